@@ -92,6 +92,16 @@ func main() {
 	})
 	log := logger.Module("main")
 
+	// Worker 模式：连接控制面，在本机 Docker 上代为运行会话
+	if len(os.Args) > 1 && os.Args[1] == "worker" {
+		os.Exit(runWorker(os.Args[2:]))
+	}
+
+	// 离线主密钥轮换：将所有密文用当前主密钥重新加密
+	if len(os.Args) > 1 && os.Args[1] == "rotate-secrets" {
+		os.Exit(runRotateSecrets())
+	}
+
 	// 打印 Banner
 	fmt.Print(banner)
 	fmt.Printf("AgentBox v%s\n", version)
@@ -138,14 +148,20 @@ func main() {
 		return fileStore.BindTask(fileID, taskID, api.FilePurposeAttachment)
 	})
 
-	// 设置文件路径解析回调（挂载附件时获取磁盘路径）
-	application.Task.SetFilePathResolver(func(fileID string) (string, string, error) {
+	// 设置文件路径解析回调（挂载附件、批量任务从文件导入输入时获取磁盘路径）
+	resolveFilePath := func(fileID string) (string, string, error) {
 		record, err := fileStore.Get(fileID)
 		if err != nil {
 			return "", "", err
 		}
 		return record.Path, record.Name, nil
-	})
+	}
+	application.Task.SetFilePathResolver(resolveFilePath)
+	application.Batch.SetFileResolver(resolveFilePath)
+
+	// 设置输出文件登记回调（每轮执行后将工作区产出文件登记为 Task 输出）
+	application.Task.SetOutputFileRegistrar(api.NewOutputFileRegistrar(cfg.Files.UploadDir, fileStore))
+	application.Task.SetOutputFileRemover(api.NewOutputFileRemover(cfg.Files.UploadDir, fileStore))
 
 	// 启动后台服务（Task Manager 等）
 	application.Start()
@@ -180,6 +196,13 @@ func main() {
 		FilesConfig:     cfg.Files,
 		FileStore:       fileStore,
 		OAuthSync:       oauthSyncMgr,
+		Search:          application.Search,
+		Views:           application.Views,
+		Workers:         application.Workers,
+		Cluster:         application.Cluster,
+		LLMProxy:        application.LLMProxy,
+		Secrets:         application.Secrets,
+		ProviderHealth:  application.ProviderHealth,
 	})
 
 	// 打印 API 路由信息
@@ -236,7 +259,11 @@ func printRoutes() {
 	fmt.Println("  *      /api/v1/providers/*            - Provider management (CRUD)")
 	fmt.Println("  *      /api/v1/sessions/*             - Session management (CRUD)")
 	fmt.Println("  *      /api/v1/tasks/*                - Task management (CRUD)")
+	fmt.Println("  GET    /api/v1/tasks/:id/files        - Task output files (list / download / zip)")
+	fmt.Println("  *      /api/v1/workflows/*            - Workflow (task DAG) management + runs")
 	fmt.Println("  *      /api/v1/batches/*              - Batch task management (Worker pool)")
+	fmt.Println("  GET    /api/v1/search                 - Full-text search (tasks, turns, results, messages)")
+	fmt.Println("  *      /api/v1/views/*                - Saved list views (task / batch filters)")
 	fmt.Println("  *      /api/v1/files/*                - File upload (CRUD)")
 	fmt.Println("  *      /api/v1/webhooks/*             - Webhook management (CRUD)")
 	fmt.Println("  *      /api/v1/history/*              - Execution history (Read)")
@@ -252,5 +279,7 @@ func printRoutes() {
 	fmt.Println("  *      /api/v1/admin/settings/*       - Business settings")
 	fmt.Println("  *      /api/v1/admin/crons/*          - Cron job management")
 	fmt.Println("  *      /api/v1/admin/channels/*       - Channel management (Feishu, etc.)")
+	fmt.Println("  GET    /api/v1/admin/workers          - Connected worker nodes (agentbox worker)")
+	fmt.Println("  GET    /api/v1/admin/cluster/*        - Server instances and current leader")
 	fmt.Println()
 }
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/tmalldedede/agentbox/internal/app"
+	"github.com/tmalldedede/agentbox/internal/config"
+	"github.com/tmalldedede/agentbox/internal/database"
+	"github.com/tmalldedede/agentbox/internal/logger"
+)
+
+// runRotateSecrets 将所有密文用当前主密钥重新加密（agentbox rotate-secrets）。
+// 需在服务停止时执行；服务运行时使用 POST /api/v1/admin/secrets/rotate。
+func runRotateSecrets() int {
+	log := logger.Module("secrets")
+	cfg := config.Load()
+
+	if err := database.Initialize(database.Config{
+		Driver:   cfg.Database.Driver,
+		DSN:      cfg.Database.DSN,
+		LogLevel: cfg.Database.LogLevel,
+	}); err != nil {
+		log.Error("failed to initialize database", "error", err)
+		return 1
+	}
+	defer database.Close()
+
+	report, err := app.RotateSecrets(cfg)
+	if err != nil {
+		log.Error("failed to rotate secrets", "error", err)
+		return 1
+	}
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	if err := report.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "agentbox rotate-secrets: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/tmalldedede/agentbox/internal/container"
+	"github.com/tmalldedede/agentbox/internal/labels"
+	"github.com/tmalldedede/agentbox/internal/logger"
+	"github.com/tmalldedede/agentbox/internal/worker"
+)
+
+// runWorker 运行 Worker 节点（agentbox worker --server http://control-plane:18080 --token xxx）
+func runWorker(args []string) int {
+	log := logger.Module("worker")
+
+	fs := flag.NewFlagSet("worker", flag.ExitOnError)
+	server := fs.String("server", os.Getenv("AGENTBOX_SERVER_URL"), "control plane URL, e.g. http://agentbox:18080 (env AGENTBOX_SERVER_URL)")
+	token := fs.String("token", os.Getenv("AGENTBOX_WORKER_TOKEN"), "worker token configured on the control plane (env AGENTBOX_WORKER_TOKEN)")
+	id := fs.String("id", os.Getenv("AGENTBOX_WORKER_ID"), "node id (default: hostname)")
+	name := fs.String("name", "", "node display name (default: node id)")
+	labelSet := fs.String("labels", os.Getenv("AGENTBOX_WORKER_LABELS"), "node labels, e.g. gpu=true,region=eu")
+	capacity := fs.Int("capacity", 0, "max concurrent sessions (0 = unlimited)")
+	workspace := fs.String("workspace", envOr("AGENTBOX_WORKSPACE_BASE", "data/workspaces"), "local workspace base directory")
+	pullImages := fs.Bool("pull-images", false, "accept sessions whose image is not present locally (pulled on demand)")
+	fs.Parse(args)
+
+	if *server == "" || *token == "" {
+		fmt.Fprintln(os.Stderr, "agentbox worker: --server and --token are required")
+		fs.Usage()
+		return 2
+	}
+	nodeLabels, err := labels.ParseSet(*labelSet)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "agentbox worker: %v\n", err)
+		return 2
+	}
+
+	docker, err := container.NewDockerManager()
+	if err != nil {
+		log.Error("failed to initialize docker", "error", err)
+		return 1
+	}
+	defer docker.Close()
+	pingCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	err = docker.Ping(pingCtx)
+	cancel()
+	if err != nil {
+		log.Error("docker is not reachable", "error", err)
+		return 1
+	}
+
+	client := worker.NewClient(worker.Options{
+		ServerURL:     *server,
+		Token:         *token,
+		ID:            *id,
+		Name:          *name,
+		Version:       version,
+		Labels:        nodeLabels,
+		Capacity:      *capacity,
+		WorkspaceBase: *workspace,
+		PullImages:    *pullImages,
+	}, docker)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("AgentBox worker v%s connecting to %s\n", version, *server)
+	if err := client.Run(ctx); err != nil {
+		log.Error("worker stopped", "error", err)
+		return 1
+	}
+	log.Info("worker stopped")
+	return 0
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
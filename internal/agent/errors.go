@@ -4,14 +4,16 @@ import "github.com/tmalldedede/agentbox/internal/apperr"
 
 // Error definitions for agent package
 var (
-	ErrAgentIDRequired       = apperr.BadRequest("agent ID is required")
-	ErrAgentNameRequired     = apperr.BadRequest("agent name is required")
-	ErrAgentAdapterRequired  = apperr.BadRequest("agent adapter is required")
-	ErrAgentInvalidAdapter   = apperr.BadRequest("agent adapter must be one of: claude-code, codex, opencode")
-	ErrAgentProviderRequired = apperr.BadRequest("agent provider_id is required")
-	ErrAgentNotFound         = apperr.NotFound("agent")
-	ErrAgentAlreadyExists    = apperr.Conflict("agent already exists")
-	ErrAgentInactive         = apperr.BadRequest("agent is not active")
-	ErrProviderNotFound      = apperr.BadRequest("referenced provider not found")
-	ErrRuntimeNotFound       = apperr.BadRequest("referenced runtime not found")
+	ErrAgentIDRequired          = apperr.BadRequest("agent ID is required")
+	ErrAgentNameRequired        = apperr.BadRequest("agent name is required")
+	ErrAgentAdapterRequired     = apperr.BadRequest("agent adapter is required")
+	ErrAgentInvalidAdapter      = apperr.BadRequest("agent adapter must be one of: claude-code, codex, opencode")
+	ErrAgentProviderRequired    = apperr.BadRequest("agent provider_id is required")
+	ErrAgentNotFound            = apperr.NotFound("agent")
+	ErrAgentAlreadyExists       = apperr.Conflict("agent already exists")
+	ErrAgentInactive            = apperr.BadRequest("agent is not active")
+	ErrProviderNotFound         = apperr.BadRequest("referenced provider not found")
+	ErrRuntimeNotFound          = apperr.BadRequest("referenced runtime not found")
+	ErrAgentApprovalUnsupported = apperr.BadRequest("tool approval is only supported for claude-code agents")
+	ErrAgentInvalidApproval     = apperr.BadRequest("approval default_action must be allow or deny, timeout must not be negative")
 )
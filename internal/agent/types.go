@@ -6,6 +6,10 @@ package agent
 import (
 	"encoding/json"
 	"time"
+
+	"github.com/tmalldedede/agentbox/internal/apperr"
+	"github.com/tmalldedede/agentbox/internal/eval"
+	"github.com/tmalldedede/agentbox/internal/labels"
 )
 
 // Agent represents a complete AI agent configuration.
@@ -48,13 +52,35 @@ type Agent struct {
 	// Permissions
 	Permissions PermissionConfig `json:"permissions"`
 
+	// Human-in-the-loop tool approval (Claude Code only).
+	// When enabled, permission prompts are routed to AgentBox and the task
+	// pauses in waiting_approval until a user approves or denies the call.
+	Approval *ApprovalConfig `json:"approval,omitempty"`
+
+	// Automatic retries for failed task executions (overridable per task)
+	Retry *RetryPolicy `json:"retry,omitempty"`
+
+	// Automatic checks run against every successful task result
+	Evaluators []eval.Evaluator `json:"evaluators,omitempty"`
+
 	// Default workspace path (relative to workspaceBase, or absolute)
 	// If empty, auto-generated as "agent-{id}-{task-id}" per task
 	Workspace string `json:"workspace,omitempty"`
 
+	// Output files collected from the workspace after each turn.
+	// Glob patterns are matched against the workspace-relative path and the base name.
+	// Empty patterns collect every created/modified file; excludes add to the built-in
+	// defaults (node_modules, .git, __pycache__, ...) and prune whole directories.
+	OutputFilePatterns []string `json:"output_file_patterns,omitempty"`
+	OutputFileExcludes []string `json:"output_file_excludes,omitempty"`
+
 	// Environment variables (injected into container)
 	Env map[string]string `json:"env,omitempty"`
 
+	// Label selector restricting which worker nodes may run this agent's
+	// sessions (e.g. "gpu=true,region in (eu,us)"). Empty allows any node.
+	NodeSelector string `json:"node_selector,omitempty"`
+
 	// API access settings
 	APIAccess  string `json:"api_access"`            // public, api_key, private
 	RateLimit  int    `json:"rate_limit,omitempty"`   // requests per minute
@@ -120,6 +146,118 @@ type PermissionConfig struct {
 	AdditionalDirs []string `json:"additional_dirs,omitempty"` // --add-dir
 }
 
+// ApprovalConfig defines the tool approval policy
+type ApprovalConfig struct {
+	Enabled       bool     `json:"enabled"`
+	Timeout       int      `json:"timeout,omitempty"`        // seconds to wait for a decision, default 600
+	DefaultAction string   `json:"default_action,omitempty"` // decision applied on timeout: deny (default) / allow
+	AutoApprove   []string `json:"auto_approve,omitempty"`   // tool names that never need approval
+}
+
+// Approval default actions
+const (
+	ApprovalActionAllow = "allow"
+	ApprovalActionDeny  = "deny"
+)
+
+// DefaultApprovalTimeout is used when ApprovalConfig.Timeout is not set
+const DefaultApprovalTimeout = 600
+
+// ApprovalEnabled reports whether tool approval is enabled for the agent
+func (a *Agent) ApprovalEnabled() bool {
+	return a.Approval != nil && a.Approval.Enabled
+}
+
+// RetryPolicy defines automatic retries of a failed task execution.
+// Retries are requeued with exponential backoff and jitter.
+type RetryPolicy struct {
+	MaxAttempts    int      `json:"max_attempts"`              // total attempts including the first; <= 1 disables retries
+	InitialBackoff int      `json:"initial_backoff,omitempty"` // seconds before the first retry, default 10
+	MaxBackoff     int      `json:"max_backoff,omitempty"`     // upper bound of the backoff in seconds, default 300
+	Multiplier     float64  `json:"multiplier,omitempty"`      // backoff growth factor, default 2
+	Jitter         float64  `json:"jitter,omitempty"`          // random spread as a fraction of the backoff (0-1), default 0.2
+	RetryOn        []string `json:"retry_on,omitempty"`        // retryable error classes, default DefaultRetryClasses
+	ReuseWorkspace bool     `json:"reuse_workspace,omitempty"` // run retries in the workspace of the failed attempt
+}
+
+// RetryClassContainer is the error class of container / session setup failures.
+// The other error classes are the apperr.FailoverReason values.
+const RetryClassContainer = "container"
+
+// Retry policy limits and defaults
+const (
+	MaxRetryAttempts      = 10
+	DefaultInitialBackoff = 10
+	DefaultMaxBackoff     = 300
+	DefaultBackoffFactor  = 2.0
+	DefaultRetryJitter    = 0.2
+)
+
+// DefaultRetryClasses are the transient error classes retried when RetryOn is empty
+var DefaultRetryClasses = []string{
+	string(apperr.ReasonRateLimit),
+	string(apperr.ReasonOverloaded),
+	string(apperr.ReasonTimeout),
+	string(apperr.ReasonNetworkError),
+	string(apperr.ReasonServerError),
+	RetryClassContainer,
+}
+
+// retryClasses are all error classes accepted in RetryOn
+var retryClasses = map[string]bool{
+	string(apperr.ReasonRateLimit):     true,
+	string(apperr.ReasonOverloaded):    true,
+	string(apperr.ReasonTimeout):       true,
+	string(apperr.ReasonAuthFailed):    true,
+	string(apperr.ReasonBadRequest):    true,
+	string(apperr.ReasonContextWindow): true,
+	string(apperr.ReasonNetworkError):  true,
+	string(apperr.ReasonServerError):   true,
+	string(apperr.ReasonUnknown):       true,
+	RetryClassContainer:                true,
+}
+
+// Enabled reports whether the policy allows any retry
+func (p *RetryPolicy) Enabled() bool {
+	return p != nil && p.MaxAttempts > 1
+}
+
+// Retryable reports whether failures of the given error class are retried
+func (p *RetryPolicy) Retryable(class string) bool {
+	classes := p.RetryOn
+	if len(classes) == 0 {
+		classes = DefaultRetryClasses
+	}
+	for _, c := range classes {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate validates the retry policy
+func (p *RetryPolicy) Validate() error {
+	if p.MaxAttempts < 0 || p.MaxAttempts > MaxRetryAttempts {
+		return apperr.BadRequestf("retry max_attempts must be between 0 and %d", MaxRetryAttempts)
+	}
+	if p.InitialBackoff < 0 || p.MaxBackoff < 0 {
+		return apperr.BadRequest("retry backoff must not be negative")
+	}
+	if p.Multiplier != 0 && p.Multiplier < 1 {
+		return apperr.BadRequest("retry multiplier must be >= 1")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return apperr.BadRequest("retry jitter must be between 0 and 1")
+	}
+	for _, c := range p.RetryOn {
+		if !retryClasses[c] {
+			return apperr.BadRequestf("unknown retry error class: %s", c)
+		}
+	}
+	return nil
+}
+
 // FeatureConfig defines feature flags
 type FeatureConfig struct {
 	WebSearch bool `json:"web_search,omitempty"`
@@ -170,6 +308,28 @@ func (a *Agent) Validate() error {
 	if a.ProviderID == "" {
 		return ErrAgentProviderRequired
 	}
+	if a.ApprovalEnabled() {
+		if a.Adapter != AdapterClaudeCode {
+			return ErrAgentApprovalUnsupported
+		}
+		if a.Approval.Timeout < 0 {
+			return ErrAgentInvalidApproval
+		}
+		if d := a.Approval.DefaultAction; d != "" && d != ApprovalActionAllow && d != ApprovalActionDeny {
+			return ErrAgentInvalidApproval
+		}
+	}
+	if a.Retry != nil {
+		if err := a.Retry.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := eval.Validate(a.Evaluators); err != nil {
+		return apperr.BadRequest(err.Error())
+	}
+	if _, err := labels.Parse(a.NodeSelector); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -287,6 +287,11 @@ func (h *AgentHandler) Run(c *gin.Context) {
 		HandleError(c, agent.ErrAgentInactive)
 		return
 	}
+	// 直接运行不经工具审批，要求审批的 Agent 需以任务方式执行
+	if ag.ApprovalEnabled() {
+		HandleError(c, session.ErrApprovalRequired)
+		return
+	}
 
 	var req RunAgentReq
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -397,8 +402,9 @@ func (h *AgentHandler) Run(c *gin.Context) {
 			var usage *history.UsageInfo
 			if result.Usage != nil {
 				usage = &history.UsageInfo{
-					InputTokens:  result.Usage.InputTokens,
-					OutputTokens: result.Usage.OutputTokens,
+					InputTokens:       result.Usage.InputTokens,
+					CachedInputTokens: result.Usage.CachedInputTokens,
+					OutputTokens:      result.Usage.OutputTokens,
 				}
 			}
 			_ = h.historyMgr.Complete(execID, result.Message, usage)
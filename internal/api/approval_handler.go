@@ -0,0 +1,267 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tmalldedede/agentbox/internal/task"
+)
+
+// ApprovalHandler 工具审批 API 处理器
+type ApprovalHandler struct {
+	manager *task.Manager
+}
+
+// NewApprovalHandler 创建工具审批处理器
+func NewApprovalHandler(manager *task.Manager) *ApprovalHandler {
+	return &ApprovalHandler{manager: manager}
+}
+
+// RegisterRoutes 注册路由（需认证）
+func (h *ApprovalHandler) RegisterRoutes(r *gin.RouterGroup) {
+	approvals := r.Group("/approvals")
+	{
+		approvals.GET("", h.List)
+		approvals.GET("/:id", h.Get)
+		approvals.POST("/:id/approve", h.Approve)
+		approvals.POST("/:id/deny", h.Deny)
+	}
+	r.GET("/tasks/:id/approvals", h.ListByTask)
+}
+
+// RegisterPublicRoutes 注册容器内 Agent 调用的 MCP 端点（通过路径中的一次性 token 认证）
+func (h *ApprovalHandler) RegisterPublicRoutes(r *gin.RouterGroup) {
+	r.POST("/approvals/mcp/:token", h.HandleMCP)
+}
+
+// DecideApprovalRequest 审批决定请求
+type DecideApprovalRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// checkApprovalOwnership 检查审批归属权（非 admin 用户只能处理自己任务的审批）
+func (h *ApprovalHandler) checkApprovalOwnership(c *gin.Context, id string) (*task.Approval, bool) {
+	approval, err := h.manager.GetApproval(id)
+	if err != nil {
+		HandleError(c, err)
+		return nil, false
+	}
+	if c.GetString("role") != "admin" && approval.UserID != c.GetString("user_id") {
+		Forbidden(c, "access denied: not your approval")
+		return nil, false
+	}
+	return approval, true
+}
+
+// List 列出审批请求
+// GET /api/v1/approvals?status=pending
+func (h *ApprovalHandler) List(c *gin.Context) {
+	filter := &task.ApprovalFilter{}
+	if c.GetString("role") != "admin" {
+		filter.UserID = c.GetString("user_id")
+	}
+	if status := c.Query("status"); status != "" {
+		filter.Status = []task.ApprovalStatus{task.ApprovalStatus(status)}
+	}
+	if taskID := c.Query("task_id"); taskID != "" {
+		filter.TaskID = taskID
+	}
+
+	approvals, err := h.manager.ListApprovals(filter)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	Success(c, gin.H{"approvals": approvals, "total": len(approvals)})
+}
+
+// ListByTask 列出任务的审批请求
+// GET /api/v1/tasks/:id/approvals
+func (h *ApprovalHandler) ListByTask(c *gin.Context) {
+	t, err := h.manager.GetTask(c.Param("id"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	if c.GetString("role") != "admin" && t.UserID != c.GetString("user_id") {
+		Forbidden(c, "access denied: not your task")
+		return
+	}
+
+	approvals, err := h.manager.ListApprovals(&task.ApprovalFilter{TaskID: t.ID})
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	Success(c, gin.H{"approvals": approvals, "total": len(approvals)})
+}
+
+// Get 获取审批请求
+// GET /api/v1/approvals/:id
+func (h *ApprovalHandler) Get(c *gin.Context) {
+	approval, ok := h.checkApprovalOwnership(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	Success(c, approval)
+}
+
+// Approve 批准工具调用
+// POST /api/v1/approvals/:id/approve
+func (h *ApprovalHandler) Approve(c *gin.Context) {
+	h.decide(c, true)
+}
+
+// Deny 拒绝工具调用
+// POST /api/v1/approvals/:id/deny
+func (h *ApprovalHandler) Deny(c *gin.Context) {
+	h.decide(c, false)
+}
+
+func (h *ApprovalHandler) decide(c *gin.Context, approve bool) {
+	if _, ok := h.checkApprovalOwnership(c, c.Param("id")); !ok {
+		return
+	}
+
+	var req DecideApprovalRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			BadRequest(c, err.Error())
+			return
+		}
+	}
+
+	approval, err := h.manager.DecideApproval(c.Param("id"), approve, req.Reason, c.GetString("user_id"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	Success(c, approval)
+}
+
+// ==================== 审批 MCP 端点 ====================
+
+// approvalToolName 审批 MCP 服务器提供的工具名（Agent 侧全名见 task.ApprovalPromptTool）
+const approvalToolName = "approval_prompt"
+
+// mcpProtocolVersion 客户端未指定协议版本时使用的版本
+const mcpProtocolVersion = "2025-03-26"
+
+// mcpRequest JSON-RPC 请求
+type mcpRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// mcpError JSON-RPC 错误
+type mcpError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// approvalPromptArgs 权限审批工具参数（由 Claude Code 传入）
+type approvalPromptArgs struct {
+	ToolName  string                 `json:"tool_name"`
+	Input     map[string]interface{} `json:"input"`
+	ToolUseID string                 `json:"tool_use_id,omitempty"`
+}
+
+// HandleMCP 处理 Agent 的 MCP 请求（Streamable HTTP，仅 JSON 响应）
+// POST /api/v1/approvals/mcp/:token
+func (h *ApprovalHandler) HandleMCP(c *gin.Context) {
+	var req mcpRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.mcpReply(c, nil, nil, &mcpError{Code: -32700, Message: "parse error"})
+		return
+	}
+
+	// 通知无需响应
+	if len(req.ID) == 0 {
+		c.Status(http.StatusAccepted)
+		return
+	}
+
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(req.Params, &params)
+		if params.ProtocolVersion == "" {
+			params.ProtocolVersion = mcpProtocolVersion
+		}
+		h.mcpReply(c, req.ID, gin.H{
+			"protocolVersion": params.ProtocolVersion,
+			"capabilities":    gin.H{"tools": gin.H{}},
+			"serverInfo":      gin.H{"name": task.ApprovalMCPServerName, "version": "1.0.0"},
+		}, nil)
+
+	case "ping":
+		h.mcpReply(c, req.ID, gin.H{}, nil)
+
+	case "tools/list":
+		h.mcpReply(c, req.ID, gin.H{"tools": []gin.H{{
+			"name":        approvalToolName,
+			"description": "Ask the AgentBox user to approve or deny a tool call",
+			"inputSchema": gin.H{
+				"type": "object",
+				"properties": gin.H{
+					"tool_name":   gin.H{"type": "string"},
+					"input":       gin.H{"type": "object"},
+					"tool_use_id": gin.H{"type": "string"},
+				},
+				"required": []string{"tool_name", "input"},
+			},
+		}}}, nil)
+
+	case "tools/call":
+		var params struct {
+			Name      string             `json:"name"`
+			Arguments approvalPromptArgs `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil || params.Name != approvalToolName {
+			h.mcpReply(c, req.ID, nil, &mcpError{Code: -32602, Message: "unknown tool or invalid arguments"})
+			return
+		}
+
+		approval, err := h.manager.RequestApproval(c.Request.Context(), c.Param("token"), params.Arguments.ToolName, params.Arguments.Input)
+		if err != nil {
+			h.mcpReply(c, req.ID, nil, &mcpError{Code: -32000, Message: err.Error()})
+			return
+		}
+
+		input := params.Arguments.Input
+		if input == nil {
+			input = map[string]interface{}{}
+		}
+		decision := gin.H{"behavior": "allow", "updatedInput": input}
+		if !approval.Allowed() {
+			message := "denied by user"
+			if approval.Reason != "" {
+				message = approval.Reason
+			}
+			decision = gin.H{"behavior": "deny", "message": message}
+		}
+		text, _ := json.Marshal(decision)
+		h.mcpReply(c, req.ID, gin.H{
+			"content": []gin.H{{"type": "text", "text": string(text)}},
+		}, nil)
+
+	default:
+		h.mcpReply(c, req.ID, nil, &mcpError{Code: -32601, Message: "method not found: " + req.Method})
+	}
+}
+
+// mcpReply 写入 JSON-RPC 响应
+func (h *ApprovalHandler) mcpReply(c *gin.Context, id json.RawMessage, result interface{}, rpcErr *mcpError) {
+	resp := gin.H{"jsonrpc": "2.0", "id": id}
+	if rpcErr != nil {
+		resp["error"] = rpcErr
+	} else {
+		resp["result"] = result
+	}
+	c.JSON(http.StatusOK, resp)
+}
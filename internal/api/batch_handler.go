@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,11 +12,13 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"github.com/tmalldedede/agentbox/internal/batch"
+	"github.com/tmalldedede/agentbox/internal/view"
 )
 
 // BatchHandler handles batch API requests.
 type BatchHandler struct {
 	batchMgr *batch.Manager
+	views    *view.GormStore // saved views (optional)
 }
 
 // NewBatchHandler creates a new batch handler.
@@ -25,14 +28,23 @@ func NewBatchHandler(batchMgr *batch.Manager) *BatchHandler {
 	}
 }
 
+// SetViewStore sets the saved view store used by view=<id> on the list endpoint.
+func (h *BatchHandler) SetViewStore(views *view.GormStore) {
+	h.views = views
+}
+
 // RegisterRoutes registers batch routes.
 func (h *BatchHandler) RegisterRoutes(r *gin.RouterGroup) {
 	batches := r.Group("/batches")
 	{
 		batches.POST("", h.Create)
+		batches.POST("/dry-run", h.DryRun)
 		batches.GET("", h.List)
 		batches.GET("/:id", h.Get)
 		batches.DELETE("/:id", h.Delete)
+		batches.PUT("/:id/labels", h.SetLabels)
+		batches.PUT("/:id/schedule", h.UpdateSchedule)
+		batches.POST("/:id/inputs", h.AppendInputs)
 		batches.POST("/:id/start", h.Start)
 		batches.POST("/:id/pause", h.Pause)
 		batches.POST("/:id/resume", h.Resume)
@@ -43,6 +55,7 @@ func (h *BatchHandler) RegisterRoutes(r *gin.RouterGroup) {
 		batches.GET("/:id/stats", h.GetStats)
 		batches.GET("/:id/events", h.StreamEvents)
 		batches.GET("/:id/export", h.Export)
+		batches.GET("/:id/comparison", h.GetComparison)
 
 		// Dead letter queue operations
 		batches.GET("/:id/dead", h.ListDeadTasks)
@@ -52,6 +65,7 @@ func (h *BatchHandler) RegisterRoutes(r *gin.RouterGroup) {
 	// Queue overview (global)
 	r.GET("/queue/overview", h.GetQueueOverview)
 	r.GET("/queue/pool", h.GetPoolStats)
+	r.GET("/queue/budgets", h.GetBudgets)
 }
 
 // Create creates a new batch.
@@ -66,28 +80,89 @@ func (h *BatchHandler) Create(c *gin.Context) {
 
 	b, err := h.batchMgr.Create(&req)
 	if err != nil {
-		Error(c, http.StatusBadRequest, err.Error())
+		batchInputError(c, err)
 		return
 	}
 
 	Created(c, b)
 }
 
+// DryRun validates a batch request, renders every prompt and estimates tokens, cost and
+// duration without creating the batch.
+// POST /api/v1/batches/dry-run
+func (h *BatchHandler) DryRun(c *gin.Context) {
+	var req batch.DryRunRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "invalid request: "+err.Error())
+		return
+	}
+
+	req.UserID = c.GetString("user_id")
+
+	result, err := h.batchMgr.DryRun(c.Request.Context(), &req)
+	if err != nil {
+		batchInputError(c, err)
+		return
+	}
+
+	Success(c, result)
+}
+
+// AppendInputs adds tasks to a pending or paused batch from inline inputs or an uploaded file.
+// POST /api/v1/batches/:id/inputs
+func (h *BatchHandler) AppendInputs(c *gin.Context) {
+	b, ok := h.checkBatchOwnership(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var req batch.AppendInputsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "invalid request: "+err.Error())
+		return
+	}
+
+	b, err := h.batchMgr.AppendInputs(b.ID, &req)
+	if err != nil {
+		batchInputError(c, err)
+		return
+	}
+
+	Success(c, b)
+}
+
+// batchInputError 返回 400，输入文件存在无效行时在 data 中附带逐行错误
+func batchInputError(c *gin.Context, err error) {
+	var importErr *batch.ImportError
+	if errors.As(err, &importErr) {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+			Data:    importErr.Result,
+		})
+		return
+	}
+	Error(c, http.StatusBadRequest, err.Error())
+}
+
 // List returns all batches with optional filtering.
+// GET /api/v1/batches?status=&agent_id=&labels=&view=&limit=&offset=
 func (h *BatchHandler) List(c *gin.Context) {
-	filter := &batch.ListBatchFilter{}
+	vf, selector, ok := listFilter(c, h.views, view.ResourceBatches)
+	if !ok {
+		return
+	}
+	filter := &batch.ListBatchFilter{
+		Status:  batch.BatchStatus(vf.Status),
+		AgentID: vf.AgentID,
+		Labels:  selector,
+	}
 
 	// 非 admin 用户只能看自己的 batch
 	if role := c.GetString("role"); role != "admin" {
 		filter.UserID = c.GetString("user_id")
 	}
 
-	if status := c.Query("status"); status != "" {
-		filter.Status = batch.BatchStatus(status)
-	}
-	if agentID := c.Query("agent_id"); agentID != "" {
-		filter.AgentID = agentID
-	}
 	if limit := c.Query("limit"); limit != "" {
 		if l, err := strconv.Atoi(limit); err == nil {
 			filter.Limit = l
@@ -108,6 +183,50 @@ func (h *BatchHandler) List(c *gin.Context) {
 	SuccessWithPagination(c, gin.H{"batches": batches}, total, filter.Limit, filter.Offset)
 }
 
+// SetLabels replaces the labels of a batch.
+// PUT /api/v1/batches/:id/labels
+func (h *BatchHandler) SetLabels(c *gin.Context) {
+	b, ok := h.checkBatchOwnership(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var req SetLabelsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+
+	b, err := h.batchMgr.SetLabels(b.ID, req.Labels)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	Success(c, b)
+}
+
+// UpdateSchedule changes the priority and schedule windows of a batch.
+// PUT /api/v1/batches/:id/schedule
+func (h *BatchHandler) UpdateSchedule(c *gin.Context) {
+	b, ok := h.checkBatchOwnership(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var req batch.UpdateScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+
+	b, err := h.batchMgr.UpdateSchedule(b.ID, &req)
+	if err != nil {
+		Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	Success(c, b)
+}
+
 // checkBatchOwnership 检查 batch 归属权（非 admin 用户只能访问自己的 batch）
 func (h *BatchHandler) checkBatchOwnership(c *gin.Context, batchID string) (*batch.Batch, bool) {
 	b, err := h.batchMgr.Get(batchID)
@@ -261,6 +380,9 @@ func (h *BatchHandler) ListTasks(c *gin.Context) {
 	if workerID := c.Query("worker_id"); workerID != "" {
 		filter.WorkerID = workerID
 	}
+	if variant := c.Query("variant"); variant != "" {
+		filter.Variant = variant
+	}
 	if limit := c.Query("limit"); limit != "" {
 		if l, err := strconv.Atoi(limit); err == nil {
 			filter.Limit = l
@@ -317,6 +439,26 @@ func (h *BatchHandler) GetStats(c *gin.Context) {
 	Success(c, stats)
 }
 
+// GetComparison returns the per-variant comparison report of an experiment batch.
+func (h *BatchHandler) GetComparison(c *gin.Context) {
+	b, ok := h.checkBatchOwnership(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if len(b.Template.Variants) == 0 {
+		Error(c, http.StatusBadRequest, "batch is not an experiment")
+		return
+	}
+
+	report, err := h.batchMgr.Compare(b.ID)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	Success(c, report)
+}
+
 // StreamEvents streams batch events via SSE.
 func (h *BatchHandler) StreamEvents(c *gin.Context) {
 	// Verify batch exists and has permission
@@ -363,6 +505,11 @@ func (h *BatchHandler) Export(c *gin.Context) {
 
 	format := c.DefaultQuery("format", "json")
 
+	if c.Query("layout") == "side_by_side" {
+		h.exportSideBySide(c, b, format)
+		return
+	}
+
 	// Get all completed and failed tasks
 	tasks, _, err := h.batchMgr.ListTasks(b.ID, &batch.ListTaskFilter{
 		Limit: 100000, // Get all
@@ -396,11 +543,17 @@ func (h *BatchHandler) exportCSV(c *gin.Context, batchID string, tasks []*batch.
 	defer w.Flush()
 
 	// Write header
-	w.Write([]string{"index", "status", "input", "result", "error", "duration_ms", "attempts"})
+	w.Write([]string{"index", "status", "input", "result", "error", "duration_ms", "attempts", "eval_passed", "eval_score", "eval_reasons"})
 
 	// Write rows
 	for _, task := range tasks {
 		inputJSON, _ := json.Marshal(task.Input)
+		evalPassed, evalScore, evalReasons := "", "", ""
+		if task.Evaluation != nil {
+			evalPassed = strconv.FormatBool(task.Evaluation.Passed)
+			evalScore = strconv.FormatFloat(task.Evaluation.Score, 'f', 3, 64)
+			evalReasons = task.Evaluation.Reasons()
+		}
 		w.Write([]string{
 			strconv.Itoa(task.Index),
 			string(task.Status),
@@ -409,7 +562,71 @@ func (h *BatchHandler) exportCSV(c *gin.Context, batchID string, tasks []*batch.
 			task.Error,
 			strconv.FormatInt(task.DurationMs, 10),
 			strconv.Itoa(task.Attempts),
+			evalPassed,
+			evalScore,
+			evalReasons,
+		})
+	}
+}
+
+// exportSideBySide exports an experiment batch with one row per input and the results of
+// every variant side by side.
+func (h *BatchHandler) exportSideBySide(c *gin.Context, b *batch.Batch, format string) {
+	if len(b.Template.Variants) == 0 {
+		Error(c, http.StatusBadRequest, "side_by_side layout requires an experiment batch")
+		return
+	}
+	variants, rows, err := h.batchMgr.SideBySide(b.ID)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	if format != "csv" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-comparison.json\"", b.ID))
+		c.JSON(http.StatusOK, gin.H{
+			"batch_id": b.ID,
+			"variants": variants,
+			"rows":     rows,
 		})
+		return
+	}
+
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-comparison.csv\"", b.ID))
+
+	w := csv.NewWriter(c.Writer)
+	defer w.Flush()
+
+	header := []string{"row", "input"}
+	for _, v := range variants {
+		for _, col := range []string{"status", "result", "error", "duration_ms", "input_tokens", "output_tokens", "eval_passed", "eval_score"} {
+			header = append(header, v.Name+":"+col)
+		}
+	}
+	w.Write(header)
+
+	for _, row := range rows {
+		inputJSON, _ := json.Marshal(row.Input)
+		record := []string{strconv.Itoa(row.Row), string(inputJSON)}
+		for _, r := range row.Results {
+			evalPassed, evalScore := "", ""
+			if r.Evaluation != nil {
+				evalPassed = strconv.FormatBool(r.Evaluation.Passed)
+				evalScore = strconv.FormatFloat(r.Evaluation.Score, 'f', 3, 64)
+			}
+			record = append(record,
+				string(r.Status),
+				r.Result,
+				r.Error,
+				strconv.FormatInt(r.DurationMs, 10),
+				strconv.FormatInt(r.InputTokens, 10),
+				strconv.FormatInt(r.OutputTokens, 10),
+				evalPassed,
+				evalScore,
+			)
+		}
+		w.Write(record)
 	}
 }
 
@@ -485,3 +702,8 @@ func (h *BatchHandler) GetPoolStats(c *gin.Context) {
 	stats := h.batchMgr.GetPoolStats()
 	Success(c, stats)
 }
+
+// GetBudgets returns the per-provider request/token budgets and their usage over the last minute.
+func (h *BatchHandler) GetBudgets(c *gin.Context) {
+	Success(c, gin.H{"budgets": h.batchMgr.GetBudgetUsage()})
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/tmalldedede/agentbox/internal/cluster"
+)
+
+// ClusterHandler 多实例协调 API 处理器
+type ClusterHandler struct {
+	cluster *cluster.Coordinator
+}
+
+// NewClusterHandler 创建多实例协调处理器
+func NewClusterHandler(c *cluster.Coordinator) *ClusterHandler {
+	return &ClusterHandler{cluster: c}
+}
+
+// RegisterRoutes 注册管理路由
+func (h *ClusterHandler) RegisterRoutes(r *gin.RouterGroup) {
+	r.GET("/cluster/instances", h.ListInstances)
+}
+
+// ListInstances 列出共享数据库的服务实例及当前 Leader
+// GET /api/v1/admin/cluster/instances
+func (h *ClusterHandler) ListInstances(c *gin.Context) {
+	if h.cluster == nil {
+		Success(c, gin.H{"instance_id": "", "leader": false, "instances": []*cluster.Instance{}, "total": 0})
+		return
+	}
+	instances, err := h.cluster.Instances()
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	Success(c, gin.H{
+		"instance_id": h.cluster.InstanceID(),
+		"leader":      h.cluster.IsLeader(),
+		"instances":   instances,
+		"total":       len(instances),
+	})
+}
@@ -91,11 +91,16 @@ type DashboardAgentDetail struct {
 
 // DashboardTaskStats Task 统计
 type DashboardTaskStats struct {
-	Total       int            `json:"total"`
-	Today       int            `json:"today"`
-	ByStatus    map[string]int `json:"by_status"`
-	AvgDuration float64        `json:"avg_duration_seconds"`
-	SuccessRate float64        `json:"success_rate"`
+	Total        int            `json:"total"`
+	Today        int            `json:"today"`
+	ByStatus     map[string]int `json:"by_status"`
+	AvgDuration  float64        `json:"avg_duration_seconds"`
+	SuccessRate  float64        `json:"success_rate"`
+	InputTokens  int64          `json:"input_tokens"`
+	OutputTokens int64          `json:"output_tokens"`
+	TotalTokens  int64          `json:"total_tokens"`
+
+	ByLabel map[string]map[string]int `json:"by_label"` // 按标签统计：key -> value -> 任务数
 }
 
 // DashboardSessionStats Session 统计
@@ -109,9 +114,10 @@ type DashboardSessionStats struct {
 
 // DashboardTokenStats Token 使用统计
 type DashboardTokenStats struct {
-	TotalInput   int64 `json:"total_input"`
-	TotalOutput  int64 `json:"total_output"`
-	TotalTokens  int64 `json:"total_tokens"`
+	TotalInput       int64 `json:"total_input"`
+	TotalCachedInput int64 `json:"total_cached_input"`
+	TotalOutput      int64 `json:"total_output"`
+	TotalTokens      int64 `json:"total_tokens"`
 }
 
 // DashboardContainerStats 容器统计
@@ -173,6 +179,7 @@ type DashboardRecentTask struct {
 	Prompt    string  `json:"prompt"`
 	Status    string  `json:"status"`
 	Duration  float64 `json:"duration_seconds"`
+	Tokens    int64   `json:"total_tokens"`
 	CreatedAt string  `json:"created_at"`
 }
 
@@ -213,7 +220,7 @@ func (h *DashboardHandler) Stats(c *gin.Context) {
 		if terr == nil {
 			for _, t := range taskList {
 				switch t.Status {
-				case task.StatusRunning:
+				case task.StatusRunning, task.StatusWaitingApproval:
 					detail.Running++
 				case task.StatusQueued, task.StatusPending:
 					detail.Queued++
@@ -229,10 +236,14 @@ func (h *DashboardHandler) Stats(c *gin.Context) {
 	}
 
 	// ==================== Task 统计 ====================
-	taskStats, err := h.taskMgr.GetStats()
+	taskStats, err := h.taskMgr.GetStats(nil)
 	if err == nil {
 		resp.Tasks.Total = taskStats.Total
 		resp.Tasks.AvgDuration = taskStats.AvgDuration
+		resp.Tasks.InputTokens = taskStats.InputTokens
+		resp.Tasks.OutputTokens = taskStats.OutputTokens
+		resp.Tasks.TotalTokens = taskStats.TotalTokens
+		resp.Tasks.ByLabel = taskStats.ByLabel
 		resp.Tasks.ByStatus = make(map[string]int)
 		for status, count := range taskStats.ByStatus {
 			resp.Tasks.ByStatus[string(status)] = count
@@ -279,6 +290,7 @@ func (h *DashboardHandler) Stats(c *gin.Context) {
 	historyStats, err := h.historyMgr.GetStats(nil)
 	if err == nil {
 		resp.Tokens.TotalInput = int64(historyStats.TotalInputTokens)
+		resp.Tokens.TotalCachedInput = int64(historyStats.TotalCachedInputTokens)
 		resp.Tokens.TotalOutput = int64(historyStats.TotalOutputTokens)
 		resp.Tokens.TotalTokens = int64(historyStats.TotalInputTokens + historyStats.TotalOutputTokens)
 	}
@@ -375,6 +387,10 @@ func (h *DashboardHandler) Stats(c *gin.Context) {
 			if t.StartedAt != nil && t.CompletedAt != nil {
 				duration = t.CompletedAt.Sub(*t.StartedAt).Seconds()
 			}
+			var tokens int64
+			if t.Usage != nil {
+				tokens = t.Usage.TotalTokens
+			}
 
 			resp.RecentTasks = append(resp.RecentTasks, DashboardRecentTask{
 				ID:        t.ID,
@@ -384,6 +400,7 @@ func (h *DashboardHandler) Stats(c *gin.Context) {
 				Prompt:    prompt,
 				Status:    string(t.Status),
 				Duration:  duration,
+				Tokens:    tokens,
 				CreatedAt: t.CreatedAt.Format(time.RFC3339),
 			})
 		}
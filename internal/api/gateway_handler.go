@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"net/http"
 
@@ -107,25 +108,37 @@ type taskManagerAdapter struct {
 	tm *task.Manager
 }
 
-func (a *taskManagerAdapter) SubscribeEvents(taskID string) <-chan *gateway.TaskEvent {
-	ch := a.tm.SubscribeEvents(taskID)
-	// 转换 channel 类型
+func (a *taskManagerAdapter) StreamEvents(ctx context.Context, taskID string, afterSeq int64) <-chan *gateway.TaskEvent {
+	ch := a.tm.OpenEventStream(ctx, taskID, afterSeq)
+	// 转换 channel 类型（源 channel 在任务结束或 ctx 取消后关闭）
 	out := make(chan *gateway.TaskEvent, 100)
 	go func() {
 		defer close(out)
 		for event := range ch {
-			out <- &gateway.TaskEvent{
-				Type: event.Type,
-				Data: event.Data,
-			}
+			out <- toGatewayEvent(event)
 		}
 	}()
 	return out
 }
 
-func (a *taskManagerAdapter) UnsubscribeEvents(taskID string, ch <-chan *gateway.TaskEvent) {
-	// 注意：这里无法直接取消订阅，因为我们包装了 channel
-	// 实际实现需要维护映射关系
+func (a *taskManagerAdapter) ReplayEvents(taskID string, afterSeq int64) ([]*gateway.TaskEvent, error) {
+	events, err := a.tm.ReplayEvents(taskID, afterSeq)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*gateway.TaskEvent, len(events))
+	for i, event := range events {
+		out[i] = toGatewayEvent(event)
+	}
+	return out, nil
+}
+
+func toGatewayEvent(event *task.TaskEvent) *gateway.TaskEvent {
+	return &gateway.TaskEvent{
+		Seq:  event.Seq,
+		Type: event.Type,
+		Data: event.Data,
+	}
 }
 
 func (a *taskManagerAdapter) CancelTask(taskID string) error {
@@ -142,3 +155,21 @@ func (a *taskManagerAdapter) CreateTask(req *gateway.CreateTaskRequest) (*gatewa
 	}
 	return &gateway.Task{ID: t.ID}, nil
 }
+
+func (a *taskManagerAdapter) DecideApproval(taskID, approvalID string, approve bool) error {
+	var approval *task.Approval
+	var err error
+	if approvalID == "" {
+		approval, err = a.tm.PendingApproval(taskID)
+	} else {
+		approval, err = a.tm.GetApproval(approvalID)
+	}
+	if err != nil {
+		return err
+	}
+	if approval.TaskID != taskID {
+		return task.ErrApprovalNotFound
+	}
+	_, err = a.tm.DecideApproval(approval.ID, approve, "", "gateway")
+	return err
+}
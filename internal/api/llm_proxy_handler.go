@@ -0,0 +1,49 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/tmalldedede/agentbox/internal/llmproxy"
+)
+
+// LLMProxyHandler LLM 凭证代理 API 处理器
+type LLMProxyHandler struct {
+	proxy *llmproxy.Proxy
+}
+
+// NewLLMProxyHandler 创建 LLM 凭证代理处理器（proxy 为 nil 表示未启用）
+func NewLLMProxyHandler(proxy *llmproxy.Proxy) *LLMProxyHandler {
+	return &LLMProxyHandler{proxy: proxy}
+}
+
+// RegisterPublicRoutes 注册容器内 Agent 调用的代理端点（通过请求头中的会话 token 认证）
+func (h *LLMProxyHandler) RegisterPublicRoutes(r *gin.RouterGroup) {
+	if h.proxy == nil {
+		return
+	}
+	r.Any("/llm-proxy/:api/*path", h.Proxy)
+}
+
+// RegisterRoutes 注册管理路由
+func (h *LLMProxyHandler) RegisterRoutes(r *gin.RouterGroup) {
+	r.GET("/llm-proxy/stats", h.Stats)
+}
+
+// Proxy 转发 Anthropic / OpenAI 兼容请求（换入真实 API Key）
+// ANY /api/v1/llm-proxy/:api/*path
+func (h *LLMProxyHandler) Proxy(c *gin.Context) {
+	h.proxy.Serve(c.Writer, c.Request, c.Param("api"), c.Param("path"))
+}
+
+// Stats 返回各 Provider 经代理的请求、延迟、错误与 Token 统计
+// GET /api/v1/admin/llm-proxy/stats
+func (h *LLMProxyHandler) Stats(c *gin.Context) {
+	if h.proxy == nil {
+		Success(c, gin.H{"enabled": false, "active_sessions": 0, "providers": []*llmproxy.ProviderStats{}})
+		return
+	}
+	Success(c, gin.H{
+		"enabled":         true,
+		"active_sessions": h.proxy.ActiveSessions(),
+		"providers":       h.proxy.Stats(),
+	})
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tmalldedede/agentbox/internal/task"
+)
+
+// NewOutputFileRegistrar 创建输出文件登记回调
+// 将工作区中的输出文件复制到上传目录（工作区可能随 Session 清理），并登记为 Task 的输出文件
+func NewOutputFileRegistrar(uploadDir string, store FileStore) task.OutputFileRegisterFunc {
+	return func(taskID, srcPath, relPath string) (*task.OutputFile, error) {
+		fileID := uuid.New().String()
+		name := filepath.Base(relPath)
+
+		fileDir := filepath.Join(uploadDir, fileID)
+		if err := os.MkdirAll(fileDir, 0755); err != nil {
+			return nil, fmt.Errorf("create file directory: %w", err)
+		}
+		dstPath := filepath.Join(fileDir, name)
+		size, err := copyOutputFile(srcPath, dstPath)
+		if err != nil {
+			os.RemoveAll(fileDir)
+			return nil, err
+		}
+
+		record := &FileRecord{
+			ID:        fileID,
+			Name:      name,
+			Size:      size,
+			MimeType:  getMimeType(name),
+			Path:      dstPath,
+			TaskID:    taskID,
+			Purpose:   FilePurposeOutput,
+			Status:    FileStatusActive,
+			CreatedAt: time.Now(),
+		}
+		if err := store.Create(record); err != nil {
+			os.RemoveAll(fileDir)
+			return nil, fmt.Errorf("save file record: %w", err)
+		}
+
+		return &task.OutputFile{
+			ID:       fileID,
+			Name:     name,
+			Path:     relPath,
+			Size:     size,
+			MimeType: record.MimeType,
+			URL:      fmt.Sprintf("/api/v1/tasks/%s/files/%s", taskID, fileID),
+		}, nil
+	}
+}
+
+// NewOutputFileRemover 创建输出文件删除回调（删除上传目录中的副本与文件记录）
+func NewOutputFileRemover(uploadDir string, store FileStore) task.OutputFileRemoveFunc {
+	return func(fileID string) error {
+		if err := os.RemoveAll(filepath.Join(uploadDir, fileID)); err != nil {
+			return fmt.Errorf("remove file directory: %w", err)
+		}
+		return store.Delete(fileID)
+	}
+}
+
+// copyOutputFile 复制文件，返回写入的字节数（超过 task.MaxOutputFileSize 时失败）
+func copyOutputFile(src, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, fmt.Errorf("open source: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return 0, fmt.Errorf("create destination: %w", err)
+	}
+	defer out.Close()
+
+	n, err := io.Copy(out, io.LimitReader(in, task.MaxOutputFileSize+1))
+	if err != nil {
+		return 0, fmt.Errorf("copy: %w", err)
+	}
+	if n > task.MaxOutputFileSize {
+		return 0, fmt.Errorf("file exceeds %d bytes", int64(task.MaxOutputFileSize))
+	}
+	return n, nil
+}
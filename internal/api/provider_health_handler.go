@@ -0,0 +1,121 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tmalldedede/agentbox/internal/providerhealth"
+)
+
+// ProviderHealthHandler Provider 健康监控（熔断器状态与探测历史）
+type ProviderHealthHandler struct {
+	monitor *providerhealth.Monitor
+}
+
+// NewProviderHealthHandler 创建 Provider 健康监控处理器
+func NewProviderHealthHandler(monitor *providerhealth.Monitor) *ProviderHealthHandler {
+	return &ProviderHealthHandler{monitor: monitor}
+}
+
+// RegisterRoutes 注册管理路由
+func (h *ProviderHealthHandler) RegisterRoutes(r *gin.RouterGroup) {
+	r.GET("/provider-health", h.Status)
+	r.GET("/provider-health/history", h.History)
+	r.POST("/provider-health/check", h.Check)
+	r.POST("/provider-health/:id/reset", h.Reset)
+}
+
+// available 监控是否已初始化
+func (h *ProviderHealthHandler) available(c *gin.Context) bool {
+	if h.monitor == nil {
+		Error(c, http.StatusServiceUnavailable, "provider health monitor not initialized")
+		return false
+	}
+	return true
+}
+
+// Status 所有 Provider 的熔断器状态与最近的状态变化
+// GET /api/v1/admin/provider-health
+func (h *ProviderHealthHandler) Status(c *gin.Context) {
+	if !h.available(c) {
+		return
+	}
+	Success(c, gin.H{
+		"providers":   h.monitor.Status(),
+		"transitions": h.monitor.Transitions(),
+	})
+}
+
+// History 探测历史与每个 Provider Key 的错误率 / 平均延迟
+// GET /api/v1/admin/provider-health/history?provider_id=&profile_id=&since=24h&limit=100
+func (h *ProviderHealthHandler) History(c *gin.Context) {
+	if !h.available(c) {
+		return
+	}
+
+	window := 24 * time.Hour
+	if s := c.Query("since"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			BadRequest(c, "invalid since: must be a positive duration such as 1h or 30m")
+			return
+		}
+		window = d
+	}
+	limit := 100
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			limit = parsed
+		}
+	}
+
+	since := time.Now().Add(-window)
+	providerID := c.Query("provider_id")
+	samples, err := h.monitor.History(&providerhealth.HistoryFilter{
+		ProviderID: providerID,
+		ProfileID:  c.Query("profile_id"),
+		Since:      since,
+		Limit:      limit,
+	})
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	summary, err := h.monitor.Summary(providerID, since)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	Success(c, gin.H{
+		"since":   since,
+		"samples": samples,
+		"summary": summary,
+	})
+}
+
+// Check 立即探测所有 Provider（结果写入历史并驱动熔断器）
+// POST /api/v1/admin/provider-health/check
+func (h *ProviderHealthHandler) Check(c *gin.Context) {
+	if !h.available(c) {
+		return
+	}
+	h.monitor.Check()
+	Success(c, gin.H{
+		"providers": h.monitor.Status(),
+	})
+}
+
+// Reset 手动关闭 Provider 的熔断器
+// POST /api/v1/admin/provider-health/:id/reset
+func (h *ProviderHealthHandler) Reset(c *gin.Context) {
+	if !h.available(c) {
+		return
+	}
+	h.monitor.Reset(c.Param("id"))
+	Success(c, gin.H{
+		"provider_id": c.Param("id"),
+		"state":       providerhealth.StateClosed,
+	})
+}
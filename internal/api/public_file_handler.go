@@ -33,6 +33,7 @@ type PublicFileHandler struct {
 	maxFileSize    int64
 	store          FileStore
 	cleanupStop    chan struct{}
+	leader         func() bool // 多实例部署时只在 Leader 上清理，nil 表示总是清理
 }
 
 // NewPublicFileHandler 创建独立文件处理器
@@ -47,6 +48,11 @@ func NewPublicFileHandler(cfg config.FilesConfig, store FileStore) *PublicFileHa
 	}
 }
 
+// SetLeaderCheck 设置 Leader 判断函数（需在 StartCleanup 之前调用）
+func (h *PublicFileHandler) SetLeaderCheck(fn func() bool) {
+	h.leader = fn
+}
+
 // StartCleanup 启动过期文件清理 goroutine
 func (h *PublicFileHandler) StartCleanup(interval time.Duration) {
 	if h.retentionHours <= 0 {
@@ -58,6 +64,9 @@ func (h *PublicFileHandler) StartCleanup(interval time.Duration) {
 		for {
 			select {
 			case <-ticker.C:
+				if h.leader != nil && !h.leader() {
+					continue
+				}
 				h.cleanupExpiredFiles()
 			case <-h.cleanupStop:
 				return
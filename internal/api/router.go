@@ -12,22 +12,28 @@ import (
 	"github.com/tmalldedede/agentbox/internal/channel/dingtalk"
 	"github.com/tmalldedede/agentbox/internal/channel/feishu"
 	"github.com/tmalldedede/agentbox/internal/channel/wecom"
+	"github.com/tmalldedede/agentbox/internal/cluster"
 	"github.com/tmalldedede/agentbox/internal/config"
 	"github.com/tmalldedede/agentbox/internal/container"
 	"github.com/tmalldedede/agentbox/internal/coordinate"
 	"github.com/tmalldedede/agentbox/internal/cron"
 	"github.com/tmalldedede/agentbox/internal/engine"
 	"github.com/tmalldedede/agentbox/internal/history"
+	"github.com/tmalldedede/agentbox/internal/llmproxy"
 	"github.com/tmalldedede/agentbox/internal/mcp"
 	"github.com/tmalldedede/agentbox/internal/oauth"
 	"github.com/tmalldedede/agentbox/internal/plugin"
 	"github.com/tmalldedede/agentbox/internal/provider"
+	"github.com/tmalldedede/agentbox/internal/providerhealth"
 	"github.com/tmalldedede/agentbox/internal/runtime"
+	"github.com/tmalldedede/agentbox/internal/search"
 	"github.com/tmalldedede/agentbox/internal/session"
 	"github.com/tmalldedede/agentbox/internal/settings"
 	"github.com/tmalldedede/agentbox/internal/skill"
 	"github.com/tmalldedede/agentbox/internal/task"
+	"github.com/tmalldedede/agentbox/internal/view"
 	"github.com/tmalldedede/agentbox/internal/webhook"
+	"github.com/tmalldedede/agentbox/internal/worker"
 )
 
 // Server HTTP 服务器
@@ -46,6 +52,11 @@ type Server struct {
 	imageHandler      *ImageHandler
 	systemHandler     *SystemHandler
 	taskHandler       *TaskHandler
+	workflowHandler   *WorkflowHandler
+	approvalHandler   *ApprovalHandler
+	templateHandler   *TemplateHandler
+	searchHandler     *SearchHandler
+	viewHandler       *ViewHandler
 	webhookHandler    *WebhookHandler
 	runtimeHandler    *RuntimeHandler
 	agentHandler      *AgentHandler
@@ -60,7 +71,12 @@ type Server struct {
 	dingtalkHandler   *DingtalkHandler
 	coordinateHandler *CoordinateHandler
 	gatewayHandler    *GatewayHandler
+	workerHandler     *WorkerHandler
+	clusterHandler    *ClusterHandler
 	oauthSyncHandler  *OAuthSyncAPI
+	llmProxyHandler   *LLMProxyHandler
+	secretsHandler    *SecretsHandler
+	healthHandler     *ProviderHealthHandler
 }
 
 // Deps 服务器依赖（从 App 容器注入）
@@ -90,6 +106,13 @@ type Deps struct {
 	FilesConfig   config.FilesConfig
 	FileStore     FileStore
 	OAuthSync     *oauth.SyncManager
+	Search        *search.Index
+	Views         *view.GormStore
+	Workers       *worker.Hub
+	Cluster       *cluster.Coordinator
+	LLMProxy      *llmproxy.Proxy // nil 表示未启用 LLM 凭证代理
+	Secrets       *provider.Secrets
+	ProviderHealth  *providerhealth.Monitor
 }
 
 // NewServer 创建服务器
@@ -111,12 +134,19 @@ func NewServer(deps *Deps) *Server {
 	skillHandler := NewSkillHandler(deps.Skill)
 	imageHandler := NewImageHandler(deps.Container)
 	systemHandler := NewSystemHandler(deps.Container, deps.Session, deps.Batch, deps.GC)
-	taskHandler := NewTaskHandler(deps.Task)
+	taskHandler := NewTaskHandler(deps.Task, deps.FileStore)
+	workflowHandler := NewWorkflowHandler(deps.Task)
+	approvalHandler := NewApprovalHandler(deps.Task)
+	templateHandler := NewTemplateHandler(deps.Task)
+	searchHandler := NewSearchHandler(deps.Search)
+	viewHandler := NewViewHandler(deps.Views)
 	webhookHandler := NewWebhookHandler(deps.Webhook)
 	agentHandler := NewAgentHandler(deps.Agent, deps.Session, deps.History)
 	historyHandler := NewHistoryHandler(deps.History)
 	dashboardHandler := NewDashboardHandler(deps.Task, deps.Agent, deps.Session, deps.Provider, deps.MCP, deps.Container, deps.History)
 	batchHandler := NewBatchHandler(deps.Batch)
+	taskHandler.SetViewStore(deps.Views)
+	batchHandler.SetViewStore(deps.Views)
 	settingsHandler := NewSettingsHandler(deps.Settings)
 	cronHandler := NewCronHandler(deps.Cron)
 	channelHandler := NewChannelHandler(deps.Channel, deps.FeishuChannel, deps.WecomChannel, deps.DingtalkChannel)
@@ -125,7 +155,12 @@ func NewServer(deps *Deps) *Server {
 	dingtalkHandler := NewDingtalkHandler()
 	coordinateHandler := NewCoordinateHandler(deps.Coordinate)
 	gatewayHandler := NewGatewayHandler(deps.Auth, deps.Task)
+	workerHandler := NewWorkerHandler(deps.Workers, deps.Session)
+	clusterHandler := NewClusterHandler(deps.Cluster)
 	oauthSyncHandler := NewOAuthSyncAPI(deps.OAuthSync, deps.Provider)
+	llmProxyHandler := NewLLMProxyHandler(deps.LLMProxy)
+	secretsHandler := NewSecretsHandler(deps.Secrets)
+	healthHandler := NewProviderHealthHandler(deps.ProviderHealth)
 
 	s := &Server{
 		engine:            engine,
@@ -142,6 +177,11 @@ func NewServer(deps *Deps) *Server {
 		imageHandler:      imageHandler,
 		systemHandler:     systemHandler,
 		taskHandler:       taskHandler,
+		workflowHandler:   workflowHandler,
+		approvalHandler:   approvalHandler,
+		templateHandler:   templateHandler,
+		searchHandler:     searchHandler,
+		viewHandler:       viewHandler,
 		webhookHandler:    webhookHandler,
 		agentHandler:      agentHandler,
 		historyHandler:    historyHandler,
@@ -155,12 +195,20 @@ func NewServer(deps *Deps) *Server {
 		dingtalkHandler:   dingtalkHandler,
 		coordinateHandler: coordinateHandler,
 		gatewayHandler:    gatewayHandler,
+		workerHandler:     workerHandler,
+		clusterHandler:    clusterHandler,
 		oauthSyncHandler:  oauthSyncHandler,
+		llmProxyHandler:   llmProxyHandler,
+		secretsHandler:    secretsHandler,
+		healthHandler:     healthHandler,
 	}
 
 	s.setupRoutes()
 
-	// 启动文件清理
+	// 启动文件清理（多实例部署时只在 Leader 上执行）
+	if deps.Cluster != nil {
+		publicFileHandler.SetLeaderCheck(deps.Cluster.IsLeader)
+	}
 	publicFileHandler.StartCleanup(deps.FilesConfig.CleanupInterval)
 
 	return s
@@ -180,6 +228,15 @@ func (s *Server) setupRoutes() {
 	// 通道 Webhook 回调（飞书等）
 	s.channelHandler.RegisterWebhookRoutes(v1)
 
+	// 工具审批 MCP 端点（容器内 Agent 调用，通过一次性 token 认证）
+	s.approvalHandler.RegisterPublicRoutes(v1)
+
+	// 远程 Worker 连接（通过 Worker token 认证）
+	s.workerHandler.RegisterPublicRoutes(v1)
+
+	// LLM 凭证代理（容器内 Agent 调用，通过会话级 token 认证）
+	s.llmProxyHandler.RegisterPublicRoutes(v1)
+
 	// ==================== 认证路由 ====================
 	authenticated := v1.Group("")
 	authenticated.Use(authMiddleware(s.authManager))
@@ -196,6 +253,21 @@ func (s *Server) setupRoutes() {
 		// Tasks (核心) - 创建/多轮/取消/SSE 事件流
 		s.taskHandler.RegisterRoutes(authenticated)
 
+		// Workflows (任务 DAG) - 多步骤编排、运行状态与 SSE 事件流
+		s.workflowHandler.RegisterRoutes(authenticated)
+
+		// Approvals (工具审批) - 批准/拒绝运行中任务的工具调用
+		s.approvalHandler.RegisterRoutes(authenticated)
+
+		// Task Templates (任务模板) - 参数化的可复用 Prompt 模板
+		s.templateHandler.RegisterRoutes(authenticated)
+
+		// Search (全文检索) - 任务 prompt / 轮次 / 结果 / 通道消息
+		s.searchHandler.RegisterRoutes(authenticated)
+
+		// Views (保存视图) - 任务 / 批量任务列表的过滤条件
+		s.viewHandler.RegisterRoutes(authenticated)
+
 		// Batches (批量任务) - Worker 池模式批量处理
 		s.batchHandler.RegisterRoutes(authenticated)
 
@@ -306,6 +378,21 @@ func (s *Server) setupRoutes() {
 
 		// Gateway (WebSocket 统计)
 		s.gatewayHandler.RegisterRoutes(admin)
+
+		// Workers (远程节点)
+		s.workerHandler.RegisterRoutes(admin)
+
+		// Cluster (多实例)
+		s.clusterHandler.RegisterRoutes(admin)
+
+		// LLM Proxy (凭证代理统计)
+		s.llmProxyHandler.RegisterRoutes(admin)
+
+		// Secrets (加密密文校验与主密钥轮换)
+		s.secretsHandler.RegisterRoutes(admin)
+
+		// Provider Health (熔断器状态与探测历史)
+		s.healthHandler.RegisterRoutes(admin)
 	}
 }
 
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tmalldedede/agentbox/internal/search"
+)
+
+// SearchHandler 全文检索 API 处理器
+type SearchHandler struct {
+	index *search.Index
+}
+
+// NewSearchHandler 创建全文检索处理器
+func NewSearchHandler(index *search.Index) *SearchHandler {
+	return &SearchHandler{index: index}
+}
+
+// RegisterRoutes 注册路由
+func (h *SearchHandler) RegisterRoutes(r *gin.RouterGroup) {
+	r.GET("/search", h.Search)
+}
+
+// Search 全文检索任务 prompt、轮次、结果与通道消息
+// GET /api/v1/search?q=&kind=task,result&agent_id=&user_id=&status=&from=&to=&limit=&offset=
+//
+// 非 admin 用户只能检索自己的任务；admin 可通过 user_id 过滤。
+// from / to 支持 RFC3339 或 YYYY-MM-DD（to 为日期时包含当天）。
+func (h *SearchHandler) Search(c *gin.Context) {
+	if h.index == nil {
+		Error(c, http.StatusServiceUnavailable, "search index not configured")
+		return
+	}
+
+	q := &search.Query{
+		Text:    c.Query("q"),
+		AgentID: c.Query("agent_id"),
+		Status:  c.Query("status"),
+	}
+	if c.GetString("role") == "admin" {
+		q.UserID = c.Query("user_id")
+	} else {
+		q.UserID = c.GetString("user_id")
+	}
+	if kinds := c.Query("kind"); kinds != "" {
+		for _, k := range strings.Split(kinds, ",") {
+			q.Kinds = append(q.Kinds, search.Kind(strings.TrimSpace(k)))
+		}
+	}
+
+	var err error
+	if q.From, err = parseSearchTime(c.Query("from"), false); err != nil {
+		BadRequest(c, "invalid from: "+err.Error())
+		return
+	}
+	if q.To, err = parseSearchTime(c.Query("to"), true); err != nil {
+		BadRequest(c, "invalid to: "+err.Error())
+		return
+	}
+	if v := c.Query("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil {
+			BadRequest(c, "invalid limit")
+			return
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		if q.Offset, err = strconv.Atoi(v); err != nil || q.Offset < 0 {
+			BadRequest(c, "invalid offset")
+			return
+		}
+	}
+
+	results, err := h.index.Search(q)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	SuccessWithPagination(c, results.Hits, int(results.Total), q.Limit, q.Offset)
+}
+
+// parseSearchTime 解析 RFC3339 或 YYYY-MM-DD，endOfDay 为 true 时日期取当天结束
+func parseSearchTime(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return &t, nil
+}
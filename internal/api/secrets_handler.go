@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tmalldedede/agentbox/internal/provider"
+)
+
+// SecretsHandler 加密密文管理（Provider Key、渠道 AppSecret、Webhook Secret）
+type SecretsHandler struct {
+	secrets *provider.Secrets
+}
+
+// NewSecretsHandler 创建密文管理处理器
+func NewSecretsHandler(secrets *provider.Secrets) *SecretsHandler {
+	return &SecretsHandler{secrets: secrets}
+}
+
+// RegisterRoutes 注册管理路由
+func (h *SecretsHandler) RegisterRoutes(r *gin.RouterGroup) {
+	r.GET("/secrets", h.Check)
+	r.POST("/secrets/rotate", h.Rotate)
+}
+
+// Check 校验所有密文可解密，并按密钥 ID 统计
+// GET /api/v1/admin/secrets
+func (h *SecretsHandler) Check(c *gin.Context) {
+	if h.secrets == nil {
+		Error(c, http.StatusServiceUnavailable, "secrets registry not initialized")
+		return
+	}
+	Success(c, h.secrets.Check())
+}
+
+// Rotate 将所有未使用主密钥的密文（含明文旧值）用主密钥重新加密，
+// 无法解密的密文保持不变并在结果中报告
+// POST /api/v1/admin/secrets/rotate
+func (h *SecretsHandler) Rotate(c *gin.Context) {
+	if h.secrets == nil {
+		Error(c, http.StatusServiceUnavailable, "secrets registry not initialized")
+		return
+	}
+	report := h.secrets.Rotate()
+	if err := report.Err(); err != nil {
+		log.Warn("secret rotation incomplete", "error", err)
+	} else {
+		log.Info("secrets re-encrypted", "primary_key_id", report.PrimaryKeyID)
+	}
+	Success(c, report)
+}
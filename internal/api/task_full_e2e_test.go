@@ -171,7 +171,7 @@ func setupTaskE2E(t *testing.T, adapterType string, idleTimeout time.Duration) (
 	// === HTTP Router ===
 	router := gin.New()
 	v1 := router.Group("/api/v1")
-	taskHandler := NewTaskHandler(taskMgr)
+	taskHandler := NewTaskHandler(taskMgr, nil)
 	taskHandler.RegisterRoutes(v1)
 
 	env := &e2eTestEnv{
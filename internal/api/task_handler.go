@@ -1,23 +1,39 @@
 package api
 
 import (
+	"archive/zip"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/tmalldedede/agentbox/internal/agent"
+	"github.com/tmalldedede/agentbox/internal/apperr"
+	"github.com/tmalldedede/agentbox/internal/eval"
+	"github.com/tmalldedede/agentbox/internal/resultcache"
 	"github.com/tmalldedede/agentbox/internal/task"
+	"github.com/tmalldedede/agentbox/internal/view"
 )
 
 // TaskHandler Task API 处理器
 type TaskHandler struct {
 	manager *task.Manager
+	files   FileStore       // 输出文件下载（可为 nil）
+	views   *view.GormStore // 保存的视图（可为 nil）
 }
 
 // NewTaskHandler 创建 Task 处理器
-func NewTaskHandler(manager *task.Manager) *TaskHandler {
-	return &TaskHandler{manager: manager}
+func NewTaskHandler(manager *task.Manager, files FileStore) *TaskHandler {
+	return &TaskHandler{manager: manager, files: files}
+}
+
+// SetViewStore 设置保存视图存储（列表与统计支持 view=<id>）
+func (h *TaskHandler) SetViewStore(views *view.GormStore) {
+	h.views = views
 }
 
 // RegisterRoutes 注册路由
@@ -30,22 +46,36 @@ func (h *TaskHandler) RegisterRoutes(r *gin.RouterGroup) {
 		tasks.POST("/cleanup", h.Cleanup)
 		tasks.GET("/:id", h.Get)
 		tasks.DELETE("/:id", h.Delete)
+		tasks.PUT("/:id/labels", h.SetLabels)
 		tasks.POST("/:id/cancel", h.Cancel)
 		tasks.POST("/:id/retry", h.Retry)
 		tasks.GET("/:id/events", h.StreamEvents)
 		tasks.GET("/:id/output", h.GetOutput)
+		tasks.GET("/:id/files", h.ListFiles)
+		tasks.GET("/:id/files/archive", h.DownloadArchive)
+		tasks.GET("/:id/files/:file_id", h.DownloadFile)
 	}
 }
 
 // CreateTaskAPIRequest 创建任务 API 请求（简化版，对齐 Manus）
 type CreateTaskAPIRequest struct {
-	AgentID     string            `json:"agent_id,omitempty"`    // 首次创建时必填
-	Prompt      string            `json:"prompt" binding:"required"`
-	TaskID      string            `json:"task_id,omitempty"`     // 多轮时传入
-	Attachments []string          `json:"attachments,omitempty"` // file IDs
-	WebhookURL  string            `json:"webhook_url,omitempty"`
-	Timeout     int               `json:"timeout,omitempty"`
-	Metadata    map[string]string `json:"metadata,omitempty"`
+	AgentID     string                 `json:"agent_id,omitempty"`    // 首次创建时必填（使用模板时可省略）
+	Prompt      string                 `json:"prompt,omitempty"`      // 不使用模板时必填
+	TaskID      string                 `json:"task_id,omitempty"`     // 多轮时传入
+	TemplateID  string                 `json:"template_id,omitempty"` // 从任务模板创建
+	Params      map[string]interface{} `json:"params,omitempty"`      // 模板参数
+	Attachments []string               `json:"attachments,omitempty"` // file IDs
+	WebhookURL  string                 `json:"webhook_url,omitempty"`
+	Timeout     int                    `json:"timeout,omitempty"`
+	Priority    task.Priority          `json:"priority,omitempty"` // high / normal / low
+	RunAt       *time.Time             `json:"run_at,omitempty"`   // RFC3339，最早开始时间
+	Deadline    *time.Time             `json:"deadline,omitempty"` // RFC3339，截止时间
+	Metadata    map[string]string      `json:"metadata,omitempty"`
+	Labels      map[string]string      `json:"labels,omitempty"`     // 标签（key=value），可按标签选择器过滤
+	Retry       *agent.RetryPolicy     `json:"retry,omitempty"`      // 自动重试策略（覆盖 Agent 配置）
+	Evaluators  []eval.Evaluator       `json:"evaluators,omitempty"` // 结果评估器（与 Agent / 模板的评估器一起执行）
+	Cache       *resultcache.Policy    `json:"cache,omitempty"`      // 结果缓存（相同配置、提示词与附件时复用结果）
+	TokenBudget int64                  `json:"token_budget,omitempty"`
 }
 
 // Create 创建任务或追加多轮
@@ -57,21 +87,45 @@ func (h *TaskHandler) Create(c *gin.Context) {
 		return
 	}
 
+	// 非 admin 用户只能使用自己的模板
+	if req.TemplateID != "" && c.GetString("role") != "admin" {
+		tpl, err := h.manager.GetTemplate(req.TemplateID)
+		if err != nil {
+			HandleError(c, err)
+			return
+		}
+		if tpl.UserID != c.GetString("user_id") {
+			Forbidden(c, "access denied: not your template")
+			return
+		}
+	}
+
 	t, err := h.manager.CreateTask(&task.CreateTaskRequest{
 		AgentID:     req.AgentID,
 		Prompt:      req.Prompt,
 		TaskID:      req.TaskID,
+		TemplateID:  req.TemplateID,
+		Params:      req.Params,
 		UserID:      c.GetString("user_id"),
 		Attachments: req.Attachments,
 		WebhookURL:  req.WebhookURL,
 		Timeout:     req.Timeout,
+		Priority:    req.Priority,
+		RunAt:       req.RunAt,
+		Deadline:    req.Deadline,
 		Metadata:    req.Metadata,
+		Labels:      req.Labels,
+		Retry:       req.Retry,
+		Evaluators:  req.Evaluators,
+		Cache:       req.Cache,
+		TokenBudget: req.TokenBudget,
 	})
 	if err != nil {
 		HandleError(c, err)
 		return
 	}
 
+	h.manager.FillQueueInfo(t)
 	Created(c, t)
 }
 
@@ -82,28 +136,15 @@ type ListTasksResponse struct {
 }
 
 // List 列出任务
-// GET /api/v1/tasks
+// GET /api/v1/tasks?status=&agent_id=&search=&labels=&view=&limit=&offset=
+//
+// labels 为标签选择器（如 project=billing,ticket in (T-1,T-2)），view 引用保存的视图。
 func (h *TaskHandler) List(c *gin.Context) {
-	filter := &task.ListFilter{
-		OrderDesc: true,
-	}
-
-	// 非 admin 用户只能看自己的任务
-	if role := c.GetString("role"); role != "admin" {
-		filter.UserID = c.GetString("user_id")
-	}
-
-	if status := c.Query("status"); status != "" {
-		filter.Status = []task.Status{task.Status(status)}
-	}
-
-	if agentID := c.Query("agent_id"); agentID != "" {
-		filter.AgentID = agentID
-	}
-
-	if search := c.Query("search"); search != "" {
-		filter.Search = search
+	filter, ok := h.listFilter(c)
+	if !ok {
+		return
 	}
+	filter.OrderDesc = true
 
 	if limit := c.Query("limit"); limit != "" {
 		if l, err := strconv.Atoi(limit); err == nil && l > 0 {
@@ -131,15 +172,39 @@ func (h *TaskHandler) List(c *gin.Context) {
 		Status:  filter.Status,
 		AgentID: filter.AgentID,
 		Search:  filter.Search,
+		Labels:  filter.Labels,
 	}
 	total, _ := h.manager.CountTasks(countFilter)
 
+	h.manager.FillQueueInfo(tasks...)
+
 	Success(c, ListTasksResponse{
 		Tasks: tasks,
 		Total: total,
 	})
 }
 
+// listFilter 由请求参数与保存的视图构建任务过滤条件（非 admin 用户只能看自己的任务）
+func (h *TaskHandler) listFilter(c *gin.Context) (*task.ListFilter, bool) {
+	vf, selector, ok := listFilter(c, h.views, view.ResourceTasks)
+	if !ok {
+		return nil, false
+	}
+
+	filter := &task.ListFilter{
+		AgentID: vf.AgentID,
+		Search:  vf.Search,
+		Labels:  selector,
+	}
+	if role := c.GetString("role"); role != "admin" {
+		filter.UserID = c.GetString("user_id")
+	}
+	if vf.Status != "" {
+		filter.Status = []task.Status{task.Status(vf.Status)}
+	}
+	return filter, true
+}
+
 // checkTaskOwnership 检查任务归属权（非 admin 用户只能访问自己的任务）
 func (h *TaskHandler) checkTaskOwnership(c *gin.Context, taskID string) (*task.Task, bool) {
 	t, err := h.manager.GetTask(taskID)
@@ -169,6 +234,7 @@ func (h *TaskHandler) Get(c *gin.Context) {
 	if !ok {
 		return
 	}
+	h.manager.FillQueueInfo(t)
 	Success(c, t)
 }
 
@@ -222,10 +288,17 @@ func (h *TaskHandler) Retry(c *gin.Context) {
 	Created(c, t)
 }
 
-// Stats 获取任务统计
-// GET /api/v1/tasks/stats
+// Stats 获取任务统计（支持与列表相同的过滤参数，返回按标签的分布）
+// GET /api/v1/tasks/stats?status=&agent_id=&search=&labels=&view=
+//
+// 与列表一致，非 admin 用户只统计自己的任务。
 func (h *TaskHandler) Stats(c *gin.Context) {
-	stats, err := h.manager.GetStats()
+	filter, ok := h.listFilter(c)
+	if !ok {
+		return
+	}
+
+	stats, err := h.manager.GetStats(filter)
 	if err != nil {
 		HandleError(c, err)
 		return
@@ -234,6 +307,33 @@ func (h *TaskHandler) Stats(c *gin.Context) {
 	Success(c, stats)
 }
 
+// SetLabelsRequest 修改标签请求
+type SetLabelsRequest struct {
+	Labels map[string]string `json:"labels"` // 替换全部标签，空对象表示清除
+}
+
+// SetLabels 替换任务标签
+// PUT /api/v1/tasks/:id/labels
+func (h *TaskHandler) SetLabels(c *gin.Context) {
+	t, ok := h.checkTaskOwnership(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var req SetLabelsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+
+	t, err := h.manager.SetTaskLabels(t.ID, req.Labels)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	Success(c, t)
+}
+
 // CleanupRequest 清理请求
 type CleanupRequest struct {
 	BeforeDays int           `json:"before_days"` // 清理多少天前的任务
@@ -260,6 +360,10 @@ func (h *TaskHandler) Cleanup(c *gin.Context) {
 
 // StreamEvents SSE 实时事件流
 // GET /api/v1/tasks/:id/events
+//
+// 支持断线续传：客户端通过 Last-Event-ID 请求头（或 last_event_id 查询参数）
+// 传入最后收到的事件序号，服务端从该序号之后开始回放。
+// 已结束的任务会回放完整事件历史后关闭连接。
 func (h *TaskHandler) StreamEvents(c *gin.Context) {
 	// 验证 task 存在且有权限
 	t, ok := h.checkTaskOwnership(c, c.Param("id"))
@@ -268,12 +372,41 @@ func (h *TaskHandler) StreamEvents(c *gin.Context) {
 	}
 	taskID := t.ID
 
-	// 如果任务已经完成，直接返回最终事件
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	var afterSeq int64
+	if lastEventID != "" {
+		seq, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || seq < 0 {
+			BadRequest(c, "invalid Last-Event-ID")
+			return
+		}
+		afterSeq = seq
+	}
+
+	// 如果任务已经完成，回放事件历史后关闭
 	if t.Status.IsTerminal() {
+		events, err := h.manager.ReplayEvents(taskID, afterSeq)
+		if err != nil {
+			HandleError(c, err)
+			return
+		}
+
 		c.Header("Content-Type", "text/event-stream")
 		c.Header("Cache-Control", "no-cache")
 		c.Header("Connection", "keep-alive")
 
+		if len(events) > 0 || afterSeq > 0 {
+			for _, event := range events {
+				writeSSEEvent(c.Writer, event)
+			}
+			c.Writer.Flush()
+			return
+		}
+
+		// 没有事件日志（旧任务或未启用）时返回最终状态
 		eventType := "task.completed"
 		if t.Status == task.StatusFailed {
 			eventType = "task.failed"
@@ -291,65 +424,53 @@ func (h *TaskHandler) StreamEvents(c *gin.Context) {
 		return
 	}
 
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		log.Error("Writer doesn't support flushing", "task_id", taskID)
+		c.String(http.StatusInternalServerError, "Streaming unsupported")
+		return
+	}
+
 	// 设置 SSE headers
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
 	c.Header("Connection", "keep-alive")
 	c.Header("X-Accel-Buffering", "no")
 
-	// 订阅事件
-	eventCh := h.manager.SubscribeEvents(taskID)
-	defer h.manager.UnsubscribeEvents(taskID, eventCh)
+	// 订阅事件（先回放 afterSeq 之后的历史）
+	eventCh := h.manager.OpenEventStream(c.Request.Context(), taskID, afterSeq)
 
-	log.Info("SSE client connected", "task_id", taskID)
+	log.Info("SSE client connected", "task_id", taskID, "last_event_id", afterSeq)
 
 	// 发送初始状态
 	initData, _ := json.Marshal(map[string]interface{}{
 		"task_id":    t.ID,
-		"status":    t.Status,
+		"status":     t.Status,
 		"turn_count": t.TurnCount,
 	})
 	c.Writer.WriteString(fmt.Sprintf("event: task.status\ndata: %s\n\n", string(initData)))
-	c.Writer.Flush()
-	log.Info("sent initial status", "task_id", taskID, "status", t.Status)
-
-	// 转发事件
-	clientGone := c.Request.Context().Done()
-	flusher, ok := c.Writer.(http.Flusher)
-	if !ok {
-		log.Error("Writer doesn't support flushing", "task_id", taskID)
-		c.String(http.StatusInternalServerError, "Streaming unsupported")
-		return
-	}
+	flusher.Flush()
 
-	for {
-		select {
-		case <-clientGone:
-			log.Info("SSE client disconnected", "task_id", taskID)
+	// 转发事件（终态事件或客户端断开后 eventCh 关闭）
+	for event := range eventCh {
+		if err := writeSSEEvent(c.Writer, event); err != nil {
+			log.Error("failed to write SSE event", "task_id", taskID, "error", err)
 			return
-		case event, ok := <-eventCh:
-			if !ok {
-				log.Info("event channel closed", "task_id", taskID)
-				return
-			}
-
-			data, _ := json.Marshal(event.Data)
-			message := fmt.Sprintf("event: %s\ndata: %s\n\n", event.Type, string(data))
-
-			if _, err := c.Writer.WriteString(message); err != nil {
-				log.Error("failed to write SSE event", "task_id", taskID, "error", err)
-				return
-			}
-			flusher.Flush()
-			log.Info("sent SSE event", "task_id", taskID, "event_type", event.Type)
-
-			// 终态事件后关闭连接
-			if event.Type == "task.completed" || event.Type == "task.failed" || event.Type == "task.cancelled" {
-				log.Info("task terminated, closing SSE", "task_id", taskID, "event_type", event.Type)
-				return
-			}
 		}
+		flusher.Flush()
 	}
+	log.Info("SSE stream closed", "task_id", taskID)
+}
+
+// writeSSEEvent 写入一条 SSE 事件（带序号时输出 id 字段，用于 Last-Event-ID 续传）
+func writeSSEEvent(w io.Writer, event *task.TaskEvent) error {
+	data, _ := json.Marshal(event.Data)
+	message := fmt.Sprintf("event: %s\ndata: %s\n\n", event.Type, string(data))
+	if event.Seq > 0 {
+		message = fmt.Sprintf("id: %d\n", event.Seq) + message
+	}
+	_, err := io.WriteString(w, message)
+	return err
 }
 
 // GetOutput 获取任务输出
@@ -370,3 +491,99 @@ func (h *TaskHandler) GetOutput(c *gin.Context) {
 
 	Success(c, t.Result)
 }
+
+// ListFiles 列出任务输出文件
+// GET /api/v1/tasks/:id/files
+func (h *TaskHandler) ListFiles(c *gin.Context) {
+	t, ok := h.checkTaskOwnership(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	files := t.OutputFiles
+	if files == nil {
+		files = []task.OutputFile{}
+	}
+	Success(c, files)
+}
+
+// DownloadFile 下载单个输出文件
+// GET /api/v1/tasks/:id/files/:file_id
+func (h *TaskHandler) DownloadFile(c *gin.Context) {
+	t, ok := h.checkTaskOwnership(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	record, err := h.outputFileRecord(t, c.Param("file_id"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", record.Name))
+	c.File(record.Path)
+}
+
+// DownloadArchive 打包下载全部输出文件（zip，保留工作区内的相对路径）
+// GET /api/v1/tasks/:id/files/archive
+func (h *TaskHandler) DownloadArchive(c *gin.Context) {
+	t, ok := h.checkTaskOwnership(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if len(t.OutputFiles) == 0 {
+		HandleError(c, apperr.NotFound("output files"))
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"task-%s-files.zip\"", t.ID))
+	c.Status(http.StatusOK)
+
+	zw := zip.NewWriter(c.Writer)
+	defer zw.Close()
+
+	for _, f := range t.OutputFiles {
+		record, err := h.outputFileRecord(t, f.ID)
+		if err != nil {
+			log.Warn("skip output file in archive", "task_id", t.ID, "file_id", f.ID, "error", err)
+			continue
+		}
+		if err := writeZipEntry(zw, f.Path, record.Path); err != nil {
+			log.Error("failed to write archive entry", "task_id", t.ID, "file_id", f.ID, "error", err)
+			return
+		}
+	}
+}
+
+// outputFileRecord 获取属于该任务的输出文件记录
+func (h *TaskHandler) outputFileRecord(t *task.Task, fileID string) (*FileRecord, error) {
+	if h.files == nil || fileID == "" {
+		return nil, apperr.NotFound("file")
+	}
+	record, err := h.files.Get(fileID)
+	if err != nil || record.TaskID != t.ID || record.Purpose != FilePurposeOutput || record.Status != FileStatusActive {
+		return nil, apperr.NotFound("file")
+	}
+	if _, err := os.Stat(record.Path); err != nil {
+		return nil, apperr.NotFound("file")
+	}
+	return record, nil
+}
+
+// writeZipEntry 将磁盘文件写入 zip
+func writeZipEntry(zw *zip.Writer, name, srcPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, src)
+	return err
+}
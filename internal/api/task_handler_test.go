@@ -15,6 +15,7 @@ import (
 	"github.com/tmalldedede/agentbox/internal/agent"
 	"github.com/tmalldedede/agentbox/internal/provider"
 	"github.com/tmalldedede/agentbox/internal/task"
+	"github.com/tmalldedede/agentbox/internal/view"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	gormlogger "gorm.io/gorm/logger"
@@ -61,7 +62,7 @@ func setupTaskTestRouter(t *testing.T) (*gin.Engine, *TaskHandler, *task.Manager
 	// Create task manager (without starting the scheduler)
 	taskMgr := task.NewManager(store, agentMgr, nil, nil)
 
-	handler := NewTaskHandler(taskMgr)
+	handler := NewTaskHandler(taskMgr, nil)
 
 	router := gin.New()
 	v1 := router.Group("/api/v1")
@@ -347,3 +348,79 @@ func TestTaskValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestTaskLabelsAndSavedViews(t *testing.T) {
+	router, handler, taskMgr, tempDir := setupTaskTestRouter(t)
+	defer os.RemoveAll(tempDir)
+
+	viewDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: gormlogger.Default.LogMode(gormlogger.Silent)})
+	require.NoError(t, err)
+	views, err := view.NewGormStore(viewDB)
+	require.NoError(t, err)
+	handler.SetViewStore(views)
+	NewViewHandler(views).RegisterRoutes(router.Group("/api/v1"))
+
+	for _, project := range []string{"billing", "billing", "search"} {
+		_, err := taskMgr.CreateTask(&task.CreateTaskRequest{
+			AgentID: "test-agent",
+			Prompt:  "Test task",
+			Labels:  map[string]string{"project": project},
+		})
+		require.NoError(t, err)
+	}
+	_, err = taskMgr.CreateTask(&task.CreateTaskRequest{
+		AgentID: "test-agent", Prompt: "Test task", Labels: map[string]string{"bad key": "x"},
+	})
+	assert.Error(t, err)
+
+	get := func(url string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		var resp Response
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		data, _ := resp.Data.(map[string]interface{})
+		return w.Code, data
+	}
+
+	code, data := get("/api/v1/tasks?labels=project%3Dbilling")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(2), data["total"])
+
+	code, _ = get("/api/v1/tasks?labels=project%3D%3D%3D")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// 保存视图后通过 view 引用，显式参数覆盖视图条件
+	body, _ := json.Marshal(SaveViewRequest{Name: "Billing", Resource: view.ResourceTasks, Filter: view.Filter{Labels: "project=billing"}})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/views", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Data view.View `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+	_, data = get("/api/v1/tasks?view=" + created.Data.ID)
+	assert.Equal(t, float64(2), data["total"])
+	_, data = get("/api/v1/tasks?view=" + created.Data.ID + "&labels=project%3Dsearch")
+	assert.Equal(t, float64(1), data["total"])
+
+	code, data = get("/api/v1/tasks/stats?view=" + created.Data.ID)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(2), data["total"])
+	assert.Equal(t, map[string]interface{}{"project": map[string]interface{}{"billing": float64(2)}}, data["by_label"])
+
+	// 修改标签
+	tasks, err := taskMgr.ListTasks(&task.ListFilter{Limit: 1})
+	require.NoError(t, err)
+	body, _ = json.Marshal(SetLabelsRequest{Labels: map[string]string{"project": "search", "ticket": "SRCH-9"}})
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPut, "/api/v1/tasks/"+tasks[0].ID+"/labels", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	_, data = get("/api/v1/tasks?labels=ticket")
+	assert.Equal(t, float64(1), data["total"])
+}
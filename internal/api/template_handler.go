@@ -0,0 +1,123 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/tmalldedede/agentbox/internal/task"
+)
+
+// TemplateHandler 任务模板 API 处理器
+type TemplateHandler struct {
+	manager *task.Manager
+}
+
+// NewTemplateHandler 创建任务模板处理器
+func NewTemplateHandler(manager *task.Manager) *TemplateHandler {
+	return &TemplateHandler{manager: manager}
+}
+
+// RegisterRoutes 注册路由
+func (h *TemplateHandler) RegisterRoutes(r *gin.RouterGroup) {
+	templates := r.Group("/task-templates")
+	{
+		templates.POST("", h.Create)
+		templates.GET("", h.List)
+		templates.GET("/:id", h.Get)
+		templates.PUT("/:id", h.Update)
+		templates.DELETE("/:id", h.Delete)
+	}
+}
+
+// checkTemplateOwnership 检查模板归属权（非 admin 用户只能访问自己的模板）
+func (h *TemplateHandler) checkTemplateOwnership(c *gin.Context, id string) (*task.TaskTemplate, bool) {
+	tpl, err := h.manager.GetTemplate(id)
+	if err != nil {
+		HandleError(c, err)
+		return nil, false
+	}
+	if c.GetString("role") != "admin" && tpl.UserID != c.GetString("user_id") {
+		Forbidden(c, "access denied: not your template")
+		return nil, false
+	}
+	return tpl, true
+}
+
+// Create 创建任务模板
+// POST /api/v1/task-templates
+func (h *TemplateHandler) Create(c *gin.Context) {
+	var req task.CreateTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+	req.UserID = c.GetString("user_id")
+
+	tpl, err := h.manager.CreateTemplate(&req)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	Created(c, tpl)
+}
+
+// List 列出任务模板
+// GET /api/v1/task-templates
+func (h *TemplateHandler) List(c *gin.Context) {
+	userID := ""
+	if c.GetString("role") != "admin" {
+		userID = c.GetString("user_id")
+	}
+
+	templates, err := h.manager.ListTemplates(userID)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	Success(c, gin.H{"templates": templates, "total": len(templates)})
+}
+
+// Get 获取任务模板
+// GET /api/v1/task-templates/:id
+func (h *TemplateHandler) Get(c *gin.Context) {
+	tpl, ok := h.checkTemplateOwnership(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	Success(c, tpl)
+}
+
+// Update 更新任务模板（版本号递增）
+// PUT /api/v1/task-templates/:id
+func (h *TemplateHandler) Update(c *gin.Context) {
+	tpl, ok := h.checkTemplateOwnership(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var req task.CreateTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+
+	updated, err := h.manager.UpdateTemplate(tpl.ID, &req)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	Success(c, updated)
+}
+
+// Delete 删除任务模板
+// DELETE /api/v1/task-templates/:id
+func (h *TemplateHandler) Delete(c *gin.Context) {
+	tpl, ok := h.checkTemplateOwnership(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	if err := h.manager.DeleteTemplate(tpl.ID); err != nil {
+		HandleError(c, err)
+		return
+	}
+	Success(c, gin.H{"deleted": true})
+}
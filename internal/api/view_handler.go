@@ -0,0 +1,189 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tmalldedede/agentbox/internal/labels"
+	"github.com/tmalldedede/agentbox/internal/view"
+)
+
+// ViewHandler 保存视图 API 处理器
+type ViewHandler struct {
+	store *view.GormStore
+}
+
+// NewViewHandler 创建保存视图处理器
+func NewViewHandler(store *view.GormStore) *ViewHandler {
+	return &ViewHandler{store: store}
+}
+
+// RegisterRoutes 注册路由
+func (h *ViewHandler) RegisterRoutes(r *gin.RouterGroup) {
+	views := r.Group("/views")
+	{
+		views.POST("", h.Create)
+		views.GET("", h.List)
+		views.GET("/:id", h.Get)
+		views.PUT("/:id", h.Update)
+		views.DELETE("/:id", h.Delete)
+	}
+}
+
+// SaveViewRequest 创建 / 更新视图请求
+type SaveViewRequest struct {
+	Name     string        `json:"name" binding:"required"`
+	Resource view.Resource `json:"resource" binding:"required"` // tasks / batches
+	Filter   view.Filter   `json:"filter"`
+}
+
+// checkViewOwnership 检查视图归属权（非 admin 用户只能访问自己的视图）
+func (h *ViewHandler) checkViewOwnership(c *gin.Context, id string) (*view.View, bool) {
+	if h.store == nil {
+		Error(c, http.StatusServiceUnavailable, "saved views not configured")
+		return nil, false
+	}
+	v, err := h.store.Get(id)
+	if err != nil {
+		HandleError(c, err)
+		return nil, false
+	}
+	if c.GetString("role") != "admin" && v.UserID != c.GetString("user_id") {
+		Forbidden(c, "access denied: not your view")
+		return nil, false
+	}
+	return v, true
+}
+
+// Create 保存视图
+// POST /api/v1/views
+func (h *ViewHandler) Create(c *gin.Context) {
+	if h.store == nil {
+		Error(c, http.StatusServiceUnavailable, "saved views not configured")
+		return
+	}
+	var req SaveViewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+
+	v := &view.View{
+		UserID:   c.GetString("user_id"),
+		Name:     req.Name,
+		Resource: req.Resource,
+		Filter:   req.Filter,
+	}
+	if err := h.store.Create(v); err != nil {
+		HandleError(c, err)
+		return
+	}
+	Created(c, v)
+}
+
+// List 列出当前用户的视图
+// GET /api/v1/views?resource=tasks
+func (h *ViewHandler) List(c *gin.Context) {
+	if h.store == nil {
+		Error(c, http.StatusServiceUnavailable, "saved views not configured")
+		return
+	}
+	views, err := h.store.List(c.GetString("user_id"), view.Resource(c.Query("resource")))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	Success(c, gin.H{"views": views, "total": len(views)})
+}
+
+// Get 获取视图
+// GET /api/v1/views/:id
+func (h *ViewHandler) Get(c *gin.Context) {
+	v, ok := h.checkViewOwnership(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	Success(c, v)
+}
+
+// Update 更新视图
+// PUT /api/v1/views/:id
+func (h *ViewHandler) Update(c *gin.Context) {
+	v, ok := h.checkViewOwnership(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	var req SaveViewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+
+	v.Name = req.Name
+	v.Resource = req.Resource
+	v.Filter = req.Filter
+	if err := h.store.Update(v); err != nil {
+		HandleError(c, err)
+		return
+	}
+	Success(c, v)
+}
+
+// Delete 删除视图
+// DELETE /api/v1/views/:id
+func (h *ViewHandler) Delete(c *gin.Context) {
+	v, ok := h.checkViewOwnership(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if err := h.store.Delete(v.ID); err != nil {
+		HandleError(c, err)
+		return
+	}
+	Success(c, gin.H{"deleted": true})
+}
+
+// listFilter 合并视图与请求参数得到列表过滤条件（请求参数优先）
+//
+// 请求未携带 view 时直接使用请求参数；视图须属于当前用户（admin 除外）且适用于 resource。
+func listFilter(c *gin.Context, views *view.GormStore, resource view.Resource) (*view.Filter, labels.Selector, bool) {
+	filter := &view.Filter{}
+	if id := c.Query("view"); id != "" {
+		if views == nil {
+			Error(c, http.StatusServiceUnavailable, "saved views not configured")
+			return nil, nil, false
+		}
+		v, err := views.Get(id)
+		if err != nil {
+			HandleError(c, err)
+			return nil, nil, false
+		}
+		if c.GetString("role") != "admin" && v.UserID != c.GetString("user_id") {
+			Forbidden(c, "access denied: not your view")
+			return nil, nil, false
+		}
+		if v.Resource != resource {
+			BadRequest(c, "view "+v.ID+" is not a "+string(resource)+" view")
+			return nil, nil, false
+		}
+		*filter = v.Filter
+	}
+
+	for param, field := range map[string]*string{
+		"status":   &filter.Status,
+		"agent_id": &filter.AgentID,
+		"search":   &filter.Search,
+		"labels":   &filter.Labels,
+	} {
+		if value, ok := c.GetQuery(param); ok {
+			*field = value
+		}
+	}
+
+	selector, err := labels.Parse(filter.Labels)
+	if err != nil {
+		HandleError(c, err)
+		return nil, nil, false
+	}
+	return filter, selector, true
+}
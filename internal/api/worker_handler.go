@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tmalldedede/agentbox/internal/session"
+	"github.com/tmalldedede/agentbox/internal/worker"
+)
+
+// WorkerHandler 远程 Worker 节点 API 处理器
+type WorkerHandler struct {
+	hub      *worker.Hub
+	sessions *session.Manager
+}
+
+// NewWorkerHandler 创建 Worker 节点处理器
+func NewWorkerHandler(hub *worker.Hub, sessions *session.Manager) *WorkerHandler {
+	return &WorkerHandler{hub: hub, sessions: sessions}
+}
+
+// RegisterPublicRoutes 注册公开路由（Worker 通过 AGENTBOX_WORKER_TOKEN 认证，不使用用户认证）
+func (h *WorkerHandler) RegisterPublicRoutes(r *gin.RouterGroup) {
+	r.GET("/workers/connect", h.Connect)
+}
+
+// RegisterRoutes 注册管理路由
+func (h *WorkerHandler) RegisterRoutes(r *gin.RouterGroup) {
+	r.GET("/workers", h.List)
+	r.GET("/workers/:id/sessions", h.ListSessions)
+}
+
+// Connect Worker WebSocket 连接
+// GET /api/v1/workers/connect
+func (h *WorkerHandler) Connect(c *gin.Context) {
+	if h.hub == nil {
+		Error(c, http.StatusServiceUnavailable, "worker hub not configured")
+		return
+	}
+	h.hub.HandleConnect(c.Writer, c.Request)
+}
+
+// List 列出已连接的 Worker 节点
+// GET /api/v1/admin/workers
+func (h *WorkerHandler) List(c *gin.Context) {
+	if h.hub == nil {
+		Success(c, gin.H{"enabled": false, "workers": []*worker.NodeStatus{}, "total": 0})
+		return
+	}
+	nodes := h.hub.Nodes()
+	Success(c, gin.H{"enabled": h.hub.Enabled(), "workers": nodes, "total": len(nodes)})
+}
+
+// ListSessions 列出运行在节点上的会话
+// GET /api/v1/admin/workers/:id/sessions
+func (h *WorkerHandler) ListSessions(c *gin.Context) {
+	sessions, err := h.sessions.List(c.Request.Context(), &session.ListFilter{NodeID: c.Param("id")})
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	Success(c, gin.H{"sessions": sessions, "total": len(sessions)})
+}
@@ -0,0 +1,312 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tmalldedede/agentbox/internal/task"
+)
+
+// WorkflowHandler Workflow API 处理器
+type WorkflowHandler struct {
+	manager *task.Manager
+}
+
+// NewWorkflowHandler 创建 Workflow 处理器
+func NewWorkflowHandler(manager *task.Manager) *WorkflowHandler {
+	return &WorkflowHandler{manager: manager}
+}
+
+// RegisterRoutes 注册路由
+func (h *WorkflowHandler) RegisterRoutes(r *gin.RouterGroup) {
+	workflows := r.Group("/workflows")
+	{
+		workflows.POST("", h.Create)
+		workflows.GET("", h.List)
+		workflows.GET("/:id", h.Get)
+		workflows.PUT("/:id", h.Update)
+		workflows.DELETE("/:id", h.Delete)
+		workflows.POST("/:id/runs", h.Run)
+		workflows.GET("/:id/runs", h.ListRuns)
+	}
+
+	runs := r.Group("/workflow-runs")
+	{
+		runs.GET("/:id", h.GetRun)
+		runs.POST("/:id/cancel", h.CancelRun)
+		runs.GET("/:id/events", h.StreamRunEvents)
+	}
+}
+
+// WorkflowRunResponse 运行详情（附带各步骤 Task）
+type WorkflowRunResponse struct {
+	*task.WorkflowRun
+	Tasks map[string]*task.Task `json:"tasks,omitempty"` // step_id → task
+}
+
+// checkWorkflowOwnership 检查工作流归属权（非 admin 用户只能访问自己的工作流）
+func (h *WorkflowHandler) checkWorkflowOwnership(c *gin.Context, id string) (*task.Workflow, bool) {
+	wf, err := h.manager.GetWorkflow(id)
+	if err != nil {
+		HandleError(c, err)
+		return nil, false
+	}
+	if c.GetString("role") != "admin" && wf.UserID != c.GetString("user_id") {
+		Forbidden(c, "access denied: not your workflow")
+		return nil, false
+	}
+	return wf, true
+}
+
+// checkRunOwnership 检查运行记录归属权
+func (h *WorkflowHandler) checkRunOwnership(c *gin.Context, id string) (*task.WorkflowRun, bool) {
+	run, err := h.manager.GetWorkflowRun(id)
+	if err != nil {
+		HandleError(c, err)
+		return nil, false
+	}
+	if c.GetString("role") != "admin" && run.UserID != c.GetString("user_id") {
+		Forbidden(c, "access denied: not your workflow run")
+		return nil, false
+	}
+	return run, true
+}
+
+// Create 创建工作流
+// POST /api/v1/workflows
+func (h *WorkflowHandler) Create(c *gin.Context) {
+	var req task.CreateWorkflowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+	req.UserID = c.GetString("user_id")
+
+	wf, err := h.manager.CreateWorkflow(&req)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	Created(c, wf)
+}
+
+// List 列出工作流
+// GET /api/v1/workflows
+func (h *WorkflowHandler) List(c *gin.Context) {
+	userID := ""
+	if c.GetString("role") != "admin" {
+		userID = c.GetString("user_id")
+	}
+
+	workflows, err := h.manager.ListWorkflows(userID)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	Success(c, gin.H{"workflows": workflows, "total": len(workflows)})
+}
+
+// Get 获取工作流
+// GET /api/v1/workflows/:id
+func (h *WorkflowHandler) Get(c *gin.Context) {
+	wf, ok := h.checkWorkflowOwnership(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	Success(c, wf)
+}
+
+// Update 更新工作流
+// PUT /api/v1/workflows/:id
+func (h *WorkflowHandler) Update(c *gin.Context) {
+	wf, ok := h.checkWorkflowOwnership(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var req task.CreateWorkflowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+
+	updated, err := h.manager.UpdateWorkflow(wf.ID, &req)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	Success(c, updated)
+}
+
+// Delete 删除工作流
+// DELETE /api/v1/workflows/:id
+func (h *WorkflowHandler) Delete(c *gin.Context) {
+	wf, ok := h.checkWorkflowOwnership(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	if err := h.manager.DeleteWorkflow(wf.ID); err != nil {
+		HandleError(c, err)
+		return
+	}
+	Success(c, gin.H{"deleted": true})
+}
+
+// Run 启动工作流
+// POST /api/v1/workflows/:id/runs
+func (h *WorkflowHandler) Run(c *gin.Context) {
+	wf, ok := h.checkWorkflowOwnership(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var req task.RunWorkflowRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			BadRequest(c, err.Error())
+			return
+		}
+	}
+	req.UserID = c.GetString("user_id")
+
+	run, err := h.manager.RunWorkflow(wf.ID, &req)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	Created(c, h.runResponse(run))
+}
+
+// ListRuns 列出工作流的运行记录
+// GET /api/v1/workflows/:id/runs
+func (h *WorkflowHandler) ListRuns(c *gin.Context) {
+	wf, ok := h.checkWorkflowOwnership(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	filter := &task.WorkflowRunFilter{WorkflowID: wf.ID, Limit: 20}
+	if c.GetString("role") != "admin" {
+		filter.UserID = c.GetString("user_id")
+	}
+	if status := c.Query("status"); status != "" {
+		filter.Status = []task.WorkflowRunStatus{task.WorkflowRunStatus(status)}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if l, err := strconv.Atoi(limit); err == nil && l > 0 {
+			filter.Limit = l
+		}
+	}
+
+	runs, err := h.manager.ListWorkflowRuns(filter)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	Success(c, gin.H{"runs": runs, "total": len(runs)})
+}
+
+// GetRun 获取运行详情（含各步骤 Task）
+// GET /api/v1/workflow-runs/:id
+func (h *WorkflowHandler) GetRun(c *gin.Context) {
+	run, ok := h.checkRunOwnership(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	Success(c, h.runResponse(run))
+}
+
+// CancelRun 取消运行
+// POST /api/v1/workflow-runs/:id/cancel
+func (h *WorkflowHandler) CancelRun(c *gin.Context) {
+	run, ok := h.checkRunOwnership(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	run, err := h.manager.CancelWorkflowRun(run.ID)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	Success(c, h.runResponse(run))
+}
+
+// StreamRunEvents SSE 实时事件流（workflow.step_* / workflow.completed 等）
+// GET /api/v1/workflow-runs/:id/events
+func (h *WorkflowHandler) StreamRunEvents(c *gin.Context) {
+	run, ok := h.checkRunOwnership(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	// 先校验权限，再订阅，最后重新读取运行状态：订阅之前发生的变化都体现在当前状态中，
+	// 之后的变化通过事件推送，不会遗漏
+	eventCh := h.manager.SubscribeEvents(run.ID)
+	defer h.manager.UnsubscribeEvents(run.ID, eventCh)
+
+	run, err := h.manager.GetWorkflowRun(run.ID)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	initData, _ := json.Marshal(h.runResponse(run))
+	c.Writer.WriteString(fmt.Sprintf("event: workflow.status\ndata: %s\n\n", string(initData)))
+	c.Writer.Flush()
+
+	if run.Status.IsTerminal() {
+		return
+	}
+
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.String(http.StatusInternalServerError, "Streaming unsupported")
+		return
+	}
+
+	clientGone := c.Request.Context().Done()
+	for {
+		select {
+		case <-clientGone:
+			return
+		case event, ok := <-eventCh:
+			if !ok {
+				return
+			}
+
+			data, _ := json.Marshal(event.Data)
+			if _, err := c.Writer.WriteString(fmt.Sprintf("event: %s\ndata: %s\n\n", event.Type, string(data))); err != nil {
+				return
+			}
+			flusher.Flush()
+
+			if event.Type == "workflow.completed" || event.Type == "workflow.failed" || event.Type == "workflow.cancelled" {
+				return
+			}
+		}
+	}
+}
+
+// runResponse 组装运行详情
+func (h *WorkflowHandler) runResponse(run *task.WorkflowRun) *WorkflowRunResponse {
+	resp := &WorkflowRunResponse{WorkflowRun: run, Tasks: make(map[string]*task.Task)}
+	for _, step := range run.Steps {
+		if step.TaskID == "" {
+			continue
+		}
+		if t, err := h.manager.GetTask(step.TaskID); err == nil {
+			resp.Tasks[step.StepID] = t
+		}
+	}
+	return resp
+}
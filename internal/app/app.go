@@ -2,10 +2,12 @@ package app
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/tmalldedede/agentbox/internal/agent"
@@ -15,6 +17,7 @@ import (
 	"github.com/tmalldedede/agentbox/internal/channel/dingtalk"
 	"github.com/tmalldedede/agentbox/internal/channel/feishu"
 	"github.com/tmalldedede/agentbox/internal/channel/wecom"
+	"github.com/tmalldedede/agentbox/internal/cluster"
 	"github.com/tmalldedede/agentbox/internal/config"
 	"github.com/tmalldedede/agentbox/internal/container"
 	"github.com/tmalldedede/agentbox/internal/coordinate"
@@ -25,16 +28,23 @@ import (
 	_ "github.com/tmalldedede/agentbox/internal/engine/codex"    // 注册 Codex 适配器
 	_ "github.com/tmalldedede/agentbox/internal/engine/opencode" // 注册 OpenCode 适配器
 	"github.com/tmalldedede/agentbox/internal/history"
+	"github.com/tmalldedede/agentbox/internal/labels"
+	"github.com/tmalldedede/agentbox/internal/llmproxy"
 	"github.com/tmalldedede/agentbox/internal/logger"
 	"github.com/tmalldedede/agentbox/internal/mcp"
 	"github.com/tmalldedede/agentbox/internal/plugin"
 	"github.com/tmalldedede/agentbox/internal/provider"
+	"github.com/tmalldedede/agentbox/internal/providerhealth"
+	"github.com/tmalldedede/agentbox/internal/resultcache"
 	"github.com/tmalldedede/agentbox/internal/runtime"
+	"github.com/tmalldedede/agentbox/internal/search"
 	"github.com/tmalldedede/agentbox/internal/session"
 	"github.com/tmalldedede/agentbox/internal/settings"
 	"github.com/tmalldedede/agentbox/internal/skill"
 	"github.com/tmalldedede/agentbox/internal/task"
+	"github.com/tmalldedede/agentbox/internal/view"
 	"github.com/tmalldedede/agentbox/internal/webhook"
+	"github.com/tmalldedede/agentbox/internal/worker"
 )
 
 // 模块日志器
@@ -59,9 +69,16 @@ type App struct {
 	Task          *task.Manager
 	Batch         *batch.Manager
 	GC            *container.GarbageCollector
+	Workers       *worker.Hub          // 远程 Worker 节点
+	Cluster       *cluster.Coordinator // 多实例协调（心跳 / Leader 选举）
+	ResultCache   *resultcache.Cache   // 执行结果缓存（任务 / 批量任务显式开启）
+	LLMProxy      *llmproxy.Proxy      // LLM 凭证代理（未启用时为 nil）
+
+	ProviderHealth *providerhealth.Monitor // Provider 健康监控与熔断器
 
 	// 配置管理
 	Provider *provider.Manager
+	Secrets  *provider.Secrets // 加密密文的校验与主密钥轮换
 	Runtime  *runtime.Manager
 	MCP      *mcp.Manager
 	Skill    *skill.Manager
@@ -72,6 +89,8 @@ type App struct {
 
 	// 执行历史
 	History *history.Manager
+	Search  *search.Index   // 全文检索
+	Views   *view.GormStore // 保存的列表视图
 
 	// 业务配置
 	Settings *settings.Manager
@@ -142,6 +161,17 @@ func (a *App) initialize() error {
 	a.Auth = auth.NewManager(database.GetDB())
 	log.Info("auth manager initialized")
 
+	// 1.6. 初始化多实例协调器（共享数据库的实例注册心跳，单例后台任务只在 Leader 上运行）
+	a.Cluster, err = cluster.New(database.GetDB(), cluster.Config{
+		InstanceID:        a.Config.Cluster.InstanceID,
+		HeartbeatInterval: a.Config.Cluster.HeartbeatInterval,
+		InstanceTTL:       a.Config.Cluster.InstanceTTL,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to initialize cluster coordinator: %w", err)
+	}
+	log.Info("cluster coordinator initialized", "instance_id", a.Cluster.InstanceID())
+
 	// 2. 获取 Agent 注册表
 	a.AgentRegistry = engine.DefaultRegistry()
 	log.Info("registered agents", "agents", a.AgentRegistry.Names())
@@ -156,24 +186,51 @@ func (a *App) initialize() error {
 	}
 	a.Session = session.NewManager(sessionStore, a.Container, a.AgentRegistry, a.Config.Container.WorkspaceBase)
 
+	// 3.1. 初始化远程 Worker 注册中心（Session 按容量与标签放置到本机或 Worker）
+	localLabels, err := labels.ParseSet(a.Config.Worker.LocalLabels)
+	if err != nil {
+		return fmt.Errorf("invalid worker local labels: %w", err)
+	}
+	a.Workers = worker.NewHub(worker.Config{
+		Token:            a.Config.Worker.Token,
+		WorkspaceBase:    a.Config.Container.WorkspaceBase,
+		LocalCapacity:    a.Config.Worker.LocalCapacity,
+		LocalLabels:      localLabels,
+		HeartbeatTimeout: a.Config.Worker.HeartbeatTimeout,
+	})
+	a.Workers.OnNodeLost(func(nodeID string) {
+		// 进行中的执行以 worker.ErrNodeLost 失败，任务按重试策略重新调度或失败
+		a.Session.HandleNodeLost(nodeID)
+	})
+	a.Session.SetWorkerHub(a.Workers)
+
 	// 3.5. 初始化 GC (依赖 Session Manager)
 	a.GC = container.NewGarbageCollector(a.Container, a.Session, container.GCConfig{
 		Interval:     a.Config.Container.GCInterval,
 		ContainerTTL: a.Config.Container.ContainerTTL,
 		IdleTimeout:  a.Config.Container.IdleTimeout,
 	})
+	a.GC.SetLeaderCheck(a.Cluster.IsLeader)
 
-	// 获取加密密钥
-	encryptionKey := os.Getenv("AGENTBOX_ENCRYPTION_KEY")
-	if encryptionKey == "" {
-		encryptionKey = "agentbox-default-encryption-key-32b" // 默认密钥，仅用于开发
+	// 加载主密钥（密钥文件或环境变量，旧密钥仅用于解密）
+	crypto, err := newCrypto(a.Config.Encryption)
+	if err != nil {
+		return fmt.Errorf("failed to load encryption keys: %w", err)
 	}
+	provider.SetDefaultCrypto(crypto)
 
 	// 4. 初始化 Provider 管理器
 	providerDataDir := filepath.Join(a.Config.Container.WorkspaceBase, "providers")
-	a.Provider = provider.NewManager(providerDataDir, encryptionKey)
+	a.Provider = provider.NewManagerWithCrypto(providerDataDir, crypto)
 	log.Info("loaded providers", "count", len(a.Provider.List()), "builtin", len(provider.GetBuiltinProviders()))
 
+	// 4.1. 初始化 LLM 凭证代理（可选）：容器只拿到会话级 token，真实 API Key 由代理按轮换注入
+	if a.Config.LLMProxy.Enabled {
+		a.LLMProxy = llmproxy.New(a.Provider, a.Config.Server.GetCallbackURL(), a.Config.LLMProxy.TokenTTL)
+		a.Session.SetLLMProxy(a.LLMProxy)
+		log.Info("LLM credential proxy enabled", "callback_url", a.Config.Server.GetCallbackURL())
+	}
+
 	// 5.5. 初始化 Runtime 管理器
 	runtimeDataDir := filepath.Join(a.Config.Container.WorkspaceBase, "runtimes")
 	a.Runtime = runtime.NewManager(runtimeDataDir, a.Config)
@@ -222,6 +279,61 @@ func (a *App) initialize() error {
 
 	// 12. 初始化 Task Manager
 	a.Task = task.NewManager(a.taskStore, a.Agent, a.Session, &task.ManagerConfig{})
+	a.Task.SetCluster(a.Cluster)
+
+	// 12.1. 初始化 Workflow Store（任务 DAG）
+	workflowStore, err := task.NewGormWorkflowStore(database.GetDB())
+	if err != nil {
+		return fmt.Errorf("failed to initialize Workflow store: %w", err)
+	}
+	a.Task.SetWorkflowStore(workflowStore)
+
+	// 12.2. 初始化任务事件日志（SSE 断线续传 / 历史回放）
+	eventStore, err := task.NewGormEventStore(database.GetDB())
+	if err != nil {
+		return fmt.Errorf("failed to initialize Task event store: %w", err)
+	}
+	a.Task.SetEventStore(eventStore)
+
+	// 12.3. 初始化工具审批（human-in-the-loop），容器内 Agent 通过回调地址访问审批 MCP 端点
+	approvalStore, err := task.NewGormApprovalStore(database.GetDB())
+	if err != nil {
+		return fmt.Errorf("failed to initialize Task approval store: %w", err)
+	}
+	a.Task.SetApprovalStore(approvalStore)
+	a.Task.SetApprovalEndpoint(a.Config.Server.GetCallbackURL())
+
+	// 12.4. 初始化任务模板（参数化 Prompt，可供 Task / Cron / Batch 引用）
+	templateStore, err := task.NewGormTemplateStore(database.GetDB())
+	if err != nil {
+		return fmt.Errorf("failed to initialize Task template store: %w", err)
+	}
+	a.Task.SetTemplateStore(templateStore)
+
+	// 结果评估：llm_judge 评估器通过已配置的 Provider 调用模型
+	a.Task.SetEvalJudge(a.Provider)
+
+	// 12.5. 初始化全文检索（任务写入时同步索引）
+	searchIndex, err := search.NewIndex(database.GetDB())
+	if err != nil {
+		return fmt.Errorf("failed to initialize search index: %w", err)
+	}
+	a.Search = searchIndex
+	a.Task.SetSearchIndexer(searchIndex)
+
+	// 12.6. 初始化保存视图（任务 / 批量任务列表的过滤条件）
+	viewStore, err := view.NewGormStore(database.GetDB())
+	if err != nil {
+		return fmt.Errorf("failed to initialize saved view store: %w", err)
+	}
+	a.Views = viewStore
+
+	// 12.7. 初始化结果缓存（相同配置与输入的任务复用结果）
+	a.ResultCache, err = resultcache.New(database.GetDB(), a.Config.ResultCache.DefaultTTL, a.Config.ResultCache.MaxTTL)
+	if err != nil {
+		return fmt.Errorf("failed to initialize result cache: %w", err)
+	}
+	a.Task.SetResultCache(a.ResultCache)
 
 	// 12. 初始化 Webhook Manager（使用数据库存储）
 	a.Webhook = webhook.NewManager()
@@ -231,6 +343,22 @@ func (a *App) initialize() error {
 	// 连接 Webhook 到 Task Manager
 	a.Task.SetWebhookNotifier(a.Webhook)
 
+	// 12.8. 初始化 Provider 健康监控（定期探测 + 熔断器，调度与故障转移跳过已熔断的 Provider）
+	healthCfg := a.Config.ProviderHealth
+	a.ProviderHealth, err = providerhealth.New(database.GetDB(), a.Provider, providerhealth.Config{
+		Interval:         healthCfg.Interval,
+		FailureThreshold: healthCfg.FailureThreshold,
+		OpenTimeout:      healthCfg.OpenTimeout,
+		HistoryRetention: healthCfg.HistoryRetention,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to initialize provider health monitor: %w", err)
+	}
+	a.ProviderHealth.SetLeaderCheck(a.Cluster.IsLeader)
+	a.ProviderHealth.SetNotifier(a.Webhook)
+	a.Task.SetProviderHealth(a.ProviderHealth)
+	a.Task.SetProviderManager(a.Provider)
+
 	// 13. 初始化 History Manager
 	var historyStore history.Store
 	if dbHistStore, err := history.NewDBStore(database.GetDB()); err != nil {
@@ -240,6 +368,7 @@ func (a *App) initialize() error {
 		historyStore = dbHistStore
 	}
 	a.History = history.NewManager(historyStore)
+	a.Task.SetHistoryRecorder(a.History)
 	log.Info("history manager initialized")
 
 	// 14. 初始化 Settings Manager
@@ -249,28 +378,74 @@ func (a *App) initialize() error {
 	}
 	log.Info("settings manager initialized")
 
+	// 调度策略从业务配置实时读取（修改 settings 后下一轮调度生效）
+	a.Task.SetSchedulingPolicy(func() *task.SchedulingPolicy {
+		ts := a.Settings.GetTask()
+		return &task.SchedulingPolicy{
+			MaxConcurrent: ts.MaxConcurrent,
+			MaxPerUser:    ts.MaxConcurrentPerUser,
+			MaxPerAgent:   ts.MaxConcurrentPerAgent,
+			UserWeights:   ts.UserWeights,
+		}
+	})
+
+	// 事件日志与执行历史使用相同的保留天数
+	a.Task.SetEventRetention(func() time.Duration {
+		st := a.Settings.GetStorage()
+		if !st.AutoCleanup || st.HistoryRetentionDays <= 0 {
+			return 0
+		}
+		return time.Duration(st.HistoryRetentionDays) * 24 * time.Hour
+	})
+
 	// 15. 初始化 Batch Manager (使用 GORM + Redis)
 	a.batchStore = batch.NewGormStore()
 	log.Info("batch store initialized (GORM)")
 
-	// 初始化 Redis 队列（可选）
-	var redisQueue *batch.RedisQueue
+	// 初始化任务队列：启用 Redis 时使用 Redis 队列，否则（或连接失败时）使用数据库队列
+	var queue batch.TaskQueue = batch.NewDBQueue(a.batchStore, a.Config.Redis.ClaimTimeout)
 	if a.Config.Redis.Enabled {
-		redisQueue, err = batch.NewRedisQueue(a.Config.Redis)
+		redisQueue, err := batch.NewRedisQueue(a.Config.Redis)
 		if err != nil {
-			log.Warn("Redis queue initialization failed, running without Redis", "error", err)
+			log.Warn("Redis queue initialization failed, using database queue", "error", err)
 		} else {
 			a.RedisQueue = redisQueue
+			queue = redisQueue
 			log.Info("Redis queue initialized", "addr", a.Config.Redis.Addr)
 		}
 	}
+	log.Info("batch queue initialized", "backend", queue.Backend())
 
+	budgets, err := batch.ParseProviderBudgets(a.Config.Batch.ProviderBudgets)
+	if err != nil {
+		log.Warn("invalid batch provider budgets, running without budgets", "error", err)
+	}
 	a.Batch = batch.NewManager(a.batchStore, a.Session, a.Agent, &batch.ManagerConfig{
 		MaxBatches:       10,                      // 最多同时运行 10 个 batch
 		PollInterval:     100 * time.Millisecond,  // 任务轮询间隔
 		ProgressInterval: 1 * time.Second,         // 进度更新间隔
-		RedisQueue:       redisQueue,
+		Queue:            queue,
+		Cluster:          a.Cluster,
+		ProviderBudgets:  budgets,
 	})
+	pricing, err := provider.ParsePricing(a.Config.Batch.ModelPricing)
+	if err != nil {
+		log.Warn("invalid batch model pricing, using built-in prices", "error", err)
+	}
+	a.Batch.SetPricing(provider.BuiltinPricing.Merge(pricing))
+	a.Batch.SetTemplateResolver(&batchTemplateResolver{tasks: a.Task})
+	a.Batch.SetEvalJudge(a.Provider)
+	a.Batch.SetResultCache(a.ResultCache)
+	// 并行 Batch 数与 Worker 总预算从业务配置实时读取（下一轮调度生效）
+	a.Batch.SetSchedulingPolicy(func() *batch.SchedulingPolicy {
+		bs := a.Settings.GetBatch()
+		return &batch.SchedulingPolicy{
+			MaxBatches:   bs.MaxConcurrentBatches,
+			WorkerBudget: bs.WorkerBudget,
+		}
+	})
+	// 实验 batch 的变体可覆盖 Agent 的 Provider
+	a.Batch.SetProviderEnvResolver(a.Provider.GetEnvVarsWithKey)
 	log.Info("batch manager initialized")
 
 	// 16. 初始化 Plugin Manager (Phase 1)
@@ -284,8 +459,12 @@ func (a *App) initialize() error {
 	// 17. 初始化 Cron Manager (Phase 1)
 	cronStore := cron.NewDBStore()
 	a.Cron = cron.NewManager(cronStore, a.cronJobExecutor)
+	a.Cron.SetLeaderCheck(a.Cluster.IsLeader)
 	log.Info("cron manager initialized")
 
+	// 19. 注册只在 Leader 上运行的单例后台任务
+	a.registerSingletons()
+
 	// 18. 初始化 Channel Manager (Phase 2)
 	a.Channel = channel.NewManager()
 	a.ChannelSession = channel.NewSessionManager(5 * time.Minute) // 5 分钟会话超时
@@ -335,13 +514,74 @@ func (a *App) initialize() error {
 	a.Channel.AddHandler(a.channelMessageHandler)
 	log.Info("channel manager initialized")
 
+	// 20. 校验所有密文可用已加载的密钥解密（主密钥配置错误时启动失败）
+	a.Secrets = newSecrets(crypto, a.Provider, a.Webhook)
+	if err := checkSecrets(a.Secrets); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// registerSingletons 注册只在 Leader 上运行的周期任务
+//
+// Cron 触发、GC 与文件清理在各自的循环中检查 Leader 身份；这里注册的是仅 Leader 需要执行的扫描。
+func (a *App) registerSingletons() {
+	// 接管已停止心跳的实例的运行中任务（每个心跳间隔扫描一次）
+	a.Cluster.RunAsLeader("task-takeover", 0, func(ctx context.Context) {
+		if n := a.Task.TakeOverOrphanedTasks(); n > 0 {
+			log.Warn("took over orphaned tasks", "count", n)
+		}
+	})
+
+	// 恢复已停止心跳的实例上运行中的批量任务（重置任务并暂停）
+	a.Cluster.RunAsLeader("batch-recovery", 0, func(ctx context.Context) {
+		if n := a.Batch.RecoverOrphaned(); n > 0 {
+			log.Warn("recovered orphaned batches", "count", n)
+		}
+	})
+
+	// 清理过期的结果缓存
+	a.Cluster.RunAsLeader("result-cache-purge", time.Hour, func(ctx context.Context) {
+		n, err := a.ResultCache.Purge()
+		if err != nil {
+			log.Warn("purge result cache failed", "error", err)
+		} else if n > 0 {
+			log.Info("purged expired result cache entries", "count", n)
+		}
+	})
+
+	// 清理过期的 Provider 探测历史
+	a.Cluster.RunAsLeader("provider-health-purge", time.Hour, func(ctx context.Context) {
+		n, err := a.ProviderHealth.Purge()
+		if err != nil {
+			log.Warn("purge provider health history failed", "error", err)
+		} else if n > 0 {
+			log.Info("purged provider health history", "count", n)
+		}
+	})
+
+	// 同步其他实例创建 / 修改的定时任务
+	a.Cluster.RunAsLeader("cron-sync", time.Minute, func(ctx context.Context) {
+		if err := a.Cron.Sync(); err != nil {
+			log.Warn("sync cron jobs failed", "error", err)
+		}
+	})
+}
+
 // Start 启动后台服务
 func (a *App) Start() {
+	// 先完成首次心跳与 Leader 选举，任务恢复与单例后台任务依赖实例存活状态
+	a.Cluster.Start()
+
 	a.Task.Start()
 	a.GC.Start()
+	a.ProviderHealth.Start()
+
+	// 首次启用全文检索时回填已有任务与通道消息
+	if a.Search != nil && a.Search.Empty() {
+		go a.backfillSearch()
+	}
 
 	// 启动 Skill Watcher（监控工作区 Skills）
 	if a.Skill != nil {
@@ -411,6 +651,10 @@ func (a *App) Close() error {
 		a.batchStore.Close()
 	}
 
+	if a.ProviderHealth != nil {
+		a.ProviderHealth.Stop()
+	}
+
 	if a.GC != nil {
 		a.GC.Stop()
 	}
@@ -419,6 +663,11 @@ func (a *App) Close() error {
 		a.Task.Stop()
 	}
 
+	// 任务停止后再注销实例，期间保持心跳避免任务被其他实例提前接管
+	if a.Cluster != nil {
+		a.Cluster.Stop()
+	}
+
 	// 停止 Skill Watcher
 	if a.Skill != nil {
 		a.Skill.Stop()
@@ -441,6 +690,36 @@ func (a *App) ServerAddr() string {
 	return fmt.Sprintf("%s:%d", a.Config.Server.Host, a.Config.Server.Port)
 }
 
+// batchTemplateResolver 将任务模板解析为批量任务配置（输入按模板参数校验并补齐默认值）
+type batchTemplateResolver struct {
+	tasks *task.Manager
+}
+
+// ResolveTemplate 实现 batch.TemplateResolver
+func (r *batchTemplateResolver) ResolveTemplate(templateID string, inputs []map[string]interface{}) (*batch.ResolvedTemplate, error) {
+	tpl, err := r.tasks.GetTemplate(templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	bound := make([]map[string]interface{}, len(inputs))
+	for i, input := range inputs {
+		if bound[i], err = tpl.BindParams(input); err != nil {
+			return nil, fmt.Errorf("inputs[%d]: %w", i, err)
+		}
+	}
+
+	return &batch.ResolvedTemplate{
+		UserID:         tpl.UserID,
+		AgentID:        tpl.AgentID,
+		PromptTemplate: tpl.Prompt,
+		Timeout:        tpl.Timeout,
+		Version:        tpl.Version,
+		Inputs:         bound,
+		Evaluators:     tpl.Evaluators,
+	}, nil
+}
+
 // cronJobExecutor Cron 任务执行器
 func (a *App) cronJobExecutor(ctx context.Context, job *cron.Job) error {
 	log.Info("executing cron job", "id", job.ID, "name", job.Name, "agent_id", job.AgentID)
@@ -450,6 +729,12 @@ func (a *App) cronJobExecutor(ctx context.Context, job *cron.Job) error {
 		AgentID: job.AgentID,
 		Prompt:  job.Prompt,
 	}
+	if job.TemplateID != "" {
+		// 引用任务模板：Agent 与 Prompt 由模板决定
+		taskReq.TemplateID = job.TemplateID
+		taskReq.Params = job.Params
+		taskReq.Prompt = ""
+	}
 
 	t, err := a.Task.CreateTask(taskReq)
 	if err != nil {
@@ -502,6 +787,34 @@ func (a *App) channelMessageHandler(ctx context.Context, msg *channel.Message) e
 	// 同时检查内存会话（兼容）
 	existingSession := a.ChannelSession.GetSession(sessionKey)
 
+	// 会话任务正在等待工具审批时，将「同意/拒绝」回复作为审批决定
+	activeTaskID := ""
+	if dbSession != nil && dbSession.Status == "active" {
+		activeTaskID = dbSession.TaskID
+	} else if existingSession != nil {
+		activeTaskID = existingSession.TaskID
+	}
+	if approve, ok := parseApprovalReply(msg.Content); ok && activeTaskID != "" {
+		if pending, err := a.Task.PendingApproval(activeTaskID); err == nil {
+			// 只有发起任务的用户可以审批（群聊中其他成员的回复不算）
+			if t, err := a.Task.GetTask(activeTaskID); err != nil || !isTaskStarter(t, msg.SenderID) {
+				log.Warn("approval reply from non-owner ignored", "approval_id", pending.ID, "sender", msg.SenderID)
+				a.sendChannelReply(msg.ChannelType, msg.ChannelID, msg.ID, "⚠️ 只有发起任务的用户可以审批该操作")
+				return nil
+			}
+			reply := "✅ 已批准，任务继续执行"
+			if !approve {
+				reply = "🚫 已拒绝该操作"
+			}
+			if _, err := a.Task.DecideApproval(pending.ID, approve, "", msg.SenderID); err != nil {
+				log.Warn("decide approval from channel failed", "approval_id", pending.ID, "error", err)
+				reply = "⚠️ 审批失败: " + err.Error()
+			}
+			a.sendChannelReply(msg.ChannelType, msg.ChannelID, msg.ID, reply)
+			return nil
+		}
+	}
+
 	var t *task.Task
 	var isNewSession bool
 
@@ -730,6 +1043,10 @@ func (a *App) waitAndReplyChannel(channelType, channelID, replyTo, taskID, sessi
 				result = "⚠️ 任务已取消"
 				completed = true
 				shouldDeleteSession = true // 取消时删除会话
+
+			case "task.waiting_approval":
+				// 提示用户审批，任务在审批后继续，不结束等待
+				a.sendChannelReply(channelType, channelID, replyTo, formatApprovalPrompt(event.Data))
 			}
 
 		case <-timeout:
@@ -760,6 +1077,39 @@ func (a *App) waitAndReplyChannel(channelType, channelID, replyTo, taskID, sessi
 	}
 }
 
+// parseApprovalReply 解析通道中的审批回复，ok 为 false 表示不是审批回复
+func parseApprovalReply(content string) (approve bool, ok bool) {
+	switch strings.ToLower(strings.TrimSpace(content)) {
+	case "同意", "批准", "允许", "approve", "yes", "y":
+		return true, true
+	case "拒绝", "不同意", "deny", "no", "n":
+		return false, true
+	}
+	return false, false
+}
+
+// isTaskStarter 发送者是否为通过通道发起该任务的用户
+func isTaskStarter(t *task.Task, senderID string) bool {
+	starter := t.Metadata["sender_id"]
+	return starter != "" && starter == senderID
+}
+
+// formatApprovalPrompt 生成工具审批提示消息
+func formatApprovalPrompt(data interface{}) string {
+	toolName := ""
+	input := ""
+	if m, ok := data.(map[string]interface{}); ok {
+		toolName, _ = m["tool_name"].(string)
+		if b, err := json.Marshal(m["input"]); err == nil && string(b) != "null" {
+			input = string(b)
+		}
+	}
+	if len(input) > 500 {
+		input = input[:500] + "..."
+	}
+	return fmt.Sprintf("🔐 Agent 请求执行工具 %s\n参数: %s\n\n回复「同意」批准，回复「拒绝」拒绝", toolName, input)
+}
+
 // sendChannelReply 发送通道回复
 func (a *App) sendChannelReply(channelType, channelID, replyTo, content string) *channel.SendResponse {
 	if a.Channel == nil {
@@ -817,7 +1167,9 @@ func (a *App) saveChannelMessage(msg *channel.Message, sessionID, taskID, direct
 
 	if err := a.ChannelMessageStore.Save(msgData); err != nil {
 		log.Warn("save channel message failed", "error", err)
+		return
 	}
+	a.indexChannelMessage(msgData)
 }
 
 // saveOutboundMessage 保存出站消息
@@ -842,5 +1194,35 @@ func (a *App) saveOutboundMessage(channelType, chatID, sessionID, taskID, messag
 
 	if err := a.ChannelMessageStore.Save(msgData); err != nil {
 		log.Warn("save outbound message failed", "error", err)
+		return
+	}
+	a.indexChannelMessage(msgData)
+}
+
+// backfillSearch 回填全文检索索引
+func (a *App) backfillSearch() {
+	tasks, err := a.Task.ReindexSearch()
+	if err != nil {
+		log.Warn("search backfill for tasks failed", "error", err)
+	}
+	messages, err := a.Search.RebuildMessages()
+	if err != nil {
+		log.Warn("search backfill for channel messages failed", "error", err)
+	}
+	log.Info("search index backfilled", "tasks", tasks, "messages", messages)
+}
+
+// indexChannelMessage 将通道消息写入全文检索索引
+func (a *App) indexChannelMessage(msg *channel.ChannelMessageData) {
+	if a.Search == nil || msg.Content == "" {
+		return
+	}
+	if err := a.Search.IndexMessage(search.Document{
+		ID:        search.DocumentID(search.KindMessage, msg.ID),
+		TaskID:    msg.TaskID,
+		Content:   msg.Content,
+		CreatedAt: msg.ReceivedAt,
+	}); err != nil {
+		log.Warn("index channel message failed", "message_id", msg.ID, "error", err)
 	}
 }
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/tmalldedede/agentbox/internal/channel/dingtalk"
+	"github.com/tmalldedede/agentbox/internal/channel/feishu"
+	"github.com/tmalldedede/agentbox/internal/channel/wecom"
+	"github.com/tmalldedede/agentbox/internal/config"
+	"github.com/tmalldedede/agentbox/internal/provider"
+	"github.com/tmalldedede/agentbox/internal/webhook"
+)
+
+// newCrypto 按配置加载主密钥与旧密钥
+func newCrypto(cfg config.EncryptionConfig) (*provider.Crypto, error) {
+	key, previous, err := cfg.LoadKeys()
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		log.Warn("no encryption key configured, using the insecure default key (set AGENTBOX_ENCRYPTION_KEY or AGENTBOX_ENCRYPTION_KEY_FILE)")
+		key = config.DefaultEncryptionKey
+	}
+	return provider.NewCrypto(key, previous...), nil
+}
+
+// newSecrets 注册所有保存密文的存储（渠道与 Webhook 的密钥在引入加密前以明文保存）
+func newSecrets(crypto *provider.Crypto, prov *provider.Manager, wh *webhook.Manager) *provider.Secrets {
+	secrets := provider.NewSecrets(crypto)
+	secrets.Register("provider_keys", prov, false)
+	secrets.Register("feishu_app_secrets", feishu.NewStore(), true)
+	secrets.Register("wecom_secrets", wecom.NewStore(), true)
+	secrets.Register("dingtalk_app_secrets", dingtalk.NewStore(), true)
+	secrets.Register("webhook_secrets", wh, true)
+	return secrets
+}
+
+// checkSecrets 启动校验：所有密文必须能用已加载的密钥解密，否则主密钥配置有误
+func checkSecrets(secrets *provider.Secrets) error {
+	report := secrets.Check()
+	if err := report.Err(); err != nil {
+		return fmt.Errorf("stored secrets cannot be decrypted, add the previous key to AGENTBOX_ENCRYPTION_PREVIOUS_KEYS or the key file: %w", err)
+	}
+	if n := report.Outdated(); n > 0 {
+		log.Warn("some secrets are not encrypted with the primary key, re-encrypt them via POST /api/v1/admin/secrets/rotate or `agentbox rotate-secrets`",
+			"count", n, "primary_key_id", report.PrimaryKeyID)
+	}
+	return nil
+}
+
+// RotateSecrets 离线将所有密文用主密钥重新加密（agentbox rotate-secrets）。
+// 需在服务停止时执行（运行中的实例会覆盖 Provider 密钥文件），调用前须已初始化数据库。
+func RotateSecrets(cfg *config.Config) (*provider.SecretReport, error) {
+	crypto, err := newCrypto(cfg.Encryption)
+	if err != nil {
+		return nil, err
+	}
+	provider.SetDefaultCrypto(crypto)
+	prov := provider.NewManagerWithCrypto(filepath.Join(cfg.Container.WorkspaceBase, "providers"), crypto)
+	return newSecrets(crypto, prov, webhook.NewManager()).Rotate(), nil
+}
@@ -0,0 +1,438 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmalldedede/agentbox/internal/apperr"
+)
+
+const (
+	decreaseCooldown = 5 * time.Second  // Minimum time between two decreases (one burst of 429s halves once)
+	minThrottleDelay = 1 * time.Second  // First backoff after a throttled task
+	maxThrottleDelay = 60 * time.Second // Backoff cap while the provider keeps throttling
+	budgetWindow     = time.Minute
+
+	throttleRetryFactor = 10 // Default throttle retry budget: MaxRetries (at least 1) times this factor
+)
+
+// AdaptiveConcurrency enables AIMD control of a batch's active workers.
+// The batch's Concurrency is the upper bound (and the initial value).
+type AdaptiveConcurrency struct {
+	MinConcurrency int `json:"min_concurrency,omitempty"` // Lower bound (default 1)
+	TargetLatency  int `json:"target_latency,omitempty"`  // Seconds; slower tasks count as congestion (0 = ignore latency)
+
+	// Throttled requeues allowed per task before it is dead-lettered
+	// (default throttleRetryFactor × MaxRetries, at least throttleRetryFactor)
+	MaxThrottleRetries int `json:"max_throttle_retries,omitempty"`
+}
+
+// throttleRetryLimit returns how many throttled requeues a task of the template may use.
+func throttleRetryLimit(t *BatchTemplate) int {
+	if t.Adaptive != nil && t.Adaptive.MaxThrottleRetries > 0 {
+		return t.Adaptive.MaxThrottleRetries
+	}
+	retries := t.MaxRetries
+	if retries < 1 {
+		retries = 1
+	}
+	return retries * throttleRetryFactor
+}
+
+// concurrencyLimiter limits how many of a batch's workers take tasks at the same time.
+// Without adaptive settings the limit stays at the worker count.
+type concurrencyLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	active  int
+	share   int           // Workers granted by the global worker budget (0 = no cap)
+	changed chan struct{} // Closed and replaced whenever a slot may have become available
+
+	adaptive  *AdaptiveConcurrency
+	min, max  int
+	successes int       // Successful tasks since the last change (additive increase after `limit` of them)
+	lastCut   time.Time // Last multiplicative decrease
+	delay     time.Duration
+	until     time.Time // No task starts before (backoff after throttling)
+}
+
+func newConcurrencyLimiter(workers int, adaptive *AdaptiveConcurrency) *concurrencyLimiter {
+	l := &concurrencyLimiter{
+		limit:    workers,
+		changed:  make(chan struct{}),
+		adaptive: adaptive,
+		min:      workers,
+		max:      workers,
+	}
+	if adaptive != nil {
+		l.min = adaptive.MinConcurrency
+		if l.min <= 0 {
+			l.min = 1
+		}
+		if l.min > workers {
+			l.min = workers
+		}
+	}
+	return l
+}
+
+// acquire blocks until the worker may take a task.
+func (l *concurrencyLimiter) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		wait := time.Until(l.until)
+		if wait <= 0 && l.active < l.allowed() {
+			l.active++
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			expired = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		case <-expired:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+func (l *concurrencyLimiter) release() {
+	l.mu.Lock()
+	l.active--
+	l.notify()
+	l.mu.Unlock()
+}
+
+// notify wakes up waiting workers (caller holds mu).
+func (l *concurrencyLimiter) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// current returns the current limit.
+func (l *concurrencyLimiter) current() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.allowed()
+}
+
+// allowed returns the limit capped by the share (caller holds mu).
+func (l *concurrencyLimiter) allowed() int {
+	if l.share > 0 && l.share < l.limit {
+		return l.share
+	}
+	return l.limit
+}
+
+// setShare caps the active workers to the batch's share of the global worker budget.
+func (l *concurrencyLimiter) setShare(share int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if share != l.share {
+		l.share = share
+		l.notify()
+	}
+}
+
+// concurrencyChange describes an adjustment of the active workers.
+type concurrencyChange struct {
+	From   int    `json:"from"`
+	To     int    `json:"to"`
+	Reason string `json:"reason"` // rate_limit, overloaded, timeout, latency or recovered
+}
+
+// observe feeds the outcome of a task into the controller and returns the resulting
+// change, if any. Throttling and timeouts halve the limit (at most once per cooldown)
+// and back off further task starts; every `limit` fast successes add one worker.
+func (l *concurrencyLimiter) observe(err error, latency time.Duration) *concurrencyChange {
+	if l.adaptive == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if err != nil {
+		reason := congestionReason(err)
+		if reason == "" {
+			return nil
+		}
+		if reason != string(apperr.ReasonTimeout) {
+			l.backoff(now)
+		}
+		return l.decrease(now, reason)
+	}
+
+	l.delay = 0
+	if target := time.Duration(l.adaptive.TargetLatency) * time.Second; target > 0 && latency > target {
+		return l.decrease(now, "latency")
+	}
+	l.successes++
+	if l.successes < l.limit || l.limit >= l.max {
+		return nil
+	}
+	return l.set(l.limit+1, "recovered")
+}
+
+func (l *concurrencyLimiter) decrease(now time.Time, reason string) *concurrencyChange {
+	if now.Sub(l.lastCut) < decreaseCooldown {
+		return nil
+	}
+	l.lastCut = now
+	return l.set(l.limit/2, reason)
+}
+
+func (l *concurrencyLimiter) set(limit int, reason string) *concurrencyChange {
+	if limit < l.min {
+		limit = l.min
+	}
+	if limit > l.max {
+		limit = l.max
+	}
+	l.successes = 0
+	if limit == l.limit {
+		return nil
+	}
+	change := &concurrencyChange{From: l.limit, To: limit, Reason: reason}
+	l.limit = limit
+	l.notify()
+	return change
+}
+
+// backoff delays further task starts exponentially while the provider keeps throttling.
+func (l *concurrencyLimiter) backoff(now time.Time) {
+	if l.delay == 0 {
+		l.delay = minThrottleDelay
+	} else if l.delay *= 2; l.delay > maxThrottleDelay {
+		l.delay = maxThrottleDelay
+	}
+	l.until = now.Add(l.delay)
+}
+
+// congestionReason classifies an execution error as a congestion signal
+// (rate_limit, overloaded or timeout); empty for other errors.
+func congestionReason(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return string(apperr.ReasonTimeout)
+	}
+	switch fe := apperr.ClassifyError(err); fe.Reason {
+	case apperr.ReasonRateLimit, apperr.ReasonOverloaded, apperr.ReasonTimeout:
+		return string(fe.Reason)
+	}
+	return ""
+}
+
+// isThrottled reports whether the provider rejected the request because of its limits.
+// Throttled attempts of adaptive batches do not count against MaxRetries but against
+// their own, larger budget (see throttleRetryLimit).
+func isThrottled(err error) bool {
+	reason := congestionReason(err)
+	return reason == string(apperr.ReasonRateLimit) || reason == string(apperr.ReasonOverloaded)
+}
+
+// ProviderBudget limits the requests and tokens per minute sent to one provider
+// by all batches of this instance. Zero means unlimited.
+type ProviderBudget struct {
+	RequestsPerMinute int `json:"requests_per_minute"`
+	TokensPerMinute   int `json:"tokens_per_minute"`
+}
+
+// ParseProviderBudgets parses budgets in the form "zhipu:rpm=60,tpm=100000;openai:rpm=500".
+func ParseProviderBudgets(s string) (map[string]ProviderBudget, error) {
+	budgets := make(map[string]ProviderBudget)
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		providerID, limits, ok := strings.Cut(entry, ":")
+		providerID = strings.TrimSpace(providerID)
+		if !ok || providerID == "" {
+			return nil, fmt.Errorf("invalid provider budget %q (expected provider:rpm=N,tpm=N)", entry)
+		}
+		var b ProviderBudget
+		for _, limit := range strings.Split(limits, ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(limit), "=")
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid limit %q for provider %s", limit, providerID)
+			}
+			switch strings.ToLower(strings.TrimSpace(key)) {
+			case "rpm":
+				b.RequestsPerMinute = n
+			case "tpm":
+				b.TokensPerMinute = n
+			default:
+				return nil, fmt.Errorf("unknown limit %q for provider %s (expected rpm or tpm)", key, providerID)
+			}
+		}
+		budgets[providerID] = b
+	}
+	return budgets, nil
+}
+
+// BudgetUsage is the usage of a provider budget over the last minute.
+type BudgetUsage struct {
+	ProviderID string `json:"provider_id"`
+	ProviderBudget
+	Requests int   `json:"requests"`
+	Tokens   int64 `json:"tokens"`
+}
+
+// budgetRequest is a request counted against a provider budget.
+type budgetRequest struct {
+	at     time.Time
+	tokens int64
+}
+
+// providerBudget enforces a ProviderBudget over a sliding one-minute window.
+type providerBudget struct {
+	limits   ProviderBudget
+	mu       sync.Mutex
+	requests []*budgetRequest
+}
+
+// reserve waits until the budget allows another request and counts it.
+// Tokens are unknown up front: they are added with use once the request finished,
+// so a request may overrun the token budget and delay the following ones.
+func (b *providerBudget) reserve(ctx context.Context) (*budgetRequest, error) {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.prune(now)
+		wait := b.wait(now)
+		if wait <= 0 {
+			r := &budgetRequest{at: now}
+			b.requests = append(b.requests, r)
+			b.mu.Unlock()
+			return r, nil
+		}
+		b.mu.Unlock()
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// use records the tokens consumed by a reserved request.
+func (b *providerBudget) use(r *budgetRequest, tokens int64) {
+	b.mu.Lock()
+	r.tokens = tokens
+	b.mu.Unlock()
+}
+
+// wait returns how long until the next request fits (caller holds mu, window pruned).
+func (b *providerBudget) wait(now time.Time) time.Duration {
+	var wait time.Duration
+	if rpm := b.limits.RequestsPerMinute; rpm > 0 && len(b.requests) >= rpm {
+		wait = b.requests[len(b.requests)-rpm].at.Add(budgetWindow).Sub(now)
+	}
+	if tpm := int64(b.limits.TokensPerMinute); tpm > 0 {
+		total := b.tokens()
+		// Drop the oldest requests until the remaining tokens fit
+		for _, r := range b.requests {
+			if total < tpm {
+				break
+			}
+			total -= r.tokens
+			if d := r.at.Add(budgetWindow).Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait
+}
+
+func (b *providerBudget) tokens() int64 {
+	var total int64
+	for _, r := range b.requests {
+		total += r.tokens
+	}
+	return total
+}
+
+func (b *providerBudget) prune(now time.Time) {
+	i := 0
+	for i < len(b.requests) && now.Sub(b.requests[i].at) >= budgetWindow {
+		i++
+	}
+	b.requests = b.requests[i:]
+}
+
+// SetProviderBudgets replaces the per-provider budgets shared by all batches.
+// Usage already counted for a provider is kept.
+func (m *Manager) SetProviderBudgets(budgets map[string]ProviderBudget) {
+	m.budgetMu.Lock()
+	defer m.budgetMu.Unlock()
+	next := make(map[string]*providerBudget, len(budgets))
+	for id, limits := range budgets {
+		if limits.RequestsPerMinute <= 0 && limits.TokensPerMinute <= 0 {
+			continue
+		}
+		b := m.budgets[id]
+		if b == nil {
+			b = &providerBudget{}
+		}
+		b.mu.Lock()
+		b.limits = limits
+		b.mu.Unlock()
+		next[id] = b
+	}
+	m.budgets = next
+}
+
+// providerBudget returns the budget of a provider, nil if unlimited.
+func (m *Manager) providerBudget(providerID string) *providerBudget {
+	if providerID == "" {
+		return nil
+	}
+	m.budgetMu.RLock()
+	defer m.budgetMu.RUnlock()
+	return m.budgets[providerID]
+}
+
+// GetBudgetUsage returns the usage of every provider budget over the last minute.
+func (m *Manager) GetBudgetUsage() []BudgetUsage {
+	m.budgetMu.RLock()
+	defer m.budgetMu.RUnlock()
+
+	usage := make([]BudgetUsage, 0, len(m.budgets))
+	now := time.Now()
+	for id, b := range m.budgets {
+		b.mu.Lock()
+		b.prune(now)
+		usage = append(usage, BudgetUsage{
+			ProviderID:     id,
+			ProviderBudget: b.limits,
+			Requests:       len(b.requests),
+			Tokens:         b.tokens(),
+		})
+		b.mu.Unlock()
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].ProviderID < usage[j].ProviderID })
+	return usage
+}
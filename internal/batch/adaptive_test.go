@@ -0,0 +1,115 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrencyLimiter_AIMD(t *testing.T) {
+	l := newConcurrencyLimiter(8, &AdaptiveConcurrency{MinConcurrency: 2})
+	assert.Equal(t, 8, l.current())
+
+	// 限流：减半并退避，冷却期内的后续限流不再减半
+	change := l.observe(errors.New("429 Too Many Requests: rate limit exceeded"), time.Second)
+	require.NotNil(t, change)
+	assert.Equal(t, concurrencyChange{From: 8, To: 4, Reason: "rate_limit"}, *change)
+	assert.True(t, l.until.After(time.Now()))
+	assert.Nil(t, l.observe(errors.New("429 Too Many Requests"), time.Second))
+	assert.Equal(t, 2*minThrottleDelay, l.delay)
+
+	// 下限
+	l.lastCut = time.Time{}
+	l.observe(errors.New("rate limit exceeded"), time.Second)
+	l.lastCut = time.Time{}
+	assert.Nil(t, l.observe(errors.New("rate limit exceeded"), time.Second))
+	assert.Equal(t, 2, l.current())
+
+	// 其他错误不影响并发
+	assert.Nil(t, l.observe(errors.New("invalid prompt"), time.Second))
+
+	// limit 次成功后加一
+	assert.Nil(t, l.observe(nil, time.Second))
+	change = l.observe(nil, time.Second)
+	require.NotNil(t, change)
+	assert.Equal(t, concurrencyChange{From: 2, To: 3, Reason: "recovered"}, *change)
+	assert.Zero(t, l.delay)
+
+	// 非自适应批次保持固定并发
+	fixed := newConcurrencyLimiter(4, nil)
+	assert.Nil(t, fixed.observe(errors.New("rate limit exceeded"), time.Second))
+	assert.Equal(t, 4, fixed.current())
+}
+
+func TestConcurrencyLimiter_Acquire(t *testing.T) {
+	l := newConcurrencyLimiter(1, nil)
+	require.NoError(t, l.acquire(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.acquire(ctx), context.DeadlineExceeded)
+
+	done := make(chan error, 1)
+	go func() { done <- l.acquire(context.Background()) }()
+	l.release()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("acquire not woken up by release")
+	}
+}
+
+func TestParseProviderBudgets(t *testing.T) {
+	budgets, err := ParseProviderBudgets(" zhipu:rpm=60,tpm=100000; openai:rpm=500 ;")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]ProviderBudget{
+		"zhipu":  {RequestsPerMinute: 60, TokensPerMinute: 100000},
+		"openai": {RequestsPerMinute: 500},
+	}, budgets)
+
+	for _, s := range []string{"zhipu", "zhipu:rpm=x", "zhipu:qps=1", ":rpm=1"} {
+		_, err := ParseProviderBudgets(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestProviderBudget(t *testing.T) {
+	m := &Manager{}
+	m.SetProviderBudgets(map[string]ProviderBudget{"zhipu": {RequestsPerMinute: 2, TokensPerMinute: 1000}, "openai": {}})
+	assert.Nil(t, m.providerBudget("openai"), "zero limits are unlimited")
+	b := m.providerBudget("zhipu")
+	require.NotNil(t, b)
+
+	r, err := b.reserve(context.Background())
+	require.NoError(t, err)
+	b.use(r, 400)
+	_, err = b.reserve(context.Background())
+	require.NoError(t, err)
+
+	// 请求数用尽，需等待窗口滑出
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = b.reserve(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// 重新配置保留已统计的用量
+	m.SetProviderBudgets(map[string]ProviderBudget{"zhipu": {TokensPerMinute: 300}})
+	assert.Equal(t, []BudgetUsage{{
+		ProviderID:     "zhipu",
+		ProviderBudget: ProviderBudget{TokensPerMinute: 300},
+		Requests:       2,
+		Tokens:         400,
+	}}, m.GetBudgetUsage())
+	assert.Greater(t, b.wait(time.Now()), 50*time.Second, "token budget exceeded")
+}
+
+func TestThrottleRetryLimit(t *testing.T) {
+	assert.Equal(t, throttleRetryFactor, throttleRetryLimit(&BatchTemplate{Adaptive: &AdaptiveConcurrency{}}))
+	assert.Equal(t, 3*throttleRetryFactor, throttleRetryLimit(&BatchTemplate{MaxRetries: 3, Adaptive: &AdaptiveConcurrency{}}))
+	assert.Equal(t, 5, throttleRetryLimit(&BatchTemplate{MaxRetries: 3, Adaptive: &AdaptiveConcurrency{MaxThrottleRetries: 5}}))
+}
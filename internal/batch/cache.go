@@ -0,0 +1,117 @@
+package batch
+
+import (
+	"fmt"
+
+	"github.com/tmalldedede/agentbox/internal/agent"
+	"github.com/tmalldedede/agentbox/internal/logger"
+	"github.com/tmalldedede/agentbox/internal/resultcache"
+)
+
+// SetResultCache sets the result cache used by batches that opt in (Template.Cache).
+func (m *Manager) SetResultCache(c *resultcache.Cache) {
+	m.cache = c
+}
+
+// cacheKey returns the result cache key of a task with its rendered prompt, or "" when the
+// batch does not use the cache or the key cannot be computed (the task then runs normally).
+func (m *Manager) cacheKey(batch *Batch, w *worker, task *BatchTask) string {
+	if m.cache == nil || batch.Template.Cache == nil {
+		return ""
+	}
+	agentID := w.agentID(batch)
+	var cfg *agent.AgentFullConfig
+	var err error
+	if w.variant != nil && w.variant.ProviderID != "" {
+		cfg, err = m.agentMgr.GetFullConfigForProvider(agentID, w.variant.ProviderID)
+	} else {
+		cfg, err = m.agentMgr.GetFullConfig(agentID)
+	}
+	if err != nil {
+		logger.Warn("Result cache skipped", "task_id", task.ID, "error", err)
+		return ""
+	}
+	files, err := m.inputFiles(batch, task.Input)
+	if err != nil {
+		logger.Warn("Result cache skipped", "task_id", task.ID, "error", err)
+		return ""
+	}
+	key, err := resultcache.Key(&resultcache.KeyInput{Config: cfg, Model: w.model(), Prompt: task.Prompt, Files: files})
+	if err != nil {
+		logger.Warn("Result cache skipped", "task_id", task.ID, "error", err)
+		return ""
+	}
+	return key
+}
+
+// inputFiles returns the local paths of the uploaded files referenced by a task's file
+// fields, in field order.
+func (m *Manager) inputFiles(batch *Batch, input map[string]interface{}) ([]string, error) {
+	if len(batch.Template.FileFields) == 0 || m.files == nil {
+		return nil, nil
+	}
+	var paths []string
+	add := func(field string, v interface{}) error {
+		fileID, ok := v.(string)
+		if !ok || fileID == "" {
+			return fmt.Errorf("input field %s: expected a file id, got %v", field, v)
+		}
+		path, _, err := m.files(fileID)
+		if err != nil {
+			return fmt.Errorf("input field %s: file %s: %w", field, fileID, err)
+		}
+		paths = append(paths, path)
+		return nil
+	}
+	for _, field := range batch.Template.FileFields {
+		value, ok := input[field]
+		if !ok || value == nil {
+			continue
+		}
+		if list, isList := value.([]interface{}); isList {
+			for _, v := range list {
+				if err := add(field, v); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		if err := add(field, value); err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+// cachedResult looks up a cached result (nil on a miss, without a key or on errors).
+func (m *Manager) cachedResult(key string) *resultcache.Entry {
+	if key == "" {
+		return nil
+	}
+	entry, err := m.cache.Get(key)
+	if err != nil {
+		logger.Warn("Failed to read result cache", "error", err)
+		return nil
+	}
+	return entry
+}
+
+// storeResult caches the result of a successful task. Results failing evaluation are not cached.
+func (m *Manager) storeResult(key string, batch *Batch, w *worker, task *BatchTask) {
+	if key == "" || (task.Evaluation != nil && !task.Evaluation.Passed) {
+		return
+	}
+	entry := &resultcache.Entry{
+		Key:               key,
+		AgentID:           w.agentID(batch),
+		Result:            task.Result,
+		InputTokens:       task.InputTokens,
+		CachedInputTokens: task.CachedInputTokens,
+		OutputTokens:      task.OutputTokens,
+		DurationMs:        task.DurationMs,
+		Source:            "batch:" + batch.ID,
+	}
+	if err := m.cache.Put(entry, m.cache.TTL(batch.Template.Cache)); err != nil {
+		logger.Warn("Failed to write result cache", "task_id", task.ID, "error", err)
+	}
+}
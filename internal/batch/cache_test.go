@@ -0,0 +1,48 @@
+package batch
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmalldedede/agentbox/internal/resultcache"
+)
+
+func TestInputFiles(t *testing.T) {
+	m := &Manager{
+		files: func(fileID string) (string, string, error) {
+			if fileID == "gone" {
+				return "", "", errors.New("file not found")
+			}
+			return filepath.Join("/uploads", fileID), fileID + ".txt", nil
+		},
+	}
+	b := &Batch{Template: BatchTemplate{FileFields: []string{"doc", "attachments", "missing"}}}
+
+	paths, err := m.inputFiles(b, map[string]interface{}{"doc": "f1", "attachments": []interface{}{"f2", "f3"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/uploads/f1", "/uploads/f2", "/uploads/f3"}, paths)
+
+	_, err = m.inputFiles(b, map[string]interface{}{"doc": "gone"})
+	assert.ErrorContains(t, err, "file not found")
+	_, err = m.inputFiles(b, map[string]interface{}{"doc": 42})
+	assert.ErrorContains(t, err, "expected a file id")
+
+	paths, err = m.inputFiles(&Batch{}, map[string]interface{}{"doc": "f1"})
+	require.NoError(t, err)
+	assert.Nil(t, paths)
+}
+
+func TestCacheKey_OptIn(t *testing.T) {
+	// 未设置缓存或 batch 未开启时不计算缓存键
+	m := &Manager{}
+	b := &Batch{AgentID: "a", Template: BatchTemplate{Cache: &resultcache.Policy{}}}
+	assert.Empty(t, m.cacheKey(b, &worker{}, &BatchTask{}))
+	assert.Nil(t, m.cachedResult(""))
+
+	m.cache = &resultcache.Cache{}
+	b.Template.Cache = nil
+	assert.Empty(t, m.cacheKey(b, &worker{}, &BatchTask{}))
+}
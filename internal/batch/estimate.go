@@ -0,0 +1,529 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"path/filepath"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"github.com/tmalldedede/agentbox/internal/logger"
+	"github.com/tmalldedede/agentbox/internal/provider"
+	"github.com/tmalldedede/agentbox/internal/session"
+)
+
+const (
+	maxDryRunSample     = 10  // Rows a dry run may execute for real
+	dryRunPreviews      = 5   // Rendered prompts returned as preview
+	historyBatches      = 20  // Recent completed batches of the agent the averages are taken from
+	maxSampleResultSize = 500 // Characters of a sample result returned
+)
+
+// maxDryRunSampleTime caps the wall time of the sample rows of a dry run (the request waits for them).
+const maxDryRunSampleTime = 2 * time.Minute
+
+// Projection bases, from most to least accurate
+const (
+	BasisSample  = "sample"  // Averages of the rows executed by the dry run
+	BasisHistory = "history" // Averages of the agent's completed batches
+	BasisPrompt  = "prompt"  // Estimated prompt tokens only (lower bound, no output or duration)
+)
+
+// DryRunRequest is a batch creation request to validate and estimate without creating the batch.
+type DryRunRequest struct {
+	CreateBatchRequest
+	Sample int `json:"sample"` // Execute the first N valid rows for real and extrapolate (max 10)
+}
+
+// PromptPreview is a rendered prompt of a dry run.
+type PromptPreview struct {
+	Row    int    `json:"row"`    // 1-based position among the inputs
+	Prompt string `json:"prompt"` // Rendered prompt (file fields as staged paths)
+	Tokens int    `json:"tokens"` // Estimated prompt tokens
+}
+
+// TaskAverages are per-task averages measured on executed tasks.
+type TaskAverages struct {
+	Batches           int     `json:"batches,omitempty"` // Batches the averages were taken from (history)
+	Tasks             int     `json:"tasks"`
+	DurationMs        float64 `json:"duration_ms"`
+	InputTokens       float64 `json:"input_tokens"`
+	CachedInputTokens float64 `json:"cached_input_tokens"`
+	OutputTokens      float64 `json:"output_tokens"`
+}
+
+// SampleRun is a row executed by a dry run.
+type SampleRun struct {
+	Row               int    `json:"row"`
+	DurationMs        int64  `json:"duration_ms"`
+	InputTokens       int64  `json:"input_tokens"`
+	CachedInputTokens int64  `json:"cached_input_tokens"`
+	OutputTokens      int64  `json:"output_tokens"`
+	Result            string `json:"result,omitempty"` // Truncated
+	Error             string `json:"error,omitempty"`
+}
+
+// Projection is the projected usage, cost and duration of a whole batch.
+type Projection struct {
+	Basis             string   `json:"basis"` // sample, history or prompt
+	Tasks             int      `json:"tasks"` // Rows that render (the others fail right away)
+	InputTokens       int64    `json:"input_tokens"`
+	CachedInputTokens int64    `json:"cached_input_tokens"`
+	OutputTokens      int64    `json:"output_tokens"`
+	CostUSD           *float64 `json:"cost_usd,omitempty"`         // Nil when the model has no known price
+	DurationSeconds   int64    `json:"duration_seconds,omitempty"` // Wall time at full concurrency (and within the provider budget)
+	Duration          string   `json:"duration,omitempty"`
+}
+
+// DryRunResult is the outcome of a dry run.
+type DryRunResult struct {
+	AgentID string               `json:"agent_id"`
+	Model   string               `json:"model,omitempty"`
+	Price   *provider.ModelPrice `json:"price,omitempty"` // USD per million tokens
+
+	Rows     int             `json:"rows"`             // Inputs (valid rows of the source)
+	Rendered int             `json:"rendered"`         // Inputs whose prompt rendered
+	Errors   []RowError      `json:"errors,omitempty"` // Template errors (row = position among the inputs)
+	Import   *ImportResult   `json:"import,omitempty"` // Source parsing (source inputs)
+	Previews []PromptPreview `json:"previews,omitempty"`
+
+	PromptTokens    int64   `json:"prompt_tokens"`     // Estimated, over all rendered prompts
+	AvgPromptTokens float64 `json:"avg_prompt_tokens"` // Estimated, per rendered prompt
+
+	History       *TaskAverages `json:"history,omitempty"`
+	Sample        *TaskAverages `json:"sample,omitempty"`
+	SampleRuns    []SampleRun   `json:"sample_runs,omitempty"`
+	SampleSkipped int           `json:"sample_skipped,omitempty"` // Sample rows not run within maxDryRunSampleTime
+
+	Variants   []VariantProjection `json:"variants,omitempty"` // Experiments: projection of each variant
+	Projection Projection          `json:"projection"`         // Experiments: all variants combined
+}
+
+// VariantProjection is the projection of one experiment variant.
+type VariantProjection struct {
+	Name       string               `json:"name"`
+	AgentID    string               `json:"agent_id"`
+	Model      string               `json:"model,omitempty"`
+	Price      *provider.ModelPrice `json:"price,omitempty"`
+	History    *TaskAverages        `json:"history,omitempty"`
+	Projection Projection           `json:"projection"`
+}
+
+// SetPricing sets the model prices used for cost estimates.
+func (m *Manager) SetPricing(p provider.Pricing) {
+	m.pricing = p
+}
+
+// DryRun renders the prompt of every input, estimates the tokens and projects the cost and
+// duration of the batch the request would create, without creating it. With Sample > 0 the
+// first valid rows are executed for real (for at most maxDryRunSampleTime) and the projection
+// is extrapolated from them.
+func (m *Manager) DryRun(ctx context.Context, req *DryRunRequest) (*DryRunResult, error) {
+	if req.Sample < 0 || req.Sample > maxDryRunSample {
+		return nil, fmt.Errorf("sample must be between 0 and %d", maxDryRunSample)
+	}
+	if req.Sample > 0 && len(req.Variants) > 0 {
+		return nil, fmt.Errorf("sample is not supported for experiments")
+	}
+	if _, err := m.prepareCreate(&req.CreateBatchRequest); err != nil {
+		return nil, err
+	}
+	// Missing fields render as "<no value>" at execution; the dry run reports them instead
+	tmpl, err := template.New("prompt").Option("missingkey=error").Parse(req.PromptTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prompt_template: %w", err)
+	}
+
+	batch := &Batch{
+		ID:          "dryrun-" + uuid.New().String()[:8],
+		AgentID:     req.AgentID,
+		Concurrency: req.Concurrency,
+		Template: BatchTemplate{
+			PromptTemplate: req.PromptTemplate,
+			Timeout:        req.Timeout,
+			Isolation:      req.Isolation,
+			FileFields:     req.FileFields,
+			Variants:       req.Variants,
+		},
+	}
+	if batch.Concurrency <= 0 {
+		batch.Concurrency = 5
+	}
+	if batch.Template.Timeout <= 0 {
+		batch.Template.Timeout = 300
+	}
+
+	result := &DryRunResult{AgentID: req.AgentID}
+	var samples []map[string]interface{}
+	var sampleRows []int
+	render := func(inputs []map[string]interface{}) error {
+		for _, input := range inputs {
+			result.Rows++
+			prompt, err := m.previewPrompt(tmpl, &batch.Template, input)
+			if err != nil {
+				if len(result.Errors) < maxImportErrors {
+					result.Errors = append(result.Errors, RowError{Row: result.Rows, Message: err.Error()})
+				}
+				continue
+			}
+			result.Rendered++
+			tokens := estimateTokens(prompt)
+			result.PromptTokens += int64(tokens)
+			if len(result.Previews) < dryRunPreviews {
+				result.Previews = append(result.Previews, PromptPreview{Row: result.Rows, Prompt: prompt, Tokens: tokens})
+			}
+			if len(samples) < req.Sample {
+				samples = append(samples, input)
+				sampleRows = append(sampleRows, result.Rows)
+			}
+		}
+		return nil
+	}
+	if req.Source != nil {
+		if result.Import, err = m.readInputs(req.Source, req.TemplateID, render); err != nil {
+			return nil, err
+		}
+	} else if err := render(req.Inputs); err != nil {
+		return nil, err
+	}
+	if result.Rendered > 0 {
+		result.AvgPromptTokens = float64(result.PromptTokens) / float64(result.Rendered)
+	}
+
+	if len(req.Variants) > 0 {
+		m.projectVariants(result, req.Variants, batch)
+		return result, nil
+	}
+
+	// Model and price
+	result.Model = m.resolveModel(req.AgentID, "", "")
+	if price, ok := m.pricing.Lookup(result.Model); ok {
+		result.Price = &price
+	}
+	budget := m.variantBudget(batch, nil)
+
+	if result.History, err = m.agentHistory(req.AgentID); err != nil {
+		logger.Warn("Failed to load batch history", "agent_id", req.AgentID, "error", err)
+	}
+	if len(samples) > 0 {
+		if result.SampleRuns, err = m.runSample(ctx, batch, budget, samples, sampleRows); err != nil {
+			return nil, err
+		}
+		result.SampleSkipped = len(samples) - len(result.SampleRuns)
+		if len(result.SampleRuns) > 0 {
+			result.Sample = sampleAverages(result.SampleRuns)
+		}
+	}
+
+	result.Projection = project(result, batch.Concurrency, budget)
+	return result, nil
+}
+
+// projectVariants projects every variant of an experiment over all rendered inputs, from the
+// history of the variant's agent, and combines them into the result's projection.
+func (m *Manager) projectVariants(result *DryRunResult, variants []Variant, batch *Batch) {
+	total := Projection{Basis: BasisHistory}
+	cost := 0.0
+	priced := true
+	for i := range variants {
+		v := &variants[i]
+		vr := &DryRunResult{Rendered: result.Rendered, PromptTokens: result.PromptTokens}
+		vr.Model = m.resolveModel(v.AgentID, v.ProviderID, v.Model)
+		if price, ok := m.pricing.Lookup(vr.Model); ok {
+			vr.Price = &price
+		}
+		var err error
+		if vr.History, err = m.agentHistory(v.AgentID); err != nil {
+			logger.Warn("Failed to load batch history", "agent_id", v.AgentID, "error", err)
+		}
+		// Each variant runs with its share of the workers
+		p := project(vr, batch.laneConcurrency(), m.variantBudget(batch, v))
+		result.Variants = append(result.Variants, VariantProjection{
+			Name:       v.Name,
+			AgentID:    v.AgentID,
+			Model:      vr.Model,
+			Price:      vr.Price,
+			History:    vr.History,
+			Projection: p,
+		})
+
+		if p.Basis == BasisPrompt {
+			total.Basis = BasisPrompt
+		}
+		total.Tasks += p.Tasks
+		total.InputTokens += p.InputTokens
+		total.CachedInputTokens += p.CachedInputTokens
+		total.OutputTokens += p.OutputTokens
+		if p.CostUSD == nil {
+			priced = false
+		} else {
+			cost += *p.CostUSD
+		}
+		if p.DurationSeconds > total.DurationSeconds {
+			total.DurationSeconds = p.DurationSeconds
+			total.Duration = p.Duration
+		}
+	}
+	if priced {
+		total.CostUSD = &cost
+	}
+	result.Projection = total
+}
+
+// previewPrompt renders a prompt the way a worker would, with file fields replaced by
+// the path their file would be staged at.
+func (m *Manager) previewPrompt(tmpl *template.Template, tpl *BatchTemplate, input map[string]interface{}) (string, error) {
+	data := input
+	if len(tpl.FileFields) > 0 {
+		data = make(map[string]interface{}, len(input))
+		for k, v := range input {
+			data[k] = v
+		}
+		path := func(field string, v interface{}) (string, error) {
+			fileID, ok := v.(string)
+			if !ok || fileID == "" {
+				return "", fmt.Errorf("input field %s: expected a file id, got %v", field, v)
+			}
+			_, name, err := m.files(fileID)
+			if err != nil {
+				return "", fmt.Errorf("input field %s: file %s: %w", field, fileID, err)
+			}
+			return stagedInputDir + "/" + filepath.Base(name), nil
+		}
+		for _, field := range tpl.FileFields {
+			value, ok := input[field]
+			if !ok || value == nil {
+				continue
+			}
+			var err error
+			if list, isList := value.([]interface{}); isList {
+				paths := make([]interface{}, len(list))
+				for i, v := range list {
+					if paths[i], err = path(field, v); err != nil {
+						return "", err
+					}
+				}
+				data[field] = paths
+				continue
+			}
+			if data[field], err = path(field, value); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// estimateTokens approximates the token count of a text: about four characters per
+// token for ASCII and one token per character otherwise (CJK).
+func estimateTokens(s string) int {
+	ascii, other := 0, 0
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// agentHistory averages the tasks of the agent's most recent completed batches.
+// Returns nil without history.
+func (m *Manager) agentHistory(agentID string) (*TaskAverages, error) {
+	batches, _, err := m.store.ListBatches(&ListBatchFilter{AgentID: agentID, Status: BatchStatusCompleted, Limit: historyBatches})
+	if err != nil {
+		return nil, err
+	}
+
+	h := &TaskAverages{}
+	var duration float64
+	var attempted int
+	var input, cachedInput, output int64
+	for _, b := range batches {
+		stats, err := m.store.GetTaskStats(b.ID)
+		if err != nil {
+			return nil, err
+		}
+		// Cache hits used neither time nor tokens
+		executed := stats.Completed - stats.CacheHits
+		if executed <= 0 {
+			continue
+		}
+		h.Batches++
+		h.Tasks += executed
+		duration += stats.AvgDuration * float64(executed)
+		// Failed tasks consumed tokens as well
+		attempted += executed + stats.Failed + stats.Dead
+		input += stats.InputTokens
+		cachedInput += stats.CachedInputTokens
+		output += stats.OutputTokens
+	}
+	if h.Tasks == 0 {
+		return nil, nil
+	}
+	h.DurationMs = duration / float64(h.Tasks)
+	h.InputTokens = float64(input) / float64(attempted)
+	h.CachedInputTokens = float64(cachedInput) / float64(attempted)
+	h.OutputTokens = float64(output) / float64(attempted)
+	return h, nil
+}
+
+// runSample executes inputs one after the other on a worker of the batch (same isolation
+// as a real run) and discards the worker's sessions afterwards. Rows stop once
+// maxDryRunSampleTime is spent; the interrupted row and the remaining ones are not returned.
+func (m *Manager) runSample(ctx context.Context, batch *Batch, budget *providerBudget, inputs []map[string]interface{}, rows []int) ([]SampleRun, error) {
+	sampleCtx, cancel := context.WithTimeout(ctx, maxDryRunSampleTime)
+	defer cancel()
+
+	w := &worker{id: "sample", isolated: batch.Template.isolated()}
+	sessionID, err := m.startSession(sampleCtx, batch, w, workerWorkspace(batch, w.id, 0))
+	if err != nil {
+		return nil, err
+	}
+	w.sessionID = sessionID
+	if batch.Template.Isolation == IsolationFreshSession {
+		m.warmSpare(sampleCtx, batch, w)
+	}
+	defer func() {
+		m.dropSpare(w)
+		m.discardSession(w.sessionID, w.isolated)
+	}()
+
+	runs := make([]SampleRun, 0, len(inputs))
+	for i, input := range inputs {
+		run := SampleRun{Row: rows[i]}
+		if err := m.runSampleTask(sampleCtx, batch, w, budget, input, &run); err != nil {
+			run.Error = err.Error()
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if sampleCtx.Err() != nil {
+			break
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+func (m *Manager) runSampleTask(ctx context.Context, batch *Batch, w *worker, budget *providerBudget, input map[string]interface{}, run *SampleRun) error {
+	if err := m.isolate(ctx, batch, w); err != nil {
+		return err
+	}
+	w.used = true
+	staged, err := m.stageInputs(batch, w, input)
+	if err != nil {
+		return err
+	}
+	prompt, err := m.renderPrompt(batch.Template.PromptTemplate, staged)
+	if err != nil {
+		return fmt.Errorf("template error: %w", err)
+	}
+
+	var reserved *budgetRequest
+	if budget != nil {
+		if reserved, err = budget.reserve(ctx); err != nil {
+			return err
+		}
+	}
+	start := time.Now()
+	execCtx, cancel := context.WithTimeout(ctx, time.Duration(batch.Template.Timeout)*time.Second)
+	defer cancel()
+	result, err := m.sessionMgr.Exec(execCtx, w.sessionID, &session.ExecRequest{Prompt: prompt})
+	run.DurationMs = time.Since(start).Milliseconds()
+	if result != nil && result.Usage != nil {
+		run.InputTokens = int64(result.Usage.InputTokens)
+		run.CachedInputTokens = int64(result.Usage.CachedInputTokens)
+		run.OutputTokens = int64(result.Usage.OutputTokens)
+	}
+	if reserved != nil {
+		budget.use(reserved, run.InputTokens+run.OutputTokens)
+	}
+	if err != nil {
+		return err
+	}
+
+	run.Result = result.Message
+	if run.Result == "" {
+		run.Result = result.Output
+	}
+	if r := []rune(run.Result); len(r) > maxSampleResultSize {
+		run.Result = string(r[:maxSampleResultSize]) + "..."
+	}
+	return nil
+}
+
+// sampleAverages averages the sample runs. Durations only count successful runs.
+func sampleAverages(runs []SampleRun) *TaskAverages {
+	a := &TaskAverages{Tasks: len(runs)}
+	succeeded := 0
+	for _, r := range runs {
+		a.InputTokens += float64(r.InputTokens)
+		a.CachedInputTokens += float64(r.CachedInputTokens)
+		a.OutputTokens += float64(r.OutputTokens)
+		if r.Error == "" {
+			a.DurationMs += float64(r.DurationMs)
+			succeeded++
+		}
+	}
+	n := float64(len(runs))
+	a.InputTokens /= n
+	a.CachedInputTokens /= n
+	a.OutputTokens /= n
+	if succeeded > 0 {
+		a.DurationMs /= float64(succeeded)
+	}
+	return a
+}
+
+// project extrapolates the per-task averages (sample, then history, then prompt estimate)
+// to all rendered inputs.
+func project(r *DryRunResult, concurrency int, budget *providerBudget) Projection {
+	p := Projection{Basis: BasisPrompt, Tasks: r.Rendered, InputTokens: r.PromptTokens}
+	avg := r.Sample
+	if avg != nil {
+		p.Basis = BasisSample
+	} else if avg = r.History; avg != nil {
+		p.Basis = BasisHistory
+	}
+
+	tasks := float64(r.Rendered)
+	if avg != nil {
+		p.InputTokens = int64(math.Round(avg.InputTokens * tasks))
+		p.CachedInputTokens = int64(math.Round(avg.CachedInputTokens * tasks))
+		p.OutputTokens = int64(math.Round(avg.OutputTokens * tasks))
+
+		// Tasks run in waves of `concurrency`, unless the provider budget is the bottleneck
+		seconds := math.Ceil(tasks/float64(concurrency)) * avg.DurationMs / 1000
+		if budget != nil {
+			budget.mu.Lock()
+			limits := budget.limits
+			budget.mu.Unlock()
+			if rpm := limits.RequestsPerMinute; rpm > 0 {
+				seconds = math.Max(seconds, tasks/float64(rpm)*60)
+			}
+			if tpm := limits.TokensPerMinute; tpm > 0 {
+				seconds = math.Max(seconds, float64(p.InputTokens+p.OutputTokens)/float64(tpm)*60)
+			}
+		}
+		p.DurationSeconds = int64(math.Ceil(seconds))
+		p.Duration = (time.Duration(p.DurationSeconds) * time.Second).String()
+	}
+
+	if r.Price != nil {
+		cost := r.Price.Cost(p.InputTokens, p.CachedInputTokens, p.OutputTokens)
+		p.CostUSD = &cost
+	}
+	return p
+}
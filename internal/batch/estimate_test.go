@@ -0,0 +1,86 @@
+package batch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tmalldedede/agentbox/internal/provider"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	assert.Equal(t, 0, estimateTokens(""))
+	assert.Equal(t, 4, estimateTokens("Summarize this"))
+	assert.Equal(t, 4, estimateTokens("总结一下"))
+	assert.Equal(t, 3, estimateTokens("ok 好的"))
+}
+
+func TestPreviewPrompt(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "f1"), []byte("x"), 0o644))
+	m := newImportManager(dir)
+	tmpl := template.Must(template.New("prompt").Option("missingkey=error").Parse("Review {{.doc}} for {{.team}}"))
+	tpl := &BatchTemplate{FileFields: []string{"doc"}}
+
+	prompt, err := m.previewPrompt(tmpl, tpl, map[string]interface{}{"doc": "f1", "team": "legal"})
+	require.NoError(t, err)
+	assert.Equal(t, "Review inputs/f1 for legal", prompt)
+
+	// 执行时缺失字段渲染为 <no value>，dry-run 报告为错误
+	_, err = m.previewPrompt(tmpl, tpl, map[string]interface{}{"doc": "f1"})
+	assert.ErrorContains(t, err, `no entry for key "team"`)
+
+	_, err = m.previewPrompt(tmpl, tpl, map[string]interface{}{"doc": "missing", "team": "legal"})
+	assert.ErrorContains(t, err, "file missing")
+}
+
+func TestProject(t *testing.T) {
+	price := provider.ModelPrice{Input: 3, CachedInput: 0.3, Output: 15}
+	r := &DryRunResult{Rendered: 100, PromptTokens: 20000, Price: &price}
+
+	// 只有 prompt 估算：不含输出与耗时
+	p := project(r, 10, nil)
+	assert.Equal(t, BasisPrompt, p.Basis)
+	assert.Equal(t, int64(20000), p.InputTokens)
+	assert.Zero(t, p.DurationSeconds)
+	require.NotNil(t, p.CostUSD)
+	assert.InDelta(t, 0.06, *p.CostUSD, 1e-9)
+
+	// 样本优先于历史
+	r.History = &TaskAverages{Tasks: 50, DurationMs: 60000, InputTokens: 5000, OutputTokens: 500}
+	r.Sample = &TaskAverages{Tasks: 2, DurationMs: 30000, InputTokens: 10000, CachedInputTokens: 5000, OutputTokens: 1000}
+	p = project(r, 10, nil)
+	assert.Equal(t, BasisSample, p.Basis)
+	assert.Equal(t, int64(1000000), p.InputTokens)
+	assert.Equal(t, int64(500000), p.CachedInputTokens)
+	assert.Equal(t, int64(100000), p.OutputTokens)
+	assert.Equal(t, int64(300), p.DurationSeconds) // 10 轮 × 30s
+	assert.Equal(t, "5m0s", p.Duration)
+	assert.InDelta(t, 1.5+0.15+1.5, *p.CostUSD, 1e-9)
+
+	// Provider 预算成为瓶颈
+	budget := &providerBudget{limits: ProviderBudget{RequestsPerMinute: 10}}
+	p = project(r, 10, budget)
+	assert.Equal(t, int64(600), p.DurationSeconds)
+
+	r.Sample, r.Price = nil, nil
+	p = project(r, 10, nil)
+	assert.Equal(t, BasisHistory, p.Basis)
+	assert.Equal(t, int64(50000), p.OutputTokens)
+	assert.Nil(t, p.CostUSD)
+}
+
+func TestSampleAverages(t *testing.T) {
+	a := sampleAverages([]SampleRun{
+		{DurationMs: 1000, InputTokens: 100, OutputTokens: 10},
+		{DurationMs: 50, InputTokens: 20, Error: "rate limit"},
+	})
+	assert.Equal(t, 2, a.Tasks)
+	assert.Equal(t, 1000.0, a.DurationMs)
+	assert.Equal(t, 60.0, a.InputTokens)
+	assert.Equal(t, 5.0, a.OutputTokens)
+}
@@ -0,0 +1,345 @@
+package batch
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tmalldedede/agentbox/internal/eval"
+	"github.com/tmalldedede/agentbox/internal/provider"
+)
+
+const (
+	maxVariants       = 10
+	maxVariantNameLen = 64
+	comparisonPage    = 1000 // Tasks read per page for the side-by-side view
+)
+
+// ProviderEnvResolver returns the environment variables (API key included) of a provider.
+// Used by experiment variants that override their agent's provider.
+type ProviderEnvResolver func(providerID string) (map[string]string, error)
+
+// SetProviderEnvResolver sets the provider lookup used by variants overriding the provider.
+func (m *Manager) SetProviderEnvResolver(r ProviderEnvResolver) {
+	m.providerEnv = r
+}
+
+// validateVariants checks the experiment variants of a create request and fills in their
+// defaults (agent and name).
+func (m *Manager) validateVariants(req *CreateBatchRequest) error {
+	if len(req.Variants) == 0 {
+		return nil
+	}
+	if len(req.Variants) < 2 || len(req.Variants) > maxVariants {
+		return fmt.Errorf("an experiment needs between 2 and %d variants", maxVariants)
+	}
+	if req.Adaptive != nil {
+		return fmt.Errorf("adaptive concurrency is not supported for experiments")
+	}
+	if req.Concurrency > 0 && req.Concurrency < len(req.Variants) {
+		return fmt.Errorf("concurrency (%d) is split across variants and must be at least the number of variants (%d)",
+			req.Concurrency, len(req.Variants))
+	}
+
+	names := make(map[string]bool, len(req.Variants))
+	for i := range req.Variants {
+		v := &req.Variants[i]
+		v.ResolvedModel = "" // Set when the batch starts
+		if v.AgentID == "" {
+			v.AgentID = req.AgentID
+		}
+		ag, err := m.agentMgr.Get(v.AgentID)
+		if err != nil {
+			return fmt.Errorf("variant %d: agent not found: %s", i+1, v.AgentID)
+		}
+		if ag.ApprovalEnabled() {
+			return fmt.Errorf("variant %d: agent %s requires tool approval, which batches do not support", i+1, v.AgentID)
+		}
+		if v.ProviderID != "" {
+			if _, err := m.variantEnv(v); err != nil {
+				return err
+			}
+		}
+
+		if v.Name == "" {
+			parts := []string{v.AgentID}
+			for _, p := range []string{v.ProviderID, v.Model} {
+				if p != "" {
+					parts = append(parts, p)
+				}
+			}
+			v.Name = strings.Join(parts, "/")
+		}
+		if len(v.Name) > maxVariantNameLen {
+			return fmt.Errorf("variant name %q is longer than %d characters", v.Name, maxVariantNameLen)
+		}
+		if names[v.Name] {
+			return fmt.Errorf("duplicate variant %q (variants need distinct names)", v.Name)
+		}
+		names[v.Name] = true
+	}
+	return nil
+}
+
+// agentID returns the agent the worker runs.
+func (w *worker) agentID(batch *Batch) string {
+	if w.variant != nil {
+		return w.variant.AgentID
+	}
+	return batch.AgentID
+}
+
+// model returns the model override of the worker's variant: the model pinned when the
+// batch started, else the variant's override (empty = the agent's model).
+func (w *worker) model() string {
+	if w.variant == nil {
+		return ""
+	}
+	if w.variant.ResolvedModel != "" {
+		return w.variant.ResolvedModel
+	}
+	return w.variant.Model
+}
+
+// variantEnv returns the session env vars of a variant overriding the provider, nil otherwise.
+func (m *Manager) variantEnv(v *Variant) (map[string]string, error) {
+	if v == nil || v.ProviderID == "" {
+		return nil, nil
+	}
+	if m.providerEnv == nil {
+		return nil, fmt.Errorf("variant %s: provider overrides are not available", v.Name)
+	}
+	env, err := m.providerEnv(v.ProviderID)
+	if err != nil {
+		return nil, fmt.Errorf("variant %s: provider %s: %w", v.Name, v.ProviderID, err)
+	}
+	return env, nil
+}
+
+// variantProvider returns the provider a variant (or the batch's agent, v == nil) calls.
+func (m *Manager) variantProvider(batch *Batch, v *Variant) string {
+	if v != nil && v.ProviderID != "" {
+		return v.ProviderID
+	}
+	agentID := batch.AgentID
+	if v != nil {
+		agentID = v.AgentID
+	}
+	if ag, err := m.agentMgr.Get(agentID); err == nil {
+		return ag.ProviderID
+	}
+	return ""
+}
+
+// variantBudget returns the budget of the provider a variant calls, nil if unlimited.
+func (m *Manager) variantBudget(batch *Batch, v *Variant) *providerBudget {
+	return m.providerBudget(m.variantProvider(batch, v))
+}
+
+// resolveModel returns the model an agent runs with: the override, else the agent's model,
+// else the default model of the provider (the agent's or providerID).
+func (m *Manager) resolveModel(agentID, providerID, override string) string {
+	if override != "" {
+		return override
+	}
+	cfg, err := m.agentMgr.GetFullConfig(agentID)
+	if providerID != "" {
+		cfg, err = m.agentMgr.GetFullConfigForProvider(agentID, providerID)
+	}
+	if err != nil {
+		return ""
+	}
+	if cfg.Agent.Model != "" {
+		return cfg.Agent.Model
+	}
+	if cfg.Provider != nil {
+		return cfg.Provider.DefaultModel
+	}
+	return ""
+}
+
+// queueFor returns the queue of the workers that run a task.
+func (rb *runningBatch) queueFor(task *BatchTask) chan *BatchTask {
+	if queue, ok := rb.variantQueues[task.Variant]; ok {
+		return queue
+	}
+	return rb.taskQueue
+}
+
+// VariantReport summarizes the tasks of one experiment variant.
+type VariantReport struct {
+	Name       string `json:"name"`
+	AgentID    string `json:"agent_id"`
+	ProviderID string `json:"provider_id,omitempty"`
+	Model      string `json:"model,omitempty"` // Model the variant ran with
+
+	Tasks       int     `json:"tasks"`
+	Completed   int     `json:"completed"`
+	Failed      int     `json:"failed"`
+	Dead        int     `json:"dead"`
+	Pending     int     `json:"pending"`      // Pending or running
+	CacheHits   int     `json:"cache_hits"`   // Completed from the result cache
+	SuccessRate float64 `json:"success_rate"` // Completed / finished tasks
+
+	AvgDurationMs     float64  `json:"avg_duration_ms"` // Completed tasks
+	InputTokens       int64    `json:"input_tokens"`
+	CachedInputTokens int64    `json:"cached_input_tokens"`
+	OutputTokens      int64    `json:"output_tokens"`
+	CostUSD           *float64 `json:"cost_usd,omitempty"` // Nil when the model has no known price
+
+	EvalPassed   int     `json:"eval_passed"`
+	EvalFailed   int     `json:"eval_failed"`
+	EvalPassRate float64 `json:"eval_pass_rate"` // Passed / evaluated tasks
+	AvgEvalScore float64 `json:"avg_eval_score"`
+}
+
+// ComparisonReport compares the variants of an experiment batch.
+type ComparisonReport struct {
+	BatchID  string          `json:"batch_id"`
+	Rows     int             `json:"rows"` // Inputs, each run once per variant
+	Variants []VariantReport `json:"variants"`
+}
+
+// VariantResult is the outcome of one input on one variant.
+type VariantResult struct {
+	Variant      string          `json:"variant"`
+	Status       BatchTaskStatus `json:"status"`
+	Result       string          `json:"result,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	DurationMs   int64           `json:"duration_ms,omitempty"`
+	InputTokens  int64           `json:"input_tokens,omitempty"`
+	OutputTokens int64           `json:"output_tokens,omitempty"`
+	Evaluation   *eval.Report    `json:"evaluation,omitempty"`
+}
+
+// ComparisonRow holds the results of all variants for one input.
+type ComparisonRow struct {
+	Row     int                    `json:"row"` // 0-based input row
+	Input   map[string]interface{} `json:"input"`
+	Results []VariantResult        `json:"results"` // In variant order
+}
+
+// experiment returns a batch that runs variants.
+func (m *Manager) experiment(batchID string) (*Batch, error) {
+	batch, err := m.store.GetBatch(batchID)
+	if err != nil {
+		return nil, err
+	}
+	if len(batch.Template.Variants) == 0 {
+		return nil, fmt.Errorf("batch %s is not an experiment (no variants)", batchID)
+	}
+	return batch, nil
+}
+
+// Compare returns the per-variant report of an experiment batch.
+func (m *Manager) Compare(batchID string) (*ComparisonReport, error) {
+	batch, err := m.experiment(batchID)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := m.store.GetVariantStats(batchID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ComparisonReport{
+		BatchID:  batchID,
+		Rows:     batch.TotalTasks / len(batch.Template.Variants),
+		Variants: make([]VariantReport, len(batch.Template.Variants)),
+	}
+	for i, v := range batch.Template.Variants {
+		r := VariantReport{
+			Name:       v.Name,
+			AgentID:    v.AgentID,
+			ProviderID: v.ProviderID,
+			Model:      v.ResolvedModel,
+		}
+		if r.Model == "" { // Not started yet
+			r.Model = m.resolveModel(v.AgentID, v.ProviderID, v.Model)
+		}
+		if s := stats[v.Name]; s != nil {
+			r.Tasks = s.TotalTasks
+			r.Completed = s.Completed
+			r.Failed = s.Failed
+			r.Dead = s.Dead
+			r.Pending = s.Pending + s.Running
+			r.CacheHits = s.CacheHits
+			if finished := s.Completed + s.Failed + s.Dead; finished > 0 {
+				r.SuccessRate = float64(s.Completed) / float64(finished)
+			}
+			r.AvgDurationMs = s.AvgDuration
+			r.InputTokens = s.InputTokens
+			r.CachedInputTokens = s.CachedInputTokens
+			r.OutputTokens = s.OutputTokens
+			r.EvalPassed = s.EvalPassed
+			r.EvalFailed = s.EvalFailed
+			if evaluated := s.EvalPassed + s.EvalFailed; evaluated > 0 {
+				r.EvalPassRate = float64(s.EvalPassed) / float64(evaluated)
+			}
+			r.AvgEvalScore = s.AvgEvalScore
+		}
+		r.CostUSD = variantCost(m.pricing, r.Model, r.InputTokens, r.CachedInputTokens, r.OutputTokens)
+		report.Variants[i] = r
+	}
+	return report, nil
+}
+
+// SideBySide returns the variants' results of an experiment batch grouped by input row.
+func (m *Manager) SideBySide(batchID string) ([]Variant, []ComparisonRow, error) {
+	batch, err := m.experiment(batchID)
+	if err != nil {
+		return nil, nil, err
+	}
+	variants := batch.Template.Variants
+	position := make(map[string]int, len(variants))
+	for i, v := range variants {
+		position[v.Name] = i
+	}
+
+	rows := make([]ComparisonRow, 0, batch.TotalTasks/len(variants))
+	for offset := 0; ; offset += comparisonPage {
+		tasks, _, err := m.store.ListTasks(batchID, &ListTaskFilter{Limit: comparisonPage, Offset: offset})
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, t := range tasks {
+			row := t.Index / len(variants)
+			if n := len(rows); n == 0 || rows[n-1].Row != row {
+				rows = append(rows, newComparisonRow(row, t.Input, variants))
+			}
+			if i, ok := position[t.Variant]; ok {
+				rows[len(rows)-1].Results[i] = VariantResult{
+					Variant:      t.Variant,
+					Status:       t.Status,
+					Result:       t.Result,
+					Error:        t.Error,
+					DurationMs:   t.DurationMs,
+					InputTokens:  t.InputTokens,
+					OutputTokens: t.OutputTokens,
+					Evaluation:   t.Evaluation,
+				}
+			}
+		}
+		if len(tasks) < comparisonPage {
+			break
+		}
+	}
+	return variants, rows, nil
+}
+
+func newComparisonRow(row int, input map[string]interface{}, variants []Variant) ComparisonRow {
+	results := make([]VariantResult, len(variants))
+	for i, v := range variants {
+		results[i] = VariantResult{Variant: v.Name}
+	}
+	return ComparisonRow{Row: row, Input: input, Results: results}
+}
+
+// variantCost returns the cost of a variant's usage, nil without a known price.
+func variantCost(pricing provider.Pricing, model string, input, cachedInput, output int64) *float64 {
+	price, ok := pricing.Lookup(model)
+	if !ok {
+		return nil
+	}
+	cost := price.Cost(input, cachedInput, output)
+	return &cost
+}
@@ -0,0 +1,86 @@
+package batch
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateVariants_Limits(t *testing.T) {
+	m := &Manager{}
+
+	req := &CreateBatchRequest{AgentID: "a", Variants: []Variant{{Name: "only"}}}
+	assert.ErrorContains(t, m.validateVariants(req), "between 2 and 10 variants")
+
+	req.Variants = make([]Variant, maxVariants+1)
+	assert.ErrorContains(t, m.validateVariants(req), "between 2 and 10 variants")
+
+	req.Variants = []Variant{{Name: "a"}, {Name: "b"}}
+	req.Adaptive = &AdaptiveConcurrency{}
+	assert.ErrorContains(t, m.validateVariants(req), "adaptive concurrency")
+
+	req.Adaptive = nil
+	req.Variants = []Variant{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	req.Concurrency = 2
+	assert.ErrorContains(t, m.validateVariants(req), "at least the number of variants")
+
+	// 非实验请求不做检查
+	assert.NoError(t, m.validateVariants(&CreateBatchRequest{AgentID: "a"}))
+}
+
+func TestVariantEnv(t *testing.T) {
+	m := &Manager{}
+	env, err := m.variantEnv(&Variant{Name: "v", AgentID: "a"})
+	require.NoError(t, err)
+	assert.Nil(t, env)
+
+	_, err = m.variantEnv(&Variant{Name: "v", ProviderID: "openai"})
+	assert.ErrorContains(t, err, "not available")
+
+	m.SetProviderEnvResolver(func(providerID string) (map[string]string, error) {
+		if providerID != "openai" {
+			return nil, errors.New("provider not found")
+		}
+		return map[string]string{"OPENAI_API_KEY": "sk-test"}, nil
+	})
+	env, err = m.variantEnv(&Variant{Name: "v", ProviderID: "openai"})
+	require.NoError(t, err)
+	assert.Equal(t, "sk-test", env["OPENAI_API_KEY"])
+
+	_, err = m.variantEnv(&Variant{Name: "v", ProviderID: "missing"})
+	assert.ErrorContains(t, err, "provider missing")
+}
+
+func TestWorkerVariant(t *testing.T) {
+	batch := &Batch{AgentID: "agent-a"}
+	w := &worker{}
+	assert.Equal(t, "agent-a", w.agentID(batch))
+	assert.Empty(t, w.model())
+
+	w.variant = &Variant{Name: "b", AgentID: "agent-b", Model: "gpt-4o"}
+	assert.Equal(t, "agent-b", w.agentID(batch))
+	assert.Equal(t, "gpt-4o", w.model())
+
+	// 启动时固定的模型优先
+	w.variant.ResolvedModel = "gpt-4o-2024-08-06"
+	assert.Equal(t, "gpt-4o-2024-08-06", w.model())
+}
+
+func TestQueueFor(t *testing.T) {
+	rb := &runningBatch{
+		taskQueue:     make(chan *BatchTask, 1),
+		variantQueues: map[string]chan *BatchTask{"a": make(chan *BatchTask, 1), "b": make(chan *BatchTask, 1)},
+	}
+	assert.Equal(t, rb.variantQueues["b"], rb.queueFor(&BatchTask{Variant: "b"}))
+	assert.Equal(t, rb.taskQueue, rb.queueFor(&BatchTask{}))
+}
+
+func TestNewComparisonRow(t *testing.T) {
+	row := newComparisonRow(3, map[string]interface{}{"q": "x"}, []Variant{{Name: "a"}, {Name: "b"}})
+	assert.Equal(t, 3, row.Row)
+	require.Len(t, row.Results, 2)
+	assert.Equal(t, "b", row.Results[1].Variant)
+	assert.Empty(t, row.Results[1].Status)
+}
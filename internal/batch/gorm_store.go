@@ -2,8 +2,13 @@ package batch
 
 import (
 	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
 
 	"github.com/tmalldedede/agentbox/internal/database"
+	"github.com/tmalldedede/agentbox/internal/labels"
+	"gorm.io/gorm"
 )
 
 // GormStore implements Store using GORM repositories.
@@ -27,7 +32,7 @@ func (s *GormStore) CreateBatch(batch *Batch) error {
 		return err
 	}
 	batch.ID = model.ID
-	return nil
+	return labels.Replace(database.DB, labels.ResourceBatch, batch.ID, batch.Labels)
 }
 
 // GetBatch retrieves a batch by ID.
@@ -50,13 +55,26 @@ func (s *GormStore) UpdateBatch(batch *Batch) error {
 
 // DeleteBatch deletes a batch and its tasks.
 func (s *GormStore) DeleteBatch(id string) error {
-	return s.batchRepo.Delete(id)
+	if err := s.batchRepo.Delete(id); err != nil {
+		return err
+	}
+	return labels.Delete(database.DB, labels.ResourceBatch, id)
+}
+
+// SetBatchLabels replaces the labels of a batch.
+func (s *GormStore) SetBatchLabels(id string, values map[string]string) error {
+	err := labels.Set(database.DB, &database.BatchModel{}, labels.ResourceBatch, id, values)
+	if err == gorm.ErrRecordNotFound {
+		return ErrBatchNotFound
+	}
+	return err
 }
 
 // ListBatches returns batches matching the filter.
 func (s *GormStore) ListBatches(filter *ListBatchFilter) ([]*Batch, int, error) {
 	var status, agentID, userID string
 	var limit, offset int
+	var scopes []func(*gorm.DB) *gorm.DB
 
 	if filter != nil {
 		status = string(filter.Status)
@@ -64,9 +82,14 @@ func (s *GormStore) ListBatches(filter *ListBatchFilter) ([]*Batch, int, error)
 		userID = filter.UserID
 		limit = filter.Limit
 		offset = filter.Offset
+		if !filter.Labels.Empty() {
+			scopes = append(scopes, func(db *gorm.DB) *gorm.DB {
+				return filter.Labels.Apply(db, labels.ResourceBatch, "id")
+			})
+		}
 	}
 
-	models, total, err := s.batchRepo.List(status, agentID, userID, limit, offset)
+	models, total, err := s.batchRepo.List(status, agentID, userID, limit, offset, scopes...)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -113,17 +136,18 @@ func (s *GormStore) UpdateTask(task *BatchTask) error {
 
 // ListTasks returns tasks for a batch.
 func (s *GormStore) ListTasks(batchID string, filter *ListTaskFilter) ([]*BatchTask, int, error) {
-	var status, workerID string
+	var status, workerID, variant string
 	var limit, offset int
 
 	if filter != nil {
 		status = string(filter.Status)
 		workerID = filter.WorkerID
+		variant = filter.Variant
 		limit = filter.Limit
 		offset = filter.Offset
 	}
 
-	models, total, err := s.taskRepo.List(batchID, status, workerID, limit, offset)
+	models, total, err := s.taskRepo.List(batchID, status, workerID, variant, limit, offset)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -141,10 +165,11 @@ func (s *GormStore) DeleteTasks(batchID string) error {
 	return s.taskRepo.DeleteByBatch(batchID)
 }
 
-// ClaimPendingTasks claims pending tasks for processing (SQLite-only mode).
-// When Redis is enabled, this falls back for tasks not in Redis queue.
-func (s *GormStore) ClaimPendingTasks(batchID string, limit int) ([]*BatchTask, error) {
-	models, err := s.taskRepo.ClaimPending(batchID, limit)
+// ClaimTasks claims pending tasks for processing. Each call claims under a token of its own,
+// so tasks claimed concurrently by another instance are never returned twice.
+func (s *GormStore) ClaimTasks(batchID, claimer string, limit int) ([]*BatchTask, error) {
+	token := claimer + "/" + uuid.New().String()[:8]
+	models, err := s.taskRepo.ClaimPending(batchID, token, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -156,14 +181,26 @@ func (s *GormStore) ClaimPendingTasks(batchID string, limit int) ([]*BatchTask,
 	return tasks, nil
 }
 
+// ExtendClaims refreshes the claim time of running tasks.
+func (s *GormStore) ExtendClaims(batchID string, taskIDs []string) error {
+	return s.taskRepo.ExtendClaims(batchID, taskIDs)
+}
+
+// RequeueStaleTasks puts running tasks claimed before the cutoff back to pending.
+func (s *GormStore) RequeueStaleTasks(batchID string, claimedBefore time.Time) (int, error) {
+	count, err := s.taskRepo.RequeueStale(batchID, claimedBefore)
+	return int(count), err
+}
+
 // RequeueTask puts a task back to pending.
 func (s *GormStore) RequeueTask(task *BatchTask) error {
 	return s.taskRepo.UpdateStatus(task.ID, string(BatchTaskPending), map[string]interface{}{
-		"worker_id":  "",
-		"started_at": nil,
-		"claimed_at": nil,
-		"claimed_by": "",
-		"attempts":   task.Attempts, // 保持重试计数
+		"worker_id":        "",
+		"started_at":       nil,
+		"claimed_at":       nil,
+		"claimed_by":       "",
+		"attempts":         task.Attempts, // 保持重试计数
+		"throttle_retries": task.ThrottleRetries,
 	})
 }
 
@@ -198,6 +235,11 @@ func (s *GormStore) ResetRunningTasks(batchID string) (int, error) {
 	return int(count), err
 }
 
+// TransitionBatch changes the status of a batch from `from` to `to` atomically.
+func (s *GormStore) TransitionBatch(id string, from, to BatchStatus) (bool, error) {
+	return s.batchRepo.UpdateStatusIf(id, string(from), string(to))
+}
+
 // ListRunningBatches returns batches with running status.
 func (s *GormStore) ListRunningBatches() ([]*Batch, error) {
 	models, err := s.batchRepo.ListByStatus(string(BatchStatusRunning))
@@ -240,6 +282,81 @@ func (s *GormStore) GetTaskStats(batchID string) (*BatchStats, error) {
 		}
 	}
 
+	input, cachedInput, output, err := s.taskRepo.GetUsage(batchID)
+	if err != nil {
+		return nil, err
+	}
+	stats.InputTokens = input
+	stats.CachedInputTokens = cachedInput
+	stats.OutputTokens = output
+	stats.TotalTokens = input + output
+
+	if stats.AvgDuration, err = s.taskRepo.GetAvgDuration(batchID); err != nil {
+		return nil, err
+	}
+	hits, err := s.taskRepo.CountCacheHits(batchID)
+	if err != nil {
+		return nil, err
+	}
+	stats.CacheHits = int(hits)
+
+	passed, failed, avgScore, err := s.taskRepo.GetEvalStats(batchID)
+	if err != nil {
+		return nil, err
+	}
+	stats.EvalPassed = int(passed)
+	stats.EvalFailed = int(failed)
+	stats.AvgEvalScore = avgScore
+
+	return stats, nil
+}
+
+// GetVariantStats returns task statistics per experiment variant.
+func (s *GormStore) GetVariantStats(batchID string) (map[string]*BatchStats, error) {
+	rows, err := s.taskRepo.GetVariantStats(batchID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]*BatchStats)
+	evalScores := make(map[string]float64)
+	for _, r := range rows {
+		vs := stats[r.Variant]
+		if vs == nil {
+			vs = &BatchStats{}
+			stats[r.Variant] = vs
+		}
+		vs.TotalTasks += int(r.Count)
+		switch BatchTaskStatus(r.Status) {
+		case BatchTaskPending:
+			vs.Pending = int(r.Count)
+		case BatchTaskRunning:
+			vs.Running = int(r.Count)
+		case BatchTaskCompleted:
+			vs.Completed = int(r.Count)
+			// Cache hits took no execution time
+			if executed := r.Count - r.CacheHits; executed > 0 {
+				vs.AvgDuration = float64(r.DurationMs-r.CacheHitDuration) / float64(executed)
+			}
+		case BatchTaskFailed:
+			vs.Failed = int(r.Count)
+		case BatchTaskDead:
+			vs.Dead = int(r.Count)
+		}
+		vs.InputTokens += r.InputTokens
+		vs.CachedInputTokens += r.CachedInputTokens
+		vs.OutputTokens += r.OutputTokens
+		vs.TotalTokens += r.InputTokens + r.OutputTokens
+		vs.EvalPassed += int(r.EvalPassed)
+		vs.EvalFailed += int(r.EvalFailed)
+		vs.CacheHits += int(r.CacheHits)
+		evalScores[r.Variant] += r.EvalScore
+	}
+	for variant, vs := range stats {
+		if evaluated := vs.EvalPassed + vs.EvalFailed; evaluated > 0 {
+			vs.AvgEvalScore = evalScores[variant] / float64(evaluated)
+		}
+	}
 	return stats, nil
 }
 
@@ -254,6 +371,7 @@ func (s *GormStore) batchToModel(b *Batch) *database.BatchModel {
 	templateJSON, _ := json.Marshal(b.Template)
 	workersJSON, _ := json.Marshal(b.Workers)
 	errorSummaryJSON, _ := json.Marshal(b.ErrorSummary)
+	labelsJSON, _ := json.Marshal(b.Labels)
 
 	return &database.BatchModel{
 		BaseModel: database.BaseModel{
@@ -265,6 +383,7 @@ func (s *GormStore) batchToModel(b *Batch) *database.BatchModel {
 		AgentID:          b.AgentID,
 		TemplateJSON:     string(templateJSON),
 		Concurrency:      b.Concurrency,
+		Priority:         b.Priority,
 		Status:           string(b.Status),
 		TotalTasks:       b.TotalTasks,
 		Completed:        b.Completed,
@@ -272,6 +391,8 @@ func (s *GormStore) batchToModel(b *Batch) *database.BatchModel {
 		Dead:             0, // Calculated from tasks
 		WorkersJSON:      string(workersJSON),
 		ErrorSummaryJSON: string(errorSummaryJSON),
+		LabelsJSON:       string(labelsJSON),
+		InstanceID:       b.InstanceID,
 		StartedAt:        b.StartedAt,
 		CompletedAt:      b.CompletedAt,
 	}
@@ -284,6 +405,7 @@ func (s *GormStore) modelToBatch(m *database.BatchModel) *Batch {
 		Name:        m.Name,
 		AgentID:     m.AgentID,
 		Concurrency: m.Concurrency,
+		Priority:    m.Priority,
 		Status:      BatchStatus(m.Status),
 		TotalTasks:  m.TotalTasks,
 		Completed:   m.Completed,
@@ -291,11 +413,15 @@ func (s *GormStore) modelToBatch(m *database.BatchModel) *Batch {
 		CreatedAt:   m.CreatedAt,
 		StartedAt:   m.StartedAt,
 		CompletedAt: m.CompletedAt,
+		InstanceID:  m.InstanceID,
 	}
 
 	json.Unmarshal([]byte(m.TemplateJSON), &b.Template)
 	json.Unmarshal([]byte(m.WorkersJSON), &b.Workers)
 	json.Unmarshal([]byte(m.ErrorSummaryJSON), &b.ErrorSummary)
+	if m.LabelsJSON != "" {
+		json.Unmarshal([]byte(m.LabelsJSON), &b.Labels)
+	}
 
 	// Calculate progress
 	if b.TotalTasks > 0 {
@@ -308,13 +434,14 @@ func (s *GormStore) modelToBatch(m *database.BatchModel) *Batch {
 func (s *GormStore) taskToModel(t *BatchTask) *database.BatchTaskModel {
 	inputJSON, _ := json.Marshal(t.Input)
 
-	return &database.BatchTaskModel{
+	model := &database.BatchTaskModel{
 		BaseModel: database.BaseModel{
 			ID:        t.ID,
 			CreatedAt: t.CreatedAt,
 		},
 		BatchID:    t.BatchID,
 		TaskIndex:  t.Index,
+		Variant:    t.Variant,
 		InputJSON:  string(inputJSON),
 		Prompt:     t.Prompt,
 		Status:     string(t.Status),
@@ -328,7 +455,24 @@ func (s *GormStore) taskToModel(t *BatchTask) *database.BatchTaskModel {
 		DeadReason: t.DeadReason,
 		StartedAt:  t.StartedAt,
 		DurationMs: t.DurationMs,
+
+		InputTokens:       t.InputTokens,
+		CachedInputTokens: t.CachedInputTokens,
+		OutputTokens:      t.OutputTokens,
+
+		CacheHit:        t.CacheHit,
+		ThrottleRetries: t.ThrottleRetries,
+	}
+	if t.Evaluation != nil {
+		evaluationJSON, _ := json.Marshal(t.Evaluation)
+		model.EvaluationJSON = string(evaluationJSON)
+		model.EvalScore = t.Evaluation.Score
+		model.EvalStatus = "failed"
+		if t.Evaluation.Passed {
+			model.EvalStatus = "passed"
+		}
 	}
+	return model
 }
 
 func (s *GormStore) modelToTask(m *database.BatchTaskModel) *BatchTask {
@@ -336,6 +480,7 @@ func (s *GormStore) modelToTask(m *database.BatchTaskModel) *BatchTask {
 		ID:         m.ID,
 		BatchID:    m.BatchID,
 		Index:      m.TaskIndex,
+		Variant:    m.Variant,
 		Prompt:     m.Prompt,
 		Status:     BatchTaskStatus(m.Status),
 		WorkerID:   m.WorkerID,
@@ -349,9 +494,19 @@ func (s *GormStore) modelToTask(m *database.BatchTaskModel) *BatchTask {
 		CreatedAt:  m.CreatedAt,
 		StartedAt:  m.StartedAt,
 		DurationMs: m.DurationMs,
+
+		InputTokens:       m.InputTokens,
+		CachedInputTokens: m.CachedInputTokens,
+		OutputTokens:      m.OutputTokens,
+
+		CacheHit:        m.CacheHit,
+		ThrottleRetries: m.ThrottleRetries,
 	}
 
 	json.Unmarshal([]byte(m.InputJSON), &t.Input)
+	if m.EvaluationJSON != "" {
+		json.Unmarshal([]byte(m.EvaluationJSON), &t.Evaluation)
+	}
 
 	return t
 }
@@ -0,0 +1,1023 @@
+package batch
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tmalldedede/agentbox/internal/logger"
+)
+
+// InputFormat is the file format of an input source.
+type InputFormat string
+
+const (
+	InputFormatCSV   InputFormat = "csv"
+	InputFormatJSONL InputFormat = "jsonl"
+	InputFormatXLSX  InputFormat = "xlsx"
+)
+
+// Input field types for type coercion.
+const (
+	FieldTypeString = "string"
+	FieldTypeInt    = "int"
+	FieldTypeFloat  = "float"
+	FieldTypeBool   = "bool"
+	FieldTypeJSON   = "json"
+)
+
+const (
+	maxImportRows     = 100000 // Maximum data rows per file
+	maxImportErrors   = 100    // Row errors reported back (the rest are only counted)
+	importChunkSize   = 500    // Rows written per CreateTasks call
+	maxJSONLLineBytes = 10 << 20
+)
+
+// FileResolver returns the local path and original name of an uploaded file.
+type FileResolver func(fileID string) (path, name string, err error)
+
+// InputSource describes batch inputs read from an uploaded file (POST /files).
+type InputSource struct {
+	FileID      string            `json:"file_id"`                // Uploaded file ID
+	Format      InputFormat       `json:"format,omitempty"`       // csv, jsonl or xlsx (default: from the file extension)
+	Sheet       string            `json:"sheet,omitempty"`        // XLSX sheet name (default: first sheet)
+	Delimiter   string            `json:"delimiter,omitempty"`    // CSV delimiter (default: ",")
+	Columns     map[string]string `json:"columns,omitempty"`      // Source column -> input field (default: every column under its own name)
+	Types       map[string]string `json:"types,omitempty"`        // Input field -> string, int, float, bool or json (default: as parsed)
+	SkipInvalid bool              `json:"skip_invalid,omitempty"` // Import valid rows and skip invalid ones instead of rejecting the file
+}
+
+// RowError is a parse or validation error of a single source row.
+type RowError struct {
+	Row     int    `json:"row"`              // 1-based line (CSV/JSONL) or sheet row (XLSX)
+	Column  string `json:"column,omitempty"` // Source column, if known
+	Message string `json:"error"`
+}
+
+func (e *RowError) Error() string {
+	if e.Column != "" {
+		return fmt.Sprintf("row %d, column %s: %s", e.Row, e.Column, e.Message)
+	}
+	return fmt.Sprintf("row %d: %s", e.Row, e.Message)
+}
+
+// ImportResult summarizes an import from an input source.
+type ImportResult struct {
+	FileID   string      `json:"file_id"`
+	Format   InputFormat `json:"format"`
+	Rows     int         `json:"rows"`             // Data rows read (blank rows are ignored)
+	Imported int         `json:"imported"`         // Rows turned into tasks
+	Skipped  int         `json:"skipped"`          // Invalid rows
+	Errors   []RowError  `json:"errors,omitempty"` // First row errors (at most 100)
+}
+
+func (r *ImportResult) addError(e RowError) {
+	r.Skipped++
+	if len(r.Errors) < maxImportErrors {
+		r.Errors = append(r.Errors, e)
+	}
+}
+
+// ImportError is returned when a source contains invalid rows and SkipInvalid is not set.
+// No tasks are created in that case.
+type ImportError struct {
+	Result *ImportResult
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("%d invalid rows in input file %s, first at %s", e.Result.Skipped, e.Result.FileID, e.Result.Errors[0].Error())
+}
+
+// DetectInputFormat infers the input format from a file name.
+func DetectInputFormat(name string) (InputFormat, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv", ".tsv":
+		return InputFormatCSV, nil
+	case ".jsonl", ".ndjson":
+		return InputFormatJSONL, nil
+	case ".xlsx":
+		return InputFormatXLSX, nil
+	}
+	return "", fmt.Errorf("cannot detect input format of %q, set format to csv, jsonl or xlsx", name)
+}
+
+// rowReader streams raw records from a source file. next returns io.EOF at the end
+// and a *RowError for rows that cannot be parsed; other errors abort the import.
+type rowReader interface {
+	header() []string // Column names, nil for JSONL
+	next() (row int, record map[string]interface{}, err error)
+	Close() error
+}
+
+// openRows opens a streaming row reader for the source file.
+func openRows(filePath string, format InputFormat, src *InputSource) (rowReader, error) {
+	switch format {
+	case InputFormatCSV:
+		return openCSV(filePath, src.Delimiter)
+	case InputFormatJSONL:
+		return openJSONL(filePath)
+	case InputFormatXLSX:
+		return openXLSX(filePath, src.Sheet)
+	}
+	return nil, fmt.Errorf("unsupported input format: %s", format)
+}
+
+// inputMapper turns raw records into task inputs (column mapping and type coercion).
+type inputMapper struct {
+	columns map[string]string
+	types   map[string]string
+}
+
+func newInputMapper(src *InputSource, header []string) (*inputMapper, error) {
+	for field, typ := range src.Types {
+		switch typ {
+		case FieldTypeString, FieldTypeInt, FieldTypeFloat, FieldTypeBool, FieldTypeJSON:
+		default:
+			return nil, fmt.Errorf("invalid type %q for field %s", typ, field)
+		}
+	}
+	seen := make(map[string]string, len(src.Columns))
+	for column, field := range src.Columns {
+		if field == "" {
+			return nil, fmt.Errorf("column %s is mapped to an empty field", column)
+		}
+		if other, ok := seen[field]; ok {
+			return nil, fmt.Errorf("columns %s and %s are both mapped to field %s", other, column, field)
+		}
+		seen[field] = column
+	}
+	if header != nil {
+		known := make(map[string]bool, len(header))
+		for _, name := range header {
+			known[name] = true
+		}
+		for column := range src.Columns {
+			if !known[column] {
+				return nil, fmt.Errorf("column %s not found in header", column)
+			}
+		}
+	}
+	return &inputMapper{columns: src.Columns, types: src.Types}, nil
+}
+
+// apply maps and coerces a record. Empty values of non-string fields are omitted
+// so that template defaults apply.
+func (m *inputMapper) apply(row int, record map[string]interface{}) (map[string]interface{}, *RowError) {
+	columns := make([]string, 0, len(record))
+	for column := range record {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns) // report the same column first on every run
+
+	input := make(map[string]interface{}, len(record))
+	for _, column := range columns {
+		value := record[column]
+		field := column
+		if len(m.columns) > 0 {
+			var ok bool
+			if field, ok = m.columns[column]; !ok {
+				continue
+			}
+		}
+		typ, ok := m.types[field]
+		if !ok {
+			input[field] = value
+			continue
+		}
+		if s, isString := value.(string); isString && s == "" && typ != FieldTypeString {
+			continue
+		}
+		v, err := coerceValue(value, typ)
+		if err != nil {
+			return nil, &RowError{Row: row, Column: column, Message: err.Error()}
+		}
+		input[field] = v
+	}
+	if len(input) == 0 {
+		return nil, &RowError{Row: row, Message: "row has no mapped values"}
+	}
+	return input, nil
+}
+
+// coerceValue converts a parsed value (string from CSV/XLSX, JSON value from JSONL) to typ.
+func coerceValue(value interface{}, typ string) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	s, isString := value.(string)
+	switch typ {
+	case FieldTypeString:
+		if isString {
+			return s, nil
+		}
+		if f, ok := value.(float64); ok {
+			return strconv.FormatFloat(f, 'f', -1, 64), nil
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	case FieldTypeInt:
+		if isString {
+			n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid int %q", s)
+			}
+			return n, nil
+		}
+		if f, ok := value.(float64); ok && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			return int64(f), nil
+		}
+		return nil, fmt.Errorf("invalid int %v", value)
+	case FieldTypeFloat:
+		if isString {
+			f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid float %q", s)
+			}
+			return f, nil
+		}
+		if f, ok := value.(float64); ok {
+			return f, nil
+		}
+		return nil, fmt.Errorf("invalid float %v", value)
+	case FieldTypeBool:
+		if isString {
+			switch strings.ToLower(strings.TrimSpace(s)) {
+			case "true", "1", "yes", "y":
+				return true, nil
+			case "false", "0", "no", "n":
+				return false, nil
+			}
+			return nil, fmt.Errorf("invalid bool %q", s)
+		}
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+		return nil, fmt.Errorf("invalid bool %v", value)
+	case FieldTypeJSON:
+		if !isString {
+			return value, nil
+		}
+		var v interface{}
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			return nil, fmt.Errorf("invalid json: %v", err)
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("unknown type %s", typ)
+}
+
+// AppendInputs adds tasks to a pending or paused batch. Inline inputs of template
+// batches are bound against the template like on creation.
+func (m *Manager) AppendInputs(batchID string, req *AppendInputsRequest) (*Batch, error) {
+	if (req.Source == nil) == (len(req.Inputs) == 0) {
+		return nil, fmt.Errorf("exactly one of inputs and source is required")
+	}
+
+	m.mu.Lock()
+	if _, ok := m.running[batchID]; ok {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("batch %s is running, pause it before appending inputs", batchID)
+	}
+	if m.importing[batchID] {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("batch %s is already importing inputs", batchID)
+	}
+	m.importing[batchID] = true
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.importing, batchID)
+		m.mu.Unlock()
+	}()
+
+	b, err := m.store.GetBatch(batchID)
+	if err != nil {
+		return nil, err
+	}
+	if b.Status != BatchStatusPending && b.Status != BatchStatusPaused {
+		return nil, fmt.Errorf("batch status is %s, inputs can only be appended to pending or paused batches", b.Status)
+	}
+
+	total := b.TotalTasks
+	if req.Source != nil {
+		b.Import, err = m.importInputs(b, req.Source)
+	} else {
+		inputs := req.Inputs
+		if b.Template.TemplateID != "" {
+			if m.templates == nil {
+				return nil, fmt.Errorf("task templates are not available")
+			}
+			tpl, resolveErr := m.templates.ResolveTemplate(b.Template.TemplateID, inputs)
+			if resolveErr != nil {
+				return nil, resolveErr
+			}
+			inputs = tpl.Inputs
+		}
+		err = m.addTasks(b, inputs)
+	}
+
+	// Record the tasks that were written even if the import stopped halfway
+	if b.TotalTasks != total {
+		if updateErr := m.store.UpdateBatch(b); updateErr != nil {
+			return nil, fmt.Errorf("failed to update batch: %w", updateErr)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Appended batch inputs", "batch_id", batchID, "tasks", b.TotalTasks-total, "total", b.TotalTasks)
+	return b, nil
+}
+
+// importInputs creates the batch's tasks from a file source. Unless SkipInvalid is set
+// the file is validated in a first pass so that no task is created for a file with
+// invalid rows.
+func (m *Manager) importInputs(b *Batch, src *InputSource) (*ImportResult, error) {
+	if !src.SkipInvalid {
+		result, err := m.readInputs(src, b.Template.TemplateID, func([]map[string]interface{}) error { return nil })
+		if err != nil {
+			return nil, err
+		}
+		if result.Skipped > 0 {
+			return result, &ImportError{Result: result}
+		}
+	}
+
+	result, err := m.readInputs(src, b.Template.TemplateID, func(inputs []map[string]interface{}) error {
+		return m.addTasks(b, inputs)
+	})
+	if err != nil {
+		return result, err
+	}
+	if result.Imported == 0 {
+		if result.Skipped > 0 {
+			return result, &ImportError{Result: result}
+		}
+		return result, fmt.Errorf("input file %s has no rows", src.FileID)
+	}
+	return result, nil
+}
+
+// readInputs streams the source, maps each row and passes valid rows to emit in chunks.
+// Template batches bind every chunk against the template parameters; rows failing
+// the binding are reported as row errors.
+func (m *Manager) readInputs(src *InputSource, templateID string, emit func(inputs []map[string]interface{}) error) (*ImportResult, error) {
+	if m.files == nil {
+		return nil, fmt.Errorf("file inputs are not available")
+	}
+	if src.FileID == "" {
+		return nil, fmt.Errorf("source.file_id is required")
+	}
+	filePath, name, err := m.files(src.FileID)
+	if err != nil {
+		return nil, fmt.Errorf("input file %s: %w", src.FileID, err)
+	}
+	format := src.Format
+	if format == "" {
+		if format, err = DetectInputFormat(name); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := openRows(filePath, format, src)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mapper, err := newInputMapper(src, rows.header())
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{FileID: src.FileID, Format: format}
+	chunkRows := make([]int, 0, importChunkSize)
+	chunk := make([]map[string]interface{}, 0, importChunkSize)
+
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		inputs, err := m.bindInputs(templateID, chunkRows, chunk, result)
+		if err != nil {
+			return err
+		}
+		if len(inputs) > 0 {
+			if err := emit(inputs); err != nil {
+				return err
+			}
+			result.Imported += len(inputs)
+		}
+		chunkRows, chunk = chunkRows[:0], chunk[:0]
+		return nil
+	}
+
+	for {
+		row, record, err := rows.next()
+		if err == io.EOF {
+			break
+		}
+		var rowErr *RowError
+		if errors.As(err, &rowErr) {
+			result.Rows++
+			result.addError(*rowErr)
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		if result.Rows++; result.Rows > maxImportRows {
+			return result, fmt.Errorf("input file has more than %d rows", maxImportRows)
+		}
+
+		input, rowErr := mapper.apply(row, record)
+		if rowErr != nil {
+			result.addError(*rowErr)
+			continue
+		}
+		chunkRows = append(chunkRows, row)
+		chunk = append(chunk, input)
+		if len(chunk) == importChunkSize {
+			if err := flush(); err != nil {
+				return result, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// bindInputs validates a chunk against the task template (no-op without a template).
+// On failure rows are bound one by one to find the invalid ones.
+func (m *Manager) bindInputs(templateID string, rows []int, inputs []map[string]interface{}, result *ImportResult) ([]map[string]interface{}, error) {
+	if templateID == "" {
+		return append([]map[string]interface{}(nil), inputs...), nil
+	}
+	if m.templates == nil {
+		return nil, fmt.Errorf("task templates are not available")
+	}
+	if tpl, err := m.templates.ResolveTemplate(templateID, inputs); err == nil {
+		return tpl.Inputs, nil
+	}
+
+	bound := make([]map[string]interface{}, 0, len(inputs))
+	for i, input := range inputs {
+		tpl, err := m.templates.ResolveTemplate(templateID, []map[string]interface{}{input})
+		if err != nil {
+			result.addError(RowError{Row: rows[i], Message: strings.TrimPrefix(err.Error(), "inputs[0]: ")})
+			continue
+		}
+		bound = append(bound, tpl.Inputs[0])
+	}
+	return bound, nil
+}
+
+// --- CSV ---
+
+type csvRows struct {
+	f       *os.File
+	r       *csv.Reader
+	columns []string
+}
+
+func openCSV(filePath, delimiter string) (*csvRows, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	r := csv.NewReader(bufio.NewReader(f))
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+	switch {
+	case delimiter == "" && strings.EqualFold(filepath.Ext(filePath), ".tsv"):
+		r.Comma = '\t'
+	case delimiter == `\t`:
+		r.Comma = '\t'
+	case delimiter != "":
+		runes := []rune(delimiter)
+		if len(runes) != 1 {
+			f.Close()
+			return nil, fmt.Errorf("invalid csv delimiter %q", delimiter)
+		}
+		r.Comma = runes[0]
+	}
+
+	header, err := r.Read()
+	if err == io.EOF {
+		f.Close()
+		return nil, fmt.Errorf("csv file is empty")
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("invalid csv header: %w", err)
+	}
+	columns, err := headerColumns(header)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &csvRows{f: f, r: r, columns: columns}, nil
+}
+
+func (c *csvRows) header() []string { return nonEmpty(c.columns) }
+
+func (c *csvRows) next() (int, map[string]interface{}, error) {
+	for {
+		record, err := c.r.Read()
+		if err == io.EOF {
+			return 0, nil, io.EOF
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return parseErr.StartLine, nil, &RowError{Row: parseErr.StartLine, Message: parseErr.Err.Error()}
+			}
+			return 0, nil, err
+		}
+		if blank(record) {
+			continue
+		}
+		line, _ := c.r.FieldPos(0)
+		if len(record) > len(c.columns) {
+			return line, nil, &RowError{Row: line, Message: fmt.Sprintf("row has %d fields, header has %d", len(record), len(c.columns))}
+		}
+		return line, buildRecord(c.columns, record), nil
+	}
+}
+
+func (c *csvRows) Close() error { return c.f.Close() }
+
+// --- JSONL ---
+
+type jsonlRows struct {
+	f    *os.File
+	r    *bufio.Reader
+	line int
+}
+
+func openJSONL(filePath string) (*jsonlRows, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonlRows{f: f, r: bufio.NewReaderSize(f, 64<<10)}, nil
+}
+
+func (j *jsonlRows) header() []string { return nil }
+
+func (j *jsonlRows) next() (int, map[string]interface{}, error) {
+	for {
+		data, err := j.readLine()
+		if err != nil {
+			return 0, nil, err
+		}
+		j.line++
+		data = bytes.TrimSpace(data)
+		if j.line == 1 {
+			data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+		}
+		if len(data) == 0 {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal(data, &record); err != nil {
+			return j.line, nil, &RowError{Row: j.line, Message: "invalid json object: " + err.Error()}
+		}
+		if record == nil {
+			return j.line, nil, &RowError{Row: j.line, Message: "line is not a json object"}
+		}
+		return j.line, record, nil
+	}
+}
+
+// readLine reads a full line of at most maxJSONLLineBytes.
+func (j *jsonlRows) readLine() ([]byte, error) {
+	var line []byte
+	for {
+		part, err := j.r.ReadSlice('\n')
+		line = append(line, part...)
+		if len(line) > maxJSONLLineBytes {
+			return nil, fmt.Errorf("line %d exceeds %d bytes", j.line+1, maxJSONLLineBytes)
+		}
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && len(line) > 0:
+			return line, nil
+		default:
+			return line, err
+		}
+	}
+}
+
+func (j *jsonlRows) Close() error { return j.f.Close() }
+
+// --- XLSX (Office Open XML, read with the standard library) ---
+
+type xlsxRows struct {
+	zr      *zip.ReadCloser
+	sheet   io.ReadCloser
+	dec     *xml.Decoder
+	shared  []string
+	columns []string
+	row     int
+}
+
+// xlsxCell is a <c> element of a worksheet row.
+type xlsxCell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Value  string `xml:"v"`
+	Inline struct {
+		Text string `xml:"t"`
+		Runs []struct {
+			Text string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"is"`
+}
+
+type xlsxRow struct {
+	Num   int        `xml:"r,attr"`
+	Cells []xlsxCell `xml:"c"`
+}
+
+func openXLSX(filePath, sheetName string) (*xlsxRows, error) {
+	zr, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid xlsx file: %w", err)
+	}
+	x := &xlsxRows{zr: zr}
+
+	sheetPath, err := x.sheetPath(sheetName)
+	if err != nil {
+		zr.Close()
+		return nil, err
+	}
+	if x.shared, err = x.sharedStrings(); err != nil {
+		zr.Close()
+		return nil, err
+	}
+	f := x.file(sheetPath)
+	if f == nil {
+		zr.Close()
+		return nil, fmt.Errorf("invalid xlsx file: missing %s", sheetPath)
+	}
+	if x.sheet, err = f.Open(); err != nil {
+		zr.Close()
+		return nil, err
+	}
+	x.dec = xml.NewDecoder(x.sheet)
+
+	for {
+		num, values, err := x.readRow()
+		if err == io.EOF {
+			x.Close()
+			return nil, fmt.Errorf("xlsx sheet is empty")
+		}
+		if err != nil {
+			x.Close()
+			return nil, err
+		}
+		if blank(values) {
+			continue
+		}
+		if x.columns, err = headerColumns(values); err != nil {
+			x.Close()
+			return nil, fmt.Errorf("row %d: %w", num, err)
+		}
+		return x, nil
+	}
+}
+
+func (x *xlsxRows) header() []string { return nonEmpty(x.columns) }
+
+func (x *xlsxRows) next() (int, map[string]interface{}, error) {
+	for {
+		num, values, err := x.readRow()
+		if err != nil {
+			return 0, nil, err
+		}
+		if blank(values) {
+			continue
+		}
+		for i := len(x.columns); i < len(values); i++ {
+			if values[i] != "" {
+				return num, nil, &RowError{Row: num, Column: columnName(i), Message: "value outside the header columns"}
+			}
+		}
+		return num, buildRecord(x.columns, values), nil
+	}
+}
+
+func (x *xlsxRows) Close() error {
+	if x.sheet != nil {
+		x.sheet.Close()
+	}
+	return x.zr.Close()
+}
+
+func (x *xlsxRows) file(name string) *zip.File {
+	for _, f := range x.zr.File {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func (x *xlsxRows) decodeFile(name string, v interface{}) error {
+	f := x.file(name)
+	if f == nil {
+		return fmt.Errorf("invalid xlsx file: missing %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("invalid xlsx file: %s: %w", name, err)
+	}
+	return nil
+}
+
+// sheetPath resolves the worksheet part of a sheet (first sheet if name is empty).
+func (x *xlsxRows) sheetPath(name string) (string, error) {
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := x.decodeFile("xl/workbook.xml", &workbook); err != nil {
+		return "", err
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", fmt.Errorf("xlsx file has no sheets")
+	}
+
+	rid := workbook.Sheets[0].RID
+	if name != "" {
+		rid = ""
+		for _, s := range workbook.Sheets {
+			if s.Name == name {
+				rid = s.RID
+				break
+			}
+		}
+		if rid == "" {
+			return "", fmt.Errorf("sheet %q not found", name)
+		}
+	}
+
+	var rels struct {
+		Items []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := x.decodeFile("xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return "", err
+	}
+	for _, rel := range rels.Items {
+		if rel.ID == rid {
+			if strings.HasPrefix(rel.Target, "/") {
+				return strings.TrimPrefix(rel.Target, "/"), nil
+			}
+			return path.Join("xl", rel.Target), nil
+		}
+	}
+	return "", fmt.Errorf("invalid xlsx file: sheet relationship %s not found", rid)
+}
+
+// sharedStrings reads the shared string table (rich text runs are concatenated,
+// phonetic hints skipped).
+func (x *xlsxRows) sharedStrings() ([]string, error) {
+	f := x.file("xl/sharedStrings.xml")
+	if f == nil {
+		return nil, nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var (
+		strs    []string
+		current strings.Builder
+		inText  bool
+		inPhon  bool
+	)
+	dec := xml.NewDecoder(rc)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return strs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid xlsx file: shared strings: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				current.Reset()
+			case "t":
+				inText = !inPhon
+			case "rPh":
+				inPhon = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				strs = append(strs, current.String())
+			case "t":
+				inText = false
+			case "rPh":
+				inPhon = false
+			}
+		case xml.CharData:
+			if inText {
+				current.Write(t)
+			}
+		}
+	}
+}
+
+// readRow decodes the next <row> element into cell values by column index.
+func (x *xlsxRows) readRow() (int, []string, error) {
+	for {
+		tok, err := x.dec.Token()
+		if err != nil {
+			if err != io.EOF {
+				err = fmt.Errorf("invalid xlsx sheet: %w", err)
+			}
+			return 0, nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+
+		var row xlsxRow
+		if err := x.dec.DecodeElement(&row, &start); err != nil {
+			return 0, nil, fmt.Errorf("invalid xlsx sheet: %w", err)
+		}
+		x.row++
+		if row.Num > 0 {
+			x.row = row.Num
+		}
+
+		var values []string
+		for i, cell := range row.Cells {
+			col := i
+			if cell.Ref != "" {
+				if col = columnIndex(cell.Ref); col < 0 {
+					return x.row, nil, fmt.Errorf("invalid xlsx cell reference %q", cell.Ref)
+				}
+			}
+			for len(values) <= col {
+				values = append(values, "")
+			}
+			values[col] = x.cellValue(cell)
+		}
+		return x.row, values, nil
+	}
+}
+
+func (x *xlsxRows) cellValue(c xlsxCell) string {
+	switch c.Type {
+	case "s":
+		i, err := strconv.Atoi(strings.TrimSpace(c.Value))
+		if err != nil || i < 0 || i >= len(x.shared) {
+			return ""
+		}
+		return x.shared[i]
+	case "inlineStr":
+		if len(c.Inline.Runs) == 0 {
+			return c.Inline.Text
+		}
+		var sb strings.Builder
+		for _, r := range c.Inline.Runs {
+			sb.WriteString(r.Text)
+		}
+		return sb.String()
+	case "b":
+		if c.Value == "1" {
+			return "true"
+		}
+		return "false"
+	case "", "n":
+		// Normalize float artifacts such as 0.30000000000000004
+		if f, err := strconv.ParseFloat(c.Value, 64); err == nil {
+			return strconv.FormatFloat(f, 'f', -1, 64)
+		}
+	}
+	return c.Value
+}
+
+// columnIndex converts a cell reference such as "AB12" to a 0-based column index.
+func columnIndex(ref string) int {
+	col := 0
+	n := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A') + 1
+		n++
+	}
+	if n == 0 {
+		return -1
+	}
+	return col - 1
+}
+
+// columnName converts a 0-based column index to its letter name ("A", "AB").
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// --- helpers ---
+
+// headerColumns validates a header row; empty names mark ignored columns.
+func headerColumns(header []string) ([]string, error) {
+	columns := make([]string, len(header))
+	seen := make(map[string]bool, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		if name == "" {
+			continue
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate column %q in header", name)
+		}
+		seen[name] = true
+		columns[i] = name
+	}
+	if len(seen) == 0 {
+		return nil, fmt.Errorf("header row has no column names")
+	}
+	return columns, nil
+}
+
+func buildRecord(columns, values []string) map[string]interface{} {
+	record := make(map[string]interface{}, len(columns))
+	for i, name := range columns {
+		if name == "" {
+			continue
+		}
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		record[name] = value
+	}
+	return record
+}
+
+func nonEmpty(columns []string) []string {
+	out := make([]string, 0, len(columns))
+	for _, c := range columns {
+		if c != "" {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func blank(values []string) bool {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
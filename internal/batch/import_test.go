@@ -0,0 +1,174 @@
+package batch
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newImportManager returns a manager that resolves file IDs to paths under dir.
+func newImportManager(dir string) *Manager {
+	return &Manager{files: func(fileID string) (string, string, error) {
+		p := filepath.Join(dir, fileID)
+		if _, err := os.Stat(p); err != nil {
+			return "", "", err
+		}
+		return p, fileID, nil
+	}}
+}
+
+func readAll(t *testing.T, m *Manager, src *InputSource) ([]map[string]interface{}, *ImportResult, error) {
+	t.Helper()
+	var inputs []map[string]interface{}
+	result, err := m.readInputs(src, "", func(chunk []map[string]interface{}) error {
+		inputs = append(inputs, chunk...)
+		return nil
+	})
+	return inputs, result, err
+}
+
+func TestReadInputs_CSV(t *testing.T) {
+	dir := t.TempDir()
+	content := "\ufeffid,text,score,ignored\n" +
+		"1,hello,0.5,x\n" +
+		"\n" +
+		"two,\"multi\nline\",1,x\n" +
+		"3,world,,x\n" +
+		"4,extra,1,x,y\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "rows.csv"), []byte(content), 0o644))
+	m := newImportManager(dir)
+
+	src := &InputSource{
+		FileID:      "rows.csv",
+		Columns:     map[string]string{"id": "id", "text": "data", "score": "score"},
+		Types:       map[string]string{"id": FieldTypeInt, "score": FieldTypeFloat},
+		SkipInvalid: true,
+	}
+	inputs, result, err := readAll(t, m, src)
+	require.NoError(t, err)
+
+	assert.Equal(t, InputFormatCSV, result.Format)
+	assert.Equal(t, 4, result.Rows)
+	assert.Equal(t, 2, result.Imported)
+	assert.Equal(t, 2, result.Skipped)
+	assert.Equal(t, []RowError{
+		{Row: 4, Column: "id", Message: `invalid int "two"`},
+		{Row: 7, Message: "row has 5 fields, header has 4"},
+	}, result.Errors)
+	assert.Equal(t, []map[string]interface{}{
+		{"id": int64(1), "data": "hello", "score": 0.5},
+		{"id": int64(3), "data": "world"}, // empty typed value omitted
+	}, inputs)
+
+	// 映射不存在的列
+	src.Columns = map[string]string{"missing": "x"}
+	_, _, err = readAll(t, m, src)
+	assert.ErrorContains(t, err, "column missing not found in header")
+}
+
+func TestReadInputs_JSONL(t *testing.T) {
+	dir := t.TempDir()
+	content := `{"q": "a", "n": 1, "meta": {"k": "v"}}` + "\n" +
+		`[1, 2]` + "\n" +
+		`{"q": "b", "n": 2.5}` + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "rows.jsonl"), []byte(content), 0o644))
+	m := newImportManager(dir)
+
+	inputs, result, err := readAll(t, m, &InputSource{
+		FileID:      "rows.jsonl",
+		Types:       map[string]string{"n": FieldTypeInt, "meta": FieldTypeString},
+		SkipInvalid: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Rows)
+	assert.Equal(t, 1, result.Imported)
+	require.Len(t, result.Errors, 2)
+	assert.Equal(t, 2, result.Errors[0].Row)
+	assert.Equal(t, RowError{Row: 3, Column: "n", Message: "invalid int 2.5"}, result.Errors[1])
+	assert.Equal(t, []map[string]interface{}{{"q": "a", "n": int64(1), "meta": `{"k":"v"}`}}, inputs)
+}
+
+func TestReadInputs_XLSX(t *testing.T) {
+	dir := t.TempDir()
+	writeXLSX(t, filepath.Join(dir, "rows.xlsx"), map[string]string{
+		"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Notes" sheetId="1" r:id="rId1"/><sheet name="Data" sheetId="2" r:id="rId2"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="worksheet" Target="/xl/worksheets/sheet2.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<si><t>name</t></si><si><t>count</t></si><si><r><t>Hello </t></r><r><t>World</t></r><rPh><t>x</t></rPh></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData><row r="1"><c r="A1" t="inlineStr"><is><t>ignored</t></is></c></row></sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="inlineStr"><is><t>ok</t></is></c></row>
+<row r="2"><c r="A2" t="s"><v>2</v></c><c r="B2"><v>42</v></c><c r="C2" t="b"><v>1</v></c></row>
+<row r="4"><c r="A4" t="inlineStr"><is><t>sparse</t></is></c><c r="C4" t="b"><v>0</v></c></row>
+<row r="5"><c r="B5"><v>0.30000000000000004</v></c><c r="E5"><v>1</v></c></row>
+</sheetData></worksheet>`,
+	})
+	m := newImportManager(dir)
+
+	inputs, result, err := readAll(t, m, &InputSource{
+		FileID:      "rows.xlsx",
+		Sheet:       "Data",
+		Types:       map[string]string{"count": FieldTypeInt, "ok": FieldTypeBool},
+		SkipInvalid: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, InputFormatXLSX, result.Format)
+	assert.Equal(t, []RowError{{Row: 5, Column: "E", Message: "value outside the header columns"}}, result.Errors)
+	assert.Equal(t, []map[string]interface{}{
+		{"name": "Hello World", "count": int64(42), "ok": true},
+		{"name": "sparse", "ok": false},
+	}, inputs)
+
+	_, _, err = readAll(t, m, &InputSource{FileID: "rows.xlsx", Sheet: "Missing"})
+	assert.ErrorContains(t, err, `sheet "Missing" not found`)
+}
+
+func TestImportInputs_RejectsInvalidRows(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "rows.csv"), []byte("n\n1\nx\n"), 0o644))
+	m := newImportManager(dir)
+
+	// 未设置 skip_invalid 时先校验整个文件，存在无效行则不写入任何任务（store 未设置，写入会 panic）
+	b := &Batch{ID: "batch-1"}
+	result, err := m.importInputs(b, &InputSource{FileID: "rows.csv", Types: map[string]string{"n": FieldTypeInt}})
+	var importErr *ImportError
+	require.ErrorAs(t, err, &importErr)
+	assert.Same(t, result, importErr.Result)
+	assert.Equal(t, 1, result.Skipped)
+	assert.Zero(t, b.TotalTasks)
+	assert.Contains(t, err.Error(), "row 3, column n")
+}
+
+func TestColumnIndex(t *testing.T) {
+	for ref, want := range map[string]int{"A1": 0, "Z9": 25, "AA10": 26, "AB2": 27} {
+		assert.Equal(t, want, columnIndex(ref), ref)
+		assert.Equal(t, strings.TrimRight(ref, "0123456789"), columnName(want), ref)
+	}
+}
+
+func writeXLSX(t *testing.T, path string, parts map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+}
@@ -0,0 +1,285 @@
+package batch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tmalldedede/agentbox/internal/logger"
+	"github.com/tmalldedede/agentbox/internal/session"
+)
+
+// resetCommand empties the workspace and removes the conversation history the engines
+// keep in the home directory, so that nothing carries over to the next task.
+const resetCommand = "find /workspace -mindepth 1 -delete; " +
+	"rm -rf ~/.claude/projects ~/.claude/todos ~/.codex/sessions ~/.local/share/opencode/storage"
+
+// stagedInputDir is the workspace directory that per-row input files are copied to.
+const stagedInputDir = "inputs"
+
+// spareSession is a session started ahead of time for a fresh_session worker.
+type spareSession struct {
+	id        string
+	workspace string
+	err       error
+}
+
+// validateIsolation checks the isolation settings of a batch.
+func (m *Manager) validateIsolation(tpl *BatchTemplate) error {
+	switch tpl.Isolation {
+	case "", IsolationShared, IsolationResetWorkspace, IsolationFreshSession:
+	default:
+		return fmt.Errorf("invalid isolation %q (expected shared, reset_workspace or fresh_session)", tpl.Isolation)
+	}
+	if len(tpl.FileFields) == 0 {
+		return nil
+	}
+	if !tpl.isolated() {
+		return fmt.Errorf("file_fields require isolation reset_workspace or fresh_session")
+	}
+	if m.files == nil {
+		return fmt.Errorf("file inputs are not available")
+	}
+	return nil
+}
+
+// isolated reports whether every worker (or task) gets a workspace of its own.
+func (t *BatchTemplate) isolated() bool {
+	return t.Isolation == IsolationResetWorkspace || t.Isolation == IsolationFreshSession
+}
+
+// workerWorkspace returns the workspace of a worker's n-th session, relative to the
+// session workspace base. Shared workers keep the default workspace.
+func workerWorkspace(batch *Batch, workerID string, n int) string {
+	switch batch.Template.Isolation {
+	case IsolationResetWorkspace:
+		return filepath.Join("batches", batch.ID, workerID)
+	case IsolationFreshSession:
+		return filepath.Join("batches", batch.ID, fmt.Sprintf("%s-%d", workerID, n))
+	}
+	return ""
+}
+
+// startSession creates and starts a session for the worker's agent (the batch's agent
+// or the worker's experiment variant).
+func (m *Manager) startSession(ctx context.Context, batch *Batch, w *worker, workspace string) (string, error) {
+	env, err := m.variantEnv(w.variant)
+	if err != nil {
+		return "", err
+	}
+
+	// Note: RuntimeID is resolved via AgentID configuration
+	sess, err := m.sessionMgr.Create(ctx, &session.CreateRequest{
+		AgentID:    w.agentID(batch),
+		Workspace:  workspace,
+		Env:        env,
+		ProviderID: m.variantProvider(batch, w.variant),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create session: %w", err)
+	}
+
+	if err := m.sessionMgr.Start(ctx, sess.ID); err != nil {
+		m.sessionMgr.Delete(ctx, sess.ID)
+		return "", fmt.Errorf("failed to start session: %w", err)
+	}
+	return sess.ID, nil
+}
+
+// discardSession stops and deletes a session. Isolated workspaces are removed as well.
+func (m *Manager) discardSession(sessionID string, isolated bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	workspace, _ := m.sessionMgr.GetWorkspace(sessionID)
+	if err := m.sessionMgr.Stop(ctx, sessionID); err != nil {
+		logger.Warn("Failed to stop session", "session_id", sessionID, "error", err)
+	}
+	if err := m.sessionMgr.Delete(ctx, sessionID); err != nil {
+		logger.Warn("Failed to delete session", "session_id", sessionID, "error", err)
+	}
+	if isolated && workspace != "" {
+		if err := os.RemoveAll(workspace); err != nil {
+			logger.Warn("Failed to remove workspace", "session_id", sessionID, "workspace", workspace, "error", err)
+		}
+	}
+}
+
+// isolate prepares a worker that already ran a task for the next one:
+// reset_workspace cleans the session, fresh_session switches to a new session.
+func (m *Manager) isolate(ctx context.Context, batch *Batch, w *worker) error {
+	if !w.used {
+		return nil
+	}
+
+	switch batch.Template.Isolation {
+	case IsolationResetWorkspace:
+		result, err := m.sessionMgr.RunCommand(ctx, w.sessionID, resetCommand)
+		if err != nil {
+			return fmt.Errorf("failed to reset workspace: %w", err)
+		}
+		if result.ExitCode != 0 {
+			return fmt.Errorf("failed to reset workspace: exit code %d: %s", result.ExitCode, result.Stderr)
+		}
+		// Remote nodes work on a synced copy: clear the control plane side too
+		workspace, err := m.sessionMgr.GetWorkspace(w.sessionID)
+		if err != nil {
+			return err
+		}
+		if err := clearDir(workspace); err != nil {
+			return fmt.Errorf("failed to reset workspace: %w", err)
+		}
+
+	case IsolationFreshSession:
+		spare := m.takeSpare(ctx, batch, w)
+		if spare.err != nil {
+			return spare.err
+		}
+		old := w.sessionID
+		w.sessionID = spare.id
+		go m.discardSession(old, true)
+		m.warmSpare(ctx, batch, w)
+	}
+
+	w.used = false
+	return nil
+}
+
+// warmSpare starts the worker's next session in the background so that the next
+// task of a fresh_session batch does not wait for a container to start.
+func (m *Manager) warmSpare(ctx context.Context, batch *Batch, w *worker) {
+	w.sessions++
+	workspace := workerWorkspace(batch, w.id, w.sessions)
+	w.spare = make(chan spareSession, 1)
+	go func(ch chan spareSession) {
+		id, err := m.startSession(ctx, batch, w, workspace)
+		ch <- spareSession{id: id, workspace: workspace, err: err}
+	}(w.spare)
+}
+
+// takeSpare returns the warmed session, starting a new one if warming failed.
+func (m *Manager) takeSpare(ctx context.Context, batch *Batch, w *worker) spareSession {
+	if w.spare == nil {
+		m.warmSpare(ctx, batch, w)
+	}
+	spare := <-w.spare
+	w.spare = nil
+	if spare.err != nil {
+		logger.Warn("Warm session failed, starting a new one", "worker_id", w.id, "error", spare.err)
+		spare.id, spare.err = m.startSession(ctx, batch, w, spare.workspace)
+	}
+	return spare
+}
+
+// dropSpare discards the worker's warmed session, if any.
+func (m *Manager) dropSpare(w *worker) {
+	if w.spare == nil {
+		return
+	}
+	spare := <-w.spare
+	w.spare = nil
+	if spare.err == nil {
+		m.discardSession(spare.id, true)
+	}
+}
+
+// stageInputs copies the files referenced by the batch's file fields into the worker's
+// workspace and returns the input to render the prompt with, where each file field holds
+// the workspace-relative path of its file(s) instead of the file ID.
+func (m *Manager) stageInputs(batch *Batch, w *worker, input map[string]interface{}) (map[string]interface{}, error) {
+	if len(batch.Template.FileFields) == 0 {
+		return input, nil
+	}
+	workspace, err := m.sessionMgr.GetWorkspace(w.sessionID)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(workspace, stagedInputDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create input directory: %w", err)
+	}
+
+	rendered := make(map[string]interface{}, len(input))
+	for k, v := range input {
+		rendered[k] = v
+	}
+	used := make(map[string]bool)
+	stage := func(field string, v interface{}) (string, error) {
+		fileID, ok := v.(string)
+		if !ok || fileID == "" {
+			return "", fmt.Errorf("input field %s: expected a file id, got %v", field, v)
+		}
+		src, name, err := m.files(fileID)
+		if err != nil {
+			return "", fmt.Errorf("input field %s: file %s: %w", field, fileID, err)
+		}
+		name = filepath.Base(name)
+		if used[name] {
+			name = fileID + "-" + name
+		}
+		used[name] = true
+		if err := copyFile(src, filepath.Join(dir, name)); err != nil {
+			return "", fmt.Errorf("input field %s: failed to stage file %s: %w", field, fileID, err)
+		}
+		return stagedInputDir + "/" + name, nil
+	}
+
+	for _, field := range batch.Template.FileFields {
+		value, ok := input[field]
+		if !ok || value == nil {
+			continue
+		}
+		if list, isList := value.([]interface{}); isList {
+			paths := make([]interface{}, len(list))
+			for i, v := range list {
+				if paths[i], err = stage(field, v); err != nil {
+					return nil, err
+				}
+			}
+			rendered[field] = paths
+			continue
+		}
+		if rendered[field], err = stage(field, value); err != nil {
+			return nil, err
+		}
+	}
+	return rendered, nil
+}
+
+// clearDir removes the contents of dir, keeping dir itself.
+func clearDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,68 @@
+package batch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmalldedede/agentbox/internal/session"
+)
+
+func TestValidateIsolation(t *testing.T) {
+	m := &Manager{}
+	assert.NoError(t, m.validateIsolation(&BatchTemplate{}))
+	assert.NoError(t, m.validateIsolation(&BatchTemplate{Isolation: IsolationFreshSession}))
+	assert.ErrorContains(t, m.validateIsolation(&BatchTemplate{Isolation: "none"}), "invalid isolation")
+	assert.ErrorContains(t, m.validateIsolation(&BatchTemplate{Isolation: IsolationShared, FileFields: []string{"doc"}}), "require isolation")
+	assert.ErrorContains(t, m.validateIsolation(&BatchTemplate{Isolation: IsolationResetWorkspace, FileFields: []string{"doc"}}), "not available")
+
+	b := &Batch{ID: "batch-1", Template: BatchTemplate{Isolation: IsolationFreshSession}}
+	assert.Equal(t, filepath.Join("batches", "batch-1", "worker-0-2"), workerWorkspace(b, "worker-0", 2))
+	b.Template.Isolation = IsolationShared
+	assert.Empty(t, workerWorkspace(b, "worker-0", 2))
+}
+
+func TestStageInputs(t *testing.T) {
+	uploads := t.TempDir()
+	for name, content := range map[string]string{"f1": "report", "f2": "first", "f3": "second"} {
+		require.NoError(t, os.WriteFile(filepath.Join(uploads, name), []byte(content), 0o644))
+	}
+	names := map[string]string{"f1": "report.pdf", "f2": "data.csv", "f3": "data.csv"}
+
+	workspace := t.TempDir()
+	store := session.NewMemoryStore()
+	require.NoError(t, store.Create(&session.Session{ID: "sess-1", Workspace: workspace}))
+
+	m := &Manager{
+		sessionMgr: session.NewManager(store, nil, nil, workspace),
+		files: func(fileID string) (string, string, error) {
+			return filepath.Join(uploads, fileID), names[fileID], nil
+		},
+	}
+	b := &Batch{Template: BatchTemplate{Isolation: IsolationResetWorkspace, FileFields: []string{"doc", "attachments", "missing"}}}
+	input := map[string]interface{}{"doc": "f1", "attachments": []interface{}{"f2", "f3"}, "topic": "q3"}
+
+	rendered, err := m.stageInputs(b, &worker{sessionID: "sess-1"}, input)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"doc":         "inputs/report.pdf",
+		"attachments": []interface{}{"inputs/data.csv", "inputs/f3-data.csv"},
+		"topic":       "q3",
+	}, rendered)
+	assert.Equal(t, "f1", input["doc"], "stored input keeps the file id")
+
+	data, err := os.ReadFile(filepath.Join(workspace, "inputs", "f3-data.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+
+	_, err = m.stageInputs(b, &worker{sessionID: "sess-1"}, map[string]interface{}{"doc": 42})
+	assert.ErrorContains(t, err, "expected a file id")
+
+	// clearDir 清空工作区但保留目录本身
+	require.NoError(t, clearDir(workspace))
+	entries, err := os.ReadDir(workspace)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -3,6 +3,7 @@ package batch
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"text/template"
@@ -11,7 +12,11 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/tmalldedede/agentbox/internal/agent"
+	"github.com/tmalldedede/agentbox/internal/eval"
+	"github.com/tmalldedede/agentbox/internal/labels"
 	"github.com/tmalldedede/agentbox/internal/logger"
+	"github.com/tmalldedede/agentbox/internal/provider"
+	"github.com/tmalldedede/agentbox/internal/resultcache"
 	"github.com/tmalldedede/agentbox/internal/session"
 )
 
@@ -21,12 +26,43 @@ type Manager struct {
 	sessionMgr *session.Manager
 	agentMgr   *agent.Manager
 
-	// Redis queue (optional, nil if disabled)
-	redisQueue *RedisQueue
+	// Task template resolver (optional, nil if templates are unavailable)
+	templates TemplateResolver
+
+	// LLM judge for llm_judge evaluators (optional)
+	judge eval.Judge
+
+	// Uploaded file lookup for file inputs (optional)
+	files FileResolver
+
+	// Provider env vars (with API key) for experiment variants overriding the provider (optional)
+	providerEnv ProviderEnvResolver
+
+	// Task queue (Redis, or the database queue when Redis is disabled)
+	queue TaskQueue
+
+	// Multi-instance coordination (optional, nil for a single instance)
+	cluster Cluster
+
+	// Requests/tokens per minute budgets by provider ID, shared by all batches
+	budgets  map[string]*providerBudget
+	budgetMu sync.RWMutex
+
+	// Model prices used by dry-run cost estimates
+	pricing provider.Pricing
+
+	// Result cache for batches opting in (optional)
+	cache *resultcache.Cache
 
 	// Running batches
-	running map[string]*runningBatch
-	mu      sync.RWMutex
+	running   map[string]*runningBatch
+	importing map[string]bool // Batches receiving appended inputs (cannot start meanwhile)
+	mu        sync.RWMutex
+
+	// Cross-batch scheduling (queued batches, priorities, windows)
+	policy     func() *SchedulingPolicy
+	scheduleMu sync.Mutex    // One scheduling pass at a time
+	scheduleCh chan struct{} // Requests a scheduling pass
 
 	// Event subscribers
 	eventSubs map[string][]chan *BatchEvent
@@ -47,9 +83,21 @@ type runningBatch struct {
 	batch     *Batch
 	workers   []*worker
 	taskQueue chan *BatchTask
+	ctx       context.Context
 	cancel    context.CancelFunc
 	wg        sync.WaitGroup
 
+	// Task queues by variant name (experiment batches; taskQueue is unused)
+	variantQueues map[string]chan *BatchTask
+
+	// Variant lanes the workers are spread over (a single nil lane for single-agent batches)
+	// and index of the next created worker (IDs stay unique when workers are retired and added)
+	lanes      []*Variant
+	nextWorker int
+
+	// Active worker limit (adaptive concurrency)
+	limiter *concurrencyLimiter
+
 	// Progress tracking
 	startTime     time.Time
 	completedLock sync.Mutex
@@ -57,6 +105,10 @@ type runningBatch struct {
 
 	// Completion flag to prevent duplicate completeBatch calls
 	completing bool
+
+	// Tasks claimed by this instance and not finished yet (claims extended by the recovery loop)
+	held   map[string]bool
+	heldMu sync.Mutex
 }
 
 // worker represents a single worker processing tasks.
@@ -64,9 +116,24 @@ type worker struct {
 	id        string
 	sessionID string
 	status    string // idle, busy, error, stopped
+	ctx       context.Context
 	cancel    context.CancelFunc
+	retired   bool // Retired by resize, stops after its current task (guarded by Manager.mu)
 	completed int
 	lastError string
+
+	// Isolation between tasks (see IsolationMode)
+	isolated bool              // Session workspace belongs to this worker only
+	used     bool              // Current session has run a task
+	sessions int               // Sessions started so far (fresh_session)
+	spare    chan spareSession // Session being warmed for the next task (fresh_session)
+
+	// Experiment variant run by the worker (nil for single-agent batches)
+	variant *Variant
+
+	// Queue the worker takes tasks from and budget of the provider it calls
+	queue  <-chan *BatchTask
+	budget *providerBudget
 }
 
 // ManagerConfig holds configuration for the batch manager.
@@ -74,8 +141,18 @@ type ManagerConfig struct {
 	MaxBatches       int
 	PollInterval     time.Duration
 	ProgressInterval time.Duration
-	RedisQueue       *RedisQueue // Optional Redis queue
-	DisableRecovery  bool        // Disable recovery of interrupted batches on startup (for testing)
+	Queue            TaskQueue // Task queue (default: database queue on the store)
+	Cluster          Cluster   // Optional multi-instance coordination
+	DisableRecovery  bool      // Disable recovery of interrupted batches on startup (for testing)
+
+	// Optional RPM/TPM budgets by provider ID, shared by all batches
+	ProviderBudgets map[string]ProviderBudget
+}
+
+// Cluster reports the current instance and which instances are still heartbeating.
+type Cluster interface {
+	InstanceID() string
+	Alive(instanceID string) bool
 }
 
 // DefaultManagerConfig returns default configuration.
@@ -99,42 +176,88 @@ func NewManager(store Store, sessionMgr *session.Manager, agentMgr *agent.Manage
 		store:            store,
 		sessionMgr:       sessionMgr,
 		agentMgr:         agentMgr,
-		redisQueue:       cfg.RedisQueue,
+		queue:            cfg.Queue,
+		cluster:          cfg.Cluster,
 		running:          make(map[string]*runningBatch),
+		importing:        make(map[string]bool),
 		eventSubs:        make(map[string][]chan *BatchEvent),
 		maxBatches:       cfg.MaxBatches,
 		pollInterval:     cfg.PollInterval,
 		progressInterval: cfg.ProgressInterval,
+		pricing:          provider.BuiltinPricing,
+		scheduleCh:       make(chan struct{}, 1),
 		ctx:              ctx,
 		cancel:           cancel,
 	}
-
-	// Start Redis recovery loop if enabled
-	if m.redisQueue != nil {
-		m.redisQueue.StartRecoveryLoop(30*time.Second, m.getRunningBatchIDs)
+	m.SetProviderBudgets(cfg.ProviderBudgets)
+	if m.queue == nil {
+		m.queue = NewDBQueue(store, DefaultClaimTimeout)
 	}
 
+	// Extend the claims of in-flight tasks and requeue timed out ones
+	go m.runQueueRecovery()
+
 	// Recover interrupted batches on startup (unless disabled for testing)
 	if !cfg.DisableRecovery {
 		go m.recoverOnStartup()
 	}
 
+	// Start queued batches when capacity and their windows allow
+	go m.runScheduler()
+
 	return m
 }
 
 // recoverOnStartup recovers batches that were running when the server stopped.
+// With a cluster, only batches of this instance (previous run) and of instances
+// that stopped heartbeating are recovered; batches of live peers are left alone.
 func (m *Manager) recoverOnStartup() {
 	// Wait a bit for initialization
 	time.Sleep(2 * time.Second)
 
-	batches, err := m.store.ListRunningBatches()
+	m.recoverBatches(func(b *Batch) bool {
+		return m.cluster == nil || b.InstanceID == m.instanceID() || !m.cluster.Alive(b.InstanceID)
+	})
+}
+
+// RecoverOrphaned recovers running batches whose instance stopped heartbeating.
+// It is run periodically by the cluster leader and returns the number of recovered batches.
+func (m *Manager) RecoverOrphaned() int {
+	if m.cluster == nil {
+		return 0
+	}
+	return m.recoverBatches(func(b *Batch) bool {
+		return !m.cluster.Alive(b.InstanceID)
+	})
+}
+
+// instanceID returns the current instance ID, empty for a single instance.
+func (m *Manager) instanceID() string {
+	if m.cluster == nil {
+		return ""
+	}
+	return m.cluster.InstanceID()
+}
+
+// recoverBatches resets the tasks of interrupted running batches and pauses them.
+func (m *Manager) recoverBatches(interrupted func(b *Batch) bool) int {
+	all, err := m.store.ListRunningBatches()
 	if err != nil {
 		logger.Warn("Failed to list running batches for recovery", "error", err)
-		return
+		return 0
 	}
 
+	var batches []*Batch
+	m.mu.RLock()
+	for _, b := range all {
+		if _, ok := m.running[b.ID]; !ok && interrupted(b) {
+			batches = append(batches, b)
+		}
+	}
+	m.mu.RUnlock()
+
 	if len(batches) == 0 {
-		return
+		return 0
 	}
 
 	logger.Info("Recovering interrupted batches", "count", len(batches))
@@ -151,24 +274,18 @@ func (m *Manager) recoverOnStartup() {
 			logger.Info("Reset running tasks for batch", "batch_id", b.ID, "count", count)
 		}
 
-		// Re-enqueue to Redis if enabled
-		if m.redisQueue != nil {
-			// Get pending tasks and re-enqueue
-			tasks, _, err := m.store.ListTasks(b.ID, &ListTaskFilter{
-				Status: BatchTaskPending,
-				Limit:  100000,
-			})
-			if err != nil {
-				logger.Warn("Failed to list pending tasks for recovery", "batch_id", b.ID, "error", err)
-				continue
-			}
-
-			if len(tasks) > 0 {
-				if err := m.redisQueue.Enqueue(context.Background(), b.ID, tasks); err != nil {
-					logger.Warn("Failed to re-enqueue tasks to Redis", "batch_id", b.ID, "error", err)
-				} else {
-					logger.Info("Re-enqueued tasks to Redis", "batch_id", b.ID, "count", len(tasks))
-				}
+		// Re-enqueue pending tasks (the queue may have lost them with the instance)
+		tasks, _, err := m.store.ListTasks(b.ID, &ListTaskFilter{
+			Status: BatchTaskPending,
+			Limit:  100000,
+		})
+		if err != nil {
+			logger.Warn("Failed to list pending tasks for recovery", "batch_id", b.ID, "error", err)
+			continue
+		}
+		if len(tasks) > 0 {
+			if err := m.queue.Enqueue(context.Background(), b.ID, tasks); err != nil {
+				logger.Warn("Failed to re-enqueue tasks", "batch_id", b.ID, "backend", m.queue.Backend(), "error", err)
 			}
 		}
 
@@ -180,26 +297,59 @@ func (m *Manager) recoverOnStartup() {
 
 		logger.Info("Batch recovered and paused", "batch_id", b.ID)
 	}
+	return len(batches)
 }
 
-// Create creates a new batch with tasks.
-func (m *Manager) Create(req *CreateBatchRequest) (*Batch, error) {
-	// Validate agent exists
-	if _, err := m.agentMgr.Get(req.AgentID); err != nil {
-		return nil, fmt.Errorf("agent not found: %s", req.AgentID)
+// SetEvalJudge sets the LLM judge used by llm_judge evaluators.
+func (m *Manager) SetEvalJudge(j eval.Judge) {
+	m.judge = j
+}
+
+// SetTemplateResolver sets the resolver used for batches created from task templates.
+func (m *Manager) SetTemplateResolver(r TemplateResolver) {
+	m.templates = r
+}
+
+// SetFileResolver sets the lookup of uploaded files used by file input sources.
+func (m *Manager) SetFileResolver(r FileResolver) {
+	m.files = r
+}
+
+// applyTemplate fills agent, prompt template and inputs from the referenced task template.
+func (m *Manager) applyTemplate(req *CreateBatchRequest) (*ResolvedTemplate, error) {
+	if m.templates == nil {
+		return nil, fmt.Errorf("task templates are not available")
+	}
+	if req.PromptTemplate != "" {
+		return nil, fmt.Errorf("template_id and prompt_template are mutually exclusive")
 	}
 
-	// Validate inputs
-	if len(req.Inputs) == 0 {
-		return nil, fmt.Errorf("inputs cannot be empty")
+	tpl, err := m.templates.ResolveTemplate(req.TemplateID, req.Inputs)
+	if err != nil {
+		return nil, err
+	}
+	if req.UserID != "" && tpl.UserID != req.UserID {
+		return nil, fmt.Errorf("access denied: not your template")
+	}
+	if req.AgentID != "" && req.AgentID != tpl.AgentID {
+		return nil, fmt.Errorf("template %s is bound to agent %s", req.TemplateID, tpl.AgentID)
 	}
 
-	// Validate template
-	if req.PromptTemplate == "" {
-		return nil, fmt.Errorf("prompt_template cannot be empty")
+	req.AgentID = tpl.AgentID
+	req.PromptTemplate = tpl.PromptTemplate
+	req.Inputs = tpl.Inputs
+	if req.Timeout <= 0 {
+		req.Timeout = tpl.Timeout
 	}
-	if _, err := template.New("test").Parse(req.PromptTemplate); err != nil {
-		return nil, fmt.Errorf("invalid prompt_template: %w", err)
+	req.Evaluators = append(append([]eval.Evaluator{}, tpl.Evaluators...), req.Evaluators...)
+	return tpl, nil
+}
+
+// Create creates a new batch with tasks.
+func (m *Manager) Create(req *CreateBatchRequest) (*Batch, error) {
+	tpl, err := m.prepareCreate(req)
+	if err != nil {
+		return nil, err
 	}
 
 	// Set defaults
@@ -230,50 +380,56 @@ func (m *Manager) Create(req *CreateBatchRequest) (*Batch, error) {
 			Timeout:        timeout,
 			MaxRetries:     maxRetries,
 			RuntimeID:      req.RuntimeID,
+			Evaluators:     req.Evaluators,
+			Isolation:      req.Isolation,
+			FileFields:     req.FileFields,
+			Adaptive:       req.Adaptive,
+			Variants:       req.Variants,
+			Windows:        req.Windows,
+			Cache:          req.Cache,
 		},
 		Concurrency:  concurrency,
+		Priority:     req.Priority,
 		Status:       BatchStatusPending,
-		TotalTasks:   len(req.Inputs),
+		TotalTasks:   0, // Counted as tasks are added
 		Completed:    0,
 		Failed:       0,
 		CreatedAt:    now,
 		Workers:      []WorkerInfo{},
 		ErrorSummary: make(map[string]int),
+		Labels:       req.Labels,
+	}
+
+	if tpl != nil {
+		batch.Template.TemplateID = req.TemplateID
+		batch.Template.TemplateVersion = tpl.Version
 	}
 
 	if err := m.store.CreateBatch(batch); err != nil {
 		return nil, fmt.Errorf("failed to create batch: %w", err)
 	}
 
-	// Create tasks
-	tasks := make([]*BatchTask, len(req.Inputs))
-	for i, input := range req.Inputs {
-		tasks[i] = &BatchTask{
-			ID:        fmt.Sprintf("%s-%d", batchID, i),
-			BatchID:   batchID,
-			Index:     i,
-			Input:     input,
-			Status:    BatchTaskPending,
-			Attempts:  0,
-			CreatedAt: now,
-		}
+	// Create tasks (streamed in chunks for file sources)
+	if req.Source != nil {
+		batch.Import, err = m.importInputs(batch, req.Source)
+	} else {
+		err = m.addTasks(batch, req.Inputs)
 	}
-
-	if err := m.store.CreateTasks(tasks); err != nil {
+	if err == nil {
+		err = m.store.UpdateBatch(batch)
+	}
+	if err != nil {
 		// Rollback batch
+		m.store.DeleteTasks(batchID)
 		m.store.DeleteBatch(batchID)
-		return nil, fmt.Errorf("failed to create tasks: %w", err)
-	}
-
-	// Enqueue to Redis if enabled
-	if m.redisQueue != nil {
-		if err := m.redisQueue.Enqueue(context.Background(), batchID, tasks); err != nil {
-			logger.Warn("Failed to enqueue tasks to Redis", "batch_id", batchID, "error", err)
-			// Continue anyway - SQLite store is the source of truth
+		var importErr *ImportError
+		if errors.As(err, &importErr) {
+			return nil, err
 		}
+		return nil, fmt.Errorf("failed to create tasks: %w", err)
 	}
 
-	logger.Info("Created batch", "batch_id", batchID, "tasks", len(tasks))
+	logger.Info("Created batch", "batch_id", batchID, "tasks", batch.TotalTasks)
 
 	// Auto-start if requested
 	if req.AutoStart {
@@ -285,27 +441,183 @@ func (m *Manager) Create(req *CreateBatchRequest) (*Batch, error) {
 	return batch, nil
 }
 
-// Start begins batch execution by creating workers.
+// prepareCreate validates a create request and resolves its task template (if any).
+// The request is completed in place (template fields, default isolation).
+func (m *Manager) prepareCreate(req *CreateBatchRequest) (*ResolvedTemplate, error) {
+	if req.Source != nil && len(req.Inputs) > 0 {
+		return nil, fmt.Errorf("inputs and source are mutually exclusive")
+	}
+
+	// Resolve task template
+	var tpl *ResolvedTemplate
+	if req.TemplateID != "" {
+		if len(req.Inputs) == 0 && req.Source == nil {
+			return nil, fmt.Errorf("inputs cannot be empty")
+		}
+		var err error
+		if tpl, err = m.applyTemplate(req); err != nil {
+			return nil, err
+		}
+	}
+
+	// Experiments without agent_id belong to the agent of their first variant
+	if req.AgentID == "" && len(req.Variants) > 0 {
+		req.AgentID = req.Variants[0].AgentID
+	}
+
+	// Validate agent exists
+	ag, err := m.agentMgr.Get(req.AgentID)
+	if err != nil {
+		return nil, fmt.Errorf("agent not found: %s", req.AgentID)
+	}
+	// Batch workers run without the tool approval gate of tasks
+	if ag.ApprovalEnabled() {
+		return nil, fmt.Errorf("agent %s requires tool approval, which batches do not support", req.AgentID)
+	}
+
+	// Validate inputs
+	if len(req.Inputs) == 0 && req.Source == nil {
+		return nil, fmt.Errorf("inputs cannot be empty")
+	}
+
+	// Validate template
+	if req.PromptTemplate == "" {
+		return nil, fmt.Errorf("prompt_template cannot be empty")
+	}
+	if _, err := template.New("test").Parse(req.PromptTemplate); err != nil {
+		return nil, fmt.Errorf("invalid prompt_template: %w", err)
+	}
+	if err := eval.Validate(req.Evaluators); err != nil {
+		return nil, fmt.Errorf("invalid evaluators: %w", err)
+	}
+	if err := labels.Validate(req.Labels); err != nil {
+		return nil, err
+	}
+	if a := req.Adaptive; a != nil && (a.MinConcurrency < 0 || a.TargetLatency < 0) {
+		return nil, fmt.Errorf("adaptive.min_concurrency and adaptive.target_latency cannot be negative")
+	}
+	if err := m.validateVariants(req); err != nil {
+		return nil, err
+	}
+	if _, err := parseWindows(req.Windows); err != nil {
+		return nil, err
+	}
+	if err := resultcache.Validate(req.Cache); err != nil {
+		return nil, err
+	}
+	if req.Isolation == "" {
+		req.Isolation = IsolationShared
+	}
+	if err := m.validateIsolation(&BatchTemplate{Isolation: req.Isolation, FileFields: req.FileFields}); err != nil {
+		return nil, err
+	}
+	return tpl, nil
+}
+
+// addTasks appends pending tasks for inputs after the batch's existing tasks.
+// Experiment batches get one task per input and variant, the variants of an input being adjacent.
+func (m *Manager) addTasks(batch *Batch, inputs []map[string]interface{}) error {
+	now := time.Now()
+	variants := batch.Template.Variants
+	fanOut := len(variants)
+	if fanOut == 0 {
+		fanOut = 1
+	}
+	tasks := make([]*BatchTask, len(inputs)*fanOut)
+	for i, input := range inputs {
+		for v := 0; v < fanOut; v++ {
+			index := batch.TotalTasks + i*fanOut + v
+			task := &BatchTask{
+				ID:        fmt.Sprintf("%s-%d", batch.ID, index),
+				BatchID:   batch.ID,
+				Index:     index,
+				Input:     input,
+				Status:    BatchTaskPending,
+				Attempts:  0,
+				CreatedAt: now,
+			}
+			if len(variants) > 0 {
+				task.Variant = variants[v].Name
+			}
+			tasks[i*fanOut+v] = task
+		}
+	}
+
+	if err := m.store.CreateTasks(tasks); err != nil {
+		return err
+	}
+	batch.TotalTasks += len(tasks)
+
+	if err := m.queue.Enqueue(context.Background(), batch.ID, tasks); err != nil {
+		logger.Warn("Failed to enqueue tasks", "batch_id", batch.ID, "backend", m.queue.Backend(), "error", err)
+		// Continue anyway - the store is the source of truth
+	}
+	return nil
+}
+
+// Start queues a pending or paused batch. It runs right away when the scheduling policy and
+// its schedule windows allow it, otherwise it stays queued until they do.
 func (m *Manager) Start(batchID string) error {
+	m.mu.RLock()
+	_, running := m.running[batchID]
+	importing := m.importing[batchID]
+	m.mu.RUnlock()
+	if running {
+		return fmt.Errorf("batch %s is already running", batchID)
+	}
+	if importing {
+		return fmt.Errorf("batch %s is importing inputs", batchID)
+	}
+
+	batch, err := m.store.GetBatch(batchID)
+	if err != nil {
+		return err
+	}
+	if batch.Status == BatchStatusQueued {
+		return nil
+	}
+	if batch.Status != BatchStatusPending && batch.Status != BatchStatusPaused {
+		return fmt.Errorf("batch status is %s, cannot start", batch.Status)
+	}
+	if ok, err := m.store.TransitionBatch(batchID, batch.Status, BatchStatusQueued); err != nil {
+		return fmt.Errorf("failed to queue batch: %w", err)
+	} else if !ok {
+		return fmt.Errorf("batch %s changed status, retry", batchID)
+	}
+
+	if err := m.schedule()[batchID]; err != nil {
+		return err
+	}
+	m.mu.RLock()
+	_, running = m.running[batchID]
+	m.mu.RUnlock()
+	if !running {
+		m.broadcast(batchID, &BatchEvent{
+			Type:      EventBatchQueued,
+			BatchID:   batchID,
+			Timestamp: time.Now(),
+			Data:      map[string]string{"reason": QueueReasonCapacity},
+		})
+		logger.Info("Queued batch", "batch_id", batchID, "priority", batch.Priority)
+	}
+	return nil
+}
+
+// run begins the execution of a batch claimed by the scheduler by creating its workers;
+// share caps its active workers (worker budget).
+func (m *Manager) run(batchID string, share int) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Check if already running
 	if _, ok := m.running[batchID]; ok {
 		return fmt.Errorf("batch %s is already running", batchID)
 	}
 
-	// Check max batches
-	if len(m.running) >= m.maxBatches {
-		return fmt.Errorf("maximum concurrent batches (%d) reached", m.maxBatches)
-	}
-
 	batch, err := m.store.GetBatch(batchID)
 	if err != nil {
 		return err
 	}
-
-	if batch.Status != BatchStatusPending && batch.Status != BatchStatusPaused {
+	if batch.Status != BatchStatusPending {
 		return fmt.Errorf("batch status is %s, cannot start", batch.Status)
 	}
 
@@ -313,25 +625,42 @@ func (m *Manager) Start(batchID string) error {
 	ctx, cancel := context.WithCancel(m.ctx)
 	rb := &runningBatch{
 		batch:     batch,
-		workers:   make([]*worker, 0, batch.Concurrency),
-		taskQueue: make(chan *BatchTask, batch.Concurrency*2),
+		workers:   make([]*worker, 0, batch.workerCount()),
+		taskQueue: make(chan *BatchTask, batch.laneConcurrency()*2),
+		ctx:       ctx,
 		cancel:    cancel,
 		startTime: time.Now(),
+		lanes:     []*Variant{nil},
+	}
+	if len(batch.Template.Variants) > 0 {
+		rb.lanes = make([]*Variant, len(batch.Template.Variants))
+		rb.variantQueues = make(map[string]chan *BatchTask, len(rb.lanes))
+		for i := range batch.Template.Variants {
+			v := &batch.Template.Variants[i]
+			// Pin the model so the whole experiment runs (and is priced) with the
+			// model it started with, whatever later changes to the agent
+			if v.ResolvedModel == "" {
+				v.ResolvedModel = m.resolveModel(v.AgentID, v.ProviderID, v.Model)
+			}
+			rb.lanes[i] = v
+			rb.variantQueues[v.Name] = make(chan *BatchTask, batch.laneConcurrency()*2)
+		}
 	}
 
-	// Create workers
-	for i := 0; i < batch.Concurrency; i++ {
-		w, err := m.createWorker(ctx, batch, i)
-		if err != nil {
+	// Only the workers granted by the worker budget get a session; resize adds
+	// or retires workers when the share changes
+	for len(rb.workers) < rb.workerTarget(share) {
+		if _, err := m.addWorker(rb); err != nil {
 			// Cleanup created workers
 			cancel()
 			for _, existingWorker := range rb.workers {
 				m.stopWorker(existingWorker)
 			}
-			return fmt.Errorf("failed to create worker %d: %w", i, err)
+			return err
 		}
-		rb.workers = append(rb.workers, w)
 	}
+	rb.limiter = newConcurrencyLimiter(batch.workerCount(), batch.Template.Adaptive)
+	rb.limiter.setShare(share)
 
 	m.running[batchID] = rb
 
@@ -339,6 +668,7 @@ func (m *Manager) Start(batchID string) error {
 	now := time.Now()
 	batch.Status = BatchStatusRunning
 	batch.StartedAt = &now
+	batch.InstanceID = m.instanceID()
 	batch.Workers = m.buildWorkerInfo(rb.workers)
 	if err := m.store.UpdateBatch(batch); err != nil {
 		logger.Warn("Failed to update batch status", "error", err)
@@ -363,43 +693,147 @@ func (m *Manager) Start(batchID string) error {
 		Timestamp: time.Now(),
 	})
 
-	logger.Info("Started batch", "batch_id", batchID, "workers", batch.Concurrency)
+	logger.Info("Started batch", "batch_id", batchID, "workers", len(rb.workers))
 	return nil
 }
 
-// createWorker creates a new worker with its session.
-func (m *Manager) createWorker(ctx context.Context, batch *Batch, index int) (*worker, error) {
-	workerID := fmt.Sprintf("worker-%d", index)
+// workerTarget returns how many workers the batch keeps for its share of the worker
+// budget: all of them without a cap, and at least one per experiment variant.
+func (rb *runningBatch) workerTarget(share int) int {
+	n := rb.batch.workerCount()
+	if share > 0 && share < n {
+		n = share
+	}
+	if n < len(rb.lanes) {
+		n = len(rb.lanes)
+	}
+	return n
+}
 
-	// Verify agent exists
-	if _, err := m.agentMgr.GetFullConfig(batch.AgentID); err != nil {
-		return nil, fmt.Errorf("failed to get agent config: %w", err)
+// laneWorkers counts the workers of each lane that are not retired.
+func (rb *runningBatch) laneWorkers() map[*Variant]int {
+	counts := make(map[*Variant]int, len(rb.lanes))
+	for _, w := range rb.workers {
+		if !w.retired {
+			counts[w.variant]++
+		}
 	}
+	return counts
+}
 
-	// Create session for worker
-	// Note: RuntimeID is resolved via AgentID configuration
-	sessionReq := &session.CreateRequest{
-		AgentID: batch.AgentID,
+// addWorker creates a worker (and its session) for the lane with the fewest workers
+// (caller holds m.mu or owns rb before it is registered).
+func (m *Manager) addWorker(rb *runningBatch) (*worker, error) {
+	counts := rb.laneWorkers()
+	v := rb.lanes[0]
+	for _, lane := range rb.lanes[1:] {
+		if counts[lane] < counts[v] {
+			v = lane
+		}
 	}
 
-	sess, err := m.sessionMgr.Create(ctx, sessionReq)
+	w, err := m.createWorker(rb.ctx, rb.batch, rb.nextWorker, v)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create session: %w", err)
+		return nil, fmt.Errorf("failed to create worker %d: %w", rb.nextWorker, err)
+	}
+	rb.nextWorker++
+	w.queue = rb.taskQueue
+	if v != nil {
+		w.queue = rb.variantQueues[v.Name]
+	}
+	w.budget = m.variantBudget(rb.batch, v)
+	rb.workers = append(rb.workers, w)
+	return w, nil
+}
+
+// resize applies a new share of the worker budget to a running batch: workers are added
+// up to the share, and surplus ones (from the lanes with the most workers, never the last
+// worker of a lane) are retired and drop their session after their current task.
+func (m *Manager) resize(rb *runningBatch, share int) {
+	rb.limiter.setShare(share)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.running[rb.batch.ID] != rb {
+		return
+	}
+
+	target := rb.workerTarget(share)
+	live := 0
+	for _, w := range rb.workers {
+		if !w.retired {
+			live++
+		}
+	}
+	for ; live < target; live++ {
+		w, err := m.addWorker(rb)
+		if err != nil {
+			logger.Warn("Failed to add worker", "batch_id", rb.batch.ID, "error", err)
+			break
+		}
+		rb.wg.Add(1)
+		go m.runWorker(rb.ctx, rb, w)
+	}
+	for ; live > target; live-- {
+		counts := rb.laneWorkers()
+		var victim *worker
+		for i := len(rb.workers) - 1; i >= 0; i-- {
+			w := rb.workers[i]
+			if !w.retired && counts[w.variant] > 1 && (victim == nil || counts[w.variant] > counts[victim.variant]) {
+				victim = w
+			}
+		}
+		if victim == nil {
+			break
+		}
+		victim.retired = true
+		victim.cancel()
 	}
+}
 
-	// Start session
-	if err := m.sessionMgr.Start(ctx, sess.ID); err != nil {
-		m.sessionMgr.Delete(ctx, sess.ID)
-		return nil, fmt.Errorf("failed to start session: %w", err)
+// removeWorker drops a retired worker from its batch and cleans up its session.
+func (m *Manager) removeWorker(rb *runningBatch, w *worker) {
+	m.mu.Lock()
+	for i, x := range rb.workers {
+		if x == w {
+			rb.workers = append(rb.workers[:i:i], rb.workers[i+1:]...)
+			break
+		}
 	}
+	m.mu.Unlock()
+	m.stopWorker(w)
+}
+
+// createWorker creates a new worker with its session.
+func (m *Manager) createWorker(ctx context.Context, batch *Batch, index int, variant *Variant) (*worker, error) {
+	workerID := fmt.Sprintf("worker-%d", index)
 
 	workerCtx, workerCancel := context.WithCancel(ctx)
 
 	w := &worker{
-		id:        workerID,
-		sessionID: sess.ID,
-		status:    "idle",
-		cancel:    workerCancel,
+		id:       workerID,
+		status:   "idle",
+		ctx:      workerCtx,
+		cancel:   workerCancel,
+		isolated: batch.Template.isolated(),
+		variant:  variant,
+	}
+
+	// Verify agent exists
+	if _, err := m.agentMgr.GetFullConfig(w.agentID(batch)); err != nil {
+		workerCancel()
+		return nil, fmt.Errorf("failed to get agent config: %w", err)
+	}
+
+	// Create session for worker (isolated modes use a workspace of its own)
+	sessionID, err := m.startSession(ctx, batch, w, workerWorkspace(batch, workerID, 0))
+	if err != nil {
+		workerCancel()
+		return nil, err
+	}
+	w.sessionID = sessionID
+	if batch.Template.Isolation == IsolationFreshSession {
+		m.warmSpare(ctx, batch, w)
 	}
 
 	// Broadcast worker started
@@ -409,15 +843,11 @@ func (m *Manager) createWorker(ctx context.Context, batch *Batch, index int) (*w
 		Timestamp: time.Now(),
 		Data: WorkerEventData{
 			WorkerID:  workerID,
-			SessionID: sess.ID,
+			SessionID: sessionID,
 		},
 	})
 
-	logger.Info("Created worker", "worker_id", workerID, "session_id", sess.ID, "batch_id", batch.ID)
-
-	// Keep context reference (not used directly but good for future)
-	_ = workerCtx
-
+	logger.Info("Created worker", "worker_id", workerID, "session_id", sessionID, "batch_id", batch.ID)
 	return w, nil
 }
 
@@ -426,17 +856,9 @@ func (m *Manager) stopWorker(w *worker) {
 	w.cancel()
 	w.status = "stopped"
 
-	// Stop and delete session
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	if err := m.sessionMgr.Stop(ctx, w.sessionID); err != nil {
-		logger.Warn("Failed to stop session", "session_id", w.sessionID, "error", err)
-	}
-
-	if err := m.sessionMgr.Delete(ctx, w.sessionID); err != nil {
-		logger.Warn("Failed to delete session", "session_id", w.sessionID, "error", err)
-	}
+	// Stop and delete session (and the warmed one)
+	m.dropSpare(w)
+	m.discardSession(w.sessionID, w.isolated)
 
 	logger.Info("Stopped worker", "worker_id", w.id, "session_id", w.sessionID)
 }
@@ -445,16 +867,31 @@ func (m *Manager) stopWorker(w *worker) {
 func (m *Manager) runWorker(ctx context.Context, rb *runningBatch, w *worker) {
 	defer rb.wg.Done()
 
+	// The worker context ends with the batch or when the worker is retired; a task
+	// already taken runs to completion under the batch context
 	for {
+		// Only the workers within the active limit take tasks
+		if err := rb.limiter.acquire(w.ctx); err != nil {
+			break
+		}
 		select {
-		case <-ctx.Done():
-			return
-		case task, ok := <-rb.taskQueue:
+		case <-w.ctx.Done():
+			rb.limiter.release()
+		case task, ok := <-w.queue:
 			if !ok {
+				rb.limiter.release()
 				return
 			}
 			m.executeTask(ctx, rb, w, task)
+			rb.limiter.release()
+			continue
 		}
+		break
+	}
+
+	// Retired while the batch keeps running
+	if ctx.Err() == nil {
+		m.removeWorker(rb, w)
 	}
 }
 
@@ -462,6 +899,7 @@ func (m *Manager) runWorker(ctx context.Context, rb *runningBatch, w *worker) {
 func (m *Manager) executeTask(ctx context.Context, rb *runningBatch, w *worker, task *BatchTask) {
 	startTime := time.Now()
 	w.status = "busy"
+	defer rb.release(task.ID)
 
 	// Update task state
 	task.Status = BatchTaskRunning
@@ -481,26 +919,91 @@ func (m *Manager) executeTask(ctx context.Context, rb *runningBatch, w *worker,
 		},
 	})
 
+	// Isolate from the worker's previous task and stage per-row input files
+	if err := m.isolate(ctx, rb.batch, w); err != nil {
+		m.handleTaskError(rb, w, task, startTime, err)
+		return
+	}
+	w.used = true
+	input, err := m.stageInputs(rb.batch, w, task.Input)
+	if err != nil {
+		m.handleTaskError(rb, w, task, startTime, err)
+		return
+	}
+
 	// Render prompt
-	prompt, err := m.renderPrompt(rb.batch.Template.PromptTemplate, task.Input)
+	prompt, err := m.renderPrompt(rb.batch.Template.PromptTemplate, input)
 	if err != nil {
 		m.handleTaskError(rb, w, task, startTime, fmt.Errorf("template error: %w", err))
 		return
 	}
 	task.Prompt = prompt
 
+	// Serve identical prompts from the result cache (no session run, no tokens)
+	cacheKey := m.cacheKey(rb.batch, w, task)
+	if entry := m.cachedResult(cacheKey); entry != nil {
+		task.Status = BatchTaskCompleted
+		task.Result = entry.Result
+		task.CacheHit = true
+		task.DurationMs = time.Since(startTime).Milliseconds()
+		task.InputTokens, task.CachedInputTokens, task.OutputTokens = 0, 0, 0
+		task.Evaluation = m.evaluate(ctx, rb.batch, w, task)
+		m.completeTask(rb, w, task)
+		return
+	}
+
+	// Wait for the provider budget shared with other batches
+	var reserved *budgetRequest
+	if w.budget != nil {
+		if reserved, err = w.budget.reserve(ctx); err != nil {
+			m.requeueTask(rb, task)
+			w.status = "idle"
+			return
+		}
+	}
+
 	// Execute via session
+	execStart := time.Now()
 	execCtx, cancel := context.WithTimeout(ctx, time.Duration(rb.batch.Template.Timeout)*time.Second)
 	defer cancel()
 
 	result, err := m.sessionMgr.Exec(execCtx, w.sessionID, &session.ExecRequest{
 		Prompt: prompt,
+		Model:  w.model(),
 	})
 
 	duration := time.Since(startTime).Milliseconds()
 	task.DurationMs = duration
+	if result != nil && result.Usage != nil {
+		task.InputTokens = int64(result.Usage.InputTokens)
+		task.CachedInputTokens = int64(result.Usage.CachedInputTokens)
+		task.OutputTokens = int64(result.Usage.OutputTokens)
+	}
+	if reserved != nil {
+		w.budget.use(reserved, task.InputTokens+task.OutputTokens)
+	}
+	if ctx.Err() == nil {
+		m.adjustConcurrency(rb, rb.limiter.observe(err, time.Since(execStart)))
+	}
 
 	if err != nil {
+		// Throttled attempts of adaptive batches are retried without using up MaxRetries,
+		// up to their own budget so a provider that keeps throttling cannot stall the batch
+		if rb.batch.Template.Adaptive != nil && ctx.Err() == nil && isThrottled(err) {
+			task.Error = err.Error()
+			w.lastError = err.Error()
+			task.ThrottleRetries++
+			if limit := throttleRetryLimit(&rb.batch.Template); task.ThrottleRetries > limit {
+				task.DurationMs = time.Since(startTime).Milliseconds()
+				m.deadLetterTask(rb, w, task, fmt.Sprintf("throttle_retries_exceeded: %s", task.Error))
+				w.status = "idle"
+				return
+			}
+			logger.Info("Task throttled by provider, requeuing", "task_id", task.ID, "throttle_retries", task.ThrottleRetries, "error", err)
+			m.requeueTask(rb, task)
+			w.status = "idle"
+			return
+		}
 		m.handleTaskError(rb, w, task, startTime, err)
 		return
 	}
@@ -511,15 +1014,19 @@ func (m *Manager) executeTask(ctx context.Context, rb *runningBatch, w *worker,
 	if task.Result == "" {
 		task.Result = result.Output // Fallback to raw output
 	}
+	task.Evaluation = m.evaluate(ctx, rb.batch, w, task)
+	m.storeResult(cacheKey, rb.batch, w, task)
+	m.completeTask(rb, w, task)
+}
+
+// completeTask records a completed task, updates the counters and checks batch completion.
+func (m *Manager) completeTask(rb *runningBatch, w *worker, task *BatchTask) {
 	if err := m.store.UpdateTask(task); err != nil {
 		logger.Warn("Failed to update task", "task_id", task.ID, "error", err)
 	}
 
-	// Mark complete in Redis
-	if m.redisQueue != nil {
-		if err := m.redisQueue.Complete(context.Background(), rb.batch.ID, task.ID); err != nil {
-			logger.Warn("Failed to complete task in Redis", "task_id", task.ID, "error", err)
-		}
+	if err := m.queue.Complete(context.Background(), rb.batch.ID, task.ID); err != nil {
+		logger.Warn("Failed to complete task in queue", "task_id", task.ID, "error", err)
 	}
 
 	// Update counters
@@ -545,7 +1052,7 @@ func (m *Manager) executeTask(ctx context.Context, rb *runningBatch, w *worker,
 			TaskID:     task.ID,
 			TaskIndex:  task.Index,
 			WorkerID:   w.id,
-			DurationMs: duration,
+			DurationMs: task.DurationMs,
 		},
 	})
 
@@ -553,6 +1060,61 @@ func (m *Manager) executeTask(ctx context.Context, rb *runningBatch, w *worker,
 	m.checkBatchComplete(rb)
 }
 
+// evaluate runs the agent's and the batch's evaluators against a successful task result.
+// Command evaluators run in the worker's session workspace. Returns nil without evaluators.
+func (m *Manager) evaluate(ctx context.Context, batch *Batch, w *worker, task *BatchTask) *eval.Report {
+	var evaluators []eval.Evaluator
+	if ag, err := m.agentMgr.Get(w.agentID(batch)); err == nil {
+		evaluators = append(evaluators, ag.Evaluators...)
+	}
+	evaluators = append(evaluators, batch.Template.Evaluators...)
+	if len(evaluators) == 0 {
+		return nil
+	}
+
+	env := &eval.Env{
+		Judge: m.judge,
+		Commands: func(ctx context.Context, command string) (int, string, error) {
+			result, err := m.sessionMgr.RunCommand(ctx, w.sessionID, command)
+			if err != nil {
+				return 0, "", err
+			}
+			return result.ExitCode, result.Stdout + result.Stderr, nil
+		},
+	}
+	report := eval.Run(ctx, evaluators, &eval.Subject{Prompt: task.Prompt, Output: task.Result}, env)
+	logger.Info("Task evaluated", "task_id", task.ID, "passed", report.Passed, "score", report.Score)
+	return report
+}
+
+// requeueTask puts a task back to pending (store and Redis) without counting an attempt.
+func (m *Manager) requeueTask(rb *runningBatch, task *BatchTask) {
+	task.Status = BatchTaskPending
+	task.WorkerID = ""
+	task.StartedAt = nil
+	if err := m.store.RequeueTask(task); err != nil {
+		logger.Warn("Failed to requeue task", "task_id", task.ID, "error", err)
+	}
+
+	if err := m.queue.Requeue(context.Background(), rb.batch.ID, task.ID, task.Attempts); err != nil {
+		logger.Warn("Failed to requeue task in queue", "task_id", task.ID, "error", err)
+	}
+}
+
+// adjustConcurrency logs and broadcasts a change of a batch's active workers.
+func (m *Manager) adjustConcurrency(rb *runningBatch, change *concurrencyChange) {
+	if change == nil {
+		return
+	}
+	logger.Info("Adjusted batch concurrency", "batch_id", rb.batch.ID, "from", change.From, "to", change.To, "reason", change.Reason)
+	m.broadcast(rb.batch.ID, &BatchEvent{
+		Type:      EventConcurrencyChanged,
+		BatchID:   rb.batch.ID,
+		Timestamp: time.Now(),
+		Data:      change,
+	})
+}
+
 // handleTaskError handles task failure and retry logic.
 func (m *Manager) handleTaskError(rb *runningBatch, w *worker, task *BatchTask, startTime time.Time, err error) {
 	task.DurationMs = time.Since(startTime).Milliseconds()
@@ -563,61 +1125,47 @@ func (m *Manager) handleTaskError(rb *runningBatch, w *worker, task *BatchTask,
 
 	// Check if should retry
 	if task.Attempts < rb.batch.Template.MaxRetries {
-		// Requeue for retry
-		task.Status = BatchTaskPending
-		task.WorkerID = ""
-		task.StartedAt = nil
-		if err := m.store.RequeueTask(task); err != nil {
-			logger.Warn("Failed to requeue task", "task_id", task.ID, "error", err)
-		}
-
-		// Requeue in Redis
-		if m.redisQueue != nil {
-			if err := m.redisQueue.Requeue(context.Background(), rb.batch.ID, task.ID, task.Attempts); err != nil {
-				logger.Warn("Failed to requeue task in Redis", "task_id", task.ID, "error", err)
-			}
-		}
-
+		m.requeueTask(rb, task)
 		logger.Info("Requeuing task for retry", "task_id", task.ID, "attempt", task.Attempts, "max_retries", rb.batch.Template.MaxRetries)
 	} else {
 		// Max retries exceeded - move to dead letter queue
-		task.Status = BatchTaskDead
-		reason := fmt.Sprintf("max_retries_exceeded: %s", task.Error)
+		m.deadLetterTask(rb, w, task, fmt.Sprintf("max_retries_exceeded: %s", task.Error))
+	}
 
-		if err := m.store.MarkTaskDead(task, reason); err != nil {
-			logger.Warn("Failed to mark task as dead", "task_id", task.ID, "error", err)
-		}
+	w.status = "idle"
+}
 
-		// Move to dead in Redis
-		if m.redisQueue != nil {
-			if err := m.redisQueue.MoveToDead(context.Background(), rb.batch.ID, task.ID, task.Attempts, task.Error); err != nil {
-				logger.Warn("Failed to move task to dead in Redis", "task_id", task.ID, "error", err)
-			}
-		}
+// deadLetterTask moves a task that will not be retried to the dead letter queue.
+func (m *Manager) deadLetterTask(rb *runningBatch, w *worker, task *BatchTask, reason string) {
+	task.Status = BatchTaskDead
+	if err := m.store.MarkTaskDead(task, reason); err != nil {
+		logger.Warn("Failed to mark task as dead", "task_id", task.ID, "error", err)
+	}
 
-		m.incrementDead(rb, task.Error)
+	if err := m.queue.MoveToDead(context.Background(), rb.batch.ID, task.ID, task.Attempts, task.Error); err != nil {
+		logger.Warn("Failed to move task to dead in queue", "task_id", task.ID, "error", err)
+	}
 
-		// Broadcast task dead
-		m.broadcast(rb.batch.ID, &BatchEvent{
-			Type:      EventTaskFailed,
-			BatchID:   rb.batch.ID,
-			Timestamp: time.Now(),
-			Data: TaskEventData{
-				TaskID:     task.ID,
-				TaskIndex:  task.Index,
-				WorkerID:   w.id,
-				DurationMs: task.DurationMs,
-				Error:      "DEAD: " + task.Error,
-			},
-		})
+	m.incrementDead(rb, task.Error)
 
-		logger.Warn("Task moved to dead letter queue", "task_id", task.ID, "attempts", task.Attempts, "error", task.Error)
+	// Broadcast task dead
+	m.broadcast(rb.batch.ID, &BatchEvent{
+		Type:      EventTaskFailed,
+		BatchID:   rb.batch.ID,
+		Timestamp: time.Now(),
+		Data: TaskEventData{
+			TaskID:     task.ID,
+			TaskIndex:  task.Index,
+			WorkerID:   w.id,
+			DurationMs: task.DurationMs,
+			Error:      "DEAD: " + task.Error,
+		},
+	})
 
-		// Check if batch is complete
-		m.checkBatchComplete(rb)
-	}
+	logger.Warn("Task moved to dead letter queue", "task_id", task.ID, "attempts", task.Attempts, "error", task.Error)
 
-	w.status = "idle"
+	// Check if batch is complete
+	m.checkBatchComplete(rb)
 }
 
 // renderPrompt renders the template with input variables.
@@ -754,6 +1302,9 @@ func (m *Manager) completeBatch(rb *runningBatch) {
 	})
 
 	logger.Info("Batch completed", "batch_id", rb.batch.ID, "succeeded", rb.batch.Completed, "failed", rb.batch.Failed)
+
+	// Capacity freed for queued batches
+	m.reschedule()
 }
 
 // runTaskDispatcher dispatches pending tasks to the queue.
@@ -767,42 +1318,33 @@ func (m *Manager) runTaskDispatcher(ctx context.Context, rb *runningBatch) {
 		select {
 		case <-ctx.Done():
 			close(rb.taskQueue)
+			for _, queue := range rb.variantQueues {
+				close(queue)
+			}
 			return
 		case <-ticker.C:
 			var tasks []*BatchTask
 
-			// Try Redis first if enabled
-			if m.redisQueue != nil {
-				claimedItems, err := m.redisQueue.Claim(ctx, rb.batch.ID, workerID, rb.batch.Concurrency)
-				if err != nil {
-					logger.Warn("Failed to claim tasks from Redis", "batch_id", rb.batch.ID, "error", err)
-				} else if len(claimedItems) > 0 {
-					// Fetch task details from store
-					for _, item := range claimedItems {
-						task, err := m.store.GetTask(rb.batch.ID, item.TaskID)
-						if err != nil {
-							logger.Warn("Failed to get task from store", "task_id", item.TaskID, "error", err)
-							continue
-						}
-						tasks = append(tasks, task)
-					}
-				}
+			claimedItems, err := m.queue.Claim(ctx, rb.batch.ID, workerID, rb.limiter.current())
+			if err != nil {
+				logger.Warn("Failed to claim tasks", "batch_id", rb.batch.ID, "backend", m.queue.Backend(), "error", err)
+				continue
 			}
-
-			// Fallback to SQLite polling if Redis not enabled or returned no tasks
-			if len(tasks) == 0 {
-				var err error
-				tasks, err = m.store.ClaimPendingTasks(rb.batch.ID, rb.batch.Concurrency)
+			// Fetch task details from store
+			for _, item := range claimedItems {
+				task, err := m.store.GetTask(rb.batch.ID, item.TaskID)
 				if err != nil {
-					logger.Warn("Failed to claim tasks from store", "batch_id", rb.batch.ID, "error", err)
+					logger.Warn("Failed to get task from store", "task_id", item.TaskID, "error", err)
 					continue
 				}
+				tasks = append(tasks, task)
+				rb.hold(task.ID)
 			}
 
 			// Dispatch to queue
 			for _, task := range tasks {
 				select {
-				case rb.taskQueue <- task:
+				case rb.queueFor(task) <- task:
 				case <-ctx.Done():
 					return
 				}
@@ -896,6 +1438,9 @@ func (m *Manager) buildWorkerInfo(workers []*worker) []WorkerInfo {
 			Completed: w.completed,
 			LastError: w.lastError,
 		}
+		if w.variant != nil {
+			info[i].Variant = w.variant.Name
+		}
 	}
 	return info
 }
@@ -906,6 +1451,13 @@ func (m *Manager) Pause(batchID string) error {
 	rb, ok := m.running[batchID]
 	if !ok {
 		m.mu.Unlock()
+		// Queued batches leave the queue
+		if paused, err := m.store.TransitionBatch(batchID, BatchStatusQueued, BatchStatusPaused); err != nil {
+			return err
+		} else if paused {
+			m.broadcast(batchID, &BatchEvent{Type: EventBatchPaused, BatchID: batchID, Timestamp: time.Now()})
+			return nil
+		}
 		return ErrBatchNotRunning
 	}
 	delete(m.running, batchID)
@@ -919,6 +1471,7 @@ func (m *Manager) Pause(batchID string) error {
 	for _, w := range rb.workers {
 		w.status = "stopped"
 		// Note: Not stopping sessions here to allow resume
+		m.dropSpare(w)
 	}
 
 	// Update status
@@ -935,6 +1488,7 @@ func (m *Manager) Pause(batchID string) error {
 	})
 
 	logger.Info("Paused batch", "batch_id", batchID)
+	m.reschedule()
 	return nil
 }
 
@@ -983,22 +1537,10 @@ func (m *Manager) Cancel(batchID string) error {
 	})
 
 	logger.Info("Cancelled batch", "batch_id", batchID)
+	m.reschedule()
 	return nil
 }
 
-// getRunningBatchIDs returns the IDs of all currently running batches.
-// Used by Redis queue recovery loop to skip tasks from active batches.
-func (m *Manager) getRunningBatchIDs() []string {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	ids := make([]string, 0, len(m.running))
-	for id := range m.running {
-		ids = append(ids, id)
-	}
-	return ids
-}
-
 // Get retrieves a batch by ID.
 func (m *Manager) Get(batchID string) (*Batch, error) {
 	batch, err := m.store.GetBatch(batchID)
@@ -1010,12 +1552,14 @@ func (m *Manager) Get(batchID string) (*Batch, error) {
 	m.mu.RLock()
 	if rb, ok := m.running[batchID]; ok {
 		batch.Workers = m.buildWorkerInfo(rb.workers)
+		batch.ActiveConcurrency = rb.limiter.current()
 		progress := m.calculateProgress(rb)
 		batch.ProgressPercent = progress.Percent
 		batch.EstimatedETA = progress.ETA
 		batch.TasksPerSec = progress.TasksPerSec
 	}
 	m.mu.RUnlock()
+	m.queueState(batch)
 
 	return batch, nil
 }
@@ -1025,6 +1569,17 @@ func (m *Manager) List(filter *ListBatchFilter) ([]*Batch, int, error) {
 	return m.store.ListBatches(filter)
 }
 
+// SetLabels replaces the labels of a batch.
+func (m *Manager) SetLabels(batchID string, values map[string]string) (*Batch, error) {
+	if err := labels.Validate(values); err != nil {
+		return nil, err
+	}
+	if err := m.store.SetBatchLabels(batchID, values); err != nil {
+		return nil, err
+	}
+	return m.Get(batchID)
+}
+
 // Delete deletes a batch.
 func (m *Manager) Delete(batchID string) error {
 	// Cancel if running
@@ -1176,6 +1731,10 @@ type PoolStats struct {
 	BusyWorkers    int              `json:"busy_workers"`
 	IdleWorkers    int              `json:"idle_workers"`
 	Batches        []RunningBatchInfo `json:"batches"`
+
+	// Workers shared by all running batches (0 = unlimited) and batches waiting for capacity
+	WorkerBudget  int `json:"worker_budget"`
+	QueuedBatches int `json:"queued_batches"`
 }
 
 // RunningBatchInfo provides summary info for a running batch.
@@ -1183,6 +1742,7 @@ type RunningBatchInfo struct {
 	ID          string  `json:"id"`
 	Name        string  `json:"name"`
 	Workers     int     `json:"workers"`
+	Active      int     `json:"active_workers"` // Workers allowed to take tasks (adaptive concurrency)
 	Completed   int     `json:"completed"`
 	Failed      int     `json:"failed"`
 	Total       int     `json:"total"`
@@ -1216,10 +1776,9 @@ func (m *Manager) RetryDeadTasks(batchID string, taskIDs []string) (int, error)
 		return 0, err
 	}
 
-	// Re-enqueue to Redis if enabled
-	if m.redisQueue != nil && count > 0 {
-		if _, err := m.redisQueue.RetryDead(context.Background(), batchID, taskIDs); err != nil {
-			logger.Warn("Failed to retry dead tasks in Redis", "batch_id", batchID, "error", err)
+	if count > 0 {
+		if _, err := m.queue.RetryDead(context.Background(), batchID, taskIDs); err != nil {
+			logger.Warn("Failed to retry dead tasks in queue", "batch_id", batchID, "error", err)
 		}
 	}
 
@@ -1264,14 +1823,10 @@ func (m *Manager) GetQueueOverview() (*QueueOverview, error) {
 			Total:       stats.TotalTasks,
 		}
 
-		// Add Redis stats if available
-		if m.redisQueue != nil {
-			redisStats, err := m.redisQueue.Stats(context.Background(), b.ID)
-			if err == nil {
-				bq.RedisPending = redisStats.Pending
-				bq.RedisProcessing = redisStats.Processing
-				bq.RedisDead = redisStats.Dead
-			}
+		if queueStats, err := m.queue.Stats(context.Background(), b.ID); err == nil {
+			bq.QueuePending = queueStats.Pending
+			bq.QueueProcessing = queueStats.Processing
+			bq.QueueDead = queueStats.Dead
 		}
 
 		overview.Batches = append(overview.Batches, bq)
@@ -1282,19 +1837,30 @@ func (m *Manager) GetQueueOverview() (*QueueOverview, error) {
 		overview.TotalDead += stats.Dead
 	}
 
-	// Add Redis enabled flag
-	overview.RedisEnabled = m.redisQueue != nil
+	overview.QueueBackend = m.queue.Backend()
+	overview.RedisEnabled = overview.QueueBackend == QueueBackendRedis
 
 	return overview, nil
 }
 
 // GetPoolStats returns current worker pool statistics.
 func (m *Manager) GetPoolStats() *PoolStats {
+	policy := m.schedulingPolicy()
+	var queued int
+	if m.store != nil {
+		var err error
+		if _, queued, err = m.store.ListBatches(&ListBatchFilter{Status: BatchStatusQueued, Limit: 1}); err != nil {
+			logger.Warn("Failed to count queued batches", "error", err)
+		}
+	}
+
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	stats := &PoolStats{
-		MaxBatches:     m.maxBatches,
+		WorkerBudget:   policy.WorkerBudget,
+		QueuedBatches:  queued,
+		MaxBatches:     policy.MaxBatches,
 		RunningBatches: len(m.running),
 		Batches:        make([]RunningBatchInfo, 0, len(m.running)),
 	}
@@ -1322,6 +1888,7 @@ func (m *Manager) GetPoolStats() *PoolStats {
 			ID:          rb.batch.ID,
 			Name:        rb.batch.Name,
 			Workers:     workerCount,
+			Active:      rb.limiter.current(),
 			Completed:   progress.Completed,
 			Failed:      progress.Failed,
 			Total:       progress.Total,
@@ -3,6 +3,10 @@ package batch
 
 import (
 	"time"
+
+	"github.com/tmalldedede/agentbox/internal/eval"
+	"github.com/tmalldedede/agentbox/internal/labels"
+	"github.com/tmalldedede/agentbox/internal/resultcache"
 )
 
 // BatchStatus represents the current state of a batch.
@@ -12,6 +16,7 @@ const (
 	BatchStatusPending   BatchStatus = "pending"
 	BatchStatusRunning   BatchStatus = "running"
 	BatchStatusPaused    BatchStatus = "paused"
+	BatchStatusQueued    BatchStatus = "queued" // Started, waiting for capacity or its schedule window
 	BatchStatusCompleted BatchStatus = "completed"
 	BatchStatusFailed    BatchStatus = "failed"
 	BatchStatusCancelled BatchStatus = "cancelled"
@@ -43,6 +48,9 @@ type Batch struct {
 	// Concurrency configuration
 	Concurrency int `json:"concurrency"` // Number of workers
 
+	// Scheduling priority across batches (higher first; preempts lower running batches)
+	Priority int `json:"priority"`
+
 	// Progress tracking
 	Status     BatchStatus `json:"status"`
 	TotalTasks int         `json:"total_tasks"`
@@ -54,6 +62,16 @@ type Batch struct {
 	EstimatedETA    string  `json:"estimated_eta,omitempty"`
 	TasksPerSec     float64 `json:"tasks_per_sec,omitempty"`
 
+	// Workers currently allowed to take tasks (running batches, see AdaptiveConcurrency)
+	ActiveConcurrency int `json:"active_concurrency,omitempty"`
+
+	// Why a queued batch is waiting and when its schedule window opens or closes (not stored)
+	QueueReason string     `json:"queue_reason,omitempty"`
+	NextWindow  *time.Time `json:"next_window,omitempty"`
+
+	// Result of the file import that created or extended the batch (not stored)
+	Import *ImportResult `json:"import,omitempty"`
+
 	// Timestamps
 	CreatedAt   time.Time  `json:"created_at"`
 	StartedAt   *time.Time `json:"started_at,omitempty"`
@@ -64,6 +82,12 @@ type Batch struct {
 
 	// Error aggregation
 	ErrorSummary map[string]int `json:"error_summary,omitempty"` // error_type -> count
+
+	// Labels for filtering with label selectors (editable after creation)
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Instance running the batch (multi-instance deployments)
+	InstanceID string `json:"instance_id,omitempty"`
 }
 
 // BatchTemplate defines the configuration template for batch tasks.
@@ -72,6 +96,75 @@ type BatchTemplate struct {
 	Timeout        int    `json:"timeout"`         // Per-task timeout in seconds
 	MaxRetries     int    `json:"max_retries"`     // Number of retry attempts
 	RuntimeID      string `json:"runtime_id"`      // Optional runtime configuration
+
+	// Set when the batch was created from a task template
+	TemplateID      string `json:"template_id,omitempty"`
+	TemplateVersion int    `json:"template_version,omitempty"`
+
+	// Checks run against every successful task result (in addition to the agent's evaluators)
+	Evaluators []eval.Evaluator `json:"evaluators,omitempty"`
+
+	// How tasks of the same worker are isolated from each other (default: shared)
+	Isolation IsolationMode `json:"isolation,omitempty"`
+	// Input fields holding uploaded file IDs; the files are staged into the task's workspace
+	// (requires isolation) and the fields render as workspace-relative paths
+	FileFields []string `json:"file_fields,omitempty"`
+
+	// Adjust active workers to provider rate limits and latency (nil = fixed Concurrency)
+	Adaptive *AdaptiveConcurrency `json:"adaptive,omitempty"`
+
+	// Experiment arms: every input runs once per variant, the Concurrency workers split
+	// evenly across the variants (empty = every input runs once on the batch's agent)
+	Variants []Variant `json:"variants,omitempty"`
+
+	// Times the batch may run (empty = any time); the batch is queued outside of them
+	Windows []ScheduleWindow `json:"windows,omitempty"`
+
+	// Reuse results of identical prompts (same resolved agent config, prompt and input files)
+	// across tasks and batches; cache hits use no tokens (nil = always execute)
+	Cache *resultcache.Policy `json:"cache,omitempty"`
+}
+
+// ScheduleWindow is a recurring period a batch may run in.
+type ScheduleWindow struct {
+	Start    string `json:"start"`    // Cron expression of the openings, e.g. "0 22 * * *" (CRON_TZ=Asia/Shanghai prefix for a time zone)
+	Duration string `json:"duration"` // How long the window stays open, e.g. "8h"
+}
+
+// Variant is one arm of an experiment batch: an agent, optionally with another provider or model.
+type Variant struct {
+	Name       string `json:"name"`                  // Unique within the batch (default: agent[/provider][/model])
+	AgentID    string `json:"agent_id"`              // Default: the batch's agent
+	ProviderID string `json:"provider_id,omitempty"` // Overrides the agent's provider
+	Model      string `json:"model,omitempty"`       // Overrides the agent's model
+
+	// Model the variant runs with, resolved when the batch first starts (read-only)
+	ResolvedModel string `json:"resolved_model,omitempty"`
+}
+
+// IsolationMode controls what a task can see of the previous tasks run by the same worker.
+type IsolationMode string
+
+const (
+	IsolationShared         IsolationMode = "shared"          // One session and workspace per worker, shared by its tasks
+	IsolationResetWorkspace IsolationMode = "reset_workspace" // Workspace and engine history cleaned between tasks
+	IsolationFreshSession   IsolationMode = "fresh_session"   // New session (container and workspace) per task
+)
+
+// ResolvedTemplate is a task template resolved for a batch.
+type ResolvedTemplate struct {
+	UserID         string                   // Template owner
+	AgentID        string                   // Agent bound to the template
+	PromptTemplate string                   // Prompt in {{.field}} syntax
+	Timeout        int                      // Default per-task timeout (0 = batch default)
+	Version        int                      // Template version at resolve time
+	Inputs         []map[string]interface{} // Inputs validated against the template parameters, defaults applied
+	Evaluators     []eval.Evaluator         // Result evaluators of the template
+}
+
+// TemplateResolver resolves task templates referenced by batches.
+type TemplateResolver interface {
+	ResolveTemplate(templateID string, inputs []map[string]interface{}) (*ResolvedTemplate, error)
 }
 
 // WorkerInfo contains runtime information about a worker.
@@ -83,6 +176,9 @@ type WorkerInfo struct {
 	CurrentTask string `json:"current_task,omitempty"` // Currently processing task ID
 	Completed   int    `json:"completed"`              // Tasks completed by this worker
 	LastError   string `json:"last_error,omitempty"`   // Last error if any
+
+	// Experiment variant the worker runs (experiment batches)
+	Variant string `json:"variant,omitempty"`
 }
 
 // BatchTask represents a single task within a batch.
@@ -94,6 +190,9 @@ type BatchTask struct {
 	// Input data
 	Input map[string]interface{} `json:"input"` // Template variables
 
+	// Experiment variant running this input (experiment batches; the input's row is Index / len(Variants))
+	Variant string `json:"variant,omitempty"`
+
 	// Rendered prompt (computed at runtime)
 	Prompt string `json:"prompt,omitempty"`
 
@@ -105,8 +204,12 @@ type BatchTask struct {
 	Result string `json:"result,omitempty"`
 	Error  string `json:"error,omitempty"`
 
+	// Result evaluation (set when the batch or agent has evaluators)
+	Evaluation *eval.Report `json:"evaluation,omitempty"`
+
 	// Retry tracking
-	Attempts int `json:"attempts"`
+	Attempts        int `json:"attempts"`
+	ThrottleRetries int `json:"throttle_retries,omitempty"` // Throttled requeues of adaptive batches (not counted in Attempts)
 
 	// Claim tracking (for checkpoint/resume)
 	ClaimedAt *time.Time `json:"claimed_at,omitempty"` // When task was claimed by worker
@@ -120,6 +223,14 @@ type BatchTask struct {
 	CreatedAt  time.Time  `json:"created_at"`
 	StartedAt  *time.Time `json:"started_at,omitempty"`
 	DurationMs int64      `json:"duration_ms,omitempty"` // Execution duration
+
+	// Token usage reported by the engine (last attempt)
+	InputTokens       int64 `json:"input_tokens,omitempty"`
+	CachedInputTokens int64 `json:"cached_input_tokens,omitempty"` // Included in InputTokens
+	OutputTokens      int64 `json:"output_tokens,omitempty"`
+
+	// Result served from the result cache: no session ran, no tokens were used
+	CacheHit bool `json:"cache_hit,omitempty"`
 }
 
 // CreateBatchRequest is the request to create a new batch.
@@ -127,34 +238,60 @@ type CreateBatchRequest struct {
 	Name           string                   `json:"name"`            // Batch name
 	AgentID        string                   `json:"agent_id"`        // Agent to use
 	PromptTemplate string                   `json:"prompt_template"` // e.g., "Analyze: {{.data}}"
+	TemplateID     string                   `json:"template_id"`     // Task template (replaces agent_id + prompt_template)
 	Inputs         []map[string]interface{} `json:"inputs"`          // List of input maps
+	Source         *InputSource             `json:"source"`          // Read inputs from an uploaded file instead
 	Concurrency    int                      `json:"concurrency"`     // Number of workers
 	Timeout        int                      `json:"timeout"`         // Per-task timeout (seconds)
 	MaxRetries     int                      `json:"max_retries"`     // Retry count
 	RuntimeID      string                   `json:"runtime_id"`      // Optional runtime
 	AutoStart      bool                     `json:"auto_start"`      // Start immediately after creation
+	Evaluators     []eval.Evaluator         `json:"evaluators"`      // Result evaluators (appended to the template's)
+	Labels         map[string]string        `json:"labels"`          // key=value labels
+	Isolation      IsolationMode            `json:"isolation"`       // shared, reset_workspace or fresh_session
+	FileFields     []string                 `json:"file_fields"`     // Input fields holding uploaded file IDs
+	Adaptive       *AdaptiveConcurrency     `json:"adaptive"`        // Adaptive concurrency (Concurrency is the upper bound)
+	Variants       []Variant                `json:"variants"`        // Experiment: run every input once per variant
+	Priority       int                      `json:"priority"`        // Scheduling priority (higher first)
+	Windows        []ScheduleWindow         `json:"windows"`         // Allowed run windows (empty = any time)
+	Cache          *resultcache.Policy      `json:"cache"`           // Opt in to the result cache
 	UserID         string                   `json:"-"`               // Injected by middleware
 }
 
+// AppendInputsRequest is the request to add tasks to a pending or paused batch.
+// Exactly one of Inputs and Source must be set.
+type AppendInputsRequest struct {
+	Inputs []map[string]interface{} `json:"inputs"`
+	Source *InputSource             `json:"source"`
+}
+
 // UpdateBatchRequest is the request to update batch settings.
 type UpdateBatchRequest struct {
 	Name        *string `json:"name,omitempty"`
 	Concurrency *int    `json:"concurrency,omitempty"` // Can adjust while paused
 }
 
+// UpdateScheduleRequest changes the priority and schedule windows of a batch.
+type UpdateScheduleRequest struct {
+	Priority *int             `json:"priority,omitempty"`
+	Windows  []ScheduleWindow `json:"windows,omitempty"` // Replaces the windows (nil = unchanged, [] = any time)
+}
+
 // ListBatchFilter defines filtering options for listing batches.
 type ListBatchFilter struct {
-	UserID  string      `json:"user_id,omitempty"`
-	Status  BatchStatus `json:"status,omitempty"`
-	AgentID string      `json:"agent_id,omitempty"`
-	Limit   int         `json:"limit,omitempty"`
-	Offset  int         `json:"offset,omitempty"`
+	UserID  string          `json:"user_id,omitempty"`
+	Status  BatchStatus     `json:"status,omitempty"`
+	AgentID string          `json:"agent_id,omitempty"`
+	Labels  labels.Selector `json:"-"`
+	Limit   int             `json:"limit,omitempty"`
+	Offset  int             `json:"offset,omitempty"`
 }
 
 // ListTaskFilter defines filtering options for listing batch tasks.
 type ListTaskFilter struct {
 	Status   BatchTaskStatus `json:"status,omitempty"`
 	WorkerID string          `json:"worker_id,omitempty"`
+	Variant  string          `json:"variant,omitempty"`
 	Limit    int             `json:"limit,omitempty"`
 	Offset   int             `json:"offset,omitempty"`
 }
@@ -170,6 +307,20 @@ type BatchStats struct {
 	ByWorker    map[string]int `json:"by_worker,omitempty"`    // worker_id -> completed count
 	AvgDuration float64        `json:"avg_duration_ms"`        // Average task duration
 	ErrorTypes  map[string]int `json:"error_types,omitempty"`  // error type -> count
+
+	// Token usage summed over all tasks
+	InputTokens       int64 `json:"input_tokens"`
+	CachedInputTokens int64 `json:"cached_input_tokens"`
+	OutputTokens      int64 `json:"output_tokens"`
+	TotalTokens       int64 `json:"total_tokens"`
+
+	// Result evaluation over evaluated tasks
+	EvalPassed   int     `json:"eval_passed"`
+	EvalFailed   int     `json:"eval_failed"`
+	AvgEvalScore float64 `json:"avg_eval_score"`
+
+	// Completed tasks served from the result cache (excluded from tokens, cost and AvgDuration)
+	CacheHits int `json:"cache_hits"`
 }
 
 // BatchEvent represents an event during batch execution.
@@ -185,6 +336,7 @@ const (
 	EventBatchStarted   = "batch.started"
 	EventBatchProgress  = "batch.progress"
 	EventBatchPaused    = "batch.paused"
+	EventBatchQueued    = "batch.queued"
 	EventBatchResumed   = "batch.resumed"
 	EventBatchCompleted = "batch.completed"
 	EventBatchFailed    = "batch.failed"
@@ -195,6 +347,9 @@ const (
 	EventTaskStarted    = "task.started"
 	EventTaskCompleted  = "task.completed"
 	EventTaskFailed     = "task.failed"
+
+	// Active worker limit changed (adaptive concurrency)
+	EventConcurrencyChanged = "batch.concurrency"
 )
 
 // ProgressData is the payload for batch.progress events.
@@ -272,6 +427,7 @@ type QueueOverview struct {
 	TotalDead      int          `json:"total_dead"`
 	Batches        []BatchQueue `json:"batches"`
 	RedisEnabled   bool         `json:"redis_enabled"`
+	QueueBackend   string       `json:"queue_backend"` // redis or database
 }
 
 // BatchQueue contains queue stats for a single batch.
@@ -286,8 +442,8 @@ type BatchQueue struct {
 	Dead       int         `json:"dead"`
 	Total      int         `json:"total"`
 
-	// Redis queue stats (if Redis enabled)
-	RedisPending    int64 `json:"redis_pending,omitempty"`
-	RedisProcessing int64 `json:"redis_processing,omitempty"`
-	RedisDead       int64 `json:"redis_dead,omitempty"`
+	// Task queue stats (Redis or database queue)
+	QueuePending    int64 `json:"queue_pending,omitempty"`
+	QueueProcessing int64 `json:"queue_processing,omitempty"`
+	QueueDead       int64 `json:"queue_dead,omitempty"`
 }
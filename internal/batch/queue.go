@@ -0,0 +1,185 @@
+package batch
+
+import (
+	"context"
+	"time"
+
+	"github.com/tmalldedede/agentbox/internal/logger"
+)
+
+// Queue backends
+const (
+	QueueBackendRedis    = "redis"
+	QueueBackendDatabase = "database"
+)
+
+const (
+	DefaultClaimTimeout   = 5 * time.Minute  // Claims older than this are requeued
+	queueRecoveryInterval = 30 * time.Second // Claim heartbeat and timeout recovery
+)
+
+// TaskQueue hands out the pending tasks of a batch with visibility timeouts: claimed tasks
+// stay in flight until completed, requeued or moved to the dead letter queue, and go back to
+// pending when their claim is not extended within the claim timeout.
+type TaskQueue interface {
+	Backend() string
+	Enqueue(ctx context.Context, batchID string, tasks []*BatchTask) error
+	Claim(ctx context.Context, batchID, workerID string, limit int) ([]*TaskQueueItem, error)
+	Extend(ctx context.Context, batchID string, taskIDs []string) error // Refresh the claims of tasks still being worked on
+	Complete(ctx context.Context, batchID, taskID string) error
+	Requeue(ctx context.Context, batchID, taskID string, attempts int) error
+	MoveToDead(ctx context.Context, batchID, taskID string, attempts int, errorMsg string) error
+	RetryDead(ctx context.Context, batchID string, taskIDs []string) (int, error)
+	RecoverTimedOut(ctx context.Context, batchID string) (int, error)
+	Stats(ctx context.Context, batchID string) (*QueueStats, error)
+}
+
+// DBQueue implements TaskQueue on the batch task rows of the store, for deployments without
+// Redis: pending rows are the queue and running rows are claimed. Completions, retries and
+// dead letters are recorded on the same rows by the store, so those operations have nothing
+// left to do here.
+type DBQueue struct {
+	store        Store
+	claimTimeout time.Duration
+}
+
+// NewDBQueue creates a database-backed queue.
+func NewDBQueue(store Store, claimTimeout time.Duration) *DBQueue {
+	if claimTimeout <= 0 {
+		claimTimeout = DefaultClaimTimeout
+	}
+	return &DBQueue{store: store, claimTimeout: claimTimeout}
+}
+
+// Backend returns the queue backend name.
+func (q *DBQueue) Backend() string { return QueueBackendDatabase }
+
+// Enqueue is a no-op: created tasks are pending rows already.
+func (q *DBQueue) Enqueue(ctx context.Context, batchID string, tasks []*BatchTask) error {
+	return nil
+}
+
+// Claim atomically claims pending tasks for a worker.
+func (q *DBQueue) Claim(ctx context.Context, batchID, workerID string, limit int) ([]*TaskQueueItem, error) {
+	tasks, err := q.store.ClaimTasks(batchID, workerID, limit)
+	if err != nil || len(tasks) == 0 {
+		return nil, err
+	}
+	items := make([]*TaskQueueItem, len(tasks))
+	for i, t := range tasks {
+		items[i] = &TaskQueueItem{TaskID: t.ID, BatchID: batchID, Index: t.Index, Attempts: t.Attempts}
+	}
+	return items, nil
+}
+
+// Extend refreshes the claim time of tasks still being worked on.
+func (q *DBQueue) Extend(ctx context.Context, batchID string, taskIDs []string) error {
+	return q.store.ExtendClaims(batchID, taskIDs)
+}
+
+// Complete is a no-op: the store records the completed task.
+func (q *DBQueue) Complete(ctx context.Context, batchID, taskID string) error {
+	return nil
+}
+
+// Requeue is a no-op: the store puts the task back to pending.
+func (q *DBQueue) Requeue(ctx context.Context, batchID, taskID string, attempts int) error {
+	return nil
+}
+
+// MoveToDead is a no-op: the store marks the task dead.
+func (q *DBQueue) MoveToDead(ctx context.Context, batchID, taskID string, attempts int, errorMsg string) error {
+	return nil
+}
+
+// RetryDead is a no-op: the store moves the dead tasks back to pending.
+func (q *DBQueue) RetryDead(ctx context.Context, batchID string, taskIDs []string) (int, error) {
+	return 0, nil
+}
+
+// RecoverTimedOut puts tasks whose claim timed out back to pending.
+func (q *DBQueue) RecoverTimedOut(ctx context.Context, batchID string) (int, error) {
+	count, err := q.store.RequeueStaleTasks(batchID, time.Now().Add(-q.claimTimeout))
+	if err == nil && count > 0 {
+		logger.Info("Recovered timed out tasks", "batch_id", batchID, "count", count)
+	}
+	return count, err
+}
+
+// Stats returns current queue statistics for a batch.
+func (q *DBQueue) Stats(ctx context.Context, batchID string) (*QueueStats, error) {
+	stats, err := q.store.GetTaskStats(batchID)
+	if err != nil {
+		return nil, err
+	}
+	return &QueueStats{
+		Pending:    int64(stats.Pending),
+		Processing: int64(stats.Running),
+		Dead:       int64(stats.Dead),
+	}, nil
+}
+
+// hold records tasks claimed by this instance until they are finished; their claims are
+// extended so that only the claims of stopped dispatchers time out.
+func (rb *runningBatch) hold(taskIDs ...string) {
+	rb.heldMu.Lock()
+	defer rb.heldMu.Unlock()
+	if rb.held == nil {
+		rb.held = make(map[string]bool)
+	}
+	for _, id := range taskIDs {
+		rb.held[id] = true
+	}
+}
+
+// release forgets a finished task.
+func (rb *runningBatch) release(taskID string) {
+	rb.heldMu.Lock()
+	delete(rb.held, taskID)
+	rb.heldMu.Unlock()
+}
+
+func (rb *runningBatch) heldTasks() []string {
+	rb.heldMu.Lock()
+	defer rb.heldMu.Unlock()
+	ids := make([]string, 0, len(rb.held))
+	for id := range rb.held {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// runQueueRecovery periodically extends the claims of the tasks held by running batches and
+// requeues the tasks whose claims timed out.
+func (m *Manager) runQueueRecovery() {
+	ticker := time.NewTicker(queueRecoveryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			m.recoverQueue(context.Background())
+		}
+	}
+}
+
+func (m *Manager) recoverQueue(ctx context.Context) {
+	m.mu.RLock()
+	running := make([]*runningBatch, 0, len(m.running))
+	for _, rb := range m.running {
+		running = append(running, rb)
+	}
+	m.mu.RUnlock()
+
+	for _, rb := range running {
+		if err := m.queue.Extend(ctx, rb.batch.ID, rb.heldTasks()); err != nil {
+			logger.Warn("Failed to extend task claims", "batch_id", rb.batch.ID, "error", err)
+			continue
+		}
+		if _, err := m.queue.RecoverTimedOut(ctx, rb.batch.ID); err != nil {
+			logger.Warn("Failed to recover timed out tasks", "batch_id", rb.batch.ID, "error", err)
+		}
+	}
+}
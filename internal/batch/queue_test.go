@@ -0,0 +1,101 @@
+package batch
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmalldedede/agentbox/internal/database"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func newQueueStore(t *testing.T) Store {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: gormlogger.Default.LogMode(gormlogger.Silent)})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	require.NoError(t, db.AutoMigrate(&database.BatchModel{}, &database.BatchTaskModel{}, &database.LabelModel{}))
+
+	prev := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = prev })
+	return NewGormStore()
+}
+
+func TestDBQueue_ClaimAndRecover(t *testing.T) {
+	store := newQueueStore(t)
+	require.NoError(t, store.CreateBatch(&Batch{ID: "b1", Name: "b1", Status: BatchStatusRunning}))
+	tasks := make([]*BatchTask, 3)
+	for i := range tasks {
+		tasks[i] = &BatchTask{ID: fmt.Sprintf("b1-%d", i), BatchID: "b1", Index: i, Status: BatchTaskPending}
+	}
+	require.NoError(t, store.CreateTasks(tasks))
+
+	q := NewDBQueue(store, time.Minute)
+	ctx := context.Background()
+	assert.Equal(t, QueueBackendDatabase, q.Backend())
+	require.NoError(t, q.Enqueue(ctx, "b1", tasks))
+
+	items, err := q.Claim(ctx, "b1", "w", 2)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, "b1-0", items[0].TaskID)
+	assert.Equal(t, "b1-1", items[1].TaskID)
+
+	stats, err := q.Stats(ctx, "b1")
+	require.NoError(t, err)
+	assert.Equal(t, &QueueStats{Pending: 1, Processing: 2}, stats)
+
+	// 未超时的认领不会被回收
+	n, err := q.RecoverTimedOut(ctx, "b1")
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	// 只续期 b1-0，b1-1 的认领超时后回到 pending
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, q.Extend(ctx, "b1", []string{"b1-0"}))
+	n, err = NewDBQueue(store, 20*time.Millisecond).RecoverTimedOut(ctx, "b1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	items, err = q.Claim(ctx, "b1", "w", 10)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, "b1-1", items[0].TaskID)
+	items, err = q.Claim(ctx, "b1", "w", 10)
+	require.NoError(t, err)
+	assert.Empty(t, items)
+}
+
+func TestRunningBatch_Held(t *testing.T) {
+	rb := &runningBatch{}
+	assert.Empty(t, rb.heldTasks())
+
+	rb.hold("t1", "t2")
+	assert.ElementsMatch(t, []string{"t1", "t2"}, rb.heldTasks())
+	rb.release("t1")
+	rb.release("missing")
+	assert.Equal(t, []string{"t2"}, rb.heldTasks())
+}
+
+func TestGormStore_RequeueKeepsThrottleRetries(t *testing.T) {
+	store := newQueueStore(t)
+	require.NoError(t, store.CreateBatch(&Batch{ID: "b1", Name: "b1", Status: BatchStatusRunning}))
+	task := &BatchTask{ID: "b1-0", BatchID: "b1", Status: BatchTaskRunning}
+	require.NoError(t, store.CreateTasks([]*BatchTask{task}))
+
+	task.ThrottleRetries = 2
+	require.NoError(t, store.RequeueTask(task))
+	got, err := store.GetTask("b1", "b1-0")
+	require.NoError(t, err)
+	assert.Equal(t, BatchTaskPending, got.Status)
+	assert.Equal(t, 2, got.ThrottleRetries)
+}
@@ -44,6 +44,9 @@ func NewRedisQueue(cfg config.RedisConfig) (*RedisQueue, error) {
 	}, nil
 }
 
+// Backend returns the queue backend name.
+func (q *RedisQueue) Backend() string { return QueueBackendRedis }
+
 // Redis key helpers
 func keyPending(batchID string) string     { return fmt.Sprintf("batch:%s:pending", batchID) }
 func keyProcessing(batchID string) string  { return fmt.Sprintf("batch:%s:processing", batchID) }
@@ -180,6 +183,43 @@ func (q *RedisQueue) Complete(ctx context.Context, batchID, taskID string) error
 	return err
 }
 
+// Extend refreshes the claim time of processing tasks still being worked on.
+func (q *RedisQueue) Extend(ctx context.Context, batchID string, taskIDs []string) error {
+	if len(taskIDs) == 0 {
+		return nil
+	}
+	held := make(map[string]bool, len(taskIDs))
+	for _, id := range taskIDs {
+		held[id] = true
+	}
+
+	items, err := q.client.ZRange(ctx, keyProcessing(batchID), 0, -1).Result()
+	if err != nil {
+		return err
+	}
+
+	now := float64(time.Now().Unix())
+	pipe := q.client.Pipeline()
+	count := 0
+	for _, item := range items {
+		var task TaskQueueItem
+		if err := json.Unmarshal([]byte(item), &task); err != nil {
+			continue
+		}
+		if held[task.TaskID] {
+			// XX: only update items still in processing
+			pipe.ZAddXX(ctx, keyProcessing(batchID), redis.Z{Score: now, Member: item})
+			count++
+		}
+	}
+	if count == 0 {
+		return nil
+	}
+
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
 // Requeue moves a task from processing back to pending for retry.
 func (q *RedisQueue) Requeue(ctx context.Context, batchID, taskID string, attempts int) error {
 	// Find in processing
@@ -482,28 +522,6 @@ func (q *RedisQueue) Cleanup(ctx context.Context, batchID string) error {
 	return q.client.Del(ctx, keys...).Err()
 }
 
-// StartRecoveryLoop starts a background goroutine to recover timed-out tasks.
-func (q *RedisQueue) StartRecoveryLoop(interval time.Duration, getBatchIDs func() []string) {
-	go func() {
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-q.ctx.Done():
-				return
-			case <-ticker.C:
-				batchIDs := getBatchIDs()
-				for _, batchID := range batchIDs {
-					if _, err := q.RecoverTimedOut(context.Background(), batchID); err != nil {
-						logger.Warn("Failed to recover timed out tasks", "batch_id", batchID, "error", err)
-					}
-				}
-			}
-		}
-	}()
-}
-
 // Close closes the Redis connection.
 func (q *RedisQueue) Close() error {
 	q.cancel()
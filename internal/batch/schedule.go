@@ -0,0 +1,428 @@
+package batch
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/tmalldedede/agentbox/internal/logger"
+)
+
+const (
+	scheduleInterval = 15 * time.Second // Re-evaluation of windows and queued batches
+	maxQueuedBatches = 1000             // Queued batches considered per scheduling pass
+	maxWindows       = 10
+)
+
+// Queue reasons of queued batches
+const (
+	QueueReasonCapacity  = "capacity"  // Waiting for a running batch slot or worker budget
+	QueueReasonWindow    = "window"    // Outside of its schedule windows
+	QueueReasonPreempted = "preempted" // Stopped for a higher-priority batch
+)
+
+// SchedulingPolicy limits the batches running at the same time.
+type SchedulingPolicy struct {
+	MaxBatches   int // Running batches on this instance (0 = unlimited)
+	WorkerBudget int // Workers shared by the running batches of all instances, granted by priority (0 = unlimited)
+}
+
+// SetSchedulingPolicy sets the source of the scheduling policy, read on every scheduling pass.
+func (m *Manager) SetSchedulingPolicy(policy func() *SchedulingPolicy) {
+	m.policy = policy
+}
+
+func (m *Manager) schedulingPolicy() *SchedulingPolicy {
+	if m.policy != nil {
+		if p := m.policy(); p != nil {
+			return p
+		}
+	}
+	return &SchedulingPolicy{MaxBatches: m.maxBatches}
+}
+
+// workerCount returns the workers a batch runs with: Concurrency, split across the
+// variants of an experiment (at least one worker per variant).
+func (b *Batch) workerCount() int {
+	if n := len(b.Template.Variants); n > b.Concurrency {
+		return n
+	}
+	return b.Concurrency
+}
+
+// laneConcurrency returns the workers of each experiment variant (all of them otherwise).
+func (b *Batch) laneConcurrency() int {
+	if n := len(b.Template.Variants); n > 0 {
+		return b.workerCount() / n
+	}
+	return b.workerCount()
+}
+
+// scheduleWindow is a parsed ScheduleWindow.
+type scheduleWindow struct {
+	schedule cron.Schedule
+	duration time.Duration
+}
+
+// parseWindows parses and validates schedule windows.
+func parseWindows(windows []ScheduleWindow) ([]scheduleWindow, error) {
+	if len(windows) > maxWindows {
+		return nil, fmt.Errorf("at most %d schedule windows are allowed", maxWindows)
+	}
+	parsed := make([]scheduleWindow, len(windows))
+	for i, w := range windows {
+		schedule, err := cron.ParseStandard(w.Start)
+		if err != nil {
+			return nil, fmt.Errorf("window %d: invalid start %q: %w", i+1, w.Start, err)
+		}
+		duration, err := time.ParseDuration(w.Duration)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("window %d: invalid duration %q (expected e.g. 8h or 30m)", i+1, w.Duration)
+		}
+		parsed[i] = scheduleWindow{schedule: schedule, duration: duration}
+	}
+	return parsed, nil
+}
+
+// windowState tells whether one of the windows is open at now, and returns when the open
+// windows close or, if none is open, when the next one opens. Without windows a batch may
+// always run (next is zero).
+func windowState(windows []scheduleWindow, now time.Time) (open bool, next time.Time) {
+	for _, w := range windows {
+		// An opening in (now-duration, now] means the window is open
+		start := w.schedule.Next(now.Add(-w.duration))
+		if !start.After(now) {
+			if !open {
+				open, next = true, time.Time{}
+			}
+			for ; !start.After(now); start = w.schedule.Next(start) {
+				if end := start.Add(w.duration); end.After(next) {
+					next = end
+				}
+			}
+			continue
+		}
+		if !open && (next.IsZero() || start.Before(next)) {
+			next = start
+		}
+	}
+	return open || len(windows) == 0, next
+}
+
+// batchWindow returns the window state of a batch (invalid windows count as always open,
+// they are rejected on create and update).
+func batchWindow(b *Batch, now time.Time) (open bool, next time.Time) {
+	windows, err := parseWindows(b.Template.Windows)
+	if err != nil {
+		return true, time.Time{}
+	}
+	return windowState(windows, now)
+}
+
+// scheduleCandidate is a running or queued batch within its windows.
+type scheduleCandidate struct {
+	ID       string
+	Priority int
+	Workers  int
+	Running  bool
+	Remote   bool // Running on another instance: takes part in the worker budget only
+	Since    time.Time
+}
+
+// planSchedule picks the batches to run and their worker shares: by priority, running
+// batches before queued ones of the same priority, then oldest first. Batches that do not
+// make it (running ones included) get no entry. Every instance plans over the batches of
+// all instances and only acts on its own, so remote batches count against the worker
+// budget but not against MaxBatches.
+func planSchedule(candidates []scheduleCandidate, policy *SchedulingPolicy) map[string]int {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if a.Running != b.Running {
+			return a.Running
+		}
+		return a.Since.Before(b.Since)
+	})
+
+	shares := make(map[string]int)
+	remaining := policy.WorkerBudget
+	local := 0
+	for _, c := range candidates {
+		if !c.Remote && policy.MaxBatches > 0 && local >= policy.MaxBatches {
+			continue
+		}
+		share := c.Workers
+		if policy.WorkerBudget > 0 {
+			if remaining <= 0 {
+				break
+			}
+			if share > remaining {
+				share = remaining
+			}
+			remaining -= share
+		}
+		shares[c.ID] = share
+		if !c.Remote {
+			local++
+		}
+	}
+	return shares
+}
+
+// reschedule requests a scheduling pass.
+func (m *Manager) reschedule() {
+	select {
+	case m.scheduleCh <- struct{}{}:
+	default:
+	}
+}
+
+// runScheduler starts queued batches, preempts lower-priority ones and enforces schedule
+// windows, periodically and whenever a batch stops.
+func (m *Manager) runScheduler() {
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-m.scheduleCh:
+		}
+		m.schedule()
+	}
+}
+
+// schedule runs a scheduling pass and returns the errors of the batches that failed to start.
+func (m *Manager) schedule() map[string]error {
+	m.scheduleMu.Lock()
+	defer m.scheduleMu.Unlock()
+
+	queued, _, err := m.store.ListBatches(&ListBatchFilter{Status: BatchStatusQueued, Limit: maxQueuedBatches})
+	if err != nil {
+		logger.Warn("Failed to list queued batches", "error", err)
+		return nil
+	}
+
+	remote, err := m.remoteRunningBatches()
+	if err != nil {
+		logger.Warn("Failed to list running batches", "error", err)
+		return nil
+	}
+
+	now := time.Now()
+	var candidates []scheduleCandidate
+	var closed []string
+	running := make(map[string]*runningBatch)
+	m.mu.RLock()
+	for id, rb := range m.running {
+		running[id] = rb
+		if open, _ := batchWindow(rb.batch, now); !open {
+			closed = append(closed, id)
+			continue
+		}
+		candidates = append(candidates, scheduleCandidate{
+			ID:       id,
+			Priority: rb.batch.Priority,
+			Workers:  rb.batch.workerCount(),
+			Running:  true,
+			Since:    rb.batch.CreatedAt,
+		})
+	}
+	for _, b := range remote {
+		if _, ok := m.running[b.ID]; ok {
+			continue
+		}
+		if open, _ := batchWindow(b, now); !open {
+			continue
+		}
+		candidates = append(candidates, scheduleCandidate{
+			ID:       b.ID,
+			Priority: b.Priority,
+			Workers:  b.workerCount(),
+			Running:  true,
+			Remote:   true,
+			Since:    b.CreatedAt,
+		})
+	}
+	waiting := make(map[string]*Batch)
+	for _, b := range queued {
+		if _, ok := m.running[b.ID]; ok || m.importing[b.ID] {
+			continue
+		}
+		if open, _ := batchWindow(b, now); !open {
+			continue
+		}
+		waiting[b.ID] = b
+		candidates = append(candidates, scheduleCandidate{
+			ID:       b.ID,
+			Priority: b.Priority,
+			Workers:  b.workerCount(),
+			Since:    b.CreatedAt,
+		})
+	}
+	m.mu.RUnlock()
+
+	shares := planSchedule(candidates, m.schedulingPolicy())
+
+	// Free capacity first: batches outside their windows and preempted ones
+	for _, id := range closed {
+		m.suspend(id, QueueReasonWindow)
+	}
+	for id := range running {
+		if _, ok := shares[id]; !ok && !contains(closed, id) {
+			m.suspend(id, QueueReasonPreempted)
+		}
+	}
+
+	errs := make(map[string]error)
+	for _, c := range candidates {
+		share, ok := shares[c.ID]
+		if !ok || c.Remote {
+			continue
+		}
+		if rb := running[c.ID]; rb != nil {
+			m.resize(rb, share)
+			continue
+		}
+		// Claim the batch (other instances schedule the same queue)
+		claimed, err := m.store.TransitionBatch(c.ID, BatchStatusQueued, BatchStatusPending)
+		if err != nil || !claimed {
+			continue
+		}
+		if err := m.run(c.ID, share); err != nil {
+			logger.Warn("Failed to start queued batch", "batch_id", c.ID, "error", err)
+			errs[c.ID] = err
+			// Stay out of the queue until started again
+			if b := waiting[c.ID]; b != nil {
+				b.Status = BatchStatusPaused
+				if err := m.store.UpdateBatch(b); err != nil {
+					logger.Warn("Failed to update batch status", "batch_id", c.ID, "error", err)
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// remoteRunningBatches lists the batches running on other live instances (none without
+// a cluster or a worker budget).
+func (m *Manager) remoteRunningBatches() ([]*Batch, error) {
+	if m.cluster == nil || m.schedulingPolicy().WorkerBudget <= 0 {
+		return nil, nil
+	}
+	batches, _, err := m.store.ListBatches(&ListBatchFilter{Status: BatchStatusRunning, Limit: maxQueuedBatches})
+	if err != nil {
+		return nil, err
+	}
+	remote := batches[:0]
+	for _, b := range batches {
+		if b.InstanceID != m.instanceID() && m.cluster.Alive(b.InstanceID) {
+			remote = append(remote, b)
+		}
+	}
+	return remote, nil
+}
+
+func contains(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// suspend stops a running batch and puts it back in the queue; it resumes automatically
+// once its window opens or capacity is available again.
+func (m *Manager) suspend(batchID, reason string) {
+	m.mu.Lock()
+	rb, ok := m.running[batchID]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+	delete(m.running, batchID)
+	m.mu.Unlock()
+
+	rb.cancel()
+	rb.wg.Wait()
+	for _, w := range rb.workers {
+		m.stopWorker(w)
+	}
+	// Claimed tasks the workers did not finish go back to pending
+	if _, err := m.store.ResetRunningTasks(batchID); err != nil {
+		logger.Warn("Failed to reset running tasks", "batch_id", batchID, "error", err)
+	}
+
+	rb.batch.Status = BatchStatusQueued
+	rb.batch.Workers = nil
+	if err := m.store.UpdateBatch(rb.batch); err != nil {
+		logger.Warn("Failed to update batch status", "batch_id", batchID, "error", err)
+	}
+
+	m.broadcast(batchID, &BatchEvent{
+		Type:      EventBatchQueued,
+		BatchID:   batchID,
+		Timestamp: time.Now(),
+		Data:      map[string]string{"reason": reason},
+	})
+	logger.Info("Suspended batch", "batch_id", batchID, "reason", reason)
+}
+
+// queueState fills the queue reason and next window of a queued batch, and the closing time
+// of the window of a running one.
+func (m *Manager) queueState(b *Batch) {
+	if len(b.Template.Windows) > 0 && (b.Status == BatchStatusQueued || b.Status == BatchStatusRunning) {
+		open, next := batchWindow(b, time.Now())
+		if !next.IsZero() {
+			b.NextWindow = &next
+		}
+		if !open {
+			b.QueueReason = QueueReasonWindow
+			return
+		}
+	}
+	if b.Status == BatchStatusQueued {
+		b.QueueReason = QueueReasonCapacity
+	}
+}
+
+// UpdateSchedule changes the priority and schedule windows of a batch; they take effect
+// on the next scheduling pass (running batches included).
+func (m *Manager) UpdateSchedule(batchID string, req *UpdateScheduleRequest) (*Batch, error) {
+	if req.Windows != nil {
+		if _, err := parseWindows(req.Windows); err != nil {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	b, err := m.store.GetBatch(batchID)
+	if err != nil {
+		m.mu.Unlock()
+		return nil, err
+	}
+	if rb, ok := m.running[batchID]; ok {
+		b = rb.batch
+	}
+	if req.Priority != nil {
+		b.Priority = *req.Priority
+	}
+	if req.Windows != nil {
+		b.Template.Windows = req.Windows
+	}
+	err = m.store.UpdateBatch(b)
+	m.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to update batch: %w", err)
+	}
+
+	m.reschedule()
+	return m.Get(batchID)
+}
@@ -0,0 +1,129 @@
+package batch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWindows(t *testing.T) {
+	_, err := parseWindows([]ScheduleWindow{{Start: "0 22 * * *", Duration: "8h"}, {Start: "CRON_TZ=Asia/Shanghai 0 12 * * 6", Duration: "30m"}})
+	require.NoError(t, err)
+
+	_, err = parseWindows([]ScheduleWindow{{Start: "at night", Duration: "8h"}})
+	assert.ErrorContains(t, err, "invalid start")
+	_, err = parseWindows([]ScheduleWindow{{Start: "0 22 * * *", Duration: "0s"}})
+	assert.ErrorContains(t, err, "invalid duration")
+	_, err = parseWindows(make([]ScheduleWindow, maxWindows+1))
+	assert.ErrorContains(t, err, "at most")
+}
+
+func TestWindowState(t *testing.T) {
+	windows, err := parseWindows([]ScheduleWindow{{Start: "0 22 * * *", Duration: "8h"}})
+	require.NoError(t, err)
+	day := func(hour, min int) time.Time { return time.Date(2026, 3, 10, hour, min, 0, 0, time.Local) }
+
+	// 夜间窗口 22:00–06:00
+	open, next := windowState(windows, day(23, 0))
+	assert.True(t, open)
+	assert.Equal(t, day(30, 0), next) // 次日 06:00 关闭
+
+	open, next = windowState(windows, day(5, 59))
+	assert.True(t, open)
+	assert.Equal(t, day(6, 0), next)
+
+	open, next = windowState(windows, day(6, 0))
+	assert.False(t, open)
+	assert.Equal(t, day(22, 0), next)
+
+	open, next = windowState(windows, day(22, 0))
+	assert.True(t, open)
+	assert.Equal(t, day(30, 0), next)
+
+	// 多个窗口取最早打开的
+	windows, err = parseWindows([]ScheduleWindow{{Start: "0 22 * * *", Duration: "1h"}, {Start: "0 12 * * *", Duration: "1h"}})
+	require.NoError(t, err)
+	open, next = windowState(windows, day(9, 0))
+	assert.False(t, open)
+	assert.Equal(t, day(12, 0), next)
+
+	// 无窗口随时可运行
+	open, next = windowState(nil, day(9, 0))
+	assert.True(t, open)
+	assert.True(t, next.IsZero())
+}
+
+func TestPlanSchedule(t *testing.T) {
+	t0 := time.Now()
+	candidates := func() []scheduleCandidate {
+		return []scheduleCandidate{
+			{ID: "low-running", Priority: 0, Workers: 5, Running: true, Since: t0},
+			{ID: "low-queued", Priority: 0, Workers: 5, Since: t0.Add(-time.Hour)},
+			{ID: "urgent", Priority: 10, Workers: 8, Since: t0.Add(time.Minute)},
+		}
+	}
+
+	// 并行 Batch 上限：紧急 Batch 抢占，同优先级运行中的优先于排队的
+	shares := planSchedule(candidates(), &SchedulingPolicy{MaxBatches: 2})
+	assert.Equal(t, map[string]int{"urgent": 8, "low-running": 5}, shares)
+
+	// Worker 预算按优先级分配，剩余给下一个
+	shares = planSchedule(candidates(), &SchedulingPolicy{WorkerBudget: 10})
+	assert.Equal(t, map[string]int{"urgent": 8, "low-running": 2}, shares)
+
+	shares = planSchedule(candidates(), &SchedulingPolicy{})
+	assert.Len(t, shares, 3)
+}
+
+func TestPlanSchedule_RemoteBatches(t *testing.T) {
+	t0 := time.Now()
+	candidates := []scheduleCandidate{
+		{ID: "remote-high", Priority: 5, Workers: 6, Running: true, Remote: true, Since: t0},
+		{ID: "local-running", Priority: 0, Workers: 5, Running: true, Since: t0},
+		{ID: "local-queued", Priority: 0, Workers: 5, Since: t0.Add(time.Minute)},
+	}
+
+	// 其他实例的 Batch 占用全局 Worker 预算，但不计入本实例的并行上限
+	shares := planSchedule(candidates, &SchedulingPolicy{MaxBatches: 1, WorkerBudget: 10})
+	assert.Equal(t, map[string]int{"remote-high": 6, "local-running": 4}, shares)
+}
+
+func TestRunningBatch_WorkerTarget(t *testing.T) {
+	rb := &runningBatch{batch: &Batch{Concurrency: 6}, lanes: []*Variant{nil}}
+	assert.Equal(t, 6, rb.workerTarget(0))
+	assert.Equal(t, 2, rb.workerTarget(2))
+	assert.Equal(t, 6, rb.workerTarget(10))
+
+	// 实验 Batch：每个变体至少保留一个 Worker
+	rb.lanes = []*Variant{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	assert.Equal(t, 3, rb.workerTarget(1))
+}
+
+func TestBatch_WorkerCount(t *testing.T) {
+	b := &Batch{Concurrency: 6}
+	assert.Equal(t, 6, b.workerCount())
+	assert.Equal(t, 6, b.laneConcurrency())
+
+	// 实验 Batch：Concurrency 在变体间均分
+	b.Template.Variants = []Variant{{Name: "a"}, {Name: "b"}}
+	assert.Equal(t, 6, b.workerCount())
+	assert.Equal(t, 3, b.laneConcurrency())
+
+	// 变体多于 Concurrency 时每个变体一个 Worker
+	b.Concurrency = 2
+	b.Template.Variants = []Variant{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	assert.Equal(t, 3, b.workerCount())
+	assert.Equal(t, 1, b.laneConcurrency())
+}
+
+func TestConcurrencyLimiter_Share(t *testing.T) {
+	l := newConcurrencyLimiter(5, nil)
+	l.setShare(2)
+	assert.Equal(t, 2, l.current())
+	l.setShare(8)
+	assert.Equal(t, 5, l.current())
+	l.setShare(0)
+	assert.Equal(t, 5, l.current())
+}
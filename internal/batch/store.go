@@ -2,6 +2,7 @@ package batch
 
 import (
 	"errors"
+	"time"
 )
 
 // Common errors
@@ -20,6 +21,8 @@ type Store interface {
 	UpdateBatch(batch *Batch) error
 	DeleteBatch(id string) error
 	ListBatches(filter *ListBatchFilter) ([]*Batch, int, error)
+	SetBatchLabels(id string, values map[string]string) error          // Replace batch labels
+	TransitionBatch(id string, from, to BatchStatus) (bool, error)     // Change status only if still `from` (multi-instance claims)
 
 	// BatchTask operations
 	CreateTasks(tasks []*BatchTask) error                                // Bulk create
@@ -28,9 +31,11 @@ type Store interface {
 	ListTasks(batchID string, filter *ListTaskFilter) ([]*BatchTask, int, error)
 	DeleteTasks(batchID string) error                                    // Delete all tasks for a batch
 
-	// Queue operations (atomic) - Legacy, kept for SQLite fallback
-	ClaimPendingTasks(batchID string, limit int) ([]*BatchTask, error)   // Atomically claim pending tasks
-	RequeueTask(task *BatchTask) error                                   // Put task back to pending
+	// Queue operations (atomic), backing the database queue
+	ClaimTasks(batchID, claimer string, limit int) ([]*BatchTask, error)    // Atomically claim pending tasks (only those this claim won)
+	ExtendClaims(batchID string, taskIDs []string) error                    // Refresh the claim time of tasks still in flight
+	RequeueStaleTasks(batchID string, claimedBefore time.Time) (int, error) // Put tasks claimed before the cutoff back to pending
+	RequeueTask(task *BatchTask) error                                      // Put task back to pending
 
 	// Dead letter operations
 	MarkTaskDead(task *BatchTask, reason string) error                   // Move task to dead letter
@@ -46,6 +51,7 @@ type Store interface {
 
 	// Statistics
 	GetTaskStats(batchID string) (*BatchStats, error)
+	GetVariantStats(batchID string) (map[string]*BatchStats, error) // Experiment batches, by variant name
 
 	// Lifecycle
 	Close() error
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/tmalldedede/agentbox/internal/database"
+	"github.com/tmalldedede/agentbox/internal/provider"
 	"gorm.io/gorm"
 )
 
@@ -48,11 +49,15 @@ func (DingtalkConfigModel) TableName() string {
 
 // Save 保存配置
 func (s *Store) Save(cfg *Config, id string, enabled bool) error {
+	secret, err := provider.SealSecret(cfg.AppSecret)
+	if err != nil {
+		return err
+	}
 	model := &DingtalkConfigModel{
 		ID:             id,
 		Name:           cfg.Name,
 		AppKey:         cfg.AppKey,
-		AppSecret:      cfg.AppSecret,
+		AppSecret:      secret,
 		AgentID:        cfg.AgentID,
 		RobotCode:      cfg.RobotCode,
 		DefaultAgentID: cfg.DefaultAgentID,
@@ -72,11 +77,15 @@ func (s *Store) Get(id string) (*Config, bool, error) {
 		}
 		return nil, false, err
 	}
+	secret, err := provider.OpenSecret(model.AppSecret)
+	if err != nil {
+		return nil, false, err
+	}
 
 	return &Config{
 		Name:           model.Name,
 		AppKey:         model.AppKey,
-		AppSecret:      model.AppSecret,
+		AppSecret:      secret,
 		AgentID:        model.AgentID,
 		RobotCode:      model.RobotCode,
 		DefaultAgentID: model.DefaultAgentID,
@@ -89,11 +98,15 @@ func (s *Store) GetEnabledConfig() (*Config, error) {
 	if err := s.db.First(&model, "enabled = ?", true).Error; err != nil {
 		return nil, err
 	}
+	secret, err := provider.OpenSecret(model.AppSecret)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Config{
 		Name:           model.Name,
 		AppKey:         model.AppKey,
-		AppSecret:      model.AppSecret,
+		AppSecret:      secret,
 		AgentID:        model.AgentID,
 		RobotCode:      model.RobotCode,
 		DefaultAgentID: model.DefaultAgentID,
@@ -124,6 +137,22 @@ func (s *Store) List() ([]map[string]interface{}, error) {
 	return result, nil
 }
 
+// RewriteSecrets 遍历所有配置的 AppSecret，fn 返回的值与原值不同时写回（主密钥轮换）
+func (s *Store) RewriteSecrets(fn func(stored string) string) error {
+	var models []*DingtalkConfigModel
+	if err := s.db.Select("id", "app_secret").Find(&models).Error; err != nil {
+		return err
+	}
+	for _, m := range models {
+		if v := fn(m.AppSecret); v != m.AppSecret {
+			if err := s.db.Model(&DingtalkConfigModel{}).Where("id = ?", m.ID).UpdateColumn("app_secret", v).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // Delete 删除配置
 func (s *Store) Delete(id string) error {
 	return s.db.Delete(&DingtalkConfigModel{}, "id = ?", id).Error
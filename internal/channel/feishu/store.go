@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/tmalldedede/agentbox/internal/database"
+	"github.com/tmalldedede/agentbox/internal/provider"
 	"gorm.io/gorm"
 )
 
@@ -13,7 +14,7 @@ type ConfigModel struct {
 	ID                string    `gorm:"primaryKey;size:36"`
 	Name              string    `gorm:"size:100"`
 	AppID             string    `gorm:"size:100;not null"`
-	AppSecret         string    `gorm:"size:200;not null"` // 加密存储
+	AppSecret         string    `gorm:"size:200;not null"` // 加密存储（provider.SealSecret）
 	VerificationToken string    `gorm:"size:100"`
 	EncryptKey        string    `gorm:"size:200"`
 	BotName           string    `gorm:"size:100"`
@@ -48,11 +49,15 @@ func NewStore() *Store {
 
 // SaveConfig 保存配置
 func (s *Store) SaveConfig(id string, cfg *Config) error {
+	secret, err := provider.SealSecret(cfg.AppSecret)
+	if err != nil {
+		return err
+	}
 	model := &ConfigModel{
 		ID:                id,
 		Name:              cfg.Name,
 		AppID:             cfg.AppID,
-		AppSecret:         cfg.AppSecret,
+		AppSecret:         secret,
 		VerificationToken: cfg.VerificationToken,
 		EncryptKey:        cfg.EncryptKey,
 		BotName:           cfg.BotName,
@@ -70,11 +75,15 @@ func (s *Store) GetConfig(id string) (*Config, error) {
 	if err := s.db.First(&model, "id = ?", id).Error; err != nil {
 		return nil, err
 	}
+	secret, err := provider.OpenSecret(model.AppSecret)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Config{
 		Name:              model.Name,
 		AppID:             model.AppID,
-		AppSecret:         model.AppSecret,
+		AppSecret:         secret,
 		VerificationToken: model.VerificationToken,
 		EncryptKey:        model.EncryptKey,
 		BotName:           model.BotName,
@@ -88,11 +97,15 @@ func (s *Store) GetEnabledConfig() (*Config, error) {
 	if err := s.db.Where("enabled = ?", true).First(&model).Error; err != nil {
 		return nil, err
 	}
+	secret, err := provider.OpenSecret(model.AppSecret)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Config{
 		Name:              model.Name,
 		AppID:             model.AppID,
-		AppSecret:         model.AppSecret,
+		AppSecret:         secret,
 		VerificationToken: model.VerificationToken,
 		EncryptKey:        model.EncryptKey,
 		BotName:           model.BotName,
@@ -111,9 +124,32 @@ func (s *Store) ListConfigs() ([]*ConfigModel, error) {
 	if err := s.db.Find(&models).Error; err != nil {
 		return nil, err
 	}
+	for _, m := range models {
+		secret, err := provider.OpenSecret(m.AppSecret)
+		if err != nil {
+			return nil, err
+		}
+		m.AppSecret = secret
+	}
 	return models, nil
 }
 
+// RewriteSecrets 遍历所有配置的 AppSecret，fn 返回的值与原值不同时写回（主密钥轮换）
+func (s *Store) RewriteSecrets(fn func(stored string) string) error {
+	var models []*ConfigModel
+	if err := s.db.Select("id", "app_secret").Find(&models).Error; err != nil {
+		return err
+	}
+	for _, m := range models {
+		if v := fn(m.AppSecret); v != m.AppSecret {
+			if err := s.db.Model(&ConfigModel{}).Where("id = ?", m.ID).UpdateColumn("app_secret", v).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // MessageLog 消息日志
 type MessageLog struct {
 	ID          string    `gorm:"primaryKey;size:100"`
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/tmalldedede/agentbox/internal/database"
+	"github.com/tmalldedede/agentbox/internal/provider"
 	"gorm.io/gorm"
 )
 
@@ -49,12 +50,16 @@ func (WecomConfigModel) TableName() string {
 
 // Save 保存配置
 func (s *Store) Save(cfg *Config, id string, enabled bool) error {
+	secret, err := provider.SealSecret(cfg.Secret)
+	if err != nil {
+		return err
+	}
 	model := &WecomConfigModel{
 		ID:             id,
 		Name:           cfg.Name,
 		CorpID:         cfg.CorpID,
 		AgentID:        cfg.AgentID,
-		Secret:         cfg.Secret,
+		Secret:         secret,
 		Token:          cfg.Token,
 		EncodingAESKey: cfg.EncodingAESKey,
 		DefaultAgentID: cfg.DefaultAgentID,
@@ -74,12 +79,16 @@ func (s *Store) Get(id string) (*Config, bool, error) {
 		}
 		return nil, false, err
 	}
+	secret, err := provider.OpenSecret(model.Secret)
+	if err != nil {
+		return nil, false, err
+	}
 
 	return &Config{
 		Name:           model.Name,
 		CorpID:         model.CorpID,
 		AgentID:        model.AgentID,
-		Secret:         model.Secret,
+		Secret:         secret,
 		Token:          model.Token,
 		EncodingAESKey: model.EncodingAESKey,
 		DefaultAgentID: model.DefaultAgentID,
@@ -92,12 +101,16 @@ func (s *Store) GetEnabledConfig() (*Config, error) {
 	if err := s.db.First(&model, "enabled = ?", true).Error; err != nil {
 		return nil, err
 	}
+	secret, err := provider.OpenSecret(model.Secret)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Config{
 		Name:           model.Name,
 		CorpID:         model.CorpID,
 		AgentID:        model.AgentID,
-		Secret:         model.Secret,
+		Secret:         secret,
 		Token:          model.Token,
 		EncodingAESKey: model.EncodingAESKey,
 		DefaultAgentID: model.DefaultAgentID,
@@ -127,6 +140,22 @@ func (s *Store) List() ([]map[string]interface{}, error) {
 	return result, nil
 }
 
+// RewriteSecrets 遍历所有配置的 Secret，fn 返回的值与原值不同时写回（主密钥轮换）
+func (s *Store) RewriteSecrets(fn func(stored string) string) error {
+	var models []*WecomConfigModel
+	if err := s.db.Select("id", "secret").Find(&models).Error; err != nil {
+		return err
+	}
+	for _, m := range models {
+		if v := fn(m.Secret); v != m.Secret {
+			if err := s.db.Model(&WecomConfigModel{}).Where("id = ?", m.ID).UpdateColumn("secret", v).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // Delete 删除配置
 func (s *Store) Delete(id string) error {
 	return s.db.Delete(&WecomConfigModel{}, "id = ?", id).Error
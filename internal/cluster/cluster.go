@@ -0,0 +1,381 @@
+// Package cluster 提供多实例协调：实例注册与心跳、Leader 选举
+//
+// 多个实例共享同一数据库时，每个实例定期写入心跳并竞争同一个 Leader 租约。
+// 单例后台任务（Cron、GC、文件清理、批量任务恢复、任务接管）只在 Leader 上运行；
+// 超过 InstanceTTL 未心跳的实例被视为已停止，其运行中的任务由 Leader 接管。
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tmalldedede/agentbox/internal/database"
+	"github.com/tmalldedede/agentbox/internal/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var log *slog.Logger
+
+func init() {
+	log = logger.Module("cluster")
+}
+
+// leaderLease Leader 租约名称
+const leaderLease = "leader"
+
+// 默认心跳间隔与实例存活时间
+const (
+	DefaultHeartbeatInterval = 10 * time.Second
+	DefaultInstanceTTL       = 30 * time.Second
+)
+
+// Config 协调器配置
+type Config struct {
+	InstanceID        string        // 实例 ID，为空时使用主机名加随机后缀
+	HeartbeatInterval time.Duration // 心跳与租约续约间隔
+	InstanceTTL       time.Duration // 心跳超时时间，同时作为 Leader 租约时长
+}
+
+// Instance 实例信息
+type Instance struct {
+	ID          string    `json:"id"`
+	Hostname    string    `json:"hostname"`
+	StartedAt   time.Time `json:"started_at"`
+	HeartbeatAt time.Time `json:"heartbeat_at"`
+	Alive       bool      `json:"alive"`  // 心跳未超时
+	Leader      bool      `json:"leader"` // 持有 Leader 租约
+	Self        bool      `json:"self"`   // 当前实例
+}
+
+// singleton 只在 Leader 上运行的周期任务
+type singleton struct {
+	name     string
+	interval time.Duration
+	fn       func(ctx context.Context)
+	kick     chan struct{} // 成为 Leader 时立即触发一次
+}
+
+// Coordinator 多实例协调器
+type Coordinator struct {
+	db        *gorm.DB
+	cfg       Config
+	hostname  string
+	startedAt time.Time
+
+	mu     sync.RWMutex
+	leader bool
+	alive  map[string]bool // 最近一次心跳时存活的实例
+
+	singletons []*singleton
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New 创建协调器
+func New(db *gorm.DB, cfg Config) (*Coordinator, error) {
+	if err := db.AutoMigrate(&database.InstanceModel{}, &database.LeaseModel{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate cluster tables: %w", err)
+	}
+
+	hostname, _ := os.Hostname()
+	if cfg.InstanceID == "" {
+		// 同一主机上的多个进程（或主机名相同的容器）必须是不同的实例
+		prefix := hostname
+		if prefix == "" {
+			prefix = "agentbox"
+		}
+		cfg.InstanceID = prefix + "-" + uuid.New().String()[:8]
+	}
+	if cfg.HeartbeatInterval <= 0 {
+		cfg.HeartbeatInterval = DefaultHeartbeatInterval
+	}
+	if cfg.InstanceTTL <= 0 {
+		cfg.InstanceTTL = DefaultInstanceTTL
+	}
+	// 租约必须在过期前至少续约一次
+	if cfg.InstanceTTL <= cfg.HeartbeatInterval {
+		cfg.InstanceTTL = 3 * cfg.HeartbeatInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Coordinator{
+		db:        db,
+		cfg:       cfg,
+		hostname:  hostname,
+		startedAt: time.Now(),
+		alive:     make(map[string]bool),
+		ctx:       ctx,
+		cancel:    cancel,
+	}, nil
+}
+
+// InstanceID 当前实例 ID
+func (c *Coordinator) InstanceID() string {
+	return c.cfg.InstanceID
+}
+
+// IsLeader 当前实例是否持有 Leader 租约
+func (c *Coordinator) IsLeader() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.leader
+}
+
+// Alive 实例在最近一次心跳检查时是否存活（当前实例始终存活）
+func (c *Coordinator) Alive(instanceID string) bool {
+	if instanceID == c.cfg.InstanceID {
+		return true
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.alive[instanceID]
+}
+
+// Refresh 立即重新读取实例心跳并更新存活实例，返回读取时刻
+//
+// 存活快照最多落后一个心跳间隔；接管任务前调用，避免把刚启动的实例误判为已停止。
+func (c *Coordinator) Refresh() (time.Time, error) {
+	now := time.Now()
+	return now, c.refreshAlive(now)
+}
+
+// RunAsLeader 注册只在 Leader 上运行的周期任务（需在 Start 之前调用）
+//
+// 成为 Leader 时立即执行一次，之后每 interval 执行一次（<= 0 时使用心跳间隔）；非 Leader 时跳过。
+func (c *Coordinator) RunAsLeader(name string, interval time.Duration, fn func(ctx context.Context)) {
+	if interval <= 0 {
+		interval = c.cfg.HeartbeatInterval
+	}
+	c.singletons = append(c.singletons, &singleton{
+		name:     name,
+		interval: interval,
+		fn:       fn,
+		kick:     make(chan struct{}, 1),
+	})
+}
+
+// Start 注册实例并参与 Leader 选举（首次心跳同步完成，返回后 IsLeader 即可用）
+//
+// 首次心跳失败时仍会启动心跳循环，数据库恢复后自动注册并参与选举。
+func (c *Coordinator) Start() {
+	if err := c.tick(); err != nil {
+		log.Error("cluster heartbeat failed", "error", err)
+	}
+
+	c.wg.Add(1)
+	go c.loop()
+	for _, s := range c.singletons {
+		c.wg.Add(1)
+		go c.runSingleton(s)
+	}
+
+	log.Info("cluster coordinator started",
+		"instance_id", c.cfg.InstanceID,
+		"leader", c.IsLeader(),
+		"heartbeat_interval", c.cfg.HeartbeatInterval,
+		"instance_ttl", c.cfg.InstanceTTL)
+}
+
+// Stop 停止心跳，释放 Leader 租约并注销实例，其他实例可立即接替
+func (c *Coordinator) Stop() {
+	c.cancel()
+	c.wg.Wait()
+
+	if c.IsLeader() {
+		if err := c.db.Model(&database.LeaseModel{}).
+			Where("name = ? AND holder = ?", leaderLease, c.cfg.InstanceID).
+			Updates(map[string]interface{}{"expires_at": time.Now(), "updated_at": time.Now()}).Error; err != nil {
+			log.Warn("failed to release leader lease", "error", err)
+		}
+		c.setLeader(false)
+	}
+	if err := c.db.Delete(&database.InstanceModel{}, "id = ?", c.cfg.InstanceID).Error; err != nil {
+		log.Warn("failed to deregister instance", "error", err)
+	}
+	log.Info("cluster coordinator stopped", "instance_id", c.cfg.InstanceID)
+}
+
+// Instances 列出已注册的实例（包含心跳已超时、尚未清理的实例）
+func (c *Coordinator) Instances() ([]*Instance, error) {
+	var models []database.InstanceModel
+	if err := c.db.Find(&models).Error; err != nil {
+		return nil, err
+	}
+	var lease database.LeaseModel
+	leader := ""
+	if err := c.db.Where("name = ?", leaderLease).Limit(1).Find(&lease).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if lease.ExpiresAt.After(now) {
+		leader = lease.Holder
+	}
+
+	instances := make([]*Instance, 0, len(models))
+	for _, m := range models {
+		instances = append(instances, &Instance{
+			ID:          m.ID,
+			Hostname:    m.Hostname,
+			StartedAt:   m.StartedAt,
+			HeartbeatAt: m.HeartbeatAt,
+			Alive:       now.Sub(m.HeartbeatAt) <= c.cfg.InstanceTTL,
+			Leader:      m.ID == leader,
+			Self:        m.ID == c.cfg.InstanceID,
+		})
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].ID < instances[j].ID })
+	return instances, nil
+}
+
+func (c *Coordinator) loop() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.tick(); err != nil {
+				log.Error("cluster heartbeat failed", "error", err)
+			}
+		}
+	}
+}
+
+// tick 写入心跳、刷新存活实例并续约 / 竞争 Leader 租约
+func (c *Coordinator) tick() error {
+	now := time.Now()
+
+	if err := c.heartbeat(now); err != nil {
+		// 无法写入心跳时其他实例会认为本实例已停止，主动放弃 Leader 避免双主
+		c.setLeader(false)
+		return fmt.Errorf("heartbeat: %w", err)
+	}
+
+	if err := c.refreshAlive(now); err != nil {
+		return err
+	}
+
+	leader, err := c.acquire(now)
+	if err != nil {
+		c.setLeader(false)
+		return fmt.Errorf("leader election: %w", err)
+	}
+	c.setLeader(leader)
+	return nil
+}
+
+// refreshAlive 读取心跳未超时的实例
+func (c *Coordinator) refreshAlive(now time.Time) error {
+	var ids []string
+	if err := c.db.Model(&database.InstanceModel{}).
+		Where("heartbeat_at > ?", now.Add(-c.cfg.InstanceTTL)).
+		Pluck("id", &ids).Error; err != nil {
+		return fmt.Errorf("list instances: %w", err)
+	}
+	alive := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		alive[id] = true
+	}
+	c.mu.Lock()
+	c.alive = alive
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Coordinator) heartbeat(now time.Time) error {
+	return c.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"hostname", "started_at", "heartbeat_at"}),
+	}).Create(&database.InstanceModel{
+		ID:          c.cfg.InstanceID,
+		Hostname:    c.hostname,
+		StartedAt:   c.startedAt,
+		HeartbeatAt: now,
+	}).Error
+}
+
+// acquire 续约或抢占 Leader 租约（条件更新保证同一时刻只有一个持有者）
+func (c *Coordinator) acquire(now time.Time) (bool, error) {
+	expires := now.Add(c.cfg.InstanceTTL)
+	result := c.db.Model(&database.LeaseModel{}).
+		Where("name = ? AND (holder = ? OR expires_at < ?)", leaderLease, c.cfg.InstanceID, now).
+		Updates(map[string]interface{}{
+			"holder":     c.cfg.InstanceID,
+			"expires_at": expires,
+			"updated_at": now,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+
+	// 租约不存在时创建（并发创建只有一个成功）
+	result = c.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&database.LeaseModel{
+		Name:      leaderLease,
+		Holder:    c.cfg.InstanceID,
+		ExpiresAt: expires,
+		UpdatedAt: now,
+	})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (c *Coordinator) setLeader(leader bool) {
+	c.mu.Lock()
+	changed := c.leader != leader
+	c.leader = leader
+	c.mu.Unlock()
+	if !changed {
+		return
+	}
+
+	if leader {
+		log.Info("became leader", "instance_id", c.cfg.InstanceID)
+		for _, s := range c.singletons {
+			select {
+			case s.kick <- struct{}{}:
+			default:
+			}
+		}
+	} else {
+		log.Warn("lost leadership", "instance_id", c.cfg.InstanceID)
+	}
+}
+
+func (c *Coordinator) runSingleton(s *singleton) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.kick:
+		}
+		if !c.IsLeader() {
+			continue
+		}
+		log.Debug("running singleton", "name", s.name)
+		s.fn(c.ctx)
+	}
+}
@@ -0,0 +1,110 @@
+package cluster
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmalldedede/agentbox/internal/database"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// setupDB 多个协调器共享的文件数据库（:memory: 每个连接各自独立）
+func setupDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "cluster.db")+"?_busy_timeout=5000"),
+		&gorm.Config{Logger: gormlogger.Default.LogMode(gormlogger.Silent)})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+func newCoordinator(t *testing.T, db *gorm.DB, id string) *Coordinator {
+	t.Helper()
+	c, err := New(db, Config{InstanceID: id, HeartbeatInterval: 20 * time.Millisecond, InstanceTTL: 100 * time.Millisecond})
+	require.NoError(t, err)
+	return c
+}
+
+func TestCoordinator_LeaderElectionAndFailover(t *testing.T) {
+	db := setupDB(t)
+	a := newCoordinator(t, db, "instance-a")
+	b := newCoordinator(t, db, "instance-b")
+
+	var runsA, runsB atomic.Int32
+	a.RunAsLeader("job", time.Hour, func(ctx context.Context) { runsA.Add(1) })
+	b.RunAsLeader("job", time.Hour, func(ctx context.Context) { runsB.Add(1) })
+
+	a.Start()
+	b.Start()
+	defer b.Stop()
+
+	assert.True(t, a.IsLeader())
+	assert.False(t, b.IsLeader())
+	require.Eventually(t, func() bool { return runsA.Load() == 1 }, time.Second, 5*time.Millisecond)
+	assert.Zero(t, runsB.Load(), "singleton only runs on the leader")
+
+	require.Eventually(t, func() bool { return b.Alive("instance-a") }, time.Second, 5*time.Millisecond)
+	instances, err := b.Instances()
+	require.NoError(t, err)
+	require.Len(t, instances, 2)
+	assert.True(t, instances[0].Leader)
+	assert.True(t, instances[1].Self)
+
+	// 正常停止时释放租约，另一实例在下一次心跳接替
+	a.Stop()
+	require.Eventually(t, b.IsLeader, time.Second, 5*time.Millisecond)
+	require.Eventually(t, func() bool { return runsB.Load() == 1 }, time.Second, 5*time.Millisecond)
+	assert.False(t, b.Alive("instance-a"))
+}
+
+func TestCoordinator_TakesOverExpiredLease(t *testing.T) {
+	db := setupDB(t)
+
+	// 已崩溃的实例：心跳与租约都停在过去
+	past := time.Now().Add(-time.Minute)
+	require.NoError(t, db.AutoMigrate(&database.InstanceModel{}, &database.LeaseModel{}))
+	require.NoError(t, db.Create(&database.InstanceModel{ID: "crashed", HeartbeatAt: past}).Error)
+	require.NoError(t, db.Create(&database.LeaseModel{Name: leaderLease, Holder: "crashed", ExpiresAt: past.Add(30 * time.Second)}).Error)
+
+	c := newCoordinator(t, db, "instance-a")
+	c.Start()
+	defer c.Stop()
+
+	assert.True(t, c.IsLeader())
+	assert.False(t, c.Alive("crashed"))
+	assert.False(t, c.Alive(""))
+	assert.True(t, c.Alive("instance-a"))
+
+	// 租约未过期时其他实例无法抢占
+	other := newCoordinator(t, db, "instance-b")
+	leader, err := other.acquire(time.Now())
+	require.NoError(t, err)
+	assert.False(t, leader)
+}
+
+func TestCoordinator_DefaultInstanceIDAndRefresh(t *testing.T) {
+	db := setupDB(t)
+	a := newCoordinator(t, db, "")
+	b := newCoordinator(t, db, "")
+	// 同一主机上的两个进程默认使用不同的实例 ID
+	assert.NotEqual(t, a.InstanceID(), b.InstanceID())
+
+	// 启动后的实例在刷新前不在存活快照中，刷新后可见
+	a.Start()
+	defer a.Stop()
+	assert.False(t, a.Alive(b.InstanceID()))
+	require.NoError(t, b.tick())
+	_, err := a.Refresh()
+	require.NoError(t, err)
+	assert.True(t, a.Alive(b.InstanceID()))
+}
@@ -1,9 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -16,6 +18,103 @@ type Config struct {
 	Files     FilesConfig     `json:"files"`
 	Redis     RedisConfig     `json:"redis"`
 	Runtime   RuntimeConfig   `json:"runtime"`
+	Worker    WorkerConfig    `json:"worker"`
+	Cluster   ClusterConfig   `json:"cluster"`
+	Batch     BatchConfig     `json:"batch"`
+
+	// 执行结果缓存（批量任务 / 任务显式开启时使用）
+	ResultCache ResultCacheConfig `json:"result_cache"`
+
+	// LLM 凭证代理（容器只拿到会话级 token，真实 API Key 由 AgentBox 转发时注入）
+	LLMProxy LLMProxyConfig `json:"llm_proxy"`
+
+	// 加密存储密钥（Provider API Key、渠道 AppSecret、Webhook Secret）的主密钥
+	Encryption EncryptionConfig `json:"encryption"`
+
+	// Provider 健康监控（定期探测、熔断器、探测历史）
+	ProviderHealth ProviderHealthConfig `json:"provider_health"`
+}
+
+// ProviderHealthConfig Provider 健康监控配置
+type ProviderHealthConfig struct {
+	Interval         time.Duration `json:"interval"`          // 探测间隔，0 表示不主动探测（熔断器仍由任务执行结果驱动）
+	FailureThreshold int           `json:"failure_threshold"` // 连续失败多少次后熔断
+	OpenTimeout      time.Duration `json:"open_timeout"`      // 熔断后多久进入半开状态试探
+	HistoryRetention time.Duration `json:"history_retention"` // 探测历史保留时长
+}
+
+// DefaultEncryptionKey 未配置主密钥时使用的默认密钥，仅用于开发
+const DefaultEncryptionKey = "agentbox-default-encryption-key-32b"
+
+// EncryptionConfig 主密钥配置。轮换时将新密钥设为主密钥、旧密钥移入 PreviousKeys，
+// 重新加密所有密文后再移除旧密钥。
+type EncryptionConfig struct {
+	Key          string   `json:"-"`        // 主密钥（用于加密）
+	KeyFile      string   `json:"key_file"` // 密钥文件：第一行为主密钥，其后每行一个旧密钥（# 开头为注释），优先于 Key
+	PreviousKeys []string `json:"-"`        // 仅用于解密的旧密钥
+}
+
+// LoadKeys 返回主密钥与旧密钥（密钥文件优先），均未配置时返回空主密钥
+func (c EncryptionConfig) LoadKeys() (string, []string, error) {
+	primary, previous := c.Key, c.PreviousKeys
+	if c.KeyFile != "" {
+		data, err := os.ReadFile(c.KeyFile)
+		if err != nil {
+			return "", nil, fmt.Errorf("read encryption key file: %w", err)
+		}
+		var keys []string
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			keys = append(keys, line)
+		}
+		if len(keys) == 0 {
+			return "", nil, fmt.Errorf("encryption key file %s contains no key", c.KeyFile)
+		}
+		primary = keys[0]
+		previous = append(keys[1:], previous...)
+	}
+	return primary, previous, nil
+}
+
+// LLMProxyConfig LLM 凭证代理配置（容器需能通过 Server.CallbackURL 访问 AgentBox）
+type LLMProxyConfig struct {
+	Enabled  bool          `json:"enabled"`   // 是否启用，默认关闭（直接注入 API Key）
+	TokenTTL time.Duration `json:"token_ttl"` // 会话 token 的空闲有效期（每次请求顺延）
+}
+
+// ResultCacheConfig 结果缓存配置
+type ResultCacheConfig struct {
+	DefaultTTL time.Duration `json:"default_ttl"` // 未指定 TTL 时的缓存时长
+	MaxTTL     time.Duration `json:"max_ttl"`     // 允许指定的最大 TTL
+}
+
+// BatchConfig 批量任务配置
+type BatchConfig struct {
+	// 按 Provider 的每分钟请求数 / Token 数预算，本实例所有 batch 共享
+	// 格式: "zhipu:rpm=60,tpm=100000;openai:rpm=500"
+	ProviderBudgets string `json:"provider_budgets"`
+
+	// 模型价格（美元 / 百万 Token），覆盖或补充内置价格表，用于 dry-run 成本估算
+	// 格式: "glm-4-plus=0.7/0.7/0.7;my-model=1/0.1/4"（input/cached_input/output，cached_input 可省略）
+	ModelPricing string `json:"model_pricing"`
+}
+
+// ClusterConfig 多实例协调配置（实例注册、心跳与 Leader 选举，共享数据库）
+type ClusterConfig struct {
+	InstanceID        string        `json:"instance_id"`        // 实例 ID，默认使用主机名加随机后缀（每次启动不同）
+	HeartbeatInterval time.Duration `json:"heartbeat_interval"` // 心跳与 Leader 续约间隔
+	InstanceTTL       time.Duration `json:"instance_ttl"`       // 超过该时间未心跳即认为实例已停止，其任务被接管
+}
+
+// WorkerConfig 远程 Worker 节点配置（控制面侧）
+type WorkerConfig struct {
+	Token            string        `json:"token"`             // Worker 认证 token，为空时不接受 Worker 连接
+	LocalCapacity    int           `json:"local_capacity"`    // 本机最大并发会话数：0 不限，-1 表示只在 Worker 上运行
+	LocalLabels      string        `json:"local_labels"`      // 本机节点标签，如 "region=eu,gpu=false"
+	HeartbeatTimeout time.Duration `json:"heartbeat_timeout"` // 超过该时间未收到心跳即认为节点断开
 }
 
 // RuntimeConfig 运行时镜像配置
@@ -33,7 +132,7 @@ type RedisConfig struct {
 	Password        string        `json:"password"`         // 密码
 	DB              int           `json:"db"`               // 数据库编号
 	PoolSize        int           `json:"pool_size"`        // 连接池大小
-	ClaimTimeout    time.Duration `json:"claim_timeout"`    // 任务认领超时（超时后重新入队）
+	ClaimTimeout    time.Duration `json:"claim_timeout"`    // 任务认领超时（超时后重新入队，数据库队列同样使用）
 	RecoverInterval time.Duration `json:"recover_interval"` // 恢复扫描间隔
 }
 
@@ -49,6 +148,18 @@ type FilesConfig struct {
 type ServerConfig struct {
 	Host string `json:"host"`
 	Port int    `json:"port"`
+
+	// CallbackURL 容器内访问 AgentBox 的地址（如任务审批 MCP 端点），
+	// 为空时使用 http://host.docker.internal:<port>（创建容器时映射到宿主机网关）
+	CallbackURL string `json:"callback_url"`
+}
+
+// GetCallbackURL 返回容器内访问 AgentBox 的基础地址
+func (c ServerConfig) GetCallbackURL() string {
+	if c.CallbackURL != "" {
+		return strings.TrimRight(c.CallbackURL, "/")
+	}
+	return fmt.Sprintf("http://host.docker.internal:%d", c.Port)
 }
 
 // ContainerConfig 容器默认配置
@@ -125,6 +236,26 @@ func Default() *Config {
 			HeavyImage:    "ghcr.io/tmalldedede/agentbox-agent:v2",
 			BinaryREImage: "ghcr.io/tmalldedede/agentbox-agent:binary-re",
 		},
+		Worker: WorkerConfig{
+			HeartbeatTimeout: 30 * time.Second,
+		},
+		Cluster: ClusterConfig{
+			HeartbeatInterval: 10 * time.Second,
+			InstanceTTL:       30 * time.Second,
+		},
+		ResultCache: ResultCacheConfig{
+			DefaultTTL: 24 * time.Hour,
+			MaxTTL:     30 * 24 * time.Hour,
+		},
+		LLMProxy: LLMProxyConfig{
+			TokenTTL: 24 * time.Hour,
+		},
+		ProviderHealth: ProviderHealthConfig{
+			Interval:         5 * time.Minute,
+			FailureThreshold: 3,
+			OpenTimeout:      time.Minute,
+			HistoryRetention: 7 * 24 * time.Hour,
+		},
 	}
 }
 
@@ -141,6 +272,9 @@ func Load() *Config {
 			cfg.Server.Port = p
 		}
 	}
+	if v := os.Getenv("AGENTBOX_CALLBACK_URL"); v != "" {
+		cfg.Server.CallbackURL = v
+	}
 	if workspace := os.Getenv("AGENTBOX_WORKSPACE_BASE"); workspace != "" {
 		cfg.Container.WorkspaceBase = workspace
 	}
@@ -233,5 +367,101 @@ func Load() *Config {
 		cfg.Runtime.BinaryREImage = v
 	}
 
+	// 远程 Worker 配置
+	if v := os.Getenv("AGENTBOX_WORKER_TOKEN"); v != "" {
+		cfg.Worker.Token = v
+	}
+	if v := os.Getenv("AGENTBOX_WORKER_LOCAL_CAPACITY"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Worker.LocalCapacity = n
+		}
+	}
+	if v := os.Getenv("AGENTBOX_WORKER_LOCAL_LABELS"); v != "" {
+		cfg.Worker.LocalLabels = v
+	}
+	if v := os.Getenv("AGENTBOX_WORKER_HEARTBEAT_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Worker.HeartbeatTimeout = d
+		}
+	}
+
+	// 多实例协调配置
+	if v := os.Getenv("AGENTBOX_INSTANCE_ID"); v != "" {
+		cfg.Cluster.InstanceID = v
+	}
+	if v := os.Getenv("AGENTBOX_CLUSTER_HEARTBEAT_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Cluster.HeartbeatInterval = d
+		}
+	}
+	if v := os.Getenv("AGENTBOX_CLUSTER_INSTANCE_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Cluster.InstanceTTL = d
+		}
+	}
+
+	// 批量任务配置
+	if v := os.Getenv("AGENTBOX_BATCH_PROVIDER_BUDGETS"); v != "" {
+		cfg.Batch.ProviderBudgets = v
+	}
+	if v := os.Getenv("AGENTBOX_BATCH_MODEL_PRICING"); v != "" {
+		cfg.Batch.ModelPricing = v
+	}
+
+	// 结果缓存配置
+	if v := os.Getenv("AGENTBOX_RESULT_CACHE_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.ResultCache.DefaultTTL = d
+		}
+	}
+	if v := os.Getenv("AGENTBOX_RESULT_CACHE_MAX_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.ResultCache.MaxTTL = d
+		}
+	}
+
+	// LLM 凭证代理配置
+	if v := os.Getenv("AGENTBOX_LLM_PROXY_ENABLED"); v != "" {
+		cfg.LLMProxy.Enabled = v == "true" || v == "1"
+	}
+	if v := os.Getenv("AGENTBOX_LLM_PROXY_TOKEN_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.LLMProxy.TokenTTL = d
+		}
+	}
+
+	// Provider 健康监控配置
+	if v := os.Getenv("AGENTBOX_PROVIDER_HEALTH_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.ProviderHealth.Interval = d
+		}
+	}
+	if v := os.Getenv("AGENTBOX_PROVIDER_HEALTH_FAILURE_THRESHOLD"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			cfg.ProviderHealth.FailureThreshold = n
+		}
+	}
+	if v := os.Getenv("AGENTBOX_PROVIDER_HEALTH_OPEN_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.ProviderHealth.OpenTimeout = d
+		}
+	}
+	if v := os.Getenv("AGENTBOX_PROVIDER_HEALTH_RETENTION"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.ProviderHealth.HistoryRetention = d
+		}
+	}
+
+	// 主密钥配置
+	cfg.Encryption.Key = os.Getenv("AGENTBOX_ENCRYPTION_KEY")
+	cfg.Encryption.KeyFile = os.Getenv("AGENTBOX_ENCRYPTION_KEY_FILE")
+	if v := os.Getenv("AGENTBOX_ENCRYPTION_PREVIOUS_KEYS"); v != "" {
+		for _, k := range strings.Split(v, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				cfg.Encryption.PreviousKeys = append(cfg.Encryption.PreviousKeys, k)
+			}
+		}
+	}
+
 	return cfg
 }
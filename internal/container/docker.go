@@ -74,6 +74,7 @@ func (m *DockerManager) Create(ctx context.Context, config *CreateConfig) (*Cont
 			Resources:   resources,
 			NetworkMode: container.NetworkMode(config.NetworkMode),
 			Privileged:  config.Privileged,
+			ExtraHosts:  []string{HostGatewayMapping},
 		},
 		nil,
 		nil,
@@ -41,6 +41,7 @@ type GarbageCollector struct {
 	stats        GCStats
 	mu           sync.RWMutex
 	logger       *slog.Logger
+	leader       func() bool // 多实例部署时只在 Leader 上执行定时清理，nil 表示总是执行
 }
 
 // NewGarbageCollector 创建垃圾回收器
@@ -58,6 +59,16 @@ func NewGarbageCollector(containerMgr Manager, sessionMgr SessionLister, config
 	}
 }
 
+// SetLeaderCheck 设置 Leader 判断函数（多实例共享 Docker 时避免重复清理）
+func (gc *GarbageCollector) SetLeaderCheck(fn func() bool) {
+	gc.leader = fn
+}
+
+// isLeader 当前实例是否负责定时清理
+func (gc *GarbageCollector) isLeader() bool {
+	return gc.leader == nil || gc.leader()
+}
+
 // Start 启动 GC 后台 goroutine
 func (gc *GarbageCollector) Start() {
 	gc.mu.Lock()
@@ -73,6 +84,9 @@ func (gc *GarbageCollector) Start() {
 
 	// 启动时执行一次清理（Docker 不可用时跳过，不报错）
 	go func() {
+		if !gc.isLeader() {
+			return
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
 		if err := gc.RunOnce(ctx); err != nil {
@@ -293,6 +307,9 @@ func (gc *GarbageCollector) loop() {
 			gc.logger.Info("stopped")
 			return
 		case <-ticker.C:
+			if !gc.isLeader() {
+				continue
+			}
 			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 			if err := gc.RunOnce(ctx); err != nil {
 				gc.logger.Warn("gc scan skipped", "error", err)
@@ -62,6 +62,10 @@ type ExecStream struct {
 	Done   chan struct{}  // 完成信号
 }
 
+// HostGatewayMapping 容器内 host.docker.internal 解析到宿主机（Linux Docker 默认不提供该主机名，
+// 任务审批 MCP 回调与 LLM 代理默认通过它访问 AgentBox）
+const HostGatewayMapping = "host.docker.internal:host-gateway"
+
 // CreateConfig 创建容器配置
 type CreateConfig struct {
 	Name        string            // 容器名称
@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"reflect"
 	"sync"
 	"time"
 
@@ -24,41 +25,47 @@ type JobFunc func(ctx context.Context, job *Job) error
 
 // Job 定时任务
 type Job struct {
-	ID          string            `json:"id"`
-	Name        string            `json:"name"`
-	Schedule    string            `json:"schedule"`     // cron 表达式
-	Enabled     bool              `json:"enabled"`
-	AgentID     string            `json:"agent_id"`     // 关联的 Agent
-	Prompt      string            `json:"prompt"`       // 执行的 prompt
-	Metadata    map[string]string `json:"metadata"`     // 额外数据
-	LastRun     *time.Time        `json:"last_run"`     // 上次执行时间
-	NextRun     *time.Time        `json:"next_run"`     // 下次执行时间
-	LastStatus  string            `json:"last_status"`  // 上次状态: success, failed
-	LastError   string            `json:"last_error"`   // 上次错误信息
-	CreatedAt   time.Time         `json:"created_at"`
-	UpdatedAt   time.Time         `json:"updated_at"`
-
-	entryID     cron.EntryID      // cron 库的 entry ID
+	ID         string                 `json:"id"`
+	Name       string                 `json:"name"`
+	Schedule   string                 `json:"schedule"` // cron 表达式
+	Enabled    bool                   `json:"enabled"`
+	AgentID    string                 `json:"agent_id"`              // 关联的 Agent
+	Prompt     string                 `json:"prompt"`                // 执行的 prompt
+	TemplateID string                 `json:"template_id,omitempty"` // 任务模板（与 prompt 二选一）
+	Params     map[string]interface{} `json:"params,omitempty"`      // 模板参数
+	Metadata   map[string]string      `json:"metadata"`              // 额外数据
+	LastRun    *time.Time             `json:"last_run"`              // 上次执行时间
+	NextRun    *time.Time             `json:"next_run"`              // 下次执行时间
+	LastStatus string                 `json:"last_status"`           // 上次状态: success, failed
+	LastError  string                 `json:"last_error"`            // 上次错误信息
+	CreatedAt  time.Time              `json:"created_at"`
+	UpdatedAt  time.Time              `json:"updated_at"`
+
+	entryID cron.EntryID // cron 库的 entry ID
 }
 
 // CreateJobRequest 创建任务请求
 type CreateJobRequest struct {
-	Name     string            `json:"name" binding:"required"`
-	Schedule string            `json:"schedule" binding:"required"` // cron 表达式
-	AgentID  string            `json:"agent_id" binding:"required"`
-	Prompt   string            `json:"prompt" binding:"required"`
-	Enabled  *bool             `json:"enabled"`
-	Metadata map[string]string `json:"metadata"`
+	Name       string                 `json:"name" binding:"required"`
+	Schedule   string                 `json:"schedule" binding:"required"` // cron 表达式
+	AgentID    string                 `json:"agent_id"`                    // 不使用模板时必填
+	Prompt     string                 `json:"prompt"`                      // 不使用模板时必填
+	TemplateID string                 `json:"template_id"`                 // 任务模板 ID（与 agent_id + prompt 二选一）
+	Params     map[string]interface{} `json:"params"`                      // 模板参数
+	Enabled    *bool                  `json:"enabled"`
+	Metadata   map[string]string      `json:"metadata"`
 }
 
 // UpdateJobRequest 更新任务请求
 type UpdateJobRequest struct {
-	Name     string            `json:"name"`
-	Schedule string            `json:"schedule"`
-	AgentID  string            `json:"agent_id"`
-	Prompt   string            `json:"prompt"`
-	Enabled  *bool             `json:"enabled"`
-	Metadata map[string]string `json:"metadata"`
+	Name       string                 `json:"name"`
+	Schedule   string                 `json:"schedule"`
+	AgentID    string                 `json:"agent_id"`
+	Prompt     string                 `json:"prompt"`
+	TemplateID string                 `json:"template_id"` // 切换为模板（清空 prompt 与 agent_id）
+	Params     map[string]interface{} `json:"params"`
+	Enabled    *bool                  `json:"enabled"`
+	Metadata   map[string]string      `json:"metadata"`
 }
 
 // Store 任务存储接口
@@ -80,6 +87,8 @@ type Manager struct {
 	jobs   map[string]*Job // id -> job
 	mu     sync.RWMutex
 
+	leader func() bool // 多实例部署时只由 Leader 执行定时触发，nil 表示总是执行
+
 	ctx    context.Context
 	cancel context.CancelFunc
 }
@@ -117,6 +126,63 @@ func (m *Manager) Start(ctx context.Context) error {
 	return nil
 }
 
+// SetLeaderCheck 设置 Leader 判断函数（多实例部署时避免每个实例都触发同一任务）
+func (m *Manager) SetLeaderCheck(fn func() bool) {
+	m.leader = fn
+}
+
+// Sync 从存储重新加载启用的任务，使其他实例创建、修改或删除的任务在本实例生效
+//
+// 多实例部署时由 Leader 定期调用。
+func (m *Manager) Sync() error {
+	jobs, err := m.store.ListEnabled()
+	if err != nil {
+		return fmt.Errorf("load jobs: %w", err)
+	}
+
+	enabled := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		enabled[job.ID] = true
+
+		m.mu.RLock()
+		current, ok := m.jobs[job.ID]
+		m.mu.RUnlock()
+		if ok {
+			if sameDefinition(current, job) {
+				continue
+			}
+			m.unscheduleJob(current)
+		}
+		if err := m.scheduleJob(job); err != nil {
+			log.Error("schedule job failed", "id", job.ID, "name", job.Name, "error", err)
+		}
+	}
+
+	m.mu.RLock()
+	var removed []*Job
+	for id, job := range m.jobs {
+		if !enabled[id] {
+			removed = append(removed, job)
+		}
+	}
+	m.mu.RUnlock()
+	for _, job := range removed {
+		m.unscheduleJob(job)
+	}
+	return nil
+}
+
+// sameDefinition 两个任务的调度与执行目标是否一致（忽略执行状态）
+func sameDefinition(a, b *Job) bool {
+	return a.Name == b.Name &&
+		a.Schedule == b.Schedule &&
+		a.AgentID == b.AgentID &&
+		a.Prompt == b.Prompt &&
+		a.TemplateID == b.TemplateID &&
+		reflect.DeepEqual(a.Params, b.Params) &&
+		reflect.DeepEqual(a.Metadata, b.Metadata)
+}
+
 // Stop 停止调度器
 func (m *Manager) Stop() error {
 	if m.cancel != nil {
@@ -136,6 +202,9 @@ func (m *Manager) Create(req *CreateJobRequest) (*Job, error) {
 	if _, err := cron.ParseStandard(req.Schedule); err != nil {
 		return nil, fmt.Errorf("invalid schedule: %w", err)
 	}
+	if err := validateTarget(req.AgentID, req.Prompt, req.TemplateID); err != nil {
+		return nil, err
+	}
 
 	enabled := true
 	if req.Enabled != nil {
@@ -147,9 +216,11 @@ func (m *Manager) Create(req *CreateJobRequest) (*Job, error) {
 		Name:      req.Name,
 		Schedule:  req.Schedule,
 		Enabled:   enabled,
-		AgentID:   req.AgentID,
-		Prompt:    req.Prompt,
-		Metadata:  req.Metadata,
+		AgentID:    req.AgentID,
+		Prompt:     req.Prompt,
+		TemplateID: req.TemplateID,
+		Params:     req.Params,
+		Metadata:   req.Metadata,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
@@ -167,6 +238,20 @@ func (m *Manager) Create(req *CreateJobRequest) (*Job, error) {
 	return job, nil
 }
 
+// validateTarget 校验执行目标：agent_id + prompt 或 template_id 二选一
+func validateTarget(agentID, prompt, templateID string) error {
+	if templateID != "" {
+		if prompt != "" {
+			return fmt.Errorf("template_id and prompt are mutually exclusive")
+		}
+		return nil
+	}
+	if agentID == "" || prompt == "" {
+		return fmt.Errorf("agent_id and prompt are required unless template_id is set")
+	}
+	return nil
+}
+
 // Get 获取任务
 func (m *Manager) Get(id string) (*Job, error) {
 	return m.store.Get(id)
@@ -179,6 +264,10 @@ func (m *Manager) Update(id string, req *UpdateJobRequest) (*Job, error) {
 		return nil, err
 	}
 
+	if req.TemplateID != "" && req.Prompt != "" {
+		return nil, fmt.Errorf("template_id and prompt are mutually exclusive")
+	}
+
 	// 先取消调度
 	m.unscheduleJob(job)
 
@@ -197,6 +286,16 @@ func (m *Manager) Update(id string, req *UpdateJobRequest) (*Job, error) {
 	}
 	if req.Prompt != "" {
 		job.Prompt = req.Prompt
+		job.TemplateID = ""
+		job.Params = nil
+	}
+	if req.TemplateID != "" {
+		job.TemplateID = req.TemplateID
+		job.Prompt = ""
+		job.AgentID = req.AgentID // 模板已绑定 Agent
+	}
+	if req.Params != nil {
+		job.Params = req.Params
 	}
 	if req.Enabled != nil {
 		job.Enabled = *req.Enabled
@@ -250,6 +349,9 @@ func (m *Manager) TriggerNow(id string) error {
 // scheduleJob 调度任务
 func (m *Manager) scheduleJob(job *Job) error {
 	entryID, err := m.cron.AddFunc(job.Schedule, func() {
+		if m.leader != nil && !m.leader() {
+			return
+		}
 		m.runJob(job)
 	})
 	if err != nil {
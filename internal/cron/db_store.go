@@ -25,6 +25,8 @@ type CronJobModel struct {
 	Enabled    bool       `gorm:"default:true"`
 	AgentID    string     `gorm:"size:36;not null"`
 	Prompt     string     `gorm:"type:text"`
+	TemplateID string     `gorm:"size:64"`
+	Params     string     `gorm:"type:text"` // JSON
 	Metadata   string     `gorm:"type:text"` // JSON
 	LastRun    *time.Time
 	NextRun    *time.Time
@@ -117,6 +119,13 @@ func (s *DBStore) toModel(job *Job) *CronJobModel {
 		}
 	}
 
+	params := ""
+	if job.Params != nil {
+		if b, err := json.Marshal(job.Params); err == nil {
+			params = string(b)
+		}
+	}
+
 	return &CronJobModel{
 		ID:         job.ID,
 		Name:       job.Name,
@@ -124,6 +133,8 @@ func (s *DBStore) toModel(job *Job) *CronJobModel {
 		Enabled:    job.Enabled,
 		AgentID:    job.AgentID,
 		Prompt:     job.Prompt,
+		TemplateID: job.TemplateID,
+		Params:     params,
 		Metadata:   metadata,
 		LastRun:    job.LastRun,
 		NextRun:    job.NextRun,
@@ -140,6 +151,10 @@ func (s *DBStore) toJob(model *CronJobModel) *Job {
 	if model.Metadata != "" {
 		json.Unmarshal([]byte(model.Metadata), &metadata)
 	}
+	var params map[string]interface{}
+	if model.Params != "" {
+		json.Unmarshal([]byte(model.Params), &params)
+	}
 
 	return &Job{
 		ID:         model.ID,
@@ -148,6 +163,8 @@ func (s *DBStore) toJob(model *CronJobModel) *Job {
 		Enabled:    model.Enabled,
 		AgentID:    model.AgentID,
 		Prompt:     model.Prompt,
+		TemplateID: model.TemplateID,
+		Params:     params,
 		Metadata:   metadata,
 		LastRun:    model.LastRun,
 		NextRun:    model.NextRun,
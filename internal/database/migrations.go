@@ -18,6 +18,12 @@ func AutoMigrate() error {
 		&SkillModel{},
 		&SessionModel{},
 		&TaskModel{},
+		&WorkflowModel{},
+		&WorkflowRunModel{},
+		&TaskEventModel{},
+		&TaskEventSeqModel{},
+		&TaskApprovalModel{},
+		&TaskTemplateModel{},
 		&ExecutionModel{},
 		&WebhookModel{},
 		&ImageModel{},
@@ -27,6 +33,13 @@ func AutoMigrate() error {
 		&FileModel{},
 		&ChannelSessionModel{},
 		&ChannelMessageModel{},
+		&SearchDocumentModel{},
+		&LabelModel{},
+		&SavedViewModel{},
+		&InstanceModel{},
+		&LeaseModel{},
+		&ResultCacheModel{},
+		&ProviderHealthModel{},
 	}
 
 	for _, model := range models {
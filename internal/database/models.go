@@ -62,6 +62,7 @@ type SessionModel struct {
 	Agent       string     `gorm:"size:64;not null" json:"agent"`
 	Status      string     `gorm:"size:32;not null;index" json:"status"`
 	ContainerID string     `gorm:"size:128" json:"container_id"`
+	NodeID      string     `gorm:"size:128;index" json:"node_id"` // remote worker node, empty for local
 	Workspace   string     `gorm:"size:512" json:"workspace"`
 	Config      string     `gorm:"type:text" json:"config"` // JSON
 	Error       string     `gorm:"type:text" json:"error"`
@@ -89,16 +90,46 @@ type TaskModel struct {
 	TurnCount       int    `gorm:"default:0" json:"turn_count"`
 
 	// Config
-	WebhookURL string `gorm:"size:1024" json:"webhook_url"`
-	Timeout    int    `gorm:"default:0" json:"timeout"`
+	WebhookURL string     `gorm:"size:1024" json:"webhook_url"`
+	Timeout    int        `gorm:"default:0" json:"timeout"`
+	Priority   string     `gorm:"size:16;index;default:'normal'" json:"priority"`
+	RunAt      *time.Time `gorm:"index" json:"run_at"`
+	Deadline   *time.Time `gorm:"index" json:"deadline"`
+
+	// Retry policy and failed attempts
+	RetryJSON    string `gorm:"type:text" json:"retry_json"`    // *agent.RetryPolicy
+	AttemptsJSON string `gorm:"type:text" json:"attempts_json"` // []Attempt
+
+	// Source template
+	TemplateID      string `gorm:"size:64;index" json:"template_id"`
+	TemplateVersion int    `gorm:"default:0" json:"template_version"`
+
+	// Result evaluation
+	EvaluatorsJSON string `gorm:"type:text" json:"evaluators_json"` // []eval.Evaluator
+	EvaluationJSON string `gorm:"type:text" json:"evaluation_json"` // *eval.Report
+
+	// Result cache
+	CacheJSON string `gorm:"type:text" json:"cache_json"` // *resultcache.Policy
+	CacheHit  bool   `gorm:"default:false" json:"cache_hit"`
+
+	// LLM proxy token budget (0 = unlimited)
+	TokenBudget int64 `gorm:"default:0" json:"token_budget"`
 
 	// Runtime state
 	Status       string `gorm:"size:32;not null;index;default:'pending'" json:"status"`
 	SessionID    string `gorm:"size:64;index" json:"session_id"`
 	ThreadID     string `gorm:"size:128" json:"thread_id"`
+	InstanceID   string `gorm:"size:128;index" json:"instance_id"` // Instance executing the task
 	ErrorMessage string `gorm:"type:text" json:"error_message"`
 	ResultJSON   string `gorm:"type:text" json:"result_json"` // *Result
 	MetadataJSON string `gorm:"type:text" json:"metadata_json"` // map[string]string
+	LabelsJSON   string `gorm:"type:text" json:"labels_json"`   // map[string]string (filterable copy in labels)
+
+	// Token usage (aggregated across turns; columns kept for SUM in stats)
+	UsageJSON         string `gorm:"type:text" json:"usage_json"` // *Usage
+	InputTokens       int64  `gorm:"default:0" json:"input_tokens"`
+	CachedInputTokens int64  `gorm:"default:0" json:"cached_input_tokens"`
+	OutputTokens      int64  `gorm:"default:0" json:"output_tokens"`
 
 	// Timestamps
 	QueuedAt    *time.Time `json:"queued_at"`
@@ -110,6 +141,100 @@ func (TaskModel) TableName() string {
 	return "tasks"
 }
 
+// TaskTemplateModel represents a reusable, parameterized task template
+type TaskTemplateModel struct {
+	BaseModel
+	UserID              string `gorm:"size:64;index" json:"user_id"`
+	Name                string `gorm:"size:255;not null" json:"name"`
+	Description         string `gorm:"type:text" json:"description"`
+	AgentID             string `gorm:"size:64;index;not null" json:"agent_id"`
+	Prompt              string `gorm:"type:text;not null" json:"prompt"` // text/template
+	ParametersJSON      string `gorm:"type:text" json:"parameters_json"` // []TemplateParameter
+	RequiredAttachments int    `gorm:"default:0" json:"required_attachments"`
+	Timeout             int    `gorm:"default:0" json:"timeout"`
+	EvaluatorsJSON      string `gorm:"type:text" json:"evaluators_json"` // []eval.Evaluator
+	Version             int    `gorm:"default:1" json:"version"`         // incremented on every update
+}
+
+func (TaskTemplateModel) TableName() string {
+	return "task_templates"
+}
+
+// WorkflowModel represents a workflow (DAG of task steps) definition
+type WorkflowModel struct {
+	BaseModel
+	UserID      string `gorm:"size:64;index" json:"user_id"`
+	Name        string `gorm:"size:255;not null" json:"name"`
+	Description string `gorm:"type:text" json:"description"`
+	StepsJSON   string `gorm:"type:text" json:"steps_json"` // []WorkflowStep
+}
+
+func (WorkflowModel) TableName() string {
+	return "workflows"
+}
+
+// WorkflowRunModel represents a single run of a workflow
+type WorkflowRunModel struct {
+	BaseModel
+	WorkflowID     string     `gorm:"size:64;index;not null" json:"workflow_id"`
+	WorkflowName   string     `gorm:"size:255" json:"workflow_name"`
+	UserID         string     `gorm:"size:64;index" json:"user_id"`
+	Status         string     `gorm:"size:32;not null;index" json:"status"`
+	InputsJSON     string     `gorm:"type:text" json:"inputs_json"`     // map[string]string
+	StepsJSON      string     `gorm:"type:text" json:"steps_json"`      // []StepRun
+	DefinitionJSON string     `gorm:"type:text" json:"definition_json"` // []WorkflowStep snapshot
+	ErrorMessage   string     `gorm:"type:text" json:"error_message"`
+	CompletedAt    *time.Time `json:"completed_at"`
+}
+
+func (WorkflowRunModel) TableName() string {
+	return "workflow_runs"
+}
+
+// TaskEventModel represents a persisted task event (SSE / gateway replay log)
+type TaskEventModel struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	TaskID    string    `gorm:"size:64;not null;uniqueIndex:idx_task_events_task_seq,priority:1" json:"task_id"`
+	Seq       int64     `gorm:"not null;uniqueIndex:idx_task_events_task_seq,priority:2" json:"seq"` // per-task, monotonically increasing
+	Type      string    `gorm:"size:64;not null" json:"type"`
+	DataJSON  string    `gorm:"type:text" json:"data_json"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+func (TaskEventModel) TableName() string {
+	return "task_events"
+}
+
+// TaskEventSeqModel holds the last event sequence number of a task, so numbering stays
+// monotonic after old events are pruned
+type TaskEventSeqModel struct {
+	TaskID string `gorm:"primaryKey;size:64" json:"task_id"`
+	Seq    int64  `gorm:"not null" json:"seq"`
+}
+
+func (TaskEventSeqModel) TableName() string {
+	return "task_event_seqs"
+}
+
+// TaskApprovalModel represents a tool-use approval request raised by a running task
+type TaskApprovalModel struct {
+	ID        string     `gorm:"primaryKey;size:64" json:"id"`
+	TaskID    string     `gorm:"size:64;index;not null" json:"task_id"`
+	UserID    string     `gorm:"size:64;index" json:"user_id"`
+	ToolName  string     `gorm:"size:255;not null" json:"tool_name"`
+	InputJSON string     `gorm:"type:text" json:"input_json"`
+	Status    string     `gorm:"size:32;index;not null" json:"status"` // pending, approved, denied, cancelled
+	Reason    string     `gorm:"type:text" json:"reason"`
+	DecidedBy string     `gorm:"size:64" json:"decided_by"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	CreatedAt time.Time  `gorm:"index" json:"created_at"`
+	DecidedAt *time.Time `json:"decided_at"`
+}
+
+func (TaskApprovalModel) TableName() string {
+	return "task_approvals"
+}
+
 // ExecutionModel represents an execution record in the database
 type ExecutionModel struct {
 	BaseModel
@@ -199,6 +324,7 @@ type BatchModel struct {
 	AgentID          string     `gorm:"size:64;index;not null" json:"agent_id"`
 	TemplateJSON     string     `gorm:"type:text" json:"template_json"`       // JSON
 	Concurrency      int        `gorm:"default:5" json:"concurrency"`
+	Priority         int        `gorm:"default:0" json:"priority"`
 	Status           string     `gorm:"size:32;not null;index" json:"status"`
 	TotalTasks       int        `json:"total_tasks"`
 	Completed        int        `json:"completed"`
@@ -206,6 +332,8 @@ type BatchModel struct {
 	Dead             int        `json:"dead"`
 	WorkersJSON      string     `gorm:"type:text" json:"workers_json"`        // JSON
 	ErrorSummaryJSON string     `gorm:"type:text" json:"error_summary_json"`  // JSON
+	LabelsJSON       string     `gorm:"type:text" json:"labels_json"`         // map[string]string (filterable copy in labels)
+	InstanceID       string     `gorm:"size:128;index" json:"instance_id"`    // Instance running the batch
 	StartedAt        *time.Time `json:"started_at"`
 	CompletedAt      *time.Time `json:"completed_at"`
 }
@@ -220,6 +348,7 @@ type BatchTaskModel struct {
 	BatchID    string     `gorm:"size:64;index;not null" json:"batch_id"`
 	TaskIndex  int        `gorm:"index" json:"task_index"`
 	InputJSON  string     `gorm:"type:text" json:"input_json"`      // JSON
+	Variant    string     `gorm:"size:64;index" json:"variant"`
 	Prompt     string     `gorm:"type:text" json:"prompt"`
 	Status     string     `gorm:"size:32;not null;index" json:"status"`
 	WorkerID   string     `gorm:"size:64" json:"worker_id"`
@@ -232,6 +361,22 @@ type BatchTaskModel struct {
 	DeadReason string     `gorm:"size:512" json:"dead_reason"`
 	StartedAt  *time.Time `json:"started_at"`
 	DurationMs int64      `json:"duration_ms"`
+
+	// Throttled requeues of adaptive batches (not counted in Attempts)
+	ThrottleRetries int `gorm:"default:0" json:"throttle_retries"`
+
+	// Token usage
+	InputTokens       int64 `gorm:"default:0" json:"input_tokens"`
+	CachedInputTokens int64 `gorm:"default:0" json:"cached_input_tokens"`
+	OutputTokens      int64 `gorm:"default:0" json:"output_tokens"`
+
+	// Result evaluation
+	EvalStatus     string  `gorm:"size:16;index" json:"eval_status"` // "" (not evaluated) | passed | failed
+	EvalScore      float64 `gorm:"default:0" json:"eval_score"`
+	EvaluationJSON string  `gorm:"type:text" json:"evaluation_json"` // *eval.Report
+
+	// Result served from the result cache (no tokens used)
+	CacheHit bool `gorm:"default:false;index" json:"cache_hit"`
 }
 
 func (BatchTaskModel) TableName() string {
@@ -342,3 +487,108 @@ type ChannelMessageModel struct {
 func (ChannelMessageModel) TableName() string {
 	return "channel_messages"
 }
+
+// SearchDocumentModel 全文检索文档（任务 prompt、轮次 prompt / 结果、通道消息）
+//
+// SQLite 下由 FTS5 虚拟表 search_documents_fts 索引 content，PostgreSQL 下使用 GIN 表达式索引。
+type SearchDocumentModel struct {
+	ID        string    `gorm:"primaryKey;size:192" json:"id"` // {kind}:{ref_id}
+	Kind      string    `gorm:"size:16;index" json:"kind"`     // task, turn, result, message
+	TaskID    string    `gorm:"size:64;index" json:"task_id"`
+	TurnID    string    `gorm:"size:64" json:"turn_id"`
+	UserID    string    `gorm:"size:64;index" json:"user_id"` // 任务归属用户（消息取关联任务的用户）
+	AgentID   string    `gorm:"size:64;index" json:"agent_id"`
+	Status    string    `gorm:"size:32;index" json:"status"` // 任务状态
+	Content   string    `gorm:"type:text" json:"content"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	FTSRowID  int64     `gorm:"column:fts_rowid;not null;default:0" json:"-"` // SQLite：FTS5 表中对应行的 rowid（按 rowid 删除）
+}
+
+func (SearchDocumentModel) TableName() string {
+	return "search_documents"
+}
+
+// LabelModel 任务 / 批量任务的标签（key=value），用于标签选择器过滤与按标签统计
+type LabelModel struct {
+	ID           uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	ResourceType string `gorm:"size:16;not null;index:idx_labels_selector,priority:1;uniqueIndex:idx_labels_resource,priority:1" json:"resource_type"` // task, batch
+	Key          string `gorm:"size:63;not null;index:idx_labels_selector,priority:2;uniqueIndex:idx_labels_resource,priority:3" json:"key"`
+	Value        string `gorm:"size:255;index:idx_labels_selector,priority:3" json:"value"`
+	ResourceID   string `gorm:"size:64;not null;index:idx_labels_selector,priority:4;uniqueIndex:idx_labels_resource,priority:2" json:"resource_id"`
+}
+
+func (LabelModel) TableName() string {
+	return "labels"
+}
+
+// SavedViewModel 用户保存的列表视图（一组过滤条件）
+type SavedViewModel struct {
+	BaseModel
+	UserID     string `gorm:"size:64;index;not null" json:"user_id"`
+	Name       string `gorm:"size:255;not null" json:"name"`
+	Resource   string `gorm:"size:16;not null" json:"resource"` // tasks, batches
+	FilterJSON string `gorm:"type:text" json:"filter_json"`
+}
+
+func (SavedViewModel) TableName() string {
+	return "saved_views"
+}
+
+// InstanceModel represents a running server instance sharing this database
+type InstanceModel struct {
+	ID          string    `gorm:"primaryKey;size:128" json:"id"`
+	Hostname    string    `gorm:"size:255" json:"hostname"`
+	StartedAt   time.Time `json:"started_at"`
+	HeartbeatAt time.Time `gorm:"index" json:"heartbeat_at"`
+}
+
+func (InstanceModel) TableName() string {
+	return "instances"
+}
+
+// LeaseModel represents a named lease held by one instance (leader election)
+type LeaseModel struct {
+	Name      string    `gorm:"primaryKey;size:64" json:"name"`
+	Holder    string    `gorm:"size:128" json:"holder"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (LeaseModel) TableName() string {
+	return "leases"
+}
+
+// ResultCacheModel represents a cached agent result keyed by a hash of config, prompt and inputs
+type ResultCacheModel struct {
+	Key               string    `gorm:"column:cache_key;primaryKey;size:64" json:"key"`
+	AgentID           string    `gorm:"size:64;index" json:"agent_id"`
+	Result            string    `gorm:"type:text" json:"result"`
+	InputTokens       int64     `gorm:"default:0" json:"input_tokens"`
+	CachedInputTokens int64     `gorm:"default:0" json:"cached_input_tokens"`
+	OutputTokens      int64     `gorm:"default:0" json:"output_tokens"`
+	DurationMs        int64     `gorm:"default:0" json:"duration_ms"`
+	Source            string    `gorm:"size:128" json:"source"` // batch:<id> or task:<id>
+	Hits              int64     `gorm:"default:0" json:"hits"`
+	CreatedAt         time.Time `json:"created_at"`
+	ExpiresAt         time.Time `gorm:"index" json:"expires_at"`
+}
+
+func (ResultCacheModel) TableName() string {
+	return "result_cache"
+}
+
+// ProviderHealthModel represents one health probe of a provider key (the provider's own key or an auth profile)
+type ProviderHealthModel struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	ProviderID string    `gorm:"size:64;index:idx_provider_health_target" json:"provider_id"`
+	ProfileID  string    `gorm:"size:64;index:idx_provider_health_target" json:"profile_id"` // empty for the provider's own key
+	Healthy    bool      `json:"healthy"`
+	StatusCode int       `json:"status_code"`
+	LatencyMs  int64     `json:"latency_ms"`
+	Error      string    `gorm:"size:512" json:"error"`
+	CheckedAt  time.Time `gorm:"index" json:"checked_at"`
+}
+
+func (ProviderHealthModel) TableName() string {
+	return "provider_health"
+}
@@ -235,6 +235,11 @@ func (r *WebhookRepository) Update(model *WebhookModel) error {
 	return r.db.Save(model).Error
 }
 
+// UpdateSecret replaces a webhook's stored secret without touching updated_at
+func (r *WebhookRepository) UpdateSecret(id, secret string) error {
+	return r.db.Model(&WebhookModel{}).Where("id = ?", id).UpdateColumn("secret", secret).Error
+}
+
 // Delete deletes a webhook
 func (r *WebhookRepository) Delete(id string) error {
 	return r.db.Delete(&WebhookModel{}, "id = ?", id).Error
@@ -284,12 +289,12 @@ func (r *BatchRepository) Get(id string) (*BatchModel, error) {
 	return &model, err
 }
 
-// List retrieves batches with optional filters
-func (r *BatchRepository) List(status string, agentID string, userID string, limit, offset int) ([]BatchModel, int64, error) {
+// List retrieves batches with optional filters; scopes add extra conditions (e.g. label selectors)
+func (r *BatchRepository) List(status string, agentID string, userID string, limit, offset int, scopes ...func(*gorm.DB) *gorm.DB) ([]BatchModel, int64, error) {
 	var models []BatchModel
 	var total int64
 
-	query := r.db.Model(&BatchModel{})
+	query := r.db.Model(&BatchModel{}).Scopes(scopes...)
 	if status != "" {
 		query = query.Where("status = ?", status)
 	}
@@ -322,10 +327,19 @@ func (r *BatchRepository) ListByStatus(status string) ([]BatchModel, error) {
 	return models, err
 }
 
-// Update updates a batch
+// UpdateStatusIf changes the status of a batch only if it still has the expected one.
+// Returns false when another instance changed it first.
+func (r *BatchRepository) UpdateStatusIf(id, from, to string) (bool, error) {
+	result := r.db.Model(&BatchModel{}).
+		Where("id = ? AND status = ?", id, from).
+		Updates(map[string]interface{}{"status": to, "updated_at": time.Now()})
+	return result.RowsAffected > 0, result.Error
+}
+
+// Update updates a batch (labels are changed separately and never overwritten here)
 func (r *BatchRepository) Update(model *BatchModel) error {
 	model.UpdatedAt = time.Now()
-	return r.db.Save(model).Error
+	return r.db.Omit("labels_json").Save(model).Error
 }
 
 // UpdateCounters atomically updates completed/failed/dead counters
@@ -402,7 +416,7 @@ func (r *BatchTaskRepository) GetByBatchAndID(batchID, taskID string) (*BatchTas
 }
 
 // List retrieves tasks for a batch with optional filters
-func (r *BatchTaskRepository) List(batchID, status, workerID string, limit, offset int) ([]BatchTaskModel, int64, error) {
+func (r *BatchTaskRepository) List(batchID, status, workerID, variant string, limit, offset int) ([]BatchTaskModel, int64, error) {
 	var models []BatchTaskModel
 	var total int64
 
@@ -413,6 +427,9 @@ func (r *BatchTaskRepository) List(batchID, status, workerID string, limit, offs
 	if workerID != "" {
 		query = query.Where("worker_id = ?", workerID)
 	}
+	if variant != "" {
+		query = query.Where("variant = ?", variant)
+	}
 
 	// Count total
 	if err := query.Count(&total).Error; err != nil {
@@ -527,65 +544,158 @@ func (r *BatchTaskRepository) GetStats(batchID string) (map[string]int64, error)
 	return stats, nil
 }
 
-// DeleteByBatch deletes all tasks for a batch
-func (r *BatchTaskRepository) DeleteByBatch(batchID string) error {
-	return r.db.Where("batch_id = ?", batchID).Delete(&BatchTaskModel{}).Error
+// GetUsage returns the summed token usage of all tasks in a batch
+func (r *BatchTaskRepository) GetUsage(batchID string) (input, cachedInput, output int64, err error) {
+	var result struct {
+		InputTokens       int64
+		CachedInputTokens int64
+		OutputTokens      int64
+	}
+	err = r.db.Model(&BatchTaskModel{}).
+		Select("COALESCE(SUM(input_tokens), 0) as input_tokens, COALESCE(SUM(cached_input_tokens), 0) as cached_input_tokens, COALESCE(SUM(output_tokens), 0) as output_tokens").
+		Where("batch_id = ?", batchID).
+		Scan(&result).Error
+	return result.InputTokens, result.CachedInputTokens, result.OutputTokens, err
+}
+
+// BatchVariantStats is the task outcome, usage and evaluation summary of one variant and status
+type BatchVariantStats struct {
+	Variant           string
+	Status            string
+	Count             int64
+	DurationMs        int64 // Summed
+	InputTokens       int64
+	CachedInputTokens int64
+	OutputTokens      int64
+	EvalPassed        int64
+	EvalFailed        int64
+	EvalScore         float64 // Summed over evaluated tasks
+	CacheHits         int64
+	CacheHitDuration  int64 // Summed duration of cache hits
+}
+
+// GetVariantStats returns the task stats of a batch grouped by experiment variant and status
+func (r *BatchTaskRepository) GetVariantStats(batchID string) ([]BatchVariantStats, error) {
+	var results []BatchVariantStats
+	err := r.db.Model(&BatchTaskModel{}).
+		Select("variant, status, COUNT(*) as count, "+
+			"COALESCE(SUM(duration_ms), 0) as duration_ms, "+
+			"COALESCE(SUM(input_tokens), 0) as input_tokens, "+
+			"COALESCE(SUM(cached_input_tokens), 0) as cached_input_tokens, "+
+			"COALESCE(SUM(output_tokens), 0) as output_tokens, "+
+			"COALESCE(SUM(CASE WHEN eval_status = 'passed' THEN 1 ELSE 0 END), 0) as eval_passed, "+
+			"COALESCE(SUM(CASE WHEN eval_status = 'failed' THEN 1 ELSE 0 END), 0) as eval_failed, "+
+			"COALESCE(SUM(CASE WHEN eval_status <> '' THEN eval_score ELSE 0 END), 0) as eval_score, "+
+			"COALESCE(SUM(CASE WHEN cache_hit = ? THEN 1 ELSE 0 END), 0) as cache_hits, "+
+			"COALESCE(SUM(CASE WHEN cache_hit = ? THEN duration_ms ELSE 0 END), 0) as cache_hit_duration", true, true).
+		Where("batch_id = ?", batchID).
+		Group("variant, status").
+		Scan(&results).Error
+	return results, err
 }
 
-// ClaimPending claims pending tasks for processing (SQLite-only mode)
-// Uses transaction to prevent race conditions between workers.
-func (r *BatchTaskRepository) ClaimPending(batchID string, limit int) ([]BatchTaskModel, error) {
-	var tasks []BatchTaskModel
-	now := time.Now()
-
-	// Use transaction for atomicity
-	err := r.db.Transaction(func(tx *gorm.DB) error {
-		// Find and lock pending tasks
-		if err := tx.Where("batch_id = ? AND status = ?", batchID, "pending").
-			Order("task_index ASC").
-			Limit(limit).
-			Find(&tasks).Error; err != nil {
-			return err
-		}
-
-		if len(tasks) == 0 {
-			return nil
-		}
+// GetAvgDuration returns the mean execution duration (ms) of the completed tasks in a batch,
+// excluding cache hits
+func (r *BatchTaskRepository) GetAvgDuration(batchID string) (float64, error) {
+	var result struct {
+		AvgDuration float64
+	}
+	err := r.db.Model(&BatchTaskModel{}).
+		Select("COALESCE(AVG(duration_ms), 0) as avg_duration").
+		Where("batch_id = ? AND status = ? AND duration_ms > 0 AND cache_hit = ?", batchID, "completed", false).
+		Scan(&result).Error
+	return result.AvgDuration, err
+}
 
-		// Update them to running atomically
-		taskIDs := make([]string, len(tasks))
-		for i, t := range tasks {
-			taskIDs[i] = t.ID
-		}
+// CountCacheHits returns the number of tasks in a batch served from the result cache
+func (r *BatchTaskRepository) CountCacheHits(batchID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&BatchTaskModel{}).
+		Where("batch_id = ? AND cache_hit = ?", batchID, true).
+		Count(&count).Error
+	return count, err
+}
 
-		if err := tx.Model(&BatchTaskModel{}).
-			Where("id IN ? AND status = ?", taskIDs, "pending"). // 再次检查状态防止竞争
-			Updates(map[string]interface{}{
-				"status":     "running",
-				"claimed_at": now,
-				"started_at": now,
-				"updated_at": now,
-			}).Error; err != nil {
-			return err
-		}
+// GetEvalStats returns the evaluation outcome counts and mean score of the evaluated tasks in a batch
+func (r *BatchTaskRepository) GetEvalStats(batchID string) (passed, failed int64, avgScore float64, err error) {
+	var result struct {
+		Passed   int64
+		Failed   int64
+		AvgScore float64
+	}
+	err = r.db.Model(&BatchTaskModel{}).
+		Select("COALESCE(SUM(CASE WHEN eval_status = 'passed' THEN 1 ELSE 0 END), 0) as passed, COALESCE(SUM(CASE WHEN eval_status = 'failed' THEN 1 ELSE 0 END), 0) as failed, COALESCE(AVG(eval_score), 0) as avg_score").
+		Where("batch_id = ? AND eval_status <> ''", batchID).
+		Scan(&result).Error
+	return result.Passed, result.Failed, result.AvgScore, err
+}
 
-		return nil
-	})
+// DeleteByBatch deletes all tasks for a batch
+func (r *BatchTaskRepository) DeleteByBatch(batchID string) error {
+	return r.db.Where("batch_id = ?", batchID).Delete(&BatchTaskModel{}).Error
+}
 
-	if err != nil {
+// ClaimPending claims pending tasks for processing under a claim token unique to the caller.
+// Only the tasks this claim moved to running are returned, so concurrent claimers (workers or
+// instances) never get the same task.
+func (r *BatchTaskRepository) ClaimPending(batchID, token string, limit int) ([]BatchTaskModel, error) {
+	var taskIDs []string
+	if err := r.db.Model(&BatchTaskModel{}).
+		Where("batch_id = ? AND status = ?", batchID, "pending").
+		Order("task_index ASC").
+		Limit(limit).
+		Pluck("id", &taskIDs).Error; err != nil {
 		return nil, err
 	}
+	if len(taskIDs) == 0 {
+		return nil, nil
+	}
 
-	if len(tasks) == 0 {
+	now := time.Now()
+	result := r.db.Model(&BatchTaskModel{}).
+		Where("id IN ? AND status = ?", taskIDs, "pending"). // 再次检查状态防止竞争
+		Updates(map[string]interface{}{
+			"status":     "running",
+			"claimed_at": now,
+			"claimed_by": token,
+			"started_at": now,
+			"updated_at": now,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
 		return nil, nil
 	}
 
-	// Update in-memory objects
-	for i := range tasks {
-		tasks[i].Status = "running"
-		tasks[i].ClaimedAt = &now
-		tasks[i].StartedAt = &now
+	var tasks []BatchTaskModel
+	err := r.db.Where("id IN ? AND status = ? AND claimed_by = ?", taskIDs, "running", token).
+		Order("task_index ASC").
+		Find(&tasks).Error
+	return tasks, err
+}
+
+// ExtendClaims refreshes the claim time of running tasks (visibility heartbeat)
+func (r *BatchTaskRepository) ExtendClaims(batchID string, taskIDs []string) error {
+	if len(taskIDs) == 0 {
+		return nil
 	}
+	return r.db.Model(&BatchTaskModel{}).
+		Where("batch_id = ? AND id IN ? AND status = ?", batchID, taskIDs, "running").
+		UpdateColumn("claimed_at", time.Now()).Error
+}
 
-	return tasks, nil
+// RequeueStale puts running tasks claimed before the cutoff back to pending (attempts are kept)
+func (r *BatchTaskRepository) RequeueStale(batchID string, claimedBefore time.Time) (int64, error) {
+	result := r.db.Model(&BatchTaskModel{}).
+		Where("batch_id = ? AND status = ? AND claimed_at < ?", batchID, "running", claimedBefore).
+		Updates(map[string]interface{}{
+			"status":     "pending",
+			"worker_id":  "",
+			"started_at": nil,
+			"claimed_at": nil,
+			"claimed_by": "",
+			"updated_at": time.Now(),
+		})
+	return result.RowsAffected, result.Error
 }
@@ -88,6 +88,10 @@ type PermissionConfig struct {
 	Tools           []string `json:"tools,omitempty"`
 	SkipAll         bool     `json:"skip_all,omitempty"`
 
+	// PermissionPromptTool 处理权限请求的 MCP 工具（--permission-prompt-tool），
+	// 设置后不再跳过权限检查，由该工具决定是否允许每次工具调用
+	PermissionPromptTool string `json:"permission_prompt_tool,omitempty"`
+
 	// Codex
 	SandboxMode    string `json:"sandbox_mode,omitempty"`
 	ApprovalPolicy string `json:"approval_policy,omitempty"`
@@ -115,6 +119,10 @@ type MCPServerConfig struct {
 	Command string            `json:"command"`
 	Args    []string          `json:"args,omitempty"`
 	Env     map[string]string `json:"env,omitempty"`
+
+	// HTTP 传输（URL 非空时忽略 Command/Args/Env）
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
 }
 
 // DebugConfig 调试配置
@@ -184,8 +184,13 @@ func (a *Adapter) PrepareExecWithConfig(req *engine.ExecOptions, cfg *engine.Age
 		args = append(args, "--model", cfg.Model.Name)
 	}
 
-	// 权限模式
-	if cfg.Permissions.SkipAll {
+	// 权限模式（配置了权限审批工具时不跳过权限检查）
+	if cfg.Permissions.PermissionPromptTool != "" {
+		if cfg.Permissions.Mode != "" && cfg.Permissions.Mode != engine.PermissionModeBypassPermissions {
+			args = append(args, "--permission-mode", cfg.Permissions.Mode)
+		}
+		args = append(args, "--permission-prompt-tool", cfg.Permissions.PermissionPromptTool)
+	} else if cfg.Permissions.SkipAll {
 		args = append(args, "--dangerously-skip-permissions")
 	} else if cfg.Permissions.Mode != "" {
 		args = append(args, "--permission-mode", cfg.Permissions.Mode)
@@ -224,6 +229,15 @@ func (a *Adapter) PrepareExecWithConfig(req *engine.ExecOptions, cfg *engine.Age
 			serverConfig := map[string]interface{}{
 				"command": server.Command,
 			}
+			if server.URL != "" {
+				serverConfig = map[string]interface{}{
+					"type": "http",
+					"url":  server.URL,
+				}
+				if len(server.Headers) > 0 {
+					serverConfig["headers"] = server.Headers
+				}
+			}
 			if len(server.Args) > 0 {
 				serverConfig["args"] = server.Args
 			}
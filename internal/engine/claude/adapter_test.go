@@ -143,3 +143,32 @@ func TestParseJSONLOutput_ErrorMaxTurns(t *testing.T) {
 	assert.Equal(t, 200, result.Usage.InputTokens)
 	assert.Equal(t, 50, result.Usage.OutputTokens)
 }
+
+func TestPrepareExecWithConfig_PermissionPromptTool(t *testing.T) {
+	adapter := New()
+	cfg := &engine.AgentConfig{
+		Permissions: engine.PermissionConfig{
+			SkipAll:              true,
+			PermissionPromptTool: "mcp__agentbox__approval_prompt",
+		},
+		MCPServers: []engine.MCPServerConfig{
+			{Name: "agentbox", URL: "http://host.docker.internal:18080/api/v1/approvals/mcp/tok"},
+		},
+	}
+
+	args := adapter.PrepareExecWithConfig(&engine.ExecOptions{Prompt: "Hello"}, cfg)
+
+	assert.NotContains(t, args, "--dangerously-skip-permissions")
+	assert.Contains(t, args, "--permission-prompt-tool")
+	assert.Contains(t, args, "mcp__agentbox__approval_prompt")
+
+	var mcpConfig string
+	for i, arg := range args {
+		if arg == "--mcp-config" && i+1 < len(args) {
+			mcpConfig = args[i+1]
+		}
+	}
+	assert.Contains(t, mcpConfig, `"type":"http"`)
+	assert.Contains(t, mcpConfig, `"url":"http://host.docker.internal:18080/api/v1/approvals/mcp/tok"`)
+	assert.NotContains(t, mcpConfig, `"command"`)
+}
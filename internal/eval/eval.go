@@ -0,0 +1,302 @@
+// Package eval provides automatic evaluation of task results.
+//
+// Evaluators are attached to agents, task templates or batches and run after a
+// task finishes successfully. Each evaluator yields a pass/fail verdict, a score
+// in [0, 1] and a human-readable reason; the results are aggregated into a Report.
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Type is the kind of an evaluator.
+type Type string
+
+const (
+	TypeContains   Type = "contains"    // output contains a substring
+	TypeRegex      Type = "regex"       // output matches a regular expression
+	TypeJSONSchema Type = "json_schema" // output (or the JSON embedded in it) validates against a schema
+	TypeCommand    Type = "command"     // shell command run in the session workspace exits with the expected code
+	TypeLLMJudge   Type = "llm_judge"   // an LLM scores the output against criteria
+)
+
+// Defaults
+const (
+	DefaultPassScore = 0.7
+	DefaultTimeout   = 120 // seconds, for command and llm_judge evaluators
+	maxReasonLength  = 500
+)
+
+// Evaluator defines a single check run against a task result.
+type Evaluator struct {
+	Name string `json:"name,omitempty"` // defaults to "{type}-{index}"
+	Type Type   `json:"type"`
+
+	// contains / regex
+	Pattern    string `json:"pattern,omitempty"`
+	IgnoreCase bool   `json:"ignore_case,omitempty"`
+	Negate     bool   `json:"negate,omitempty"` // pass when the pattern does NOT match
+
+	// json_schema
+	Schema json.RawMessage `json:"schema,omitempty"`
+
+	// command
+	Command  string `json:"command,omitempty"`   // run with sh -c in /workspace
+	ExitCode int    `json:"exit_code,omitempty"` // expected exit code (default 0)
+
+	// llm_judge
+	ProviderID string  `json:"provider_id,omitempty"`
+	Model      string  `json:"model,omitempty"` // defaults to the provider's default model
+	Criteria   string  `json:"criteria,omitempty"`
+	PassScore  float64 `json:"pass_score,omitempty"` // minimum score to pass (default 0.7)
+
+	Timeout int `json:"timeout,omitempty"` // seconds, command / llm_judge only
+}
+
+// Result is the outcome of a single evaluator.
+type Result struct {
+	Name       string  `json:"name"`
+	Type       Type    `json:"type"`
+	Passed     bool    `json:"passed"`
+	Score      float64 `json:"score"`
+	Reason     string  `json:"reason,omitempty"`
+	DurationMs int64   `json:"duration_ms"`
+}
+
+// Report aggregates the results of all evaluators of a task.
+type Report struct {
+	Passed      bool      `json:"passed"` // all evaluators passed
+	Score       float64   `json:"score"`  // mean score
+	Results     []Result  `json:"results"`
+	EvaluatedAt time.Time `json:"evaluated_at"`
+}
+
+// Reasons joins the reasons of the failed evaluators.
+func (r *Report) Reasons() string {
+	var parts []string
+	for _, res := range r.Results {
+		if !res.Passed {
+			parts = append(parts, fmt.Sprintf("%s: %s", res.Name, res.Reason))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Subject is the task result being evaluated.
+type Subject struct {
+	Prompt string
+	Output string
+}
+
+// CommandRunner runs a shell command in the task's workspace and returns its exit code and combined output.
+type CommandRunner func(ctx context.Context, command string) (exitCode int, output string, err error)
+
+// Judge completes a prompt with an LLM of the given provider.
+type Judge interface {
+	Complete(ctx context.Context, providerID, model, prompt string) (string, error)
+}
+
+// Env provides the side-effecting capabilities needed by some evaluators.
+// A nil field makes the corresponding evaluators fail with an explanatory reason.
+type Env struct {
+	Commands CommandRunner
+	Judge    Judge
+}
+
+// Validate checks a list of evaluators for configuration errors.
+func Validate(evaluators []Evaluator) error {
+	names := make(map[string]bool, len(evaluators))
+	for i := range evaluators {
+		e := &evaluators[i]
+		name := e.name(i)
+		if names[name] {
+			return fmt.Errorf("duplicate evaluator name: %s", name)
+		}
+		names[name] = true
+
+		if e.Timeout < 0 {
+			return fmt.Errorf("evaluator %s: timeout must not be negative", name)
+		}
+		switch e.Type {
+		case TypeContains:
+			if e.Pattern == "" {
+				return fmt.Errorf("evaluator %s: pattern is required", name)
+			}
+		case TypeRegex:
+			if _, err := e.compile(); err != nil {
+				return fmt.Errorf("evaluator %s: invalid pattern: %v", name, err)
+			}
+		case TypeJSONSchema:
+			var schema interface{}
+			if len(e.Schema) == 0 || json.Unmarshal(e.Schema, &schema) != nil {
+				return fmt.Errorf("evaluator %s: schema must be a valid JSON document", name)
+			}
+			if _, ok := schema.(map[string]interface{}); !ok {
+				return fmt.Errorf("evaluator %s: schema must be a JSON object", name)
+			}
+		case TypeCommand:
+			if strings.TrimSpace(e.Command) == "" {
+				return fmt.Errorf("evaluator %s: command is required", name)
+			}
+		case TypeLLMJudge:
+			if e.ProviderID == "" || strings.TrimSpace(e.Criteria) == "" {
+				return fmt.Errorf("evaluator %s: provider_id and criteria are required", name)
+			}
+			if e.PassScore < 0 || e.PassScore > 1 {
+				return fmt.Errorf("evaluator %s: pass_score must be between 0 and 1", name)
+			}
+		default:
+			return fmt.Errorf("evaluator %s: unknown type %q", name, e.Type)
+		}
+	}
+	return nil
+}
+
+// Run executes all evaluators against the subject. It returns nil when there are no evaluators.
+func Run(ctx context.Context, evaluators []Evaluator, subject *Subject, env *Env) *Report {
+	if len(evaluators) == 0 {
+		return nil
+	}
+	if env == nil {
+		env = &Env{}
+	}
+
+	report := &Report{Passed: true, Results: make([]Result, 0, len(evaluators))}
+	var total float64
+	for i := range evaluators {
+		e := &evaluators[i]
+		start := time.Now()
+		res := e.run(ctx, subject, env)
+		res.Name = e.name(i)
+		res.Type = e.Type
+		res.Reason = truncate(res.Reason, maxReasonLength)
+		res.DurationMs = time.Since(start).Milliseconds()
+
+		report.Results = append(report.Results, res)
+		report.Passed = report.Passed && res.Passed
+		total += res.Score
+	}
+	report.Score = total / float64(len(evaluators))
+	report.EvaluatedAt = time.Now()
+	return report
+}
+
+func (e *Evaluator) name(i int) string {
+	if e.Name != "" {
+		return e.Name
+	}
+	return fmt.Sprintf("%s-%d", e.Type, i+1)
+}
+
+func (e *Evaluator) timeout() time.Duration {
+	if e.Timeout > 0 {
+		return time.Duration(e.Timeout) * time.Second
+	}
+	return DefaultTimeout * time.Second
+}
+
+func (e *Evaluator) compile() (*regexp.Regexp, error) {
+	pattern := e.Pattern
+	if e.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+func (e *Evaluator) run(ctx context.Context, subject *Subject, env *Env) Result {
+	switch e.Type {
+	case TypeContains:
+		output, pattern := subject.Output, e.Pattern
+		if e.IgnoreCase {
+			output, pattern = strings.ToLower(output), strings.ToLower(pattern)
+		}
+		return e.match(strings.Contains(output, pattern), "output contains %q")
+	case TypeRegex:
+		re, err := e.compile()
+		if err != nil {
+			return fail("invalid pattern: %v", err)
+		}
+		return e.match(re.MatchString(subject.Output), "output matches /%s/")
+	case TypeJSONSchema:
+		return e.runSchema(subject.Output)
+	case TypeCommand:
+		return e.runCommand(ctx, env.Commands)
+	case TypeLLMJudge:
+		return e.runJudge(ctx, subject, env.Judge)
+	default:
+		return fail("unknown evaluator type %q", e.Type)
+	}
+}
+
+// match converts a pattern match into a result, honouring Negate.
+func (e *Evaluator) match(matched bool, format string) Result {
+	desc := fmt.Sprintf(format, e.Pattern)
+	if matched != e.Negate {
+		return pass("")
+	}
+	if e.Negate {
+		return fail("unexpected: %s", desc)
+	}
+	return fail("expected: %s", desc)
+}
+
+func (e *Evaluator) runSchema(output string) Result {
+	var schema map[string]interface{}
+	if err := json.Unmarshal(e.Schema, &schema); err != nil {
+		return fail("invalid schema: %v", err)
+	}
+	doc, err := extractJSON(output)
+	if err != nil {
+		return fail("%v", err)
+	}
+	if errs := validateSchema(schema, doc, "$"); len(errs) > 0 {
+		return fail("%s", strings.Join(errs, "; "))
+	}
+	return pass("")
+}
+
+func (e *Evaluator) runCommand(ctx context.Context, runner CommandRunner) Result {
+	if runner == nil {
+		return fail("command evaluators are not available for this task")
+	}
+	ctx, cancel := context.WithTimeout(ctx, e.timeout())
+	defer cancel()
+
+	code, output, err := runner(ctx, e.Command)
+	if err != nil {
+		return fail("command error: %v", err)
+	}
+	if code != e.ExitCode {
+		return fail("exit code %d (expected %d): %s", code, e.ExitCode, tail(output, maxReasonLength/2))
+	}
+	return pass("")
+}
+
+func pass(reason string) Result {
+	return Result{Passed: true, Score: 1, Reason: reason}
+}
+
+func fail(format string, args ...interface{}) Result {
+	return Result{Passed: false, Score: 0, Reason: fmt.Sprintf(format, args...)}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// tail keeps the last n bytes of s, where command failures usually explain themselves.
+func tail(s string, n int) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= n {
+		return s
+	}
+	return "..." + s[len(s)-n:]
+}
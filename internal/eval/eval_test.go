@@ -0,0 +1,143 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeJudge struct {
+	reply  string
+	err    error
+	prompt string
+}
+
+func (j *fakeJudge) Complete(_ context.Context, _, _, prompt string) (string, error) {
+	j.prompt = prompt
+	return j.reply, j.err
+}
+
+func TestRun_TextEvaluators(t *testing.T) {
+	subject := &Subject{Prompt: "p", Output: "All 12 tests PASSED"}
+	report := Run(context.Background(), []Evaluator{
+		{Type: TypeContains, Pattern: "passed", IgnoreCase: true},
+		{Type: TypeRegex, Pattern: `\d+ tests`},
+		{Name: "no-failures", Type: TypeContains, Pattern: "FAIL", Negate: true},
+		{Type: TypeContains, Pattern: "passed"},
+	}, subject, nil)
+
+	require.NotNil(t, report)
+	require.Len(t, report.Results, 4)
+	assert.False(t, report.Passed)
+	assert.InDelta(t, 0.75, report.Score, 1e-9)
+	assert.Equal(t, "contains-1", report.Results[0].Name)
+	assert.True(t, report.Results[1].Passed)
+	assert.Equal(t, "no-failures", report.Results[2].Name)
+	assert.True(t, report.Results[2].Passed)
+	assert.False(t, report.Results[3].Passed)
+	assert.Equal(t, `contains-4: expected: output contains "passed"`, report.Reasons())
+
+	assert.Nil(t, Run(context.Background(), nil, subject, nil))
+}
+
+func TestRun_JSONSchema(t *testing.T) {
+	schema := json.RawMessage(`{
+		"type": "object",
+		"required": ["status", "files"],
+		"additionalProperties": false,
+		"properties": {
+			"status": {"enum": ["ok", "error"]},
+			"files": {"type": "array", "minItems": 1, "items": {"type": "string", "pattern": "\\.go$"}},
+			"score": {"type": "number", "minimum": 0, "maximum": 1}
+		}
+	}`)
+	evaluators := []Evaluator{{Type: TypeJSONSchema, Schema: schema}}
+	require.NoError(t, Validate(evaluators))
+
+	ok := Run(context.Background(), evaluators, &Subject{
+		Output: "Done.\n```json\n{\"status\": \"ok\", \"files\": [\"main.go\"], \"score\": 0.5}\n```",
+	}, nil)
+	assert.True(t, ok.Passed, ok.Reasons())
+
+	bad := Run(context.Background(), evaluators, &Subject{
+		Output: `Result: {"status": "done", "files": ["a.txt"], "extra": 1}`,
+	}, nil)
+	require.False(t, bad.Passed)
+	reason := bad.Results[0].Reason
+	assert.Contains(t, reason, `$: unexpected property "extra"`)
+	assert.Contains(t, reason, `$.files[0]: value does not match pattern`)
+	assert.Contains(t, reason, `$.status: value is not one of`)
+
+	none := Run(context.Background(), evaluators, &Subject{Output: "no json here"}, nil)
+	assert.Equal(t, "output does not contain a JSON document", none.Results[0].Reason)
+}
+
+func TestRun_Command(t *testing.T) {
+	var ran string
+	env := &Env{Commands: func(_ context.Context, command string) (int, string, error) {
+		ran = command
+		if command == "go test ./..." {
+			return 1, "--- FAIL: TestX", nil
+		}
+		return 0, "", nil
+	}}
+
+	report := Run(context.Background(), []Evaluator{
+		{Type: TypeCommand, Command: "go test ./..."},
+		{Type: TypeCommand, Command: "go vet ./..."},
+	}, &Subject{}, env)
+	assert.Equal(t, "go vet ./...", ran)
+	assert.False(t, report.Results[0].Passed)
+	assert.Equal(t, "exit code 1 (expected 0): --- FAIL: TestX", report.Results[0].Reason)
+	assert.True(t, report.Results[1].Passed)
+
+	// without a command runner the evaluator fails
+	report = Run(context.Background(), []Evaluator{{Type: TypeCommand, Command: "true"}}, &Subject{}, nil)
+	assert.False(t, report.Passed)
+}
+
+func TestRun_LLMJudge(t *testing.T) {
+	judge := &fakeJudge{reply: "Verdict:\n{\"score\": 0.8, \"reason\": \"covers most points\"}"}
+	evaluators := []Evaluator{{Type: TypeLLMJudge, ProviderID: "anthropic", Criteria: "Mentions the root cause"}}
+
+	report := Run(context.Background(), evaluators, &Subject{Prompt: "Why did it crash?", Output: "nil map"}, &Env{Judge: judge})
+	assert.True(t, report.Passed)
+	assert.InDelta(t, 0.8, report.Score, 1e-9)
+	assert.Equal(t, "covers most points", report.Results[0].Reason)
+	assert.Contains(t, judge.prompt, "Why did it crash?")
+	assert.Contains(t, judge.prompt, "Mentions the root cause")
+
+	evaluators[0].PassScore = 0.9
+	assert.False(t, Run(context.Background(), evaluators, &Subject{}, &Env{Judge: judge}).Passed)
+
+	judge.err = errors.New("rate limited")
+	report = Run(context.Background(), evaluators, &Subject{}, &Env{Judge: judge})
+	assert.Equal(t, "judge error: rate limited", report.Results[0].Reason)
+
+	judge.err, judge.reply = nil, "looks fine to me"
+	assert.False(t, Run(context.Background(), evaluators, &Subject{}, &Env{Judge: judge}).Passed)
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate([]Evaluator{
+		{Type: TypeContains, Pattern: "x"},
+		{Type: TypeCommand, Command: "make test"},
+		{Type: TypeLLMJudge, ProviderID: "p", Criteria: "c"},
+	}))
+	for name, e := range map[string][]Evaluator{
+		"unknown type":   {{Type: "vibes"}},
+		"empty pattern":  {{Type: TypeContains}},
+		"bad regex":      {{Type: TypeRegex, Pattern: "("}},
+		"bad schema":     {{Type: TypeJSONSchema, Schema: json.RawMessage(`[1]`)}},
+		"no command":     {{Type: TypeCommand}},
+		"judge criteria": {{Type: TypeLLMJudge, ProviderID: "p"}},
+		"pass score":     {{Type: TypeLLMJudge, ProviderID: "p", Criteria: "c", PassScore: 2}},
+		"duplicate":      {{Name: "a", Type: TypeContains, Pattern: "x"}, {Name: "a", Type: TypeContains, Pattern: "y"}},
+	} {
+		assert.Error(t, Validate(e), name)
+	}
+}
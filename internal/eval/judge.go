@@ -0,0 +1,64 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// maxJudgeOutput bounds the task output embedded in the judge prompt.
+const maxJudgeOutput = 20000
+
+const judgePrompt = `You are evaluating the result of an AI agent task.
+
+## Task
+%s
+
+## Result
+%s
+
+## Criteria
+%s
+
+Score how well the result satisfies the criteria on a scale from 0.0 (not at all) to 1.0 (fully).
+Respond with only a JSON object: {"score": <number>, "reason": "<one or two sentences>"}`
+
+func (e *Evaluator) runJudge(ctx context.Context, subject *Subject, judge Judge) Result {
+	if judge == nil {
+		return fail("llm judge is not configured")
+	}
+	ctx, cancel := context.WithTimeout(ctx, e.timeout())
+	defer cancel()
+
+	prompt := fmt.Sprintf(judgePrompt, subject.Prompt, truncate(subject.Output, maxJudgeOutput), e.Criteria)
+	reply, err := judge.Complete(ctx, e.ProviderID, e.Model, prompt)
+	if err != nil {
+		return fail("judge error: %v", err)
+	}
+
+	score, reason, err := parseVerdict(reply)
+	if err != nil {
+		return fail("%v", err)
+	}
+	passScore := e.PassScore
+	if passScore == 0 {
+		passScore = DefaultPassScore
+	}
+	return Result{Passed: score >= passScore, Score: score, Reason: reason}
+}
+
+// parseVerdict extracts {"score", "reason"} from the judge's reply.
+func parseVerdict(reply string) (float64, string, error) {
+	doc, err := extractJSON(reply)
+	if err != nil {
+		return 0, "", fmt.Errorf("judge returned no verdict: %s", truncate(strings.TrimSpace(reply), 200))
+	}
+	obj, _ := doc.(map[string]interface{})
+	score, ok := obj["score"].(float64)
+	if !ok || math.IsNaN(score) {
+		return 0, "", fmt.Errorf("judge verdict has no numeric score: %s", mustJSON(doc))
+	}
+	reason, _ := obj["reason"].(string)
+	return math.Max(0, math.Min(1, score)), reason, nil
+}
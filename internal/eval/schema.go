@@ -0,0 +1,191 @@
+package eval
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var jsonFence = regexp.MustCompile("(?s)```(?:json)?\\s*\\n(.*?)```")
+
+// extractJSON parses the JSON document in an agent's output: the whole text,
+// the first ```json fenced block, or the first balanced {...} / [...] span.
+func extractJSON(output string) (interface{}, error) {
+	var doc interface{}
+	text := strings.TrimSpace(output)
+	if json.Unmarshal([]byte(text), &doc) == nil {
+		return doc, nil
+	}
+	if m := jsonFence.FindStringSubmatch(text); m != nil {
+		if json.Unmarshal([]byte(m[1]), &doc) == nil {
+			return doc, nil
+		}
+	}
+	if start := strings.IndexAny(text, "{["); start >= 0 {
+		dec := json.NewDecoder(strings.NewReader(text[start:]))
+		if dec.Decode(&doc) == nil {
+			return doc, nil
+		}
+	}
+	return nil, errors.New("output does not contain a JSON document")
+}
+
+// validateSchema validates doc against a subset of JSON Schema: type, enum, const,
+// properties, required, additionalProperties, items, min/maxItems, min/maxLength,
+// pattern, minimum/maximum. It returns one message per violation.
+func validateSchema(schema map[string]interface{}, doc interface{}, path string) []string {
+	var errs []string
+	addf := func(format string, args ...interface{}) {
+		errs = append(errs, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if t, ok := schema["type"]; ok && !matchesType(t, doc) {
+		addf("expected type %v, got %s", t, jsonType(doc))
+		return errs
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && !containsValue(enum, doc) {
+		addf("value is not one of %s", mustJSON(enum))
+	}
+	if c, ok := schema["const"]; ok && !equalJSON(c, doc) {
+		addf("value must be %s", mustJSON(c))
+	}
+
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		props, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, r := range required {
+				if name, ok := r.(string); ok {
+					if _, present := v[name]; !present {
+						addf("missing required property %q", name)
+					}
+				}
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if sub, ok := props[k].(map[string]interface{}); ok {
+				errs = append(errs, validateSchema(sub, v[k], path+"."+k)...)
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					addf("unexpected property %q", k)
+				}
+			case map[string]interface{}:
+				errs = append(errs, validateSchema(extra, v[k], path+"."+k)...)
+			}
+		}
+	case []interface{}:
+		if n, ok := number(schema["minItems"]); ok && float64(len(v)) < n {
+			addf("expected at least %v items, got %d", n, len(v))
+		}
+		if n, ok := number(schema["maxItems"]); ok && float64(len(v)) > n {
+			addf("expected at most %v items, got %d", n, len(v))
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				errs = append(errs, validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case string:
+		length := float64(len([]rune(v)))
+		if n, ok := number(schema["minLength"]); ok && length < n {
+			addf("expected length >= %v", n)
+		}
+		if n, ok := number(schema["maxLength"]); ok && length > n {
+			addf("expected length <= %v", n)
+		}
+		if p, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(p); err != nil {
+				addf("invalid pattern %q in schema", p)
+			} else if !re.MatchString(v) {
+				addf("value does not match pattern %q", p)
+			}
+		}
+	case float64:
+		if n, ok := number(schema["minimum"]); ok && v < n {
+			addf("expected value >= %v", n)
+		}
+		if n, ok := number(schema["maximum"]); ok && v > n {
+			addf("expected value <= %v", n)
+		}
+	}
+	return errs
+}
+
+func matchesType(t interface{}, doc interface{}) bool {
+	switch t := t.(type) {
+	case string:
+		return matchesTypeName(t, doc)
+	case []interface{}:
+		for _, name := range t {
+			if s, ok := name.(string); ok && matchesTypeName(s, doc) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchesTypeName(name string, doc interface{}) bool {
+	actual := jsonType(doc)
+	if name == "number" && actual == "integer" {
+		return true
+	}
+	return name == actual
+}
+
+func jsonType(doc interface{}) string {
+	switch v := doc.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", doc)
+}
+
+func number(v interface{}) (float64, bool) {
+	f, ok := v.(float64)
+	return f, ok
+}
+
+func containsValue(values []interface{}, doc interface{}) bool {
+	for _, v := range values {
+		if equalJSON(v, doc) {
+			return true
+		}
+	}
+	return false
+}
+
+func equalJSON(a, b interface{}) bool {
+	return mustJSON(a) == mustJSON(b)
+}
+
+func mustJSON(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -17,14 +17,17 @@ type TaskEventBridge struct {
 
 // TaskManager 任务管理器接口
 type TaskManager interface {
-	// SubscribeEvents 订阅任务事件
-	SubscribeEvents(taskID string) <-chan *TaskEvent
-	// UnsubscribeEvents 取消订阅任务事件
-	UnsubscribeEvents(taskID string, ch <-chan *TaskEvent)
+	// StreamEvents 打开可续传的任务事件流（afterSeq < 0 表示只推送之后的新事件），
+	// 收到终态事件或 ctx 结束后关闭
+	StreamEvents(ctx context.Context, taskID string, afterSeq int64) <-chan *TaskEvent
+	// ReplayEvents 返回 afterSeq 之后的历史事件
+	ReplayEvents(taskID string, afterSeq int64) ([]*TaskEvent, error)
 	// CancelTask 取消任务
 	CancelTask(taskID string) error
 	// CreateTask 创建任务（如果带 TaskID 则追加轮次）
 	CreateTask(req *CreateTaskRequest) (*Task, error)
+	// DecideApproval 批准或拒绝任务的工具调用（approvalID 为空时处理任务最早的待审批请求）
+	DecideApproval(taskID, approvalID string, approve bool) error
 }
 
 // CreateTaskRequest 创建任务请求（简化版）
@@ -40,10 +43,16 @@ type Task struct {
 
 // TaskEvent 任务事件（与 task.TaskEvent 对应）
 type TaskEvent struct {
+	Seq  int64       `json:"seq,omitempty"`
 	Type string      `json:"type"`
 	Data interface{} `json:"data,omitempty"`
 }
 
+// isTerminalTaskEvent 是否是任务终态事件
+func isTerminalTaskEvent(eventType string) bool {
+	return eventType == "task.completed" || eventType == "task.failed" || eventType == "task.cancelled"
+}
+
 // NewTaskEventBridge 创建任务事件桥接器
 func NewTaskEventBridge(gw *Gateway, tm TaskManager) *TaskEventBridge {
 	bridge := &TaskEventBridge{
@@ -54,6 +63,8 @@ func NewTaskEventBridge(gw *Gateway, tm TaskManager) *TaskEventBridge {
 
 	// 设置任务操作回调
 	gw.SetTaskActionFunc(bridge.handleTaskAction)
+	// 订阅任务时回放历史事件并开始转发
+	gw.SetSubscribeHook(bridge.handleSubscribe)
 
 	return bridge
 }
@@ -69,45 +80,82 @@ func (b *TaskEventBridge) handleTaskAction(taskID, action, data string) error {
 			Prompt: data,
 		})
 		return err
+	case "approve", "deny":
+		return b.taskManager.DecideApproval(taskID, data, action == "approve")
 	default:
 		return nil
 	}
 }
 
-// StartForwarding 开始转发任务事件
-func (b *TaskEventBridge) StartForwarding(taskID string) {
-	eventCh := b.taskManager.SubscribeEvents(taskID)
+// handleSubscribe 订阅任务时向该客户端回放 afterSeq 之后的历史事件，
+// 任务未结束则开始转发后续事件
+func (b *TaskEventBridge) handleSubscribe(client *Client, channel, topic string, afterSeq int64) {
+	if channel != ChannelTask || topic == "*" {
+		return
+	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	events, err := b.taskManager.ReplayEvents(topic, afterSeq)
+	if err != nil {
+		log.Printf("[Gateway] Replay task events failed: task=%s error=%v", topic, err)
+	}
+	for _, event := range events {
+		client.SendMessage(NewMessage(MsgTypeEvent, EventPayload{
+			Channel:   ChannelTask,
+			Topic:     topic,
+			EventType: event.Type,
+			Seq:       event.Seq,
+			Data:      event.Data,
+		}))
+	}
 
+	from := afterSeq
+	if n := len(events); n > 0 {
+		if isTerminalTaskEvent(events[n-1].Type) {
+			return // 任务已结束，历史已完整回放
+		}
+		from = events[n-1].Seq
+	}
+	b.startForwarding(topic, from)
+}
+
+// StartForwarding 开始转发任务事件（只转发之后产生的事件）
+func (b *TaskEventBridge) StartForwarding(taskID string) {
+	b.startForwarding(taskID, -1)
+}
+
+// startForwarding 从 afterSeq 之后开始转发任务事件，同一任务只保留一个转发协程
+func (b *TaskEventBridge) startForwarding(taskID string, afterSeq int64) {
 	b.mu.Lock()
+	if _, ok := b.cancelFuncs[taskID]; ok {
+		b.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 	b.cancelFuncs[taskID] = cancel
 	b.mu.Unlock()
 
+	eventCh := b.taskManager.StreamEvents(ctx, taskID, afterSeq)
+
 	go func() {
 		defer func() {
-			b.taskManager.UnsubscribeEvents(taskID, eventCh)
-			b.mu.Lock()
-			delete(b.cancelFuncs, taskID)
-			b.mu.Unlock()
+			// 被 StopForwarding 取消时映射已由其移除（可能已有新的转发协程），不能再删除
+			if ctx.Err() == nil {
+				b.mu.Lock()
+				delete(b.cancelFuncs, taskID)
+				b.mu.Unlock()
+			}
+			cancel()
 		}()
 
-		for {
-			select {
-			case event, ok := <-eventCh:
-				if !ok {
-					return
-				}
-				// 广播到 Gateway
-				b.gateway.BroadcastEvent(ChannelTask, taskID, event.Type, event.Data)
-
-				// 如果任务完成或失败，停止转发
-				if event.Type == "task.completed" || event.Type == "task.failed" || event.Type == "task.cancelled" {
-					return
-				}
-			case <-ctx.Done():
-				return
-			}
+		// 事件流在任务结束或 ctx 取消后关闭
+		for event := range eventCh {
+			b.gateway.PublishEvent(EventPayload{
+				Channel:   ChannelTask,
+				Topic:     taskID,
+				EventType: event.Type,
+				Seq:       event.Seq,
+				Data:      event.Data,
+			})
 		}
 	}()
 }
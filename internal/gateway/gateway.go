@@ -28,6 +28,9 @@ type TaskActionFunc func(taskID, action, data string) error
 // SessionExecFunc 会话执行函数类型
 type SessionExecFunc func(sessionID, command string) (execID string, err error)
 
+// SubscribeHook 订阅成功后的回调（每个具体 topic 调用一次，用于回放历史事件）
+type SubscribeHook func(client *Client, channel, topic string, afterSeq int64)
+
 // Gateway WebSocket 网关
 type Gateway struct {
 	clients    map[string]*Client // clientID -> Client
@@ -43,6 +46,7 @@ type Gateway struct {
 	authFunc       AuthFunc
 	taskActionFunc TaskActionFunc
 	sessionExecFunc SessionExecFunc
+	subscribeHook  SubscribeHook
 
 	// 控制
 	register   chan *Client
@@ -77,6 +81,11 @@ func (g *Gateway) SetSessionExecFunc(f SessionExecFunc) {
 	g.sessionExecFunc = f
 }
 
+// SetSubscribeHook 设置订阅回调
+func (g *Gateway) SetSubscribeHook(f SubscribeHook) {
+	g.subscribeHook = f
+}
+
 // Start 启动网关
 func (g *Gateway) Start() {
 	go g.run()
@@ -298,6 +307,13 @@ func (g *Gateway) handleSubscribe(client *Client, msg *Message) {
 		Topics:  payload.Topics,
 		Success: true,
 	}))
+
+	// 订阅已生效后再回放，回放期间的新事件不会丢失（客户端按 seq 去重）
+	if g.subscribeHook != nil {
+		for _, topic := range payload.Topics {
+			g.subscribeHook(client, payload.Channel, topic, payload.AfterSeq[topic])
+		}
+	}
 }
 
 // handleUnsubscribe 处理取消订阅
@@ -424,12 +440,18 @@ func (g *Gateway) handleSessionExec(client *Client, msg *Message) {
 
 // BroadcastEvent 广播事件到订阅者
 func (g *Gateway) BroadcastEvent(channel, topic, eventType string, data interface{}) {
-	event := NewMessage(MsgTypeEvent, EventPayload{
+	g.PublishEvent(EventPayload{
 		Channel:   channel,
 		Topic:     topic,
 		EventType: eventType,
 		Data:      data,
 	})
+}
+
+// PublishEvent 广播完整的事件负载到订阅者
+func (g *Gateway) PublishEvent(payload EventPayload) {
+	channel, topic := payload.Channel, payload.Topic
+	event := NewMessage(MsgTypeEvent, payload)
 
 	g.subMu.RLock()
 	defer g.subMu.RUnlock()
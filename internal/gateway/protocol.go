@@ -68,8 +68,9 @@ type AuthResult struct {
 
 // SubscribePayload 订阅请求
 type SubscribePayload struct {
-	Channel string   `json:"channel"` // task, session, system
-	Topics  []string `json:"topics"`  // 具体的任务ID或会话ID列表，空表示订阅所有
+	Channel  string           `json:"channel"`             // task, session, system
+	Topics   []string         `json:"topics"`              // 具体的任务ID或会话ID列表，空表示订阅所有
+	AfterSeq map[string]int64 `json:"after_seq,omitempty"` // topic → 最后收到的事件序号（task 频道断线续传，未指定时回放全部历史）
 }
 
 // SubscribeResult 订阅结果
@@ -81,17 +82,18 @@ type SubscribeResult struct {
 
 // EventPayload 事件推送
 type EventPayload struct {
-	Channel   string      `json:"channel"`    // task, session, system
-	Topic     string      `json:"topic"`      // 具体的任务ID或会话ID
-	EventType string      `json:"event_type"` // 具体事件类型
-	Data      interface{} `json:"data"`       // 事件数据
+	Channel   string      `json:"channel"`       // task, session, system
+	Topic     string      `json:"topic"`         // 具体的任务ID或会话ID
+	EventType string      `json:"event_type"`    // 具体事件类型
+	Seq       int64       `json:"seq,omitempty"` // 事件序号（task 频道，用于续传和去重）
+	Data      interface{} `json:"data"`          // 事件数据
 }
 
 // TaskActionPayload 任务操作请求
 type TaskActionPayload struct {
 	TaskID string `json:"task_id"`
-	Action string `json:"action"` // cancel, append_turn
-	Data   string `json:"data,omitempty"` // append_turn 时的用户输入
+	Action string `json:"action"` // cancel, append_turn, approve, deny
+	Data   string `json:"data,omitempty"` // append_turn 时的用户输入；approve/deny 时的审批 ID（为空则处理最早的待审批请求）
 }
 
 // TaskActionResult 任务操作结果
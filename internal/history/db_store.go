@@ -145,6 +145,7 @@ func (s *DBStore) GetStats(filter *ListFilter) (*Stats, error) {
 
 		if entry.Usage != nil {
 			stats.TotalInputTokens += entry.Usage.InputTokens
+			stats.TotalCachedInputTokens += entry.Usage.CachedInputTokens
 			stats.TotalOutputTokens += entry.Usage.OutputTokens
 		}
 
@@ -160,6 +160,7 @@ func (s *MemoryStore) GetStats(filter *ListFilter) (*Stats, error) {
 
 		if entry.Usage != nil {
 			stats.TotalInputTokens += entry.Usage.InputTokens
+			stats.TotalCachedInputTokens += entry.Usage.CachedInputTokens
 			stats.TotalOutputTokens += entry.Usage.OutputTokens
 		}
 
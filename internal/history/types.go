@@ -10,6 +10,7 @@ type SourceType string
 const (
 	SourceSession SourceType = "session" // Session 执行
 	SourceAgent   SourceType = "agent"   // Agent 执行
+	SourceTask    SourceType = "task"    // Task 执行（每轮一条）
 )
 
 // Status 执行状态
@@ -67,11 +68,12 @@ type ListFilter struct {
 
 // Stats 执行统计
 type Stats struct {
-	TotalExecutions   int            `json:"total_executions"`
-	CompletedCount    int            `json:"completed_count"`
-	FailedCount       int            `json:"failed_count"`
-	TotalInputTokens  int            `json:"total_input_tokens"`
-	TotalOutputTokens int            `json:"total_output_tokens"`
-	BySource          map[string]int `json:"by_source"`
-	ByEngine          map[string]int `json:"by_engine"`
+	TotalExecutions        int            `json:"total_executions"`
+	CompletedCount         int            `json:"completed_count"`
+	FailedCount            int            `json:"failed_count"`
+	TotalInputTokens       int            `json:"total_input_tokens"`
+	TotalCachedInputTokens int            `json:"total_cached_input_tokens"`
+	TotalOutputTokens      int            `json:"total_output_tokens"`
+	BySource               map[string]int `json:"by_source"`
+	ByEngine               map[string]int `json:"by_engine"`
 }
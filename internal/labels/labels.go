@@ -0,0 +1,265 @@
+// Package labels 任务与批量任务的标签（key=value）及标签选择器
+//
+// 标签以 JSON 保存在资源表中便于读取，同时写入 labels 表并建立 (resource_type, key, value, resource_id)
+// 复合索引，标签选择器通过该表上的子查询过滤。
+//
+// 选择器语法（逗号分隔，各条件需同时满足）：
+//
+//	project=billing        等于
+//	project!=billing       不等于（含未设置该标签）
+//	env in (prod,staging)  属于集合
+//	env notin (dev)        不属于集合（含未设置该标签）
+//	ticket                 存在该标签
+//	!ticket                不存在该标签
+package labels
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/tmalldedede/agentbox/internal/apperr"
+)
+
+// 资源类型
+const (
+	ResourceTask  = "task"
+	ResourceBatch = "batch"
+)
+
+const (
+	MaxLabels      = 32  // 单个资源最多标签数
+	MaxKeyLength   = 63  // 标签键最大长度
+	MaxValueLength = 255 // 标签值最大长度
+)
+
+var (
+	keyPattern   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+	valuePattern = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9._:/@#-]*[A-Za-z0-9])?)?$`)
+)
+
+// Validate 校验标签键值格式与数量
+func Validate(labels map[string]string) error {
+	if len(labels) > MaxLabels {
+		return apperr.Validationf("too many labels: %d (max %d)", len(labels), MaxLabels)
+	}
+	for k, v := range labels {
+		if err := validateKey(k); err != nil {
+			return err
+		}
+		if err := validateValue(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateKey(k string) error {
+	if len(k) > MaxKeyLength || !keyPattern.MatchString(k) {
+		return apperr.Validationf("invalid label key %q: must be 1-%d alphanumeric characters, '-', '_', '.' or '/'", k, MaxKeyLength)
+	}
+	return nil
+}
+
+func validateValue(v string) error {
+	if len(v) > MaxValueLength || !valuePattern.MatchString(v) {
+		return apperr.Validationf("invalid label value %q: must be at most %d alphanumeric characters, '-', '_', '.', ':', '/', '@' or '#'", v, MaxValueLength)
+	}
+	return nil
+}
+
+// Operator 选择器条件运算符
+type Operator string
+
+const (
+	OpEquals       Operator = "="
+	OpNotEquals    Operator = "!="
+	OpIn           Operator = "in"
+	OpNotIn        Operator = "notin"
+	OpExists       Operator = "exists"
+	OpDoesNotExist Operator = "!"
+)
+
+// Requirement 单个选择器条件
+type Requirement struct {
+	Key      string
+	Operator Operator
+	Values   []string
+}
+
+// Matches 判断标签是否满足条件
+func (r Requirement) Matches(labels map[string]string) bool {
+	v, ok := labels[r.Key]
+	switch r.Operator {
+	case OpExists:
+		return ok
+	case OpDoesNotExist:
+		return !ok
+	case OpEquals, OpIn:
+		return ok && contains(r.Values, v)
+	case OpNotEquals, OpNotIn:
+		return !ok || !contains(r.Values, v)
+	}
+	return false
+}
+
+func (r Requirement) String() string {
+	switch r.Operator {
+	case OpExists:
+		return r.Key
+	case OpDoesNotExist:
+		return "!" + r.Key
+	case OpIn, OpNotIn:
+		return r.Key + " " + string(r.Operator) + " (" + strings.Join(r.Values, ",") + ")"
+	}
+	return r.Key + string(r.Operator) + r.Values[0]
+}
+
+// Selector 标签选择器，空选择器匹配所有资源
+type Selector []Requirement
+
+// Empty 是否为空选择器
+func (s Selector) Empty() bool {
+	return len(s) == 0
+}
+
+// Matches 判断标签是否满足全部条件
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s Selector) String() string {
+	parts := make([]string, len(s))
+	for i, r := range s {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// Parse 解析标签选择器
+func Parse(text string) (Selector, error) {
+	var sel Selector
+	for _, part := range splitRequirements(text) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		r, err := parseRequirement(part)
+		if err != nil {
+			return nil, err
+		}
+		sel = append(sel, r)
+	}
+	return sel, nil
+}
+
+// splitRequirements 按逗号拆分条件（忽略括号内的逗号）
+func splitRequirements(text string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range text {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, text[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, text[start:])
+}
+
+var setPattern = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+
+func parseRequirement(part string) (Requirement, error) {
+	invalid := apperr.BadRequestf("invalid label selector %q", part)
+
+	if m := setPattern.FindStringSubmatch(part); m != nil {
+		r := Requirement{Key: m[1], Operator: Operator(m[2])}
+		for _, v := range strings.Split(m[3], ",") {
+			r.Values = append(r.Values, strings.TrimSpace(v))
+		}
+		return r, r.validate()
+	}
+
+	var r Requirement
+	switch {
+	case strings.HasPrefix(part, "!") && !strings.Contains(part, "="):
+		r = Requirement{Key: strings.TrimSpace(part[1:]), Operator: OpDoesNotExist}
+	case strings.Contains(part, "!="):
+		k, v, _ := strings.Cut(part, "!=")
+		r = Requirement{Key: strings.TrimSpace(k), Operator: OpNotEquals, Values: []string{strings.TrimSpace(v)}}
+	case strings.Contains(part, "="):
+		k, v, _ := strings.Cut(part, "=")
+		v = strings.TrimPrefix(v, "=") // 兼容 ==
+		r = Requirement{Key: strings.TrimSpace(k), Operator: OpEquals, Values: []string{strings.TrimSpace(v)}}
+	case strings.ContainsAny(part, " ()"):
+		return r, invalid
+	default:
+		r = Requirement{Key: part, Operator: OpExists}
+	}
+	if err := r.validate(); err != nil {
+		return r, invalid.WithDetail(err.Error())
+	}
+	return r, nil
+}
+
+func (r Requirement) validate() error {
+	if err := validateKey(r.Key); err != nil {
+		return apperr.BadRequest(err.Error())
+	}
+	for _, v := range r.Values {
+		if err := validateValue(v); err != nil {
+			return apperr.BadRequest(err.Error())
+		}
+	}
+	return nil
+}
+
+// ParseSet 解析 "k1=v1,k2=v2" 形式的标签集合（如命令行 / 环境变量中的节点标签）
+func ParseSet(text string) (map[string]string, error) {
+	set := make(map[string]string)
+	for _, part := range strings.Split(text, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, apperr.Validationf("invalid label %q: expected key=value", part)
+		}
+		set[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	if err := Validate(set); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// Keys 按字母序返回标签键
+func Keys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
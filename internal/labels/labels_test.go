@@ -0,0 +1,73 @@
+package labels
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	sel, err := Parse(" project=billing, ticket in (BIL-1, BIL-2),!archived,env!=dev, owner ,team==core")
+	require.NoError(t, err)
+	assert.Equal(t, Selector{
+		{Key: "project", Operator: OpEquals, Values: []string{"billing"}},
+		{Key: "ticket", Operator: OpIn, Values: []string{"BIL-1", "BIL-2"}},
+		{Key: "archived", Operator: OpDoesNotExist},
+		{Key: "env", Operator: OpNotEquals, Values: []string{"dev"}},
+		{Key: "owner", Operator: OpExists},
+		{Key: "team", Operator: OpEquals, Values: []string{"core"}},
+	}, sel)
+	assert.Equal(t, "project=billing,ticket in (BIL-1,BIL-2),!archived,env!=dev,owner,team=core", sel.String())
+
+	sel, err = Parse("")
+	require.NoError(t, err)
+	assert.True(t, sel.Empty())
+
+	_, err = Parse("project=billing,")
+	assert.NoError(t, err, "trailing comma is ignored")
+
+	for _, invalid := range []string{"project=bill ing", "bad key", "-x", "k in (a b)"} {
+		_, err := Parse(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestSelector_Matches(t *testing.T) {
+	labels := map[string]string{"project": "billing", "ticket": "BIL-1"}
+	for selector, want := range map[string]bool{
+		"project=billing":             true,
+		"project=search":              false,
+		"project!=search":             true,
+		"env!=dev":                    true,
+		"ticket notin (BIL-1)":        false,
+		"project in (search,billing)": true,
+		"ticket,!env":                 true,
+		"env":                         false,
+	} {
+		sel, err := Parse(selector)
+		require.NoError(t, err, selector)
+		assert.Equal(t, want, sel.Matches(labels), selector)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(map[string]string{"project": "billing", "team/owner": "", "ticket": "BIL-1"}))
+	assert.Error(t, Validate(map[string]string{"": "x"}))
+	assert.Error(t, Validate(map[string]string{"project": "a,b"}))
+
+	many := make(map[string]string)
+	for i := 0; i <= MaxLabels; i++ {
+		many[string(rune('a'+i%26))+string(rune('a'+i/26))] = "v"
+	}
+	assert.Error(t, Validate(many))
+}
+
+func TestParseSet(t *testing.T) {
+	set, err := ParseSet(" gpu=true, region=eu ,")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"gpu": "true", "region": "eu"}, set)
+
+	_, err = ParseSet("gpu")
+	assert.Error(t, err)
+}
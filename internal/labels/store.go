@@ -0,0 +1,111 @@
+package labels
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/tmalldedede/agentbox/internal/database"
+	"gorm.io/gorm"
+)
+
+// Apply 将选择器作为子查询条件追加到资源查询上，idColumn 为资源表主键列
+func (s Selector) Apply(db *gorm.DB, resource, idColumn string) *gorm.DB {
+	for _, r := range s {
+		sub := db.Session(&gorm.Session{NewDB: true}).Model(&database.LabelModel{}).
+			Select("resource_id").
+			Where("resource_type = ? AND key = ?", resource, r.Key)
+		if len(r.Values) > 0 {
+			sub = sub.Where("value IN ?", r.Values)
+		}
+		switch r.Operator {
+		case OpEquals, OpIn, OpExists:
+			db = db.Where(idColumn+" IN (?)", sub)
+		default:
+			db = db.Where(idColumn+" NOT IN (?)", sub)
+		}
+	}
+	return db
+}
+
+// Replace 在事务 tx 中替换资源的标签行
+func Replace(tx *gorm.DB, resource, id string, labels map[string]string) error {
+	if err := tx.Where("resource_type = ? AND resource_id = ?", resource, id).Delete(&database.LabelModel{}).Error; err != nil {
+		return err
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	rows := make([]database.LabelModel, 0, len(labels))
+	for _, k := range Keys(labels) {
+		rows = append(rows, database.LabelModel{ResourceType: resource, ResourceID: id, Key: k, Value: labels[k]})
+	}
+	return tx.Create(&rows).Error
+}
+
+// Set 更新资源表的 labels_json 列并替换标签行，资源不存在时返回 gorm.ErrRecordNotFound
+func Set(db *gorm.DB, model interface{}, resource, id string, labels map[string]string) error {
+	labelsJSON, _ := json.Marshal(labels)
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(model).Where("id = ?", id).Update("labels_json", string(labelsJSON))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return Replace(tx, resource, id, labels)
+	})
+}
+
+// Delete 删除资源的全部标签行
+func Delete(db *gorm.DB, resource string, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return db.Where("resource_type = ? AND resource_id IN ?", resource, ids).Delete(&database.LabelModel{}).Error
+}
+
+// Prune 删除资源已不存在的标签行，model 为资源表模型（批量清理后调用）
+func Prune(db *gorm.DB, model interface{}, resource string) error {
+	return db.Where("resource_type = ? AND resource_id NOT IN (?)", resource,
+		db.Session(&gorm.Session{NewDB: true}).Model(model).Select("id")).
+		Delete(&database.LabelModel{}).Error
+}
+
+// MaxBreakdownValues 按标签统计时每个键保留的最多取值数
+const MaxBreakdownValues = 10
+
+// Breakdown 统计 ids 子查询所选资源的标签分布：key -> value -> 数量（每个键保留数量最多的取值）
+func Breakdown(db *gorm.DB, resource string, ids *gorm.DB) (map[string]map[string]int, error) {
+	var rows []struct {
+		Key   string
+		Value string
+		Count int
+	}
+	if err := db.Model(&database.LabelModel{}).
+		Select("key, value, count(*) as count").
+		Where("resource_type = ? AND resource_id IN (?)", resource, ids).
+		Group("key, value").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].Count != rows[j].Count {
+			return rows[i].Count > rows[j].Count
+		}
+		return rows[i].Value < rows[j].Value
+	})
+	result := make(map[string]map[string]int)
+	for _, r := range rows {
+		values := result[r.Key]
+		if values == nil {
+			values = make(map[string]int)
+			result[r.Key] = values
+		}
+		if len(values) < MaxBreakdownValues {
+			values[r.Value] = r.Count
+		}
+	}
+	return result, nil
+}
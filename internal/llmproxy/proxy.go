@@ -0,0 +1,377 @@
+// Package llmproxy 内置的 LLM 凭证代理：容器只拿到会话级 token 与指向 AgentBox 的 base URL，
+// 代理在转发 Anthropic / OpenAI 兼容请求时换入真实 API Key（按 Provider 的 Key 轮换选择），
+// 并按请求计量 Token、执行任务级 Token 预算、统计各 Provider 的请求 / 延迟 / 错误。
+//
+// 会话凭证只保存在本实例内存中，多实例部署时容器的回调地址需指向创建会话的实例。
+package llmproxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmalldedede/agentbox/internal/logger"
+)
+
+var log = logger.Module("llmproxy")
+
+// API 类型（代理路径 /llm-proxy/{api}/... 的第一段）
+const (
+	APIAnthropic = "anthropic"
+	APIOpenAI    = "openai"
+)
+
+const (
+	// Path 代理端点在 AgentBox 上的路径前缀
+	Path = "/api/v1/llm-proxy"
+
+	// DefaultTokenTTL 会话 token 的默认空闲有效期（每次请求顺延）
+	DefaultTokenTTL = 24 * time.Hour
+
+	tokenPrefix = "abx-"
+)
+
+// 未配置 base URL 时的官方上游地址
+var defaultUpstreams = map[string]string{
+	APIAnthropic: "https://api.anthropic.com",
+	APIOpenAI:    "https://api.openai.com/v1",
+}
+
+// 会话环境变量中的凭证：变量名 → API 类型
+var credentialVars = map[string]string{
+	"ANTHROPIC_API_KEY":    APIAnthropic,
+	"ANTHROPIC_AUTH_TOKEN": APIAnthropic,
+	"OPENAI_API_KEY":       APIOpenAI,
+}
+
+// 各 API 类型的 base URL 环境变量
+var baseURLVars = map[string]string{
+	APIAnthropic: "ANTHROPIC_BASE_URL",
+	APIOpenAI:    "OPENAI_BASE_URL",
+}
+
+// KeyStore 提供 Provider 的真实 API Key 与轮换反馈（provider.Manager 实现）
+type KeyStore interface {
+	GetDecryptedKeys(providerID string) []string
+	GetDecryptedKeyWithRotation(providerID string) (apiKey, profileID string, err error)
+	MarkProfileFailed(providerID, profileID string, reason string)
+	MarkProfileSuccess(providerID, profileID string)
+}
+
+// Grant 签发会话 token 的参数
+type Grant struct {
+	SessionID   string
+	ProviderID  string // 真实 Key 所属的 Provider
+	BudgetKey   string // 共享 Token 预算的键（如任务 ID），为空时按会话计
+	TokenBudget int64  // 输入 + 输出 Token 上限，0 表示不限
+}
+
+// Usage Token 用量
+type Usage struct {
+	InputTokens       int64 `json:"input_tokens"`
+	CachedInputTokens int64 `json:"cached_input_tokens"`
+	OutputTokens      int64 `json:"output_tokens"`
+}
+
+// Total 计入预算的 Token 数（输入 + 输出）
+func (u Usage) Total() int64 {
+	return u.InputTokens + u.OutputTokens
+}
+
+func (u *Usage) add(o Usage) {
+	u.InputTokens += o.InputTokens
+	u.CachedInputTokens += o.CachedInputTokens
+	u.OutputTokens += o.OutputTokens
+}
+
+// ProviderStats 单个 Provider 经代理的请求统计
+type ProviderStats struct {
+	ProviderID    string     `json:"provider_id"`
+	Requests      int64      `json:"requests"`
+	Errors        int64      `json:"errors"`       // 上游错误响应与网络错误
+	RateLimited   int64      `json:"rate_limited"` // 上游 429
+	Failovers     int64      `json:"failovers"`    // 换用其他 Key 重试的次数
+	Rejected      int64      `json:"rejected"`     // 因超出 Token 预算被拒绝
+	AvgLatencyMs  int64      `json:"avg_latency_ms"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastRequestAt *time.Time `json:"last_request_at,omitempty"`
+	Usage
+
+	totalLatency time.Duration
+}
+
+// session 一个已签发的会话 token
+type session struct {
+	Grant
+	upstreams    map[string]string // API 类型 → 上游 base URL
+	fallbackKeys map[string]string // API 类型 → 会话环境中原有的 Key（Provider 未配置 Key 时使用）
+	expiresAt    time.Time
+}
+
+// budget 同一预算键下所有会话的累计用量
+type budget struct {
+	used     Usage
+	lastUsed time.Time
+}
+
+// Proxy LLM 凭证代理
+type Proxy struct {
+	keys     KeyStore
+	baseURL  string // 容器内访问代理的地址（{callback}/api/v1/llm-proxy）
+	tokenTTL time.Duration
+	client   *http.Client
+
+	mu        sync.Mutex
+	sessions  map[string]*session // token → session
+	bySession map[string]string   // sessionID → token
+	budgets   map[string]*budget
+	stats     map[string]*ProviderStats
+}
+
+// New 创建 LLM 凭证代理，callbackURL 为容器内访问 AgentBox 的基础地址
+func New(keys KeyStore, callbackURL string, tokenTTL time.Duration) *Proxy {
+	if tokenTTL <= 0 {
+		tokenTTL = DefaultTokenTTL
+	}
+	return &Proxy{
+		keys:      keys,
+		baseURL:   strings.TrimRight(callbackURL, "/") + Path,
+		tokenTTL:  tokenTTL,
+		client:    &http.Client{},
+		sessions:  make(map[string]*session),
+		bySession: make(map[string]string),
+		budgets:   make(map[string]*budget),
+		stats:     make(map[string]*ProviderStats),
+	}
+}
+
+// BaseURL 返回容器内访问指定 API 类型代理的 base URL
+func (p *Proxy) BaseURL(api string) string {
+	return p.baseURL + "/" + api
+}
+
+// Issue 为会话签发 token 并改写环境变量：值等于 Provider 真实 Key 的变量（不限变量名）
+// 与已知凭证变量均替换为 token，base URL 指向代理，原 base URL 作为上游地址保留在代理侧。
+// 环境中没有凭证时原样返回；凭证无法经代理转发（没有可代理的凭证变量）时返回错误。
+func (p *Proxy) Issue(g *Grant, env map[string]string) (map[string]string, error) {
+	secrets := make(map[string]bool)
+	if g.ProviderID != "" {
+		for _, k := range p.keys.GetDecryptedKeys(g.ProviderID) {
+			secrets[k] = true
+		}
+	}
+	fallbackKeys := make(map[string]string)
+	for name, api := range credentialVars {
+		if v := env[name]; v != "" {
+			fallbackKeys[api] = v
+			secrets[v] = true
+		}
+	}
+	var leaked []string
+	for name, v := range env {
+		if _, known := credentialVars[name]; !known && secrets[v] {
+			leaked = append(leaked, name)
+		}
+	}
+	if len(fallbackKeys) == 0 {
+		if len(leaked) > 0 {
+			sort.Strings(leaked)
+			return nil, fmt.Errorf("provider %s: credential in %s cannot be proxied", g.ProviderID, strings.Join(leaked, ", "))
+		}
+		return env, nil
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	s := &session{
+		Grant:        *g,
+		upstreams:    make(map[string]string),
+		fallbackKeys: fallbackKeys,
+		expiresAt:    time.Now().Add(p.tokenTTL),
+	}
+	if s.BudgetKey == "" {
+		s.BudgetKey = g.SessionID
+	}
+
+	out := make(map[string]string, len(env)+len(fallbackKeys))
+	for k, v := range env {
+		if secrets[v] {
+			v = token
+		}
+		out[k] = v
+	}
+	for name, api := range credentialVars {
+		if env[name] != "" {
+			out[name] = token
+		}
+		if _, ok := fallbackKeys[api]; !ok {
+			continue
+		}
+		upstream := strings.TrimRight(env[baseURLVars[api]], "/")
+		if upstream == "" {
+			upstream = defaultUpstreams[api]
+		}
+		s.upstreams[api] = upstream
+		out[baseURLVars[api]] = p.BaseURL(api)
+	}
+
+	p.mu.Lock()
+	p.purgeLocked(time.Now())
+	if old, ok := p.bySession[g.SessionID]; ok {
+		delete(p.sessions, old)
+	}
+	p.sessions[token] = s
+	p.bySession[g.SessionID] = token
+	p.mu.Unlock()
+
+	log.Debug("session token issued", "session_id", g.SessionID, "provider", g.ProviderID, "budget", g.TokenBudget)
+	return out, nil
+}
+
+// Revoke 撤销会话的 token（会话删除时调用）
+func (p *Proxy) Revoke(sessionID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if token, ok := p.bySession[sessionID]; ok {
+		delete(p.sessions, token)
+		delete(p.bySession, sessionID)
+	}
+}
+
+// BudgetUsage 返回预算键（任务 ID 或会话 ID）下经代理的累计用量
+func (p *Proxy) BudgetUsage(key string) Usage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if b, ok := p.budgets[key]; ok {
+		return b.used
+	}
+	return Usage{}
+}
+
+// Stats 返回各 Provider 的代理统计（按 Provider ID 排序）
+func (p *Proxy) Stats() []*ProviderStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	result := make([]*ProviderStats, 0, len(p.stats))
+	for _, st := range p.stats {
+		cp := *st
+		if cp.Requests > 0 {
+			cp.AvgLatencyMs = (st.totalLatency / time.Duration(cp.Requests)).Milliseconds()
+		}
+		result = append(result, &cp)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ProviderID < result[j].ProviderID })
+	return result
+}
+
+// ActiveSessions 返回当前有效的会话 token 数
+func (p *Proxy) ActiveSessions() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.purgeLocked(time.Now())
+	return len(p.sessions)
+}
+
+// lookup 按 token 查找会话并顺延有效期
+func (p *Proxy) lookup(token string) (*session, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, ok := p.sessions[token]
+	if !ok {
+		return nil, false
+	}
+	now := time.Now()
+	if now.After(s.expiresAt) {
+		delete(p.sessions, token)
+		delete(p.bySession, s.SessionID)
+		return nil, false
+	}
+	s.expiresAt = now.Add(p.tokenTTL)
+	return s, true
+}
+
+// overBudget 检查会话所属预算是否已用尽
+func (p *Proxy) overBudget(s *session) bool {
+	if s.TokenBudget <= 0 {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b, ok := p.budgets[s.BudgetKey]
+	return ok && b.used.Total() >= s.TokenBudget
+}
+
+// purgeLocked 清理过期 token 与空闲超过有效期的预算记录（调用方持有锁）
+func (p *Proxy) purgeLocked(now time.Time) {
+	for token, s := range p.sessions {
+		if now.After(s.expiresAt) {
+			delete(p.sessions, token)
+			delete(p.bySession, s.SessionID)
+		}
+	}
+	for key, b := range p.budgets {
+		if now.Sub(b.lastUsed) > p.tokenTTL {
+			delete(p.budgets, key)
+		}
+	}
+}
+
+// record 记录一次请求的结果与用量
+func (p *Proxy) record(s *session, latency time.Duration, status int, errMsg string, usage Usage, failovers int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	st := p.stats[s.ProviderID]
+	if st == nil {
+		st = &ProviderStats{ProviderID: s.ProviderID}
+		p.stats[s.ProviderID] = st
+	}
+	now := time.Now()
+	st.Requests++
+	st.totalLatency += latency
+	st.LastRequestAt = &now
+	st.Failovers += int64(failovers)
+	if status == http.StatusTooManyRequests {
+		st.RateLimited++
+	}
+	if errMsg != "" {
+		st.Errors++
+		st.LastError = errMsg
+	}
+	st.Usage.add(usage)
+
+	b := p.budgets[s.BudgetKey]
+	if b == nil {
+		b = &budget{}
+		p.budgets[s.BudgetKey] = b
+	}
+	b.used.add(usage)
+	b.lastUsed = now
+}
+
+// reject 记录一次因预算被拒绝的请求
+func (p *Proxy) reject(s *session) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st := p.stats[s.ProviderID]
+	if st == nil {
+		st = &ProviderStats{ProviderID: s.ProviderID}
+		p.stats[s.ProviderID] = st
+	}
+	st.Rejected++
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return tokenPrefix + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,239 @@
+package llmproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeKeys 按顺序返回未失败的 Key（profile ID 即 Key）
+type fakeKeys struct {
+	keys   []string
+	failed map[string]string
+}
+
+func (f *fakeKeys) GetDecryptedKeyWithRotation(providerID string) (string, string, error) {
+	for _, k := range f.keys {
+		if _, bad := f.failed[k]; !bad {
+			return k, k, nil
+		}
+	}
+	return "", "", io.EOF
+}
+
+func (f *fakeKeys) GetDecryptedKeys(providerID string) []string {
+	return f.keys
+}
+
+func (f *fakeKeys) MarkProfileFailed(providerID, profileID, reason string) {
+	f.failed[profileID] = reason
+}
+
+func (f *fakeKeys) MarkProfileSuccess(providerID, profileID string) {}
+
+func newTestProxy(t *testing.T, upstream http.HandlerFunc, keys ...string) (*Proxy, *fakeKeys, string) {
+	t.Helper()
+	srv := httptest.NewServer(upstream)
+	t.Cleanup(srv.Close)
+	fk := &fakeKeys{keys: keys, failed: map[string]string{}}
+	return New(fk, "http://agentbox:18080/", 0), fk, srv.URL
+}
+
+func call(p *Proxy, api, path, header, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, Path+"/"+api+path, strings.NewReader(body))
+	if header == "X-Api-Key" {
+		req.Header.Set(header, token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	p.Serve(rec, req, api, path)
+	return rec
+}
+
+func TestIssue_RewritesEnv(t *testing.T) {
+	p := New(&fakeKeys{}, "http://agentbox:18080/", 0)
+
+	env, err := p.Issue(&Grant{SessionID: "s1", ProviderID: "zhipu"}, map[string]string{
+		"ANTHROPIC_API_KEY":  "sk-real",
+		"ANTHROPIC_BASE_URL": "https://open.bigmodel.cn/api/anthropic/",
+		"OTHER":              "x",
+	})
+	require.NoError(t, err)
+	token := env["ANTHROPIC_API_KEY"]
+	assert.True(t, strings.HasPrefix(token, tokenPrefix))
+	assert.Equal(t, "http://agentbox:18080/api/v1/llm-proxy/anthropic", env["ANTHROPIC_BASE_URL"])
+	assert.Equal(t, "x", env["OTHER"])
+	assert.NotContains(t, env, "OPENAI_BASE_URL")
+
+	s, ok := p.lookup(token)
+	require.True(t, ok)
+	assert.Equal(t, "https://open.bigmodel.cn/api/anthropic", s.upstreams[APIAnthropic])
+	assert.Equal(t, "s1", s.BudgetKey)
+
+	// 重新签发后旧 token 失效；撤销后新 token 失效
+	env2, err := p.Issue(&Grant{SessionID: "s1"}, map[string]string{"OPENAI_API_KEY": "sk-real"})
+	require.NoError(t, err)
+	_, ok = p.lookup(token)
+	assert.False(t, ok)
+	assert.Equal(t, "http://agentbox:18080/api/v1/llm-proxy/openai", env2["OPENAI_BASE_URL"])
+	p.Revoke("s1")
+	_, ok = p.lookup(env2["OPENAI_API_KEY"])
+	assert.False(t, ok)
+
+	// 没有凭证的环境原样返回
+	plain := map[string]string{"FOO": "bar"}
+	out, err := p.Issue(&Grant{SessionID: "s2"}, plain)
+	require.NoError(t, err)
+	assert.Equal(t, plain, out)
+	assert.Zero(t, p.ActiveSessions())
+}
+
+func TestIssue_NonStandardCredentialVars(t *testing.T) {
+	p := New(&fakeKeys{keys: []string{"sk-azure"}}, "http://agentbox:18080/", 0)
+
+	// Provider 模板把真实 Key 填入所有空变量（如 Azure 的 AZURE_OPENAI_KEY）：一并替换
+	env, err := p.Issue(&Grant{SessionID: "s1", ProviderID: "azure-openai"}, map[string]string{
+		"OPENAI_API_KEY":   "sk-azure",
+		"AZURE_OPENAI_KEY": "sk-azure",
+		"OPENAI_BASE_URL":  "https://res.openai.azure.com/openai",
+	})
+	require.NoError(t, err)
+	token := env["OPENAI_API_KEY"]
+	assert.True(t, strings.HasPrefix(token, tokenPrefix))
+	assert.Equal(t, token, env["AZURE_OPENAI_KEY"])
+	for _, v := range env {
+		assert.NotEqual(t, "sk-azure", v)
+	}
+
+	// Key 只出现在无法代理的变量中：拒绝签发，而不是把真实 Key 交给容器
+	_, err = p.Issue(&Grant{SessionID: "s2", ProviderID: "custom"}, map[string]string{
+		"CUSTOM_LLM_KEY": "sk-azure",
+		"FOO":            "bar",
+	})
+	assert.ErrorContains(t, err, "CUSTOM_LLM_KEY cannot be proxied")
+	assert.Equal(t, 1, p.ActiveSessions())
+}
+
+func TestServe_SwapsKeyAndMeters(t *testing.T) {
+	p, _, upstream := newTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		assert.Equal(t, "beta=1", r.URL.RawQuery)
+		assert.Equal(t, "sk-one", r.Header.Get("X-Api-Key"))
+		assert.Empty(t, r.Header.Get("Authorization"))
+		assert.Equal(t, "2023-06-01", r.Header.Get("Anthropic-Version"))
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"content":[],"usage":{"input_tokens":100,"cache_read_input_tokens":20,"output_tokens":30}}`)
+	}, "sk-one")
+
+	env, err := p.Issue(&Grant{SessionID: "s1", ProviderID: "anthropic", BudgetKey: "task-1"}, map[string]string{
+		"ANTHROPIC_API_KEY": "sk-env", "ANTHROPIC_BASE_URL": upstream,
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, Path+"/anthropic/v1/messages?beta=1", strings.NewReader(`{}`))
+	req.Header.Set("X-Api-Key", env["ANTHROPIC_API_KEY"])
+	req.Header.Set("Anthropic-Version", "2023-06-01")
+	rec := httptest.NewRecorder()
+	p.Serve(rec, req, APIAnthropic, "/v1/messages")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"output_tokens":30`)
+
+	assert.Equal(t, Usage{InputTokens: 100, CachedInputTokens: 20, OutputTokens: 30}, p.BudgetUsage("task-1"))
+	stats := p.Stats()
+	require.Len(t, stats, 1)
+	assert.Equal(t, "anthropic", stats[0].ProviderID)
+	assert.Equal(t, int64(1), stats[0].Requests)
+	assert.Zero(t, stats[0].Errors)
+	assert.Equal(t, int64(130), stats[0].Usage.Total())
+
+	rec = call(p, APIAnthropic, "/v1/messages", "X-Api-Key", "abx-unknown", `{}`)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), "authentication_error")
+	rec = call(p, APIOpenAI, "/chat/completions", "Bearer", env["ANTHROPIC_API_KEY"], `{}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestServe_FailsOverToNextKey(t *testing.T) {
+	p, fk, upstream := newTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "Bearer sk-limited":
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		case "Bearer sk-env":
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "Bearer sk-ok", r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, `{"model":"gpt-4o"}`, string(body))
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"usage":{"prompt_tokens":10,"completion_tokens":5,"prompt_tokens_details":{"cached_tokens":4}}}`)
+	}, "sk-limited", "sk-ok")
+
+	env, err := p.Issue(&Grant{SessionID: "s1", ProviderID: "openai"}, map[string]string{
+		"OPENAI_API_KEY": "sk-env", "OPENAI_BASE_URL": upstream,
+	})
+	require.NoError(t, err)
+
+	rec := call(p, APIOpenAI, "/chat/completions", "Bearer", env["OPENAI_API_KEY"], `{"model":"gpt-4o"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "rate_limit", fk.failed["sk-limited"])
+	assert.Equal(t, Usage{InputTokens: 10, CachedInputTokens: 4, OutputTokens: 5}, p.BudgetUsage("s1"))
+	stats := p.Stats()
+	assert.Equal(t, int64(1), stats[0].Failovers)
+
+	// 所有 Key 均不可用时使用会话环境中原有的 Key
+	fk.failed["sk-ok"] = "auth_failed"
+	rec = call(p, APIOpenAI, "/chat/completions", "Bearer", env["OPENAI_API_KEY"], `{"model":"gpt-4o"}`)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	stats = p.Stats()
+	assert.Equal(t, int64(2), stats[0].Requests)
+	assert.Equal(t, int64(1), stats[0].Errors)
+	assert.Equal(t, "upstream status 401", stats[0].LastError)
+}
+
+func TestServe_EnforcesBudget(t *testing.T) {
+	p, _, upstream := newTestProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":60,\"output_tokens\":1}}}\n\n")
+		io.WriteString(w, "event: message_delta\ndata: {\"type\":\"message_delta\",\"usage\":{\"output_tokens\":50}}\n\n")
+	}, "sk-one")
+
+	grant := &Grant{ProviderID: "anthropic", BudgetKey: "task-1", TokenBudget: 100}
+	env := map[string]string{"ANTHROPIC_AUTH_TOKEN": "sk-env", "ANTHROPIC_BASE_URL": upstream}
+	grant.SessionID = "s1"
+	env1, err := p.Issue(grant, env)
+	require.NoError(t, err)
+
+	rec := call(p, APIAnthropic, "/v1/messages", "Bearer", env1["ANTHROPIC_AUTH_TOKEN"], `{"stream":true}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "message_delta")
+	assert.Equal(t, Usage{InputTokens: 60, OutputTokens: 50}, p.BudgetUsage("task-1"))
+
+	// 同一任务的其他会话共享预算
+	grant.SessionID = "s2"
+	env2, err := p.Issue(grant, env)
+	require.NoError(t, err)
+	rec = call(p, APIAnthropic, "/v1/messages", "Bearer", env2["ANTHROPIC_AUTH_TOKEN"], `{}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "budget_exceeded")
+	assert.Equal(t, int64(1), p.Stats()[0].Rejected)
+}
+
+func TestMeter_OpenAIResponsesStream(t *testing.T) {
+	m := &meter{sse: true}
+	stream := "data: {\"type\":\"response.created\",\"response\":{\"usage\":null}}\n\n" +
+		"data: {\"type\":\"response.completed\",\"response\":{\"usage\":{\"input_tokens\":7,\"output_tokens\":3,\"input_tokens_details\":{\"cached_tokens\":2}}}}\n\n" +
+		"data: [DONE]"
+	// 分块写入，事件跨块
+	for i := 0; i < len(stream); i += 16 {
+		m.Write([]byte(stream[i:min(i+16, len(stream))]))
+	}
+	assert.Equal(t, Usage{InputTokens: 7, CachedInputTokens: 2, OutputTokens: 3}, m.finish())
+}
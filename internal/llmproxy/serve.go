@@ -0,0 +1,225 @@
+package llmproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tmalldedede/agentbox/internal/apperr"
+)
+
+const (
+	maxRequestBody = 32 << 20 // 请求体上限（需缓存以便换 Key 重试）
+	maxAttempts    = 3        // 单个请求最多尝试的 Key 数
+)
+
+// 不转发的逐跳头与由代理重新设置的头
+var skipHeaders = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+	"Content-Length":      true,
+	"Host":                true,
+	"Authorization":       true,
+	"X-Api-Key":           true,
+	"Accept-Encoding":     true, // 由 Transport 协商压缩并解压，便于计量
+}
+
+// Serve 转发 {Path}/{api}{path} 的请求：校验会话 token 与预算，换入真实 Key 后转发到上游，
+// 认证失败或限流时标记该 Key 并换用下一个可用 Key 重试，响应原样（含 SSE 流）返回并计量 Token
+func (p *Proxy) Serve(w http.ResponseWriter, r *http.Request, api, path string) {
+	if _, ok := defaultUpstreams[api]; !ok {
+		writeError(w, api, http.StatusNotFound, "not_found_error", "unknown API: "+api)
+		return
+	}
+	token, bearer := requestToken(r)
+	s, ok := p.lookup(token)
+	if !ok {
+		writeError(w, api, http.StatusUnauthorized, "authentication_error", "invalid or expired session token")
+		return
+	}
+	upstream, ok := s.upstreams[api]
+	if !ok {
+		writeError(w, api, http.StatusForbidden, "permission_error", "session has no credentials for this API")
+		return
+	}
+	if p.overBudget(s) {
+		p.reject(s)
+		writeError(w, api, http.StatusForbidden, "budget_exceeded", fmt.Sprintf("token budget of %d exhausted", s.TokenBudget))
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBody+1))
+	if err != nil {
+		writeError(w, api, http.StatusBadRequest, "invalid_request_error", "failed to read request body")
+		return
+	}
+	if len(body) > maxRequestBody {
+		writeError(w, api, http.StatusRequestEntityTooLarge, "invalid_request_error", "request body too large")
+		return
+	}
+
+	target := upstream + path
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+
+	start := time.Now()
+	key, profileID, err := p.keys.GetDecryptedKeyWithRotation(s.ProviderID)
+	if err != nil || key == "" {
+		if s.fallbackKeys[api] == "" {
+			msg := "no API key available"
+			if err != nil {
+				msg += ": " + err.Error()
+			}
+			p.record(s, time.Since(start), 0, msg, Usage{}, 0)
+			writeError(w, api, http.StatusBadGateway, "api_error", msg)
+			return
+		}
+		key, profileID = s.fallbackKeys[api], ""
+	}
+
+	tried := map[string]bool{profileID: true}
+	failovers := 0
+	for attempt := 1; ; attempt++ {
+		resp, err := p.forward(r, target, body, key, bearer)
+		if err != nil {
+			p.record(s, time.Since(start), 0, err.Error(), Usage{}, failovers)
+			writeError(w, api, http.StatusBadGateway, "api_error", "upstream request failed: "+err.Error())
+			return
+		}
+
+		reason := keyFailure(resp.StatusCode)
+		if profileID != "" {
+			if reason != "" {
+				p.keys.MarkProfileFailed(s.ProviderID, profileID, string(reason))
+			} else if resp.StatusCode < 400 {
+				p.keys.MarkProfileSuccess(s.ProviderID, profileID)
+			}
+		}
+		if reason != "" && profileID != "" && attempt < maxAttempts {
+			nextKey, nextProfile, err := p.keys.GetDecryptedKeyWithRotation(s.ProviderID)
+			if err == nil && nextProfile != "" && !tried[nextProfile] {
+				resp.Body.Close()
+				log.Info("failing over to next API key", "provider", s.ProviderID, "from", profileID, "to", nextProfile, "status", resp.StatusCode)
+				key, profileID = nextKey, nextProfile
+				tried[profileID] = true
+				failovers++
+				continue
+			}
+		}
+
+		usage := relay(w, resp)
+		resp.Body.Close()
+		errMsg := ""
+		if resp.StatusCode >= 400 {
+			errMsg = fmt.Sprintf("upstream status %d", resp.StatusCode)
+		}
+		p.record(s, time.Since(start), resp.StatusCode, errMsg, usage, failovers)
+		return
+	}
+}
+
+// forward 以真实 Key 向上游发送请求（保持客户端使用的认证头形式）
+func (p *Proxy) forward(r *http.Request, target string, body []byte, key string, bearer bool) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range r.Header {
+		if skipHeaders[http.CanonicalHeaderKey(k)] {
+			continue
+		}
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	if bearer {
+		req.Header.Set("Authorization", "Bearer "+key)
+	} else {
+		req.Header.Set("X-Api-Key", key)
+	}
+	return p.client.Do(req)
+}
+
+// relay 将上游响应写回客户端（SSE 逐块刷新）并返回计量到的用量
+func relay(w http.ResponseWriter, resp *http.Response) Usage {
+	for k, vs := range resp.Header {
+		if skipHeaders[http.CanonicalHeaderKey(k)] {
+			continue
+		}
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	m := &meter{sse: strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")}
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			m.Write(buf[:n])
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				break // 客户端已断开
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	return m.finish()
+}
+
+// requestToken 从 x-api-key 或 Authorization: Bearer 头读取会话 token
+func requestToken(r *http.Request) (token string, bearer bool) {
+	if v := r.Header.Get("X-Api-Key"); v != "" {
+		return v, false
+	}
+	if v := r.Header.Get("Authorization"); strings.HasPrefix(v, "Bearer ") {
+		return strings.TrimPrefix(v, "Bearer "), true
+	}
+	return "", false
+}
+
+// keyFailure 判断上游响应是否说明当前 Key 不可用（换用其他 Key 可能成功）
+func keyFailure(status int) apperr.FailoverReason {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return apperr.ReasonAuthFailed
+	case http.StatusTooManyRequests:
+		return apperr.ReasonRateLimit
+	}
+	return ""
+}
+
+// writeError 按 API 类型的错误格式返回代理自身的错误（客户端可正常解析）
+func writeError(w http.ResponseWriter, api string, status int, errType, msg string) {
+	var body interface{}
+	if api == APIOpenAI {
+		body = map[string]interface{}{
+			"error": map[string]string{"message": msg, "type": errType, "code": errType},
+		}
+	} else {
+		body = map[string]interface{}{
+			"type":  "error",
+			"error": map[string]string{"type": errType, "message": msg},
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
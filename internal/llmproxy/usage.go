@@ -0,0 +1,139 @@
+package llmproxy
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// maxMeteredBody 非流式响应用于解析用量的最大缓存字节数（超出时不计量）
+const maxMeteredBody = 8 << 20
+
+// usageFields Anthropic / OpenAI（Chat Completions 与 Responses）响应中的 usage 字段
+type usageFields struct {
+	InputTokens          int64 `json:"input_tokens"`
+	OutputTokens         int64 `json:"output_tokens"`
+	CacheReadInputTokens int64 `json:"cache_read_input_tokens"`
+	PromptTokens         int64 `json:"prompt_tokens"`
+	CompletionTokens     int64 `json:"completion_tokens"`
+	PromptTokensDetails  *struct {
+		CachedTokens int64 `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+	InputTokensDetails *struct {
+		CachedTokens int64 `json:"cached_tokens"`
+	} `json:"input_tokens_details"`
+}
+
+func (f *usageFields) usage() Usage {
+	u := Usage{
+		InputTokens:       f.InputTokens + f.PromptTokens,
+		CachedInputTokens: f.CacheReadInputTokens,
+		OutputTokens:      f.OutputTokens + f.CompletionTokens,
+	}
+	if f.PromptTokensDetails != nil {
+		u.CachedInputTokens += f.PromptTokensDetails.CachedTokens
+	}
+	if f.InputTokensDetails != nil {
+		u.CachedInputTokens += f.InputTokensDetails.CachedTokens
+	}
+	return u
+}
+
+// usageEnvelope usage 可能出现的位置：响应体顶层、Anthropic message_start 的 message、
+// OpenAI Responses 流事件的 response
+type usageEnvelope struct {
+	Usage   *usageFields `json:"usage"`
+	Message *struct {
+		Usage *usageFields `json:"usage"`
+	} `json:"message"`
+	Response *struct {
+		Usage *usageFields `json:"usage"`
+	} `json:"response"`
+}
+
+// meter 从响应体中解析 Token 用量：非流式响应解析整个 JSON，SSE 逐条解析 data 事件。
+// 流事件中的用量是累计值（如 Anthropic message_delta 的 output_tokens），各字段取最大值。
+// OpenAI Chat Completions 流式请求未开启 stream_options.include_usage 时无法计量。
+type meter struct {
+	sse      bool
+	buf      bytes.Buffer
+	overflow bool
+	usage    Usage
+}
+
+func (m *meter) Write(b []byte) {
+	if !m.sse {
+		if m.overflow || m.buf.Len()+len(b) > maxMeteredBody {
+			m.overflow = true
+			return
+		}
+		m.buf.Write(b)
+		return
+	}
+	m.buf.Write(b)
+	for {
+		line, err := m.buf.ReadBytes('\n')
+		if err != nil {
+			// 不完整的行留待下次写入
+			m.buf.Reset()
+			m.buf.Write(line)
+			return
+		}
+		m.event(line)
+	}
+}
+
+// event 解析一行 SSE
+func (m *meter) event(line []byte) {
+	line = bytes.TrimSpace(line)
+	if !bytes.HasPrefix(line, []byte("data:")) {
+		return
+	}
+	data := bytes.TrimSpace(line[len("data:"):])
+	if len(data) == 0 || data[0] != '{' {
+		return // 如 [DONE]
+	}
+	m.parse(data)
+}
+
+func (m *meter) parse(data []byte) {
+	var env usageEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return
+	}
+	for _, f := range []*usageFields{env.Usage, messageUsage(&env), responseUsage(&env)} {
+		if f != nil {
+			m.merge(f.usage())
+		}
+	}
+}
+
+func (m *meter) merge(u Usage) {
+	m.usage.InputTokens = max(m.usage.InputTokens, u.InputTokens)
+	m.usage.CachedInputTokens = max(m.usage.CachedInputTokens, u.CachedInputTokens)
+	m.usage.OutputTokens = max(m.usage.OutputTokens, u.OutputTokens)
+}
+
+// finish 处理剩余数据并返回用量
+func (m *meter) finish() Usage {
+	if m.sse {
+		m.event(m.buf.Bytes())
+	} else if !m.overflow {
+		m.parse(m.buf.Bytes())
+	}
+	m.buf.Reset()
+	return m.usage
+}
+
+func messageUsage(env *usageEnvelope) *usageFields {
+	if env.Message == nil {
+		return nil
+	}
+	return env.Message.Usage
+}
+
+func responseUsage(env *usageEnvelope) *usageFields {
+	if env.Response == nil {
+		return nil
+	}
+	return env.Response.Usage
+}
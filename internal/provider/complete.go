@@ -0,0 +1,154 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// completionMaxTokens bounds the length of a single completion
+const completionMaxTokens = 1024
+
+// Complete sends a single-turn prompt to a configured provider and returns the text reply.
+// Providers supporting claude-code use the Anthropic Messages API; all others use
+// OpenAI-compatible chat completions. An empty model falls back to the provider default.
+func (m *Manager) Complete(ctx context.Context, id string, model string, prompt string) (string, error) {
+	m.mu.RLock()
+	p, ok := m.providers[id]
+	if !ok {
+		m.mu.RUnlock()
+		return "", ErrProviderNotFound
+	}
+	keyData, ok := m.keys[id]
+	if !ok {
+		m.mu.RUnlock()
+		return "", ErrKeyNotConfigured
+	}
+	apiKey, err := m.crypto.Decrypt(keyData.EncryptedKey)
+	if err != nil {
+		m.mu.RUnlock()
+		return "", ErrDecryptionFailed
+	}
+	baseURL := p.BaseURL
+	anthropic := false
+	for _, a := range p.Agents {
+		if a == AgentClaudeCode {
+			anthropic = true
+			break
+		}
+	}
+	if model == "" {
+		model = p.DefaultModel
+	}
+	m.mu.RUnlock()
+
+	if model == "" {
+		return "", fmt.Errorf("no model specified and provider %s has no default model", id)
+	}
+	if anthropic {
+		if baseURL == "" {
+			baseURL = "https://api.anthropic.com"
+		}
+		return m.completeAnthropic(ctx, baseURL, apiKey, model, prompt)
+	}
+	if baseURL == "" {
+		baseURL = "https://api.openai.com/v1"
+	}
+	return m.completeOpenAI(ctx, baseURL, apiKey, model, prompt)
+}
+
+// completeAnthropic calls Anthropic /v1/messages
+func (m *Manager) completeAnthropic(ctx context.Context, baseURL, apiKey, model, prompt string) (string, error) {
+	body := map[string]interface{}{
+		"model":      model,
+		"max_tokens": completionMaxTokens,
+		"messages":   []map[string]string{{"role": "user", "content": prompt}},
+	}
+	headers := map[string]string{
+		"x-api-key":         apiKey,
+		"anthropic-version": "2023-06-01",
+	}
+
+	var resp struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+	}
+	if err := postJSON(ctx, strings.TrimRight(baseURL, "/")+"/v1/messages", headers, body, &resp); err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for _, c := range resp.Content {
+		if c.Type == "text" {
+			sb.WriteString(c.Text)
+		}
+	}
+	return sb.String(), nil
+}
+
+// completeOpenAI calls OpenAI-compatible /chat/completions
+func (m *Manager) completeOpenAI(ctx context.Context, baseURL, apiKey, model, prompt string) (string, error) {
+	body := map[string]interface{}{
+		"model":      model,
+		"max_tokens": completionMaxTokens,
+		"messages":   []map[string]string{{"role": "user", "content": prompt}},
+	}
+	headers := map[string]string{"Authorization": "Bearer " + apiKey}
+
+	var resp struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := postJSON(ctx, strings.TrimRight(baseURL, "/")+"/chat/completions", headers, body, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", errors.New("completion returned no choices")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+// postJSON posts a JSON body and decodes a successful JSON response into out
+func postJSON(ctx context.Context, url string, headers map[string]string, body interface{}, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg := strings.TrimSpace(string(respBody))
+		if len(msg) > 300 {
+			msg = msg[:300]
+		}
+		return fmt.Errorf("completion failed: HTTP %d: %s", resp.StatusCode, msg)
+	}
+	return json.Unmarshal(respBody, out)
+}
@@ -4,17 +4,59 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"fmt"
 	"io"
+	"strings"
+	"sync"
 )
 
-// Crypto AES-256-GCM 加密工具
+// 带版本的密文格式：enc:<密钥 ID>:<base64(nonce + 密文)>。
+// 不带前缀的是引入密钥版本前的旧密文，解密时依次尝试所有已加载的密钥。
+const cipherPrefix = "enc:"
+
+// 密钥 ID 之外的密文分类（见 CiphertextKeyID）
+const (
+	LegacyKeyID    = "legacy"    // 无版本的旧密文
+	PlaintextKeyID = "plaintext" // 尚未加密的旧值（渠道 AppSecret、Webhook Secret）
+)
+
+// Crypto AES-256-GCM 加密工具，支持多版本密钥：
+// 用主密钥加密，按密文中的密钥 ID 选择密钥解密（旧密钥仅用于解密，轮换期间保留）
 type Crypto struct {
-	key []byte
+	primary string
+	keys    map[string]cipher.AEAD // 密钥 ID → AEAD
+	order   []string               // 主密钥在前，旧密钥按配置顺序
+}
+
+// NewCrypto 创建加密工具，key 为主密钥，previous 为仅用于解密的旧密钥
+func NewCrypto(key string, previous ...string) *Crypto {
+	c := &Crypto{keys: make(map[string]cipher.AEAD)}
+	for _, k := range append([]string{key}, previous...) {
+		keyBytes := normalizeKey(k)
+		id := keyID(keyBytes)
+		if _, ok := c.keys[id]; ok {
+			continue
+		}
+		block, err := aes.NewCipher(keyBytes)
+		if err != nil {
+			continue // 32 字节密钥不会出错
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			continue
+		}
+		c.keys[id] = gcm
+		c.order = append(c.order, id)
+	}
+	c.primary = c.order[0]
+	return c
 }
 
-// NewCrypto 创建加密工具
-func NewCrypto(key string) *Crypto {
+// normalizeKey 将密钥补齐或截断为 32 字节（与引入密钥版本前的行为一致，旧密文才能解密）
+func normalizeKey(key string) []byte {
 	keyBytes := []byte(key)
 	if len(keyBytes) < 32 {
 		padded := make([]byte, 32)
@@ -23,47 +65,98 @@ func NewCrypto(key string) *Crypto {
 	} else if len(keyBytes) > 32 {
 		keyBytes = keyBytes[:32]
 	}
-	return &Crypto{key: keyBytes}
+	return keyBytes
 }
 
-// Encrypt 加密明文，返回 base64 编码的密文
-func (c *Crypto) Encrypt(plaintext string) (string, error) {
-	block, err := aes.NewCipher(c.key)
-	if err != nil {
-		return "", err
-	}
+// keyID 由密钥派生的短 ID（SHA-256 前 4 字节），同一密钥在各实例上 ID 相同
+func keyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
 
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", err
-	}
+// PrimaryKeyID 返回用于加密的主密钥 ID
+func (c *Crypto) PrimaryKeyID() string {
+	return c.primary
+}
 
+// KeyIDs 返回所有已加载的密钥 ID（主密钥在前）
+func (c *Crypto) KeyIDs() []string {
+	return append([]string(nil), c.order...)
+}
+
+// Encrypt 用主密钥加密明文，返回带密钥 ID 的密文
+func (c *Crypto) Encrypt(plaintext string) (string, error) {
+	gcm := c.keys[c.primary]
 	nonce := make([]byte, gcm.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return "", err
 	}
 
 	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	return cipherPrefix + c.primary + ":" + base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
-// Decrypt 解密 base64 编码的密文
+// Decrypt 解密密文：带密钥 ID 的密文使用对应密钥，无版本的旧密文依次尝试所有密钥
 func (c *Crypto) Decrypt(ciphertext string) (string, error) {
-	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	id, payload, versioned := splitCiphertext(ciphertext)
+	data, err := base64.StdEncoding.DecodeString(payload)
 	if err != nil {
 		return "", err
 	}
 
-	block, err := aes.NewCipher(c.key)
-	if err != nil {
-		return "", err
+	if versioned {
+		gcm, ok := c.keys[id]
+		if !ok {
+			return "", fmt.Errorf("%w: key %s", ErrUnknownEncryptionKey, id)
+		}
+		return open(gcm, data)
+	}
+	for _, id := range c.order {
+		if plaintext, err := open(c.keys[id], data); err == nil {
+			return plaintext, nil
+		}
 	}
+	return "", ErrDecryptionFailed
+}
 
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", err
+// Seal 加密可选加密的值（渠道 AppSecret、Webhook Secret），空值原样返回
+func (c *Crypto) Seal(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	return c.Encrypt(value)
+}
+
+// Open 解密 Seal 的结果；不带密文前缀的值视为加密前保存的明文原样返回
+func (c *Crypto) Open(value string) (string, error) {
+	if !strings.HasPrefix(value, cipherPrefix) {
+		return value, nil
+	}
+	return c.Decrypt(value)
+}
+
+// CiphertextKeyID 返回密文使用的密钥 ID；无版本的旧密文返回 LegacyKeyID
+func CiphertextKeyID(ciphertext string) string {
+	id, _, versioned := splitCiphertext(ciphertext)
+	if !versioned {
+		return LegacyKeyID
+	}
+	return id
+}
+
+func splitCiphertext(ciphertext string) (id, payload string, versioned bool) {
+	rest, ok := strings.CutPrefix(ciphertext, cipherPrefix)
+	if !ok {
+		return "", ciphertext, false
+	}
+	id, payload, ok = strings.Cut(rest, ":")
+	if !ok {
+		return "", ciphertext, false
 	}
+	return id, payload, true
+}
 
+func open(gcm cipher.AEAD, data []byte) (string, error) {
 	if len(data) < gcm.NonceSize() {
 		return "", ErrDecryptionFailed
 	}
@@ -77,6 +170,44 @@ func (c *Crypto) Decrypt(ciphertext string) (string, error) {
 	return string(plaintext), nil
 }
 
+// 进程级加密工具：渠道与 Webhook 存储在各处按需创建，统一使用这里设置的密钥
+var (
+	defaultMu     sync.RWMutex
+	defaultCrypto *Crypto
+)
+
+// SetDefaultCrypto 设置进程级加密工具（启动时调用）
+func SetDefaultCrypto(c *Crypto) {
+	defaultMu.Lock()
+	defaultCrypto = c
+	defaultMu.Unlock()
+}
+
+// SealSecret 用进程级加密工具加密可选加密的值，未设置加密工具时原样返回
+func SealSecret(value string) (string, error) {
+	defaultMu.RLock()
+	c := defaultCrypto
+	defaultMu.RUnlock()
+	if c == nil {
+		return value, nil
+	}
+	return c.Seal(value)
+}
+
+// OpenSecret 解密 SealSecret 的结果，明文旧值原样返回
+func OpenSecret(value string) (string, error) {
+	defaultMu.RLock()
+	c := defaultCrypto
+	defaultMu.RUnlock()
+	if c == nil {
+		if strings.HasPrefix(value, cipherPrefix) {
+			return "", ErrDecryptionFailed
+		}
+		return value, nil
+	}
+	return c.Open(value)
+}
+
 // MaskAPIKey 生成 API Key 掩码
 func MaskAPIKey(key string) string {
 	if len(key) <= 8 {
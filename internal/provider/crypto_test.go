@@ -0,0 +1,146 @@
+package provider
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// legacyEncrypt 引入密钥版本前的密文格式：base64(nonce + 密文)
+func legacyEncrypt(t *testing.T, key, plaintext string) string {
+	t.Helper()
+	block, err := aes.NewCipher(normalizeKey(key))
+	require.NoError(t, err)
+	gcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(plaintext), nil))
+}
+
+func TestCrypto_VersionedKeys(t *testing.T) {
+	oldKey, newKey := "old-key", "new-key-32bytes-for-aes256-gcm!!"
+	old := NewCrypto(oldKey)
+	c := NewCrypto(newKey, oldKey)
+	assert.Equal(t, []string{c.PrimaryKeyID(), old.PrimaryKeyID()}, c.KeyIDs())
+	assert.NotEqual(t, c.PrimaryKeyID(), old.PrimaryKeyID())
+
+	enc, err := c.Encrypt("sk-secret")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(enc, "enc:"+c.PrimaryKeyID()+":"))
+	assert.Equal(t, c.PrimaryKeyID(), CiphertextKeyID(enc))
+
+	// 旧密钥加密的密文与无版本的旧密文都能解密
+	oldEnc, err := old.Encrypt("sk-old")
+	require.NoError(t, err)
+	for ciphertext, want := range map[string]string{
+		enc:                                   "sk-secret",
+		oldEnc:                                "sk-old",
+		legacyEncrypt(t, oldKey, "sk-legacy"): "sk-legacy",
+	} {
+		got, err := c.Decrypt(ciphertext)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	// 只加载新密钥时，旧密钥的密文无法解密
+	_, err = NewCrypto(newKey).Decrypt(oldEnc)
+	assert.ErrorIs(t, err, ErrUnknownEncryptionKey)
+	_, err = NewCrypto(newKey).Decrypt(legacyEncrypt(t, oldKey, "x"))
+	assert.ErrorIs(t, err, ErrDecryptionFailed)
+}
+
+func TestCrypto_SealOpen(t *testing.T) {
+	c := NewCrypto("key")
+	sealed, err := c.Seal("app-secret")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(sealed, cipherPrefix))
+
+	opened, err := c.Open(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "app-secret", opened)
+
+	// 加密前保存的明文原样返回
+	opened, err = c.Open("plain-secret")
+	require.NoError(t, err)
+	assert.Equal(t, "plain-secret", opened)
+
+	empty, err := c.Seal("")
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+}
+
+// memSecretStore 内存中的密文存储
+type memSecretStore struct {
+	values []string
+}
+
+func (s *memSecretStore) RewriteSecrets(fn func(stored string) string) error {
+	for i, v := range s.values {
+		s.values[i] = fn(v)
+	}
+	return nil
+}
+
+func TestSecrets_CheckAndRotate(t *testing.T) {
+	oldKey := "old-key"
+	old := NewCrypto(oldKey)
+	mgr := NewManagerWithCrypto(t.TempDir(), old)
+	require.NoError(t, mgr.ConfigureKey("anthropic", "sk-ant-123456789"))
+	_, err := mgr.AddAuthProfile("anthropic", "sk-ant-profile-1", 0)
+	require.NoError(t, err)
+
+	oldWebhook, err := old.Seal("whsec-old")
+	require.NoError(t, err)
+	channels := &memSecretStore{values: []string{"plain-app-secret", "", oldWebhook}}
+
+	// 换用新主密钥，旧密钥保留用于解密
+	c := NewCrypto("new-key", oldKey)
+	mgr.crypto = c
+	secrets := NewSecrets(c)
+	secrets.Register("provider_keys", mgr, false)
+	secrets.Register("channels", channels, true)
+
+	report := secrets.Check()
+	require.NoError(t, report.Err())
+	assert.Equal(t, 4, report.Outdated())
+	assert.Equal(t, map[string]int{old.PrimaryKeyID(): 2}, report.Stores[0].ByKey)
+	assert.Equal(t, map[string]int{PlaintextKeyID: 1, old.PrimaryKeyID(): 1}, report.Stores[1].ByKey)
+
+	report = secrets.Rotate()
+	require.NoError(t, report.Err())
+	assert.Equal(t, 2, report.Stores[0].ReEncrypted)
+	assert.Equal(t, 2, report.Stores[1].ReEncrypted)
+	assert.Zero(t, secrets.Check().Outdated())
+
+	// 移除旧密钥后仍能解密，且 Provider 密钥已写回文件
+	c = NewCrypto("new-key")
+	reloaded := NewManagerWithCrypto(mgr.dataDir, c)
+	key, err := reloaded.GetDecryptedKey("anthropic")
+	require.NoError(t, err)
+	assert.Equal(t, "sk-ant-123456789", key)
+	mgr.crypto = c
+	key, profileID, err := mgr.GetDecryptedKeyWithRotation("anthropic")
+	require.NoError(t, err)
+	assert.NotEmpty(t, profileID)
+	assert.Equal(t, "sk-ant-profile-1", key)
+	for i, want := range []string{"plain-app-secret", "", "whsec-old"} {
+		got, err := c.Open(channels.values[i])
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	// 缺少旧密钥时校验失败
+	secrets = NewSecrets(NewCrypto("other-key"))
+	secrets.Register("channels", channels, true)
+	report = secrets.Check()
+	assert.Equal(t, 2, report.Failed())
+	assert.Error(t, report.Err())
+}
@@ -23,4 +23,7 @@ var (
 
 	// ErrDecryptionFailed is returned when decryption fails
 	ErrDecryptionFailed = errors.New("decryption failed")
+
+	// ErrUnknownEncryptionKey is returned when a ciphertext was encrypted with a key that is not loaded
+	ErrUnknownEncryptionKey = errors.New("unknown encryption key")
 )
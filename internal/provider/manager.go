@@ -28,11 +28,17 @@ type Manager struct {
 
 // NewManager creates a new provider manager
 func NewManager(dataDir string, encryptionKey string) *Manager {
+	return NewManagerWithCrypto(dataDir, NewCrypto(encryptionKey))
+}
+
+// NewManagerWithCrypto creates a provider manager using a crypto loaded with
+// versioned keys (the primary key plus previous keys kept for decryption)
+func NewManagerWithCrypto(dataDir string, crypto *Crypto) *Manager {
 	m := &Manager{
 		providers: make(map[string]*Provider),
 		keys:      make(map[string]*ProviderKeyData),
 		rotators:  make(map[string]*ProfileRotator),
-		crypto:    NewCrypto(encryptionKey),
+		crypto:    crypto,
 		dataDir:   dataDir,
 	}
 
@@ -428,8 +434,109 @@ func (m *Manager) ValidateKey(id string) (bool, error) {
 	return valid, nil
 }
 
+// ProbeResult is the outcome of one lightweight API call made with a provider key
+type ProbeResult struct {
+	ProviderID string        `json:"provider_id"`
+	ProfileID  string        `json:"profile_id,omitempty"` // Empty for the provider's own key
+	StatusCode int           `json:"status_code,omitempty"`
+	Latency    time.Duration `json:"latency"`
+	Error      string        `json:"error,omitempty"` // Network or decryption error
+}
+
+// KeyValid reports whether the key was accepted (any response other than 401/403)
+func (r *ProbeResult) KeyValid() bool {
+	return r.Error == "" && r.StatusCode != http.StatusUnauthorized && r.StatusCode != http.StatusForbidden
+}
+
+// Healthy reports whether the provider served the request with a valid key:
+// 401/403, 429, 5xx and network errors count as failures, while other 4xx
+// (e.g. an unknown probe model) prove the API is reachable
+func (r *ProbeResult) Healthy() bool {
+	return r.KeyValid() && r.StatusCode != http.StatusTooManyRequests && r.StatusCode < 500
+}
+
+// ProbeAll probes every configured provider key and enabled auth profile
+// concurrently (used by the health monitor). Providers whose API protocol
+// cannot be determined are skipped.
+func (m *Manager) ProbeAll() []*ProbeResult {
+	type target struct {
+		result  *ProbeResult
+		baseURL string
+		agents  []string
+		apiKey  string
+	}
+
+	m.mu.RLock()
+	var targets []*target
+	add := func(p *Provider, profileID, encrypted string) {
+		t := &target{result: &ProbeResult{ProviderID: p.ID, ProfileID: profileID}, baseURL: p.BaseURL, agents: p.Agents}
+		apiKey, err := m.crypto.Decrypt(encrypted)
+		if err != nil {
+			t.result.Error = ErrDecryptionFailed.Error()
+		}
+		t.apiKey = apiKey
+		targets = append(targets, t)
+	}
+	for id, keyData := range m.keys {
+		if p, ok := m.providers[id]; ok {
+			add(p, "", keyData.EncryptedKey)
+		}
+	}
+	for id, rotator := range m.rotators {
+		p, ok := m.providers[id]
+		if !ok {
+			continue
+		}
+		for _, profile := range rotator.GetAllProfiles() {
+			if profile.IsEnabled {
+				add(p, profile.ID, profile.EncryptedKey)
+			}
+		}
+	}
+	m.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		if t.result.Error != "" {
+			continue
+		}
+		wg.Add(1)
+		go func(t *target) {
+			defer wg.Done()
+			if r := m.probe(t.baseURL, t.apiKey, t.agents); r != nil {
+				r.ProviderID, r.ProfileID = t.result.ProviderID, t.result.ProfileID
+				t.result = r
+			} else {
+				t.result = nil
+			}
+		}(t)
+	}
+	wg.Wait()
+
+	results := make([]*ProbeResult, 0, len(targets))
+	for _, t := range targets {
+		if t.result != nil {
+			results = append(results, t.result)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].ProviderID != results[j].ProviderID {
+			return results[i].ProviderID < results[j].ProviderID
+		}
+		return results[i].ProfileID < results[j].ProfileID
+	})
+	return results
+}
+
 // probeAPI makes a lightweight API call to verify the key works
 func (m *Manager) probeAPI(baseURL string, apiKey string, agents []string) bool {
+	r := m.probe(baseURL, apiKey, agents)
+	return r == nil || r.KeyValid() // Can't determine protocol, assume valid
+}
+
+// probe calls the provider's Anthropic or OpenAI compatible API, returning
+// nil when the protocol cannot be determined from the supported agents
+func (m *Manager) probe(baseURL string, apiKey string, agents []string) *ProbeResult {
 	if baseURL == "" {
 		// Official providers without base_url — try to determine protocol
 		for _, a := range agents {
@@ -440,7 +547,7 @@ func (m *Manager) probeAPI(baseURL string, apiKey string, agents []string) bool
 				return m.probeOpenAI("https://api.openai.com/v1", apiKey)
 			}
 		}
-		return true // Can't determine, assume valid
+		return nil
 	}
 
 	// Try to determine protocol from agents
@@ -458,57 +565,54 @@ func (m *Manager) probeAPI(baseURL string, apiKey string, agents []string) bool
 		}
 	}
 
-	return true
+	return nil
 }
 
 // probeAnthropic calls Anthropic /v1/messages with a minimal request
-func (m *Manager) probeAnthropic(baseURL string, apiKey string) bool {
+func (m *Manager) probeAnthropic(baseURL string, apiKey string) *ProbeResult {
 	url := strings.TrimRight(baseURL, "/") + "/v1/messages"
 	body := `{"model":"claude-haiku-3-5-20241022","max_tokens":1,"messages":[{"role":"user","content":"hi"}]}`
 
 	req, err := http.NewRequest("POST", url, strings.NewReader(body))
 	if err != nil {
-		return false
+		return &ProbeResult{Error: err.Error()}
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("x-api-key", apiKey)
 	req.Header.Set("anthropic-version", "2023-06-01")
 
-	client := &http.Client{Timeout: 15 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return false
-	}
-	defer resp.Body.Close()
-
 	// 200 = success, 401/403 = invalid key, others (400, 429, etc.) = key is valid but request issue
-	if resp.StatusCode == 401 || resp.StatusCode == 403 {
-		return false
-	}
-	return true
+	return doProbe(req)
 }
 
 // probeOpenAI calls OpenAI /models to verify the key
-func (m *Manager) probeOpenAI(baseURL string, apiKey string) bool {
+func (m *Manager) probeOpenAI(baseURL string, apiKey string) *ProbeResult {
 	url := strings.TrimRight(baseURL, "/") + "/models"
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return false
+		return &ProbeResult{Error: err.Error()}
 	}
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
 
+	return doProbe(req)
+}
+
+// doProbe sends a probe request and records the status code and latency
+func doProbe(req *http.Request) *ProbeResult {
 	client := &http.Client{Timeout: 15 * time.Second}
+	start := time.Now()
 	resp, err := client.Do(req)
+	result := &ProbeResult{Latency: time.Since(start)}
 	if err != nil {
-		return false
+		result.Error = err.Error()
+		return result
 	}
 	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
 
-	if resp.StatusCode == 401 || resp.StatusCode == 403 {
-		return false
-	}
-	return true
+	result.StatusCode = resp.StatusCode
+	return result
 }
 
 // FetchModels fetches the available model list for a configured provider
@@ -699,6 +803,29 @@ func (m *Manager) GetDecryptedKey(id string) (string, error) {
 	return m.crypto.Decrypt(keyData.EncryptedKey)
 }
 
+// GetDecryptedKeys returns every API key of a provider: the single key and the keys of
+// all auth profiles (keys that fail to decrypt are skipped)
+func (m *Manager) GetDecryptedKeys(id string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var keys []string
+	add := func(encrypted string) {
+		if k, err := m.crypto.Decrypt(encrypted); err == nil && k != "" {
+			keys = append(keys, k)
+		}
+	}
+	if keyData, ok := m.keys[id]; ok {
+		add(keyData.EncryptedKey)
+	}
+	if rotator, ok := m.rotators[id]; ok && rotator != nil {
+		for _, profile := range rotator.GetAllProfiles() {
+			add(profile.EncryptedKey)
+		}
+	}
+	return keys
+}
+
 // GetEnvVarsWithKey returns environment variables for a provider with the actual API key injected
 func (m *Manager) GetEnvVarsWithKey(id string) (map[string]string, error) {
 	m.mu.RLock()
@@ -814,6 +941,36 @@ func (m *Manager) saveCustomProviders() error {
 	return os.WriteFile(m.customProvidersFile(), data, 0644)
 }
 
+// --- Secret Rotation ---
+
+// RewriteSecrets calls fn with every stored encrypted API key (provider keys
+// and auth profiles) and stores the values fn changed. Implements SecretStore.
+// Auth profiles live in memory only, so they are rewritten in place.
+func (m *Manager) RewriteSecrets(fn func(stored string) string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	changed := false
+	for _, k := range m.keys {
+		if v := fn(k.EncryptedKey); v != k.EncryptedKey {
+			k.EncryptedKey = v
+			changed = true
+		}
+	}
+	for _, rotator := range m.rotators {
+		rotator.mu.Lock()
+		for _, p := range rotator.profiles {
+			p.EncryptedKey = fn(p.EncryptedKey)
+		}
+		rotator.mu.Unlock()
+	}
+
+	if !changed {
+		return nil
+	}
+	return m.saveKeys()
+}
+
 // --- Auth Profile Rotation ---
 
 // GetDecryptedKeyWithRotation returns the decrypted API key using rotation
@@ -0,0 +1,140 @@
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ModelPrice is the list price of a model in USD per million tokens.
+type ModelPrice struct {
+	Input       float64 `json:"input"`                  // Uncached input tokens
+	CachedInput float64 `json:"cached_input,omitempty"` // Cache hits (0 = charged as input)
+	Output      float64 `json:"output"`
+}
+
+// Cost returns the cost in USD of a usage; cachedInput is included in input.
+func (p ModelPrice) Cost(input, cachedInput, output int64) float64 {
+	cachedPrice := p.CachedInput
+	if cachedPrice == 0 {
+		cachedPrice = p.Input
+	}
+	uncached := input - cachedInput
+	if uncached < 0 {
+		uncached = 0
+	}
+	return (float64(uncached)*p.Input + float64(cachedInput)*cachedPrice + float64(output)*p.Output) / 1e6
+}
+
+// Pricing maps model names to prices.
+type Pricing map[string]ModelPrice
+
+// BuiltinPricing contains the list prices of the models offered by the built-in providers.
+// Prices change: override them with ParsePricing (AGENTBOX_BATCH_MODEL_PRICING).
+var BuiltinPricing = Pricing{
+	// Anthropic
+	"claude-opus-4":    {Input: 15, CachedInput: 1.5, Output: 75},
+	"claude-sonnet-4":  {Input: 3, CachedInput: 0.3, Output: 15},
+	"claude-haiku-3-5": {Input: 0.8, CachedInput: 0.08, Output: 4},
+	"claude-3-5-haiku": {Input: 0.8, CachedInput: 0.08, Output: 4},
+
+	// OpenAI
+	"gpt-4.1":      {Input: 2, CachedInput: 0.5, Output: 8},
+	"gpt-4.1-mini": {Input: 0.4, CachedInput: 0.1, Output: 1.6},
+	"gpt-4.1-nano": {Input: 0.1, CachedInput: 0.025, Output: 0.4},
+	"gpt-4o":       {Input: 2.5, CachedInput: 1.25, Output: 10},
+	"gpt-4o-mini":  {Input: 0.15, CachedInput: 0.075, Output: 0.6},
+	"gpt-4-turbo":  {Input: 10, Output: 30},
+	"gpt-4":        {Input: 30, Output: 60},
+	"gpt-35-turbo": {Input: 0.5, Output: 1.5},
+	"o3":           {Input: 2, CachedInput: 0.5, Output: 8},
+	"o3-mini":      {Input: 1.1, CachedInput: 0.55, Output: 4.4},
+	"o4-mini":      {Input: 1.1, CachedInput: 0.275, Output: 4.4},
+
+	// Chinese providers
+	"deepseek-chat":     {Input: 0.27, CachedInput: 0.07, Output: 1.1},
+	"deepseek-coder":    {Input: 0.27, CachedInput: 0.07, Output: 1.1},
+	"deepseek-reasoner": {Input: 0.55, CachedInput: 0.14, Output: 2.19},
+	"glm-4.7":           {Input: 0.6, CachedInput: 0.11, Output: 2.2},
+	"glm-4-flash":       {Input: 0, Output: 0},
+	"qwen-max":          {Input: 1.6, Output: 6.4},
+	"qwen-plus":         {Input: 0.4, Output: 1.2},
+	"qwen-turbo":        {Input: 0.05, Output: 0.2},
+}
+
+// Lookup returns the price of a model. Besides exact names, a dated snapshot matches the
+// catalog entry it starts with (e.g. "claude-sonnet-4" for "claude-sonnet-4-20250514" or
+// "gpt-4o" for "gpt-4o-2024-08-06"); other variants ("o3-mini", "gpt-4.1-mini") need an
+// entry of their own and are unknown otherwise. Aggregator prefixes such as "anthropic/"
+// are ignored.
+func (p Pricing) Lookup(model string) (ModelPrice, bool) {
+	model = strings.ToLower(strings.TrimSpace(model))
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+	}
+	if model == "" {
+		return ModelPrice{}, false
+	}
+	if price, ok := p[model]; ok {
+		return price, true
+	}
+
+	var best string
+	for name := range p {
+		if len(name) > len(best) && strings.HasPrefix(model, name+"-2") {
+			best = name
+		}
+	}
+	if best == "" {
+		return ModelPrice{}, false
+	}
+	return p[best], true
+}
+
+// Merge returns a copy of p with the entries of overrides added or replaced.
+func (p Pricing) Merge(overrides Pricing) Pricing {
+	merged := make(Pricing, len(p)+len(overrides))
+	for name, price := range p {
+		merged[name] = price
+	}
+	for name, price := range overrides {
+		merged[name] = price
+	}
+	return merged
+}
+
+// ParsePricing parses prices in the form "glm-4-plus=0.7/0.7/0.7;my-model=1/0.1/4",
+// each being input/cached_input/output USD per million tokens (cached_input optional:
+// "my-model=1/4").
+func ParsePricing(s string) (Pricing, error) {
+	pricing := make(Pricing)
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		model, prices, ok := strings.Cut(entry, "=")
+		model = strings.ToLower(strings.TrimSpace(model))
+		if !ok || model == "" {
+			return nil, fmt.Errorf("invalid model price %q (expected model=input/cached_input/output)", entry)
+		}
+		parts := strings.Split(prices, "/")
+		values := make([]float64, len(parts))
+		for i, part := range parts {
+			v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil || v < 0 {
+				return nil, fmt.Errorf("invalid price %q for model %s", part, model)
+			}
+			values[i] = v
+		}
+		switch len(values) {
+		case 2:
+			pricing[model] = ModelPrice{Input: values[0], Output: values[1]}
+		case 3:
+			pricing[model] = ModelPrice{Input: values[0], CachedInput: values[1], Output: values[2]}
+		default:
+			return nil, fmt.Errorf("invalid model price %q (expected model=input/cached_input/output)", entry)
+		}
+	}
+	return pricing, nil
+}
@@ -0,0 +1,75 @@
+package provider
+
+import "testing"
+
+func TestPricing_Lookup(t *testing.T) {
+	tests := []struct {
+		model string
+		want  float64 // Input price, -1 = not found
+	}{
+		{"claude-sonnet-4-20250514", 3},
+		{"anthropic/claude-opus-4", 15},
+		{"GPT-4o-mini", 0.15},
+		{"gpt-4o", 2.5},
+		{"gpt-4-turbo", 10},
+		{"gpt-4o-2024-08-06", 2.5},
+		{"o3-mini", 1.1},
+		{"gpt-4.1-mini", 0.4},
+		{"o3-pro", -1},
+		{"gpt-4.1-preview", -1},
+		{"deepseek-chat", 0.27},
+		{"llama3.1", -1},
+		{"", -1},
+	}
+	for _, tt := range tests {
+		price, ok := BuiltinPricing.Lookup(tt.model)
+		if tt.want < 0 {
+			if ok {
+				t.Errorf("%q: expected no price, got %+v", tt.model, price)
+			}
+			continue
+		}
+		if !ok || price.Input != tt.want {
+			t.Errorf("%q: expected input price %v, got %+v (found=%v)", tt.model, tt.want, price, ok)
+		}
+	}
+}
+
+func TestModelPrice_Cost(t *testing.T) {
+	p := ModelPrice{Input: 2, CachedInput: 0.5, Output: 8}
+	if got := p.Cost(1_000_000, 400_000, 100_000); got != 1.2+0.2+0.8 {
+		t.Errorf("expected 2.2, got %v", got)
+	}
+	// 未设置缓存价格时按输入价格计费
+	p = ModelPrice{Input: 1, Output: 2}
+	if got := p.Cost(1_000_000, 500_000, 0); got != 1 {
+		t.Errorf("expected 1, got %v", got)
+	}
+}
+
+func TestParsePricing(t *testing.T) {
+	pricing, err := ParsePricing(" GLM-4-Plus=0.7/0.7/0.7; my-model=1/4 ;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pricing["glm-4-plus"] != (ModelPrice{Input: 0.7, CachedInput: 0.7, Output: 0.7}) {
+		t.Errorf("unexpected glm-4-plus price: %+v", pricing["glm-4-plus"])
+	}
+	if pricing["my-model"] != (ModelPrice{Input: 1, Output: 4}) {
+		t.Errorf("unexpected my-model price: %+v", pricing["my-model"])
+	}
+
+	merged := BuiltinPricing.Merge(pricing)
+	if _, ok := merged.Lookup("glm-4-plus"); !ok {
+		t.Error("expected merged pricing to contain glm-4-plus")
+	}
+	if _, ok := BuiltinPricing["glm-4-plus"]; ok {
+		t.Error("merge must not modify the built-in pricing")
+	}
+
+	for _, s := range []string{"model", "model=1", "model=a/b", "=1/2", "model=1/2/3/4", "model=-1/2"} {
+		if _, err := ParsePricing(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// SecretStore is a store holding encrypted secrets. RewriteSecrets calls fn
+// with every stored value and writes back the values fn changed.
+type SecretStore interface {
+	RewriteSecrets(fn func(stored string) string) error
+}
+
+// SecretStoreReport summarizes the secrets of one store.
+type SecretStoreReport struct {
+	Name        string         `json:"name"`
+	Total       int            `json:"total"`
+	ByKey       map[string]int `json:"by_key"` // key ID (or legacy / plaintext) -> count
+	Failed      int            `json:"failed"` // secrets that could not be decrypted
+	ReEncrypted int            `json:"re_encrypted"`
+	Error       string         `json:"error,omitempty"`
+}
+
+// SecretReport is the result of a secrets check or rotation.
+type SecretReport struct {
+	PrimaryKeyID string               `json:"primary_key_id"`
+	KeyIDs       []string             `json:"key_ids"`
+	Stores       []*SecretStoreReport `json:"stores"`
+}
+
+// Failed returns the number of secrets that could not be decrypted.
+func (r *SecretReport) Failed() int {
+	n := 0
+	for _, s := range r.Stores {
+		n += s.Failed
+	}
+	return n
+}
+
+// Outdated returns the number of secrets not yet encrypted with the primary key.
+func (r *SecretReport) Outdated() int {
+	n := 0
+	for _, s := range r.Stores {
+		for id, count := range s.ByKey {
+			if id != r.PrimaryKeyID {
+				n += count
+			}
+		}
+	}
+	return n
+}
+
+// Err summarizes failed decryptions and store errors, or returns nil.
+func (r *SecretReport) Err() error {
+	var errs []error
+	for _, s := range r.Stores {
+		if s.Failed > 0 {
+			errs = append(errs, fmt.Errorf("%s: %d secrets cannot be decrypted with the loaded keys", s.Name, s.Failed))
+		}
+		if s.Error != "" {
+			errs = append(errs, fmt.Errorf("%s: %s", s.Name, s.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type registeredStore struct {
+	name            string
+	store           SecretStore
+	legacyPlaintext bool
+}
+
+// Secrets checks and rotates the encrypted secrets of all registered stores.
+type Secrets struct {
+	crypto *Crypto
+	mu     sync.Mutex // serializes checks and rotations
+	stores []registeredStore
+}
+
+// NewSecrets creates a secrets registry using crypto.
+func NewSecrets(crypto *Crypto) *Secrets {
+	return &Secrets{crypto: crypto}
+}
+
+// Register adds a store. legacyPlaintext marks stores whose values were kept
+// in plaintext before encryption was introduced (channel and webhook
+// secrets), so values without the ciphertext prefix are plaintext rather
+// than unversioned ciphertexts.
+func (s *Secrets) Register(name string, store SecretStore, legacyPlaintext bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stores = append(s.stores, registeredStore{name: name, store: store, legacyPlaintext: legacyPlaintext})
+}
+
+// Check verifies that every stored secret decrypts with the loaded keys.
+func (s *Secrets) Check() *SecretReport {
+	return s.walk(false)
+}
+
+// Rotate re-encrypts every secret not yet under the primary key (including
+// legacy plaintext values). Secrets that cannot be decrypted are left as is
+// and reported as failed.
+func (s *Secrets) Rotate() *SecretReport {
+	return s.walk(true)
+}
+
+func (s *Secrets) walk(rotate bool) *SecretReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := &SecretReport{PrimaryKeyID: s.crypto.PrimaryKeyID(), KeyIDs: s.crypto.KeyIDs()}
+	for _, rs := range s.stores {
+		sr := &SecretStoreReport{Name: rs.name, ByKey: make(map[string]int)}
+		err := rs.store.RewriteSecrets(func(stored string) string {
+			if stored == "" {
+				return stored
+			}
+			sr.Total++
+			id := CiphertextKeyID(stored)
+			decrypt := s.crypto.Decrypt
+			if rs.legacyPlaintext {
+				decrypt = s.crypto.Open
+				if id == LegacyKeyID {
+					id = PlaintextKeyID
+				}
+			}
+			plaintext, err := decrypt(stored)
+			if err != nil {
+				sr.Failed++
+				sr.ByKey[id]++
+				return stored
+			}
+			if !rotate || id == report.PrimaryKeyID {
+				sr.ByKey[id]++
+				return stored
+			}
+			encrypted, err := s.crypto.Encrypt(plaintext)
+			if err != nil {
+				sr.ByKey[id]++
+				return stored
+			}
+			sr.ReEncrypted++
+			sr.ByKey[report.PrimaryKeyID]++
+			return encrypted
+		})
+		if err != nil {
+			sr.Error = err.Error()
+		}
+		report.Stores = append(report.Stores, sr)
+	}
+	return report
+}
@@ -0,0 +1,99 @@
+package providerhealth
+
+import "time"
+
+// State 熔断器状态
+type State string
+
+const (
+	StateClosed   State = "closed"    // 正常放行
+	StateOpen     State = "open"      // 熔断：调度与故障转移跳过该 Provider
+	StateHalfOpen State = "half_open" // 熔断超时后试探：只放行一个试探请求，成功即恢复，失败则重新熔断
+)
+
+// Transition 熔断器状态变化（同时作为告警内容推送）
+type Transition struct {
+	ProviderID string    `json:"provider_id"`
+	From       State     `json:"from"`
+	To         State     `json:"to"`
+	Reason     string    `json:"reason,omitempty"`
+	At         time.Time `json:"at"`
+}
+
+// breaker 单个 Provider 的熔断器（由 Monitor 加锁访问）
+type breaker struct {
+	state     State
+	failures  int // 连续失败次数
+	openedAt  time.Time
+	lastError string
+	changedAt time.Time
+	trialAt   time.Time // 半开状态下试探请求的放行时间（零值表示没有进行中的试探）
+}
+
+// current 当前的放行状态（无副作用）：熔断超时后为半开；半开试探进行中不再放行，视为 open
+//
+// 试探请求一直没有结果（如执行前被取消）时，超过 openTimeout 后允许新的试探。
+func (b *breaker) current(now time.Time, openTimeout time.Duration) State {
+	switch b.state {
+	case StateOpen:
+		if now.Sub(b.openedAt) < openTimeout {
+			return StateOpen
+		}
+		return StateHalfOpen
+	case StateHalfOpen:
+		if !b.trialAt.IsZero() && now.Sub(b.trialAt) < openTimeout {
+			return StateOpen
+		}
+	}
+	return b.state
+}
+
+// allow 是否放行请求；熔断超时后转为半开，并且同一时间只放行一个试探请求
+func (b *breaker) allow(now time.Time, openTimeout time.Duration) (bool, *Transition) {
+	switch b.current(now, openTimeout) {
+	case StateClosed:
+		return true, nil
+	case StateOpen:
+		return false, nil
+	}
+	b.trialAt = now
+	if b.state == StateOpen {
+		return true, b.transition(StateHalfOpen, "open timeout elapsed", now)
+	}
+	return true, nil
+}
+
+// success 记录一次成功：非关闭状态恢复为关闭
+func (b *breaker) success(now time.Time) *Transition {
+	b.failures = 0
+	b.trialAt = time.Time{}
+	if b.state == StateClosed {
+		return nil
+	}
+	return b.transition(StateClosed, "provider recovered", now)
+}
+
+// failure 记录一次失败：半开状态或连续失败达到阈值时熔断
+func (b *breaker) failure(reason string, threshold int, now time.Time) *Transition {
+	b.failures++
+	b.lastError = reason
+	b.trialAt = time.Time{}
+	switch b.state {
+	case StateHalfOpen:
+		b.openedAt = now
+		return b.transition(StateOpen, reason, now)
+	case StateClosed:
+		if b.failures >= threshold {
+			b.openedAt = now
+			return b.transition(StateOpen, reason, now)
+		}
+	}
+	return nil
+}
+
+func (b *breaker) transition(to State, reason string, now time.Time) *Transition {
+	t := &Transition{From: b.state, To: to, Reason: reason, At: now}
+	b.state = to
+	b.changedAt = now
+	return t
+}
@@ -0,0 +1,470 @@
+// Package providerhealth Provider 健康监控
+//
+// 后台定期用各 Provider 的 Key（含 Auth Profile）发起轻量探测，探测结果写入历史表，
+// 并与任务执行结果一起驱动每个 Provider 的熔断器（closed / open / half_open）。
+// 任务调度跳过整条 Provider 链均已熔断的任务，故障转移跳过已熔断的 Provider。
+// 熔断器状态变化时记录日志并推送 provider.circuit_changed Webhook 告警。
+//
+// 熔断器状态保存在各实例内存中（每个实例独立探测），探测历史只由 Leader 写入。
+package providerhealth
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tmalldedede/agentbox/internal/database"
+	"github.com/tmalldedede/agentbox/internal/logger"
+	"github.com/tmalldedede/agentbox/internal/provider"
+	"github.com/tmalldedede/agentbox/internal/webhook"
+	"gorm.io/gorm"
+)
+
+var log *slog.Logger
+
+func init() {
+	log = logger.Module("providerhealth")
+}
+
+// 默认配置
+const (
+	DefaultFailureThreshold = 3
+	DefaultOpenTimeout      = time.Minute
+	DefaultHistoryRetention = 7 * 24 * time.Hour
+
+	maxTransitions = 100 // 内存中保留的最近状态变化数
+)
+
+// Prober 探测所有已配置的 Provider Key（provider.Manager 实现）
+type Prober interface {
+	ProbeAll() []*provider.ProbeResult
+}
+
+// Notifier 状态变化告警（webhook.Manager 实现）
+type Notifier interface {
+	Send(event string, data interface{})
+}
+
+// Config 监控配置
+type Config struct {
+	Interval         time.Duration // 探测间隔，0 表示不主动探测
+	FailureThreshold int           // 连续失败多少次后熔断
+	OpenTimeout      time.Duration // 熔断后多久进入半开状态
+	HistoryRetention time.Duration // 探测历史保留时长
+}
+
+// Status Provider 熔断器状态
+type Status struct {
+	ProviderID          string     `json:"provider_id"`
+	State               State      `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"` // 熔断中：进入半开状态的时间
+	ChangedAt           *time.Time `json:"changed_at,omitempty"`
+	LastProbeAt         *time.Time `json:"last_probe_at,omitempty"`
+	LastProbeLatencyMs  int64      `json:"last_probe_latency_ms"`
+}
+
+// Sample 一次探测记录
+type Sample struct {
+	ProviderID string    `json:"provider_id"`
+	ProfileID  string    `json:"profile_id,omitempty"` // 为空表示 Provider 自身的 Key
+	Healthy    bool      `json:"healthy"`
+	StatusCode int       `json:"status_code,omitempty"`
+	LatencyMs  int64     `json:"latency_ms"`
+	Error      string    `json:"error,omitempty"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// HistoryFilter 探测历史查询条件
+type HistoryFilter struct {
+	ProviderID string
+	ProfileID  string
+	Since      time.Time
+	Limit      int
+}
+
+// TargetStats 单个 Provider Key 在时间窗口内的探测统计
+type TargetStats struct {
+	ProviderID   string  `json:"provider_id"`
+	ProfileID    string  `json:"profile_id,omitempty"`
+	Checks       int64   `json:"checks"`
+	Failures     int64   `json:"failures"`
+	ErrorRate    float64 `json:"error_rate"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+}
+
+// lastProbe Provider 最近一轮探测
+type lastProbe struct {
+	at      time.Time
+	latency time.Duration
+}
+
+// Monitor Provider 健康监控与熔断器
+type Monitor struct {
+	db       *gorm.DB
+	prober   Prober
+	cfg      Config
+	notifier Notifier
+	leader   func() bool
+
+	mu          sync.Mutex
+	breakers    map[string]*breaker
+	probes      map[string]*lastProbe
+	transitions []*Transition
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// New 创建健康监控
+func New(db *gorm.DB, prober Prober, cfg Config) (*Monitor, error) {
+	if err := db.AutoMigrate(&database.ProviderHealthModel{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate provider health table: %w", err)
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = DefaultFailureThreshold
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = DefaultOpenTimeout
+	}
+	if cfg.HistoryRetention <= 0 {
+		cfg.HistoryRetention = DefaultHistoryRetention
+	}
+	return &Monitor{
+		db:       db,
+		prober:   prober,
+		cfg:      cfg,
+		breakers: make(map[string]*breaker),
+		probes:   make(map[string]*lastProbe),
+		stopCh:   make(chan struct{}),
+	}, nil
+}
+
+// SetNotifier 设置状态变化告警
+func (m *Monitor) SetNotifier(n Notifier) {
+	m.notifier = n
+}
+
+// SetLeaderCheck 设置 Leader 判断函数（探测历史只由 Leader 写入）
+func (m *Monitor) SetLeaderCheck(fn func() bool) {
+	m.leader = fn
+}
+
+func (m *Monitor) isLeader() bool {
+	return m.leader == nil || m.leader()
+}
+
+// Start 启动后台探测（Interval 为 0 时不探测）
+func (m *Monitor) Start() {
+	if m.cfg.Interval <= 0 {
+		log.Info("provider health probing disabled")
+		return
+	}
+	log.Info("started", "interval", m.cfg.Interval, "failure_threshold", m.cfg.FailureThreshold, "open_timeout", m.cfg.OpenTimeout)
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(m.cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stopCh:
+				return
+			case <-ticker.C:
+				m.Check()
+			}
+		}
+	}()
+}
+
+// Stop 停止后台探测
+func (m *Monitor) Stop() {
+	close(m.stopCh)
+	m.wg.Wait()
+}
+
+// Check 执行一轮探测：记录历史，并按 Provider 汇总驱动熔断器（任一 Key 健康即视为成功）
+func (m *Monitor) Check() []*provider.ProbeResult {
+	results := m.prober.ProbeAll()
+	now := time.Now()
+
+	if len(results) > 0 && m.isLeader() {
+		models := make([]*database.ProviderHealthModel, len(results))
+		for i, r := range results {
+			models[i] = &database.ProviderHealthModel{
+				ProviderID: r.ProviderID,
+				ProfileID:  r.ProfileID,
+				Healthy:    r.Healthy(),
+				StatusCode: r.StatusCode,
+				LatencyMs:  r.Latency.Milliseconds(),
+				Error:      truncate(r.Error, 512),
+				CheckedAt:  now,
+			}
+		}
+		if err := m.db.Create(&models).Error; err != nil {
+			log.Warn("failed to save provider health samples", "error", err)
+		}
+	}
+
+	type outcome struct {
+		healthy bool
+		reason  string
+		latency time.Duration
+	}
+	byProvider := make(map[string]*outcome)
+	var order []string
+	for _, r := range results {
+		o := byProvider[r.ProviderID]
+		if o == nil {
+			o = &outcome{}
+			byProvider[r.ProviderID] = o
+			order = append(order, r.ProviderID)
+		}
+		if r.Healthy() {
+			if !o.healthy || r.Latency < o.latency {
+				o.latency = r.Latency
+			}
+			o.healthy = true
+		} else if o.reason == "" {
+			o.reason = "probe failed: " + probeError(r)
+		}
+	}
+
+	m.mu.Lock()
+	for _, id := range order {
+		m.probes[id] = &lastProbe{at: now, latency: byProvider[id].latency}
+	}
+	m.mu.Unlock()
+	for _, id := range order {
+		if o := byProvider[id]; o.healthy {
+			m.RecordSuccess(id)
+		} else {
+			m.RecordFailure(id, o.reason)
+		}
+	}
+	return results
+}
+
+// State Provider 当前的放行状态（无副作用，用于状态查询与调度过滤）
+func (m *Monitor) State(providerID string) State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.breakers[providerID]
+	if !ok {
+		return StateClosed
+	}
+	return b.current(time.Now(), m.cfg.OpenTimeout)
+}
+
+// Allow 为一次执行申请放行（未熔断时放行；熔断超时后转为半开，只放行一个试探请求）
+//
+// 只应在真正发起请求前调用；仅查询状态请使用 State。
+func (m *Monitor) Allow(providerID string) bool {
+	m.mu.Lock()
+	b, ok := m.breakers[providerID]
+	if !ok {
+		m.mu.Unlock()
+		return true
+	}
+	allowed, t := b.allow(time.Now(), m.cfg.OpenTimeout)
+	m.mu.Unlock()
+	m.emit(providerID, t)
+	return allowed
+}
+
+// RecordSuccess 记录一次成功（探测或任务执行）
+func (m *Monitor) RecordSuccess(providerID string) {
+	m.mu.Lock()
+	t := m.breaker(providerID).success(time.Now())
+	m.mu.Unlock()
+	m.emit(providerID, t)
+}
+
+// RecordFailure 记录一次 Provider 导致的失败（探测失败，或执行时的认证 / 限流 / 超时等错误）
+func (m *Monitor) RecordFailure(providerID, reason string) {
+	m.mu.Lock()
+	t := m.breaker(providerID).failure(reason, m.cfg.FailureThreshold, time.Now())
+	m.mu.Unlock()
+	m.emit(providerID, t)
+}
+
+// Reset 手动恢复熔断器为关闭状态
+func (m *Monitor) Reset(providerID string) {
+	m.mu.Lock()
+	b := m.breaker(providerID)
+	var t *Transition
+	b.failures = 0
+	b.trialAt = time.Time{}
+	if b.state != StateClosed {
+		t = b.transition(StateClosed, "reset by admin", time.Now())
+	}
+	m.mu.Unlock()
+	m.emit(providerID, t)
+}
+
+// Status 返回所有 Provider 的熔断器状态（按 Provider ID 排序）
+func (m *Monitor) Status() []*Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := make(map[string]bool, len(m.breakers)+len(m.probes))
+	for id := range m.breakers {
+		ids[id] = true
+	}
+	for id := range m.probes {
+		ids[id] = true
+	}
+
+	result := make([]*Status, 0, len(ids))
+	for id := range ids {
+		st := &Status{ProviderID: id, State: StateClosed}
+		if b, ok := m.breakers[id]; ok {
+			st.State = b.state
+			st.ConsecutiveFailures = b.failures
+			st.LastError = b.lastError
+			if !b.changedAt.IsZero() {
+				st.ChangedAt = timePtr(b.changedAt)
+			}
+			if b.state == StateOpen {
+				st.OpenedAt = timePtr(b.openedAt)
+				st.RetryAt = timePtr(b.openedAt.Add(m.cfg.OpenTimeout))
+			}
+		}
+		if p, ok := m.probes[id]; ok {
+			st.LastProbeAt = timePtr(p.at)
+			st.LastProbeLatencyMs = p.latency.Milliseconds()
+		}
+		result = append(result, st)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ProviderID < result[j].ProviderID })
+	return result
+}
+
+// Transitions 返回最近的熔断器状态变化（新的在前）
+func (m *Monitor) Transitions() []*Transition {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make([]*Transition, len(m.transitions))
+	for i, t := range m.transitions {
+		result[len(m.transitions)-1-i] = t
+	}
+	return result
+}
+
+// History 查询探测历史（新的在前）
+func (m *Monitor) History(f *HistoryFilter) ([]*Sample, error) {
+	q := m.db.Model(&database.ProviderHealthModel{})
+	if f.ProviderID != "" {
+		q = q.Where("provider_id = ?", f.ProviderID)
+	}
+	if f.ProfileID != "" {
+		q = q.Where("profile_id = ?", f.ProfileID)
+	}
+	if !f.Since.IsZero() {
+		q = q.Where("checked_at >= ?", f.Since)
+	}
+	if f.Limit > 0 {
+		q = q.Limit(f.Limit)
+	}
+	var models []*database.ProviderHealthModel
+	if err := q.Order("checked_at DESC, id DESC").Find(&models).Error; err != nil {
+		return nil, err
+	}
+	result := make([]*Sample, len(models))
+	for i, md := range models {
+		result[i] = &Sample{
+			ProviderID: md.ProviderID,
+			ProfileID:  md.ProfileID,
+			Healthy:    md.Healthy,
+			StatusCode: md.StatusCode,
+			LatencyMs:  md.LatencyMs,
+			Error:      md.Error,
+			CheckedAt:  md.CheckedAt,
+		}
+	}
+	return result, nil
+}
+
+// Summary 统计时间窗口内每个 Provider Key 的错误率与平均延迟
+func (m *Monitor) Summary(providerID string, since time.Time) ([]*TargetStats, error) {
+	q := m.db.Model(&database.ProviderHealthModel{}).
+		Select("provider_id, profile_id, COUNT(*) AS checks, "+
+			"SUM(CASE WHEN healthy THEN 0 ELSE 1 END) AS failures, AVG(latency_ms) AS avg_latency_ms").
+		Where("checked_at >= ?", since)
+	if providerID != "" {
+		q = q.Where("provider_id = ?", providerID)
+	}
+	var result []*TargetStats
+	if err := q.Group("provider_id, profile_id").Order("provider_id, profile_id").Scan(&result).Error; err != nil {
+		return nil, err
+	}
+	for _, s := range result {
+		if s.Checks > 0 {
+			s.ErrorRate = float64(s.Failures) / float64(s.Checks)
+		}
+	}
+	return result, nil
+}
+
+// Purge 删除超过保留时长的探测历史，返回删除数量
+func (m *Monitor) Purge() (int64, error) {
+	result := m.db.Where("checked_at < ?", time.Now().Add(-m.cfg.HistoryRetention)).Delete(&database.ProviderHealthModel{})
+	return result.RowsAffected, result.Error
+}
+
+// breaker 获取或创建熔断器（调用方持有锁）
+func (m *Monitor) breaker(providerID string) *breaker {
+	b, ok := m.breakers[providerID]
+	if !ok {
+		b = &breaker{state: StateClosed}
+		m.breakers[providerID] = b
+	}
+	return b
+}
+
+// emit 记录状态变化并告警
+func (m *Monitor) emit(providerID string, t *Transition) {
+	if t == nil {
+		return
+	}
+	t.ProviderID = providerID
+
+	m.mu.Lock()
+	m.transitions = append(m.transitions, t)
+	if len(m.transitions) > maxTransitions {
+		m.transitions = m.transitions[len(m.transitions)-maxTransitions:]
+	}
+	m.mu.Unlock()
+
+	if t.To == StateOpen {
+		log.Warn("provider circuit opened", "provider", providerID, "from", t.From, "reason", t.Reason)
+	} else {
+		log.Info("provider circuit state changed", "provider", providerID, "from", t.From, "to", t.To, "reason", t.Reason)
+	}
+	if m.notifier != nil {
+		m.notifier.Send(webhook.EventProviderCircuit, t)
+	}
+}
+
+func probeError(r *provider.ProbeResult) string {
+	if r.Error != "" {
+		return r.Error
+	}
+	return fmt.Sprintf("status %d", r.StatusCode)
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
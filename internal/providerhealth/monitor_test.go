@@ -0,0 +1,158 @@
+package providerhealth
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmalldedede/agentbox/internal/provider"
+	"github.com/tmalldedede/agentbox/internal/webhook"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// fakeProber 返回预设的探测结果
+type fakeProber struct {
+	results []*provider.ProbeResult
+}
+
+func (p *fakeProber) ProbeAll() []*provider.ProbeResult {
+	return p.results
+}
+
+// fakeNotifier 记录推送的告警
+type fakeNotifier struct {
+	mu     sync.Mutex
+	events []string
+	data   []interface{}
+}
+
+func (n *fakeNotifier) Send(event string, data interface{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, event)
+	n.data = append(n.data, data)
+}
+
+func newMonitor(t *testing.T, prober Prober, cfg Config) *Monitor {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: gormlogger.Default.LogMode(gormlogger.Silent)})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	m, err := New(db, prober, cfg)
+	require.NoError(t, err)
+	return m
+}
+
+func TestMonitor_CircuitBreaker(t *testing.T) {
+	m := newMonitor(t, &fakeProber{}, Config{FailureThreshold: 2, OpenTimeout: 20 * time.Millisecond})
+	notifier := &fakeNotifier{}
+	m.SetNotifier(notifier)
+
+	assert.True(t, m.Allow("anthropic"))
+	m.RecordFailure("anthropic", "rate limited")
+	assert.True(t, m.Allow("anthropic"))
+
+	// 连续失败达到阈值后熔断
+	m.RecordFailure("anthropic", "rate limited")
+	assert.False(t, m.Allow("anthropic"))
+	status := m.Status()
+	require.Len(t, status, 1)
+	assert.Equal(t, StateOpen, status[0].State)
+	assert.Equal(t, 2, status[0].ConsecutiveFailures)
+	assert.NotNil(t, status[0].RetryAt)
+
+	// 熔断超时后：查询状态没有副作用
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, StateHalfOpen, m.State("anthropic"))
+	assert.Equal(t, StateOpen, m.Status()[0].State)
+	assert.Len(t, notifier.events, 1)
+
+	// 半开只放行一个试探请求，失败则重新熔断
+	assert.True(t, m.Allow("anthropic"))
+	assert.Equal(t, StateHalfOpen, m.Status()[0].State)
+	assert.False(t, m.Allow("anthropic"))
+	assert.Equal(t, StateOpen, m.State("anthropic"))
+	m.RecordFailure("anthropic", "still failing")
+	assert.False(t, m.Allow("anthropic"))
+
+	// 半开状态下成功则恢复
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, m.Allow("anthropic"))
+	m.RecordSuccess("anthropic")
+	assert.Equal(t, StateClosed, m.Status()[0].State)
+
+	var states []State
+	for _, tr := range m.Transitions() {
+		states = append(states, tr.To)
+	}
+	assert.Equal(t, []State{StateClosed, StateHalfOpen, StateOpen, StateHalfOpen, StateOpen}, states)
+	assert.Len(t, notifier.events, 5)
+	assert.Equal(t, webhook.EventProviderCircuit, notifier.events[0])
+	assert.Equal(t, "anthropic", notifier.data[0].(*Transition).ProviderID)
+
+	// 手动重置
+	m.RecordFailure("anthropic", "x")
+	m.RecordFailure("anthropic", "x")
+	assert.False(t, m.Allow("anthropic"))
+	m.Reset("anthropic")
+	assert.True(t, m.Allow("anthropic"))
+}
+
+func TestMonitor_CheckHistory(t *testing.T) {
+	prober := &fakeProber{results: []*provider.ProbeResult{
+		{ProviderID: "anthropic", StatusCode: 200, Latency: 100 * time.Millisecond},
+		{ProviderID: "anthropic", ProfileID: "p1", StatusCode: 429, Latency: 50 * time.Millisecond},
+		{ProviderID: "openai", Error: "connection refused", Latency: 10 * time.Millisecond},
+	}}
+	m := newMonitor(t, prober, Config{FailureThreshold: 2})
+
+	m.Check()
+	m.Check()
+
+	// 任一 Key 健康即视为 Provider 可用
+	assert.True(t, m.Allow("anthropic"))
+	assert.False(t, m.Allow("openai"))
+	status := m.Status()
+	require.Len(t, status, 2)
+	assert.Equal(t, int64(100), status[0].LastProbeLatencyMs)
+	assert.Equal(t, "probe failed: connection refused", status[1].LastError)
+
+	samples, err := m.History(&HistoryFilter{ProviderID: "anthropic"})
+	require.NoError(t, err)
+	assert.Len(t, samples, 4)
+	samples, err = m.History(&HistoryFilter{ProviderID: "anthropic", ProfileID: "p1", Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, samples, 1)
+	assert.False(t, samples[0].Healthy)
+	assert.Equal(t, 429, samples[0].StatusCode)
+
+	stats, err := m.Summary("", time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Len(t, stats, 3)
+	assert.Equal(t, "anthropic", stats[0].ProviderID)
+	assert.Empty(t, stats[0].ProfileID)
+	assert.Equal(t, int64(2), stats[0].Checks)
+	assert.Zero(t, stats[0].ErrorRate)
+	assert.Equal(t, float64(100), stats[0].AvgLatencyMs)
+	assert.Equal(t, 1.0, stats[1].ErrorRate)
+	assert.Equal(t, "openai", stats[2].ProviderID)
+
+	// 非 Leader 不写入历史
+	m.SetLeaderCheck(func() bool { return false })
+	m.Check()
+	samples, err = m.History(&HistoryFilter{})
+	require.NoError(t, err)
+	assert.Len(t, samples, 6)
+
+	m.cfg.HistoryRetention = -time.Second
+	n, err := m.Purge()
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), n)
+}
@@ -0,0 +1,162 @@
+// Package resultcache 提供 Agent 执行结果缓存
+//
+// 缓存键为解析后的 Agent 配置（适配器、模型、系统提示词、Skills、MCP）与渲染后的提示词、
+// 附件内容的哈希。相同输入的批量任务 / 任务命中缓存时直接复用结果，不启动 Session，
+// 也不计入成本。缓存需显式开启（Policy），条目在 TTL 到期后失效并由 Leader 定期清理。
+package resultcache
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/tmalldedede/agentbox/internal/database"
+	"github.com/tmalldedede/agentbox/internal/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var log *slog.Logger
+
+func init() {
+	log = logger.Module("resultcache")
+}
+
+// 默认 TTL 与 TTL 上限
+const (
+	DefaultTTL    = 24 * time.Hour
+	DefaultMaxTTL = 30 * 24 * time.Hour
+)
+
+// Policy 缓存策略（批量任务模板 / 任务请求中开启）
+type Policy struct {
+	TTL int `json:"ttl,omitempty"` // 秒，0 表示使用默认 TTL
+}
+
+// Entry 缓存条目
+type Entry struct {
+	Key               string    `json:"key"`
+	AgentID           string    `json:"agent_id"`
+	Result            string    `json:"result"`
+	InputTokens       int64     `json:"input_tokens"`
+	CachedInputTokens int64     `json:"cached_input_tokens"`
+	OutputTokens      int64     `json:"output_tokens"`
+	DurationMs        int64     `json:"duration_ms"` // 原始执行耗时
+	Source            string    `json:"source"`      // 产生结果的来源，如 batch:<id> / task:<id>
+	Hits              int64     `json:"hits"`
+	CreatedAt         time.Time `json:"created_at"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+// Cache 结果缓存
+type Cache struct {
+	db         *gorm.DB
+	defaultTTL time.Duration
+	maxTTL     time.Duration
+}
+
+// New 创建结果缓存
+func New(db *gorm.DB, defaultTTL, maxTTL time.Duration) (*Cache, error) {
+	if err := db.AutoMigrate(&database.ResultCacheModel{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate result cache table: %w", err)
+	}
+	if defaultTTL <= 0 {
+		defaultTTL = DefaultTTL
+	}
+	if maxTTL <= 0 {
+		maxTTL = DefaultMaxTTL
+	}
+	if defaultTTL > maxTTL {
+		defaultTTL = maxTTL
+	}
+	return &Cache{db: db, defaultTTL: defaultTTL, maxTTL: maxTTL}, nil
+}
+
+// TTL 返回策略对应的 TTL（未指定时使用默认值，不超过上限）
+func (c *Cache) TTL(p *Policy) time.Duration {
+	if p == nil || p.TTL <= 0 {
+		return c.defaultTTL
+	}
+	ttl := time.Duration(p.TTL) * time.Second
+	if ttl > c.maxTTL {
+		return c.maxTTL
+	}
+	return ttl
+}
+
+// Validate 校验缓存策略
+func Validate(p *Policy) error {
+	if p != nil && p.TTL < 0 {
+		return fmt.Errorf("cache ttl must not be negative")
+	}
+	return nil
+}
+
+// Get 查找未过期的缓存条目并累计命中次数，未命中时返回 nil
+func (c *Cache) Get(key string) (*Entry, error) {
+	var m database.ResultCacheModel
+	err := c.db.Where("cache_key = ? AND expires_at > ?", key, time.Now()).First(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := c.db.Model(&database.ResultCacheModel{}).
+		Where("cache_key = ?", key).
+		UpdateColumn("hits", gorm.Expr("hits + 1")).Error; err != nil {
+		log.Warn("failed to count cache hit", "key", key, "error", err)
+	}
+	m.Hits++
+	return fromModel(&m), nil
+}
+
+// Put 写入缓存条目（已存在时覆盖）
+func (c *Cache) Put(e *Entry, ttl time.Duration) error {
+	now := time.Now()
+	if ttl <= 0 {
+		ttl = c.defaultTTL
+	}
+	m := &database.ResultCacheModel{
+		Key:               e.Key,
+		AgentID:           e.AgentID,
+		Result:            e.Result,
+		InputTokens:       e.InputTokens,
+		CachedInputTokens: e.CachedInputTokens,
+		OutputTokens:      e.OutputTokens,
+		DurationMs:        e.DurationMs,
+		Source:            e.Source,
+		CreatedAt:         now,
+		ExpiresAt:         now.Add(ttl),
+	}
+	return c.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "cache_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"agent_id", "result", "input_tokens", "cached_input_tokens", "output_tokens",
+			"duration_ms", "source", "hits", "created_at", "expires_at",
+		}),
+	}).Create(m).Error
+}
+
+// Purge 删除过期条目，返回删除数量
+func (c *Cache) Purge() (int64, error) {
+	result := c.db.Where("expires_at <= ?", time.Now()).Delete(&database.ResultCacheModel{})
+	return result.RowsAffected, result.Error
+}
+
+func fromModel(m *database.ResultCacheModel) *Entry {
+	return &Entry{
+		Key:               m.Key,
+		AgentID:           m.AgentID,
+		Result:            m.Result,
+		InputTokens:       m.InputTokens,
+		CachedInputTokens: m.CachedInputTokens,
+		OutputTokens:      m.OutputTokens,
+		DurationMs:        m.DurationMs,
+		Source:            m.Source,
+		Hits:              m.Hits,
+		CreatedAt:         m.CreatedAt,
+		ExpiresAt:         m.ExpiresAt,
+	}
+}
@@ -0,0 +1,128 @@
+package resultcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmalldedede/agentbox/internal/agent"
+	"github.com/tmalldedede/agentbox/internal/database"
+	"github.com/tmalldedede/agentbox/internal/provider"
+	"github.com/tmalldedede/agentbox/internal/skill"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func newCache(t *testing.T) *Cache {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: gormlogger.Default.LogMode(gormlogger.Silent)})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	c, err := New(db, time.Hour, 2*time.Hour)
+	require.NoError(t, err)
+	return c
+}
+
+func TestCache_GetPutPurge(t *testing.T) {
+	c := newCache(t)
+
+	e, err := c.Get("k")
+	require.NoError(t, err)
+	assert.Nil(t, e)
+
+	require.NoError(t, c.Put(&Entry{Key: "k", AgentID: "a", Result: "done", OutputTokens: 10}, time.Hour))
+	e, err = c.Get("k")
+	require.NoError(t, err)
+	require.NotNil(t, e)
+	assert.Equal(t, "done", e.Result)
+	assert.Equal(t, int64(1), e.Hits)
+
+	// 覆盖写入后命中次数重置
+	require.NoError(t, c.Put(&Entry{Key: "k", Result: "again"}, time.Hour))
+	e, err = c.Get("k")
+	require.NoError(t, err)
+	assert.Equal(t, "again", e.Result)
+	assert.Equal(t, int64(1), e.Hits)
+
+	// 过期条目不命中，由 Purge 清理
+	require.NoError(t, c.Put(&Entry{Key: "old"}, time.Nanosecond))
+	time.Sleep(time.Millisecond)
+	e, err = c.Get("old")
+	require.NoError(t, err)
+	assert.Nil(t, e)
+	n, err := c.Purge()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	require.NoError(t, c.db.Model(&database.ResultCacheModel{}).Count(&n).Error)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestCache_TTL(t *testing.T) {
+	c := newCache(t)
+	assert.Equal(t, time.Hour, c.TTL(nil))
+	assert.Equal(t, time.Hour, c.TTL(&Policy{}))
+	assert.Equal(t, 10*time.Minute, c.TTL(&Policy{TTL: 600}))
+	assert.Equal(t, 2*time.Hour, c.TTL(&Policy{TTL: 86400}))
+	assert.Error(t, Validate(&Policy{TTL: -1}))
+}
+
+func TestKey(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "doc.txt")
+	require.NoError(t, os.WriteFile(file, []byte("v1"), 0644))
+
+	input := func() *KeyInput {
+		return &KeyInput{
+			Config: &agent.AgentFullConfig{
+				Agent:    &agent.Agent{Adapter: "codex", SystemPrompt: "be brief"},
+				Provider: &provider.Provider{ID: "openai", DefaultModel: "gpt-4o"},
+				Skills:   []*skill.Skill{{ID: "review", Prompt: "review it"}},
+			},
+			Prompt: "summarize doc.txt",
+			Files:  []string{file},
+		}
+	}
+	key := func(in *KeyInput) string {
+		k, err := Key(in)
+		require.NoError(t, err)
+		return k
+	}
+
+	base := key(input())
+	assert.Len(t, base, 64)
+	assert.Equal(t, base, key(input()))
+
+	// Provider 默认模型与显式指定相同模型等价
+	in := input()
+	in.Model = "gpt-4o"
+	assert.Equal(t, base, key(in))
+
+	in = input()
+	in.Model = "gpt-4o-mini"
+	assert.NotEqual(t, base, key(in))
+
+	in = input()
+	in.Prompt = "summarize doc.txt briefly"
+	assert.NotEqual(t, base, key(in))
+
+	in = input()
+	in.Config.Skills[0].Prompt = "review it carefully"
+	assert.NotEqual(t, base, key(in))
+
+	require.NoError(t, os.WriteFile(file, []byte("v2"), 0644))
+	assert.NotEqual(t, base, key(input()))
+
+	_, err := Key(&KeyInput{Files: []string{file}})
+	assert.Error(t, err)
+	in = input()
+	in.Files = []string{filepath.Join(dir, "missing")}
+	_, err = Key(in)
+	assert.Error(t, err)
+}
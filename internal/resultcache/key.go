@@ -0,0 +1,127 @@
+package resultcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/tmalldedede/agentbox/internal/agent"
+)
+
+// KeyInput 计算缓存键的输入
+type KeyInput struct {
+	Config *agent.AgentFullConfig // 解析后的 Agent 配置（Provider 已按实际使用的解析）
+	Model  string                 // 模型覆盖（为空时使用 Agent / Provider 的模型）
+	Prompt string                 // 渲染后的提示词
+	Files  []string               // 附件的本地路径（按内容参与哈希）
+}
+
+// keyMaterial 参与哈希的规范化内容
+type keyMaterial struct {
+	Adapter            string            `json:"adapter"`
+	Provider           string            `json:"provider"`
+	Model              string            `json:"model"`
+	ModelConfig        agent.ModelConfig `json:"model_config"`
+	SystemPrompt       string            `json:"system_prompt"`
+	AppendSystemPrompt string            `json:"append_system_prompt"`
+	Skills             []keySkill        `json:"skills"`
+	MCPServers         []keyMCP          `json:"mcp_servers"`
+	Prompt             string            `json:"prompt"`
+	Files              []keyFile         `json:"files"`
+}
+
+type keySkill struct {
+	ID           string      `json:"id"`
+	Version      string      `json:"version"`
+	Prompt       string      `json:"prompt"`
+	Files        interface{} `json:"files"`
+	AllowedTools []string    `json:"allowed_tools"`
+}
+
+type keyMCP struct {
+	ID      string   `json:"id"`
+	Type    string   `json:"type"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	URL     string   `json:"url"`
+}
+
+type keyFile struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+}
+
+// Key 计算缓存键：Agent 配置、提示词与附件内容的 SHA-256
+func Key(in *KeyInput) (string, error) {
+	cfg := in.Config
+	if cfg == nil || cfg.Agent == nil {
+		return "", fmt.Errorf("agent config is required")
+	}
+
+	m := keyMaterial{
+		Adapter:            cfg.Agent.Adapter,
+		Model:              in.Model,
+		ModelConfig:        cfg.Agent.ModelConfig,
+		SystemPrompt:       cfg.Agent.SystemPrompt,
+		AppendSystemPrompt: cfg.Agent.AppendSystemPrompt,
+		Prompt:             in.Prompt,
+	}
+	if m.Model == "" {
+		m.Model = cfg.Agent.Model
+	}
+	if cfg.Provider != nil {
+		m.Provider = cfg.Provider.ID
+		if m.Model == "" {
+			m.Model = cfg.Provider.DefaultModel
+		}
+	}
+	for _, s := range cfg.Skills {
+		m.Skills = append(m.Skills, keySkill{
+			ID:           s.ID,
+			Version:      s.Version,
+			Prompt:       s.Prompt,
+			Files:        s.Files,
+			AllowedTools: s.AllowedTools,
+		})
+	}
+	for _, s := range cfg.MCPServers {
+		m.MCPServers = append(m.MCPServers, keyMCP{
+			ID:      s.ID,
+			Type:    string(s.Type),
+			Command: s.Command,
+			Args:    s.Args,
+			URL:     s.URL,
+		})
+	}
+	for _, path := range in.Files {
+		sum, err := fileHash(path)
+		if err != nil {
+			return "", err
+		}
+		m.Files = append(m.Files, keyFile{Name: filepath.Base(path), SHA256: sum})
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func fileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file %s: %w", filepath.Base(path), err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read file %s: %w", filepath.Base(path), err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
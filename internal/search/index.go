@@ -0,0 +1,322 @@
+// Package search 任务、轮次与通道消息的全文检索
+//
+// 文档写入 search_documents 表，按数据库驱动选择索引方式：
+//   - SQLite：FTS5 虚拟表（trigram 分词，支持中文子串匹配），snippet() 生成高亮
+//   - PostgreSQL：to_tsvector GIN 表达式索引，ts_headline() 生成高亮
+//
+// SQLite 未编译 FTS5 或检索词不足 3 个字符时退化为 LIKE 匹配。
+package search
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/tmalldedede/agentbox/internal/database"
+	"github.com/tmalldedede/agentbox/internal/logger"
+	"gorm.io/gorm"
+)
+
+var log *slog.Logger
+
+func init() {
+	log = logger.Module("search")
+}
+
+// Kind 文档类型
+type Kind string
+
+const (
+	KindTask    Kind = "task"    // 任务 prompt
+	KindTurn    Kind = "turn"    // 追加轮次的 prompt
+	KindResult  Kind = "result"  // 轮次结果文本
+	KindMessage Kind = "message" // 通道消息
+)
+
+// IsValid 检查文档类型是否有效
+func (k Kind) IsValid() bool {
+	switch k {
+	case KindTask, KindTurn, KindResult, KindMessage:
+		return true
+	}
+	return false
+}
+
+// 索引后端
+const (
+	backendFTS5     = "sqlite_fts5"
+	backendLike     = "sqlite_like"
+	backendPostgres = "postgres"
+)
+
+const ftsTable = "search_documents_fts"
+
+// Document 检索文档
+type Document struct {
+	ID        string    `json:"id"` // {kind}:{ref_id}
+	Kind      Kind      `json:"kind"`
+	TaskID    string    `json:"task_id,omitempty"`
+	TurnID    string    `json:"turn_id,omitempty"`
+	UserID    string    `json:"user_id,omitempty"`
+	AgentID   string    `json:"agent_id,omitempty"`
+	Status    string    `json:"status,omitempty"`
+	Content   string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DocumentID 生成文档 ID
+func DocumentID(kind Kind, refID string) string {
+	return string(kind) + ":" + refID
+}
+
+// Index 全文检索索引
+type Index struct {
+	db      *gorm.DB
+	backend string
+}
+
+// NewIndex 创建检索索引（迁移文档表并按驱动建立全文索引）
+func NewIndex(db *gorm.DB) (*Index, error) {
+	if err := db.AutoMigrate(&database.SearchDocumentModel{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate search document table: %w", err)
+	}
+
+	idx := &Index{db: db}
+	switch db.Dialector.Name() {
+	case "postgres":
+		idx.backend = backendPostgres
+		if err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_search_documents_fts
+			ON search_documents USING GIN (to_tsvector('simple', content))`).Error; err != nil {
+			return nil, fmt.Errorf("failed to create full-text index: %w", err)
+		}
+	default:
+		idx.backend = backendFTS5
+		err := db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS ` + ftsTable +
+			` USING fts5(doc_id UNINDEXED, content, tokenize = 'trigram')`).Error
+		if err != nil {
+			log.Warn("FTS5 unavailable, falling back to LIKE search", "error", err)
+			idx.backend = backendLike
+		} else if err := idx.backfillRowIDs(); err != nil {
+			return nil, fmt.Errorf("failed to backfill full-text rowids: %w", err)
+		}
+	}
+	log.Info("search index initialized", "backend", idx.backend)
+	return idx, nil
+}
+
+// backfillRowIDs 为升级前写入的文档记录 FTS5 rowid（只扫描一遍 FTS 表）
+func (idx *Index) backfillRowIDs() error {
+	var missing int64
+	if err := idx.db.Model(&database.SearchDocumentModel{}).Where("fts_rowid = 0").Limit(1).Count(&missing).Error; err != nil {
+		return err
+	}
+	if missing == 0 {
+		return nil
+	}
+
+	rows, err := idx.db.Raw("SELECT rowid, doc_id FROM " + ftsTable).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	rowIDs := make(map[string]int64)
+	for rows.Next() {
+		var rowID int64
+		var docID string
+		if err := rows.Scan(&rowID, &docID); err != nil {
+			return err
+		}
+		rowIDs[docID] = rowID
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return idx.db.Transaction(func(tx *gorm.DB) error {
+		for docID, rowID := range rowIDs {
+			if err := tx.Model(&database.SearchDocumentModel{}).
+				Where("id = ? AND fts_rowid = 0", docID).
+				Update("fts_rowid", rowID).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Empty 索引中是否没有任何文档（用于启动时判断是否需要回填）
+func (idx *Index) Empty() bool {
+	var count int64
+	idx.db.Model(&database.SearchDocumentModel{}).Limit(1).Count(&count)
+	return count == 0
+}
+
+// ReplaceTask 用 docs 替换任务的全部文档（任务 / 轮次 / 结果，不含通道消息）
+//
+// 内容与状态均未变化时不做写入，任务频繁更新时避免重建索引。
+func (idx *Index) ReplaceTask(taskID string, docs []Document) error {
+	var existing []database.SearchDocumentModel
+	if err := idx.db.Where("task_id = ? AND kind <> ?", taskID, KindMessage).Find(&existing).Error; err != nil {
+		return err
+	}
+	if sameDocuments(existing, docs) {
+		return nil
+	}
+
+	return idx.db.Transaction(func(tx *gorm.DB) error {
+		ids := make([]string, len(existing))
+		for i := range existing {
+			ids[i] = existing[i].ID
+		}
+		if err := idx.delete(tx, ids); err != nil {
+			return err
+		}
+		for i := range docs {
+			if err := idx.insert(tx, &docs[i]); err != nil {
+				return err
+			}
+		}
+		// 任务状态变化同步到关联的通道消息
+		if len(docs) > 0 {
+			return tx.Model(&database.SearchDocumentModel{}).
+				Where("task_id = ? AND kind = ?", taskID, KindMessage).
+				Update("status", docs[0].Status).Error
+		}
+		return nil
+	})
+}
+
+// DeleteTask 删除任务的全部文档（含通道消息）
+func (idx *Index) DeleteTask(taskID string) error {
+	return idx.db.Transaction(func(tx *gorm.DB) error {
+		var ids []string
+		if err := tx.Model(&database.SearchDocumentModel{}).Where("task_id = ?", taskID).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		return idx.delete(tx, ids)
+	})
+}
+
+// PruneTasks 删除所属任务已不存在的文档（任务被批量清理后调用）
+func (idx *Index) PruneTasks() error {
+	return idx.db.Transaction(func(tx *gorm.DB) error {
+		var ids []string
+		err := tx.Model(&database.SearchDocumentModel{}).
+			Where("task_id <> '' AND task_id NOT IN (?)",
+				tx.Model(&database.TaskModel{}).Select("id")).
+			Pluck("id", &ids).Error
+		if err != nil {
+			return err
+		}
+		return idx.delete(tx, ids)
+	})
+}
+
+// IndexMessage 索引一条通道消息（归属用户、Agent 与状态取自关联任务）
+func (idx *Index) IndexMessage(doc Document) error {
+	doc.Kind = KindMessage
+	if doc.TaskID != "" && doc.UserID == "" {
+		var task database.TaskModel
+		if err := idx.db.Select("user_id", "agent_id", "status").First(&task, "id = ?", doc.TaskID).Error; err == nil {
+			doc.UserID = task.UserID
+			doc.AgentID = task.AgentID
+			doc.Status = task.Status
+		}
+	}
+	return idx.db.Transaction(func(tx *gorm.DB) error {
+		if err := idx.delete(tx, []string{doc.ID}); err != nil {
+			return err
+		}
+		return idx.insert(tx, &doc)
+	})
+}
+
+// RebuildMessages 回填已有的通道消息
+func (idx *Index) RebuildMessages() (int, error) {
+	var models []database.ChannelMessageModel
+	count := 0
+	err := idx.db.FindInBatches(&models, 500, func(tx *gorm.DB, batch int) error {
+		for i := range models {
+			m := &models[i]
+			if strings.TrimSpace(m.Content) == "" {
+				continue
+			}
+			if err := idx.IndexMessage(Document{
+				ID:        DocumentID(KindMessage, m.ID),
+				TaskID:    m.TaskID,
+				TurnID:    m.TurnID,
+				Content:   m.Content,
+				CreatedAt: m.ReceivedAt,
+			}); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	}).Error
+	return count, err
+}
+
+func (idx *Index) insert(tx *gorm.DB, doc *Document) error {
+	model := &database.SearchDocumentModel{
+		ID:        doc.ID,
+		Kind:      string(doc.Kind),
+		TaskID:    doc.TaskID,
+		TurnID:    doc.TurnID,
+		UserID:    doc.UserID,
+		AgentID:   doc.AgentID,
+		Status:    doc.Status,
+		Content:   doc.Content,
+		CreatedAt: doc.CreatedAt,
+	}
+	if idx.backend == backendFTS5 {
+		if err := tx.Exec("INSERT INTO "+ftsTable+" (doc_id, content) VALUES (?, ?)", doc.ID, doc.Content).Error; err != nil {
+			return err
+		}
+		if err := tx.Raw("SELECT last_insert_rowid()").Scan(&model.FTSRowID).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Create(model).Error
+}
+
+// delete 删除文档；FTS5 行按 rowid 删除（doc_id 是 UNINDEXED 列，按它过滤会扫描整张表）
+func (idx *Index) delete(tx *gorm.DB, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var rowIDs []int64
+	if idx.backend == backendFTS5 {
+		if err := tx.Model(&database.SearchDocumentModel{}).
+			Where("id IN ? AND fts_rowid > 0", ids).
+			Pluck("fts_rowid", &rowIDs).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Where("id IN ?", ids).Delete(&database.SearchDocumentModel{}).Error; err != nil {
+		return err
+	}
+	if len(rowIDs) > 0 {
+		return tx.Exec("DELETE FROM "+ftsTable+" WHERE rowid IN ?", rowIDs).Error
+	}
+	return nil
+}
+
+// sameDocuments 已索引的文档与新文档的 ID、内容和状态是否一致
+func sameDocuments(existing []database.SearchDocumentModel, docs []Document) bool {
+	if len(existing) != len(docs) {
+		return false
+	}
+	byID := make(map[string]*database.SearchDocumentModel, len(existing))
+	for i := range existing {
+		byID[existing[i].ID] = &existing[i]
+	}
+	for i := range docs {
+		m, ok := byID[docs[i].ID]
+		if !ok || m.Content != docs[i].Content || m.Status != docs[i].Status || m.UserID != docs[i].UserID {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,295 @@
+package search
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tmalldedede/agentbox/internal/apperr"
+	"github.com/tmalldedede/agentbox/internal/database"
+	"gorm.io/gorm"
+)
+
+// 高亮标记
+const (
+	HighlightStart = "<mark>"
+	HighlightEnd   = "</mark>"
+)
+
+// 数据库生成摘要时使用的占位标记，转义内容后再替换为高亮标记
+const (
+	markStart = "\x02"
+	markEnd   = "\x03"
+)
+
+const (
+	defaultLimit   = 20
+	maxLimit       = 100
+	minTrigramTerm = 3  // trigram 分词下可匹配的最短检索词（字符）
+	snippetRunes   = 80 // LIKE 检索时摘要前后保留的字符数
+)
+
+// Query 检索条件
+type Query struct {
+	Text    string     // 检索词，空格分隔的词需全部命中，"..." 包裹的短语整体匹配
+	UserID  string     // 任务归属用户（非 admin 强制为当前用户）
+	AgentID string     // 按 Agent 过滤
+	Status  string     // 按任务状态过滤
+	Kinds   []Kind     // 按文档类型过滤，空表示全部
+	From    *time.Time // 创建时间下限
+	To      *time.Time // 创建时间上限
+	Limit   int
+	Offset  int
+}
+
+// Hit 检索命中
+type Hit struct {
+	Document
+	Snippet string `json:"snippet"` // 命中片段（HTML 转义），检索词以 <mark></mark> 包裹
+}
+
+// Results 检索结果
+type Results struct {
+	Hits  []Hit `json:"hits"`
+	Total int64 `json:"total"`
+}
+
+var termPattern = regexp.MustCompile(`"([^"]+)"|(\S+)`)
+
+// parseTerms 拆分检索词（支持双引号短语）
+func parseTerms(text string) []string {
+	var terms []string
+	for _, m := range termPattern.FindAllStringSubmatch(text, -1) {
+		term := strings.TrimSpace(m[1] + m[2])
+		if term != "" {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// Search 执行全文检索，按相关度排序（LIKE 退化模式按时间倒序）
+func (idx *Index) Search(q *Query) (*Results, error) {
+	terms := parseTerms(q.Text)
+	if len(terms) == 0 {
+		return nil, apperr.BadRequest("search query is required")
+	}
+	for _, k := range q.Kinds {
+		if !k.IsValid() {
+			return nil, apperr.BadRequestf("invalid kind: %s (expected task, turn, result or message)", k)
+		}
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultLimit
+	}
+	if q.Limit > maxLimit {
+		q.Limit = maxLimit
+	}
+
+	backend := idx.backend
+	if backend == backendFTS5 {
+		for _, t := range terms {
+			if utf8.RuneCountInString(t) < minTrigramTerm {
+				backend = backendLike
+				break
+			}
+		}
+	}
+
+	switch backend {
+	case backendFTS5:
+		return idx.searchFTS5(q, terms)
+	case backendPostgres:
+		return idx.searchPostgres(q, terms)
+	default:
+		return idx.searchLike(q, terms)
+	}
+}
+
+// filter 应用通用过滤条件，d 为文档表别名
+func (q *Query) filter(db *gorm.DB) *gorm.DB {
+	if q.UserID != "" {
+		db = db.Where("d.user_id = ?", q.UserID)
+	}
+	if q.AgentID != "" {
+		db = db.Where("d.agent_id = ?", q.AgentID)
+	}
+	if q.Status != "" {
+		db = db.Where("d.status = ?", q.Status)
+	}
+	if len(q.Kinds) > 0 {
+		db = db.Where("d.kind IN ?", q.Kinds)
+	}
+	if q.From != nil {
+		db = db.Where("d.created_at >= ?", *q.From)
+	}
+	if q.To != nil {
+		db = db.Where("d.created_at <= ?", *q.To)
+	}
+	return db
+}
+
+type hitRow struct {
+	database.SearchDocumentModel
+	Snippet string
+}
+
+func toResults(rows []hitRow, total int64) *Results {
+	res := &Results{Hits: make([]Hit, len(rows)), Total: total}
+	for i := range rows {
+		r := &rows[i]
+		res.Hits[i] = Hit{
+			Document: Document{
+				ID:        r.ID,
+				Kind:      Kind(r.Kind),
+				TaskID:    r.TaskID,
+				TurnID:    r.TurnID,
+				UserID:    r.UserID,
+				AgentID:   r.AgentID,
+				Status:    r.Status,
+				CreatedAt: r.CreatedAt,
+			},
+			Snippet: renderSnippet(r.Snippet),
+		}
+	}
+	return res
+}
+
+// searchFTS5 SQLite FTS5：词间为 AND，按 bm25 排序
+func (idx *Index) searchFTS5(q *Query, terms []string) (*Results, error) {
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(t, `"`, `""`) + `"`
+	}
+	match := strings.Join(quoted, " ")
+
+	base := func() *gorm.DB {
+		return q.filter(idx.db.Table(ftsTable).
+			Joins("JOIN search_documents d ON d.id = "+ftsTable+".doc_id").
+			Where(ftsTable+" MATCH ?", match))
+	}
+
+	var total int64
+	if err := base().Count(&total).Error; err != nil {
+		return nil, err
+	}
+	var rows []hitRow
+	err := base().
+		Select("d.*, snippet(" + ftsTable + ", 1, '" + markStart + "', '" + markEnd + "', '...', 24) AS snippet").
+		Order(ftsTable + ".rank").
+		Limit(q.Limit).Offset(q.Offset).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return toResults(rows, total), nil
+}
+
+// searchPostgres PostgreSQL 全文检索：websearch_to_tsquery 解析检索词，按 ts_rank 排序
+func (idx *Index) searchPostgres(q *Query, terms []string) (*Results, error) {
+	text := strings.Join(terms, " ")
+	const tsq = "websearch_to_tsquery('simple', ?)"
+
+	base := func() *gorm.DB {
+		return q.filter(idx.db.Table("search_documents AS d").
+			Where("to_tsvector('simple', d.content) @@ "+tsq, text))
+	}
+
+	var total int64
+	if err := base().Count(&total).Error; err != nil {
+		return nil, err
+	}
+	var rows []hitRow
+	err := base().
+		Select("d.*, ts_headline('simple', d.content, "+tsq+
+			", 'StartSel="+markStart+", StopSel="+markEnd+", MaxWords=35, MinWords=15') AS snippet", text).
+		Order(gorm.Expr("ts_rank(to_tsvector('simple', d.content), "+tsq+") DESC", text)).
+		Limit(q.Limit).Offset(q.Offset).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return toResults(rows, total), nil
+}
+
+// searchLike 退化模式：每个词 LIKE 匹配，按时间倒序，摘要与高亮在内存中生成
+func (idx *Index) searchLike(q *Query, terms []string) (*Results, error) {
+	base := func() *gorm.DB {
+		db := q.filter(idx.db.Table("search_documents AS d"))
+		for _, t := range terms {
+			db = db.Where(`LOWER(d.content) LIKE ? ESCAPE '\'`, "%"+likeEscaper.Replace(strings.ToLower(t))+"%")
+		}
+		return db
+	}
+
+	var total int64
+	if err := base().Count(&total).Error; err != nil {
+		return nil, err
+	}
+	var rows []hitRow
+	if err := base().Select("d.*").Order("d.created_at DESC").
+		Limit(q.Limit).Offset(q.Offset).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		rows[i].Snippet = highlight(rows[i].Content, terms)
+	}
+	return toResults(rows, total), nil
+}
+
+// markReplacer 占位标记替换为高亮标记
+var markReplacer = strings.NewReplacer(markStart, HighlightStart, markEnd, HighlightEnd)
+
+// renderSnippet 转义摘要中的文档内容后插入高亮标记（文档内容不可信，不能原样作为 HTML 返回）
+func renderSnippet(s string) string {
+	return markReplacer.Replace(html.EscapeString(s))
+}
+
+// likeEscaper 转义 LIKE 通配符（配合 ESCAPE '\'）
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// highlight 截取首个命中词附近的片段并标记全部命中词（大小写不敏感），
+// 片段中的占位标记在 toResults 中于 HTML 转义后替换为高亮标记
+func highlight(content string, terms []string) string {
+	re := termsPattern(terms)
+	first := 0
+	if loc := re.FindStringIndex(content); loc != nil {
+		first = loc[0]
+	}
+
+	// 按字符截取 [first-snippetRunes, first+2*snippetRunes)
+	runes := []rune(content)
+	pos := utf8.RuneCountInString(content[:first])
+	start := pos - snippetRunes
+	if start < 0 {
+		start = 0
+	}
+	end := pos + 2*snippetRunes
+	if end > len(runes) {
+		end = len(runes)
+	}
+	snippet := string(runes[start:end])
+
+	var sb strings.Builder
+	if start > 0 {
+		sb.WriteString("...")
+	}
+	sb.WriteString(re.ReplaceAllStringFunc(snippet, func(m string) string {
+		return markStart + m + markEnd
+	}))
+	if end < len(runes) {
+		sb.WriteString("...")
+	}
+	return sb.String()
+}
+
+// termsPattern 匹配任一检索词（大小写不敏感）
+func termsPattern(terms []string) *regexp.Regexp {
+	parts := make([]string, len(terms))
+	for i, t := range terms {
+		parts[i] = regexp.QuoteMeta(t)
+	}
+	return regexp.MustCompile("(?i)" + strings.Join(parts, "|"))
+}
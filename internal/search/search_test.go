@@ -0,0 +1,193 @@
+package search
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	glebarez "github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmalldedede/agentbox/internal/database"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// setupIndexes 分别使用支持 FTS5 的纯 Go 驱动与未编译 FTS5 的 cgo 驱动（LIKE 退化）
+func setupIndexes(t *testing.T) map[string]*Index {
+	t.Helper()
+	cfg := &gorm.Config{Logger: gormlogger.Default.LogMode(gormlogger.Silent)}
+	indexes := map[string]*Index{}
+	for name, dialector := range map[string]gorm.Dialector{
+		"fts5": glebarez.Open(":memory:"),
+		"like": sqlite.Open(":memory:"),
+	} {
+		db, err := gorm.Open(dialector, cfg)
+		require.NoError(t, err)
+		require.NoError(t, db.AutoMigrate(&database.TaskModel{}))
+		idx, err := NewIndex(db)
+		require.NoError(t, err)
+		indexes[name] = idx
+	}
+	require.Equal(t, backendFTS5, indexes["fts5"].backend)
+	return indexes
+}
+
+func seed(t *testing.T, idx *Index) {
+	t.Helper()
+	now := time.Now()
+	require.NoError(t, idx.ReplaceTask("task-1", []Document{
+		{ID: DocumentID(KindTask, "task-1"), Kind: KindTask, TaskID: "task-1", UserID: "alice", AgentID: "coder",
+			Status: "completed", Content: "Refactor the billing service retry logic", CreatedAt: now},
+		{ID: DocumentID(KindResult, "turn-1"), Kind: KindResult, TaskID: "task-1", TurnID: "turn-1", UserID: "alice",
+			AgentID: "coder", Status: "completed", Content: "Updated billing/service.go and added tests", CreatedAt: now},
+	}))
+	require.NoError(t, idx.ReplaceTask("task-2", []Document{
+		{ID: DocumentID(KindTask, "task-2"), Kind: KindTask, TaskID: "task-2", UserID: "bob", AgentID: "writer",
+			Status: "failed", Content: "Summarize the billing meeting notes", CreatedAt: now.Add(-48 * time.Hour)},
+	}))
+}
+
+func TestSearch(t *testing.T) {
+	for name, idx := range setupIndexes(t) {
+		t.Run(name, func(t *testing.T) {
+			assert.True(t, idx.Empty())
+			seed(t, idx)
+			assert.False(t, idx.Empty())
+
+			res, err := idx.Search(&Query{Text: "billing"})
+			require.NoError(t, err)
+			assert.EqualValues(t, 3, res.Total)
+
+			// 多个词需全部命中，摘要高亮
+			res, err = idx.Search(&Query{Text: "billing service"})
+			require.NoError(t, err)
+			require.EqualValues(t, 2, res.Total)
+			assert.Contains(t, res.Hits[0].Snippet, "<mark>")
+			assert.Equal(t, "task-1", res.Hits[0].TaskID)
+
+			// 归属用户 / Agent / 状态 / 类型 / 时间过滤
+			res, err = idx.Search(&Query{Text: "billing", UserID: "bob"})
+			require.NoError(t, err)
+			require.EqualValues(t, 1, res.Total)
+			assert.Equal(t, "task-2", res.Hits[0].TaskID)
+
+			res, err = idx.Search(&Query{Text: "billing", AgentID: "coder", Kinds: []Kind{KindResult}})
+			require.NoError(t, err)
+			require.EqualValues(t, 1, res.Total)
+			assert.Equal(t, "turn-1", res.Hits[0].TurnID)
+
+			from := time.Now().Add(-time.Hour)
+			res, err = idx.Search(&Query{Text: "billing", Status: "completed", From: &from})
+			require.NoError(t, err)
+			assert.EqualValues(t, 2, res.Total)
+
+			_, err = idx.Search(&Query{Text: "  "})
+			assert.Error(t, err)
+			_, err = idx.Search(&Query{Text: "x", Kinds: []Kind{"nope"}})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestIndex_ReplaceAndMessages(t *testing.T) {
+	for name, idx := range setupIndexes(t) {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, idx.db.Create(&database.TaskModel{
+				BaseModel: database.BaseModel{ID: "task-1"}, UserID: "alice", AgentID: "coder", Status: "running",
+			}).Error)
+			seed(t, idx)
+
+			// 通道消息继承任务的归属用户
+			require.NoError(t, idx.IndexMessage(Document{
+				ID: DocumentID(KindMessage, "msg-1"), TaskID: "task-1", Content: "请检查计费服务的重试逻辑", CreatedAt: time.Now(),
+			}))
+			res, err := idx.Search(&Query{Text: "计费服务", UserID: "alice"})
+			require.NoError(t, err)
+			require.EqualValues(t, 1, res.Total)
+			assert.Equal(t, KindMessage, res.Hits[0].Kind)
+			assert.Contains(t, res.Hits[0].Snippet, "<mark>计费服务</mark>")
+
+			// 替换任务文档：旧内容不再命中，消息保留
+			require.NoError(t, idx.ReplaceTask("task-1", []Document{
+				{ID: DocumentID(KindTask, "task-1"), Kind: KindTask, TaskID: "task-1", UserID: "alice", Status: "completed", Content: "Rename invoices"},
+			}))
+			res, err = idx.Search(&Query{Text: "retry"})
+			require.NoError(t, err)
+			assert.EqualValues(t, 0, res.Total)
+			res, err = idx.Search(&Query{Text: "计费服务", Status: "completed"})
+			require.NoError(t, err)
+			assert.EqualValues(t, 1, res.Total, "message status follows the task")
+
+			require.NoError(t, idx.DeleteTask("task-1"))
+			res, err = idx.Search(&Query{Text: "计费服务"})
+			require.NoError(t, err)
+			assert.EqualValues(t, 0, res.Total)
+		})
+	}
+}
+
+func TestIndex_DeletesFTSRowsByRowID(t *testing.T) {
+	idx := setupIndexes(t)["fts5"]
+	seed(t, idx)
+	ftsRows := func() int64 {
+		var n int64
+		require.NoError(t, idx.db.Raw("SELECT COUNT(*) FROM "+ftsTable).Scan(&n).Error)
+		return n
+	}
+	assert.EqualValues(t, 3, ftsRows())
+
+	var missing int64
+	require.NoError(t, idx.db.Model(&database.SearchDocumentModel{}).Where("fts_rowid = 0").Count(&missing).Error)
+	assert.Zero(t, missing)
+
+	require.NoError(t, idx.ReplaceTask("task-1", []Document{
+		{ID: DocumentID(KindTask, "task-1"), Kind: KindTask, TaskID: "task-1", Status: "completed", Content: "Rename invoices"},
+	}))
+	assert.EqualValues(t, 2, ftsRows())
+
+	// 升级前写入的文档没有 rowid：初始化时回填，之后可以按 rowid 删除
+	require.NoError(t, idx.db.Model(&database.SearchDocumentModel{}).Where("1 = 1").Update("fts_rowid", 0).Error)
+	require.NoError(t, idx.backfillRowIDs())
+	require.NoError(t, idx.DeleteTask("task-2"))
+	assert.EqualValues(t, 1, ftsRows())
+	res, err := idx.Search(&Query{Text: "invoices"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, res.Total)
+}
+
+func TestSearch_EscapesSnippets(t *testing.T) {
+	for name, idx := range setupIndexes(t) {
+		t.Run(name, func(t *testing.T) {
+			seed(t, idx)
+			require.NoError(t, idx.ReplaceTask("task-3", []Document{
+				{ID: DocumentID(KindTask, "task-3"), Kind: KindTask, TaskID: "task-3", UserID: "eve", AgentID: "coder",
+					Status: "completed", Content: `<img src=x onerror=alert(1)> 100% done_now`, CreatedAt: time.Now()},
+			}))
+
+			res, err := idx.Search(&Query{Text: "onerror"})
+			require.NoError(t, err)
+			require.EqualValues(t, 1, res.Total)
+			assert.NotContains(t, res.Hits[0].Snippet, "<img")
+			assert.Contains(t, res.Hits[0].Snippet, "&lt;img src=x <mark>onerror</mark>")
+
+			// LIKE 通配符按字面匹配
+			for _, text := range []string{"%", "_", "0%"} {
+				res, err = idx.Search(&Query{Text: text})
+				require.NoError(t, err)
+				assert.EqualValues(t, 1, res.Total, text)
+			}
+		})
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	assert.Equal(t, "Fix the <mark>Billing</mark> <mark>service</mark>",
+		renderSnippet(highlight("Fix the Billing service", []string{"billing", "SERVICE"})))
+	// 小写后字节长度变化的字符不影响定位
+	content := strings.Repeat("ȺİK", 40) + " billing"
+	assert.True(t, strings.HasSuffix(renderSnippet(highlight(content, []string{"BILLING"})), " <mark>billing</mark>"))
+	assert.Equal(t, "a &lt;b&gt; <mark>x</mark>", renderSnippet(highlight("a <b> x", []string{"x"})))
+	assert.Equal(t, []string{"billing service", "retry"}, parseTerms(`"billing service"  retry`))
+}
@@ -60,6 +60,9 @@ func (s *DBStore) List(filter *ListFilter) ([]*Session, error) {
 		if filter.Status != "" {
 			query = query.Where("status = ?", filter.Status)
 		}
+		if filter.NodeID != "" {
+			query = query.Where("node_id = ?", filter.NodeID)
+		}
 		if filter.Limit > 0 {
 			query = query.Limit(filter.Limit)
 		}
@@ -97,6 +100,9 @@ func (s *DBStore) Count(filter *ListFilter) (int, error) {
 		if filter.Status != "" {
 			query = query.Where("status = ?", filter.Status)
 		}
+		if filter.NodeID != "" {
+			query = query.Where("node_id = ?", filter.NodeID)
+		}
 	}
 
 	var count int64
@@ -178,6 +184,7 @@ func (s *DBStore) toModel(session *Session) (*database.SessionModel, error) {
 		Agent:       session.Agent,
 		Status:      string(session.Status),
 		ContainerID: session.ContainerID,
+		NodeID:      session.NodeID,
 		Workspace:   session.Workspace,
 		Config:      string(configJSON),
 	}
@@ -198,6 +205,7 @@ func (s *DBStore) fromModel(model *database.SessionModel) (*Session, error) {
 		Status:      Status(model.Status),
 		Workspace:   model.Workspace,
 		ContainerID: model.ContainerID,
+		NodeID:      model.NodeID,
 		Config:      cfg,
 		CreatedAt:   model.CreatedAt,
 		UpdatedAt:   model.UpdatedAt,
@@ -15,15 +15,22 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/tmalldedede/agentbox/internal/agent"
+	"github.com/tmalldedede/agentbox/internal/apperr"
 	"github.com/tmalldedede/agentbox/internal/container"
 	"github.com/tmalldedede/agentbox/internal/engine"
+	"github.com/tmalldedede/agentbox/internal/labels"
+	"github.com/tmalldedede/agentbox/internal/llmproxy"
 	"github.com/tmalldedede/agentbox/internal/logger"
 	"github.com/tmalldedede/agentbox/internal/skill"
+	"github.com/tmalldedede/agentbox/internal/worker"
 )
 
 // 模块日志器
 var log *slog.Logger
 
+// ErrApprovalRequired 启用工具审批的 Agent 只能以任务方式执行（由任务注入审批工具）
+var ErrApprovalRequired = apperr.BadRequest("agent requires tool approval, run it as a task")
+
 func init() {
 	log = logger.Module("session")
 }
@@ -35,7 +42,11 @@ type Manager struct {
 	agentRegistry *engine.Registry
 	agentMgr      *agent.Manager
 	skillMgr      *skill.Manager
+	workers       *worker.Hub
 	workspaceBase string
+
+	// LLM 凭证代理（可选，设置后容器只拿到会话级 token）
+	llmProxy *llmproxy.Proxy
 }
 
 // NewManager 创建会话管理器
@@ -58,6 +69,114 @@ func (m *Manager) SetSkillManager(mgr *skill.Manager) {
 	m.skillMgr = mgr
 }
 
+// SetWorkerHub 设置远程 Worker 节点注册中心（可选依赖）
+// 设置后新会话按容量与 Agent 的 node_selector 放置到本机或远程节点
+func (m *Manager) SetWorkerHub(hub *worker.Hub) {
+	m.workers = hub
+}
+
+// SetLLMProxy 设置 LLM 凭证代理（可选依赖）
+// 设置后会话环境中的 Provider API Key 替换为会话级 token，base URL 指向 AgentBox 的代理
+func (m *Manager) SetLLMProxy(p *llmproxy.Proxy) {
+	m.llmProxy = p
+}
+
+// workspaceSyncer 远程节点的工作区不在控制面磁盘上，执行前后需要同步
+type workspaceSyncer interface {
+	PushWorkspace(ctx context.Context, dir string) error
+	PullWorkspace(ctx context.Context, dir string) error
+}
+
+// place 为会话选择运行节点，返回该节点的容器管理器
+func (m *Manager) place(session *Session, image string, fullConfig *agent.AgentFullConfig) (container.Manager, error) {
+	if m.workers == nil {
+		return m.containerMgr, nil
+	}
+	var selector labels.Selector
+	if fullConfig != nil && fullConfig.Agent.NodeSelector != "" {
+		var err error
+		if selector, err = labels.Parse(fullConfig.Agent.NodeSelector); err != nil {
+			return nil, err
+		}
+	}
+	node, err := m.workers.Place(&worker.Placement{SessionID: session.ID, Image: image, Selector: selector})
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return m.containerMgr, nil
+	}
+	session.NodeID = node.ID()
+	log.Info("session placed on worker node", "session_id", session.ID, "node_id", session.NodeID)
+	return node, nil
+}
+
+// release 释放会话占用的节点容量
+func (m *Manager) release(session *Session) {
+	if m.workers != nil {
+		m.workers.Release(session.ID)
+	}
+}
+
+// containersFor 返回会话所在节点的容器管理器（节点已断开时返回 worker.ErrNodeLost）
+func (m *Manager) containersFor(session *Session) (container.Manager, error) {
+	if session.NodeID == "" {
+		return m.containerMgr, nil
+	}
+	if m.workers != nil {
+		if node, ok := m.workers.Node(session.NodeID); ok {
+			return node, nil
+		}
+	}
+	return nil, fmt.Errorf("session %s on node %s: %w", session.ID, session.NodeID, worker.ErrNodeLost)
+}
+
+// pushWorkspace 执行前将控制面工作区同步到远程节点（如附件文件）
+func (m *Manager) pushWorkspace(ctx context.Context, ctrs container.Manager, session *Session) error {
+	if syncer, ok := ctrs.(workspaceSyncer); ok {
+		if err := syncer.PushWorkspace(ctx, session.Workspace); err != nil {
+			return fmt.Errorf("failed to sync workspace to node %s: %w", session.NodeID, err)
+		}
+	}
+	return nil
+}
+
+// pullWorkspace 执行后将远程节点的工作区同步回控制面，便于收集产出文件
+func (m *Manager) pullWorkspace(ctx context.Context, ctrs container.Manager, session *Session) {
+	if syncer, ok := ctrs.(workspaceSyncer); ok {
+		if err := syncer.PullWorkspace(ctx, session.Workspace); err != nil {
+			log.Warn("failed to sync workspace from node", "session_id", session.ID, "node_id", session.NodeID, "error", err)
+		}
+	}
+}
+
+// HandleNodeLost 节点断开后将其上的会话标记为 error，返回受影响的会话
+//
+// 进行中的执行会以 worker.ErrNodeLost 失败，由任务的重试策略决定重新调度或失败。
+func (m *Manager) HandleNodeLost(nodeID string) []*Session {
+	sessions, err := m.store.List(&ListFilter{NodeID: nodeID})
+	if err != nil {
+		log.Error("failed to list sessions of lost node", "node_id", nodeID, "error", err)
+		return nil
+	}
+	affected := make([]*Session, 0, len(sessions))
+	for _, session := range sessions {
+		if session.Status != StatusRunning && session.Status != StatusCreating {
+			continue
+		}
+		session.Status = StatusError
+		if err := m.store.Update(session); err != nil {
+			log.Error("failed to mark session as error", "session_id", session.ID, "error", err)
+			continue
+		}
+		affected = append(affected, session)
+	}
+	if len(affected) > 0 {
+		log.Warn("sessions lost with worker node", "node_id", nodeID, "count", len(affected))
+	}
+	return affected
+}
+
 // Create 创建会话
 func (m *Manager) Create(ctx context.Context, req *CreateRequest) (*Session, error) {
 	// 确定适配器名称
@@ -168,6 +287,26 @@ func (m *Manager) Create(ctx context.Context, req *CreateRequest) (*Session, err
 		envVars[k] = v
 	}
 
+	// 经 LLM 代理时容器内不出现真实 API Key
+	if m.llmProxy != nil {
+		providerID := req.ProviderID
+		if providerID == "" && fullConfig != nil && fullConfig.Provider != nil {
+			providerID = fullConfig.Provider.ID
+		}
+		proxied, err := m.llmProxy.Issue(&llmproxy.Grant{
+			SessionID:   sessionID,
+			ProviderID:  providerID,
+			BudgetKey:   req.BudgetKey,
+			TokenBudget: req.TokenBudget,
+		}, envVars)
+		if err != nil {
+			session.Status = StatusError
+			_ = m.store.Update(session)
+			return nil, fmt.Errorf("failed to issue LLM proxy token: %w", err)
+		}
+		envVars = proxied
+	}
+
 	// 准备容器配置
 	containerConfig := adapter.PrepareContainer(&engine.SessionInfo{
 		ID:        sessionID,
@@ -199,9 +338,18 @@ func (m *Manager) Create(ctx context.Context, req *CreateRequest) (*Session, err
 	}
 	containerConfig.Labels["agentbox.session_id"] = sessionID
 
+	// 选择运行节点（配置了远程 Worker 时按容量与标签放置）
+	ctrs, err := m.place(session, containerConfig.Image, fullConfig)
+	if err != nil {
+		session.Status = StatusError
+		_ = m.store.Update(session)
+		return nil, fmt.Errorf("failed to place session: %w", err)
+	}
+
 	// 创建容器
-	ctr, err := m.containerMgr.Create(ctx, containerConfig)
+	ctr, err := ctrs.Create(ctx, containerConfig)
 	if err != nil {
+		m.release(session)
 		session.Status = StatusError
 		_ = m.store.Update(session)
 		return nil, fmt.Errorf("failed to create container: %w", err)
@@ -210,14 +358,15 @@ func (m *Manager) Create(ctx context.Context, req *CreateRequest) (*Session, err
 	session.ContainerID = ctr.ID
 
 	// 启动容器
-	if err := m.containerMgr.Start(ctx, ctr.ID); err != nil {
+	if err := ctrs.Start(ctx, ctr.ID); err != nil {
+		m.release(session)
 		session.Status = StatusError
 		_ = m.store.Update(session)
 		return nil, fmt.Errorf("failed to start container: %w", err)
 	}
 
 	// 写入配置文件（如果适配器需要）
-	if err := m.writeConfigFiles(ctx, adapter, ctr.ID, req, envVars); err != nil {
+	if err := m.writeConfigFiles(ctx, ctrs, adapter, ctr.ID, req, envVars); err != nil {
 		// 配置文件写入失败不中断创建，但记录警告
 		log.Warn("failed to write config files", "session_id", sessionID, "error", err)
 	} else {
@@ -225,7 +374,7 @@ func (m *Manager) Create(ctx context.Context, req *CreateRequest) (*Session, err
 	}
 
 	// 注入 Skills 文件到容器（独立于配置文件）
-	if err := m.injectSkills(ctx, ctr.ID, req, workspace); err != nil {
+	if err := m.injectSkills(ctx, ctrs, ctr.ID, req, workspace); err != nil {
 		log.Warn("failed to inject skills", "session_id", sessionID, "error", err)
 	}
 
@@ -301,7 +450,7 @@ func resolvePathWithSymlinks(path string) string {
 }
 
 // writeConfigFiles 写入配置文件到容器
-func (m *Manager) writeConfigFiles(ctx context.Context, adapter engine.Adapter, containerID string, req *CreateRequest, envVars map[string]string) error {
+func (m *Manager) writeConfigFiles(ctx context.Context, ctrs container.Manager, adapter engine.Adapter, containerID string, req *CreateRequest, envVars map[string]string) error {
 	// 检查适配器是否实现 ConfigFilesProvider 接口
 	cfgProvider, ok := adapter.(engine.ConfigFilesProvider)
 	if !ok {
@@ -334,6 +483,11 @@ func (m *Manager) writeConfigFiles(ctx context.Context, adapter engine.Adapter,
 		}
 	}
 
+	// 经 LLM 代理时配置文件中的地址同样指向代理
+	if m.llmProxy != nil && envVars["OPENAI_BASE_URL"] == m.llmProxy.BaseURL(llmproxy.APIOpenAI) {
+		cfg.Model.BaseURL = envVars["OPENAI_BASE_URL"]
+	}
+
 	// 从环境变量补充 Model 配置（优先级低于 Agent 配置）
 	if cfg.Model.BaseURL == "" {
 		if baseURL, ok := req.Env["OPENAI_BASE_URL"]; ok && baseURL != "" {
@@ -401,7 +555,7 @@ func (m *Manager) writeConfigFiles(ctx context.Context, adapter engine.Adapter,
 			fmt.Sprintf("mkdir -p %s && cat > %s << 'AGENTBOX_EOF'\n%s\nAGENTBOX_EOF", dir, expandedPath, escapedContent),
 		}
 		log.Debug("exec write command", "dir", dir, "path", expandedPath)
-		result, err := m.containerMgr.Exec(ctx, containerID, writeCmd)
+		result, err := ctrs.Exec(ctx, containerID, writeCmd)
 		if err != nil {
 			log.Error("failed to write config file", "path", path, "error", err)
 			return fmt.Errorf("failed to write file %s: %w", path, err)
@@ -414,7 +568,7 @@ func (m *Manager) writeConfigFiles(ctx context.Context, adapter engine.Adapter,
 
 // injectSkills 注入 Skills 到容器（独立于适配器配置）
 // 包括 Agent 配置的 Skills 和工作区 Skills
-func (m *Manager) injectSkills(ctx context.Context, containerID string, req *CreateRequest, workspace string) error {
+func (m *Manager) injectSkills(ctx context.Context, ctrs container.Manager, containerID string, req *CreateRequest, workspace string) error {
 	var skillIDs []string
 	if req.AgentID != "" && m.agentMgr != nil {
 		if fullConfig, err := m.agentMgr.GetFullConfig(req.AgentID); err == nil {
@@ -435,13 +589,13 @@ func (m *Manager) injectSkills(ctx context.Context, containerID string, req *Cre
 	}
 
 	// 写入 Agent 配置的 Skills
-	if err := m.writeSkillFiles(ctx, containerID, skillIDs); err != nil {
+	if err := m.writeSkillFiles(ctx, ctrs, containerID, skillIDs); err != nil {
 		return err
 	}
 
 	// 写入工作区 Skills（优先级较低，不覆盖已有的同名 Skill）
 	if len(workspaceSkills) > 0 {
-		if err := m.writeWorkspaceSkills(ctx, containerID, workspaceSkills, skillIDs); err != nil {
+		if err := m.writeWorkspaceSkills(ctx, ctrs, containerID, workspaceSkills, skillIDs); err != nil {
 			log.Warn("failed to write workspace skills", "error", err)
 		}
 	}
@@ -450,7 +604,7 @@ func (m *Manager) injectSkills(ctx context.Context, containerID string, req *Cre
 }
 
 // writeWorkspaceSkills 写入工作区 Skills
-func (m *Manager) writeWorkspaceSkills(ctx context.Context, containerID string, skills []*skill.Skill, existingIDs []string) error {
+func (m *Manager) writeWorkspaceSkills(ctx context.Context, ctrs container.Manager, containerID string, skills []*skill.Skill, existingIDs []string) error {
 	// 构建已存在的 ID 集合
 	existingSet := make(map[string]bool)
 	for _, id := range existingIDs {
@@ -458,7 +612,7 @@ func (m *Manager) writeWorkspaceSkills(ctx context.Context, containerID string,
 	}
 
 	// 获取容器内 HOME 目录
-	homeResult, err := m.containerMgr.Exec(ctx, containerID, []string{"sh", "-c", "echo $HOME"})
+	homeResult, err := ctrs.Exec(ctx, containerID, []string{"sh", "-c", "echo $HOME"})
 	if err != nil {
 		return err
 	}
@@ -480,20 +634,20 @@ func (m *Manager) writeWorkspaceSkills(ctx context.Context, containerID string,
 		// 复制 SourceDir（如果有）
 		if s.SourceDir != "" {
 			mkdirCmd := []string{"sh", "-c", fmt.Sprintf("mkdir -p %s/.codex/skills", containerHome)}
-			if _, err := m.containerMgr.Exec(ctx, containerID, mkdirCmd); err != nil {
+			if _, err := ctrs.Exec(ctx, containerID, mkdirCmd); err != nil {
 				log.Error("failed to create skills dir", "skill_id", s.ID, "error", err)
 				continue
 			}
 
 			dstPath := fmt.Sprintf("%s/.codex/skills/", containerHome)
-			if err := m.containerMgr.CopyToContainer(ctx, containerID, s.SourceDir, dstPath); err != nil {
+			if err := ctrs.CopyToContainer(ctx, containerID, s.SourceDir, dstPath); err != nil {
 				log.Error("failed to copy workspace skill", "skill_id", s.ID, "error", err)
 				continue
 			}
 
 			// 修复权限
 			chownCmd := []string{"sh", "-c", fmt.Sprintf("chmod -R 755 %s", containerSkillDir)}
-			m.containerMgr.Exec(ctx, containerID, chownCmd)
+			ctrs.Exec(ctx, containerID, chownCmd)
 		}
 
 		// 生成 SKILL.md
@@ -506,7 +660,7 @@ func (m *Manager) writeWorkspaceSkills(ctx context.Context, containerID string,
 			fmt.Sprintf("mkdir -p %s && cat > %s << 'AGENTBOX_SKILL_EOF'\n%s\nAGENTBOX_SKILL_EOF", skillDir, skillPath, escapedContent),
 		}
 
-		if _, err := m.containerMgr.Exec(ctx, containerID, writeCmd); err != nil {
+		if _, err := ctrs.Exec(ctx, containerID, writeCmd); err != nil {
 			log.Error("failed to write workspace skill", "skill_id", s.ID, "error", err)
 			continue
 		}
@@ -519,7 +673,7 @@ func (m *Manager) writeWorkspaceSkills(ctx context.Context, containerID string,
 
 // writeSkillFiles 写入 Skills 文件到容器
 // Skills 文件存放位置: ~/.codex/skills/{skill-id}/SKILL.md
-func (m *Manager) writeSkillFiles(ctx context.Context, containerID string, skillIDs []string) error {
+func (m *Manager) writeSkillFiles(ctx context.Context, ctrs container.Manager, containerID string, skillIDs []string) error {
 	if m.skillMgr == nil {
 		log.Debug("skill manager not set, skipping skill injection")
 		return nil
@@ -533,7 +687,7 @@ func (m *Manager) writeSkillFiles(ctx context.Context, containerID string, skill
 	log.Debug("writing skills to container", "skill_ids", skillIDs)
 
 	// 先获取容器内用户 HOME 目录
-	homeResult, err := m.containerMgr.Exec(ctx, containerID, []string{"sh", "-c", "echo $HOME"})
+	homeResult, err := ctrs.Exec(ctx, containerID, []string{"sh", "-c", "echo $HOME"})
 	if err != nil {
 		log.Error("failed to get container HOME", "error", err)
 		return err
@@ -588,14 +742,14 @@ func (m *Manager) writeSkillFiles(ctx context.Context, containerID string, skill
 
 			// 创建目标目录
 			mkdirCmd := []string{"sh", "-c", fmt.Sprintf("mkdir -p %s/.codex/skills", containerHome)}
-			if _, err := m.containerMgr.Exec(ctx, containerID, mkdirCmd); err != nil {
+			if _, err := ctrs.Exec(ctx, containerID, mkdirCmd); err != nil {
 				log.Error("failed to create skills dir", "skill_id", skillID, "error", err)
 				continue
 			}
 
 			// 复制整个目录到容器
 			dstPath := fmt.Sprintf("%s/.codex/skills/", containerHome)
-			if err := m.containerMgr.CopyToContainer(ctx, containerID, s.SourceDir, dstPath); err != nil {
+			if err := ctrs.CopyToContainer(ctx, containerID, s.SourceDir, dstPath); err != nil {
 				log.Error("failed to copy skill directory", "skill_id", skillID, "source_dir", s.SourceDir, "error", err)
 				continue
 			}
@@ -603,7 +757,7 @@ func (m *Manager) writeSkillFiles(ctx context.Context, containerID string, skill
 
 			// 修复权限（确保容器用户可读写）
 			chownCmd := []string{"sh", "-c", fmt.Sprintf("chmod -R 755 %s", containerSkillDir)}
-			if _, err := m.containerMgr.Exec(ctx, containerID, chownCmd); err != nil {
+			if _, err := ctrs.Exec(ctx, containerID, chownCmd); err != nil {
 				log.Warn("failed to fix permissions", "skill_id", skillID, "error", err)
 			}
 		}
@@ -618,7 +772,7 @@ func (m *Manager) writeSkillFiles(ctx context.Context, containerID string, skill
 			fmt.Sprintf("mkdir -p %s && cat > %s << 'AGENTBOX_SKILL_EOF'\n%s\nAGENTBOX_SKILL_EOF", skillDir, skillPath, escapedContent),
 		}
 
-		result, err := m.containerMgr.Exec(ctx, containerID, writeCmd)
+		result, err := ctrs.Exec(ctx, containerID, writeCmd)
 		if err != nil {
 			log.Error("failed to write skill file", "skill_id", skillID, "error", err)
 			continue
@@ -637,7 +791,7 @@ func (m *Manager) writeSkillFiles(ctx context.Context, containerID string, skill
 					fmt.Sprintf("mkdir -p %s && cat > %s << 'AGENTBOX_SKILL_EOF'\n%s\nAGENTBOX_SKILL_EOF", fileDir, filePath, escapedFileContent),
 				}
 
-				if _, err := m.containerMgr.Exec(ctx, containerID, writeFileCmd); err != nil {
+				if _, err := ctrs.Exec(ctx, containerID, writeFileCmd); err != nil {
 					log.Warn("failed to write skill file", "skill_id", skillID, "file", file.Path, "error", err)
 				} else {
 					log.Debug("skill reference file written", "skill_id", skillID, "file", file.Path)
@@ -681,11 +835,15 @@ func (m *Manager) Delete(ctx context.Context, id string) error {
 	}
 
 	// 删除容器（忽略容器不存在的错误）
-	if session.ContainerID != "" {
-		_ = m.containerMgr.Stop(ctx, session.ContainerID)
-		_ = m.containerMgr.Remove(ctx, session.ContainerID)
+	if ctrs, err := m.containersFor(session); err == nil && session.ContainerID != "" {
+		_ = ctrs.Stop(ctx, session.ContainerID)
+		_ = ctrs.Remove(ctx, session.ContainerID)
 		// 忽略错误，容器可能已经被删除
 	}
+	m.release(session)
+	if m.llmProxy != nil {
+		m.llmProxy.Revoke(id)
+	}
 
 	// 删除会话记录
 	return m.store.Delete(id)
@@ -699,10 +857,15 @@ func (m *Manager) Stop(ctx context.Context, id string) error {
 	}
 
 	if session.ContainerID != "" {
-		if err := m.containerMgr.Stop(ctx, session.ContainerID); err != nil {
+		ctrs, err := m.containersFor(session)
+		if err != nil {
+			return err
+		}
+		if err := ctrs.Stop(ctx, session.ContainerID); err != nil {
 			return fmt.Errorf("failed to stop container: %w", err)
 		}
 	}
+	m.release(session)
 
 	session.Status = StatusStopped
 	return m.store.Update(session)
@@ -716,7 +879,11 @@ func (m *Manager) Start(ctx context.Context, id string) error {
 	}
 
 	if session.ContainerID != "" {
-		if err := m.containerMgr.Start(ctx, session.ContainerID); err != nil {
+		ctrs, err := m.containersFor(session)
+		if err != nil {
+			return err
+		}
+		if err := ctrs.Start(ctx, session.ContainerID); err != nil {
 			return fmt.Errorf("failed to start container: %w", err)
 		}
 	}
@@ -733,12 +900,16 @@ func (m *Manager) Reconnect(ctx context.Context, id string) (*Session, error) {
 	if err != nil {
 		return nil, fmt.Errorf("session not found: %s", id)
 	}
+	ctrs, err := m.containersFor(session)
+	if err != nil {
+		return nil, err
+	}
 
 	// 如果会话已在运行，直接返回
 	if session.Status == StatusRunning {
 		// 验证容器是否真的在运行
 		if session.ContainerID != "" {
-			ctr, err := m.containerMgr.Inspect(ctx, session.ContainerID)
+			ctr, err := ctrs.Inspect(ctx, session.ContainerID)
 			if err == nil && ctr.Status == container.StatusRunning {
 				return session, nil
 			}
@@ -748,14 +919,14 @@ func (m *Manager) Reconnect(ctx context.Context, id string) (*Session, error) {
 	// 尝试重新启动容器
 	if session.ContainerID != "" {
 		// 先检查容器状态
-		ctr, err := m.containerMgr.Inspect(ctx, session.ContainerID)
+		ctr, err := ctrs.Inspect(ctx, session.ContainerID)
 		if err != nil {
 			return nil, fmt.Errorf("failed to inspect container: %w", err)
 		}
 
 		// 如果容器已停止，重新启动
 		if ctr.Status != container.StatusRunning {
-			if err := m.containerMgr.Start(ctx, session.ContainerID); err != nil {
+			if err := ctrs.Start(ctx, session.ContainerID); err != nil {
 				return nil, fmt.Errorf("failed to restart container: %w", err)
 			}
 		}
@@ -783,7 +954,10 @@ func (m *Manager) Exec(ctx context.Context, id string, req *ExecRequest) (*ExecR
 	}
 
 	// 检查容器是否存在
-	_, err = m.containerMgr.Inspect(ctx, session.ContainerID)
+	ctrs, err := m.containersFor(session)
+	if err == nil {
+		_, err = ctrs.Inspect(ctx, session.ContainerID)
+	}
 	if err != nil {
 		// 容器不存在，更新 session 状态
 		session.Status = StatusError
@@ -813,10 +987,25 @@ func (m *Manager) Exec(ctx context.Context, id string, req *ExecRequest) (*ExecR
 	// 这样 PrepareExecWithConfig 才能使用完整的 Agent 配置（model、permissions 等）
 	if session.AgentID != "" && m.agentMgr != nil {
 		if fullConfig, err := m.agentMgr.GetFullConfig(session.AgentID); err == nil {
+			// 没有审批工具时引擎会跳过权限确认，不能以这种方式执行要求审批的 Agent
+			if fullConfig.Agent.ApprovalEnabled() && req.PermissionPromptTool == "" {
+				return nil, ErrApprovalRequired
+			}
 			execOpts.Config = buildEngineConfig(fullConfig)
 		}
 	}
 
+	// 注入调用方指定的 MCP 服务器、权限审批工具和模型
+	if execOpts.Config != nil {
+		execOpts.Config.MCPServers = append(execOpts.Config.MCPServers, req.MCPServers...)
+		if req.PermissionPromptTool != "" {
+			execOpts.Config.Permissions.PermissionPromptTool = req.PermissionPromptTool
+		}
+		if req.Model != "" {
+			execOpts.Config.Model.Name = req.Model
+		}
+	}
+
 	// 设置默认值
 	if execOpts.MaxTurns <= 0 {
 		execOpts.MaxTurns = 10
@@ -848,8 +1037,13 @@ func (m *Manager) Exec(ctx context.Context, id string, req *ExecRequest) (*ExecR
 		return m.execDirect(execCtx, directExec, execOpts, execution)
 	}
 
-	// 回退到 CLI 执行方式
-	return m.execViaCLI(execCtx, adapter, execOpts, session.ContainerID, execution)
+	// 回退到 CLI 执行方式（远程节点执行前后同步工作区）
+	if err := m.pushWorkspace(execCtx, ctrs, session); err != nil {
+		return nil, err
+	}
+	resp, err := m.execViaCLI(execCtx, ctrs, adapter, execOpts, session.ContainerID, execution)
+	m.pullWorkspace(ctx, ctrs, session)
+	return resp, err
 }
 
 // execDirect 使用 Go SDK 直接执行 (Codex)
@@ -915,7 +1109,7 @@ func (m *Manager) execDirect(ctx context.Context, executor engine.DirectExecutor
 }
 
 // execViaCLI 通过 CLI 在容器中执行 (Claude Code, OpenCode, Codex)
-func (m *Manager) execViaCLI(ctx context.Context, adapter engine.Adapter, opts *engine.ExecOptions, containerID string, execution *Execution) (*ExecResponse, error) {
+func (m *Manager) execViaCLI(ctx context.Context, ctrs container.Manager, adapter engine.Adapter, opts *engine.ExecOptions, containerID string, execution *Execution) (*ExecResponse, error) {
 	// 准备执行命令
 	// 如果有 AgentConfig，使用 PrepareExecWithConfig 获取完整配置
 	var cmd []string
@@ -928,7 +1122,7 @@ func (m *Manager) execViaCLI(ctx context.Context, adapter engine.Adapter, opts *
 	log.Debug("execViaCLI: running command", "cmd", strings.Join(cmd, " "), "thread_id", opts.ThreadID)
 
 	// 在容器中执行
-	result, err := m.containerMgr.Exec(ctx, containerID, cmd)
+	result, err := ctrs.Exec(ctx, containerID, cmd)
 	if err != nil {
 		execution.Status = ExecutionFailed
 		if ctx.Err() == context.DeadlineExceeded {
@@ -1140,7 +1334,10 @@ func (m *Manager) ExecStream(ctx context.Context, id string, req *ExecRequest) (
 	}
 
 	// 检查容器是否存在
-	_, err = m.containerMgr.Inspect(ctx, session.ContainerID)
+	ctrs, err := m.containersFor(session)
+	if err == nil {
+		_, err = ctrs.Inspect(ctx, session.ContainerID)
+	}
 	if err != nil {
 		session.Status = StatusError
 		_ = m.store.Update(session)
@@ -1157,6 +1354,12 @@ func (m *Manager) ExecStream(ctx context.Context, id string, req *ExecRequest) (
 	if session.Agent != "codex" {
 		return nil, "", fmt.Errorf("streaming exec only supported for codex agent, got: %s", session.Agent)
 	}
+	// 流式执行不注入审批工具
+	if session.AgentID != "" && m.agentMgr != nil {
+		if ag, err := m.agentMgr.Get(session.AgentID); err == nil && ag.ApprovalEnabled() {
+			return nil, "", ErrApprovalRequired
+		}
+	}
 
 	// 准备执行选项
 	execOpts := &engine.ExecOptions{
@@ -1191,7 +1394,11 @@ func (m *Manager) ExecStream(ctx context.Context, id string, req *ExecRequest) (
 	cmd := adapter.PrepareExec(execOpts)
 
 	// 启动流式执行
-	stream, err := m.containerMgr.ExecStream(ctx, session.ContainerID, cmd)
+	err = m.pushWorkspace(ctx, ctrs, session)
+	var stream *container.ExecStream
+	if err == nil {
+		stream, err = ctrs.ExecStream(ctx, session.ContainerID, cmd)
+	}
 	if err != nil {
 		execution.Status = ExecutionFailed
 		execution.Error = err.Error()
@@ -1205,13 +1412,16 @@ func (m *Manager) ExecStream(ctx context.Context, id string, req *ExecRequest) (
 	eventCh := make(chan *StreamEvent, 100)
 
 	// 启动 goroutine 读取输出并解析
-	go m.processExecStream(ctx, stream, execution, eventCh)
+	go m.processExecStream(ctx, stream, execution, eventCh, func() {
+		m.pullWorkspace(ctx, ctrs, session)
+	})
 
 	return eventCh, execID, nil
 }
 
 // processExecStream 处理流式执行输出
-func (m *Manager) processExecStream(ctx context.Context, stream *container.ExecStream, execution *Execution, eventCh chan<- *StreamEvent) {
+// 输出结束后先调用 finished（如同步远程工作区），再发送完成事件
+func (m *Manager) processExecStream(ctx context.Context, stream *container.ExecStream, execution *Execution, eventCh chan<- *StreamEvent, finished func()) {
 	defer close(eventCh)
 	defer stream.Reader.Close()
 
@@ -1306,6 +1516,8 @@ func (m *Manager) processExecStream(ctx context.Context, stream *container.ExecS
 		eventCh <- streamEvent
 	}
 
+	finished()
+
 	// 更新执行记录
 	now := time.Now()
 	execution.EndedAt = &now
@@ -1368,6 +1580,22 @@ func (m *Manager) GetWorkspace(sessionID string) (string, error) {
 	return session.Workspace, nil
 }
 
+// RunCommand 在会话容器的工作区（/workspace）中执行 shell 命令，用于结果评估等场景
+func (m *Manager) RunCommand(ctx context.Context, id string, command string) (*container.ExecResult, error) {
+	session, err := m.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != StatusRunning {
+		return nil, fmt.Errorf("session is not running: %s", session.Status)
+	}
+	ctrs, err := m.containersFor(session)
+	if err != nil {
+		return nil, err
+	}
+	return ctrs.Exec(ctx, session.ContainerID, []string{"sh", "-c", "cd /workspace && " + command})
+}
+
 // ANSI color codes
 const (
 	ansiReset       = "\x1b[0m"
@@ -1474,7 +1702,11 @@ func (m *Manager) StreamLogs(ctx context.Context, id string) (io.ReadCloser, err
 	}
 
 	// 获取容器日志流
-	return m.containerMgr.Logs(ctx, sess.ContainerID)
+	ctrs, err := m.containersFor(sess)
+	if err != nil {
+		return nil, err
+	}
+	return ctrs.Logs(ctx, sess.ContainerID)
 }
 
 // inferProviderFromBaseURL 从 BaseURL 推断 Provider 名称
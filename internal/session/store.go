@@ -80,6 +80,9 @@ func (s *MemoryStore) List(filter *ListFilter) ([]*Session, error) {
 			if filter.Status != "" && session.Status != filter.Status {
 				continue
 			}
+			if filter.NodeID != "" && session.NodeID != filter.NodeID {
+				continue
+			}
 		}
 		result = append(result, session)
 	}
@@ -114,6 +117,9 @@ func (s *MemoryStore) Count(filter *ListFilter) (int, error) {
 			if filter.Status != "" && session.Status != filter.Status {
 				continue
 			}
+			if filter.NodeID != "" && session.NodeID != filter.NodeID {
+				continue
+			}
 		}
 		count++
 	}
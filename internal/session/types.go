@@ -3,6 +3,8 @@ package session
 import (
 	"encoding/json"
 	"time"
+
+	"github.com/tmalldedede/agentbox/internal/engine"
 )
 
 // Session 会话
@@ -13,6 +15,7 @@ type Session struct {
 	Status      Status            `json:"status"`
 	Workspace   string            `json:"workspace"`
 	ContainerID string            `json:"container_id,omitempty"`
+	NodeID      string            `json:"node_id,omitempty"` // 运行会话的远程 Worker 节点，为空表示本机
 	Config      Config            `json:"config"`
 	Env         map[string]string `json:"env,omitempty"`
 	CreatedAt   time.Time         `json:"created_at"`
@@ -42,6 +45,12 @@ type CreateRequest struct {
 	Workspace string            `json:"workspace" binding:"required"`
 	Env       map[string]string `json:"env,omitempty"`
 	Config    *Config           `json:"config,omitempty"`
+
+	// LLM 代理（启用时）：ProviderID 覆盖真实 Key 所属的 Provider（Fallback / 实验变体通过 Env 传入其他 Provider 的配置），
+	// 同一 BudgetKey 的会话共享 TokenBudget（如同一任务的多次尝试），为空时按会话计
+	ProviderID  string `json:"provider_id,omitempty"`
+	BudgetKey   string `json:"-"`
+	TokenBudget int64  `json:"token_budget,omitempty"` // 输入 + 输出 Token 上限，0 表示不限
 }
 
 // Execution 执行记录
@@ -76,6 +85,11 @@ type ExecRequest struct {
 	DisallowedTools []string `json:"disallowed_tools,omitempty"` // 禁用的工具列表
 	IncludeEvents   bool     `json:"include_events,omitempty"`   // 是否返回完整事件列表
 	ThreadID        string   `json:"thread_id,omitempty"`        // 多轮对话 Thread ID (resume)
+
+	// 以下字段仅供内部调用方（如任务审批）使用，不对外暴露
+	MCPServers           []engine.MCPServerConfig `json:"-"` // 额外注入的 MCP 服务器
+	PermissionPromptTool string                   `json:"-"` // 权限审批 MCP 工具名
+	Model                string                   `json:"-"` // 覆盖 Agent 配置的模型
 }
 
 // ExecResponse 执行响应
@@ -116,6 +130,7 @@ type StreamEvent struct {
 type ListFilter struct {
 	Agent  string `form:"agent"`
 	Status Status `form:"status"`
+	NodeID string `form:"node_id"`
 	Limit  int    `form:"limit"`
 	Offset int    `form:"offset"`
 }
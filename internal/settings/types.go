@@ -27,6 +27,12 @@ type TaskSettings struct {
 	MaxTurns           int `json:"max_turns"`             // 最大对话轮次
 	MaxAttachments     int `json:"max_attachments"`       // 最大附件数
 	MaxAttachmentSize  int `json:"max_attachment_size"`   // 单个附件最大大小（MB）
+
+	// 调度（优先级通道 high → normal → low，同通道内按用户加权轮询）
+	MaxConcurrent         int            `json:"max_concurrent"`           // 最大并发任务数（0 使用启动配置）
+	MaxConcurrentPerUser  int            `json:"max_concurrent_per_user"`  // 单用户最大并发（0 不限）
+	MaxConcurrentPerAgent int            `json:"max_concurrent_per_agent"` // 单 Agent 最大并发（0 不限）
+	UserWeights           map[string]int `json:"user_weights,omitempty"`   // 用户权重 user_id → weight（默认 1）
 }
 
 // BatchSettings Batch 配置
@@ -37,11 +43,14 @@ type BatchSettings struct {
 	MaxRetries        int `json:"max_retries"`         // 最大重试次数
 	RetryDelay        int `json:"retry_delay"`         // 重试延迟（秒）
 	DeadLetterEnabled bool `json:"dead_letter_enabled"` // 是否启用 Dead Letter Queue
+
+	// 跨 Batch 调度：所有运行中 Batch 共享的 Worker 总数，按优先级分配（0 不限）
+	WorkerBudget int `json:"worker_budget"`
 }
 
 // StorageSettings 存储配置
 type StorageSettings struct {
-	HistoryRetentionDays int  `json:"history_retention_days"` // 历史记录保留天数
+	HistoryRetentionDays int  `json:"history_retention_days"` // 历史记录保留天数（任务事件日志同样适用）
 	SessionRetentionDays int  `json:"session_retention_days"` // Session 保留天数
 	AutoCleanup          bool `json:"auto_cleanup"`           // 是否自动清理
 }
@@ -78,6 +87,9 @@ func Default() *Settings {
 			MaxTurns:            100,
 			MaxAttachments:      10,
 			MaxAttachmentSize:   100,   // 100MB
+			MaxConcurrent:         0,   // 0 使用启动配置
+			MaxConcurrentPerUser:  0,
+			MaxConcurrentPerAgent: 0,
 		},
 		Batch: BatchSettings{
 			DefaultWorkers:       5,
@@ -0,0 +1,401 @@
+package task
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tmalldedede/agentbox/internal/agent"
+	"github.com/tmalldedede/agentbox/internal/apperr"
+	"github.com/tmalldedede/agentbox/internal/engine"
+	"github.com/tmalldedede/agentbox/internal/session"
+)
+
+// 工具审批相关错误
+var (
+	ErrApprovalNotFound      = apperr.NotFound("approval")
+	ErrApprovalDecided       = apperr.Conflict("approval has already been decided")
+	ErrApprovalTokenInvalid  = apperr.Unauthorized("invalid or expired approval token")
+	ErrApprovalNotConfigured = apperr.Internal("agent requires tool approval but approval is not configured")
+)
+
+const (
+	// ApprovalMCPServerName 注入到 Agent 的审批 MCP 服务器名
+	ApprovalMCPServerName = "agentbox"
+	// ApprovalPromptTool Claude Code --permission-prompt-tool 使用的工具全名
+	ApprovalPromptTool = "mcp__" + ApprovalMCPServerName + "__approval_prompt"
+	// ApprovalMCPPath 审批 MCP 端点路径前缀（后接一次性 token）
+	ApprovalMCPPath = "/api/v1/approvals/mcp/"
+
+	// approvalPollInterval 等待审批时轮询存储的间隔（决定可能由其他实例写入）
+	approvalPollInterval = time.Second
+)
+
+// ApprovalStatus 审批状态
+type ApprovalStatus string
+
+const (
+	ApprovalPending   ApprovalStatus = "pending"   // 等待用户决定
+	ApprovalApproved  ApprovalStatus = "approved"  // 允许执行
+	ApprovalDenied    ApprovalStatus = "denied"    // 拒绝执行
+	ApprovalCancelled ApprovalStatus = "cancelled" // 任务取消或执行中断
+)
+
+// 审批决定人（非用户决定时）
+const (
+	ApprovalDecidedByAuto    = "auto"    // 命中 auto_approve 列表
+	ApprovalDecidedByTimeout = "timeout" // 超时后按 default_action 决定
+)
+
+// Approval 工具调用审批请求
+type Approval struct {
+	ID        string                 `json:"id"`
+	TaskID    string                 `json:"task_id"`
+	UserID    string                 `json:"user_id,omitempty"`
+	ToolName  string                 `json:"tool_name"`
+	Input     map[string]interface{} `json:"input,omitempty"`
+	Status    ApprovalStatus         `json:"status"`
+	Reason    string                 `json:"reason,omitempty"`
+	DecidedBy string                 `json:"decided_by,omitempty"`
+	ExpiresAt time.Time              `json:"expires_at"`
+	CreatedAt time.Time              `json:"created_at"`
+	DecidedAt *time.Time             `json:"decided_at,omitempty"`
+}
+
+// Allowed 是否允许执行工具调用
+func (a *Approval) Allowed() bool {
+	return a.Status == ApprovalApproved
+}
+
+// ApprovalFilter 审批列表过滤器
+type ApprovalFilter struct {
+	TaskID string
+	UserID string
+	Status []ApprovalStatus
+	Limit  int
+}
+
+// ApprovalStore 工具审批存储接口
+type ApprovalStore interface {
+	// Create 创建审批请求
+	Create(approval *Approval) error
+	// Get 获取审批请求
+	Get(id string) (*Approval, error)
+	// List 按创建时间升序列出审批请求
+	List(filter *ApprovalFilter) ([]*Approval, error)
+	// Decide 条件更新审批结果（仅 pending 状态可决定），返回是否更新成功
+	Decide(id string, status ApprovalStatus, reason, decidedBy string) (bool, error)
+	// CancelPending 将任务所有待审批请求标记为已取消
+	CancelPending(taskID, reason string) (int64, error)
+	// DeleteByTask 删除任务的全部审批记录
+	DeleteByTask(taskID string) error
+}
+
+// approvalSession 一次执行期间有效的审批会话（token → 任务及审批策略）
+type approvalSession struct {
+	taskID string
+	policy agent.ApprovalConfig
+}
+
+// approvalBroker 本实例上的审批会话和等待者
+type approvalBroker struct {
+	mu       sync.Mutex
+	sessions map[string]*approvalSession // token → session
+	waiters  map[string]chan struct{}    // approvalID → 决定通知
+	waiting  map[string]int              // taskID → 等待中的审批数
+}
+
+func newApprovalBroker() *approvalBroker {
+	return &approvalBroker{
+		sessions: make(map[string]*approvalSession),
+		waiters:  make(map[string]chan struct{}),
+		waiting:  make(map[string]int),
+	}
+}
+
+// notify 唤醒等待该审批的请求（不阻塞）
+func (b *approvalBroker) notify(approvalID string) {
+	b.mu.Lock()
+	ch := b.waiters[approvalID]
+	b.mu.Unlock()
+	if ch != nil {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// SetApprovalStore 设置工具审批存储（未设置时启用审批的 Agent 无法执行）
+func (m *Manager) SetApprovalStore(store ApprovalStore) {
+	m.approvalStore = store
+}
+
+// SetApprovalEndpoint 设置容器内访问 AgentBox 的基础地址（审批 MCP 端点挂在其下）
+func (m *Manager) SetApprovalEndpoint(baseURL string) {
+	m.approvalEndpoint = strings.TrimRight(baseURL, "/")
+}
+
+// checkApproval Agent 要求审批但本实例未配置审批存储或端点时返回错误（不允许绕过审批执行）
+func (m *Manager) checkApproval(ag *agent.Agent) error {
+	if ag != nil && ag.ApprovalEnabled() && (m.approvalStore == nil || m.approvalEndpoint == "") {
+		return ErrApprovalNotConfigured
+	}
+	return nil
+}
+
+// prepareApproval 为启用审批的 Agent 注入审批 MCP 服务器和权限审批工具，
+// 返回的 release 需在本次执行结束后调用以注销审批会话；审批未配置时返回错误
+func (m *Manager) prepareApproval(task *Task, ag *agent.Agent, req *session.ExecRequest) (release func(), err error) {
+	if err := m.checkApproval(ag); err != nil {
+		return nil, err
+	}
+	if ag == nil || !ag.ApprovalEnabled() {
+		return func() {}, nil
+	}
+
+	token := uuid.New().String()
+	m.approvals.mu.Lock()
+	m.approvals.sessions[token] = &approvalSession{taskID: task.ID, policy: *ag.Approval}
+	m.approvals.mu.Unlock()
+
+	req.MCPServers = append(req.MCPServers, engine.MCPServerConfig{
+		Name: ApprovalMCPServerName,
+		URL:  m.approvalEndpoint + ApprovalMCPPath + token,
+	})
+	req.PermissionPromptTool = ApprovalPromptTool
+
+	return func() {
+		m.approvals.mu.Lock()
+		delete(m.approvals.sessions, token)
+		m.approvals.mu.Unlock()
+	}, nil
+}
+
+// RequestApproval 处理 Agent 的权限请求：暂停任务等待用户决定，
+// 超时后按 Agent 的 default_action 决定。阻塞直到有结果或 ctx 结束。
+func (m *Manager) RequestApproval(ctx context.Context, token, toolName string, input map[string]interface{}) (*Approval, error) {
+	m.approvals.mu.Lock()
+	sess := m.approvals.sessions[token]
+	m.approvals.mu.Unlock()
+	if sess == nil || m.approvalStore == nil {
+		return nil, ErrApprovalTokenInvalid
+	}
+
+	task, err := m.store.Get(sess.taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	approval := &Approval{
+		ID:        "apv-" + uuid.New().String()[:8],
+		TaskID:    task.ID,
+		UserID:    task.UserID,
+		ToolName:  toolName,
+		Input:     input,
+		Status:    ApprovalPending,
+		CreatedAt: now,
+	}
+
+	if matchesToolPattern(sess.policy.AutoApprove, toolName) {
+		approval.Status = ApprovalApproved
+		approval.DecidedBy = ApprovalDecidedByAuto
+		approval.DecidedAt = &now
+		return approval, nil
+	}
+
+	timeout := sess.policy.Timeout
+	if timeout <= 0 {
+		timeout = agent.DefaultApprovalTimeout
+	}
+	approval.ExpiresAt = now.Add(time.Duration(timeout) * time.Second)
+
+	if err := m.approvalStore.Create(approval); err != nil {
+		return nil, err
+	}
+
+	wake := make(chan struct{}, 1)
+	m.approvals.mu.Lock()
+	m.approvals.waiters[approval.ID] = wake
+	m.approvals.waiting[task.ID]++
+	m.approvals.mu.Unlock()
+
+	if _, err := m.store.UpdateStatus(task.ID, StatusRunning, StatusWaitingApproval); err != nil {
+		log.Error("failed to mark task waiting for approval", "task_id", task.ID, "error", err)
+	}
+	log.Info("task waiting for tool approval", "task_id", task.ID, "approval_id", approval.ID, "tool", toolName)
+	m.broadcastEvent(task.ID, &TaskEvent{Type: "task.waiting_approval", Data: map[string]interface{}{
+		"approval_id": approval.ID,
+		"tool_name":   toolName,
+		"input":       input,
+		"expires_at":  approval.ExpiresAt,
+	}})
+
+	decided := m.awaitApproval(ctx, approval, wake, sess.policy.DefaultAction)
+
+	m.approvals.mu.Lock()
+	delete(m.approvals.waiters, approval.ID)
+	m.approvals.waiting[task.ID]--
+	remaining := m.approvals.waiting[task.ID]
+	if remaining <= 0 {
+		delete(m.approvals.waiting, task.ID)
+	}
+	m.approvals.mu.Unlock()
+
+	// 最后一个待审批请求结束后恢复运行（任务已取消时条件更新不生效）
+	if remaining <= 0 {
+		if _, err := m.store.UpdateStatus(task.ID, StatusWaitingApproval, StatusRunning); err != nil {
+			log.Error("failed to resume task after approval", "task_id", task.ID, "error", err)
+		}
+	}
+	m.broadcastEvent(task.ID, &TaskEvent{Type: "task.approval_resolved", Data: map[string]interface{}{
+		"approval_id": decided.ID,
+		"tool_name":   toolName,
+		"status":      decided.Status,
+		"reason":      decided.Reason,
+		"decided_by":  decided.DecidedBy,
+	}})
+
+	return decided, nil
+}
+
+// awaitApproval 等待审批结果：本实例的决定会立即唤醒，其他实例的决定通过轮询发现
+func (m *Manager) awaitApproval(ctx context.Context, approval *Approval, wake <-chan struct{}, defaultAction string) *Approval {
+	timer := time.NewTimer(time.Until(approval.ExpiresAt))
+	defer timer.Stop()
+	ticker := time.NewTicker(approvalPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-wake:
+		case <-ticker.C:
+		case <-timer.C:
+			status := ApprovalDenied
+			if defaultAction == agent.ApprovalActionAllow {
+				status = ApprovalApproved
+			}
+			m.decideApproval(approval.ID, status, "approval timed out", ApprovalDecidedByTimeout)
+		case <-ctx.Done():
+			m.decideApproval(approval.ID, ApprovalCancelled, "execution interrupted", "")
+		}
+
+		current, err := m.approvalStore.Get(approval.ID)
+		if err != nil {
+			log.Warn("failed to reload approval", "approval_id", approval.ID, "error", err)
+			if ctx.Err() != nil {
+				approval.Status = ApprovalCancelled
+				return approval
+			}
+			continue
+		}
+		if current.Status != ApprovalPending {
+			return current
+		}
+	}
+}
+
+// decideApproval 写入审批结果（已决定的审批保持不变）
+func (m *Manager) decideApproval(id string, status ApprovalStatus, reason, decidedBy string) bool {
+	ok, err := m.approvalStore.Decide(id, status, reason, decidedBy)
+	if err != nil {
+		log.Error("failed to decide approval", "approval_id", id, "error", err)
+		return false
+	}
+	return ok
+}
+
+// DecideApproval 用户批准或拒绝工具调用
+func (m *Manager) DecideApproval(id string, approve bool, reason, decidedBy string) (*Approval, error) {
+	if m.approvalStore == nil {
+		return nil, ErrApprovalNotFound
+	}
+
+	status := ApprovalDenied
+	if approve {
+		status = ApprovalApproved
+	}
+	ok, err := m.approvalStore.Decide(id, status, reason, decidedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	approval, err := m.approvalStore.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return approval, ErrApprovalDecided
+	}
+
+	m.approvals.notify(id)
+	log.Info("tool approval decided", "task_id", approval.TaskID, "approval_id", id, "status", status, "decided_by", decidedBy)
+	return approval, nil
+}
+
+// GetApproval 获取审批请求
+func (m *Manager) GetApproval(id string) (*Approval, error) {
+	if m.approvalStore == nil {
+		return nil, ErrApprovalNotFound
+	}
+	return m.approvalStore.Get(id)
+}
+
+// ListApprovals 列出审批请求
+func (m *Manager) ListApprovals(filter *ApprovalFilter) ([]*Approval, error) {
+	if m.approvalStore == nil {
+		return []*Approval{}, nil
+	}
+	return m.approvalStore.List(filter)
+}
+
+// PendingApproval 返回任务最早的待审批请求（没有时返回 ErrApprovalNotFound）
+func (m *Manager) PendingApproval(taskID string) (*Approval, error) {
+	approvals, err := m.ListApprovals(&ApprovalFilter{
+		TaskID: taskID,
+		Status: []ApprovalStatus{ApprovalPending},
+		Limit:  1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(approvals) == 0 {
+		return nil, ErrApprovalNotFound
+	}
+	return approvals[0], nil
+}
+
+// cancelApprovals 取消任务所有待审批请求并唤醒等待者
+func (m *Manager) cancelApprovals(taskID, reason string) {
+	if m.approvalStore == nil {
+		return
+	}
+	if _, err := m.approvalStore.CancelPending(taskID, reason); err != nil {
+		log.Error("failed to cancel pending approvals", "task_id", taskID, "error", err)
+		return
+	}
+
+	approvals, err := m.approvalStore.List(&ApprovalFilter{TaskID: taskID, Status: []ApprovalStatus{ApprovalCancelled}})
+	if err != nil {
+		return
+	}
+	for _, approval := range approvals {
+		m.approvals.notify(approval.ID)
+	}
+}
+
+// matchesToolPattern 工具名是否匹配列表（支持 "mcp__github__*" 形式的前缀通配）
+func matchesToolPattern(patterns []string, toolName string) bool {
+	for _, p := range patterns {
+		if p == toolName {
+			return true
+		}
+		if strings.HasSuffix(p, "*") && strings.HasPrefix(toolName, strings.TrimSuffix(p, "*")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/tmalldedede/agentbox/internal/database"
+	"gorm.io/gorm"
+)
+
+// GormApprovalStore 工具审批 GORM 存储实现
+type GormApprovalStore struct {
+	db *gorm.DB
+}
+
+// NewGormApprovalStore 创建工具审批存储
+func NewGormApprovalStore(db *gorm.DB) (*GormApprovalStore, error) {
+	if err := db.AutoMigrate(&database.TaskApprovalModel{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate task approval table: %w", err)
+	}
+	return &GormApprovalStore{db: db}, nil
+}
+
+// Create 创建审批请求
+func (s *GormApprovalStore) Create(approval *Approval) error {
+	model, err := approvalToModel(approval)
+	if err != nil {
+		return err
+	}
+	return s.db.Create(model).Error
+}
+
+// Get 获取审批请求
+func (s *GormApprovalStore) Get(id string) (*Approval, error) {
+	var model database.TaskApprovalModel
+	if err := s.db.First(&model, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrApprovalNotFound
+		}
+		return nil, err
+	}
+	return modelToApproval(&model), nil
+}
+
+// List 按创建时间升序列出审批请求
+func (s *GormApprovalStore) List(filter *ApprovalFilter) ([]*Approval, error) {
+	query := s.db.Model(&database.TaskApprovalModel{})
+	if filter != nil {
+		if filter.TaskID != "" {
+			query = query.Where("task_id = ?", filter.TaskID)
+		}
+		if filter.UserID != "" {
+			query = query.Where("user_id = ?", filter.UserID)
+		}
+		if len(filter.Status) > 0 {
+			statuses := make([]string, len(filter.Status))
+			for i, st := range filter.Status {
+				statuses[i] = string(st)
+			}
+			query = query.Where("status IN ?", statuses)
+		}
+		if filter.Limit > 0 {
+			query = query.Limit(filter.Limit)
+		}
+	}
+
+	var models []database.TaskApprovalModel
+	if err := query.Order("created_at ASC").Find(&models).Error; err != nil {
+		return nil, err
+	}
+
+	approvals := make([]*Approval, len(models))
+	for i := range models {
+		approvals[i] = modelToApproval(&models[i])
+	}
+	return approvals, nil
+}
+
+// Decide 条件更新审批结果（仅 pending 状态可决定），返回是否更新成功
+func (s *GormApprovalStore) Decide(id string, status ApprovalStatus, reason, decidedBy string) (bool, error) {
+	result := s.db.Model(&database.TaskApprovalModel{}).
+		Where("id = ? AND status = ?", id, string(ApprovalPending)).
+		Updates(map[string]interface{}{
+			"status":     string(status),
+			"reason":     reason,
+			"decided_by": decidedBy,
+			"decided_at": time.Now(),
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// CancelPending 将任务所有待审批请求标记为已取消，返回更新条数
+func (s *GormApprovalStore) CancelPending(taskID, reason string) (int64, error) {
+	result := s.db.Model(&database.TaskApprovalModel{}).
+		Where("task_id = ? AND status = ?", taskID, string(ApprovalPending)).
+		Updates(map[string]interface{}{
+			"status":     string(ApprovalCancelled),
+			"reason":     reason,
+			"decided_at": time.Now(),
+		})
+	return result.RowsAffected, result.Error
+}
+
+// DeleteByTask 删除任务的全部审批记录
+func (s *GormApprovalStore) DeleteByTask(taskID string) error {
+	return s.db.Where("task_id = ?", taskID).Delete(&database.TaskApprovalModel{}).Error
+}
+
+func approvalToModel(approval *Approval) (*database.TaskApprovalModel, error) {
+	input, err := json.Marshal(approval.Input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal approval input: %w", err)
+	}
+	return &database.TaskApprovalModel{
+		ID:        approval.ID,
+		TaskID:    approval.TaskID,
+		UserID:    approval.UserID,
+		ToolName:  approval.ToolName,
+		InputJSON: string(input),
+		Status:    string(approval.Status),
+		Reason:    approval.Reason,
+		DecidedBy: approval.DecidedBy,
+		ExpiresAt: approval.ExpiresAt,
+		CreatedAt: approval.CreatedAt,
+		DecidedAt: approval.DecidedAt,
+	}, nil
+}
+
+func modelToApproval(model *database.TaskApprovalModel) *Approval {
+	approval := &Approval{
+		ID:        model.ID,
+		TaskID:    model.TaskID,
+		UserID:    model.UserID,
+		ToolName:  model.ToolName,
+		Status:    ApprovalStatus(model.Status),
+		Reason:    model.Reason,
+		DecidedBy: model.DecidedBy,
+		ExpiresAt: model.ExpiresAt,
+		CreatedAt: model.CreatedAt,
+		DecidedAt: model.DecidedAt,
+	}
+	if model.InputJSON != "" && model.InputJSON != "null" {
+		json.Unmarshal([]byte(model.InputJSON), &approval.Input)
+	}
+	return approval
+}
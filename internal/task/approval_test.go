@@ -0,0 +1,195 @@
+package task
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmalldedede/agentbox/internal/agent"
+	"github.com/tmalldedede/agentbox/internal/session"
+)
+
+func newApprovalManager(t *testing.T) *Manager {
+	t.Helper()
+	db := setupTestDB(t)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1) // 内存库：所有 goroutine 共享同一连接
+
+	store, err := NewGormStore(db)
+	require.NoError(t, err)
+	approvalStore, err := NewGormApprovalStore(db)
+	require.NoError(t, err)
+
+	m := NewManager(store, nil, nil, nil)
+	m.SetApprovalStore(approvalStore)
+	m.SetApprovalEndpoint("http://host.docker.internal:18080/")
+	return m
+}
+
+// startApprovalSession 创建运行中的任务并注册审批会话，返回 token
+func startApprovalSession(t *testing.T, m *Manager, policy *agent.ApprovalConfig) (string, *Task) {
+	t.Helper()
+	task := &Task{ID: "task-1", UserID: "alice", AgentID: "agent-1", Prompt: "p", Status: StatusRunning, CreatedAt: time.Now()}
+	require.NoError(t, m.store.Create(task))
+
+	req := &session.ExecRequest{Prompt: "p"}
+	release, err := m.prepareApproval(task, &agent.Agent{ID: "agent-1", Approval: policy}, req)
+	require.NoError(t, err)
+	t.Cleanup(release)
+
+	require.Len(t, req.MCPServers, 1)
+	assert.Equal(t, ApprovalMCPServerName, req.MCPServers[0].Name)
+	assert.Equal(t, ApprovalPromptTool, req.PermissionPromptTool)
+
+	url := req.MCPServers[0].URL
+	prefix := "http://host.docker.internal:18080" + ApprovalMCPPath
+	require.Contains(t, url, prefix)
+	return url[len(prefix):], task
+}
+
+func waitTaskStatus(t *testing.T, m *Manager, taskID string, status Status) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		task, err := m.store.Get(taskID)
+		return err == nil && task.Status == status
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestPrepareApproval_DisabledAgent(t *testing.T) {
+	m := newApprovalManager(t)
+	req := &session.ExecRequest{Prompt: "p"}
+	release, err := m.prepareApproval(&Task{ID: "task-1"}, &agent.Agent{ID: "agent-1"}, req)
+	require.NoError(t, err)
+	release()
+
+	assert.Empty(t, req.MCPServers)
+	assert.Empty(t, req.PermissionPromptTool)
+}
+
+func TestPrepareApproval_NotConfigured(t *testing.T) {
+	m := NewManager(nil, nil, nil, nil)
+	ag := &agent.Agent{ID: "agent-1", Approval: &agent.ApprovalConfig{Enabled: true}}
+	req := &session.ExecRequest{Prompt: "p"}
+
+	// 审批未配置：拒绝执行，而不是不经审批运行
+	_, err := m.prepareApproval(&Task{ID: "task-1"}, ag, req)
+	assert.ErrorIs(t, err, ErrApprovalNotConfigured)
+	assert.Empty(t, req.PermissionPromptTool)
+	assert.ErrorIs(t, m.checkApproval(ag), ErrApprovalNotConfigured)
+
+	m.SetApprovalStore(&GormApprovalStore{})
+	assert.ErrorIs(t, m.checkApproval(ag), ErrApprovalNotConfigured)
+	m.SetApprovalEndpoint("http://agentbox:18080")
+	assert.NoError(t, m.checkApproval(ag))
+	assert.NoError(t, m.checkApproval(&agent.Agent{ID: "agent-2"}))
+}
+
+func TestRequestApproval_UserDecision(t *testing.T) {
+	m := newApprovalManager(t)
+	token, task := startApprovalSession(t, m, &agent.ApprovalConfig{Enabled: true})
+	events := m.SubscribeEvents(task.ID)
+
+	done := make(chan *Approval, 1)
+	go func() {
+		approval, err := m.RequestApproval(context.Background(), token, "Bash", map[string]interface{}{"command": "rm -rf build"})
+		assert.NoError(t, err)
+		done <- approval
+	}()
+
+	waitTaskStatus(t, m, task.ID, StatusWaitingApproval)
+	pending, err := m.PendingApproval(task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Bash", pending.ToolName)
+	assert.Equal(t, "alice", pending.UserID)
+	assert.Equal(t, "rm -rf build", pending.Input["command"])
+
+	decided, err := m.DecideApproval(pending.ID, true, "looks fine", "alice")
+	require.NoError(t, err)
+	assert.Equal(t, ApprovalApproved, decided.Status)
+
+	select {
+	case approval := <-done:
+		assert.True(t, approval.Allowed())
+		assert.Equal(t, "alice", approval.DecidedBy)
+	case <-time.After(5 * time.Second):
+		t.Fatal("approval request did not return")
+	}
+	waitTaskStatus(t, m, task.ID, StatusRunning)
+
+	// 已决定的审批不能再次决定
+	_, err = m.DecideApproval(pending.ID, false, "", "alice")
+	assert.ErrorIs(t, err, ErrApprovalDecided)
+
+	assert.Equal(t, "task.waiting_approval", (<-events).Type)
+	assert.Equal(t, "task.approval_resolved", (<-events).Type)
+}
+
+func TestRequestApproval_TimeoutDefaultAction(t *testing.T) {
+	for _, tc := range []struct {
+		defaultAction string
+		allowed       bool
+	}{
+		{"", false},
+		{agent.ApprovalActionAllow, true},
+	} {
+		m := newApprovalManager(t)
+		token, _ := startApprovalSession(t, m, &agent.ApprovalConfig{Enabled: true, Timeout: 1, DefaultAction: tc.defaultAction})
+
+		approval, err := m.RequestApproval(context.Background(), token, "Write", nil)
+		require.NoError(t, err)
+		assert.Equal(t, tc.allowed, approval.Allowed(), "default_action=%q", tc.defaultAction)
+		assert.Equal(t, ApprovalDecidedByTimeout, approval.DecidedBy)
+	}
+}
+
+func TestRequestApproval_AutoApprove(t *testing.T) {
+	m := newApprovalManager(t)
+	token, task := startApprovalSession(t, m, &agent.ApprovalConfig{Enabled: true, AutoApprove: []string{"Read", "mcp__github__*"}})
+
+	for _, tool := range []string{"Read", "mcp__github__list_issues"} {
+		approval, err := m.RequestApproval(context.Background(), token, tool, nil)
+		require.NoError(t, err)
+		assert.True(t, approval.Allowed(), tool)
+		assert.Equal(t, ApprovalDecidedByAuto, approval.DecidedBy)
+	}
+
+	approvals, err := m.ListApprovals(&ApprovalFilter{TaskID: task.ID})
+	require.NoError(t, err)
+	assert.Empty(t, approvals)
+}
+
+func TestRequestApproval_CancelledWithTask(t *testing.T) {
+	m := newApprovalManager(t)
+	token, task := startApprovalSession(t, m, &agent.ApprovalConfig{Enabled: true})
+
+	done := make(chan *Approval, 1)
+	go func() {
+		approval, _ := m.RequestApproval(context.Background(), token, "Bash", nil)
+		done <- approval
+	}()
+
+	waitTaskStatus(t, m, task.ID, StatusWaitingApproval)
+	require.NoError(t, m.CancelTask(task.ID))
+
+	select {
+	case approval := <-done:
+		assert.Equal(t, ApprovalCancelled, approval.Status)
+		assert.False(t, approval.Allowed())
+	case <-time.After(5 * time.Second):
+		t.Fatal("approval request did not return")
+	}
+
+	// 取消后不会恢复为 running
+	got, err := m.store.Get(task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusCancelled, got.Status)
+}
+
+func TestRequestApproval_InvalidToken(t *testing.T) {
+	m := newApprovalManager(t)
+	_, err := m.RequestApproval(context.Background(), "unknown", "Bash", nil)
+	assert.ErrorIs(t, err, ErrApprovalTokenInvalid)
+}
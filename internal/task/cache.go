@@ -0,0 +1,97 @@
+package task
+
+import (
+	"github.com/tmalldedede/agentbox/internal/resultcache"
+)
+
+// SetResultCache 设置结果缓存（任务请求 cache 开启时使用，未设置时始终执行）
+func (m *Manager) SetResultCache(c *resultcache.Cache) {
+	m.resultCache = c
+}
+
+// resultCacheKey 计算任务首轮的缓存键（Agent 配置、提示词与附件内容），不使用缓存或无法计算时返回空
+func (m *Manager) resultCacheKey(task *Task) string {
+	if m.resultCache == nil || task.Cache == nil {
+		return ""
+	}
+	cfg, err := m.agentMgr.GetFullConfig(task.AgentID)
+	if err != nil {
+		log.Warn("result cache skipped", "task_id", task.ID, "error", err)
+		return ""
+	}
+	var files []string
+	if len(task.Attachments) > 0 {
+		if m.filePathResolver == nil {
+			return ""
+		}
+		for _, fileID := range task.Attachments {
+			path, _, err := m.filePathResolver(fileID)
+			if err != nil {
+				log.Warn("result cache skipped", "task_id", task.ID, "file_id", fileID, "error", err)
+				return ""
+			}
+			files = append(files, path)
+		}
+	}
+	key, err := resultcache.Key(&resultcache.KeyInput{Config: cfg, Prompt: task.Prompt, Files: files})
+	if err != nil {
+		log.Warn("result cache skipped", "task_id", task.ID, "error", err)
+		return ""
+	}
+	return key
+}
+
+// useCachedResult 查找缓存并在命中时写入首轮结果（不创建 Session、不产生 Token 使用）
+func (m *Manager) useCachedResult(task *Task) bool {
+	task.cacheKey = m.resultCacheKey(task)
+	if task.cacheKey == "" {
+		return false
+	}
+	entry, err := m.resultCache.Get(task.cacheKey)
+	if err != nil {
+		log.Warn("failed to read result cache", "task_id", task.ID, "error", err)
+		return false
+	}
+	if entry == nil {
+		return false
+	}
+
+	result := &Result{Summary: "Task completed (cached)", Text: entry.Result}
+	if len(task.Turns) > 0 {
+		task.Turns[0].Result = result
+	}
+	task.Result = result
+	task.CacheHit = true
+	task.cacheKey = ""
+
+	m.broadcastEvent(task.ID, &TaskEvent{Type: "agent.message", Data: map[string]interface{}{
+		"text":      result.Text,
+		"cache_hit": true,
+	}})
+	log.Info("task served from result cache", "task_id", task.ID, "source", entry.Source, "hits", entry.Hits)
+	return true
+}
+
+// storeCachedResult 将首轮执行成功的结果写入缓存（未通过评估的结果不缓存）
+func (m *Manager) storeCachedResult(task *Task) {
+	key := task.cacheKey
+	task.cacheKey = ""
+	if key == "" || task.Result == nil || (task.Evaluation != nil && !task.Evaluation.Passed) {
+		return
+	}
+	entry := &resultcache.Entry{
+		Key:     key,
+		AgentID: task.AgentID,
+		Result:  task.Result.Text,
+		Source:  "task:" + task.ID,
+	}
+	if u := task.Result.Usage; u != nil {
+		entry.InputTokens = u.InputTokens
+		entry.CachedInputTokens = u.CachedInputTokens
+		entry.OutputTokens = u.OutputTokens
+		entry.DurationMs = int64(u.DurationSeconds) * 1000
+	}
+	if err := m.resultCache.Put(entry, m.resultCache.TTL(task.Cache)); err != nil {
+		log.Warn("failed to write result cache", "task_id", task.ID, "error", err)
+	}
+}
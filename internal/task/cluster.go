@@ -0,0 +1,74 @@
+package task
+
+import "time"
+
+// Cluster 多实例协调接口（实例 ID 与心跳存活状态）
+type Cluster interface {
+	// InstanceID 当前实例 ID
+	InstanceID() string
+	// Alive 实例是否仍在心跳（当前实例始终存活）
+	Alive(instanceID string) bool
+	// Refresh 立即重新读取实例心跳，返回读取时刻
+	Refresh() (time.Time, error)
+}
+
+// SetCluster 设置多实例协调器（未设置时按单实例运行，启动时恢复全部中断的任务）
+func (m *Manager) SetCluster(c Cluster) {
+	m.cluster = c
+}
+
+// instanceID 当前实例 ID，单实例运行时为空
+func (m *Manager) instanceID() string {
+	if m.cluster == nil {
+		return ""
+	}
+	return m.cluster.InstanceID()
+}
+
+// TakeOverOrphanedTasks 接管所属实例已停止心跳的 running / waiting_approval 任务
+//
+// 由 Leader 周期调用：任务重新入队（由存活实例重新调度执行），超时的标记失败，
+// 多轮任务在轮次之间中断的直接完成。返回被接管的任务数。
+//
+// 接管前重新读取心跳；刷新之后才开始执行的任务可能属于刚启动、尚未出现在存活列表中的实例，跳过。
+// 任务先按原实例与状态条件更新归属到当前实例，期间被其他实例修改的任务不接管。
+func (m *Manager) TakeOverOrphanedTasks() int {
+	if m.cluster == nil {
+		return 0
+	}
+
+	refreshedAt, err := m.cluster.Refresh()
+	if err != nil {
+		log.Error("takeover: failed to refresh instances", "error", err)
+		return 0
+	}
+
+	tasks, err := m.store.List(&ListFilter{Status: []Status{StatusRunning, StatusWaitingApproval}})
+	if err != nil {
+		log.Error("takeover: failed to list running tasks", "error", err)
+		return 0
+	}
+
+	taken := 0
+	for _, task := range tasks {
+		if m.cluster.Alive(task.InstanceID) {
+			continue
+		}
+		if task.StartedAt != nil && task.StartedAt.After(refreshedAt) {
+			continue
+		}
+		ok, err := m.store.ReassignInstance(task.ID, task.InstanceID, m.instanceID(), task.Status)
+		if err != nil {
+			log.Error("takeover: failed to reassign task", "task_id", task.ID, "error", err)
+			continue
+		}
+		if !ok {
+			continue // 已被原实例更新或其他实例接管
+		}
+		log.Warn("taking over orphaned task", "task_id", task.ID, "instance_id", task.InstanceID, "status", task.Status)
+		task.InstanceID = m.instanceID()
+		m.recoverTask(task, true)
+		taken++
+	}
+	return taken
+}
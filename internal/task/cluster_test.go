@@ -0,0 +1,87 @@
+package task
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCluster 固定存活实例集合
+type fakeCluster struct {
+	self  string
+	alive map[string]bool
+}
+
+func (c *fakeCluster) InstanceID() string { return c.self }
+
+func (c *fakeCluster) Alive(id string) bool { return id == c.self || c.alive[id] }
+
+func (c *fakeCluster) Refresh() (time.Time, error) { return time.Now(), nil }
+
+func TestManager_TakeOverOrphanedTasks(t *testing.T) {
+	store, err := NewGormStore(setupTestDB(t))
+	require.NoError(t, err)
+	m := NewManager(store, nil, nil, nil)
+	m.SetCluster(&fakeCluster{self: "instance-a", alive: map[string]bool{"instance-b": true}})
+
+	now := time.Now()
+	for _, task := range []*Task{
+		{ID: "mine", InstanceID: "instance-a"},
+		{ID: "peer", InstanceID: "instance-b"},
+		{ID: "orphan", InstanceID: "instance-c", SessionID: "sess-1"},
+		{ID: "idle", InstanceID: "instance-c", Turns: []Turn{{ID: "turn-1", Prompt: "p", Result: &Result{Text: "done"}}}},
+		{ID: "legacy"},
+		{ID: "expired", InstanceID: "instance-c", Timeout: 60, StartedAt: timePtr(now.Add(-time.Hour))},
+		// 刷新心跳之后才开始执行：所属实例可能刚启动，不接管
+		{ID: "fresh", InstanceID: "instance-d", StartedAt: timePtr(now.Add(time.Minute))},
+	} {
+		task.AgentID = "agent-1"
+		task.Prompt = "p"
+		task.Status = StatusRunning
+		task.CreatedAt = now
+		if task.StartedAt == nil {
+			task.StartedAt = &now
+		}
+		require.NoError(t, store.Create(task))
+	}
+
+	assert.Equal(t, 4, m.TakeOverOrphanedTasks())
+
+	for id, want := range map[string]Status{
+		"mine":    StatusRunning,
+		"peer":    StatusRunning,
+		"orphan":  StatusQueued,
+		"idle":    StatusCompleted,
+		"legacy":  StatusQueued,
+		"expired": StatusFailed,
+		"fresh":   StatusRunning,
+	} {
+		got, err := store.Get(id)
+		require.NoError(t, err)
+		assert.Equal(t, want, got.Status, id)
+	}
+
+	orphan, err := store.Get("orphan")
+	require.NoError(t, err)
+	assert.Empty(t, orphan.SessionID)
+	assert.Empty(t, orphan.InstanceID)
+
+	// 归属只按原实例与状态条件更新
+	ok, err := store.ReassignInstance("fresh", "instance-c", "instance-a", StatusRunning)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = store.ReassignInstance("orphan", "instance-c", "instance-a", StatusRunning)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// 重新入队的任务由存活实例领取，并记录新的执行实例
+	claimed, err := store.ClaimTasks([]string{"orphan"}, "instance-b")
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, "instance-b", claimed[0].InstanceID)
+
+	// 未配置多实例协调时不接管
+	assert.Zero(t, NewManager(store, nil, nil, nil).TakeOverOrphanedTasks())
+}
@@ -0,0 +1,99 @@
+package task
+
+import (
+	"time"
+
+	"github.com/tmalldedede/agentbox/internal/apperr"
+)
+
+// deadlineExceededReason 截止时间已过时写入 ErrorMessage 的原因
+const deadlineExceededReason = "deadline exceeded"
+
+// validateSchedule 校验 run_at / deadline
+func validateSchedule(runAt, deadline *time.Time, now time.Time) error {
+	if deadline != nil {
+		if !deadline.After(now) {
+			return apperr.BadRequestf("deadline must be in the future")
+		}
+		if runAt != nil && !deadline.After(*runAt) {
+			return apperr.BadRequestf("deadline must be after run_at")
+		}
+	}
+	return nil
+}
+
+// deadlineBefore 截止时间排序：有截止时间的任务优先，越近越靠前
+func deadlineBefore(a, b *Task) bool {
+	switch {
+	case a.Deadline == nil:
+		return false
+	case b.Deadline == nil:
+		return true
+	default:
+		return a.Deadline.Before(*b.Deadline)
+	}
+}
+
+// turnInProgress 任务是否有正在执行（或等待审批）的轮次；首轮完成后等待下一轮的空闲任务返回 false
+func turnInProgress(task *Task) bool {
+	if task.Status == StatusWaitingApproval {
+		return true
+	}
+	n := len(task.Turns)
+	return n == 0 || task.Turns[n-1].Result == nil
+}
+
+// enforceDeadlines 处理已过截止时间的任务。截止时间约束的是执行，不是多轮任务的整个生命周期：
+//   - 尚未开始的任务：原子标记为失败（多实例下只会被处理一次）
+//   - 本实例正在执行轮次的任务：取消执行
+//   - 空闲等待下一轮的任务：不处理，由 idle timeout 正常完成（过期后不再接受新的轮次）
+func (m *Manager) enforceDeadlines() {
+	now := time.Now()
+
+	expired, err := m.store.ExpireQueued(now, deadlineExceededReason)
+	if err != nil {
+		log.Error("failed to expire queued tasks", "error", err)
+	}
+	for _, task := range expired {
+		log.Warn("task deadline exceeded before start", "task_id", task.ID, "deadline", task.Deadline)
+		m.broadcastEvent(task.ID, &TaskEvent{Type: "task.failed", Data: map[string]interface{}{
+			"error": deadlineExceededReason,
+		}})
+		if task.WebhookURL != "" {
+			go m.sendWebhook(task)
+		}
+		m.notifyWorkflow(task)
+	}
+
+	m.runningMu.Lock()
+	owned := len(m.running)
+	m.runningMu.Unlock()
+	if owned == 0 {
+		return
+	}
+
+	overdue, err := m.store.List(&ListFilter{
+		Status:         []Status{StatusRunning, StatusWaitingApproval},
+		DeadlineBefore: &now,
+	})
+	if err != nil {
+		log.Error("failed to list overdue running tasks", "error", err)
+		return
+	}
+	for _, task := range overdue {
+		m.runningMu.Lock()
+		_, ours := m.running[task.ID]
+		m.runningMu.Unlock()
+		if !ours {
+			continue // 由运行该任务的实例处理
+		}
+		if !turnInProgress(task) {
+			continue
+		}
+
+		log.Warn("task deadline exceeded, cancelling", "task_id", task.ID, "deadline", task.Deadline)
+		if err := m.cancelTask(task.ID, deadlineExceededReason); err != nil {
+			log.Error("failed to cancel overdue task", "task_id", task.ID, "error", err)
+		}
+	}
+}
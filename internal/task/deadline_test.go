@@ -0,0 +1,134 @@
+package task
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func timePtr(t time.Time) *time.Time { return &t }
+
+func TestValidateSchedule(t *testing.T) {
+	now := time.Now()
+	assert.NoError(t, validateSchedule(nil, nil, now))
+	assert.NoError(t, validateSchedule(timePtr(now.Add(time.Hour)), nil, now))
+	assert.NoError(t, validateSchedule(timePtr(now.Add(time.Hour)), timePtr(now.Add(2*time.Hour)), now))
+
+	assert.Error(t, validateSchedule(nil, timePtr(now.Add(-time.Minute)), now))
+	assert.Error(t, validateSchedule(timePtr(now.Add(2*time.Hour)), timePtr(now.Add(time.Hour)), now))
+}
+
+func TestGormStore_ClaimRespectsRunAtAndDeadline(t *testing.T) {
+	store, err := NewGormStore(setupTestDB(t))
+	require.NoError(t, err)
+
+	now := time.Now()
+	for _, task := range []*Task{
+		{ID: "ready", CreatedAt: now.Add(-3 * time.Minute)},
+		{ID: "delayed", RunAt: timePtr(now.Add(time.Hour)), CreatedAt: now.Add(-2 * time.Minute)},
+		{ID: "expired", Deadline: timePtr(now.Add(-time.Second)), CreatedAt: now.Add(-time.Minute)},
+		{ID: "urgent", Deadline: timePtr(now.Add(time.Minute)), CreatedAt: now},
+	} {
+		task.AgentID = "agent-1"
+		task.Prompt = "p"
+		task.Status = StatusQueued
+		require.NoError(t, store.Create(task))
+	}
+
+	// 截止时间近的任务优先，延迟任务和已过期任务不会被领取
+	claimed, err := store.ClaimQueued(10, "")
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+	assert.Equal(t, "urgent", claimed[0].ID)
+	assert.Equal(t, "ready", claimed[1].ID)
+
+	claimed, err = store.ClaimTasks([]string{"delayed", "expired"}, "")
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+
+	ready, err := store.List(&ListFilter{Status: []Status{StatusQueued}, ReadyAt: timePtr(now.Add(2 * time.Hour))})
+	require.NoError(t, err)
+	require.Len(t, ready, 1)
+	assert.Equal(t, "delayed", ready[0].ID)
+}
+
+func TestGormStore_ExpireQueued(t *testing.T) {
+	store, err := NewGormStore(setupTestDB(t))
+	require.NoError(t, err)
+
+	now := time.Now()
+	require.NoError(t, store.Create(&Task{ID: "late", AgentID: "a", Prompt: "p", Status: StatusQueued, Deadline: timePtr(now.Add(-time.Minute)), CreatedAt: now}))
+	require.NoError(t, store.Create(&Task{ID: "ok", AgentID: "a", Prompt: "p", Status: StatusQueued, Deadline: timePtr(now.Add(time.Hour)), CreatedAt: now}))
+	require.NoError(t, store.Create(&Task{ID: "running", AgentID: "a", Prompt: "p", Status: StatusRunning, Deadline: timePtr(now.Add(-time.Minute)), CreatedAt: now}))
+
+	expired, err := store.ExpireQueued(now, deadlineExceededReason)
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	assert.Equal(t, "late", expired[0].ID)
+
+	got, err := store.Get("late")
+	require.NoError(t, err)
+	assert.Equal(t, StatusFailed, got.Status)
+	assert.Equal(t, deadlineExceededReason, got.ErrorMessage)
+	assert.NotNil(t, got.CompletedAt)
+
+	// 再次执行不会重复处理
+	expired, err = store.ExpireQueued(now, deadlineExceededReason)
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+
+	overdue, err := store.List(&ListFilter{Status: []Status{StatusRunning}, DeadlineBefore: &now})
+	require.NoError(t, err)
+	require.Len(t, overdue, 1)
+	assert.Equal(t, "running", overdue[0].ID)
+}
+
+func TestFairScheduler_DeadlineFirstWithinUser(t *testing.T) {
+	now := time.Now()
+	queued := queuedTasks("alice", "agent-1", PriorityNormal, 3, now)
+	queued[2].Deadline = timePtr(now.Add(time.Minute))
+	queued[1].Deadline = timePtr(now.Add(time.Hour))
+
+	f := newFairScheduler()
+	picked := f.pick(queued, nil, &SchedulingPolicy{}, 3)
+	require.Len(t, picked, 3)
+	assert.Equal(t, []string{"alice-normal-2", "alice-normal-1", "alice-normal-0"},
+		[]string{picked[0].ID, picked[1].ID, picked[2].ID})
+}
+
+func TestEnforceDeadlines_IdleTaskNotCancelled(t *testing.T) {
+	store, err := NewGormStore(setupTestDB(t))
+	require.NoError(t, err)
+	m := NewManager(store, nil, nil, nil)
+
+	// 首轮已完成、等待下一轮的任务超过截止时间：不取消
+	task := &Task{
+		ID: "idle", AgentID: "agent-1", Prompt: "p", Status: StatusRunning, SessionID: "sess-1",
+		Deadline: timePtr(time.Now().Add(-time.Second)), CreatedAt: time.Now(),
+		Turns: []Turn{{ID: "turn-1", Prompt: "p", Result: &Result{Text: "done"}}},
+	}
+	require.NoError(t, store.Create(task))
+	cancelled := false
+	m.running[task.ID] = func() { cancelled = true }
+
+	m.enforceDeadlines()
+	got, err := store.Get(task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusRunning, got.Status)
+	assert.Empty(t, got.ErrorMessage)
+	assert.False(t, cancelled)
+
+	// 过期后不再接受新的轮次
+	_, err = m.appendTurn(&CreateTaskRequest{TaskID: task.ID, Prompt: "again"})
+	assert.ErrorContains(t, err, "past its deadline")
+}
+
+func TestTurnInProgress(t *testing.T) {
+	assert.True(t, turnInProgress(&Task{Status: StatusRunning}))
+	assert.True(t, turnInProgress(&Task{Status: StatusRunning, Turns: []Turn{{ID: "t1"}}}))
+	assert.False(t, turnInProgress(&Task{Status: StatusRunning, Turns: []Turn{{ID: "t1", Result: &Result{}}}}))
+	assert.True(t, turnInProgress(&Task{Status: StatusRunning, Turns: []Turn{{ID: "t1", Result: &Result{}}, {ID: "t2"}}}))
+	assert.True(t, turnInProgress(&Task{Status: StatusWaitingApproval, Turns: []Turn{{ID: "t1", Result: &Result{}}}}))
+}
@@ -0,0 +1,79 @@
+package task
+
+import (
+	"context"
+
+	"github.com/tmalldedede/agentbox/internal/agent"
+	"github.com/tmalldedede/agentbox/internal/eval"
+	"github.com/tmalldedede/agentbox/internal/session"
+)
+
+// SetEvalJudge 设置 LLM 评审（llm_judge 评估器使用，未设置时该类评估器判定为失败）
+func (m *Manager) SetEvalJudge(judge eval.Judge) {
+	m.evalJudge = judge
+}
+
+// taskEvaluators 任务需要执行的评估器：Agent 的评估器在前，任务级（模板 / 请求）评估器在后
+func taskEvaluators(task *Task, ag *agent.Agent) []eval.Evaluator {
+	var evaluators []eval.Evaluator
+	if ag != nil {
+		evaluators = append(evaluators, ag.Evaluators...)
+	}
+	return append(evaluators, task.Evaluators...)
+}
+
+// sessionCommandRunner 在 Session 容器工作区中执行 command 评估器
+func sessionCommandRunner(mgr *session.Manager, sessionID string) eval.CommandRunner {
+	return func(ctx context.Context, command string) (int, string, error) {
+		result, err := mgr.RunCommand(ctx, sessionID, command)
+		if err != nil {
+			return 0, "", err
+		}
+		return result.ExitCode, result.Stdout + result.Stderr, nil
+	}
+}
+
+// evaluateTask 对任务最新一轮的结果执行评估器，报告写入 task.Evaluation（由调用方持久化）
+//
+// 评估不改变任务状态：未通过的评估只记录在报告中，并通过 task.evaluated 事件通知。
+func (m *Manager) evaluateTask(ctx context.Context, task *Task, ag *agent.Agent, prompt string) {
+	evaluators := taskEvaluators(task, ag)
+	if len(evaluators) == 0 || task.Result == nil {
+		return
+	}
+
+	env := &eval.Env{Judge: m.evalJudge}
+	if m.sessionMgr != nil && task.SessionID != "" {
+		env.Commands = sessionCommandRunner(m.sessionMgr, task.SessionID)
+	}
+	report := eval.Run(ctx, evaluators, &eval.Subject{Prompt: prompt, Output: task.Result.Text}, env)
+	task.Evaluation = report
+
+	log.Info("task evaluated",
+		"task_id", task.ID,
+		"passed", report.Passed,
+		"score", report.Score,
+		"evaluators", len(report.Results))
+
+	m.broadcastEvent(task.ID, &TaskEvent{Type: "task.evaluated", Data: map[string]interface{}{
+		"passed":  report.Passed,
+		"score":   report.Score,
+		"results": report.Results,
+	}})
+}
+
+// evaluateTurn 多轮追加执行成功后重新评估（报告反映最新一轮的结果）
+func (m *Manager) evaluateTurn(taskID string, ag *agent.Agent, prompt string) {
+	task, err := m.store.Get(taskID)
+	if err != nil {
+		log.Error("evaluateTurn: failed to get task", "task_id", taskID, "error", err)
+		return
+	}
+	if len(taskEvaluators(task, ag)) == 0 {
+		return
+	}
+	m.evaluateTask(m.ctx, task, ag, prompt)
+	if err := m.store.Update(task); err != nil {
+		log.Error("evaluateTurn: failed to save evaluation", "task_id", taskID, "error", err)
+	}
+}
@@ -0,0 +1,53 @@
+package task
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmalldedede/agentbox/internal/agent"
+	"github.com/tmalldedede/agentbox/internal/eval"
+)
+
+type stubJudge struct{ reply string }
+
+func (j *stubJudge) Complete(context.Context, string, string, string) (string, error) {
+	return j.reply, nil
+}
+
+func TestEvaluateTask(t *testing.T) {
+	m := setupWorkflowManager(t)
+	m.SetEvalJudge(&stubJudge{reply: `{"score": 0.4, "reason": "misses edge cases"}`})
+
+	task := newRunningTask(t, m, nil)
+	task.Result = &Result{Text: `{"status": "ok"}`}
+	task.Evaluators = []eval.Evaluator{
+		{Type: eval.TypeJSONSchema, Schema: []byte(`{"type": "object", "required": ["status"]}`)},
+		{Name: "judge", Type: eval.TypeLLMJudge, ProviderID: "p", Criteria: "handles edge cases"},
+	}
+	ag := &agent.Agent{Evaluators: []eval.Evaluator{{Name: "ok", Type: eval.TypeContains, Pattern: "ok"}}}
+	events := m.SubscribeEvents(task.ID)
+
+	m.evaluateTask(context.Background(), task, ag, task.Prompt)
+	require.NotNil(t, task.Evaluation)
+	require.Len(t, task.Evaluation.Results, 3)
+	assert.Equal(t, "ok", task.Evaluation.Results[0].Name)
+	assert.False(t, task.Evaluation.Passed)
+	assert.InDelta(t, 0.8, task.Evaluation.Score, 1e-9)
+	assert.Equal(t, "judge: misses edge cases", task.Evaluation.Reasons())
+	assert.Equal(t, "task.evaluated", (<-events).Type)
+
+	// 评估报告随任务持久化
+	require.NoError(t, m.store.Update(task))
+	got, err := m.GetTask(task.ID)
+	require.NoError(t, err)
+	require.NotNil(t, got.Evaluation)
+	assert.False(t, got.Evaluation.Passed)
+	assert.Len(t, got.Evaluators, 2)
+
+	// 没有评估器时不生成报告
+	plain := &Task{ID: "task-plain", Result: &Result{Text: "x"}}
+	m.evaluateTask(context.Background(), plain, nil, "p")
+	assert.Nil(t, plain.Evaluation)
+}
@@ -0,0 +1,199 @@
+package task
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// eventCatchUpInterval 事件流空闲时从事件日志补齐的间隔
+	// （补回因订阅通道写满而丢弃的事件，以及其他实例产生的事件）
+	eventCatchUpInterval = 3 * time.Second
+	// eventPruneInterval 事件日志过期清理间隔
+	eventPruneInterval = time.Hour
+	// eventReplayLimit 单次从事件日志读取的最大条数
+	eventReplayLimit = 1000
+)
+
+// EventStore 任务事件日志存储接口
+type EventStore interface {
+	// Append 追加事件并分配任务内单调递增的序号（写回 event.Seq）
+	Append(taskID string, event *TaskEvent) error
+	// ListAfter 按序号升序返回 afterSeq 之后的事件，limit <= 0 表示不限
+	ListAfter(taskID string, afterSeq int64, limit int) ([]*TaskEvent, error)
+	// DeleteByTask 删除任务的全部事件
+	DeleteByTask(taskID string) error
+	// DeleteBefore 删除早于指定时间的事件
+	DeleteBefore(before time.Time) (int64, error)
+}
+
+// RetentionFunc 事件日志保留时长提供者，返回 0 表示不自动清理
+type RetentionFunc func() time.Duration
+
+// SetEventStore 设置事件日志存储（未设置时事件只推送给在线订阅者，不可回放）
+func (m *Manager) SetEventStore(store EventStore) {
+	m.eventStore = store
+}
+
+// SetEventRetention 设置事件日志保留时长提供者（如从 settings.StorageSettings 读取）
+func (m *Manager) SetEventRetention(fn RetentionFunc) {
+	m.eventRetention = fn
+}
+
+// IsTerminalEvent 是否是任务终态事件（收到后事件流结束）
+func IsTerminalEvent(eventType string) bool {
+	return eventType == "task.completed" || eventType == "task.failed" || eventType == "task.cancelled"
+}
+
+// ReplayEvents 返回任务在 afterSeq 之后的历史事件（未配置事件日志时返回空）
+func (m *Manager) ReplayEvents(taskID string, afterSeq int64) ([]*TaskEvent, error) {
+	if m.eventStore == nil {
+		return nil, nil
+	}
+	var all []*TaskEvent
+	for {
+		events, err := m.eventStore.ListAfter(taskID, afterSeq, eventReplayLimit)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, events...)
+		if len(events) < eventReplayLimit {
+			return all, nil
+		}
+		afterSeq = events[len(events)-1].Seq
+	}
+}
+
+// OpenEventStream 打开可续传的任务事件流
+//
+// 先回放 afterSeq 之后的历史事件，再推送实时事件；按序号去重，
+// 发现序号缺口（订阅通道写满丢弃）时从事件日志补齐。
+// afterSeq < 0 表示不回放历史，只推送之后产生的事件。
+// 收到终态事件或 ctx 结束后关闭返回的 channel。
+func (m *Manager) OpenEventStream(ctx context.Context, taskID string, afterSeq int64) <-chan *TaskEvent {
+	// 先订阅再回放：回放期间产生的事件会留在订阅通道中，按序号去重
+	live := m.SubscribeEvents(taskID)
+	out := make(chan *TaskEvent, 100)
+
+	go func() {
+		defer close(out)
+		defer m.UnsubscribeEvents(taskID, live)
+
+		last := afterSeq
+		// emit 推送一个事件，返回 false 表示事件流应结束
+		emit := func(event *TaskEvent) bool {
+			select {
+			case out <- event:
+			case <-ctx.Done():
+				return false
+			}
+			if event.Seq > 0 {
+				last = event.Seq
+			}
+			return !IsTerminalEvent(event.Type)
+		}
+		// catchUp 从事件日志补齐 last 之后的事件
+		catchUp := func() bool {
+			if last < 0 {
+				return true
+			}
+			events, err := m.ReplayEvents(taskID, last)
+			if err != nil {
+				log.Warn("failed to replay task events", "task_id", taskID, "after_seq", last, "error", err)
+				return true
+			}
+			for _, event := range events {
+				if !emit(event) {
+					return false
+				}
+			}
+			return true
+		}
+
+		if !catchUp() {
+			return
+		}
+
+		ticker := time.NewTicker(eventCatchUpInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if m.eventStore != nil && !catchUp() {
+					return
+				}
+			case event, ok := <-live:
+				if !ok {
+					return
+				}
+				switch {
+				case event.Seq == 0:
+					// 未持久化（未配置事件日志或写入失败），直接推送
+					if !emit(event) {
+						return
+					}
+				case last < 0:
+					// 仅实时模式：以收到的第一个事件作为起点
+					if !emit(event) {
+						return
+					}
+				case event.Seq <= last:
+					// 已通过回放推送过
+				case event.Seq > last+1:
+					// 存在缺口，从事件日志补齐（包含当前事件）
+					if !catchUp() {
+						return
+					}
+				default:
+					if !emit(event) {
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return out
+}
+
+// eventJanitor 按保留策略定期清理事件日志
+func (m *Manager) eventJanitor() {
+	defer m.wg.Done()
+
+	m.pruneEvents()
+
+	ticker := time.NewTicker(eventPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			m.pruneEvents()
+		}
+	}
+}
+
+// pruneEvents 删除超过保留时长的事件
+func (m *Manager) pruneEvents() {
+	if m.eventStore == nil || m.eventRetention == nil {
+		return
+	}
+	retention := m.eventRetention()
+	if retention <= 0 {
+		return
+	}
+
+	count, err := m.eventStore.DeleteBefore(time.Now().Add(-retention))
+	if err != nil {
+		log.Error("failed to prune task events", "error", err)
+		return
+	}
+	if count > 0 {
+		log.Info("pruned task events", "count", count, "retention", retention)
+	}
+}
@@ -0,0 +1,154 @@
+package task
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmalldedede/agentbox/internal/database"
+)
+
+func newEventLogManager(t *testing.T) (*Manager, *GormEventStore) {
+	t.Helper()
+	store, err := NewGormEventStore(setupTestDB(t))
+	require.NoError(t, err)
+	m := &Manager{eventSubs: make(map[string][]chan *TaskEvent)}
+	m.SetEventStore(store)
+	return m, store
+}
+
+func eventTypes(events []*TaskEvent) []string {
+	types := make([]string, len(events))
+	for i, e := range events {
+		types[i] = e.Type
+	}
+	return types
+}
+
+func collectEvents(t *testing.T, ch <-chan *TaskEvent) []*TaskEvent {
+	t.Helper()
+	var events []*TaskEvent
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return events
+			}
+			events = append(events, e)
+		case <-timeout:
+			t.Fatal("event stream did not close")
+		}
+	}
+}
+
+func TestGormEventStore_SequencePerTask(t *testing.T) {
+	store, err := NewGormEventStore(setupTestDB(t))
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		e := &TaskEvent{Type: "agent.message", Data: map[string]interface{}{"i": i}}
+		require.NoError(t, store.Append("task-a", e))
+		assert.Equal(t, int64(i+1), e.Seq)
+	}
+	other := &TaskEvent{Type: "task.started"}
+	require.NoError(t, store.Append("task-b", other))
+	assert.Equal(t, int64(1), other.Seq)
+
+	events, err := store.ListAfter("task-a", 1, 0)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, int64(2), events[0].Seq)
+	assert.Equal(t, map[string]interface{}{"i": float64(1)}, events[0].Data)
+
+	require.NoError(t, store.DeleteByTask("task-a"))
+	events, err = store.ListAfter("task-a", 0, 0)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+
+	// 已有事件但还没有计数器（升级前的数据）：从最大序号继续
+	require.NoError(t, store.db.Create(&database.TaskEventModel{TaskID: "task-c", Seq: 7, Type: "old", CreatedAt: time.Now()}).Error)
+	legacy := &TaskEvent{Type: "new"}
+	require.NoError(t, store.Append("task-c", legacy))
+	assert.Equal(t, int64(8), legacy.Seq)
+}
+
+func TestGormEventStore_DeleteBefore(t *testing.T) {
+	store, err := NewGormEventStore(setupTestDB(t))
+	require.NoError(t, err)
+
+	require.NoError(t, store.Append("task-a", &TaskEvent{Type: "old", CreatedAt: time.Now().Add(-48 * time.Hour)}))
+	require.NoError(t, store.Append("task-a", &TaskEvent{Type: "new"}))
+
+	count, err := store.DeleteBefore(time.Now().Add(-24 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	events, err := store.ListAfter("task-a", 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new"}, eventTypes(events))
+
+	// 清理掉任务的全部事件后序号继续递增（续传的客户端不会丢事件）
+	_, err = store.DeleteBefore(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	next := &TaskEvent{Type: "later"}
+	require.NoError(t, store.Append("task-a", next))
+	assert.Equal(t, int64(3), next.Seq)
+}
+
+func TestOpenEventStream_ReplaysFinishedTask(t *testing.T) {
+	m, _ := newEventLogManager(t)
+	for _, typ := range []string{"task.started", "agent.message", "task.completed"} {
+		m.broadcastEvent("task-1", &TaskEvent{Type: typ})
+	}
+
+	all := collectEvents(t, m.OpenEventStream(context.Background(), "task-1", 0))
+	assert.Equal(t, []string{"task.started", "agent.message", "task.completed"}, eventTypes(all))
+
+	// Last-Event-ID 续传：只返回之后的事件
+	resumed := collectEvents(t, m.OpenEventStream(context.Background(), "task-1", 2))
+	assert.Equal(t, []string{"task.completed"}, eventTypes(resumed))
+	assert.Equal(t, int64(3), resumed[0].Seq)
+}
+
+func TestOpenEventStream_LiveWithGapFill(t *testing.T) {
+	m, _ := newEventLogManager(t)
+	m.broadcastEvent("task-1", &TaskEvent{Type: "task.started"})
+
+	ch := m.OpenEventStream(context.Background(), "task-1", 0)
+	first := <-ch
+	assert.Equal(t, "task.started", first.Type)
+
+	// 模拟订阅通道写满丢弃：事件只写入日志，不推送给订阅者
+	require.NoError(t, m.eventStore.Append("task-1", &TaskEvent{Type: "agent.thinking"}))
+	m.broadcastEvent("task-1", &TaskEvent{Type: "agent.message"})
+	m.broadcastEvent("task-1", &TaskEvent{Type: "task.failed"})
+
+	rest := collectEvents(t, ch)
+	assert.Equal(t, []string{"agent.thinking", "agent.message", "task.failed"}, eventTypes(rest))
+	for i, e := range rest {
+		assert.Equal(t, int64(i+2), e.Seq)
+	}
+
+	m.eventSubsMu.RLock()
+	assert.Empty(t, m.eventSubs["task-1"])
+	m.eventSubsMu.RUnlock()
+}
+
+func TestPruneEvents_FollowsRetention(t *testing.T) {
+	m, store := newEventLogManager(t)
+	require.NoError(t, store.Append("task-1", &TaskEvent{Type: "old", CreatedAt: time.Now().Add(-10 * 24 * time.Hour)}))
+	require.NoError(t, store.Append("task-1", &TaskEvent{Type: "recent"}))
+
+	// 未配置保留策略时不清理
+	m.pruneEvents()
+	events, _ := store.ListAfter("task-1", 0, 0)
+	assert.Len(t, events, 2)
+
+	m.SetEventRetention(func() time.Duration { return 7 * 24 * time.Hour })
+	m.pruneEvents()
+	events, _ = store.ListAfter("task-1", 0, 0)
+	assert.Equal(t, []string{"recent"}, eventTypes(events))
+}
@@ -0,0 +1,146 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/tmalldedede/agentbox/internal/database"
+	"gorm.io/gorm"
+)
+
+// appendRetries 序号冲突（多实例并发写同一任务）时的重试次数
+const appendRetries = 3
+
+// GormEventStore 任务事件日志 GORM 存储实现
+type GormEventStore struct {
+	db *gorm.DB
+}
+
+// NewGormEventStore 创建任务事件日志存储
+func NewGormEventStore(db *gorm.DB) (*GormEventStore, error) {
+	if err := db.AutoMigrate(&database.TaskEventModel{}, &database.TaskEventSeqModel{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate task event table: %w", err)
+	}
+	return &GormEventStore{db: db}, nil
+}
+
+// Append 追加事件，分配该任务内单调递增的序号（写回 event.Seq）
+func (s *GormEventStore) Append(taskID string, event *TaskEvent) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event data: %w", err)
+	}
+
+	createdAt := event.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	for attempt := 1; ; attempt++ {
+		model := &database.TaskEventModel{
+			TaskID:    taskID,
+			Type:      event.Type,
+			DataJSON:  string(data),
+			CreatedAt: createdAt,
+		}
+		err = s.db.Transaction(func(tx *gorm.DB) error {
+			seq, err := nextSeq(tx, taskID)
+			if err != nil {
+				return err
+			}
+			model.Seq = seq
+			return tx.Create(model).Error
+		})
+		if err == nil {
+			event.Seq = model.Seq
+			event.CreatedAt = createdAt
+			return nil
+		}
+		if attempt >= appendRetries {
+			return err
+		}
+	}
+}
+
+// nextSeq 递增并返回任务的事件序号。计数器独立于事件行保存，清理旧事件后序号不会回退；
+// 首次使用时从已有事件的最大序号开始
+func nextSeq(tx *gorm.DB, taskID string) (int64, error) {
+	res := tx.Model(&database.TaskEventSeqModel{}).
+		Where("task_id = ?", taskID).
+		Update("seq", gorm.Expr("seq + 1"))
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	if res.RowsAffected == 0 {
+		var last int64
+		if err := tx.Model(&database.TaskEventModel{}).
+			Where("task_id = ?", taskID).
+			Select("COALESCE(MAX(seq), 0)").
+			Scan(&last).Error; err != nil {
+			return 0, err
+		}
+		// 并发创建计数器时主键冲突，由 Append 重试
+		counter := &database.TaskEventSeqModel{TaskID: taskID, Seq: last + 1}
+		if err := tx.Create(counter).Error; err != nil {
+			return 0, err
+		}
+		return counter.Seq, nil
+	}
+
+	var seq int64
+	if err := tx.Model(&database.TaskEventSeqModel{}).
+		Where("task_id = ?", taskID).
+		Select("seq").
+		Scan(&seq).Error; err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
+
+// ListAfter 按序号升序返回 afterSeq 之后的事件，limit <= 0 表示不限
+func (s *GormEventStore) ListAfter(taskID string, afterSeq int64, limit int) ([]*TaskEvent, error) {
+	query := s.db.Where("task_id = ? AND seq > ?", taskID, afterSeq).Order("seq ASC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	var models []database.TaskEventModel
+	if err := query.Find(&models).Error; err != nil {
+		return nil, err
+	}
+
+	events := make([]*TaskEvent, len(models))
+	for i := range models {
+		events[i] = modelToEvent(&models[i])
+	}
+	return events, nil
+}
+
+// DeleteByTask 删除任务的全部事件及其序号计数器（任务删除时调用）
+func (s *GormEventStore) DeleteByTask(taskID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("task_id = ?", taskID).Delete(&database.TaskEventModel{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("task_id = ?", taskID).Delete(&database.TaskEventSeqModel{}).Error
+	})
+}
+
+// DeleteBefore 删除早于指定时间的事件
+func (s *GormEventStore) DeleteBefore(before time.Time) (int64, error) {
+	result := s.db.Where("created_at < ?", before).Delete(&database.TaskEventModel{})
+	return result.RowsAffected, result.Error
+}
+
+func modelToEvent(model *database.TaskEventModel) *TaskEvent {
+	event := &TaskEvent{
+		Seq:       model.Seq,
+		Type:      model.Type,
+		CreatedAt: model.CreatedAt,
+	}
+	if model.DataJSON != "" && model.DataJSON != "null" {
+		json.Unmarshal([]byte(model.DataJSON), &event.Data)
+	}
+	return event
+}
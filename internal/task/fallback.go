@@ -11,6 +11,7 @@ import (
 	"github.com/tmalldedede/agentbox/internal/agent"
 	"github.com/tmalldedede/agentbox/internal/apperr"
 	"github.com/tmalldedede/agentbox/internal/engine"
+	"github.com/tmalldedede/agentbox/internal/providerhealth"
 	"github.com/tmalldedede/agentbox/internal/session"
 )
 
@@ -29,6 +30,14 @@ type FallbackExecutor struct {
 	providerMgr ProviderKeyManager
 	sessionMgr  *session.Manager
 
+	// health is the optional circuit breaker: providers with an open circuit are skipped
+	// and every attempt's outcome is reported back
+	health ProviderHealth
+
+	// prepareExec is called before each exec (e.g. to inject the approval MCP server);
+	// the returned func is called once the exec returns, an error aborts the exec
+	prepareExec func(task *Task, ag *agent.Agent, req *session.ExecRequest) (func(), error)
+
 	// Metrics (protected by mutex for concurrent access)
 	mu              sync.Mutex
 	totalAttempts   int
@@ -59,6 +68,8 @@ type FallbackResult struct {
 	UsedFallback bool
 	// Errors from each provider
 	ProviderErrors map[string]error
+	// Per-attempt token usage, in attempt order
+	ProviderUsage []ProviderUsage
 	// Thread ID for multi-turn conversations
 	ThreadID string
 }
@@ -70,14 +81,20 @@ func (e *FallbackExecutor) ExecuteWithFallback(ctx context.Context, task *Task,
 	}
 
 	// Build provider list: primary + fallbacks
-	providers := []string{ag.ProviderID}
-	if ag.FallbackEnabled && len(ag.FallbackProviderIDs) > 0 {
-		providers = append(providers, ag.FallbackProviderIDs...)
-	}
+	providers := providerChain(ag)
 
 	var lastErr error
 
 	for i, providerID := range providers {
+		// Skip providers whose circuit is open
+		if e.health != nil && !e.health.Allow(providerID) {
+			err := fmt.Errorf("provider %s: %w", providerID, ErrProviderCircuitOpen)
+			result.ProviderErrors[providerID] = err
+			lastErr = err
+			log.Info("skipping provider, circuit open", "task_id", task.ID, "provider", providerID)
+			continue
+		}
+
 		result.Attempts++
 		e.incrementAttempts()
 
@@ -93,6 +110,11 @@ func (e *FallbackExecutor) ExecuteWithFallback(ctx context.Context, task *Task,
 
 		// Try to execute with this provider
 		sess, execResp, err := e.tryExecuteWithProvider(ctx, task, ag, providerID)
+		var attemptUsage *session.TokenUsage
+		if execResp != nil {
+			attemptUsage = execResp.Usage
+		}
+		result.ProviderUsage = append(result.ProviderUsage, providerUsage(providerID, attemptUsage, err))
 		if err == nil {
 			// Success!
 			result.ProviderID = providerID
@@ -107,6 +129,7 @@ func (e *FallbackExecutor) ExecuteWithFallback(ctx context.Context, task *Task,
 			if e.providerMgr != nil {
 				e.providerMgr.MarkProfileSuccess(providerID, "")
 			}
+			recordProviderHealth(e.health, providerID, nil)
 
 			log.Info("execution succeeded",
 				"task_id", task.ID,
@@ -127,6 +150,7 @@ func (e *FallbackExecutor) ExecuteWithFallback(ctx context.Context, task *Task,
 		if e.providerMgr != nil {
 			e.providerMgr.MarkProfileFailed(providerID, "", string(engineErr.GetReason()))
 		}
+		recordProviderHealth(e.health, providerID, err)
 
 		log.Warn("provider execution failed",
 			"task_id", task.ID,
@@ -155,23 +179,24 @@ func (e *FallbackExecutor) ExecuteWithFallback(ctx context.Context, task *Task,
 	return nil, &ProviderFallbackError{
 		Attempts:       result.Attempts,
 		ProviderErrors: result.ProviderErrors,
+		ProviderUsage:  result.ProviderUsage,
 		LastError:      lastErr,
 	}
 }
 
 // tryExecuteWithProvider attempts to execute a task with a specific provider
 func (e *FallbackExecutor) tryExecuteWithProvider(ctx context.Context, task *Task, ag *agent.Agent, providerID string) (*session.Session, *session.ExecResponse, error) {
-	// Determine workspace
-	workspace := ag.Workspace
-	if workspace == "" {
-		workspace = fmt.Sprintf("agent-%s-%s", ag.ID, task.ID)
-	}
+	// Determine workspace (fresh per retry attempt unless the retry policy reuses it)
+	workspace := taskWorkspace(task, ag)
 
 	// Create session with this provider
 	// We need to inject the provider's env vars
 	createReq := &session.CreateRequest{
-		AgentID:   ag.ID,
-		Workspace: workspace,
+		AgentID:     ag.ID,
+		Workspace:   workspace,
+		ProviderID:  providerID,
+		BudgetKey:   task.ID,
+		TokenBudget: task.TokenBudget,
 	}
 
 	// Get provider env vars
@@ -186,14 +211,14 @@ func (e *FallbackExecutor) tryExecuteWithProvider(ctx context.Context, task *Tas
 	// Create session
 	sess, err := e.sessionMgr.Create(ctx, createReq)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create session: %w", err)
+		return nil, nil, &sessionSetupError{fmt.Errorf("failed to create session: %w", err)}
 	}
 
 	// Start session
 	if err := e.sessionMgr.Start(ctx, sess.ID); err != nil {
 		// Cleanup on failure
 		e.sessionMgr.Stop(ctx, sess.ID)
-		return nil, nil, fmt.Errorf("failed to start session: %w", err)
+		return nil, nil, &sessionSetupError{fmt.Errorf("failed to start session: %w", err)}
 	}
 
 	// Execute the task
@@ -202,10 +227,19 @@ func (e *FallbackExecutor) tryExecuteWithProvider(ctx context.Context, task *Tas
 		timeout = 1800 // Default 30 minutes
 	}
 
-	execResp, err := e.sessionMgr.Exec(ctx, sess.ID, &session.ExecRequest{
+	execReq := &session.ExecRequest{
 		Prompt:  task.Prompt,
 		Timeout: timeout,
-	})
+	}
+	if e.prepareExec != nil {
+		release, err := e.prepareExec(task, ag, execReq)
+		if err != nil {
+			e.sessionMgr.Stop(ctx, sess.ID)
+			return nil, nil, err
+		}
+		defer release()
+	}
+	execResp, err := e.sessionMgr.Exec(ctx, sess.ID, execReq)
 	if err != nil {
 		// Cleanup on failure
 		e.sessionMgr.Stop(ctx, sess.ID)
@@ -261,10 +295,14 @@ func (e *FallbackExecutor) GetStats() map[string]interface{} {
 // AllProvidersFailed is returned when all providers in the fallback chain fail
 var ErrAllProvidersFailed = errors.New("all providers failed")
 
+// ErrProviderCircuitOpen is recorded for providers skipped because their circuit breaker is open
+var ErrProviderCircuitOpen = errors.New("provider circuit open")
+
 // ProviderFallbackError contains information about a fallback chain failure
 type ProviderFallbackError struct {
 	Attempts       int
 	ProviderErrors map[string]error
+	ProviderUsage  []ProviderUsage
 	LastError      error
 }
 
@@ -278,6 +316,9 @@ func (e *ProviderFallbackError) Unwrap() error {
 
 // CheckProviderHealth checks if a provider is healthy (not in cooldown)
 func (e *FallbackExecutor) CheckProviderHealth(providerID string) bool {
+	if e.health != nil && e.health.State(providerID) == providerhealth.StateOpen {
+		return false
+	}
 	if e.providerMgr == nil {
 		return true
 	}
@@ -301,10 +342,7 @@ func (e *FallbackExecutor) CheckProviderHealth(providerID string) bool {
 
 // GetHealthyProviders returns a list of healthy providers from a fallback chain
 func (e *FallbackExecutor) GetHealthyProviders(ag *agent.Agent) []string {
-	providers := []string{ag.ProviderID}
-	if ag.FallbackEnabled && len(ag.FallbackProviderIDs) > 0 {
-		providers = append(providers, ag.FallbackProviderIDs...)
-	}
+	providers := providerChain(ag)
 
 	healthy := make([]string, 0, len(providers))
 	for _, p := range providers {
@@ -339,10 +377,7 @@ func (e *FallbackExecutor) GetProviderHealthStatus(ag *agent.Agent) *ProviderHea
 		FallbackEnabled: ag.FallbackEnabled,
 	}
 
-	providers := []string{ag.ProviderID}
-	if ag.FallbackEnabled && len(ag.FallbackProviderIDs) > 0 {
-		providers = append(providers, ag.FallbackProviderIDs...)
-	}
+	providers := providerChain(ag)
 
 	status.TotalCount = len(providers)
 
@@ -358,7 +393,9 @@ func (e *FallbackExecutor) GetProviderHealthStatus(ag *agent.Agent) *ProviderHea
 		} else {
 			ps.Healthy = false
 			// Try to get reason
-			if e.providerMgr != nil {
+			if e.health != nil && e.health.State(providerID) == providerhealth.StateOpen {
+				ps.Reason = "circuit open"
+			} else if e.providerMgr != nil {
 				stats := e.providerMgr.GetRotatorStats(providerID)
 				if stats != nil {
 					if nextAvail, ok := stats["next_available_in"].(string); ok {
@@ -3,13 +3,24 @@ package task
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/tmalldedede/agentbox/internal/database"
+	"github.com/tmalldedede/agentbox/internal/labels"
 	"gorm.io/gorm"
 )
 
+// priorityOrderExpr 按优先级通道排序（high → normal → low）
+const priorityOrderExpr = "CASE priority WHEN 'high' THEN 0 WHEN 'low' THEN 2 ELSE 1 END"
+
+// deadlineOrderExpr 有截止时间的任务优先，截止时间越近越靠前
+const deadlineOrderExpr = "CASE WHEN deadline IS NULL THEN 1 ELSE 0 END, deadline ASC"
+
+// readyCondition 可调度条件：已到 run_at 且未过截止时间（参数：now, now）
+const readyCondition = "(run_at IS NULL OR run_at <= ?) AND (deadline IS NULL OR deadline > ?)"
+
 // GormStore GORM 存储实现
 type GormStore struct {
 	db *gorm.DB
@@ -18,7 +29,7 @@ type GormStore struct {
 // NewGormStore 创建 GORM 存储
 func NewGormStore(db *gorm.DB) (*GormStore, error) {
 	// AutoMigrate
-	if err := db.AutoMigrate(&database.TaskModel{}); err != nil {
+	if err := db.AutoMigrate(&database.TaskModel{}, &database.LabelModel{}); err != nil {
 		return nil, fmt.Errorf("failed to migrate task table: %w", err)
 	}
 	return &GormStore{db: db}, nil
@@ -27,13 +38,18 @@ func NewGormStore(db *gorm.DB) (*GormStore, error) {
 // Create 创建任务
 func (s *GormStore) Create(task *Task) error {
 	model := taskToModel(task)
-	result := s.db.Create(model)
-	if result.Error != nil {
-		if strings.Contains(result.Error.Error(), "UNIQUE constraint failed") ||
-			strings.Contains(result.Error.Error(), "duplicate key") {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(model).Error; err != nil {
+			return err
+		}
+		return labels.Replace(tx, labels.ResourceTask, task.ID, task.Labels)
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") ||
+			strings.Contains(err.Error(), "duplicate key") {
 			return ErrTaskExists
 		}
-		return result.Error
+		return err
 	}
 	return nil
 }
@@ -51,29 +67,44 @@ func (s *GormStore) Get(id string) (*Task, error) {
 	return modelToTask(&model), nil
 }
 
-// Update 更新任务
+// Update 更新任务（不含标签，标签通过 SetLabels 修改，避免执行中的任务覆盖用户的修改）
 func (s *GormStore) Update(task *Task) error {
 	model := taskToModel(task)
 	result := s.db.Model(&database.TaskModel{}).Where("id = ?", task.ID).Updates(map[string]interface{}{
-		"agent_id":         model.AgentID,
-		"agent_name":       model.AgentName,
-		"agent_type":       model.AgentType,
-		"prompt":           model.Prompt,
-		"attachments_json": model.AttachmentsJSON,
-		"output_files_json": model.OutputFilesJSON,
-		"turns_json":       model.TurnsJSON,
-		"turn_count":       model.TurnCount,
-		"webhook_url":      model.WebhookURL,
-		"timeout":          model.Timeout,
-		"status":           model.Status,
-		"session_id":       model.SessionID,
-		"thread_id":        model.ThreadID,
-		"error_message":    model.ErrorMessage,
-		"result_json":      model.ResultJSON,
-		"metadata_json":    model.MetadataJSON,
-		"queued_at":        model.QueuedAt,
-		"started_at":       model.StartedAt,
-		"completed_at":     model.CompletedAt,
+		"agent_id":            model.AgentID,
+		"agent_name":          model.AgentName,
+		"agent_type":          model.AgentType,
+		"prompt":              model.Prompt,
+		"attachments_json":    model.AttachmentsJSON,
+		"output_files_json":   model.OutputFilesJSON,
+		"turns_json":          model.TurnsJSON,
+		"turn_count":          model.TurnCount,
+		"webhook_url":         model.WebhookURL,
+		"timeout":             model.Timeout,
+		"priority":            model.Priority,
+		"run_at":              model.RunAt,
+		"deadline":            model.Deadline,
+		"retry_json":          model.RetryJSON,
+		"attempts_json":       model.AttemptsJSON,
+		"evaluators_json":     model.EvaluatorsJSON,
+		"evaluation_json":     model.EvaluationJSON,
+		"cache_json":          model.CacheJSON,
+		"cache_hit":           model.CacheHit,
+		"token_budget":        model.TokenBudget,
+		"status":              model.Status,
+		"session_id":          model.SessionID,
+		"thread_id":           model.ThreadID,
+		"instance_id":         model.InstanceID,
+		"error_message":       model.ErrorMessage,
+		"result_json":         model.ResultJSON,
+		"metadata_json":       model.MetadataJSON,
+		"usage_json":          model.UsageJSON,
+		"input_tokens":        model.InputTokens,
+		"cached_input_tokens": model.CachedInputTokens,
+		"output_tokens":       model.OutputTokens,
+		"queued_at":           model.QueuedAt,
+		"started_at":          model.StartedAt,
+		"completed_at":        model.CompletedAt,
 	})
 	if result.Error != nil {
 		return result.Error
@@ -93,7 +124,16 @@ func (s *GormStore) Delete(id string) error {
 	if result.RowsAffected == 0 {
 		return ErrTaskNotFound
 	}
-	return nil
+	return labels.Delete(s.db, labels.ResourceTask, id)
+}
+
+// SetLabels 替换任务的标签
+func (s *GormStore) SetLabels(id string, values map[string]string) error {
+	err := labels.Set(s.db, &database.TaskModel{}, labels.ResourceTask, id, values)
+	if err == gorm.ErrRecordNotFound {
+		return ErrTaskNotFound
+	}
+	return err
 }
 
 // List 列出任务
@@ -144,7 +184,7 @@ func (s *GormStore) Count(filter *ListFilter) (int, error) {
 }
 
 // Stats 获取任务统计
-func (s *GormStore) Stats() (*TaskStats, error) {
+func (s *GormStore) Stats(filter *ListFilter) (*TaskStats, error) {
 	stats := &TaskStats{
 		ByStatus: make(map[Status]int),
 		ByAgent:  make(map[string]int),
@@ -155,7 +195,7 @@ func (s *GormStore) Stats() (*TaskStats, error) {
 		Status string
 		Count  int
 	}
-	if err := s.db.Model(&database.TaskModel{}).
+	if err := s.buildQuery(filter).
 		Select("status, count(*) as count").
 		Group("status").
 		Scan(&statusCounts).Error; err != nil {
@@ -171,7 +211,7 @@ func (s *GormStore) Stats() (*TaskStats, error) {
 		AgentName string
 		Count     int
 	}
-	if err := s.db.Model(&database.TaskModel{}).
+	if err := s.buildQuery(filter).
 		Select("COALESCE(agent_name, agent_id) as agent_name, count(*) as count").
 		Group("agent_id").
 		Order("count DESC").
@@ -188,7 +228,7 @@ func (s *GormStore) Stats() (*TaskStats, error) {
 		StartedAt   time.Time
 		CompletedAt time.Time
 	}
-	if err := s.db.Model(&database.TaskModel{}).
+	if err := s.buildQuery(filter).
 		Select("started_at, completed_at").
 		Where("status = ? AND started_at IS NOT NULL AND completed_at IS NOT NULL", "completed").
 		Limit(1000). // 限制数量避免内存问题
@@ -200,6 +240,29 @@ func (s *GormStore) Stats() (*TaskStats, error) {
 		stats.AvgDuration = totalDuration / float64(len(completedTasks))
 	}
 
+	// Token 使用累计
+	var tokens struct {
+		InputTokens       int64
+		CachedInputTokens int64
+		OutputTokens      int64
+	}
+	if err := s.buildQuery(filter).
+		Select("COALESCE(SUM(input_tokens), 0) as input_tokens, COALESCE(SUM(cached_input_tokens), 0) as cached_input_tokens, COALESCE(SUM(output_tokens), 0) as output_tokens").
+		Scan(&tokens).Error; err != nil {
+		return nil, err
+	}
+	stats.InputTokens = tokens.InputTokens
+	stats.CachedInputTokens = tokens.CachedInputTokens
+	stats.OutputTokens = tokens.OutputTokens
+	stats.TotalTokens = tokens.InputTokens + tokens.OutputTokens
+
+	// 按标签统计
+	byLabel, err := labels.Breakdown(s.db, labels.ResourceTask, s.buildQuery(filter).Select("id"))
+	if err != nil {
+		return nil, err
+	}
+	stats.ByLabel = byLabel
+
 	return stats, nil
 }
 
@@ -219,11 +282,16 @@ func (s *GormStore) Cleanup(before time.Time, statuses []Status) (int, error) {
 	if result.Error != nil {
 		return 0, result.Error
 	}
+	if result.RowsAffected > 0 {
+		if err := labels.Prune(s.db, &database.TaskModel{}, labels.ResourceTask); err != nil {
+			return int(result.RowsAffected), err
+		}
+	}
 	return int(result.RowsAffected), nil
 }
 
 // ClaimQueued 原子领取等待中的任务
-func (s *GormStore) ClaimQueued(limit int) ([]*Task, error) {
+func (s *GormStore) ClaimQueued(limit int, instanceID string) ([]*Task, error) {
 	if limit <= 0 {
 		return []*Task{}, nil
 	}
@@ -235,6 +303,9 @@ func (s *GormStore) ClaimQueued(limit int) ([]*Task, error) {
 		// 查询待处理任务
 		var models []database.TaskModel
 		if err := tx.Where("status = ?", string(StatusQueued)).
+			Where(readyCondition, now, now).
+			Order(priorityOrderExpr).
+			Order(deadlineOrderExpr).
 			Order("created_at ASC").
 			Limit(limit).
 			Find(&models).Error; err != nil {
@@ -246,8 +317,9 @@ func (s *GormStore) ClaimQueued(limit int) ([]*Task, error) {
 			result := tx.Model(&database.TaskModel{}).
 				Where("id = ? AND status = ?", model.ID, string(StatusQueued)).
 				Updates(map[string]interface{}{
-					"status":     string(StatusRunning),
-					"started_at": now,
+					"status":      string(StatusRunning),
+					"started_at":  now,
+					"instance_id": instanceID,
 				})
 			if result.Error != nil {
 				return result.Error
@@ -256,6 +328,7 @@ func (s *GormStore) ClaimQueued(limit int) ([]*Task, error) {
 				task := modelToTask(&model)
 				task.Status = StatusRunning
 				task.StartedAt = &now
+				task.InstanceID = instanceID
 				claimed = append(claimed, task)
 			}
 		}
@@ -268,6 +341,140 @@ func (s *GormStore) ClaimQueued(limit int) ([]*Task, error) {
 	return claimed, nil
 }
 
+// ClaimTasks 原子领取指定的等待中任务（已被其他实例领取的任务会被跳过）
+func (s *GormStore) ClaimTasks(ids []string, instanceID string) ([]*Task, error) {
+	if len(ids) == 0 {
+		return []*Task{}, nil
+	}
+
+	var claimed []*Task
+	now := time.Now()
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for _, id := range ids {
+			result := tx.Model(&database.TaskModel{}).
+				Where("id = ? AND status = ?", id, string(StatusQueued)).
+				Where(readyCondition, now, now).
+				Updates(map[string]interface{}{
+					"status":      string(StatusRunning),
+					"started_at":  now,
+					"instance_id": instanceID,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+
+			var model database.TaskModel
+			if err := tx.First(&model, "id = ?", id).Error; err != nil {
+				return err
+			}
+			claimed = append(claimed, modelToTask(&model))
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// ExpireQueued 原子地将已过截止时间的等待中任务标记为失败
+func (s *GormStore) ExpireQueued(now time.Time, reason string) ([]*Task, error) {
+	var expired []*Task
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var models []database.TaskModel
+		if err := tx.Where("status IN ?", []string{string(StatusPending), string(StatusQueued)}).
+			Where("deadline IS NOT NULL AND deadline <= ?", now).
+			Find(&models).Error; err != nil {
+			return err
+		}
+
+		for _, model := range models {
+			// 条件更新，避免与其他实例的领取 / 过期处理冲突
+			result := tx.Model(&database.TaskModel{}).
+				Where("id = ? AND status = ?", model.ID, model.Status).
+				Updates(map[string]interface{}{
+					"status":        string(StatusFailed),
+					"error_message": reason,
+					"completed_at":  now,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				task := modelToTask(&model)
+				task.Status = StatusFailed
+				task.ErrorMessage = reason
+				task.CompletedAt = &now
+				expired = append(expired, task)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return expired, nil
+}
+
+// UpdateStatus 条件更新任务状态（仅当前状态为 from 时更新），返回是否更新成功
+func (s *GormStore) UpdateStatus(id string, from, to Status) (bool, error) {
+	result := s.db.Model(&database.TaskModel{}).
+		Where("id = ? AND status = ?", id, string(from)).
+		Update("status", string(to))
+	return result.RowsAffected > 0, result.Error
+}
+
+// ListQueueHeads 按（优先级, 用户）分组列出可调度的排队任务
+func (s *GormStore) ListQueueHeads(readyAt time.Time, perGroup int) ([]*Task, error) {
+	ready := func() *gorm.DB {
+		return s.db.Model(&database.TaskModel{}).
+			Where("status = ?", string(StatusQueued)).
+			Where(readyCondition, readyAt, readyAt)
+	}
+
+	var groups []struct {
+		Priority string
+		UserID   string
+	}
+	if err := ready().Distinct("priority", "user_id").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+
+	var tasks []*Task
+	for _, g := range groups {
+		var models []database.TaskModel
+		err := ready().
+			Where("priority = ? AND user_id = ?", g.Priority, g.UserID).
+			Order(deadlineOrderExpr + ", created_at ASC").
+			Limit(perGroup).
+			Find(&models).Error
+		if err != nil {
+			return nil, err
+		}
+		for i := range models {
+			tasks = append(tasks, modelToTask(&models[i]))
+		}
+	}
+	// 调度器要求按创建时间升序（决定用户的首次出现顺序）
+	sort.SliceStable(tasks, func(i, j int) bool { return tasks[i].CreatedAt.Before(tasks[j].CreatedAt) })
+	return tasks, nil
+}
+
+// ReassignInstance 条件更新任务的执行实例
+func (s *GormStore) ReassignInstance(id, from, to string, status Status) (bool, error) {
+	result := s.db.Model(&database.TaskModel{}).
+		Where("id = ? AND instance_id = ? AND status = ?", id, from, string(status)).
+		Update("instance_id", to)
+	return result.RowsAffected > 0, result.Error
+}
+
 // Close 关闭存储
 func (s *GormStore) Close() error {
 	// GORM 由外部管理连接，这里不关闭
@@ -306,6 +513,19 @@ func (s *GormStore) buildQuery(filter *ListFilter) *gorm.DB {
 		query = query.Where("prompt LIKE ?", "%"+filter.Search+"%")
 	}
 
+	// 标签选择器
+	if !filter.Labels.Empty() {
+		query = filter.Labels.Apply(query, labels.ResourceTask, "id")
+	}
+
+	// 可调度时间窗口
+	if filter.ReadyAt != nil {
+		query = query.Where(readyCondition, *filter.ReadyAt, *filter.ReadyAt)
+	}
+	if filter.DeadlineBefore != nil {
+		query = query.Where("deadline IS NOT NULL AND deadline <= ?", *filter.DeadlineBefore)
+	}
+
 	return query
 }
 
@@ -316,8 +536,15 @@ func taskToModel(task *Task) *database.TaskModel {
 	turnsJSON, _ := json.Marshal(task.Turns)
 	resultJSON, _ := json.Marshal(task.Result)
 	metadataJSON, _ := json.Marshal(task.Metadata)
-
-	return &database.TaskModel{
+	usageJSON, _ := json.Marshal(task.Usage)
+	retryJSON, _ := json.Marshal(task.Retry)
+	attemptsJSON, _ := json.Marshal(task.Attempts)
+	evaluatorsJSON, _ := json.Marshal(task.Evaluators)
+	evaluationJSON, _ := json.Marshal(task.Evaluation)
+	cacheJSON, _ := json.Marshal(task.Cache)
+	labelsJSON, _ := json.Marshal(task.Labels)
+
+	model := &database.TaskModel{
 		BaseModel: database.BaseModel{
 			ID:        task.ID,
 			CreatedAt: task.CreatedAt,
@@ -333,16 +560,37 @@ func taskToModel(task *Task) *database.TaskModel {
 		TurnCount:       task.TurnCount,
 		WebhookURL:      task.WebhookURL,
 		Timeout:         task.Timeout,
+		Priority:        string(task.Priority),
+		RunAt:           task.RunAt,
+		Deadline:        task.Deadline,
+		RetryJSON:       string(retryJSON),
+		AttemptsJSON:    string(attemptsJSON),
+		TemplateID:      task.TemplateID,
+		TemplateVersion: task.TemplateVersion,
+		EvaluatorsJSON:  string(evaluatorsJSON),
+		EvaluationJSON:  string(evaluationJSON),
+		CacheJSON:       string(cacheJSON),
+		CacheHit:        task.CacheHit,
+		TokenBudget:     task.TokenBudget,
 		Status:          string(task.Status),
 		SessionID:       task.SessionID,
 		ThreadID:        task.ThreadID,
+		InstanceID:      task.InstanceID,
 		ErrorMessage:    task.ErrorMessage,
 		ResultJSON:      string(resultJSON),
 		MetadataJSON:    string(metadataJSON),
+		LabelsJSON:      string(labelsJSON),
 		QueuedAt:        task.QueuedAt,
 		StartedAt:       task.StartedAt,
 		CompletedAt:     task.CompletedAt,
+		UsageJSON:       string(usageJSON),
 	}
+	if task.Usage != nil {
+		model.InputTokens = task.Usage.InputTokens
+		model.CachedInputTokens = task.Usage.CachedInputTokens
+		model.OutputTokens = task.Usage.OutputTokens
+	}
+	return model
 }
 
 // modelToTask 将 TaskModel 转换为 Task
@@ -357,14 +605,23 @@ func modelToTask(model *database.TaskModel) *Task {
 		TurnCount:    model.TurnCount,
 		WebhookURL:   model.WebhookURL,
 		Timeout:      model.Timeout,
+		Priority:     Priority(model.Priority),
+		RunAt:        model.RunAt,
+		Deadline:     model.Deadline,
 		Status:       Status(model.Status),
 		SessionID:    model.SessionID,
 		ThreadID:     model.ThreadID,
+		InstanceID:   model.InstanceID,
 		ErrorMessage: model.ErrorMessage,
 		CreatedAt:    model.CreatedAt,
 		QueuedAt:     model.QueuedAt,
 		StartedAt:    model.StartedAt,
 		CompletedAt:  model.CompletedAt,
+		CacheHit:     model.CacheHit,
+
+		TemplateID:      model.TemplateID,
+		TemplateVersion: model.TemplateVersion,
+		TokenBudget:     model.TokenBudget,
 	}
 
 	// 解析 JSON 字段
@@ -383,6 +640,27 @@ func modelToTask(model *database.TaskModel) *Task {
 	if model.MetadataJSON != "" && model.MetadataJSON != "null" {
 		json.Unmarshal([]byte(model.MetadataJSON), &task.Metadata)
 	}
+	if model.UsageJSON != "" && model.UsageJSON != "null" {
+		json.Unmarshal([]byte(model.UsageJSON), &task.Usage)
+	}
+	if model.RetryJSON != "" && model.RetryJSON != "null" {
+		json.Unmarshal([]byte(model.RetryJSON), &task.Retry)
+	}
+	if model.AttemptsJSON != "" && model.AttemptsJSON != "null" {
+		json.Unmarshal([]byte(model.AttemptsJSON), &task.Attempts)
+	}
+	if model.EvaluatorsJSON != "" && model.EvaluatorsJSON != "null" {
+		json.Unmarshal([]byte(model.EvaluatorsJSON), &task.Evaluators)
+	}
+	if model.EvaluationJSON != "" && model.EvaluationJSON != "null" {
+		json.Unmarshal([]byte(model.EvaluationJSON), &task.Evaluation)
+	}
+	if model.CacheJSON != "" && model.CacheJSON != "null" {
+		json.Unmarshal([]byte(model.CacheJSON), &task.Cache)
+	}
+	if model.LabelsJSON != "" && model.LabelsJSON != "null" {
+		json.Unmarshal([]byte(model.LabelsJSON), &task.Labels)
+	}
 
 	return task
 }
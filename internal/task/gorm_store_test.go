@@ -6,6 +6,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tmalldedede/agentbox/internal/labels"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	gormlogger "gorm.io/gorm/logger"
@@ -300,7 +301,7 @@ func TestGormStore_Stats(t *testing.T) {
 		require.NoError(t, store.Create(task))
 	}
 
-	stats, err := store.Stats()
+	stats, err := store.Stats(nil)
 	require.NoError(t, err)
 
 	assert.Equal(t, 3, stats.Total)
@@ -361,7 +362,7 @@ func TestGormStore_ClaimQueued(t *testing.T) {
 	}
 
 	// Claim 2 tasks
-	claimed, err := store.ClaimQueued(2)
+	claimed, err := store.ClaimQueued(2, "instance-a")
 	require.NoError(t, err)
 	assert.Len(t, claimed, 2)
 
@@ -369,6 +370,7 @@ func TestGormStore_ClaimQueued(t *testing.T) {
 	for _, task := range claimed {
 		assert.Equal(t, StatusRunning, task.Status)
 		assert.NotNil(t, task.StartedAt)
+		assert.Equal(t, "instance-a", task.InstanceID)
 	}
 
 	// Verify only 3 queued tasks remain
@@ -377,11 +379,37 @@ func TestGormStore_ClaimQueued(t *testing.T) {
 	assert.Len(t, remaining, 3)
 
 	// Claim with limit 0 returns empty
-	claimed, err = store.ClaimQueued(0)
+	claimed, err = store.ClaimQueued(0, "instance-a")
 	require.NoError(t, err)
 	assert.Len(t, claimed, 0)
 }
 
+func TestGormStore_ListQueueHeads(t *testing.T) {
+	db := setupTestDB(t)
+	store, err := NewGormStore(db)
+	require.NoError(t, err)
+
+	// alice 早先提交了大量低优先级任务，bob 随后提交了一个高优先级任务
+	base := time.Now().Add(-time.Hour)
+	tasks := append(queuedTasks("alice", "agent-1", PriorityLow, 5, base),
+		queuedTasks("bob", "agent-1", PriorityHigh, 1, base.Add(time.Minute))...)
+	deadline := time.Now().Add(time.Hour)
+	tasks[4].Deadline = &deadline
+	for _, task := range tasks {
+		task.Prompt = "test"
+		require.NoError(t, store.Create(task))
+	}
+
+	heads, err := store.ListQueueHeads(time.Now(), 2)
+	require.NoError(t, err)
+	var ids []string
+	for _, task := range heads {
+		ids = append(ids, task.ID)
+	}
+	// 每组取 2 个：截止时间近的优先，其余 FIFO；结果按创建时间升序
+	assert.Equal(t, []string{"alice-low-0", "alice-low-4", "bob-high-0"}, ids)
+}
+
 func TestGormStore_JSONFields(t *testing.T) {
 	db := setupTestDB(t)
 	store, err := NewGormStore(db)
@@ -442,3 +470,61 @@ func TestGormStore_Close(t *testing.T) {
 	err = store.Close()
 	assert.NoError(t, err)
 }
+
+func TestGormStore_Labels(t *testing.T) {
+	db := setupTestDB(t)
+	store, err := NewGormStore(db)
+	require.NoError(t, err)
+
+	now := time.Now()
+	for _, task := range []*Task{
+		{ID: "t1", AgentID: "a", Prompt: "p", Status: StatusCompleted, CreatedAt: now, Labels: map[string]string{"project": "billing", "ticket": "BIL-1"}},
+		{ID: "t2", AgentID: "a", Prompt: "p", Status: StatusFailed, CreatedAt: now, Labels: map[string]string{"project": "billing"}},
+		{ID: "t3", AgentID: "a", Prompt: "p", Status: StatusCompleted, CreatedAt: now, Labels: map[string]string{"project": "search"}},
+		{ID: "t4", AgentID: "a", Prompt: "p", Status: StatusCompleted, CreatedAt: now},
+	} {
+		require.NoError(t, store.Create(task))
+	}
+
+	ids := func(selector string) []string {
+		sel, err := labels.Parse(selector)
+		require.NoError(t, err)
+		filter := &ListFilter{Labels: sel, OrderBy: "id"}
+		tasks, err := store.List(filter)
+		require.NoError(t, err)
+		count, err := store.Count(filter)
+		require.NoError(t, err)
+		require.Equal(t, len(tasks), count)
+		var out []string
+		for _, task := range tasks {
+			out = append(out, task.ID)
+		}
+		return out
+	}
+	assert.Equal(t, []string{"t1", "t2"}, ids("project=billing"))
+	assert.Equal(t, []string{"t1"}, ids("project=billing,ticket"))
+	assert.Equal(t, []string{"t2", "t3", "t4"}, ids("!ticket"))
+	assert.Equal(t, []string{"t3", "t4"}, ids("project!=billing"))
+	assert.Equal(t, []string{"t1", "t2", "t3"}, ids("project in (billing, search)"))
+
+	// 标签单独修改，Update 不覆盖
+	require.NoError(t, store.SetLabels("t4", map[string]string{"project": "search"}))
+	stale, err := store.Get("t4")
+	require.NoError(t, err)
+	stale.Labels = nil
+	require.NoError(t, store.Update(stale))
+	got, err := store.Get("t4")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"project": "search"}, got.Labels)
+	assert.Equal(t, ErrTaskNotFound, store.SetLabels("missing", nil))
+
+	sel, _ := labels.Parse("project")
+	stats, err := store.Stats(&ListFilter{Labels: sel, Status: []Status{StatusCompleted}})
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.Total)
+	assert.Equal(t, map[string]int{"billing": 1, "search": 2}, stats.ByLabel["project"])
+	assert.Equal(t, map[string]int{"BIL-1": 1}, stats.ByLabel["ticket"])
+
+	require.NoError(t, store.Delete("t1"))
+	assert.Equal(t, []string{"t2"}, ids("project=billing"))
+}
@@ -16,7 +16,10 @@ import (
 	"github.com/google/uuid"
 	"github.com/tmalldedede/agentbox/internal/agent"
 	"github.com/tmalldedede/agentbox/internal/apperr"
+	"github.com/tmalldedede/agentbox/internal/eval"
+	"github.com/tmalldedede/agentbox/internal/labels"
 	"github.com/tmalldedede/agentbox/internal/logger"
+	"github.com/tmalldedede/agentbox/internal/resultcache"
 	"github.com/tmalldedede/agentbox/internal/session"
 )
 
@@ -45,8 +48,10 @@ type Manager struct {
 	sessionMgr *session.Manager
 
 	// 调度配置
-	maxConcurrent int           // 最大并发任务数
+	maxConcurrent int           // 最大并发任务数（调度策略未配置时的默认值）
 	pollInterval  time.Duration // 轮询间隔
+	policyFunc    PolicyFunc    // 调度策略提供者（优先级 / 公平调度）
+	fair          *fairScheduler
 
 	// Idle timeout 配置
 	idleTimeout time.Duration          // 默认 30 分钟
@@ -58,8 +63,10 @@ type Manager struct {
 	webhookClient   *http.Client
 
 	// 文件管理
-	fileBinder       FileBindFunc // 创建 task 时绑定附件
-	filePathResolver FilePathFunc // 根据 fileID 解析磁盘路径
+	fileBinder       FileBindFunc           // 创建 task 时绑定附件
+	filePathResolver FilePathFunc           // 根据 fileID 解析磁盘路径
+	outputRegistrar  OutputFileRegisterFunc // 登记每轮产出的输出文件
+	outputRemover    OutputFileRemoveFunc   // 删除被后续轮次覆盖的输出文件
 
 	// 运行时状态
 	ctx       context.Context
@@ -78,12 +85,46 @@ type Manager struct {
 	// Provider Fallback 执行器
 	fallbackExecutor *FallbackExecutor
 	providerMgr      ProviderKeyManager
+	providerHealth   ProviderHealth // Provider 熔断器（可选）
+
+	// 执行历史（每轮记录 token 使用）
+	historyRecorder HistoryRecorder
+
+	// 工作流 (DAG)
+	workflowStore WorkflowStore
+	workflowMu    sync.Mutex // 串行推进工作流运行状态
+
+	// 事件日志（SSE 断线续传 / 历史回放）
+	eventStore     EventStore
+	eventRetention RetentionFunc
+
+	// 工具审批（human-in-the-loop）
+	approvalStore    ApprovalStore
+	approvalEndpoint string
+	approvals        *approvalBroker
+
+	// 任务模板
+	templateStore TemplateStore
+
+	// 结果评估（LLM 评审）
+	evalJudge eval.Judge
+
+	// 全文检索索引
+	searchIndexer SearchIndexer
+
+	// 多实例协调（任务归属实例、接管已停止实例的任务）
+	cluster Cluster
+
+	// 结果缓存（任务显式开启时使用）
+	resultCache *resultcache.Cache
 }
 
 // TaskEvent SSE 事件
 type TaskEvent struct {
-	Type string      `json:"type"` // task.started, agent.thinking, agent.tool_call, agent.message, task.completed, task.failed
-	Data interface{} `json:"data,omitempty"`
+	Seq       int64       `json:"seq,omitempty"` // 任务内单调递增的序号（配置事件日志后分配，用作 SSE id）
+	Type      string      `json:"type"`          // task.started, agent.thinking, agent.tool_call, agent.message, task.completed, task.failed
+	Data      interface{} `json:"data,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
 }
 
 // ManagerConfig 管理器配置
@@ -124,6 +165,7 @@ func NewManager(store Store, agentMgr *agent.Manager, sessionMgr *session.Manage
 		sessionMgr:    sessionMgr,
 		maxConcurrent: cfg.MaxConcurrent,
 		pollInterval:  cfg.PollInterval,
+		fair:          newFairScheduler(),
 		idleTimeout:   cfg.IdleTimeout,
 		idleTimers:    make(map[string]*time.Timer),
 		webhookClient: &http.Client{Timeout: 10 * time.Second},
@@ -132,6 +174,7 @@ func NewManager(store Store, agentMgr *agent.Manager, sessionMgr *session.Manage
 		running:       make(map[string]context.CancelFunc),
 		laneQueue:     NewLaneQueue(nil), // 使用默认配置
 		eventSubs:     make(map[string][]chan *TaskEvent),
+		approvals:     newApprovalBroker(),
 	}
 }
 
@@ -156,6 +199,8 @@ func (m *Manager) SetProviderManager(mgr ProviderKeyManager) {
 	// 如果 fallback executor 还没有初始化，现在初始化
 	if m.fallbackExecutor == nil && m.agentMgr != nil && m.sessionMgr != nil {
 		m.fallbackExecutor = NewFallbackExecutor(m.agentMgr, mgr, m.sessionMgr)
+		m.fallbackExecutor.prepareExec = m.prepareApproval
+		m.fallbackExecutor.health = m.providerHealth
 	}
 }
 
@@ -170,8 +215,13 @@ func (m *Manager) GetFallbackStats() map[string]interface{} {
 // Start 启动调度器
 func (m *Manager) Start() {
 	m.recoverStuckTasks()
+	m.resumeWorkflowRuns()
 	m.wg.Add(1)
 	go m.scheduler()
+	if m.eventStore != nil {
+		m.wg.Add(1)
+		go m.eventJanitor()
+	}
 	log.Info("task manager started", "max_concurrent", m.maxConcurrent, "poll_interval", m.pollInterval)
 }
 
@@ -191,53 +241,79 @@ func (m *Manager) Stop() {
 }
 
 // recoverStuckTasks 在启动时清理异常 running 任务
+//
+// 多实例部署时只处理本实例（上一次运行）及已停止心跳的实例的任务，其他实例仍在执行的任务不受影响。
 func (m *Manager) recoverStuckTasks() {
 	if m.sessionMgr == nil {
 		log.Warn("recoverStuckTasks: sessionMgr is nil, skipping recovery")
 		return
 	}
 
-	tasks, err := m.store.List(&ListFilter{Status: []Status{StatusRunning}})
+	tasks, err := m.store.List(&ListFilter{Status: []Status{StatusRunning, StatusWaitingApproval}})
 	if err != nil {
 		log.Error("recoverStuckTasks: failed to list running tasks", "error", err)
 		return
 	}
 
-	if len(tasks) == 0 {
-		return
+	for _, task := range tasks {
+		if m.cluster != nil && task.InstanceID != m.instanceID() && m.cluster.Alive(task.InstanceID) {
+			continue
+		}
+		m.recoverTask(task, false)
 	}
+}
 
+// recoverTask 处理执行被中断的任务：超时的标记失败，其余重新入队
+//
+// orphaned 为 true 表示所属实例已停止心跳：Session 无人跟进，即使仍在运行也重新入队，
+// 多轮任务在轮次之间（已有结果）则直接完成。
+func (m *Manager) recoverTask(task *Task, orphaned bool) {
 	now := time.Now()
-	for _, task := range tasks {
-		// 超时任务直接标记失败
-		timeout := task.Timeout
-		if timeout <= 0 {
-			timeout = 1800 // 默认 30 分钟
-		}
-		if task.StartedAt != nil {
-			grace := 300 * time.Second
-			if now.Sub(*task.StartedAt) > time.Duration(timeout)*time.Second+grace {
-				task.Status = StatusFailed
-				task.ErrorMessage = "task timed out during recovery"
-				task.CompletedAt = &now
-				if err := m.store.Update(task); err != nil {
-					log.Error("recoverStuckTasks: failed to mark task failed", "task_id", task.ID, "error", err)
-				} else {
-					log.Warn("recoverStuckTasks: marked task failed", "task_id", task.ID)
-				}
-				continue
+
+	// 超时任务直接标记失败
+	timeout := task.Timeout
+	if timeout <= 0 {
+		timeout = 1800 // 默认 30 分钟
+	}
+	if task.StartedAt != nil {
+		grace := 300 * time.Second
+		if now.Sub(*task.StartedAt) > time.Duration(timeout)*time.Second+grace {
+			task.Status = StatusFailed
+			task.ErrorMessage = "task timed out during recovery"
+			task.CompletedAt = &now
+			if err := m.store.Update(task); err != nil {
+				log.Error("recoverStuckTasks: failed to mark task failed", "task_id", task.ID, "error", err)
+			} else {
+				log.Warn("recoverStuckTasks: marked task failed", "task_id", task.ID)
 			}
+			return
 		}
+	}
 
-		// 无 session 或 session 非运行状态 -> 重新入队
-		if task.SessionID == "" {
-			m.requeueTask(task, "missing session_id")
-			continue
-		}
-		sess, err := m.sessionMgr.Get(context.Background(), task.SessionID)
-		if err != nil || sess.Status != session.StatusRunning {
-			m.requeueTask(task, "session not running")
+	// 等待审批的执行随进程退出中断 -> 重新入队
+	if task.Status == StatusWaitingApproval {
+		m.cancelApprovals(task.ID, "approval wait interrupted by restart")
+		m.requeueTask(task, "approval wait interrupted")
+		return
+	}
+
+	if orphaned {
+		if n := len(task.Turns); n > 0 && task.Turns[n-1].Result != nil {
+			m.completeTask(task.ID, "owner instance lost")
+			return
 		}
+		m.requeueTask(task, "owner instance lost")
+		return
+	}
+
+	// 无 session 或 session 非运行状态 -> 重新入队
+	if task.SessionID == "" {
+		m.requeueTask(task, "missing session_id")
+		return
+	}
+	sess, err := m.sessionMgr.Get(context.Background(), task.SessionID)
+	if err != nil || sess.Status != session.StatusRunning {
+		m.requeueTask(task, "session not running")
 	}
 }
 
@@ -250,6 +326,7 @@ func (m *Manager) requeueTask(task *Task, reason string) {
 	task.ErrorMessage = ""
 	task.SessionID = ""
 	task.ThreadID = ""
+	task.InstanceID = ""
 
 	if err := m.store.Update(task); err != nil {
 		log.Error("requeueTask: failed", "task_id", task.ID, "reason", reason, "error", err)
@@ -270,25 +347,60 @@ func (m *Manager) scheduler() {
 		case <-m.ctx.Done():
 			return
 		case <-ticker.C:
+			m.enforceDeadlines()
 			m.scheduleNext()
 		}
 	}
 }
 
-// scheduleNext 调度下一个任务
+// scheduleNext 调度下一批任务（优先级通道 + 用户间加权轮询 + 并发上限）
 func (m *Manager) scheduleNext() {
+	policy := m.schedulingPolicy()
+
 	m.runningMu.Lock()
 	currentRunning := len(m.running)
 	m.runningMu.Unlock()
 
-	if currentRunning >= m.maxConcurrent {
+	if currentRunning >= policy.MaxConcurrent {
+		return
+	}
+
+	limit := policy.MaxConcurrent - currentRunning
+
+	// 只考虑已到 run_at 且未过截止时间的任务
+	now := time.Now()
+	queued, err := m.store.ListQueueHeads(now, schedulerWindow)
+	if err != nil {
+		log.Error("failed to list queued tasks", "error", err)
+		return
+	}
+	// 跳过 Provider 链全部熔断的任务
+	queued = m.filterCircuitOpen(queued)
+	if len(queued) == 0 {
 		return
 	}
 
-	limit := m.maxConcurrent - currentRunning
+	// 单用户 / 单 Agent 上限按全局 running 任务计算（多实例共享）
+	var running []*Task
+	if policy.MaxPerUser > 0 || policy.MaxPerAgent > 0 {
+		running, err = m.store.List(&ListFilter{Status: []Status{StatusRunning, StatusWaitingApproval}})
+		if err != nil {
+			log.Error("failed to list running tasks", "error", err)
+			return
+		}
+	}
 
-	// 原子领取等待中的任务（避免多实例重复执行）
-	tasks, err := m.store.ClaimQueued(limit)
+	picked := m.fair.pick(queued, running, policy, limit)
+	if len(picked) == 0 {
+		return
+	}
+	ids := make([]string, len(picked))
+	for i, t := range picked {
+		ids[i] = t.ID
+	}
+
+	// 原子领取选中的任务（避免多实例重复执行）
+	tasks, err := m.store.ClaimTasks(ids, m.instanceID())
 	if err != nil {
 		log.Error("failed to claim queued tasks", "error", err)
 		return
@@ -296,7 +408,7 @@ func (m *Manager) scheduleNext() {
 
 	for _, task := range tasks {
 		m.runningMu.Lock()
-		if len(m.running) >= m.maxConcurrent {
+		if len(m.running) >= policy.MaxConcurrent {
 			m.runningMu.Unlock()
 			break
 		}
@@ -310,9 +422,13 @@ func (m *Manager) scheduleNext() {
 // CreateTaskRequest 创建任务请求（简化版）
 type CreateTaskRequest struct {
 	// 核心字段
-	AgentID string `json:"agent_id,omitempty"` // 首次创建时必填
-	Prompt  string `json:"prompt" binding:"required"`
-	TaskID  string `json:"task_id,omitempty"` // 多轮时传入已有 task_id
+	AgentID string `json:"agent_id,omitempty"` // 首次创建时必填（使用模板时由模板决定）
+	Prompt  string `json:"prompt,omitempty"`   // 不使用模板时必填
+	TaskID  string `json:"task_id,omitempty"`  // 多轮时传入已有 task_id
+
+	// 任务模板（与 Prompt 二选一）
+	TemplateID string                 `json:"template_id,omitempty"`
+	Params     map[string]interface{} `json:"params,omitempty"` // 模板参数
 
 	// 归属用户
 	UserID string `json:"-"` // 由中间件注入，不从请求体读取
@@ -323,20 +439,51 @@ type CreateTaskRequest struct {
 	// 可选配置
 	WebhookURL string            `json:"webhook_url,omitempty"`
 	Timeout    int               `json:"timeout,omitempty"`
+	Priority   Priority          `json:"priority,omitempty"` // high / normal / low，默认 normal
+	RunAt      *time.Time        `json:"run_at,omitempty"`   // 最早开始时间，为空表示立即调度
+	Deadline   *time.Time        `json:"deadline,omitempty"` // 截止时间，过期未开始则失败、执行中则取消
 	Metadata   map[string]string `json:"metadata,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"` // 标签（key=value），可按标签选择器过滤
+
+	// 自动重试策略（覆盖 Agent 的策略，max_attempts <= 1 表示不重试）
+	Retry *agent.RetryPolicy `json:"retry,omitempty"`
+
+	// 结果评估器（与 Agent / 模板的评估器一起在执行成功后运行）
+	Evaluators []eval.Evaluator `json:"evaluators,omitempty"`
+
+	// 结果缓存：相同 Agent 配置、提示词与附件内容的任务直接复用结果（命中时单轮完成，不计成本）
+	Cache *resultcache.Policy `json:"cache,omitempty"`
+
+	// LLM 代理的 Token 预算（输入 + 输出，任务所有会话共享；未启用代理时不生效，0 表示不限）
+	TokenBudget int64 `json:"token_budget,omitempty"`
 }
 
 // CreateTask 创建任务（或追加多轮）
 func (m *Manager) CreateTask(req *CreateTaskRequest) (*Task, error) {
 	// 多轮追加：传了 TaskID
 	if req.TaskID != "" {
+		if req.TemplateID != "" {
+			return nil, apperr.BadRequest("template_id cannot be used when appending a turn")
+		}
 		return m.appendTurn(req)
 	}
 
+	// 从模板创建：渲染 prompt 并绑定 Agent
+	var tpl *TaskTemplate
+	if req.TemplateID != "" {
+		var err error
+		if tpl, err = m.applyTemplate(req); err != nil {
+			return nil, err
+		}
+	}
+
 	// 新建任务
 	if req.AgentID == "" {
 		return nil, apperr.BadRequestf("agent_id is required for new task")
 	}
+	if req.Prompt == "" {
+		return nil, apperr.BadRequestf("prompt is required for new task")
+	}
 
 	ag, err := m.agentMgr.Get(req.AgentID)
 	if err != nil {
@@ -346,7 +493,35 @@ func (m *Manager) CreateTask(req *CreateTaskRequest) (*Task, error) {
 		return nil, apperr.BadRequestf("agent is inactive: %s", req.AgentID)
 	}
 
+	priority := req.Priority
+	if priority == "" {
+		priority = PriorityNormal
+	}
+	if !priority.IsValid() {
+		return nil, apperr.BadRequestf("invalid priority: %s (expected high, normal or low)", req.Priority)
+	}
+
 	now := time.Now()
+	if err := validateSchedule(req.RunAt, req.Deadline, now); err != nil {
+		return nil, err
+	}
+	if req.Retry != nil {
+		if err := req.Retry.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if err := eval.Validate(req.Evaluators); err != nil {
+		return nil, apperr.BadRequest(err.Error())
+	}
+	if err := resultcache.Validate(req.Cache); err != nil {
+		return nil, apperr.BadRequest(err.Error())
+	}
+	if req.TokenBudget < 0 {
+		return nil, apperr.BadRequest("token_budget must not be negative")
+	}
+	if err := labels.Validate(req.Labels); err != nil {
+		return nil, err
+	}
 	task := &Task{
 		ID:          "task-" + uuid.New().String()[:8],
 		UserID:      req.UserID,
@@ -365,9 +540,22 @@ func (m *Manager) CreateTask(req *CreateTaskRequest) (*Task, error) {
 		},
 		WebhookURL: req.WebhookURL,
 		Timeout:    req.Timeout,
+		Priority:   priority,
+		RunAt:      req.RunAt,
+		Deadline:   req.Deadline,
+		Retry:      req.Retry,
+		Evaluators: req.Evaluators,
+		Cache:      req.Cache,
 		Status:     StatusPending,
 		Metadata:   req.Metadata,
+		Labels:     req.Labels,
 		CreatedAt:  now,
+
+		TokenBudget: req.TokenBudget,
+	}
+	if tpl != nil {
+		task.TemplateID = tpl.ID
+		task.TemplateVersion = tpl.Version
 	}
 
 	// 保存到数据库
@@ -398,6 +586,10 @@ func (m *Manager) CreateTask(req *CreateTaskRequest) (*Task, error) {
 
 // appendTurn 追加对话轮次（多轮对话）— 同步部分立即返回，异步执行 Agent
 func (m *Manager) appendTurn(req *CreateTaskRequest) (*Task, error) {
+	if req.Prompt == "" {
+		return nil, apperr.BadRequestf("prompt is required")
+	}
+
 	task, err := m.store.Get(req.TaskID)
 	if err != nil {
 		return nil, err
@@ -412,6 +604,9 @@ func (m *Manager) appendTurn(req *CreateTaskRequest) (*Task, error) {
 	if task.SessionID == "" {
 		return nil, apperr.BadRequestf("task %s has no active session", task.ID)
 	}
+	if task.Deadline != nil && !time.Now().Before(*task.Deadline) {
+		return nil, apperr.BadRequestf("task %s is past its deadline", task.ID)
+	}
 
 	// 停止 idle timer（新的轮次进来了）
 	m.stopIdleTimer(task.ID)
@@ -428,6 +623,7 @@ func (m *Manager) appendTurn(req *CreateTaskRequest) (*Task, error) {
 	task.TurnCount = len(task.Turns)
 	task.Status = StatusRunning
 	task.Prompt = req.Prompt
+	task.InstanceID = m.instanceID() // 由本实例执行该轮次（idle timer 也在本实例）
 
 	if err := m.store.Update(task); err != nil {
 		return nil, fmt.Errorf("failed to save turn: %w", err)
@@ -453,6 +649,8 @@ func (m *Manager) executeTurn(taskID, turnID, prompt string) {
 		return
 	}
 
+	startedAt := time.Now()
+
 	// 广播事件
 	m.broadcastEvent(taskID, &TaskEvent{Type: "task.turn_started", Data: map[string]interface{}{
 		"turn_id": turnID,
@@ -464,14 +662,31 @@ func (m *Manager) executeTurn(taskID, turnID, prompt string) {
 		timeout = 1800
 	}
 
-	execResp, err := m.sessionMgr.Exec(m.ctx, task.SessionID, &session.ExecRequest{
+	// 执行前为工作区拍快照，用于收集本轮输出文件
+	ag, _ := m.agentMgr.Get(task.AgentID)
+	var tracker *outputTracker
+	if workspace, err := m.sessionMgr.GetWorkspace(task.SessionID); err == nil {
+		tracker = newOutputTracker(ag, workspace)
+	}
+
+	execReq := &session.ExecRequest{
 		Prompt:   prompt,
 		Timeout:  timeout,
 		ThreadID: task.ThreadID, // 传递 Thread ID 用于 resume 多轮对话
-	})
+	}
+	release, err := m.prepareApproval(task, ag, execReq)
+	if err != nil {
+		log.Error("executeTurn: approval unavailable", "task_id", taskID, "turn_id", turnID, "error", err)
+		m.updateTurnResult(taskID, turnID, &Result{Text: "exec error: " + err.Error()})
+		m.recordTurnHistory(task, turnID, prompt, startedAt, nil, err)
+		return
+	}
+	execResp, err := m.sessionMgr.Exec(m.ctx, task.SessionID, execReq)
+	release()
 	if err != nil {
 		log.Error("executeTurn: exec failed", "task_id", taskID, "turn_id", turnID, "error", err)
 		m.updateTurnResult(taskID, turnID, &Result{Text: "exec error: " + err.Error()})
+		m.recordTurnHistory(task, turnID, prompt, startedAt, nil, err)
 		return
 	}
 
@@ -498,13 +713,18 @@ func (m *Manager) executeTurn(taskID, turnID, prompt string) {
 	if err != nil {
 		m.updateTurnResult(taskID, turnID, &Result{Text: err.Error()})
 	} else {
+		applyTokenUsage(result, execResp.Usage)
+		result.Files = m.collectOutputFiles(taskID, tracker)
 		m.updateTurnResult(taskID, turnID, result)
 		m.broadcastEvent(taskID, &TaskEvent{Type: "agent.message", Data: map[string]interface{}{
 			"turn_id": turnID,
 			"text":    result.Text,
 		}})
+		m.evaluateTurn(taskID, ag, prompt)
 	}
 
+	m.recordTurnHistory(task, turnID, prompt, startedAt, result, err)
+
 	// 重置 idle timer
 	m.resetIdleTimer(taskID)
 }
@@ -524,6 +744,8 @@ func (m *Manager) updateTurnResult(taskID, turnID string, result *Result) {
 		}
 	}
 	task.Result = result // 最新结果
+	m.replaceOutputFiles(task, result.Files)
+	task.refreshUsage()
 
 	if err := m.store.Update(task); err != nil {
 		log.Error("updateTurnResult: failed to update", "task_id", taskID, "error", err)
@@ -542,6 +764,11 @@ func (m *Manager) ListTasks(filter *ListFilter) ([]*Task, error) {
 
 // CancelTask 取消任务
 func (m *Manager) CancelTask(id string) error {
+	return m.cancelTask(id, "")
+}
+
+// cancelTask 取消任务，reason 非空时记录为取消原因（如截止时间已过）
+func (m *Manager) cancelTask(id, reason string) error {
 	task, err := m.store.Get(id)
 	if err != nil {
 		return err
@@ -567,15 +794,28 @@ func (m *Manager) CancelTask(id string) error {
 		m.sessionMgr.Stop(context.Background(), task.SessionID)
 	}
 
+	// 取消待审批的工具调用
+	m.cancelApprovals(id, "task cancelled")
+
 	// 更新状态
 	task.Status = StatusCancelled
 	now := time.Now()
 	task.CompletedAt = &now
 
 	// 广播事件
-	m.broadcastEvent(id, &TaskEvent{Type: "task.cancelled"})
+	event := &TaskEvent{Type: "task.cancelled"}
+	if reason != "" {
+		task.ErrorMessage = reason
+		event.Data = map[string]interface{}{"reason": reason}
+	}
+	m.broadcastEvent(id, event)
 
-	return m.store.Update(task)
+	if err := m.store.Update(task); err != nil {
+		return err
+	}
+	m.removeAttemptWorkspaces(task)
+	m.notifyWorkflow(task)
+	return nil
 }
 
 // SubscribeEvents 订阅任务事件
@@ -607,6 +847,17 @@ func (m *Manager) UnsubscribeEvents(taskID string, ch <-chan *TaskEvent) {
 
 // broadcastEvent 广播事件到所有订阅者
 func (m *Manager) broadcastEvent(taskID string, event *TaskEvent) {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	// 先持久化再推送，保证订阅者收到的事件都可回放
+	if m.eventStore != nil {
+		if err := m.eventStore.Append(taskID, event); err != nil {
+			log.Warn("failed to persist task event", "task_id", taskID, "event_type", event.Type, "error", err)
+		}
+	}
+
 	m.eventSubsMu.RLock()
 	subCount := len(m.eventSubs[taskID])
 	m.eventSubsMu.RUnlock()
@@ -674,17 +925,46 @@ func (m *Manager) executeTask(task *Task) {
 	})
 	<-done // 等待 lane 执行完成
 
+	if err != nil && ctx.Err() == nil && circuitOpenOnly(err) && m.requeueCircuitOpen(task) {
+		m.runningMu.Lock()
+		delete(m.running, task.ID)
+		m.runningMu.Unlock()
+		cancel()
+		return
+	}
+
+	firstTurnID := ""
+	if len(task.Turns) > 0 {
+		firstTurnID = task.Turns[0].ID
+	}
+	if err != nil {
+		m.recordTurnHistory(task, firstTurnID, task.Prompt, now, fallbackFailureResult(err), err)
+	} else {
+		m.recordTurnHistory(task, firstTurnID, task.Prompt, now, task.Result, nil)
+	}
+
+	// 按重试策略重新入队
+	if err != nil && m.handleAttemptFailure(ctx, task, err, now) {
+		m.runningMu.Lock()
+		delete(m.running, task.ID)
+		m.runningMu.Unlock()
+		cancel()
+		return
+	}
+
 	if err != nil {
 		// 执行失败 → 终态
 		completedAt := time.Now()
 		task.CompletedAt = &completedAt
 		task.Status = StatusFailed
-		task.ErrorMessage = err.Error()
-		log.Error("task failed", "task_id", task.ID, "error", err)
+		task.ErrorMessage = failureMessage(task, err)
+		log.Error("task failed", "task_id", task.ID, "attempts", len(task.Attempts), "error", err)
 
-		m.broadcastEvent(task.ID, &TaskEvent{Type: "task.failed", Data: map[string]interface{}{
-			"error": err.Error(),
-		}})
+		data := map[string]interface{}{"error": task.ErrorMessage}
+		if len(task.Attempts) > 0 {
+			data["attempts"] = task.Attempts
+		}
+		m.broadcastEvent(task.ID, &TaskEvent{Type: "task.failed", Data: data})
 
 		// 清理
 		m.runningMu.Lock()
@@ -695,18 +975,38 @@ func (m *Manager) executeTask(task *Task) {
 		if err := m.store.Update(task); err != nil {
 			log.Error("failed to update task result", "task_id", task.ID, "error", err)
 		}
+		m.removeAttemptWorkspaces(task)
 
 		if task.WebhookURL != "" {
 			go m.sendWebhook(task)
 		}
+		m.notifyWorkflow(task)
 		return
 	}
 
-	// 首轮执行成功 → 保持 running 状态等待多轮
+	// 首轮执行成功 → 评估结果，保持 running 状态等待多轮
+	var ag *agent.Agent
+	if m.agentMgr != nil {
+		ag, _ = m.agentMgr.Get(task.AgentID)
+	}
+	m.evaluateTask(ctx, task, ag, task.Prompt)
+	m.storeCachedResult(task)
 	if err := m.store.Update(task); err != nil {
 		log.Error("failed to update task after first turn", "task_id", task.ID, "error", err)
 	}
 
+	// 工作流步骤不等待多轮，首轮完成即结束，以便调度下游步骤
+	if isWorkflowTask(task) {
+		m.completeTask(task.ID, "workflow step finished")
+		return
+	}
+
+	// 缓存命中没有 Session，无法继续多轮
+	if task.CacheHit {
+		m.completeTask(task.ID, "result served from cache")
+		return
+	}
+
 	// 广播 turn_completed 事件，通知前端本轮已完成
 	m.broadcastEvent(task.ID, &TaskEvent{
 		Type: "task.turn_completed",
@@ -740,6 +1040,15 @@ func (m *Manager) doExecute(ctx context.Context, task *Task) error {
 	if err != nil {
 		return fmt.Errorf("failed to get agent: %w", err)
 	}
+	// 要求审批的 Agent 在审批未配置时不执行（不创建 Session）
+	if err := m.checkApproval(ag); err != nil {
+		return err
+	}
+
+	// 命中结果缓存：直接复用结果，不创建 Session
+	if m.useCachedResult(task) {
+		return nil
+	}
 
 	// 如果启用了 Fallback 且有 FallbackExecutor，使用带故障转移的执行
 	if ag.FallbackEnabled && len(ag.FallbackProviderIDs) > 0 && m.fallbackExecutor != nil {
@@ -764,6 +1073,10 @@ func (m *Manager) doExecuteWithFallback(ctx context.Context, task *Task, ag *age
 	// 使用 FallbackExecutor 执行
 	result, err := m.fallbackExecutor.ExecuteWithFallback(ctx, task, ag)
 	if err != nil {
+		// 所有 Provider 均失败：计入每次尝试消耗的 token 并保留明细
+		if r := fallbackFailureResult(err); r != nil {
+			task.Usage = r.Usage
+		}
 		return fmt.Errorf("execution failed: %w", err)
 	}
 
@@ -778,6 +1091,7 @@ func (m *Manager) doExecuteWithFallback(ctx context.Context, task *Task, ag *age
 	if len(task.Attachments) > 0 {
 		m.mountAttachments(ctx, result.Session, task.Attachments)
 	}
+	tracker := newOutputTracker(ag, result.Session.Workspace)
 
 	// 等待执行完成
 	timeout := task.Timeout
@@ -791,10 +1105,20 @@ func (m *Manager) doExecuteWithFallback(ctx context.Context, task *Task, ag *age
 	}
 
 	// 保存结果
+	applyTokenUsage(execResult, result.ExecResponse.Usage)
+	if result.UsedFallback {
+		if execResult.Usage == nil {
+			execResult.Usage = &Usage{}
+		}
+		execResult.Usage.Attempts = result.ProviderUsage
+	}
+	execResult.Files = m.collectOutputFiles(task.ID, tracker)
+	m.replaceOutputFiles(task, execResult.Files)
 	if len(task.Turns) > 0 {
 		task.Turns[0].Result = execResult
 	}
 	task.Result = execResult
+	task.refreshUsage()
 
 	// 广播执行成功事件
 	m.broadcastEvent(task.ID, &TaskEvent{Type: "agent.message", Data: map[string]interface{}{
@@ -815,37 +1139,41 @@ func (m *Manager) doExecuteWithFallback(ctx context.Context, task *Task, ag *age
 
 // doExecuteStandard 标准执行流程（无 Fallback）
 func (m *Manager) doExecuteStandard(ctx context.Context, task *Task, ag *agent.Agent) error {
-	// 从 Agent 配置获取 workspace
-	workspace := ""
-	if ag.Workspace != "" {
-		workspace = ag.Workspace
-	} else {
-		workspace = fmt.Sprintf("agent-%s-%s", task.AgentID, task.ID)
+	// 熔断中（或半开试探已被占用）不发起请求
+	if m.providerHealth != nil && ag.ProviderID != "" && !m.providerHealth.Allow(ag.ProviderID) {
+		return fmt.Errorf("provider %s: %w", ag.ProviderID, ErrProviderCircuitOpen)
 	}
 
+	// 从 Agent 配置获取 workspace（自动重试时按策略决定是否沿用上次的工作区）
+	workspace := taskWorkspace(task, ag)
+
 	createReq := &session.CreateRequest{
-		AgentID:   task.AgentID,
-		Workspace: workspace,
+		AgentID:     task.AgentID,
+		Workspace:   workspace,
+		BudgetKey:   task.ID,
+		TokenBudget: task.TokenBudget,
 	}
 
 	sess, err := m.sessionMgr.Create(ctx, createReq)
 	if err != nil {
 		// 记录创建 session 失败（可能是 provider 问题）
 		m.recordProviderError(ag.ProviderID, err)
-		return fmt.Errorf("failed to create session: %w", err)
+		return &sessionSetupError{fmt.Errorf("failed to create session: %w", err)}
 	}
 	task.SessionID = sess.ID
 
 	// 启动 Session
 	if err := m.sessionMgr.Start(ctx, sess.ID); err != nil {
 		m.recordProviderError(ag.ProviderID, err)
-		return fmt.Errorf("failed to start session: %w", err)
+		m.sessionMgr.Stop(context.Background(), sess.ID)
+		return &sessionSetupError{fmt.Errorf("failed to start session: %w", err)}
 	}
 
 	// 挂载附件到容器工作区
 	if len(task.Attachments) > 0 {
 		m.mountAttachments(ctx, sess, task.Attachments)
 	}
+	tracker := newOutputTracker(ag, sess.Workspace)
 
 	// 广播事件
 	m.broadcastEvent(task.ID, &TaskEvent{Type: "agent.thinking"})
@@ -856,10 +1184,17 @@ func (m *Manager) doExecuteStandard(ctx context.Context, task *Task, ag *agent.A
 		timeout = 1800 // 默认 30 分钟
 	}
 
-	execResp, err := m.sessionMgr.Exec(ctx, sess.ID, &session.ExecRequest{
+	execReq := &session.ExecRequest{
 		Prompt:  task.Prompt,
 		Timeout: timeout,
-	})
+	}
+	release, err := m.prepareApproval(task, ag, execReq)
+	if err != nil {
+		m.sessionMgr.Stop(ctx, task.SessionID)
+		return err
+	}
+	execResp, err := m.sessionMgr.Exec(ctx, sess.ID, execReq)
+	release()
 	if err != nil {
 		m.sessionMgr.Stop(ctx, task.SessionID)
 		// 记录执行失败（分类错误类型）
@@ -886,10 +1221,14 @@ func (m *Manager) doExecuteStandard(ctx context.Context, task *Task, ag *agent.A
 	m.recordProviderSuccess(ag.ProviderID)
 
 	// 保存结果到首轮 Turn
+	applyTokenUsage(result, execResp.Usage)
+	result.Files = m.collectOutputFiles(task.ID, tracker)
+	m.replaceOutputFiles(task, result.Files)
 	if len(task.Turns) > 0 {
 		task.Turns[0].Result = result
 	}
 	task.Result = result
+	task.refreshUsage()
 
 	// 广播事件
 	m.broadcastEvent(task.ID, &TaskEvent{Type: "agent.message", Data: map[string]interface{}{
@@ -901,6 +1240,7 @@ func (m *Manager) doExecuteStandard(ctx context.Context, task *Task, ag *agent.A
 
 // recordProviderError 记录 provider 执行失败（用于故障转移决策）
 func (m *Manager) recordProviderError(providerID string, err error) {
+	recordProviderHealth(m.providerHealth, providerID, err)
 	if m.providerMgr == nil {
 		return
 	}
@@ -923,6 +1263,7 @@ func (m *Manager) recordProviderError(providerID string, err error) {
 
 // recordProviderSuccess 记录 provider 执行成功
 func (m *Manager) recordProviderSuccess(providerID string) {
+	recordProviderHealth(m.providerHealth, providerID, nil)
 	if m.providerMgr == nil {
 		return
 	}
@@ -1082,6 +1423,7 @@ func (m *Manager) completeTask(taskID string, reason string) {
 	if err := m.store.Update(task); err != nil {
 		log.Error("failed to update task to completed", "task_id", taskID, "error", err)
 	}
+	m.removeAttemptWorkspaces(task)
 
 	// 清理 running map
 	m.runningMu.Lock()
@@ -1103,6 +1445,8 @@ func (m *Manager) completeTask(taskID string, reason string) {
 	if task.WebhookURL != "" {
 		go m.sendWebhook(task)
 	}
+
+	m.notifyWorkflow(task)
 }
 
 // RetryTask 重试失败的任务（创建新任务，复制原任务的 agent + prompt）
@@ -1122,13 +1466,30 @@ func (m *Manager) RetryTask(id string) (*Task, error) {
 		Attachments: oldTask.Attachments,
 		WebhookURL:  oldTask.WebhookURL,
 		Timeout:     oldTask.Timeout,
+		Priority:    oldTask.Priority,
 		Metadata:    oldTask.Metadata,
+		Labels:      oldTask.Labels,
+		Retry:       oldTask.Retry,
+		Evaluators:  oldTask.Evaluators,
+		Cache:       oldTask.Cache,
+		TokenBudget: oldTask.TokenBudget,
 	})
 }
 
-// GetStats 获取任务统计
-func (m *Manager) GetStats() (*TaskStats, error) {
-	return m.store.Stats()
+// GetStats 获取任务统计（filter 为空时统计全部任务）
+func (m *Manager) GetStats(filter *ListFilter) (*TaskStats, error) {
+	return m.store.Stats(filter)
+}
+
+// SetTaskLabels 替换任务的标签
+func (m *Manager) SetTaskLabels(id string, values map[string]string) (*Task, error) {
+	if err := labels.Validate(values); err != nil {
+		return nil, err
+	}
+	if err := m.store.SetLabels(id, values); err != nil {
+		return nil, err
+	}
+	return m.store.Get(id)
 }
 
 // DeleteTask 删除任务
@@ -1143,7 +1504,20 @@ func (m *Manager) DeleteTask(id string) error {
 		return apperr.BadRequestf("cannot delete task in status: %s", task.Status)
 	}
 
-	return m.store.Delete(id)
+	if err := m.store.Delete(id); err != nil {
+		return err
+	}
+	if m.eventStore != nil {
+		if err := m.eventStore.DeleteByTask(id); err != nil {
+			log.Warn("failed to delete task events", "task_id", id, "error", err)
+		}
+	}
+	if m.approvalStore != nil {
+		if err := m.approvalStore.DeleteByTask(id); err != nil {
+			log.Warn("failed to delete task approvals", "task_id", id, "error", err)
+		}
+	}
+	return nil
 }
 
 // CleanupTasks 清理旧任务
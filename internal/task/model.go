@@ -3,7 +3,10 @@ package task
 import (
 	"time"
 
+	"github.com/tmalldedede/agentbox/internal/agent"
 	"github.com/tmalldedede/agentbox/internal/apperr"
+	"github.com/tmalldedede/agentbox/internal/eval"
+	"github.com/tmalldedede/agentbox/internal/resultcache"
 )
 
 // 任务状态
@@ -16,8 +19,27 @@ const (
 	StatusCompleted Status = "completed" // 执行成功
 	StatusFailed    Status = "failed"    // 执行失败
 	StatusCancelled Status = "cancelled" // 用户取消
+
+	StatusWaitingApproval Status = "waiting_approval" // 执行中，暂停等待用户审批工具调用
+)
+
+// Priority 任务优先级（优先级通道，高优先级通道中的任务总是先于低优先级调度）
+type Priority string
+
+const (
+	PriorityHigh   Priority = "high"
+	PriorityNormal Priority = "normal"
+	PriorityLow    Priority = "low"
 )
 
+// priorityLanes 调度时依次服务的优先级通道
+var priorityLanes = []Priority{PriorityHigh, PriorityNormal, PriorityLow}
+
+// IsValid 是否是合法的优先级
+func (p Priority) IsValid() bool {
+	return p == PriorityHigh || p == PriorityNormal || p == PriorityLow
+}
+
 // 常见错误 - 使用 apperr 提供正确的 HTTP 状态码
 var (
 	ErrTaskNotFound = apperr.NotFound("task")
@@ -49,14 +71,43 @@ type Task struct {
 	WebhookURL string `json:"webhook_url,omitempty"`
 
 	// 执行配置
-	Timeout int `json:"timeout,omitempty"` // 秒，0 表示使用默认
+	Timeout  int        `json:"timeout,omitempty"`  // 秒，0 表示使用默认
+	Priority Priority   `json:"priority,omitempty"` // 优先级通道，默认 normal
+	RunAt    *time.Time `json:"run_at,omitempty"`   // 最早开始时间（之前不会被调度）
+	Deadline *time.Time `json:"deadline,omitempty"` // 截止时间（超时未完成则失败 / 取消）
+
+	// 自动重试策略（为空时使用 Agent 的策略）与失败尝试记录
+	Retry    *agent.RetryPolicy `json:"retry,omitempty"`
+	Attempts []Attempt          `json:"attempts,omitempty"`
+
+	// 来源模板（通过任务模板创建时记录）
+	TemplateID      string `json:"template_id,omitempty"`
+	TemplateVersion int    `json:"template_version,omitempty"`
+
+	// 结果评估：任务级评估器（来自模板 / 请求，与 Agent 的评估器一起执行）与最近一次评估报告
+	Evaluators []eval.Evaluator `json:"evaluators,omitempty"`
+	Evaluation *eval.Report     `json:"evaluation,omitempty"`
+
+	// 结果缓存策略（为空时不使用缓存）；CacheHit 表示首轮结果来自缓存（未执行、不计成本）
+	Cache    *resultcache.Policy `json:"cache,omitempty"`
+	CacheHit bool                `json:"cache_hit,omitempty"`
+	cacheKey string              // 首轮执行时计算的缓存键（执行成功后写入缓存）
+
+	// LLM 代理的 Token 预算（输入 + 输出，任务所有会话共享；未启用代理时不生效，0 表示不限）
+	TokenBudget int64 `json:"token_budget,omitempty"`
 
 	// 运行时状态
 	Status       Status  `json:"status"`
 	SessionID    string  `json:"session_id,omitempty"`    // 关联的 Session
 	ThreadID     string  `json:"thread_id,omitempty"`     // 多轮对话 Thread ID (Codex resume)
+	InstanceID   string  `json:"instance_id,omitempty"`   // 执行任务的实例（多实例部署时用于接管已停止实例的任务）
 	ErrorMessage string  `json:"error_message,omitempty"` // 失败原因
 	Result       *Result `json:"result,omitempty"`        // 执行结果（最后一轮）
+	Usage        *Usage  `json:"usage,omitempty"`         // 所有轮次累计的资源使用
+
+	// 排队信息（仅 queued 状态时计算，不持久化）
+	QueuePosition    int        `json:"queue_position,omitempty"`     // 在调度顺序中的位置（从 1 开始）
+	EstimatedStartAt *time.Time `json:"estimated_start_at,omitempty"` // 预计开始时间
 
 	// 时间戳
 	CreatedAt   time.Time  `json:"created_at"`
@@ -66,6 +117,21 @@ type Task struct {
 
 	// 元数据
 	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// 标签（可按标签选择器过滤、按标签统计，创建后可修改）
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Attempt 一次失败的执行尝试（首轮执行按重试策略自动重试时记录）
+type Attempt struct {
+	Number    int       `json:"number"`               // 从 1 开始
+	Error     string    `json:"error"`                // 错误信息
+	Class     string    `json:"class"`                // 错误分类（apperr.FailoverReason 或 container）
+	Retried   bool      `json:"retried"`              // 是否已安排重试
+	SessionID string    `json:"session_id,omitempty"` // 本次尝试使用的 Session
+	Workspace string    `json:"workspace,omitempty"`  // 本次尝试使用的工作区（任务结束时清理）
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
 }
 
 // Turn 对话轮次
@@ -87,8 +153,9 @@ type Result struct {
 
 // OutputFile 输出文件
 type OutputFile struct {
+	ID       string `json:"id,omitempty"` // 文件存储中的 file ID
 	Name     string `json:"name"`
-	Path     string `json:"path"`
+	Path     string `json:"path"` // 工作区内的相对路径
 	Size     int64  `json:"size"`
 	MimeType string `json:"mime_type,omitempty"`
 	URL      string `json:"url,omitempty"` // 下载地址
@@ -96,10 +163,24 @@ type OutputFile struct {
 
 // Usage 资源使用统计
 type Usage struct {
-	DurationSeconds int   `json:"duration_seconds"`
-	InputTokens     int64 `json:"input_tokens,omitempty"`
-	OutputTokens    int64 `json:"output_tokens,omitempty"`
-	TotalTokens     int64 `json:"total_tokens,omitempty"`
+	DurationSeconds   int   `json:"duration_seconds"`
+	InputTokens       int64 `json:"input_tokens,omitempty"`
+	CachedInputTokens int64 `json:"cached_input_tokens,omitempty"` // 命中缓存的输入 token（包含在 InputTokens 中）
+	OutputTokens      int64 `json:"output_tokens,omitempty"`
+	TotalTokens       int64 `json:"total_tokens,omitempty"`
+
+	// Provider 故障转移时每次尝试的明细（未发生故障转移时为空）
+	Attempts []ProviderUsage `json:"attempts,omitempty"`
+}
+
+// ProviderUsage 单个 Provider 尝试的资源使用
+type ProviderUsage struct {
+	ProviderID        string `json:"provider_id"`
+	Success           bool   `json:"success"`
+	Error             string `json:"error,omitempty"`
+	InputTokens       int64  `json:"input_tokens,omitempty"`
+	CachedInputTokens int64  `json:"cached_input_tokens,omitempty"`
+	OutputTokens      int64  `json:"output_tokens,omitempty"`
 }
 
 // IsTerminal 是否是终止状态
@@ -109,7 +190,8 @@ func (s Status) IsTerminal() bool {
 
 // CanCancel 是否可以取消
 func (t *Task) CanCancel() bool {
-	return t.Status == StatusPending || t.Status == StatusQueued || t.Status == StatusRunning
+	return t.Status == StatusPending || t.Status == StatusQueued || t.Status == StatusRunning ||
+		t.Status == StatusWaitingApproval
 }
 
 // Duration 获取执行时长
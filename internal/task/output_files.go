@@ -0,0 +1,243 @@
+package task
+
+import (
+	"io/fs"
+	"mime"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tmalldedede/agentbox/internal/agent"
+)
+
+// OutputFileRegisterFunc 输出文件登记回调
+// 将工作区中的文件登记到文件存储，返回填充了 ID / 下载地址的 OutputFile
+type OutputFileRegisterFunc func(taskID, srcPath, relPath string) (*OutputFile, error)
+
+// OutputFileRemoveFunc 删除已登记的输出文件（同一路径在后续轮次中被覆盖时清理旧记录）
+type OutputFileRemoveFunc func(fileID string) error
+
+const (
+	maxOutputFilesPerTurn = 200       // 单轮最多收集的输出文件数
+	maxOutputBytesPerTurn = 500 << 20 // 单轮收集的输出文件总大小上限
+
+	// MaxOutputFileSize 单个输出文件的大小上限，超过的文件不收集
+	MaxOutputFileSize = 100 << 20
+)
+
+// defaultOutputFileExcludes 默认排除的噪声目录 / 文件
+var defaultOutputFileExcludes = []string{
+	".git", ".svn", ".hg",
+	"node_modules", "__pycache__", ".venv", "venv", ".cache",
+	".claude", ".codex", ".DS_Store", "*.pyc",
+}
+
+// SetOutputFileRegistrar 设置输出文件登记回调
+func (m *Manager) SetOutputFileRegistrar(fn OutputFileRegisterFunc) {
+	m.outputRegistrar = fn
+}
+
+// SetOutputFileRemover 设置输出文件删除回调
+func (m *Manager) SetOutputFileRemover(fn OutputFileRemoveFunc) {
+	m.outputRemover = fn
+}
+
+// fileStamp 文件快照信息
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// outputTracker 记录一轮执行前的工作区状态，执行后对比得出新建 / 修改的文件
+type outputTracker struct {
+	workspace string
+	include   []string
+	exclude   []string
+	before    map[string]fileStamp
+}
+
+// newOutputTracker 在执行前为工作区拍快照；workspace 为空时返回 nil
+func newOutputTracker(ag *agent.Agent, workspace string) *outputTracker {
+	if workspace == "" {
+		return nil
+	}
+	tr := &outputTracker{
+		workspace: workspace,
+		exclude:   append([]string{}, defaultOutputFileExcludes...),
+	}
+	if ag != nil {
+		tr.include = ag.OutputFilePatterns
+		tr.exclude = append(tr.exclude, ag.OutputFileExcludes...)
+	}
+	tr.before = tr.snapshot()
+	return tr
+}
+
+// snapshot 遍历工作区，记录符合规则的文件
+func (tr *outputTracker) snapshot() map[string]fileStamp {
+	files := make(map[string]fileStamp)
+	filepath.WalkDir(tr.workspace, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // 不可读的条目跳过
+		}
+		rel, err := filepath.Rel(tr.workspace, p)
+		if err != nil || rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if matchAny(tr.exclude, rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !tr.accept(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files[rel] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	return files
+}
+
+// accept 判断文件是否应作为输出文件
+func (tr *outputTracker) accept(rel string) bool {
+	if matchAny(tr.exclude, rel) {
+		return false
+	}
+	return len(tr.include) == 0 || matchAny(tr.include, rel)
+}
+
+// changedFile 执行后新建或修改的文件
+type changedFile struct {
+	rel  string
+	size int64
+}
+
+// changed 返回执行后新建或修改的文件（按相对路径排序）
+func (tr *outputTracker) changed() []changedFile {
+	var files []changedFile
+	for rel, after := range tr.snapshot() {
+		before, ok := tr.before[rel]
+		if ok && before.size == after.size && before.modTime.Equal(after.modTime) {
+			continue
+		}
+		files = append(files, changedFile{rel: rel, size: after.size})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].rel < files[j].rel })
+	return files
+}
+
+// matchAny 判断相对路径是否匹配任一 glob（匹配完整路径或文件名）
+func matchAny(patterns []string, rel string) bool {
+	base := path.Base(rel)
+	for _, p := range patterns {
+		p = strings.TrimSuffix(p, "/")
+		if p == "" {
+			continue
+		}
+		if ok, _ := path.Match(p, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// collectOutputFiles 收集本轮产出的文件并登记到文件存储
+func (m *Manager) collectOutputFiles(taskID string, tr *outputTracker) []OutputFile {
+	if tr == nil {
+		return nil
+	}
+
+	changed := tr.changed()
+	if len(changed) > maxOutputFilesPerTurn {
+		log.Warn("too many output files, truncating",
+			"task_id", taskID, "count", len(changed), "max", maxOutputFilesPerTurn)
+		changed = changed[:maxOutputFilesPerTurn]
+	}
+
+	files := make([]OutputFile, 0, len(changed))
+	var total int64
+	for _, c := range changed {
+		if c.size > MaxOutputFileSize {
+			log.Warn("output file too large, skipped",
+				"task_id", taskID, "path", c.rel, "size", c.size, "max", MaxOutputFileSize)
+			continue
+		}
+		if total+c.size > maxOutputBytesPerTurn {
+			log.Warn("output files exceed the size limit of a turn, skipped",
+				"task_id", taskID, "path", c.rel, "size", c.size, "max", maxOutputBytesPerTurn)
+			continue
+		}
+		total += c.size
+
+		// 未配置文件存储时只记录元信息
+		if m.outputRegistrar == nil {
+			files = append(files, OutputFile{
+				Name:     path.Base(c.rel),
+				Path:     c.rel,
+				Size:     c.size,
+				MimeType: mime.TypeByExtension(path.Ext(c.rel)),
+			})
+			continue
+		}
+		src := filepath.Join(tr.workspace, filepath.FromSlash(c.rel))
+		f, err := m.outputRegistrar(taskID, src, c.rel)
+		if err != nil {
+			log.Warn("failed to register output file", "task_id", taskID, "path", c.rel, "error", err)
+			continue
+		}
+		files = append(files, *f)
+	}
+
+	if len(files) > 0 {
+		log.Info("output files collected", "task_id", taskID, "count", len(files))
+	}
+	return files
+}
+
+// replaceOutputFiles 将本轮输出文件合并到任务中，并删除被同一路径覆盖的旧文件记录
+func (m *Manager) replaceOutputFiles(task *Task, latest []OutputFile) {
+	if m.outputRemover != nil && len(latest) > 0 {
+		paths := make(map[string]bool, len(latest))
+		for _, f := range latest {
+			paths[f.Path] = true
+		}
+		for _, f := range task.OutputFiles {
+			if f.ID == "" || !paths[f.Path] {
+				continue
+			}
+			if err := m.outputRemover(f.ID); err != nil {
+				log.Warn("failed to remove replaced output file", "task_id", task.ID, "file_id", f.ID, "error", err)
+			}
+		}
+	}
+	task.OutputFiles = mergeOutputFiles(task.OutputFiles, latest)
+}
+
+// mergeOutputFiles 合并多轮输出文件，同一路径以最新一轮为准
+func mergeOutputFiles(existing, latest []OutputFile) []OutputFile {
+	if len(latest) == 0 {
+		return existing
+	}
+	replaced := make(map[string]bool, len(latest))
+	for _, f := range latest {
+		replaced[f.Path] = true
+	}
+	merged := make([]OutputFile, 0, len(existing)+len(latest))
+	for _, f := range existing {
+		if !replaced[f.Path] {
+			merged = append(merged, f)
+		}
+	}
+	return append(merged, latest...)
+}
@@ -0,0 +1,128 @@
+package task
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmalldedede/agentbox/internal/agent"
+)
+
+func writeWorkspaceFile(t *testing.T, dir, rel, content string) {
+	t.Helper()
+	p := filepath.Join(dir, filepath.FromSlash(rel))
+	require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+	require.NoError(t, os.WriteFile(p, []byte(content), 0644))
+}
+
+func outputPaths(files []OutputFile) []string {
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.Path
+	}
+	return paths
+}
+
+func TestCollectOutputFiles_DetectsCreatedAndModified(t *testing.T) {
+	dir := t.TempDir()
+	writeWorkspaceFile(t, dir, "input.csv", "a,b")
+	writeWorkspaceFile(t, dir, "notes.md", "v1")
+
+	m := &Manager{}
+	tr := newOutputTracker(&agent.Agent{}, dir)
+
+	// 模拟 Agent 执行：新建 / 修改文件，并产生依赖目录噪声
+	writeWorkspaceFile(t, dir, "report/summary.json", `{"ok":true}`)
+	writeWorkspaceFile(t, dir, "notes.md", "v2 updated")
+	writeWorkspaceFile(t, dir, "node_modules/pkg/index.js", "x")
+	writeWorkspaceFile(t, dir, ".git/HEAD", "ref")
+
+	files := m.collectOutputFiles("task-1", tr)
+	assert.Equal(t, []string{"notes.md", "report/summary.json"}, outputPaths(files))
+	assert.Equal(t, "summary.json", files[1].Name)
+	assert.Equal(t, int64(len(`{"ok":true}`)), files[1].Size)
+	assert.Equal(t, "application/json", files[1].MimeType)
+}
+
+func TestCollectOutputFiles_AgentPatterns(t *testing.T) {
+	dir := t.TempDir()
+	ag := &agent.Agent{
+		OutputFilePatterns: []string{"*.md", "dist/*"},
+		OutputFileExcludes: []string{"tmp"},
+	}
+
+	m := &Manager{}
+	tr := newOutputTracker(ag, dir)
+	writeWorkspaceFile(t, dir, "README.md", "# hi")
+	writeWorkspaceFile(t, dir, "main.go", "package main")
+	writeWorkspaceFile(t, dir, "dist/app.bin", "bin")
+	writeWorkspaceFile(t, dir, "tmp/scratch.md", "scratch")
+
+	files := m.collectOutputFiles("task-1", tr)
+	assert.Equal(t, []string{"README.md", "dist/app.bin"}, outputPaths(files))
+}
+
+func TestCollectOutputFiles_Registrar(t *testing.T) {
+	dir := t.TempDir()
+	m := &Manager{}
+	var registered []string
+	m.SetOutputFileRegistrar(func(taskID, srcPath, relPath string) (*OutputFile, error) {
+		registered = append(registered, srcPath)
+		return &OutputFile{ID: "file-1", Name: filepath.Base(relPath), Path: relPath, URL: "/api/v1/tasks/" + taskID + "/files/file-1"}, nil
+	})
+
+	tr := newOutputTracker(nil, dir)
+	writeWorkspaceFile(t, dir, "out.txt", "hello")
+
+	files := m.collectOutputFiles("task-9", tr)
+	require.Len(t, files, 1)
+	assert.Equal(t, []string{filepath.Join(dir, "out.txt")}, registered)
+	assert.Equal(t, "/api/v1/tasks/task-9/files/file-1", files[0].URL)
+
+	// 未变化的文件不会在下一轮重复收集
+	tr = newOutputTracker(nil, dir)
+	assert.Empty(t, m.collectOutputFiles("task-9", tr))
+}
+
+func TestMergeOutputFiles(t *testing.T) {
+	existing := []OutputFile{{ID: "1", Path: "a.txt"}, {ID: "2", Path: "b.txt"}}
+	merged := mergeOutputFiles(existing, []OutputFile{{ID: "3", Path: "a.txt"}, {ID: "4", Path: "c.txt"}})
+
+	ids := make([]string, len(merged))
+	for i, f := range merged {
+		ids[i] = f.ID
+	}
+	assert.Equal(t, []string{"2", "3", "4"}, ids)
+	assert.Equal(t, existing, mergeOutputFiles(existing, nil))
+}
+
+func TestCollectOutputFiles_SizeLimit(t *testing.T) {
+	dir := t.TempDir()
+	m := &Manager{}
+	tr := newOutputTracker(nil, dir)
+	writeWorkspaceFile(t, dir, "small.txt", "ok")
+	// 稀疏文件：超过单文件上限
+	big, err := os.Create(filepath.Join(dir, "big.bin"))
+	require.NoError(t, err)
+	require.NoError(t, big.Truncate(MaxOutputFileSize+1))
+	require.NoError(t, big.Close())
+
+	files := m.collectOutputFiles("task-1", tr)
+	assert.Equal(t, []string{"small.txt"}, outputPaths(files))
+}
+
+func TestReplaceOutputFiles(t *testing.T) {
+	m := &Manager{}
+	var removed []string
+	m.SetOutputFileRemover(func(fileID string) error {
+		removed = append(removed, fileID)
+		return nil
+	})
+
+	task := &Task{ID: "task-1", OutputFiles: []OutputFile{{ID: "1", Path: "a.txt"}, {ID: "2", Path: "b.txt"}}}
+	m.replaceOutputFiles(task, []OutputFile{{ID: "3", Path: "a.txt"}})
+	assert.Equal(t, []string{"1"}, removed)
+	assert.Equal(t, []string{"b.txt", "a.txt"}, outputPaths(task.OutputFiles))
+}
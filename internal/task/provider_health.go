@@ -0,0 +1,117 @@
+package task
+
+import (
+	"errors"
+	"time"
+
+	"github.com/tmalldedede/agentbox/internal/agent"
+	"github.com/tmalldedede/agentbox/internal/apperr"
+	"github.com/tmalldedede/agentbox/internal/providerhealth"
+)
+
+// ProviderHealth Provider 熔断器（providerhealth.Monitor 实现）
+type ProviderHealth interface {
+	// State Provider 当前的放行状态（无副作用，用于调度过滤与状态查询）
+	State(providerID string) providerhealth.State
+	// Allow 执行前申请放行（熔断中返回 false；半开状态只放行一个试探请求）
+	Allow(providerID string) bool
+	// RecordSuccess 记录一次执行成功
+	RecordSuccess(providerID string)
+	// RecordFailure 记录一次 Provider 导致的执行失败
+	RecordFailure(providerID, reason string)
+}
+
+// SetProviderHealth 设置 Provider 熔断器：调度跳过整条 Provider 链均已熔断的任务，
+// 故障转移跳过已熔断的 Provider，执行结果反馈给熔断器
+func (m *Manager) SetProviderHealth(h ProviderHealth) {
+	m.providerHealth = h
+	if m.fallbackExecutor != nil {
+		m.fallbackExecutor.health = h
+	}
+}
+
+// providerChain Agent 的 Provider 链（主 Provider + 启用时的备用 Provider）
+func providerChain(ag *agent.Agent) []string {
+	providers := []string{ag.ProviderID}
+	if ag.FallbackEnabled && len(ag.FallbackProviderIDs) > 0 {
+		providers = append(providers, ag.FallbackProviderIDs...)
+	}
+	return providers
+}
+
+// filterCircuitOpen 过滤掉 Provider 链全部熔断的排队任务（任务留在队列中，熔断恢复后再调度）
+func (m *Manager) filterCircuitOpen(queued []*Task) []*Task {
+	if m.providerHealth == nil {
+		return queued
+	}
+
+	allowed := make(map[string]bool) // agentID -> 是否有可用 Provider
+	result := queued[:0:0]
+	for _, t := range queued {
+		ok, seen := allowed[t.AgentID]
+		if !seen {
+			ok = true
+			if ag, err := m.agentMgr.Get(t.AgentID); err == nil && ag.ProviderID != "" {
+				ok = false
+				for _, p := range providerChain(ag) {
+					if m.providerHealth.State(p) != providerhealth.StateOpen {
+						ok = true
+						break
+					}
+				}
+				if !ok {
+					log.Debug("skipping task, provider circuit open", "agent_id", ag.ID, "provider", ag.ProviderID)
+				}
+			}
+			allowed[t.AgentID] = ok
+		}
+		if ok {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// circuitOpenOnly 执行失败是否只是因为 Provider 链全部熔断（未真正发起请求）
+func circuitOpenOnly(err error) bool {
+	var fe *ProviderFallbackError
+	if errors.As(err, &fe) {
+		for _, e := range fe.ProviderErrors {
+			if !errors.Is(e, ErrProviderCircuitOpen) {
+				return false
+			}
+		}
+		return len(fe.ProviderErrors) > 0
+	}
+	return errors.Is(err, ErrProviderCircuitOpen)
+}
+
+// requeueCircuitOpen 执行时 Provider 链已全部熔断（如半开试探已被其他任务占用）：
+// 任务回到队列，不计为失败的尝试，熔断恢复后再调度
+func (m *Manager) requeueCircuitOpen(task *Task) bool {
+	now := time.Now()
+	task.Status = StatusQueued
+	task.QueuedAt = &now
+	task.StartedAt = nil
+	task.SessionID = ""
+	if err := m.store.Update(task); err != nil {
+		log.Error("failed to requeue task, provider circuit open", "task_id", task.ID, "error", err)
+		return false
+	}
+	log.Info("provider circuit open, task requeued", "task_id", task.ID, "agent_id", task.AgentID)
+	return true
+}
+
+// recordProviderHealth 将执行结果反馈给熔断器（只统计需要 cooldown 的 Provider 错误）
+func recordProviderHealth(h ProviderHealth, providerID string, err error) {
+	if h == nil || providerID == "" {
+		return
+	}
+	if err == nil {
+		h.RecordSuccess(providerID)
+		return
+	}
+	if fe := apperr.ClassifyError(err); fe != nil && fe.ShouldCooldown() {
+		h.RecordFailure(providerID, string(fe.Reason))
+	}
+}
@@ -0,0 +1,94 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmalldedede/agentbox/internal/agent"
+	"github.com/tmalldedede/agentbox/internal/provider"
+	"github.com/tmalldedede/agentbox/internal/providerhealth"
+)
+
+// fakeProviderHealth 按 Provider 设置熔断状态并记录反馈
+type fakeProviderHealth struct {
+	open      map[string]bool
+	successes []string
+	failures  []string
+}
+
+func (h *fakeProviderHealth) State(providerID string) providerhealth.State {
+	if h.open[providerID] {
+		return providerhealth.StateOpen
+	}
+	return providerhealth.StateClosed
+}
+
+func (h *fakeProviderHealth) Allow(providerID string) bool { return !h.open[providerID] }
+
+func (h *fakeProviderHealth) RecordSuccess(providerID string) {
+	h.successes = append(h.successes, providerID)
+}
+
+func (h *fakeProviderHealth) RecordFailure(providerID, reason string) {
+	h.failures = append(h.failures, providerID+":"+reason)
+}
+
+func TestFilterCircuitOpen(t *testing.T) {
+	dir := t.TempDir()
+	providerMgr := provider.NewManager(filepath.Join(dir, "providers"), "test-key-32bytes-for-aes256!!")
+	for _, id := range []string{"primary", "backup"} {
+		providerMgr.Create(&provider.Provider{ID: id, Name: id, Agents: []string{"claude-code"}})
+	}
+	agentMgr := agent.NewManager(filepath.Join(dir, "agents"), providerMgr, nil, nil, nil)
+	require.NoError(t, agentMgr.Create(&agent.Agent{
+		ID: "single", Name: "Single", Adapter: "claude-code", ProviderID: "primary", Status: "active",
+	}))
+	require.NoError(t, agentMgr.Create(&agent.Agent{
+		ID: "fallback", Name: "Fallback", Adapter: "claude-code", ProviderID: "primary", Status: "active",
+		FallbackEnabled: true, FallbackProviderIDs: []string{"backup"},
+	}))
+
+	m := NewManager(nil, agentMgr, nil, nil)
+	queued := []*Task{{ID: "t1", AgentID: "single"}, {ID: "t2", AgentID: "fallback"}, {ID: "t3", AgentID: "single"}}
+	assert.Len(t, m.filterCircuitOpen(queued), 3)
+
+	// 主 Provider 熔断：有备用 Provider 的任务仍可调度
+	health := &fakeProviderHealth{open: map[string]bool{"primary": true}}
+	m.SetProviderHealth(health)
+	picked := m.filterCircuitOpen(queued)
+	require.Len(t, picked, 1)
+	assert.Equal(t, "t2", picked[0].ID)
+
+	health.open["backup"] = true
+	assert.Empty(t, m.filterCircuitOpen(queued))
+	assert.Len(t, queued, 3)
+}
+
+func TestRecordProviderHealth(t *testing.T) {
+	health := &fakeProviderHealth{}
+	recordProviderHealth(health, "p", nil)
+	recordProviderHealth(health, "p", errors.New("rate limit exceeded"))
+	recordProviderHealth(health, "p", errors.New("maximum context length exceeded"))
+	recordProviderHealth(nil, "p", nil)
+
+	assert.Equal(t, []string{"p"}, health.successes)
+	assert.Equal(t, []string{"p:rate_limit"}, health.failures)
+}
+
+func TestCircuitOpenOnly(t *testing.T) {
+	open := fmt.Errorf("provider p: %w", ErrProviderCircuitOpen)
+	assert.True(t, circuitOpenOnly(open))
+	assert.True(t, circuitOpenOnly(&ProviderFallbackError{
+		ProviderErrors: map[string]error{"p": open, "q": fmt.Errorf("provider q: %w", ErrProviderCircuitOpen)},
+		LastError:      open,
+	}))
+	assert.False(t, circuitOpenOnly(&ProviderFallbackError{
+		ProviderErrors: map[string]error{"p": errors.New("rate limit exceeded"), "q": open},
+		LastError:      open,
+	}))
+	assert.False(t, circuitOpenOnly(errors.New("boom")))
+}
@@ -0,0 +1,207 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tmalldedede/agentbox/internal/agent"
+	"github.com/tmalldedede/agentbox/internal/apperr"
+	"github.com/tmalldedede/agentbox/internal/worker"
+)
+
+// sessionSetupError 创建 / 启动 Session（容器）失败，错误分类为 container
+type sessionSetupError struct {
+	err error
+}
+
+func (e *sessionSetupError) Error() string { return e.err.Error() }
+func (e *sessionSetupError) Unwrap() error { return e.err }
+
+// effectiveRetryPolicy 任务级策略优先，否则使用 Agent 的策略
+func effectiveRetryPolicy(task *Task, ag *agent.Agent) *agent.RetryPolicy {
+	if task.Retry != nil {
+		return task.Retry
+	}
+	if ag != nil {
+		return ag.Retry
+	}
+	return nil
+}
+
+// taskWorkspace 首轮执行使用的工作区
+//
+// 重试时默认使用新的工作区（agent-{id}-{task}-attempt-N），避免残留文件影响结果；
+// 策略开启 reuse_workspace 或 Agent 配置了固定工作区时沿用原工作区。
+func taskWorkspace(task *Task, ag *agent.Agent) string {
+	if ag.Workspace != "" {
+		return ag.Workspace
+	}
+	workspace := fmt.Sprintf("agent-%s-%s", ag.ID, task.ID)
+	if n := len(task.Attempts); n > 0 {
+		if p := effectiveRetryPolicy(task, ag); p == nil || !p.ReuseWorkspace {
+			workspace = fmt.Sprintf("%s-attempt-%d", workspace, n+1)
+		}
+	}
+	return workspace
+}
+
+// classifyAttemptError 将执行错误归类为重试策略中的错误分类
+//
+// Worker 节点断开导致的失败与容器创建失败同属 container 分类，可由重试策略重新调度到其他节点。
+func classifyAttemptError(err error) string {
+	var setupErr *sessionSetupError
+	if errors.As(err, &setupErr) || errors.Is(err, worker.ErrNodeLost) {
+		return agent.RetryClassContainer
+	}
+	var fe *apperr.FailoverError
+	if errors.As(err, &fe) {
+		return string(fe.Reason)
+	}
+	return string(apperr.ClassifyError(err).Reason)
+}
+
+// retryBackoff 第 attempt 次失败后的等待时间：指数退避 + 随机抖动
+func retryBackoff(p *agent.RetryPolicy, attempt int) time.Duration {
+	initial := p.InitialBackoff
+	if initial == 0 {
+		initial = agent.DefaultInitialBackoff
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff == 0 {
+		maxBackoff = agent.DefaultMaxBackoff
+	}
+	factor := p.Multiplier
+	if factor == 0 {
+		factor = agent.DefaultBackoffFactor
+	}
+	jitter := p.Jitter
+	if jitter == 0 {
+		jitter = agent.DefaultRetryJitter
+	}
+
+	delay := math.Min(float64(initial)*math.Pow(factor, float64(attempt-1)), float64(maxBackoff))
+	delay *= 1 + jitter*(2*rand.Float64()-1)
+	return time.Duration(delay * float64(time.Second))
+}
+
+// handleAttemptFailure 记录失败的首轮执行，并在策略允许时重新入队（run_at 延后退避时间）
+//
+// 返回 true 表示已安排重试，调用方不应再将任务置为失败。
+func (m *Manager) handleAttemptFailure(ctx context.Context, task *Task, execErr error, startedAt time.Time) bool {
+	var ag *agent.Agent
+	if m.agentMgr != nil {
+		ag, _ = m.agentMgr.Get(task.AgentID)
+	}
+	policy := effectiveRetryPolicy(task, ag)
+	if !policy.Enabled() {
+		return false
+	}
+
+	now := time.Now()
+	attempt := Attempt{
+		Number:    len(task.Attempts) + 1,
+		Error:     execErr.Error(),
+		Class:     classifyAttemptError(execErr),
+		SessionID: task.SessionID,
+		StartedAt: startedAt,
+		EndedAt:   now,
+	}
+	if task.SessionID != "" && m.sessionMgr != nil {
+		attempt.Workspace, _ = m.sessionMgr.GetWorkspace(task.SessionID)
+	}
+
+	// 已取消（用户取消 / 截止时间）、次数用尽或错误不可重试时不再重试
+	retry := ctx.Err() == nil && attempt.Number < policy.MaxAttempts && policy.Retryable(attempt.Class)
+	retryAt := now.Add(retryBackoff(policy, attempt.Number))
+	if retry && task.Deadline != nil && retryAt.After(*task.Deadline) {
+		retry = false
+	}
+	attempt.Retried = retry
+	task.Attempts = append(task.Attempts, attempt)
+	if !retry {
+		return false
+	}
+
+	// 释放失败尝试的 Session 与容器（工作区保留到任务结束，便于排查）
+	if task.SessionID != "" && m.sessionMgr != nil {
+		if err := m.sessionMgr.Delete(context.Background(), task.SessionID); err != nil {
+			log.Warn("failed to delete session of failed attempt", "task_id", task.ID, "session_id", task.SessionID, "error", err)
+		}
+	}
+
+	task.Status = StatusQueued
+	task.QueuedAt = &now
+	task.RunAt = &retryAt
+	task.StartedAt = nil
+	task.SessionID = ""
+	task.ThreadID = ""
+	task.Result = nil
+	task.ErrorMessage = ""
+	if len(task.Turns) > 0 {
+		task.Turns[0].Result = nil
+	}
+	if err := m.store.Update(task); err != nil {
+		log.Error("failed to requeue task for retry", "task_id", task.ID, "error", err)
+		return false
+	}
+
+	log.Warn("task attempt failed, retry scheduled",
+		"task_id", task.ID,
+		"attempt", attempt.Number,
+		"max_attempts", policy.MaxAttempts,
+		"class", attempt.Class,
+		"retry_at", retryAt,
+		"error", execErr)
+
+	m.broadcastEvent(task.ID, &TaskEvent{Type: "task.retrying", Data: map[string]interface{}{
+		"attempt":      attempt.Number,
+		"max_attempts": policy.MaxAttempts,
+		"class":        attempt.Class,
+		"error":        attempt.Error,
+		"retry_at":     retryAt,
+	}})
+	return true
+}
+
+// removeAttemptWorkspaces 任务结束时删除之前失败尝试的工作区
+//
+// 保留最后一次执行使用的工作区；沿用工作区或 Agent 配置了固定工作区时各次尝试路径相同，不会删除。
+func (m *Manager) removeAttemptWorkspaces(task *Task) {
+	if len(task.Attempts) == 0 {
+		return
+	}
+	keep := map[string]bool{task.Attempts[len(task.Attempts)-1].Workspace: true}
+	if task.SessionID != "" && m.sessionMgr != nil {
+		if ws, err := m.sessionMgr.GetWorkspace(task.SessionID); err == nil {
+			keep[ws] = true
+		}
+	}
+	for _, a := range task.Attempts {
+		// 只删除按任务生成的工作区（agent-{id}-{task}[-attempt-N]）
+		if !a.Retried || a.Workspace == "" || keep[a.Workspace] || !strings.Contains(filepath.Base(a.Workspace), task.ID) {
+			continue
+		}
+		if err := os.RemoveAll(a.Workspace); err != nil {
+			log.Warn("failed to remove attempt workspace", "task_id", task.ID, "workspace", a.Workspace, "error", err)
+		}
+	}
+}
+
+// failureMessage 最终失败的错误信息（经过多次尝试时汇总每次尝试）
+func failureMessage(task *Task, err error) string {
+	if len(task.Attempts) <= 1 {
+		return err.Error()
+	}
+	parts := make([]string, len(task.Attempts))
+	for i, a := range task.Attempts {
+		parts[i] = fmt.Sprintf("#%d [%s] %s", a.Number, a.Class, a.Error)
+	}
+	return fmt.Sprintf("failed after %d attempts: %s", len(task.Attempts), strings.Join(parts, "; "))
+}
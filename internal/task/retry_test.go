@@ -0,0 +1,157 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmalldedede/agentbox/internal/agent"
+	"github.com/tmalldedede/agentbox/internal/apperr"
+	"github.com/tmalldedede/agentbox/internal/engine"
+)
+
+func TestClassifyAttemptError(t *testing.T) {
+	assert.Equal(t, agent.RetryClassContainer,
+		classifyAttemptError(&sessionSetupError{errors.New("failed to start session: docker unavailable")}))
+	assert.Equal(t, string(apperr.ReasonTimeout), classifyAttemptError(fmt.Errorf("task timeout after %v", time.Minute)))
+	assert.Equal(t, string(apperr.ReasonRateLimit),
+		classifyAttemptError(fmt.Errorf("execution failed: %w", engine.NewEngineErrorFromHTTP(429, "slow down", "p", "m", "claude-code"))))
+	assert.Equal(t, string(apperr.ReasonUnknown), classifyAttemptError(errors.New("boom")))
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := &agent.RetryPolicy{MaxAttempts: 5, InitialBackoff: 10, MaxBackoff: 30, Jitter: 0.1}
+	for attempt, base := range map[int]float64{1: 10, 2: 20, 3: 30, 4: 30} {
+		d := retryBackoff(p, attempt).Seconds()
+		assert.InDelta(t, base, d, base*0.1+0.001, "attempt %d", attempt)
+	}
+}
+
+func TestRetryPolicy_Validate(t *testing.T) {
+	assert.NoError(t, (&agent.RetryPolicy{MaxAttempts: 3, RetryOn: []string{"timeout", "container"}}).Validate())
+	for _, p := range []*agent.RetryPolicy{
+		{MaxAttempts: agent.MaxRetryAttempts + 1},
+		{MaxAttempts: 3, Jitter: 2},
+		{MaxAttempts: 3, Multiplier: 0.5},
+		{MaxAttempts: 3, RetryOn: []string{"cosmic_rays"}},
+	} {
+		assert.Error(t, p.Validate(), "%+v", p)
+	}
+}
+
+func TestTaskWorkspace(t *testing.T) {
+	ag := &agent.Agent{ID: "a1"}
+	task := &Task{ID: "task-1", Retry: &agent.RetryPolicy{MaxAttempts: 3}}
+	assert.Equal(t, "agent-a1-task-1", taskWorkspace(task, ag))
+
+	task.Attempts = []Attempt{{Number: 1}}
+	assert.Equal(t, "agent-a1-task-1-attempt-2", taskWorkspace(task, ag))
+
+	task.Retry.ReuseWorkspace = true
+	assert.Equal(t, "agent-a1-task-1", taskWorkspace(task, ag))
+
+	ag.Workspace = "shared"
+	task.Retry.ReuseWorkspace = false
+	assert.Equal(t, "shared", taskWorkspace(task, ag))
+}
+
+func newRunningTask(t *testing.T, m *Manager, policy *agent.RetryPolicy) *Task {
+	t.Helper()
+	now := time.Now()
+	task := &Task{
+		ID: "task-retry", AgentID: "test-agent", Prompt: "p", Status: StatusRunning,
+		Turns: []Turn{{ID: "turn-1", Prompt: "p"}}, TurnCount: 1,
+		Retry: policy, SessionID: "sess-1", StartedAt: &now, CreatedAt: now,
+	}
+	require.NoError(t, m.store.Create(task))
+	return task
+}
+
+func TestHandleAttemptFailure_Requeue(t *testing.T) {
+	m := setupWorkflowManager(t)
+	task := newRunningTask(t, m, &agent.RetryPolicy{MaxAttempts: 2, InitialBackoff: 60})
+	events := m.SubscribeEvents(task.ID)
+
+	start := time.Now()
+	require.True(t, m.handleAttemptFailure(context.Background(), task, errors.New("task timeout after 30m0s"), start))
+
+	got, err := m.GetTask(task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusQueued, got.Status)
+	require.NotNil(t, got.RunAt)
+	assert.True(t, got.RunAt.After(start.Add(45*time.Second)), "run_at should be delayed by the backoff")
+	assert.Empty(t, got.SessionID)
+	require.Len(t, got.Attempts, 1)
+	assert.Equal(t, 1, got.Attempts[0].Number)
+	assert.Equal(t, "timeout", got.Attempts[0].Class)
+	assert.Equal(t, "sess-1", got.Attempts[0].SessionID)
+	assert.True(t, got.Attempts[0].Retried)
+	assert.Equal(t, "task.retrying", (<-events).Type)
+
+	// 第二次失败：次数用尽，不再重试，失败信息汇总所有尝试
+	err = errors.New("connection refused")
+	assert.False(t, m.handleAttemptFailure(context.Background(), got, err, time.Now()))
+	require.Len(t, got.Attempts, 2)
+	assert.False(t, got.Attempts[1].Retried)
+	assert.Equal(t, "failed after 2 attempts: #1 [timeout] task timeout after 30m0s; #2 [network_error] connection refused",
+		failureMessage(got, err))
+}
+
+func TestHandleAttemptFailure_NoRetry(t *testing.T) {
+	m := setupWorkflowManager(t)
+
+	// 不可重试的错误分类
+	task := newRunningTask(t, m, &agent.RetryPolicy{MaxAttempts: 3})
+	assert.False(t, m.handleAttemptFailure(context.Background(), task, errors.New("invalid api key"), time.Now()))
+	require.Len(t, task.Attempts, 1)
+	assert.Equal(t, "auth_failed", task.Attempts[0].Class)
+	assert.Equal(t, "invalid api key", failureMessage(task, errors.New("invalid api key")))
+
+	// 已取消的执行不重试
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	task.Attempts = nil
+	assert.False(t, m.handleAttemptFailure(ctx, task, errors.New("task cancelled timeout"), time.Now()))
+
+	// 未配置策略：不记录尝试
+	task.Retry = nil
+	task.Attempts = nil
+	assert.False(t, m.handleAttemptFailure(context.Background(), task, errors.New("timeout"), time.Now()))
+	assert.Empty(t, task.Attempts)
+}
+
+func TestRemoveAttemptWorkspaces(t *testing.T) {
+	base := t.TempDir()
+	dir := func(name string) string {
+		p := filepath.Join(base, name)
+		require.NoError(t, os.MkdirAll(p, 0755))
+		return p
+	}
+	first, second, last := dir("agent-a1-task-1"), dir("agent-a1-task-1-attempt-2"), dir("agent-a1-task-1-attempt-3")
+	shared := dir("shared")
+
+	m := &Manager{}
+	m.removeAttemptWorkspaces(&Task{ID: "task-1", Attempts: []Attempt{
+		{Number: 1, Retried: true, Workspace: first},
+		{Number: 2, Retried: true, Workspace: second},
+		{Number: 3, Retried: true, Workspace: shared}, // 非按任务生成的工作区不删除
+		{Number: 4, Workspace: last},
+	}})
+	assert.NoDirExists(t, first)
+	assert.NoDirExists(t, second)
+	assert.DirExists(t, shared)
+	assert.DirExists(t, last)
+
+	// 沿用工作区：各次尝试路径相同，保留
+	m.removeAttemptWorkspaces(&Task{ID: "task-1", Attempts: []Attempt{
+		{Number: 1, Retried: true, Workspace: last},
+		{Number: 2, Retried: true, Workspace: last},
+	}})
+	assert.DirExists(t, last)
+}
@@ -0,0 +1,245 @@
+package task
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// schedulerWindow 每轮调度每个（优先级, 用户）分组最多考察的排队任务数
+//
+// 按分组取队首而不是全局按创建时间取前 N 个，避免大量早期的低优先级任务或单个用户的积压
+// 挡住较新的高优先级任务与其他用户的任务。
+const schedulerWindow = 100
+
+// SchedulingPolicy 调度策略（可运行时修改）
+type SchedulingPolicy struct {
+	MaxConcurrent int            // 全局最大并发（本实例），0 表示使用 ManagerConfig.MaxConcurrent
+	MaxPerUser    int            // 单用户最大并发，0 表示不限
+	MaxPerAgent   int            // 单 Agent 最大并发，0 表示不限
+	UserWeights   map[string]int // 用户权重（加权轮询），未配置的用户权重为 1
+}
+
+// PolicyFunc 调度策略提供者，每轮调度调用一次以获取最新配置
+type PolicyFunc func() *SchedulingPolicy
+
+// fairScheduler 公平调度器
+//
+// 调度顺序：
+//  1. 优先级通道严格有序：high → normal → low
+//  2. 同一通道内按用户做平滑加权轮询（smooth weighted round-robin），
+//     每个用户内部有截止时间的任务优先（越近越先），其余按创建时间 FIFO
+//  3. 达到单用户 / 单 Agent 并发上限的任务被跳过，留给下一轮
+type fairScheduler struct {
+	mu      sync.Mutex
+	credits map[string]int // userID → 当前权重（跨轮次保留，保证长期公平）
+}
+
+func newFairScheduler() *fairScheduler {
+	return &fairScheduler{credits: make(map[string]int)}
+}
+
+// pick 从排队任务中按公平策略选出至多 slots 个可执行的任务
+// queued 需按创建时间升序；running 用于计算单用户 / 单 Agent 的当前并发
+func (f *fairScheduler) pick(queued, running []*Task, policy *SchedulingPolicy, slots int) []*Task {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.order(queued, running, policy, slots, f.credits, true)
+}
+
+// estimate 模拟完整的调度顺序（不应用并发上限、不修改调度状态），用于计算排队位置
+func (f *fairScheduler) estimate(queued []*Task, policy *SchedulingPolicy) []*Task {
+	f.mu.Lock()
+	credits := make(map[string]int, len(f.credits))
+	for k, v := range f.credits {
+		credits[k] = v
+	}
+	f.mu.Unlock()
+	return f.order(queued, nil, policy, len(queued), credits, false)
+}
+
+func (f *fairScheduler) order(queued, running []*Task, policy *SchedulingPolicy, slots int, credits map[string]int, applyCaps bool) []*Task {
+	userRunning := make(map[string]int)
+	agentRunning := make(map[string]int)
+	for _, t := range running {
+		userRunning[t.UserID]++
+		agentRunning[t.AgentID]++
+	}
+
+	// 按通道 → 用户分组，保持 FIFO
+	lanes := make(map[Priority]map[string][]*Task)
+	var userOrder []string // 用户首次出现的顺序，用于权重相同时的稳定选择
+	seen := make(map[string]bool)
+	for _, t := range queued {
+		lane := t.Priority
+		if !lane.IsValid() {
+			lane = PriorityNormal
+		}
+		if lanes[lane] == nil {
+			lanes[lane] = make(map[string][]*Task)
+		}
+		lanes[lane][t.UserID] = append(lanes[lane][t.UserID], t)
+		if !seen[t.UserID] {
+			seen[t.UserID] = true
+			userOrder = append(userOrder, t.UserID)
+		}
+	}
+
+	// 用户内部：截止时间近的任务优先，其余保持 FIFO
+	for _, users := range lanes {
+		for _, tasks := range users {
+			sort.SliceStable(tasks, func(i, j int) bool { return deadlineBefore(tasks[i], tasks[j]) })
+		}
+	}
+
+	// nextFor 返回用户在当前通道中第一个未被并发上限阻塞的任务下标
+	nextFor := func(tasks []*Task) int {
+		for i, t := range tasks {
+			if applyCaps && policy.MaxPerAgent > 0 && agentRunning[t.AgentID] >= policy.MaxPerAgent {
+				continue
+			}
+			return i
+		}
+		return -1
+	}
+
+	var picked []*Task
+	for _, lane := range priorityLanes {
+		users := lanes[lane]
+		for len(picked) < slots {
+			// 收集本通道内可调度的用户
+			var candidates []string
+			for _, u := range userOrder {
+				if len(users[u]) == 0 {
+					continue
+				}
+				if applyCaps && policy.MaxPerUser > 0 && userRunning[u] >= policy.MaxPerUser {
+					continue
+				}
+				if nextFor(users[u]) < 0 {
+					continue
+				}
+				candidates = append(candidates, u)
+			}
+			if len(candidates) == 0 {
+				break
+			}
+
+			// 平滑加权轮询：所有候选加上自身权重，选最大者，再减去总权重
+			total := 0
+			chosen := ""
+			best := math.MinInt
+			for _, u := range candidates {
+				w := policy.weight(u)
+				credits[u] += w
+				total += w
+				if credits[u] > best {
+					best = credits[u]
+					chosen = u
+				}
+			}
+			credits[chosen] -= total
+
+			idx := nextFor(users[chosen])
+			t := users[chosen][idx]
+			users[chosen] = append(users[chosen][:idx], users[chosen][idx+1:]...)
+			picked = append(picked, t)
+			userRunning[t.UserID]++
+			agentRunning[t.AgentID]++
+		}
+	}
+
+	// 清理已无排队任务的用户的权重，避免 map 无限增长
+	if applyCaps {
+		for u := range credits {
+			if !seen[u] {
+				delete(credits, u)
+			}
+		}
+	}
+	return picked
+}
+
+// weight 获取用户权重
+func (p *SchedulingPolicy) weight(userID string) int {
+	if w, ok := p.UserWeights[userID]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+// SetSchedulingPolicy 设置调度策略提供者（如从 settings.TaskSettings 读取）
+func (m *Manager) SetSchedulingPolicy(fn PolicyFunc) {
+	m.policyFunc = fn
+}
+
+// schedulingPolicy 获取当前调度策略
+func (m *Manager) schedulingPolicy() *SchedulingPolicy {
+	policy := &SchedulingPolicy{}
+	if m.policyFunc != nil {
+		if p := m.policyFunc(); p != nil {
+			policy = p
+		}
+	}
+	if policy.MaxConcurrent <= 0 {
+		policy.MaxConcurrent = m.maxConcurrent
+	}
+	return policy
+}
+
+// FillQueueInfo 为排队中的任务计算排队位置和预计开始时间
+func (m *Manager) FillQueueInfo(tasks ...*Task) {
+	pending := false
+	for _, t := range tasks {
+		if t.Status == StatusQueued {
+			pending = true
+			break
+		}
+	}
+	if !pending {
+		return
+	}
+
+	now := time.Now()
+	queued, err := m.store.ListQueueHeads(now, schedulerWindow)
+	if err != nil {
+		log.Warn("failed to list queued tasks for queue info", "error", err)
+		return
+	}
+
+	policy := m.schedulingPolicy()
+	order := m.fair.estimate(queued, policy)
+	position := make(map[string]int, len(order))
+	for i, t := range order {
+		position[t.ID] = i + 1
+	}
+
+	// 预计开始时间 = 排在前面的批次数 × 平均执行时长
+	var avg time.Duration
+	if stats, err := m.store.Stats(nil); err == nil && stats.AvgDuration > 0 {
+		avg = time.Duration(stats.AvgDuration * float64(time.Second))
+	}
+
+	for _, t := range tasks {
+		if t.Status != StatusQueued {
+			continue
+		}
+		// 延迟任务：run_at 之前不会被调度
+		if t.RunAt != nil && t.RunAt.After(now) {
+			runAt := *t.RunAt
+			t.EstimatedStartAt = &runAt
+			continue
+		}
+		pos, ok := position[t.ID]
+		if !ok {
+			continue
+		}
+		t.QueuePosition = pos
+		if avg > 0 {
+			waves := (pos - 1) / policy.MaxConcurrent
+			eta := now.Add(time.Duration(waves) * avg)
+			t.EstimatedStartAt = &eta
+		}
+	}
+}
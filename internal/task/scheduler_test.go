@@ -0,0 +1,117 @@
+package task
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func queuedTasks(userID, agentID string, priority Priority, n int, base time.Time) []*Task {
+	tasks := make([]*Task, n)
+	for i := range tasks {
+		tasks[i] = &Task{
+			ID:        fmt.Sprintf("%s-%s-%d", userID, priority, i),
+			UserID:    userID,
+			AgentID:   agentID,
+			Priority:  priority,
+			Status:    StatusQueued,
+			CreatedAt: base.Add(time.Duration(i) * time.Second),
+		}
+	}
+	return tasks
+}
+
+func pickedUsers(tasks []*Task) []string {
+	users := make([]string, len(tasks))
+	for i, t := range tasks {
+		users[i] = t.UserID
+	}
+	return users
+}
+
+func TestFairScheduler_RoundRobinBetweenUsers(t *testing.T) {
+	now := time.Now()
+	// alice 先提交了大量任务，bob 随后提交
+	queued := append(queuedTasks("alice", "agent-1", PriorityNormal, 50, now),
+		queuedTasks("bob", "agent-1", PriorityNormal, 2, now.Add(time.Hour))...)
+
+	f := newFairScheduler()
+	picked := f.pick(queued, nil, &SchedulingPolicy{}, 4)
+	assert.Equal(t, []string{"alice", "bob", "alice", "bob"}, pickedUsers(picked))
+	assert.Equal(t, "alice-normal-0", picked[0].ID)
+	assert.Equal(t, "alice-normal-1", picked[2].ID)
+}
+
+func TestFairScheduler_UserWeights(t *testing.T) {
+	now := time.Now()
+	queued := append(queuedTasks("alice", "agent-1", PriorityNormal, 10, now),
+		queuedTasks("bob", "agent-1", PriorityNormal, 10, now)...)
+
+	f := newFairScheduler()
+	picked := f.pick(queued, nil, &SchedulingPolicy{UserWeights: map[string]int{"bob": 3}}, 8)
+
+	counts := map[string]int{}
+	for _, t := range picked {
+		counts[t.UserID]++
+	}
+	assert.Equal(t, 2, counts["alice"])
+	assert.Equal(t, 6, counts["bob"])
+}
+
+func TestFairScheduler_PriorityLanes(t *testing.T) {
+	now := time.Now()
+	queued := append(queuedTasks("alice", "agent-1", PriorityLow, 3, now),
+		queuedTasks("bob", "agent-1", PriorityNormal, 1, now.Add(time.Minute))...)
+	queued = append(queued, queuedTasks("carol", "agent-1", PriorityHigh, 1, now.Add(2*time.Minute))...)
+
+	f := newFairScheduler()
+	picked := f.pick(queued, nil, &SchedulingPolicy{}, 3)
+	assert.Equal(t, []string{"carol", "bob", "alice"}, pickedUsers(picked))
+}
+
+func TestFairScheduler_ConcurrencyCaps(t *testing.T) {
+	now := time.Now()
+	queued := append(queuedTasks("alice", "agent-1", PriorityNormal, 5, now),
+		queuedTasks("bob", "agent-2", PriorityNormal, 5, now)...)
+	running := []*Task{
+		{ID: "r1", UserID: "alice", AgentID: "agent-1", Status: StatusRunning},
+	}
+
+	f := newFairScheduler()
+
+	// 单用户上限 2：alice 已有 1 个在运行，只能再领 1 个
+	picked := f.pick(queued, running, &SchedulingPolicy{MaxPerUser: 2}, 10)
+	counts := map[string]int{}
+	for _, t := range picked {
+		counts[t.UserID]++
+	}
+	assert.Equal(t, 1, counts["alice"])
+	assert.Equal(t, 2, counts["bob"])
+
+	// 单 Agent 上限 1：agent-1 已满，只调度 agent-2
+	picked = f.pick(queued, running, &SchedulingPolicy{MaxPerAgent: 1}, 10)
+	require.Len(t, picked, 1)
+	assert.Equal(t, "agent-2", picked[0].AgentID)
+}
+
+func TestFillQueueInfo(t *testing.T) {
+	m := setupWorkflowManager(t)
+	now := time.Now()
+
+	for _, task := range append(queuedTasks("alice", "test-agent", PriorityNormal, 3, now),
+		queuedTasks("bob", "test-agent", PriorityHigh, 1, now.Add(time.Minute))...) {
+		require.NoError(t, m.store.Create(task))
+	}
+
+	bob, err := m.GetTask("bob-high-0")
+	require.NoError(t, err)
+	alice, err := m.GetTask("alice-normal-2")
+	require.NoError(t, err)
+
+	m.FillQueueInfo(bob, alice)
+	assert.Equal(t, 1, bob.QueuePosition)
+	assert.Equal(t, 4, alice.QueuePosition)
+}
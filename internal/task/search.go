@@ -0,0 +1,154 @@
+package task
+
+import (
+	"strings"
+	"time"
+
+	"github.com/tmalldedede/agentbox/internal/search"
+)
+
+// SearchIndexer 全文检索索引（任务写入后同步）
+type SearchIndexer interface {
+	// ReplaceTask 替换任务的全部文档（任务 / 轮次 / 结果）
+	ReplaceTask(taskID string, docs []search.Document) error
+	// DeleteTask 删除任务的全部文档
+	DeleteTask(taskID string) error
+	// PruneTasks 删除已不存在的任务的文档（批量清理后调用）
+	PruneTasks() error
+}
+
+// SetSearchIndexer 设置全文检索索引：包装任务存储，任务写入时同步更新索引
+func (m *Manager) SetSearchIndexer(indexer SearchIndexer) {
+	m.searchIndexer = indexer
+	m.store = &indexedStore{Store: m.store, indexer: indexer}
+}
+
+// ReindexSearch 重建所有任务的检索文档（用于索引为空时回填已有数据）
+func (m *Manager) ReindexSearch() (int, error) {
+	if m.searchIndexer == nil {
+		return 0, nil
+	}
+	const pageSize = 200
+	count := 0
+	for offset := 0; ; offset += pageSize {
+		tasks, err := m.store.List(&ListFilter{Limit: pageSize, Offset: offset, OrderBy: "created_at"})
+		if err != nil {
+			return count, err
+		}
+		for _, t := range tasks {
+			if err := m.searchIndexer.ReplaceTask(t.ID, searchDocuments(t)); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if len(tasks) < pageSize {
+			return count, nil
+		}
+	}
+}
+
+// searchDocuments 任务的检索文档：任务 prompt、追加轮次的 prompt、每轮结果文本
+func searchDocuments(task *Task) []search.Document {
+	doc := func(kind search.Kind, refID, turnID, content string, createdAt time.Time) search.Document {
+		return search.Document{
+			ID:        search.DocumentID(kind, refID),
+			Kind:      kind,
+			TaskID:    task.ID,
+			TurnID:    turnID,
+			UserID:    task.UserID,
+			AgentID:   task.AgentID,
+			Status:    string(task.Status),
+			Content:   content,
+			CreatedAt: createdAt,
+		}
+	}
+
+	docs := []search.Document{doc(search.KindTask, task.ID, "", task.Prompt, task.CreatedAt)}
+	for i, turn := range task.Turns {
+		if i > 0 && strings.TrimSpace(turn.Prompt) != "" {
+			docs = append(docs, doc(search.KindTurn, turn.ID, turn.ID, turn.Prompt, turn.CreatedAt))
+		}
+		if turn.Result != nil && strings.TrimSpace(turn.Result.Text) != "" {
+			docs = append(docs, doc(search.KindResult, turn.ID, turn.ID, turn.Result.Text, turn.CreatedAt))
+		}
+	}
+	return docs
+}
+
+// indexedStore 在写操作后同步全文检索索引（索引失败只记录日志，不影响任务写入）
+type indexedStore struct {
+	Store
+	indexer SearchIndexer
+}
+
+func (s *indexedStore) index(tasks ...*Task) {
+	for _, t := range tasks {
+		if err := s.indexer.ReplaceTask(t.ID, searchDocuments(t)); err != nil {
+			log.Warn("failed to index task for search", "task_id", t.ID, "error", err)
+		}
+	}
+}
+
+func (s *indexedStore) Create(task *Task) error {
+	if err := s.Store.Create(task); err != nil {
+		return err
+	}
+	s.index(task)
+	return nil
+}
+
+func (s *indexedStore) Update(task *Task) error {
+	if err := s.Store.Update(task); err != nil {
+		return err
+	}
+	s.index(task)
+	return nil
+}
+
+func (s *indexedStore) Delete(id string) error {
+	if err := s.Store.Delete(id); err != nil {
+		return err
+	}
+	if err := s.indexer.DeleteTask(id); err != nil {
+		log.Warn("failed to remove task from search index", "task_id", id, "error", err)
+	}
+	return nil
+}
+
+func (s *indexedStore) Cleanup(before time.Time, statuses []Status) (int, error) {
+	n, err := s.Store.Cleanup(before, statuses)
+	if err == nil && n > 0 {
+		if err := s.indexer.PruneTasks(); err != nil {
+			log.Warn("failed to prune search index", "error", err)
+		}
+	}
+	return n, err
+}
+
+func (s *indexedStore) ClaimQueued(limit int, instanceID string) ([]*Task, error) {
+	tasks, err := s.Store.ClaimQueued(limit, instanceID)
+	s.index(tasks...)
+	return tasks, err
+}
+
+func (s *indexedStore) ClaimTasks(ids []string, instanceID string) ([]*Task, error) {
+	tasks, err := s.Store.ClaimTasks(ids, instanceID)
+	s.index(tasks...)
+	return tasks, err
+}
+
+func (s *indexedStore) ExpireQueued(now time.Time, reason string) ([]*Task, error) {
+	tasks, err := s.Store.ExpireQueued(now, reason)
+	s.index(tasks...)
+	return tasks, err
+}
+
+func (s *indexedStore) UpdateStatus(id string, from, to Status) (bool, error) {
+	ok, err := s.Store.UpdateStatus(id, from, to)
+	if ok {
+		if task, err := s.Store.Get(id); err == nil {
+			s.index(task)
+		}
+	}
+	return ok, err
+}
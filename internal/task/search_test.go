@@ -0,0 +1,66 @@
+package task
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmalldedede/agentbox/internal/search"
+)
+
+func TestSearchIndexer_SyncsTaskWrites(t *testing.T) {
+	m := setupWorkflowManager(t)
+	idx, err := search.NewIndex(m.store.(*GormStore).db)
+	require.NoError(t, err)
+	m.SetSearchIndexer(idx)
+
+	now := time.Now()
+	task := &Task{
+		ID: "task-search", UserID: "alice", AgentID: "test-agent", Prompt: "migrate the invoice exporter",
+		Status: StatusRunning, Turns: []Turn{{ID: "turn-1", Prompt: "migrate the invoice exporter"}},
+		TurnCount: 1, CreatedAt: now,
+	}
+	require.NoError(t, m.store.Create(task))
+
+	res, err := idx.Search(&search.Query{Text: "invoice"})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, res.Total)
+	assert.Equal(t, search.KindTask, res.Hits[0].Kind)
+
+	// 结果与追加轮次写入后可检索，状态同步
+	task.Turns[0].Result = &Result{Text: "exporter now streams CSV rows"}
+	task.Turns = append(task.Turns, Turn{ID: "turn-2", Prompt: "also gzip the CSV output"})
+	task.Status = StatusCompleted
+	require.NoError(t, m.store.Update(task))
+
+	res, err = idx.Search(&search.Query{Text: "CSV", Status: string(StatusCompleted), UserID: "alice"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, res.Total)
+
+	require.NoError(t, m.store.Delete(task.ID))
+	res, err = idx.Search(&search.Query{Text: "invoice"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, res.Total)
+}
+
+func TestReindexSearch(t *testing.T) {
+	m := setupWorkflowManager(t)
+	for _, id := range []string{"task-a", "task-b"} {
+		require.NoError(t, m.store.Create(&Task{
+			ID: id, AgentID: "test-agent", Prompt: "rotate the signing keys", Status: StatusQueued, CreatedAt: time.Now(),
+		}))
+	}
+
+	idx, err := search.NewIndex(m.store.(*GormStore).db)
+	require.NoError(t, err)
+	m.SetSearchIndexer(idx)
+	require.True(t, idx.Empty())
+
+	n, err := m.ReindexSearch()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	res, err := idx.Search(&search.Query{Text: "signing"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, res.Total)
+}
@@ -2,6 +2,8 @@ package task
 
 import (
 	"time"
+
+	"github.com/tmalldedede/agentbox/internal/labels"
 )
 
 // TaskStats 任务统计
@@ -10,6 +12,15 @@ type TaskStats struct {
 	ByStatus    map[Status]int `json:"by_status"`
 	ByAgent     map[string]int `json:"by_agent"`
 	AvgDuration float64        `json:"avg_duration_seconds"` // 已完成任务平均耗时
+
+	// 按标签统计：key -> value -> 任务数（每个键保留任务数最多的取值）
+	ByLabel map[string]map[string]int `json:"by_label"`
+
+	// Token 使用（所有任务累计）
+	InputTokens       int64 `json:"input_tokens"`
+	CachedInputTokens int64 `json:"cached_input_tokens"`
+	OutputTokens      int64 `json:"output_tokens"`
+	TotalTokens       int64 `json:"total_tokens"`
 }
 
 // Store 任务存储接口
@@ -26,24 +37,41 @@ type Store interface {
 	List(filter *ListFilter) ([]*Task, error)
 	// Count 统计任务数量
 	Count(filter *ListFilter) (int, error)
-	// Stats 获取任务统计
-	Stats() (*TaskStats, error)
+	// Stats 获取任务统计（filter 为空时统计全部任务，分页与排序字段忽略）
+	Stats(filter *ListFilter) (*TaskStats, error)
+	// SetLabels 替换任务的标签
+	SetLabels(id string, values map[string]string) error
 	// Cleanup 清理旧任务
 	Cleanup(before time.Time, statuses []Status) (int, error)
-	// ClaimQueued 原子领取等待中的任务（用于多实例调度）
-	ClaimQueued(limit int) ([]*Task, error)
+	// ClaimQueued 原子领取等待中的任务并记录执行实例（用于多实例调度）
+	ClaimQueued(limit int, instanceID string) ([]*Task, error)
+	// ListQueueHeads 按（优先级, 用户）分组列出可调度的排队任务，每组最多 perGroup 个
+	// （组内截止时间近的优先，其余按创建时间 FIFO），供调度器在各通道、各用户间公平选择
+	ListQueueHeads(readyAt time.Time, perGroup int) ([]*Task, error)
+	// ClaimTasks 原子领取指定的等待中任务并记录执行实例（调度器按公平策略选出后领取）
+	ClaimTasks(ids []string, instanceID string) ([]*Task, error)
+	// ExpireQueued 原子地将已过截止时间的等待中任务标记为失败，返回被标记的任务
+	ExpireQueued(now time.Time, reason string) ([]*Task, error)
+	// UpdateStatus 条件更新任务状态（仅当前状态为 from 时更新），返回是否更新成功
+	UpdateStatus(id string, from, to Status) (bool, error)
+	// ReassignInstance 条件更新任务的执行实例（仅当仍属于 from 且状态为 status 时更新），返回是否更新成功
+	ReassignInstance(id, from, to string, status Status) (bool, error)
 	// Close 关闭存储
 	Close() error
 }
 
 // ListFilter 列表过滤器
 type ListFilter struct {
-	UserID    string   // 按用户过滤（空则不过滤）
-	Status    []Status // 按状态过滤
-	AgentID   string   // 按 Agent 过滤
-	Search    string   // 搜索 prompt 关键字
-	Limit     int      // 限制数量
-	Offset    int      // 偏移量
-	OrderBy   string   // 排序字段：created_at, started_at, completed_at
-	OrderDesc bool     // 是否降序
+	UserID    string          // 按用户过滤（空则不过滤）
+	Status    []Status        // 按状态过滤
+	AgentID   string          // 按 Agent 过滤
+	Search    string          // 搜索 prompt 关键字
+	Labels    labels.Selector // 标签选择器
+	Limit     int             // 限制数量
+	Offset    int             // 偏移量
+	OrderBy   string          // 排序字段：created_at, started_at, completed_at
+	OrderDesc bool            // 是否降序
+
+	ReadyAt        *time.Time // 仅返回在该时刻可调度的任务（run_at 已到且未过截止时间）
+	DeadlineBefore *time.Time // 仅返回截止时间早于该时刻的任务
 }
@@ -0,0 +1,407 @@
+package task
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tmalldedede/agentbox/internal/apperr"
+	"github.com/tmalldedede/agentbox/internal/eval"
+)
+
+// ErrTemplateNotFound 任务模板不存在
+var ErrTemplateNotFound = apperr.NotFound("task template")
+
+// ParamType 模板参数类型
+type ParamType string
+
+const (
+	ParamString  ParamType = "string"
+	ParamNumber  ParamType = "number"
+	ParamInteger ParamType = "integer"
+	ParamBoolean ParamType = "boolean"
+)
+
+// TemplateParameter 模板参数定义
+type TemplateParameter struct {
+	Name        string      `json:"name"`           // 在模板中以 {{.<name>}} 引用
+	Type        ParamType   `json:"type,omitempty"` // 默认 string
+	Description string      `json:"description,omitempty"`
+	Required    bool        `json:"required,omitempty"`
+	Default     interface{} `json:"default,omitempty"` // 未传入时使用
+	Options     []string    `json:"options,omitempty"` // 可选值（仅 string 类型）
+}
+
+// TaskTemplate 可复用的参数化任务模板
+//
+// Prompt 为 text/template 模板，语法与批量任务的 prompt_template 相同（{{.field}}）。
+type TaskTemplate struct {
+	ID                  string              `json:"id"`
+	UserID              string              `json:"user_id,omitempty"`
+	Name                string              `json:"name"`
+	Description         string              `json:"description,omitempty"`
+	AgentID             string              `json:"agent_id"`
+	Prompt              string              `json:"prompt"`
+	Parameters          []TemplateParameter `json:"parameters,omitempty"`
+	RequiredAttachments int                 `json:"required_attachments,omitempty"` // 创建任务时至少需要的附件数
+	Timeout             int                 `json:"timeout,omitempty"`              // 秒，0 表示使用默认
+	Evaluators          []eval.Evaluator    `json:"evaluators,omitempty"`           // 结果评估器，创建任务时复制到任务上
+	Version             int                 `json:"version"`                        // 每次更新递增
+	CreatedAt           time.Time           `json:"created_at"`
+	UpdatedAt           time.Time           `json:"updated_at"`
+}
+
+// CreateTemplateRequest 创建 / 更新任务模板请求
+type CreateTemplateRequest struct {
+	Name                string              `json:"name" binding:"required"`
+	Description         string              `json:"description,omitempty"`
+	AgentID             string              `json:"agent_id" binding:"required"`
+	Prompt              string              `json:"prompt" binding:"required"`
+	Parameters          []TemplateParameter `json:"parameters,omitempty"`
+	RequiredAttachments int                 `json:"required_attachments,omitempty"`
+	Timeout             int                 `json:"timeout,omitempty"`
+	Evaluators          []eval.Evaluator    `json:"evaluators,omitempty"`
+	UserID              string              `json:"-"` // 由中间件注入
+}
+
+// TemplateStore 任务模板存储接口
+type TemplateStore interface {
+	CreateTemplate(tpl *TaskTemplate) error
+	GetTemplate(id string) (*TaskTemplate, error)
+	UpdateTemplate(tpl *TaskTemplate) error
+	DeleteTemplate(id string) error
+	// ListTemplates 列出模板，userID 为空表示全部
+	ListTemplates(userID string) ([]*TaskTemplate, error)
+}
+
+// parseTemplatePrompt 解析模板 prompt（引用未传入的字段时报错）
+func parseTemplatePrompt(prompt string) (*template.Template, error) {
+	return template.New("prompt").Option("missingkey=error").Parse(prompt)
+}
+
+// validate 校验模板定义
+func (t *TaskTemplate) validate() error {
+	if t.Name == "" {
+		return apperr.Validation("name is required")
+	}
+	if t.AgentID == "" {
+		return apperr.Validation("agent_id is required")
+	}
+	if t.Prompt == "" {
+		return apperr.Validation("prompt is required")
+	}
+	if _, err := parseTemplatePrompt(t.Prompt); err != nil {
+		return apperr.Validationf("invalid prompt template: %v", err)
+	}
+	if t.RequiredAttachments < 0 {
+		return apperr.Validation("required_attachments must be >= 0")
+	}
+	if t.Timeout < 0 {
+		return apperr.Validation("timeout must be >= 0")
+	}
+	if err := eval.Validate(t.Evaluators); err != nil {
+		return apperr.Validation(err.Error())
+	}
+
+	seen := make(map[string]bool, len(t.Parameters))
+	for i := range t.Parameters {
+		p := &t.Parameters[i]
+		if !stepIDPattern.MatchString(p.Name) {
+			return apperr.Validationf("invalid parameter name %q: must match %s", p.Name, stepIDPattern)
+		}
+		if seen[p.Name] {
+			return apperr.Validationf("duplicate parameter: %s", p.Name)
+		}
+		seen[p.Name] = true
+
+		if p.Type == "" {
+			p.Type = ParamString
+		}
+		switch p.Type {
+		case ParamString, ParamNumber, ParamInteger, ParamBoolean:
+		default:
+			return apperr.Validationf("parameter %s: unknown type %q (expected string, number, integer or boolean)", p.Name, p.Type)
+		}
+		if len(p.Options) > 0 && p.Type != ParamString {
+			return apperr.Validationf("parameter %s: options are only supported for string parameters", p.Name)
+		}
+		if p.Default != nil {
+			v, err := p.coerce(p.Default)
+			if err != nil {
+				return apperr.Validationf("parameter %s: invalid default: %v", p.Name, err)
+			}
+			p.Default = v
+		}
+	}
+	return nil
+}
+
+// coerce 将参数值转换为声明的类型（接受字符串形式的数字和布尔值，如来自 CSV 的输入）
+func (p *TemplateParameter) coerce(value interface{}) (interface{}, error) {
+	switch p.Type {
+	case ParamNumber:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case int:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		case string:
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("expected number, got %q", v)
+			}
+			return f, nil
+		}
+		return nil, fmt.Errorf("expected number, got %T", value)
+
+	case ParamInteger:
+		switch v := value.(type) {
+		case int:
+			return int64(v), nil
+		case int64:
+			return v, nil
+		case float64:
+			if v != math.Trunc(v) {
+				return nil, fmt.Errorf("expected integer, got %v", v)
+			}
+			return int64(v), nil
+		case string:
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("expected integer, got %q", v)
+			}
+			return n, nil
+		}
+		return nil, fmt.Errorf("expected integer, got %T", value)
+
+	case ParamBoolean:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("expected boolean, got %q", v)
+			}
+			return b, nil
+		}
+		return nil, fmt.Errorf("expected boolean, got %T", value)
+
+	default:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected string, got %T", value)
+		}
+		if len(p.Options) > 0 {
+			for _, opt := range p.Options {
+				if s == opt {
+					return s, nil
+				}
+			}
+			return nil, fmt.Errorf("%q is not one of %v", s, p.Options)
+		}
+		return s, nil
+	}
+}
+
+// BindParams 校验参数并补齐默认值，返回用于渲染的参数表
+//
+// 未声明的参数、缺少必填参数或类型不符时返回校验错误；
+// 未传入且无默认值的可选参数渲染为空字符串。
+func (t *TaskTemplate) BindParams(params map[string]interface{}) (map[string]interface{}, error) {
+	declared := make(map[string]bool, len(t.Parameters))
+	for _, p := range t.Parameters {
+		declared[p.Name] = true
+	}
+	for name := range params {
+		if !declared[name] {
+			return nil, apperr.Validationf("unknown parameter: %s", name)
+		}
+	}
+
+	bound := make(map[string]interface{}, len(t.Parameters))
+	for i := range t.Parameters {
+		p := &t.Parameters[i]
+		value, ok := params[p.Name]
+		switch {
+		case ok && value != nil:
+			v, err := p.coerce(value)
+			if err != nil {
+				return nil, apperr.Validationf("parameter %s: %v", p.Name, err)
+			}
+			bound[p.Name] = v
+		case p.Default != nil:
+			// 默认值经 JSON 持久化后数字会变为 float64，按声明类型重新转换
+			v, err := p.coerce(p.Default)
+			if err != nil {
+				return nil, apperr.Validationf("parameter %s: invalid default: %v", p.Name, err)
+			}
+			bound[p.Name] = v
+		case p.Required:
+			return nil, apperr.Validationf("missing required parameter: %s", p.Name)
+		default:
+			bound[p.Name] = ""
+		}
+	}
+	return bound, nil
+}
+
+// Render 校验参数并渲染 prompt
+func (t *TaskTemplate) Render(params map[string]interface{}) (string, error) {
+	bound, err := t.BindParams(params)
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := parseTemplatePrompt(t.Prompt)
+	if err != nil {
+		return "", apperr.Validationf("invalid prompt template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, bound); err != nil {
+		return "", apperr.Validationf("render template: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// ==================== Manager: 任务模板 ====================
+
+// SetTemplateStore 设置任务模板存储（未设置时模板功能不可用）
+func (m *Manager) SetTemplateStore(store TemplateStore) {
+	m.templateStore = store
+}
+
+// checkTemplateStore 检查模板存储是否可用
+func (m *Manager) checkTemplateStore() error {
+	if m.templateStore == nil {
+		return apperr.Unavailable("task template store not configured")
+	}
+	return nil
+}
+
+// buildTemplate 根据请求构建并校验模板
+func (m *Manager) buildTemplate(tpl *TaskTemplate, req *CreateTemplateRequest) error {
+	tpl.Name = req.Name
+	tpl.Description = req.Description
+	tpl.AgentID = req.AgentID
+	tpl.Prompt = req.Prompt
+	tpl.Parameters = req.Parameters
+	tpl.RequiredAttachments = req.RequiredAttachments
+	tpl.Timeout = req.Timeout
+	tpl.Evaluators = req.Evaluators
+	if err := tpl.validate(); err != nil {
+		return err
+	}
+	if m.agentMgr != nil {
+		if _, err := m.agentMgr.Get(tpl.AgentID); err != nil {
+			return apperr.Validationf("agent not found: %s", tpl.AgentID)
+		}
+	}
+	return nil
+}
+
+// CreateTemplate 创建任务模板
+func (m *Manager) CreateTemplate(req *CreateTemplateRequest) (*TaskTemplate, error) {
+	if err := m.checkTemplateStore(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	tpl := &TaskTemplate{
+		ID:        "tpl-" + uuid.New().String()[:8],
+		UserID:    req.UserID,
+		Version:   1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := m.buildTemplate(tpl, req); err != nil {
+		return nil, err
+	}
+	if err := m.templateStore.CreateTemplate(tpl); err != nil {
+		return nil, fmt.Errorf("failed to create task template: %w", err)
+	}
+
+	log.Info("task template created", "template_id", tpl.ID, "name", tpl.Name)
+	return tpl, nil
+}
+
+// UpdateTemplate 更新任务模板（版本号递增，已创建的任务保留原版本号）
+func (m *Manager) UpdateTemplate(id string, req *CreateTemplateRequest) (*TaskTemplate, error) {
+	if err := m.checkTemplateStore(); err != nil {
+		return nil, err
+	}
+	tpl, err := m.templateStore.GetTemplate(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.buildTemplate(tpl, req); err != nil {
+		return nil, err
+	}
+
+	tpl.Version++
+	tpl.UpdatedAt = time.Now()
+	if err := m.templateStore.UpdateTemplate(tpl); err != nil {
+		return nil, err
+	}
+	return tpl, nil
+}
+
+// GetTemplate 获取任务模板
+func (m *Manager) GetTemplate(id string) (*TaskTemplate, error) {
+	if err := m.checkTemplateStore(); err != nil {
+		return nil, err
+	}
+	return m.templateStore.GetTemplate(id)
+}
+
+// ListTemplates 列出任务模板（userID 为空表示全部）
+func (m *Manager) ListTemplates(userID string) ([]*TaskTemplate, error) {
+	if err := m.checkTemplateStore(); err != nil {
+		return nil, err
+	}
+	return m.templateStore.ListTemplates(userID)
+}
+
+// DeleteTemplate 删除任务模板（已创建的任务不受影响）
+func (m *Manager) DeleteTemplate(id string) error {
+	if err := m.checkTemplateStore(); err != nil {
+		return err
+	}
+	return m.templateStore.DeleteTemplate(id)
+}
+
+// applyTemplate 用模板填充新建任务请求：渲染 prompt，绑定 Agent，补齐默认超时并校验附件数
+func (m *Manager) applyTemplate(req *CreateTaskRequest) (*TaskTemplate, error) {
+	tpl, err := m.GetTemplate(req.TemplateID)
+	if err != nil {
+		return nil, err
+	}
+	if req.AgentID != "" && req.AgentID != tpl.AgentID {
+		return nil, apperr.BadRequestf("template %s is bound to agent %s", tpl.ID, tpl.AgentID)
+	}
+	if req.Prompt != "" {
+		return nil, apperr.BadRequest("prompt must be empty when creating a task from a template")
+	}
+	if len(req.Attachments) < tpl.RequiredAttachments {
+		return nil, apperr.BadRequestf("template %s requires at least %d attachment(s), got %d",
+			tpl.ID, tpl.RequiredAttachments, len(req.Attachments))
+	}
+
+	prompt, err := tpl.Render(req.Params)
+	if err != nil {
+		return nil, err
+	}
+	req.AgentID = tpl.AgentID
+	req.Prompt = prompt
+	if req.Timeout == 0 {
+		req.Timeout = tpl.Timeout
+	}
+	// 模板评估器在前，请求中额外指定的评估器在后
+	req.Evaluators = append(append([]eval.Evaluator{}, tpl.Evaluators...), req.Evaluators...)
+	return tpl, nil
+}
@@ -0,0 +1,139 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/tmalldedede/agentbox/internal/database"
+	"gorm.io/gorm"
+)
+
+// GormTemplateStore 任务模板 GORM 存储实现
+type GormTemplateStore struct {
+	db *gorm.DB
+}
+
+// NewGormTemplateStore 创建任务模板 GORM 存储
+func NewGormTemplateStore(db *gorm.DB) (*GormTemplateStore, error) {
+	if err := db.AutoMigrate(&database.TaskTemplateModel{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate task template table: %w", err)
+	}
+	return &GormTemplateStore{db: db}, nil
+}
+
+// CreateTemplate 创建任务模板
+func (s *GormTemplateStore) CreateTemplate(tpl *TaskTemplate) error {
+	return s.db.Create(templateToModel(tpl)).Error
+}
+
+// GetTemplate 获取任务模板
+func (s *GormTemplateStore) GetTemplate(id string) (*TaskTemplate, error) {
+	var model database.TaskTemplateModel
+	if err := s.db.First(&model, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrTemplateNotFound
+		}
+		return nil, err
+	}
+	return modelToTemplate(&model), nil
+}
+
+// UpdateTemplate 更新任务模板
+func (s *GormTemplateStore) UpdateTemplate(tpl *TaskTemplate) error {
+	model := templateToModel(tpl)
+	result := s.db.Model(&database.TaskTemplateModel{}).Where("id = ?", tpl.ID).Updates(map[string]interface{}{
+		"name":                 model.Name,
+		"description":          model.Description,
+		"agent_id":             model.AgentID,
+		"prompt":               model.Prompt,
+		"parameters_json":      model.ParametersJSON,
+		"required_attachments": model.RequiredAttachments,
+		"timeout":              model.Timeout,
+		"evaluators_json":      model.EvaluatorsJSON,
+		"version":              model.Version,
+		"updated_at":           model.UpdatedAt,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTemplateNotFound
+	}
+	return nil
+}
+
+// DeleteTemplate 删除任务模板
+func (s *GormTemplateStore) DeleteTemplate(id string) error {
+	result := s.db.Delete(&database.TaskTemplateModel{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTemplateNotFound
+	}
+	return nil
+}
+
+// ListTemplates 列出任务模板（userID 为空表示全部）
+func (s *GormTemplateStore) ListTemplates(userID string) ([]*TaskTemplate, error) {
+	query := s.db.Order("created_at DESC")
+	if userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var models []database.TaskTemplateModel
+	if err := query.Find(&models).Error; err != nil {
+		return nil, err
+	}
+
+	templates := make([]*TaskTemplate, len(models))
+	for i := range models {
+		templates[i] = modelToTemplate(&models[i])
+	}
+	return templates, nil
+}
+
+func templateToModel(tpl *TaskTemplate) *database.TaskTemplateModel {
+	paramsJSON, _ := json.Marshal(tpl.Parameters)
+	evaluatorsJSON, _ := json.Marshal(tpl.Evaluators)
+	return &database.TaskTemplateModel{
+		BaseModel: database.BaseModel{
+			ID:        tpl.ID,
+			CreatedAt: tpl.CreatedAt,
+			UpdatedAt: tpl.UpdatedAt,
+		},
+		UserID:              tpl.UserID,
+		Name:                tpl.Name,
+		Description:         tpl.Description,
+		AgentID:             tpl.AgentID,
+		Prompt:              tpl.Prompt,
+		ParametersJSON:      string(paramsJSON),
+		RequiredAttachments: tpl.RequiredAttachments,
+		Timeout:             tpl.Timeout,
+		EvaluatorsJSON:      string(evaluatorsJSON),
+		Version:             tpl.Version,
+	}
+}
+
+func modelToTemplate(model *database.TaskTemplateModel) *TaskTemplate {
+	tpl := &TaskTemplate{
+		ID:                  model.ID,
+		UserID:              model.UserID,
+		Name:                model.Name,
+		Description:         model.Description,
+		AgentID:             model.AgentID,
+		Prompt:              model.Prompt,
+		RequiredAttachments: model.RequiredAttachments,
+		Timeout:             model.Timeout,
+		Version:             model.Version,
+		CreatedAt:           model.CreatedAt,
+		UpdatedAt:           model.UpdatedAt,
+	}
+	if model.ParametersJSON != "" && model.ParametersJSON != "null" {
+		json.Unmarshal([]byte(model.ParametersJSON), &tpl.Parameters)
+	}
+	if model.EvaluatorsJSON != "" && model.EvaluatorsJSON != "null" {
+		json.Unmarshal([]byte(model.EvaluatorsJSON), &tpl.Evaluators)
+	}
+	return tpl
+}
@@ -0,0 +1,177 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmalldedede/agentbox/internal/apperr"
+	"github.com/tmalldedede/agentbox/internal/eval"
+)
+
+func setupTemplateManager(t *testing.T) *Manager {
+	t.Helper()
+	m := setupWorkflowManager(t)
+	tplStore, err := NewGormTemplateStore(m.store.(*GormStore).db)
+	require.NoError(t, err)
+	m.SetTemplateStore(tplStore)
+	return m
+}
+
+func reviewTemplateRequest() *CreateTemplateRequest {
+	return &CreateTemplateRequest{
+		Name:    "Code review",
+		AgentID: "test-agent",
+		Prompt:  "Review {{.repo}} (max {{.max_files}} files, strict={{.strict}})",
+		Parameters: []TemplateParameter{
+			{Name: "repo", Required: true},
+			{Name: "max_files", Type: ParamInteger, Default: "10"},
+			{Name: "strict", Type: ParamBoolean},
+		},
+		Timeout: 120,
+		UserID:  "alice",
+	}
+}
+
+func TestTemplate_BindParams(t *testing.T) {
+	tpl := &TaskTemplate{Name: "t", AgentID: "a", Prompt: "{{.n}}", Parameters: []TemplateParameter{
+		{Name: "n", Type: ParamNumber, Required: true},
+		{Name: "level", Options: []string{"low", "high"}, Default: "low"},
+	}}
+	require.NoError(t, tpl.validate())
+
+	bound, err := tpl.BindParams(map[string]interface{}{"n": "1.5"})
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, bound["n"])
+	assert.Equal(t, "low", bound["level"])
+
+	for name, params := range map[string]map[string]interface{}{
+		"missing required": {},
+		"wrong type":       {"n": "abc"},
+		"unknown option":   {"n": 1, "level": "medium"},
+		"unknown param":    {"n": 1, "extra": "x"},
+	} {
+		_, err := tpl.BindParams(params)
+		assert.True(t, apperr.IsValidation(err), "%s: %v", name, err)
+	}
+}
+
+func TestTemplate_Validate(t *testing.T) {
+	for name, tpl := range map[string]*TaskTemplate{
+		"bad prompt":     {Name: "t", AgentID: "a", Prompt: "{{.x"},
+		"bad param name": {Name: "t", AgentID: "a", Prompt: "p", Parameters: []TemplateParameter{{Name: "a-b"}}},
+		"duplicate":      {Name: "t", AgentID: "a", Prompt: "p", Parameters: []TemplateParameter{{Name: "a"}, {Name: "a"}}},
+		"bad type":       {Name: "t", AgentID: "a", Prompt: "p", Parameters: []TemplateParameter{{Name: "a", Type: "date"}}},
+		"bad default":    {Name: "t", AgentID: "a", Prompt: "p", Parameters: []TemplateParameter{{Name: "a", Type: ParamInteger, Default: "x"}}},
+	} {
+		assert.Error(t, tpl.validate(), name)
+	}
+}
+
+func TestCreateTask_FromTemplate(t *testing.T) {
+	m := setupTemplateManager(t)
+	tpl, err := m.CreateTemplate(reviewTemplateRequest())
+	require.NoError(t, err)
+	assert.Equal(t, 1, tpl.Version)
+
+	task, err := m.CreateTask(&CreateTaskRequest{
+		TemplateID: tpl.ID,
+		Params:     map[string]interface{}{"repo": "agentbox", "strict": "true"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "test-agent", task.AgentID)
+	assert.Equal(t, "Review agentbox (max 10 files, strict=true)", task.Prompt)
+	assert.Equal(t, 120, task.Timeout)
+	assert.Equal(t, tpl.ID, task.TemplateID)
+	assert.Equal(t, 1, task.TemplateVersion)
+
+	// 更新模板后版本递增，已创建的任务保留原版本
+	req := reviewTemplateRequest()
+	req.Prompt = "Review {{.repo}} carefully"
+	updated, err := m.UpdateTemplate(tpl.ID, req)
+	require.NoError(t, err)
+	assert.Equal(t, 2, updated.Version)
+
+	got, err := m.GetTask(task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, tpl.ID, got.TemplateID)
+	assert.Equal(t, 1, got.TemplateVersion)
+
+	task2, err := m.CreateTask(&CreateTaskRequest{TemplateID: tpl.ID, Params: map[string]interface{}{"repo": "x"}})
+	require.NoError(t, err)
+	assert.Equal(t, "Review x carefully", task2.Prompt)
+	assert.Equal(t, 2, task2.TemplateVersion)
+}
+
+func TestCreateTask_FromTemplateErrors(t *testing.T) {
+	m := setupTemplateManager(t)
+	req := reviewTemplateRequest()
+	req.RequiredAttachments = 1
+	tpl, err := m.CreateTemplate(req)
+	require.NoError(t, err)
+
+	params := map[string]interface{}{"repo": "agentbox"}
+	for name, r := range map[string]*CreateTaskRequest{
+		"missing attachment": {TemplateID: tpl.ID, Params: params},
+		"missing param":      {TemplateID: tpl.ID, Attachments: []string{"f1"}},
+		"prompt given":       {TemplateID: tpl.ID, Params: params, Attachments: []string{"f1"}, Prompt: "x"},
+		"agent mismatch":     {TemplateID: tpl.ID, Params: params, Attachments: []string{"f1"}, AgentID: "other"},
+		"unknown template":   {TemplateID: "tpl-missing", Params: params},
+	} {
+		_, err := m.CreateTask(r)
+		assert.Error(t, err, name)
+	}
+
+	_, err = m.CreateTask(&CreateTaskRequest{TemplateID: tpl.ID, Params: params, Attachments: []string{"f1"}})
+	assert.NoError(t, err)
+}
+
+func TestGormTemplateStore_CRUD(t *testing.T) {
+	m := setupTemplateManager(t)
+	tpl, err := m.CreateTemplate(reviewTemplateRequest())
+	require.NoError(t, err)
+
+	got, err := m.GetTemplate(tpl.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", got.UserID)
+	require.Len(t, got.Parameters, 3)
+	assert.Equal(t, ParamInteger, got.Parameters[1].Type)
+	assert.EqualValues(t, 10, got.Parameters[1].Default)
+
+	list, err := m.ListTemplates("alice")
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+	list, err = m.ListTemplates("bob")
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	require.NoError(t, m.DeleteTemplate(tpl.ID))
+	_, err = m.GetTemplate(tpl.ID)
+	assert.ErrorIs(t, err, ErrTemplateNotFound)
+}
+
+func TestCreateTask_TemplateEvaluators(t *testing.T) {
+	m := setupTemplateManager(t)
+	req := reviewTemplateRequest()
+	req.Evaluators = []eval.Evaluator{{Name: "lgtm", Type: eval.TypeContains, Pattern: "LGTM"}}
+	tpl, err := m.CreateTemplate(req)
+	require.NoError(t, err)
+
+	task, err := m.CreateTask(&CreateTaskRequest{
+		TemplateID: tpl.ID,
+		Params:     map[string]interface{}{"repo": "agentbox"},
+		Evaluators: []eval.Evaluator{{Type: eval.TypeRegex, Pattern: `\d+ issues`}},
+	})
+	require.NoError(t, err)
+
+	got, err := m.GetTask(task.ID)
+	require.NoError(t, err)
+	require.Len(t, got.Evaluators, 2)
+	assert.Equal(t, "lgtm", got.Evaluators[0].Name)
+	assert.Equal(t, eval.TypeRegex, got.Evaluators[1].Type)
+
+	// 评估器配置错误时拒绝创建
+	req.Evaluators = []eval.Evaluator{{Type: eval.TypeRegex, Pattern: "("}}
+	_, err = m.CreateTemplate(req)
+	assert.True(t, apperr.IsValidation(err))
+}
@@ -0,0 +1,149 @@
+package task
+
+import (
+	"errors"
+	"time"
+
+	"github.com/tmalldedede/agentbox/internal/history"
+	"github.com/tmalldedede/agentbox/internal/session"
+)
+
+// HistoryRecorder 执行历史记录接口（由 history.Manager 实现）
+type HistoryRecorder interface {
+	Record(entry *history.Entry) error
+}
+
+// SetHistoryRecorder 设置执行历史记录器（每轮执行结束后写入一条记录）
+func (m *Manager) SetHistoryRecorder(r HistoryRecorder) {
+	m.historyRecorder = r
+}
+
+// applyTokenUsage 将引擎返回的 token 使用写入执行结果
+func applyTokenUsage(result *Result, usage *session.TokenUsage) {
+	if result == nil || usage == nil {
+		return
+	}
+	if result.Usage == nil {
+		result.Usage = &Usage{}
+	}
+	result.Usage.InputTokens = int64(usage.InputTokens)
+	result.Usage.CachedInputTokens = int64(usage.CachedInputTokens)
+	result.Usage.OutputTokens = int64(usage.OutputTokens)
+	result.Usage.TotalTokens = result.Usage.InputTokens + result.Usage.OutputTokens
+}
+
+// providerUsage 将一次 Provider 尝试转换为用量明细
+func providerUsage(providerID string, usage *session.TokenUsage, err error) ProviderUsage {
+	pu := ProviderUsage{ProviderID: providerID, Success: err == nil}
+	if err != nil {
+		pu.Error = err.Error()
+	}
+	if usage != nil {
+		pu.InputTokens = int64(usage.InputTokens)
+		pu.CachedInputTokens = int64(usage.CachedInputTokens)
+		pu.OutputTokens = int64(usage.OutputTokens)
+	}
+	return pu
+}
+
+// fallbackFailureResult 故障转移全部失败时的结果：汇总每次尝试的 token 用量（保留明细），
+// 其他错误返回 nil
+func fallbackFailureResult(err error) *Result {
+	var fe *ProviderFallbackError
+	if !errors.As(err, &fe) {
+		return nil
+	}
+	u := &Usage{Attempts: fe.ProviderUsage}
+	for _, a := range fe.ProviderUsage {
+		u.InputTokens += a.InputTokens
+		u.CachedInputTokens += a.CachedInputTokens
+		u.OutputTokens += a.OutputTokens
+	}
+	u.TotalTokens = u.InputTokens + u.OutputTokens
+	return &Result{Usage: u}
+}
+
+// add 累加另一份用量（故障转移明细一并追加）
+func (u *Usage) add(o *Usage) {
+	if o == nil {
+		return
+	}
+	u.DurationSeconds += o.DurationSeconds
+	u.InputTokens += o.InputTokens
+	u.CachedInputTokens += o.CachedInputTokens
+	u.OutputTokens += o.OutputTokens
+	u.TotalTokens += o.TotalTokens
+	u.Attempts = append(u.Attempts, o.Attempts...)
+}
+
+// aggregateUsage 汇总所有轮次的用量，没有任何用量时返回 nil
+func aggregateUsage(turns []Turn) *Usage {
+	var total *Usage
+	for _, t := range turns {
+		if t.Result == nil || t.Result.Usage == nil {
+			continue
+		}
+		if total == nil {
+			total = &Usage{}
+		}
+		total.add(t.Result.Usage)
+	}
+	return total
+}
+
+// refreshUsage 根据各轮结果重新汇总任务用量
+func (t *Task) refreshUsage() {
+	if u := aggregateUsage(t.Turns); u != nil {
+		t.Usage = u
+	}
+}
+
+// recordTurnHistory 将一轮执行写入执行历史
+func (m *Manager) recordTurnHistory(task *Task, turnID, prompt string, startedAt time.Time, result *Result, execErr error) {
+	if m.historyRecorder == nil {
+		return
+	}
+
+	sourceName := task.AgentName
+	if sourceName == "" {
+		sourceName = task.AgentID
+	}
+	endedAt := time.Now()
+	entry := &history.Entry{
+		SourceType: history.SourceTask,
+		SourceID:   task.ID,
+		SourceName: sourceName,
+		Engine:     task.AgentType,
+		Prompt:     prompt,
+		Status:     history.StatusCompleted,
+		StartedAt:  startedAt,
+		EndedAt:    &endedAt,
+		Metadata: map[string]string{
+			"task_id":  task.ID,
+			"turn_id":  turnID,
+			"agent_id": task.AgentID,
+		},
+	}
+	if task.UserID != "" {
+		entry.Metadata["user_id"] = task.UserID
+	}
+	if execErr != nil {
+		entry.Status = history.StatusFailed
+		entry.Error = execErr.Error()
+		entry.ExitCode = 1
+	}
+	if result != nil {
+		entry.Output = result.Text
+		if u := result.Usage; u != nil && u.TotalTokens > 0 {
+			entry.Usage = &history.UsageInfo{
+				InputTokens:       int(u.InputTokens),
+				CachedInputTokens: int(u.CachedInputTokens),
+				OutputTokens:      int(u.OutputTokens),
+			}
+		}
+	}
+
+	if err := m.historyRecorder.Record(entry); err != nil {
+		log.Warn("failed to record task history", "task_id", task.ID, "turn_id", turnID, "error", err)
+	}
+}
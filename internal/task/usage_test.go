@@ -0,0 +1,147 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmalldedede/agentbox/internal/history"
+	"github.com/tmalldedede/agentbox/internal/session"
+)
+
+type fakeHistoryRecorder struct {
+	entries []*history.Entry
+}
+
+func (r *fakeHistoryRecorder) Record(entry *history.Entry) error {
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+func TestApplyTokenUsage(t *testing.T) {
+	result := &Result{Usage: &Usage{DurationSeconds: 12}}
+	applyTokenUsage(result, &session.TokenUsage{InputTokens: 1000, CachedInputTokens: 800, OutputTokens: 200})
+
+	assert.Equal(t, 12, result.Usage.DurationSeconds)
+	assert.Equal(t, int64(1000), result.Usage.InputTokens)
+	assert.Equal(t, int64(800), result.Usage.CachedInputTokens)
+	assert.Equal(t, int64(200), result.Usage.OutputTokens)
+	assert.Equal(t, int64(1200), result.Usage.TotalTokens)
+
+	// 引擎未返回用量时保持不变
+	empty := &Result{}
+	applyTokenUsage(empty, nil)
+	assert.Nil(t, empty.Usage)
+}
+
+func TestAggregateUsage(t *testing.T) {
+	task := &Task{Turns: []Turn{
+		{ID: "t1", Result: &Result{Usage: &Usage{
+			DurationSeconds: 10, InputTokens: 100, CachedInputTokens: 40, OutputTokens: 10, TotalTokens: 110,
+			Attempts: []ProviderUsage{
+				{ProviderID: "primary", Error: "rate limited"},
+				{ProviderID: "backup", Success: true, InputTokens: 100, CachedInputTokens: 40, OutputTokens: 10},
+			},
+		}}},
+		{ID: "t2"}, // 尚未完成
+		{ID: "t3", Result: &Result{Usage: &Usage{DurationSeconds: 5, InputTokens: 50, OutputTokens: 5, TotalTokens: 55}}},
+	}}
+
+	task.refreshUsage()
+	require.NotNil(t, task.Usage)
+	assert.Equal(t, 15, task.Usage.DurationSeconds)
+	assert.Equal(t, int64(150), task.Usage.InputTokens)
+	assert.Equal(t, int64(40), task.Usage.CachedInputTokens)
+	assert.Equal(t, int64(15), task.Usage.OutputTokens)
+	assert.Equal(t, int64(165), task.Usage.TotalTokens)
+	require.Len(t, task.Usage.Attempts, 2)
+	assert.False(t, task.Usage.Attempts[0].Success)
+	assert.Equal(t, "backup", task.Usage.Attempts[1].ProviderID)
+
+	assert.Nil(t, aggregateUsage([]Turn{{ID: "t1"}}))
+}
+
+func TestFallbackFailureResult(t *testing.T) {
+	assert.Nil(t, fallbackFailureResult(errors.New("boom")))
+
+	err := fmt.Errorf("execution failed: %w", &ProviderFallbackError{
+		Attempts: 2,
+		ProviderUsage: []ProviderUsage{
+			{ProviderID: "primary", Error: "rate limit", InputTokens: 100, CachedInputTokens: 40, OutputTokens: 5},
+			{ProviderID: "backup", Error: "timeout", InputTokens: 50, OutputTokens: 20},
+		},
+		LastError: errors.New("timeout"),
+	})
+	r := fallbackFailureResult(err)
+	require.NotNil(t, r)
+	assert.Equal(t, int64(150), r.Usage.InputTokens)
+	assert.Equal(t, int64(40), r.Usage.CachedInputTokens)
+	assert.Equal(t, int64(25), r.Usage.OutputTokens)
+	assert.Equal(t, int64(175), r.Usage.TotalTokens)
+	assert.Len(t, r.Usage.Attempts, 2)
+}
+
+func TestRecordTurnHistory(t *testing.T) {
+	rec := &fakeHistoryRecorder{}
+	m := &Manager{}
+	m.SetHistoryRecorder(rec)
+
+	task := &Task{ID: "task-1", AgentID: "agent-1", AgentName: "Coder", AgentType: "codex", UserID: "user-1"}
+	started := time.Now().Add(-time.Minute)
+	m.recordTurnHistory(task, "turn-1", "hello", started, &Result{
+		Text:  "done",
+		Usage: &Usage{InputTokens: 30, CachedInputTokens: 10, OutputTokens: 7, TotalTokens: 37},
+	}, nil)
+	m.recordTurnHistory(task, "turn-2", "again", started, nil, errors.New("boom"))
+
+	require.Len(t, rec.entries, 2)
+	ok := rec.entries[0]
+	assert.Equal(t, history.SourceTask, ok.SourceType)
+	assert.Equal(t, "task-1", ok.SourceID)
+	assert.Equal(t, "Coder", ok.SourceName)
+	assert.Equal(t, "codex", ok.Engine)
+	assert.Equal(t, history.StatusCompleted, ok.Status)
+	assert.Equal(t, &history.UsageInfo{InputTokens: 30, CachedInputTokens: 10, OutputTokens: 7}, ok.Usage)
+	assert.Equal(t, "turn-1", ok.Metadata["turn_id"])
+	assert.Equal(t, "user-1", ok.Metadata["user_id"])
+
+	failed := rec.entries[1]
+	assert.Equal(t, history.StatusFailed, failed.Status)
+	assert.Equal(t, "boom", failed.Error)
+	assert.Nil(t, failed.Usage)
+}
+
+func TestGormStore_UsagePersistedAndAggregated(t *testing.T) {
+	store, err := NewGormStore(setupTestDB(t))
+	require.NoError(t, err)
+
+	for i, u := range []*Usage{
+		{InputTokens: 100, CachedInputTokens: 60, OutputTokens: 20, TotalTokens: 120},
+		{InputTokens: 50, OutputTokens: 5, TotalTokens: 55},
+		nil,
+	} {
+		require.NoError(t, store.Create(&Task{
+			ID:        fmt.Sprintf("usage-%d", i),
+			AgentID:   "agent-1",
+			Prompt:    "p",
+			Status:    StatusCompleted,
+			Usage:     u,
+			CreatedAt: time.Now(),
+		}))
+	}
+
+	got, err := store.Get("usage-0")
+	require.NoError(t, err)
+	require.NotNil(t, got.Usage)
+	assert.Equal(t, int64(60), got.Usage.CachedInputTokens)
+
+	stats, err := store.Stats(nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(150), stats.InputTokens)
+	assert.Equal(t, int64(60), stats.CachedInputTokens)
+	assert.Equal(t, int64(25), stats.OutputTokens)
+	assert.Equal(t, int64(175), stats.TotalTokens)
+}
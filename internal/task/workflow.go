@@ -0,0 +1,703 @@
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tmalldedede/agentbox/internal/apperr"
+)
+
+// 工作流相关错误
+var (
+	ErrWorkflowNotFound    = apperr.NotFound("workflow")
+	ErrWorkflowRunNotFound = apperr.NotFound("workflow run")
+)
+
+// Task.Metadata 中关联工作流的键
+const (
+	MetadataWorkflowRunID  = "workflow_run_id"
+	MetadataWorkflowStepID = "workflow_step_id"
+)
+
+// stepIDPattern 步骤 ID 需能在模板中以 {{.Steps.<id>}} 形式引用
+var stepIDPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// WorkflowRunStatus 工作流运行状态
+type WorkflowRunStatus string
+
+const (
+	WorkflowRunRunning   WorkflowRunStatus = "running"
+	WorkflowRunCompleted WorkflowRunStatus = "completed"
+	WorkflowRunFailed    WorkflowRunStatus = "failed"
+	WorkflowRunCancelled WorkflowRunStatus = "cancelled"
+)
+
+// IsTerminal 是否是终止状态
+func (s WorkflowRunStatus) IsTerminal() bool {
+	return s == WorkflowRunCompleted || s == WorkflowRunFailed || s == WorkflowRunCancelled
+}
+
+// StepStatus 工作流步骤状态
+type StepStatus string
+
+const (
+	StepPending   StepStatus = "pending"   // 等待依赖完成
+	StepRunning   StepStatus = "running"   // 已创建 Task，执行中
+	StepCompleted StepStatus = "completed" // Task 执行成功
+	StepFailed    StepStatus = "failed"    // Task 失败或 prompt 渲染失败
+	StepSkipped   StepStatus = "skipped"   // 上游步骤失败，未执行
+	StepCancelled StepStatus = "cancelled" // 运行被取消
+)
+
+// IsTerminal 是否是终止状态
+func (s StepStatus) IsTerminal() bool {
+	return s == StepCompleted || s == StepFailed || s == StepSkipped || s == StepCancelled
+}
+
+// Workflow 工作流定义（由多个步骤组成的 DAG）
+type Workflow struct {
+	ID          string         `json:"id"`
+	UserID      string         `json:"user_id,omitempty"`
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Steps       []WorkflowStep `json:"steps"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+// WorkflowStep 工作流步骤定义
+//
+// Prompt 为 text/template 模板，可引用：
+//   - {{.Inputs.<key>}}          运行时传入的参数
+//   - {{.Steps.<id>.Text}}       上游步骤的结果文本
+//   - {{.Steps.<id>.Output}}     上游步骤的结构化输出（结果为 JSON 时解析）
+//   - {{.Steps.<id>.Files}}      上游步骤的产出文件
+type WorkflowStep struct {
+	ID        string   `json:"id"`
+	AgentID   string   `json:"agent_id"`
+	Prompt    string   `json:"prompt"`
+	DependsOn []string `json:"depends_on,omitempty"`
+	Timeout   int      `json:"timeout,omitempty"` // 秒，0 表示使用默认
+}
+
+// WorkflowRun 工作流的一次运行
+type WorkflowRun struct {
+	ID           string            `json:"id"`
+	WorkflowID   string            `json:"workflow_id"`
+	WorkflowName string            `json:"workflow_name,omitempty"`
+	UserID       string            `json:"user_id,omitempty"`
+	Status       WorkflowRunStatus `json:"status"`
+	Inputs       map[string]string `json:"inputs,omitempty"`
+	Steps        []*StepRun        `json:"steps"`
+	ErrorMessage string            `json:"error_message,omitempty"`
+
+	// Definition 启动时的步骤快照，运行期间修改工作流不影响本次运行
+	Definition []WorkflowStep `json:"-"`
+
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// StepRun 步骤运行状态
+type StepRun struct {
+	StepID       string     `json:"step_id"`
+	AgentID      string     `json:"agent_id"`
+	DependsOn    []string   `json:"depends_on,omitempty"`
+	Status       StepStatus `json:"status"`
+	TaskID       string     `json:"task_id,omitempty"`
+	ErrorMessage string     `json:"error_message,omitempty"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+}
+
+// CreateWorkflowRequest 创建/更新工作流请求
+type CreateWorkflowRequest struct {
+	Name        string         `json:"name" binding:"required"`
+	Description string         `json:"description,omitempty"`
+	Steps       []WorkflowStep `json:"steps" binding:"required"`
+	UserID      string         `json:"-"` // 由中间件注入
+}
+
+// RunWorkflowRequest 启动工作流请求
+type RunWorkflowRequest struct {
+	Inputs map[string]string `json:"inputs,omitempty"`
+	UserID string            `json:"-"` // 由中间件注入
+}
+
+// WorkflowRunFilter 运行记录过滤器
+type WorkflowRunFilter struct {
+	WorkflowID string
+	UserID     string
+	Status     []WorkflowRunStatus
+	Limit      int
+}
+
+// WorkflowStore 工作流存储接口
+type WorkflowStore interface {
+	CreateWorkflow(wf *Workflow) error
+	GetWorkflow(id string) (*Workflow, error)
+	UpdateWorkflow(wf *Workflow) error
+	DeleteWorkflow(id string) error
+	ListWorkflows(userID string) ([]*Workflow, error)
+
+	CreateRun(run *WorkflowRun) error
+	GetRun(id string) (*WorkflowRun, error)
+	UpdateRun(run *WorkflowRun) error
+	ListRuns(filter *WorkflowRunFilter) ([]*WorkflowRun, error)
+}
+
+// stepContext 模板中 {{.Steps.<id>}} 的取值
+type stepContext struct {
+	TaskID string
+	Status StepStatus
+	Text   string
+	Output interface{}
+	Files  []OutputFile
+}
+
+// templateContext 步骤 prompt 模板的渲染上下文
+type templateContext struct {
+	Inputs map[string]string
+	Steps  map[string]*stepContext
+}
+
+// sortWorkflowSteps 校验步骤定义并返回拓扑排序后的副本
+func sortWorkflowSteps(steps []WorkflowStep) ([]WorkflowStep, error) {
+	if len(steps) == 0 {
+		return nil, apperr.Validation("workflow must have at least one step")
+	}
+
+	byID := make(map[string]WorkflowStep, len(steps))
+	for _, s := range steps {
+		if !stepIDPattern.MatchString(s.ID) {
+			return nil, apperr.Validationf("invalid step id %q: must match %s", s.ID, stepIDPattern.String())
+		}
+		if _, dup := byID[s.ID]; dup {
+			return nil, apperr.Validationf("duplicate step id: %s", s.ID)
+		}
+		if s.AgentID == "" {
+			return nil, apperr.Validationf("step %s: agent_id is required", s.ID)
+		}
+		if strings.TrimSpace(s.Prompt) == "" {
+			return nil, apperr.Validationf("step %s: prompt is required", s.ID)
+		}
+		if _, err := template.New(s.ID).Parse(s.Prompt); err != nil {
+			return nil, apperr.Validationf("step %s: invalid prompt template: %v", s.ID, err)
+		}
+		byID[s.ID] = s
+	}
+	for _, s := range steps {
+		for _, dep := range s.DependsOn {
+			if _, ok := byID[dep]; !ok {
+				return nil, apperr.Validationf("step %s depends on unknown step %s", s.ID, dep)
+			}
+			if dep == s.ID {
+				return nil, apperr.Validationf("step %s depends on itself", s.ID)
+			}
+		}
+	}
+
+	// Kahn 算法，保持定义顺序的稳定性
+	indegree := make(map[string]int, len(steps))
+	for _, s := range steps {
+		indegree[s.ID] = len(s.DependsOn)
+	}
+	sorted := make([]WorkflowStep, 0, len(steps))
+	done := make(map[string]bool, len(steps))
+	for len(sorted) < len(steps) {
+		progressed := false
+		for _, s := range steps {
+			if done[s.ID] || indegree[s.ID] > 0 {
+				continue
+			}
+			done[s.ID] = true
+			sorted = append(sorted, s)
+			progressed = true
+			for _, other := range steps {
+				for _, dep := range other.DependsOn {
+					if dep == s.ID {
+						indegree[other.ID]--
+					}
+				}
+			}
+		}
+		if !progressed {
+			return nil, apperr.Validation("workflow steps contain a dependency cycle")
+		}
+	}
+	return sorted, nil
+}
+
+// renderStepPrompt 渲染步骤 prompt
+func renderStepPrompt(step WorkflowStep, ctx *templateContext) (string, error) {
+	tmpl, err := template.New(step.ID).Option("missingkey=error").Parse(step.Prompt)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, ctx); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// parseStructuredOutput 尝试从结果文本中解析 JSON（整段 JSON 或 ```json 代码块）
+func parseStructuredOutput(text string) interface{} {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+
+	var out interface{}
+	if json.Unmarshal([]byte(text), &out) == nil {
+		return out
+	}
+
+	if start := strings.Index(text, "```json"); start >= 0 {
+		body := text[start+len("```json"):]
+		if end := strings.Index(body, "```"); end >= 0 {
+			if json.Unmarshal([]byte(strings.TrimSpace(body[:end])), &out) == nil {
+				return out
+			}
+		}
+	}
+	return nil
+}
+
+// ==================== Manager: 工作流定义 ====================
+
+// SetWorkflowStore 设置工作流存储（未设置时工作流功能不可用）
+func (m *Manager) SetWorkflowStore(store WorkflowStore) {
+	m.workflowStore = store
+}
+
+// checkWorkflowStore 检查工作流存储是否可用
+func (m *Manager) checkWorkflowStore() error {
+	if m.workflowStore == nil {
+		return apperr.Unavailable("workflow store not configured")
+	}
+	return nil
+}
+
+// validateWorkflow 校验工作流定义并返回拓扑排序后的步骤
+func (m *Manager) validateWorkflow(req *CreateWorkflowRequest) ([]WorkflowStep, error) {
+	steps, err := sortWorkflowSteps(req.Steps)
+	if err != nil {
+		return nil, err
+	}
+	if m.agentMgr != nil {
+		for _, s := range steps {
+			if _, err := m.agentMgr.Get(s.AgentID); err != nil {
+				return nil, apperr.Validationf("step %s: agent not found: %s", s.ID, s.AgentID)
+			}
+		}
+	}
+	return steps, nil
+}
+
+// CreateWorkflow 创建工作流
+func (m *Manager) CreateWorkflow(req *CreateWorkflowRequest) (*Workflow, error) {
+	if err := m.checkWorkflowStore(); err != nil {
+		return nil, err
+	}
+	steps, err := m.validateWorkflow(req)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	wf := &Workflow{
+		ID:          "wf-" + uuid.New().String()[:8],
+		UserID:      req.UserID,
+		Name:        req.Name,
+		Description: req.Description,
+		Steps:       steps,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := m.workflowStore.CreateWorkflow(wf); err != nil {
+		return nil, fmt.Errorf("failed to create workflow: %w", err)
+	}
+
+	log.Info("workflow created", "workflow_id", wf.ID, "steps", len(wf.Steps))
+	return wf, nil
+}
+
+// UpdateWorkflow 更新工作流定义（不影响已启动的运行）
+func (m *Manager) UpdateWorkflow(id string, req *CreateWorkflowRequest) (*Workflow, error) {
+	if err := m.checkWorkflowStore(); err != nil {
+		return nil, err
+	}
+	wf, err := m.workflowStore.GetWorkflow(id)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := m.validateWorkflow(req)
+	if err != nil {
+		return nil, err
+	}
+
+	wf.Name = req.Name
+	wf.Description = req.Description
+	wf.Steps = steps
+	wf.UpdatedAt = time.Now()
+	if err := m.workflowStore.UpdateWorkflow(wf); err != nil {
+		return nil, err
+	}
+	return wf, nil
+}
+
+// GetWorkflow 获取工作流
+func (m *Manager) GetWorkflow(id string) (*Workflow, error) {
+	if err := m.checkWorkflowStore(); err != nil {
+		return nil, err
+	}
+	return m.workflowStore.GetWorkflow(id)
+}
+
+// ListWorkflows 列出工作流（userID 为空则列出全部）
+func (m *Manager) ListWorkflows(userID string) ([]*Workflow, error) {
+	if err := m.checkWorkflowStore(); err != nil {
+		return nil, err
+	}
+	return m.workflowStore.ListWorkflows(userID)
+}
+
+// DeleteWorkflow 删除工作流（存在运行中的 run 时拒绝）
+func (m *Manager) DeleteWorkflow(id string) error {
+	if err := m.checkWorkflowStore(); err != nil {
+		return err
+	}
+	runs, err := m.workflowStore.ListRuns(&WorkflowRunFilter{
+		WorkflowID: id,
+		Status:     []WorkflowRunStatus{WorkflowRunRunning},
+		Limit:      1,
+	})
+	if err != nil {
+		return err
+	}
+	if len(runs) > 0 {
+		return apperr.BadRequestf("workflow %s has running runs", id)
+	}
+	return m.workflowStore.DeleteWorkflow(id)
+}
+
+// ==================== Manager: 工作流运行 ====================
+
+// RunWorkflow 启动工作流运行
+func (m *Manager) RunWorkflow(workflowID string, req *RunWorkflowRequest) (*WorkflowRun, error) {
+	if err := m.checkWorkflowStore(); err != nil {
+		return nil, err
+	}
+	wf, err := m.workflowStore.GetWorkflow(workflowID)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &WorkflowRun{
+		ID:           "wfrun-" + uuid.New().String()[:8],
+		WorkflowID:   wf.ID,
+		WorkflowName: wf.Name,
+		UserID:       req.UserID,
+		Status:       WorkflowRunRunning,
+		Inputs:       req.Inputs,
+		Definition:   wf.Steps,
+		CreatedAt:    time.Now(),
+	}
+	for _, s := range wf.Steps {
+		run.Steps = append(run.Steps, &StepRun{
+			StepID:    s.ID,
+			AgentID:   s.AgentID,
+			DependsOn: s.DependsOn,
+			Status:    StepPending,
+		})
+	}
+	if err := m.workflowStore.CreateRun(run); err != nil {
+		return nil, fmt.Errorf("failed to create workflow run: %w", err)
+	}
+
+	log.Info("workflow run started", "run_id", run.ID, "workflow_id", wf.ID)
+	m.broadcastEvent(run.ID, &TaskEvent{Type: "workflow.started", Data: map[string]interface{}{
+		"run_id":      run.ID,
+		"workflow_id": wf.ID,
+	}})
+
+	m.advanceWorkflowRun(run.ID)
+	return m.workflowStore.GetRun(run.ID)
+}
+
+// GetWorkflowRun 获取运行记录
+func (m *Manager) GetWorkflowRun(id string) (*WorkflowRun, error) {
+	if err := m.checkWorkflowStore(); err != nil {
+		return nil, err
+	}
+	return m.workflowStore.GetRun(id)
+}
+
+// ListWorkflowRuns 列出运行记录
+func (m *Manager) ListWorkflowRuns(filter *WorkflowRunFilter) ([]*WorkflowRun, error) {
+	if err := m.checkWorkflowStore(); err != nil {
+		return nil, err
+	}
+	return m.workflowStore.ListRuns(filter)
+}
+
+// CancelWorkflowRun 取消运行：取消执行中的步骤 Task，未开始的步骤标记为 cancelled
+func (m *Manager) CancelWorkflowRun(id string) (*WorkflowRun, error) {
+	if err := m.checkWorkflowStore(); err != nil {
+		return nil, err
+	}
+
+	m.workflowMu.Lock()
+	run, err := m.workflowStore.GetRun(id)
+	if err != nil {
+		m.workflowMu.Unlock()
+		return nil, err
+	}
+	if run.Status.IsTerminal() {
+		m.workflowMu.Unlock()
+		return nil, apperr.BadRequestf("workflow run %s is already %s", id, run.Status)
+	}
+
+	now := time.Now()
+	var runningTasks []string
+	for _, step := range run.Steps {
+		if step.Status.IsTerminal() {
+			continue
+		}
+		if step.Status == StepRunning && step.TaskID != "" {
+			runningTasks = append(runningTasks, step.TaskID)
+		}
+		step.Status = StepCancelled
+		step.CompletedAt = &now
+	}
+	run.Status = WorkflowRunCancelled
+	run.CompletedAt = &now
+	err = m.workflowStore.UpdateRun(run)
+	m.workflowMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, taskID := range runningTasks {
+		if err := m.CancelTask(taskID); err != nil {
+			log.Warn("cancel workflow step task failed", "run_id", id, "task_id", taskID, "error", err)
+		}
+	}
+
+	m.broadcastEvent(run.ID, &TaskEvent{Type: "workflow.cancelled", Data: map[string]interface{}{
+		"run_id": run.ID,
+	}})
+	return run, nil
+}
+
+// resumeWorkflowRuns 启动时推进所有未结束的运行（实例重启后继续调度）
+func (m *Manager) resumeWorkflowRuns() {
+	if m.workflowStore == nil {
+		return
+	}
+	runs, err := m.workflowStore.ListRuns(&WorkflowRunFilter{Status: []WorkflowRunStatus{WorkflowRunRunning}})
+	if err != nil {
+		log.Error("resumeWorkflowRuns: failed to list running runs", "error", err)
+		return
+	}
+	for _, run := range runs {
+		m.advanceWorkflowRun(run.ID)
+	}
+}
+
+// notifyWorkflow 步骤 Task 进入终态后推进所属工作流
+func (m *Manager) notifyWorkflow(task *Task) {
+	if m.workflowStore == nil || task.Metadata == nil {
+		return
+	}
+	runID := task.Metadata[MetadataWorkflowRunID]
+	if runID == "" {
+		return
+	}
+	// 异步推进：调用方可能正持有 workflowMu（如 CancelWorkflowRun → CancelTask）
+	go m.advanceWorkflowRun(runID)
+}
+
+// isWorkflowTask 是否为工作流步骤 Task（步骤 Task 首轮完成即结束，不等待多轮）
+func isWorkflowTask(task *Task) bool {
+	return task.Metadata != nil && task.Metadata[MetadataWorkflowRunID] != ""
+}
+
+// advanceWorkflowRun 同步步骤状态、传播失败、启动依赖已满足的步骤，并在全部结束时收尾
+func (m *Manager) advanceWorkflowRun(runID string) {
+	m.workflowMu.Lock()
+	defer m.workflowMu.Unlock()
+
+	run, err := m.workflowStore.GetRun(runID)
+	if err != nil {
+		log.Error("advanceWorkflowRun: failed to get run", "run_id", runID, "error", err)
+		return
+	}
+	if run.Status.IsTerminal() {
+		return
+	}
+
+	defs := make(map[string]WorkflowStep, len(run.Definition))
+	for _, d := range run.Definition {
+		defs[d.ID] = d
+	}
+	ctx := &templateContext{Inputs: run.Inputs, Steps: make(map[string]*stepContext)}
+	if ctx.Inputs == nil {
+		ctx.Inputs = map[string]string{}
+	}
+	steps := make(map[string]*StepRun, len(run.Steps))
+	for _, s := range run.Steps {
+		steps[s.StepID] = s
+	}
+
+	// 1. 同步执行中步骤的 Task 状态，并收集已完成步骤的输出
+	for _, step := range run.Steps {
+		if step.TaskID == "" || (step.Status != StepRunning && step.Status != StepCompleted) {
+			continue
+		}
+		t, err := m.store.Get(step.TaskID)
+		if err != nil {
+			if step.Status == StepRunning {
+				m.finishStep(run, step, StepFailed, "step task lost: "+err.Error())
+			}
+			continue
+		}
+		switch t.Status {
+		case StatusCompleted:
+			if step.Status == StepRunning {
+				m.finishStep(run, step, StepCompleted, "")
+			}
+			sc := &stepContext{TaskID: t.ID, Status: StepCompleted, Files: t.OutputFiles}
+			if t.Result != nil {
+				sc.Text = t.Result.Text
+				sc.Output = parseStructuredOutput(t.Result.Text)
+			}
+			ctx.Steps[step.StepID] = sc
+		case StatusFailed:
+			m.finishStep(run, step, StepFailed, t.ErrorMessage)
+		case StatusCancelled:
+			m.finishStep(run, step, StepCancelled, "step task cancelled")
+		}
+	}
+
+	// 2. 传播失败并启动就绪步骤（步骤已按拓扑序存储，单次遍历即可）
+	for _, step := range run.Steps {
+		if step.Status != StepPending {
+			continue
+		}
+
+		ready := true
+		for _, dep := range step.DependsOn {
+			depStatus := steps[dep].Status
+			if depStatus == StepFailed || depStatus == StepSkipped || depStatus == StepCancelled {
+				m.finishStep(run, step, StepSkipped, "upstream step "+dep+" "+string(depStatus))
+				ready = false
+				break
+			}
+			if depStatus != StepCompleted {
+				ready = false
+			}
+		}
+		if !ready {
+			continue
+		}
+
+		m.startStep(run, step, defs[step.StepID], ctx)
+	}
+
+	// 3. 全部步骤结束 → 收尾
+	allDone := true
+	failed := 0
+	for _, step := range run.Steps {
+		if !step.Status.IsTerminal() {
+			allDone = false
+		}
+		if step.Status == StepFailed || step.Status == StepSkipped || step.Status == StepCancelled {
+			failed++
+		}
+	}
+	eventType := ""
+	if allDone {
+		now := time.Now()
+		run.CompletedAt = &now
+		if failed == 0 {
+			run.Status = WorkflowRunCompleted
+			eventType = "workflow.completed"
+		} else {
+			run.Status = WorkflowRunFailed
+			run.ErrorMessage = fmt.Sprintf("%d of %d steps did not complete", failed, len(run.Steps))
+			eventType = "workflow.failed"
+		}
+	}
+
+	if err := m.workflowStore.UpdateRun(run); err != nil {
+		log.Error("advanceWorkflowRun: failed to update run", "run_id", runID, "error", err)
+		return
+	}
+
+	if eventType != "" {
+		log.Info("workflow run finished", "run_id", run.ID, "status", run.Status)
+		m.broadcastEvent(run.ID, &TaskEvent{Type: eventType, Data: map[string]interface{}{
+			"run_id": run.ID,
+			"status": run.Status,
+			"error":  run.ErrorMessage,
+		}})
+	}
+}
+
+// startStep 渲染 prompt 并为步骤创建 Task
+func (m *Manager) startStep(run *WorkflowRun, step *StepRun, def WorkflowStep, ctx *templateContext) {
+	prompt, err := renderStepPrompt(def, ctx)
+	if err != nil {
+		m.finishStep(run, step, StepFailed, "render prompt: "+err.Error())
+		return
+	}
+
+	t, err := m.CreateTask(&CreateTaskRequest{
+		AgentID: def.AgentID,
+		Prompt:  prompt,
+		UserID:  run.UserID,
+		Timeout: def.Timeout,
+		Metadata: map[string]string{
+			MetadataWorkflowRunID:  run.ID,
+			MetadataWorkflowStepID: step.StepID,
+		},
+	})
+	if err != nil {
+		m.finishStep(run, step, StepFailed, "create task: "+err.Error())
+		return
+	}
+
+	now := time.Now()
+	step.Status = StepRunning
+	step.TaskID = t.ID
+	step.StartedAt = &now
+
+	m.broadcastEvent(run.ID, &TaskEvent{Type: "workflow.step_started", Data: map[string]interface{}{
+		"run_id":  run.ID,
+		"step_id": step.StepID,
+		"task_id": t.ID,
+	}})
+}
+
+// finishStep 将步骤置为终态并广播事件
+func (m *Manager) finishStep(run *WorkflowRun, step *StepRun, status StepStatus, errMsg string) {
+	now := time.Now()
+	step.Status = status
+	step.ErrorMessage = errMsg
+	step.CompletedAt = &now
+
+	m.broadcastEvent(run.ID, &TaskEvent{Type: "workflow.step_" + string(status), Data: map[string]interface{}{
+		"run_id":  run.ID,
+		"step_id": step.StepID,
+		"task_id": step.TaskID,
+		"error":   errMsg,
+	}})
+}
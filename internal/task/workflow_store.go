@@ -0,0 +1,234 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/tmalldedede/agentbox/internal/database"
+	"gorm.io/gorm"
+)
+
+// GormWorkflowStore 工作流 GORM 存储实现
+type GormWorkflowStore struct {
+	db *gorm.DB
+}
+
+// NewGormWorkflowStore 创建工作流 GORM 存储
+func NewGormWorkflowStore(db *gorm.DB) (*GormWorkflowStore, error) {
+	if err := db.AutoMigrate(&database.WorkflowModel{}, &database.WorkflowRunModel{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate workflow tables: %w", err)
+	}
+	return &GormWorkflowStore{db: db}, nil
+}
+
+// CreateWorkflow 创建工作流
+func (s *GormWorkflowStore) CreateWorkflow(wf *Workflow) error {
+	return s.db.Create(workflowToModel(wf)).Error
+}
+
+// GetWorkflow 获取工作流
+func (s *GormWorkflowStore) GetWorkflow(id string) (*Workflow, error) {
+	var model database.WorkflowModel
+	if err := s.db.First(&model, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrWorkflowNotFound
+		}
+		return nil, err
+	}
+	return modelToWorkflow(&model), nil
+}
+
+// UpdateWorkflow 更新工作流
+func (s *GormWorkflowStore) UpdateWorkflow(wf *Workflow) error {
+	model := workflowToModel(wf)
+	result := s.db.Model(&database.WorkflowModel{}).Where("id = ?", wf.ID).Updates(map[string]interface{}{
+		"name":        model.Name,
+		"description": model.Description,
+		"steps_json":  model.StepsJSON,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrWorkflowNotFound
+	}
+	return nil
+}
+
+// DeleteWorkflow 删除工作流
+func (s *GormWorkflowStore) DeleteWorkflow(id string) error {
+	result := s.db.Delete(&database.WorkflowModel{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrWorkflowNotFound
+	}
+	return nil
+}
+
+// ListWorkflows 列出工作流
+func (s *GormWorkflowStore) ListWorkflows(userID string) ([]*Workflow, error) {
+	query := s.db.Model(&database.WorkflowModel{})
+	if userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var models []database.WorkflowModel
+	if err := query.Order("created_at DESC").Find(&models).Error; err != nil {
+		return nil, err
+	}
+
+	workflows := make([]*Workflow, len(models))
+	for i := range models {
+		workflows[i] = modelToWorkflow(&models[i])
+	}
+	return workflows, nil
+}
+
+// CreateRun 创建运行记录
+func (s *GormWorkflowStore) CreateRun(run *WorkflowRun) error {
+	return s.db.Create(runToModel(run)).Error
+}
+
+// GetRun 获取运行记录
+func (s *GormWorkflowStore) GetRun(id string) (*WorkflowRun, error) {
+	var model database.WorkflowRunModel
+	if err := s.db.First(&model, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrWorkflowRunNotFound
+		}
+		return nil, err
+	}
+	return modelToRun(&model), nil
+}
+
+// UpdateRun 更新运行记录
+func (s *GormWorkflowStore) UpdateRun(run *WorkflowRun) error {
+	model := runToModel(run)
+	result := s.db.Model(&database.WorkflowRunModel{}).Where("id = ?", run.ID).Updates(map[string]interface{}{
+		"status":        model.Status,
+		"steps_json":    model.StepsJSON,
+		"error_message": model.ErrorMessage,
+		"completed_at":  model.CompletedAt,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrWorkflowRunNotFound
+	}
+	return nil
+}
+
+// ListRuns 列出运行记录
+func (s *GormWorkflowStore) ListRuns(filter *WorkflowRunFilter) ([]*WorkflowRun, error) {
+	query := s.db.Model(&database.WorkflowRunModel{})
+	if filter != nil {
+		if filter.WorkflowID != "" {
+			query = query.Where("workflow_id = ?", filter.WorkflowID)
+		}
+		if filter.UserID != "" {
+			query = query.Where("user_id = ?", filter.UserID)
+		}
+		if len(filter.Status) > 0 {
+			statusStrs := make([]string, len(filter.Status))
+			for i, st := range filter.Status {
+				statusStrs[i] = string(st)
+			}
+			query = query.Where("status IN ?", statusStrs)
+		}
+		if filter.Limit > 0 {
+			query = query.Limit(filter.Limit)
+		}
+	}
+
+	var models []database.WorkflowRunModel
+	if err := query.Order("created_at DESC").Find(&models).Error; err != nil {
+		return nil, err
+	}
+
+	runs := make([]*WorkflowRun, len(models))
+	for i := range models {
+		runs[i] = modelToRun(&models[i])
+	}
+	return runs, nil
+}
+
+// workflowToModel 将 Workflow 转换为 WorkflowModel
+func workflowToModel(wf *Workflow) *database.WorkflowModel {
+	stepsJSON, _ := json.Marshal(wf.Steps)
+	return &database.WorkflowModel{
+		BaseModel: database.BaseModel{
+			ID:        wf.ID,
+			CreatedAt: wf.CreatedAt,
+			UpdatedAt: wf.UpdatedAt,
+		},
+		UserID:      wf.UserID,
+		Name:        wf.Name,
+		Description: wf.Description,
+		StepsJSON:   string(stepsJSON),
+	}
+}
+
+// modelToWorkflow 将 WorkflowModel 转换为 Workflow
+func modelToWorkflow(model *database.WorkflowModel) *Workflow {
+	wf := &Workflow{
+		ID:          model.ID,
+		UserID:      model.UserID,
+		Name:        model.Name,
+		Description: model.Description,
+		CreatedAt:   model.CreatedAt,
+		UpdatedAt:   model.UpdatedAt,
+	}
+	if model.StepsJSON != "" && model.StepsJSON != "null" {
+		json.Unmarshal([]byte(model.StepsJSON), &wf.Steps)
+	}
+	return wf
+}
+
+// runToModel 将 WorkflowRun 转换为 WorkflowRunModel
+func runToModel(run *WorkflowRun) *database.WorkflowRunModel {
+	inputsJSON, _ := json.Marshal(run.Inputs)
+	stepsJSON, _ := json.Marshal(run.Steps)
+	definitionJSON, _ := json.Marshal(run.Definition)
+	return &database.WorkflowRunModel{
+		BaseModel: database.BaseModel{
+			ID:        run.ID,
+			CreatedAt: run.CreatedAt,
+		},
+		WorkflowID:     run.WorkflowID,
+		WorkflowName:   run.WorkflowName,
+		UserID:         run.UserID,
+		Status:         string(run.Status),
+		InputsJSON:     string(inputsJSON),
+		StepsJSON:      string(stepsJSON),
+		DefinitionJSON: string(definitionJSON),
+		ErrorMessage:   run.ErrorMessage,
+		CompletedAt:    run.CompletedAt,
+	}
+}
+
+// modelToRun 将 WorkflowRunModel 转换为 WorkflowRun
+func modelToRun(model *database.WorkflowRunModel) *WorkflowRun {
+	run := &WorkflowRun{
+		ID:           model.ID,
+		WorkflowID:   model.WorkflowID,
+		WorkflowName: model.WorkflowName,
+		UserID:       model.UserID,
+		Status:       WorkflowRunStatus(model.Status),
+		ErrorMessage: model.ErrorMessage,
+		CreatedAt:    model.CreatedAt,
+		CompletedAt:  model.CompletedAt,
+	}
+	if model.InputsJSON != "" && model.InputsJSON != "null" {
+		json.Unmarshal([]byte(model.InputsJSON), &run.Inputs)
+	}
+	if model.StepsJSON != "" && model.StepsJSON != "null" {
+		json.Unmarshal([]byte(model.StepsJSON), &run.Steps)
+	}
+	if model.DefinitionJSON != "" && model.DefinitionJSON != "null" {
+		json.Unmarshal([]byte(model.DefinitionJSON), &run.Definition)
+	}
+	return run
+}
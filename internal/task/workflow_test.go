@@ -0,0 +1,170 @@
+package task
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmalldedede/agentbox/internal/agent"
+	"github.com/tmalldedede/agentbox/internal/provider"
+)
+
+func setupWorkflowManager(t *testing.T) *Manager {
+	t.Helper()
+	dir := t.TempDir()
+
+	providerMgr := provider.NewManager(filepath.Join(dir, "providers"), "test-key-32bytes-for-aes256!!")
+	providerMgr.Create(&provider.Provider{ID: "test-provider", Name: "Test Provider", Agents: []string{"claude-code"}})
+	agentMgr := agent.NewManager(filepath.Join(dir, "agents"), providerMgr, nil, nil, nil)
+	require.NoError(t, agentMgr.Create(&agent.Agent{
+		ID:         "test-agent",
+		Name:       "Test Agent",
+		Adapter:    "claude-code",
+		ProviderID: "test-provider",
+		Status:     "active",
+	}))
+
+	db := setupTestDB(t)
+	store, err := NewGormStore(db)
+	require.NoError(t, err)
+	wfStore, err := NewGormWorkflowStore(db)
+	require.NoError(t, err)
+
+	m := NewManager(store, agentMgr, nil, nil)
+	m.SetWorkflowStore(wfStore)
+	return m
+}
+
+// finishStepTask 模拟步骤 Task 结束
+func finishStepTask(t *testing.T, m *Manager, taskID string, status Status, text string) {
+	t.Helper()
+	task, err := m.GetTask(taskID)
+	require.NoError(t, err)
+	now := time.Now()
+	task.Status = status
+	task.CompletedAt = &now
+	if text != "" {
+		task.Result = &Result{Text: text}
+	}
+	if status == StatusFailed {
+		task.ErrorMessage = "boom"
+	}
+	require.NoError(t, m.store.Update(task))
+}
+
+func stepByID(run *WorkflowRun, id string) *StepRun {
+	for _, s := range run.Steps {
+		if s.StepID == id {
+			return s
+		}
+	}
+	return nil
+}
+
+func TestSortWorkflowSteps(t *testing.T) {
+	sorted, err := sortWorkflowSteps([]WorkflowStep{
+		{ID: "review", AgentID: "a", Prompt: "r", DependsOn: []string{"code", "docs"}},
+		{ID: "code", AgentID: "a", Prompt: "c", DependsOn: []string{"research"}},
+		{ID: "docs", AgentID: "a", Prompt: "d", DependsOn: []string{"research"}},
+		{ID: "research", AgentID: "a", Prompt: "q"},
+	})
+	require.NoError(t, err)
+	ids := make([]string, len(sorted))
+	for i, s := range sorted {
+		ids[i] = s.ID
+	}
+	assert.Equal(t, []string{"research", "code", "docs", "review"}, ids)
+
+	_, err = sortWorkflowSteps([]WorkflowStep{
+		{ID: "a", AgentID: "x", Prompt: "p", DependsOn: []string{"b"}},
+		{ID: "b", AgentID: "x", Prompt: "p", DependsOn: []string{"a"}},
+	})
+	assert.ErrorContains(t, err, "cycle")
+
+	_, err = sortWorkflowSteps([]WorkflowStep{{ID: "a", AgentID: "x", Prompt: "p", DependsOn: []string{"missing"}}})
+	assert.ErrorContains(t, err, "unknown step")
+
+	_, err = sortWorkflowSteps([]WorkflowStep{{ID: "bad-id", AgentID: "x", Prompt: "p"}})
+	assert.ErrorContains(t, err, "invalid step id")
+
+	_, err = sortWorkflowSteps(nil)
+	assert.Error(t, err)
+}
+
+func TestRenderStepPrompt(t *testing.T) {
+	ctx := &templateContext{
+		Inputs: map[string]string{"topic": "caching"},
+		Steps: map[string]*stepContext{
+			"research": {
+				Text:   "```json\n{\"summary\": \"use LRU\"}\n```",
+				Output: parseStructuredOutput("```json\n{\"summary\": \"use LRU\"}\n```"),
+				Files:  []OutputFile{{Name: "notes.md"}},
+			},
+		},
+	}
+
+	out, err := renderStepPrompt(WorkflowStep{
+		ID:     "code",
+		Prompt: "Implement {{.Inputs.topic}}: {{.Steps.research.Output.summary}} ({{range .Steps.research.Files}}{{.Name}}{{end}})",
+	}, ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "Implement caching: use LRU (notes.md)", out)
+
+	_, err = renderStepPrompt(WorkflowStep{ID: "x", Prompt: "{{.Inputs.missing}}"}, ctx)
+	assert.Error(t, err)
+}
+
+func TestWorkflowRun_FanOutFanIn(t *testing.T) {
+	m := setupWorkflowManager(t)
+
+	wf, err := m.CreateWorkflow(&CreateWorkflowRequest{
+		Name: "research-code-review",
+		Steps: []WorkflowStep{
+			{ID: "research", AgentID: "test-agent", Prompt: "Research {{.Inputs.topic}}"},
+			{ID: "code", AgentID: "test-agent", Prompt: "Code: {{.Steps.research.Text}}", DependsOn: []string{"research"}},
+			{ID: "docs", AgentID: "test-agent", Prompt: "Docs: {{.Steps.research.Text}}", DependsOn: []string{"research"}},
+			{ID: "review", AgentID: "test-agent", Prompt: "Review {{.Steps.code.Text}} {{.Steps.docs.Text}}", DependsOn: []string{"code", "docs"}},
+		},
+	})
+	require.NoError(t, err)
+
+	run, err := m.RunWorkflow(wf.ID, &RunWorkflowRequest{Inputs: map[string]string{"topic": "queues"}, UserID: "user-1"})
+	require.NoError(t, err)
+	assert.Equal(t, WorkflowRunRunning, run.Status)
+
+	research := stepByID(run, "research")
+	require.Equal(t, StepRunning, research.Status)
+	researchTask, err := m.GetTask(research.TaskID)
+	require.NoError(t, err)
+	assert.Equal(t, "Research queues", researchTask.Prompt)
+	assert.Equal(t, "user-1", researchTask.UserID)
+	assert.Equal(t, StepPending, stepByID(run, "code").Status)
+
+	// research 完成 → code/docs 并行启动
+	finishStepTask(t, m, research.TaskID, StatusCompleted, "findings")
+	m.advanceWorkflowRun(run.ID)
+	run, err = m.GetWorkflowRun(run.ID)
+	require.NoError(t, err)
+	code, docs := stepByID(run, "code"), stepByID(run, "docs")
+	require.Equal(t, StepRunning, code.Status)
+	require.Equal(t, StepRunning, docs.Status)
+	codeTask, _ := m.GetTask(code.TaskID)
+	assert.Equal(t, "Code: findings", codeTask.Prompt)
+
+	// 只完成 code 时 review 仍需等待
+	finishStepTask(t, m, code.TaskID, StatusCompleted, "patch")
+	m.advanceWorkflowRun(run.ID)
+	run, _ = m.GetWorkflowRun(run.ID)
+	assert.Equal(t, StepPending, stepByID(run, "review").Status)
+
+	// docs 失败 → review 跳过，运行失败
+	finishStepTask(t, m, docs.TaskID, StatusFailed, "")
+	m.advanceWorkflowRun(run.ID)
+	run, _ = m.GetWorkflowRun(run.ID)
+	assert.Equal(t, StepFailed, stepByID(run, "docs").Status)
+	assert.Equal(t, StepSkipped, stepByID(run, "review").Status)
+	assert.Equal(t, WorkflowRunFailed, run.Status)
+	assert.NotNil(t, run.CompletedAt)
+}
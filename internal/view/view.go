@@ -0,0 +1,185 @@
+// Package view 用户保存的列表视图
+//
+// 视图保存一组任务 / 批量任务的过滤条件（状态、Agent、关键字、标签选择器），
+// 列表与统计接口通过 view=<id> 引用，请求中显式传入的参数优先于视图中的条件。
+package view
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tmalldedede/agentbox/internal/apperr"
+	"github.com/tmalldedede/agentbox/internal/database"
+	"github.com/tmalldedede/agentbox/internal/labels"
+	"gorm.io/gorm"
+)
+
+// ErrViewNotFound 视图不存在
+var ErrViewNotFound = apperr.NotFound("view")
+
+// Resource 视图适用的列表
+type Resource string
+
+const (
+	ResourceTasks   Resource = "tasks"
+	ResourceBatches Resource = "batches"
+)
+
+// IsValid 检查资源类型是否有效
+func (r Resource) IsValid() bool {
+	return r == ResourceTasks || r == ResourceBatches
+}
+
+// Filter 视图保存的过滤条件
+type Filter struct {
+	Status  string `json:"status,omitempty"`
+	AgentID string `json:"agent_id,omitempty"`
+	Search  string `json:"search,omitempty"` // 仅任务列表
+	Labels  string `json:"labels,omitempty"` // 标签选择器，如 "project=billing,ticket"
+}
+
+// View 保存的视图
+type View struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Name      string    `json:"name"`
+	Resource  Resource  `json:"resource"`
+	Filter    Filter    `json:"filter"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Validate 校验视图
+func (v *View) Validate() error {
+	if strings.TrimSpace(v.Name) == "" {
+		return apperr.BadRequest("name is required")
+	}
+	if !v.Resource.IsValid() {
+		return apperr.BadRequestf("invalid resource: %s (expected tasks or batches)", v.Resource)
+	}
+	if _, err := labels.Parse(v.Filter.Labels); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GormStore 视图 GORM 存储
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore 创建视图存储
+func NewGormStore(db *gorm.DB) (*GormStore, error) {
+	if err := db.AutoMigrate(&database.SavedViewModel{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate saved view table: %w", err)
+	}
+	return &GormStore{db: db}, nil
+}
+
+// Create 创建视图
+func (s *GormStore) Create(v *View) error {
+	if err := v.Validate(); err != nil {
+		return err
+	}
+	now := time.Now()
+	v.ID = "view-" + uuid.New().String()[:8]
+	v.CreatedAt = now
+	v.UpdatedAt = now
+	return s.db.Create(toModel(v)).Error
+}
+
+// Get 获取视图
+func (s *GormStore) Get(id string) (*View, error) {
+	var model database.SavedViewModel
+	if err := s.db.First(&model, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrViewNotFound
+		}
+		return nil, err
+	}
+	return fromModel(&model), nil
+}
+
+// Update 更新视图名称与过滤条件
+func (s *GormStore) Update(v *View) error {
+	if err := v.Validate(); err != nil {
+		return err
+	}
+	v.UpdatedAt = time.Now()
+	model := toModel(v)
+	result := s.db.Model(&database.SavedViewModel{}).Where("id = ?", v.ID).Updates(map[string]interface{}{
+		"name":        model.Name,
+		"resource":    model.Resource,
+		"filter_json": model.FilterJSON,
+		"updated_at":  model.UpdatedAt,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrViewNotFound
+	}
+	return nil
+}
+
+// Delete 删除视图
+func (s *GormStore) Delete(id string) error {
+	result := s.db.Delete(&database.SavedViewModel{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrViewNotFound
+	}
+	return nil
+}
+
+// List 列出用户的视图（resource 为空表示全部）
+func (s *GormStore) List(userID string, resource Resource) ([]*View, error) {
+	query := s.db.Where("user_id = ?", userID).Order("name ASC")
+	if resource != "" {
+		query = query.Where("resource = ?", resource)
+	}
+	var models []database.SavedViewModel
+	if err := query.Find(&models).Error; err != nil {
+		return nil, err
+	}
+	views := make([]*View, len(models))
+	for i := range models {
+		views[i] = fromModel(&models[i])
+	}
+	return views, nil
+}
+
+func toModel(v *View) *database.SavedViewModel {
+	filterJSON, _ := json.Marshal(v.Filter)
+	return &database.SavedViewModel{
+		BaseModel: database.BaseModel{
+			ID:        v.ID,
+			CreatedAt: v.CreatedAt,
+			UpdatedAt: v.UpdatedAt,
+		},
+		UserID:     v.UserID,
+		Name:       v.Name,
+		Resource:   string(v.Resource),
+		FilterJSON: string(filterJSON),
+	}
+}
+
+func fromModel(m *database.SavedViewModel) *View {
+	v := &View{
+		ID:        m.ID,
+		UserID:    m.UserID,
+		Name:      m.Name,
+		Resource:  Resource(m.Resource),
+		CreatedAt: m.CreatedAt,
+		UpdatedAt: m.UpdatedAt,
+	}
+	if m.FilterJSON != "" {
+		json.Unmarshal([]byte(m.FilterJSON), &v.Filter)
+	}
+	return v
+}
@@ -2,10 +2,12 @@ package webhook
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/tmalldedede/agentbox/internal/database"
+	"github.com/tmalldedede/agentbox/internal/provider"
 )
 
 // DBStore 基于数据库的 Webhook 存储
@@ -30,7 +32,10 @@ func (s *DBStore) Create(w *Webhook) error {
 	w.CreatedAt = now
 	w.UpdatedAt = now
 
-	model := s.toModel(w)
+	model, err := s.toModel(w)
+	if err != nil {
+		return err
+	}
 	if err := s.repo.Create(model); err != nil {
 		return err
 	}
@@ -44,7 +49,7 @@ func (s *DBStore) Get(id string) (*Webhook, error) {
 	if err != nil {
 		return nil, ErrWebhookNotFound
 	}
-	return s.fromModel(model), nil
+	return s.fromModel(model)
 }
 
 // Update 更新 Webhook
@@ -56,7 +61,10 @@ func (s *DBStore) Update(w *Webhook) error {
 	}
 
 	w.UpdatedAt = time.Now()
-	model := s.toModel(w)
+	model, err := s.toModel(w)
+	if err != nil {
+		return err
+	}
 	return s.repo.Update(model)
 }
 
@@ -78,7 +86,9 @@ func (s *DBStore) List() ([]*Webhook, error) {
 
 	result := make([]*Webhook, 0, len(models))
 	for i := range models {
-		result = append(result, s.fromModel(&models[i]))
+		// 密钥无法解密的 Webhook 以停用状态列出
+		w, _ := s.fromModel(&models[i])
+		result = append(result, w)
 	}
 	return result, nil
 }
@@ -92,7 +102,10 @@ func (s *DBStore) ListByEvent(event string) ([]*Webhook, error) {
 
 	result := make([]*Webhook, 0)
 	for i := range models {
-		w := s.fromModel(&models[i])
+		w, err := s.fromModel(&models[i])
+		if err != nil {
+			continue // 不发送未签名的投递
+		}
 		// Events 为空表示订阅所有事件
 		if len(w.Events) == 0 {
 			result = append(result, w)
@@ -108,8 +121,24 @@ func (s *DBStore) ListByEvent(event string) ([]*Webhook, error) {
 	return result, nil
 }
 
-// toModel 将领域模型转为数据库模型
-func (s *DBStore) toModel(w *Webhook) *database.WebhookModel {
+// RewriteSecrets 遍历所有 Webhook 的签名密钥，fn 返回的值与原值不同时写回（主密钥轮换）
+func (s *DBStore) RewriteSecrets(fn func(stored string) string) error {
+	models, err := s.repo.List()
+	if err != nil {
+		return err
+	}
+	for _, m := range models {
+		if v := fn(m.Secret); v != m.Secret {
+			if err := s.repo.UpdateSecret(m.ID, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// toModel 将领域模型转为数据库模型（签名密钥加密存储）
+func (s *DBStore) toModel(w *Webhook) (*database.WebhookModel, error) {
 	eventsJSON := ""
 	if len(w.Events) > 0 {
 		b, _ := json.Marshal(w.Events)
@@ -122,6 +151,11 @@ func (s *DBStore) toModel(w *Webhook) *database.WebhookModel {
 		name = name[:255]
 	}
 
+	secret, err := provider.SealSecret(w.Secret)
+	if err != nil {
+		return nil, err
+	}
+
 	return &database.WebhookModel{
 		BaseModel: database.BaseModel{
 			ID:        w.ID,
@@ -130,26 +164,36 @@ func (s *DBStore) toModel(w *Webhook) *database.WebhookModel {
 		},
 		Name:      name,
 		URL:       w.URL,
-		Secret:    w.Secret,
+		Secret:    secret,
 		Events:    eventsJSON,
 		IsEnabled: w.IsActive,
-	}
+	}, nil
 }
 
 // fromModel 将数据库模型转为领域模型
-func (s *DBStore) fromModel(m *database.WebhookModel) *Webhook {
+//
+// 签名密钥无法解密时返回错误，同时返回停用状态、不含密钥的 Webhook（不降级为未签名投递，
+// 也不暴露密文；启动校验会报告该问题）
+func (s *DBStore) fromModel(m *database.WebhookModel) (*Webhook, error) {
 	var events []string
 	if m.Events != "" {
 		_ = json.Unmarshal([]byte(m.Events), &events)
 	}
-
-	return &Webhook{
+	w := &Webhook{
 		ID:        m.ID,
 		URL:       m.URL,
-		Secret:    m.Secret,
 		Events:    events,
 		IsActive:  m.IsEnabled,
 		CreatedAt: m.CreatedAt,
 		UpdatedAt: m.UpdatedAt,
 	}
+
+	secret, err := provider.OpenSecret(m.Secret)
+	if err != nil {
+		log.Error("failed to decrypt webhook secret, webhook disabled", "id", m.ID, "error", err)
+		w.IsActive = false
+		return w, fmt.Errorf("webhook %s: failed to decrypt secret: %w", m.ID, err)
+	}
+	w.Secret = secret
+	return w, nil
 }
@@ -46,6 +46,16 @@ func NewManagerWithStore(store Store) *Manager {
 	}
 }
 
+// RewriteSecrets 遍历所有 Webhook 的签名密钥（主密钥轮换），存储不保存密文时跳过
+func (m *Manager) RewriteSecrets(fn func(stored string) string) error {
+	if s, ok := m.store.(interface {
+		RewriteSecrets(fn func(stored string) string) error
+	}); ok {
+		return s.RewriteSecrets(fn)
+	}
+	return nil
+}
+
 // Create 创建 Webhook
 func (m *Manager) Create(req *CreateWebhookRequest) (*Webhook, error) {
 	w := &Webhook{
@@ -70,7 +80,8 @@ func (m *Manager) Get(id string) (*Webhook, error) {
 // Update 更新 Webhook
 func (m *Manager) Update(id string, req *UpdateWebhookRequest) (*Webhook, error) {
 	w, err := m.store.Get(id)
-	if err != nil {
+	// 密钥无法解密时只允许通过设置新密钥修复
+	if err != nil && (w == nil || req.Secret == "") {
 		return nil, err
 	}
 
@@ -22,6 +22,9 @@ const (
 	EventTaskFailed    = "task.failed"
 	EventSessionStart  = "session.started"
 	EventSessionStop   = "session.stopped"
+
+	// Provider 熔断器状态变化（closed / open / half_open）
+	EventProviderCircuit = "provider.circuit_changed"
 )
 
 // AllEvents 所有支持的事件
@@ -31,6 +34,7 @@ var AllEvents = []string{
 	EventTaskFailed,
 	EventSessionStart,
 	EventSessionStop,
+	EventProviderCircuit,
 }
 
 // WebhookPayload Webhook 推送的数据结构
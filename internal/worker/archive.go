@@ -0,0 +1,201 @@
+package worker
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// packPath 将 path（文件或目录）打包为 tar，条目路径相对于 root
+func packPath(root, path string) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" && p != path {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// unpack 解压 tar 到 dst 目录
+//
+// 归档来自远程节点，不可信：拒绝指向 dst 之外的条目与符号链接，不经由已存在的符号链接写入，
+// 解压完成后再校验所有符号链接解析后仍在 dst 内。
+func unpack(data []byte, dst string) error {
+	dst, err := filepath.Abs(dst)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	realDst, err := filepath.EvalSymlinks(dst)
+	if err != nil {
+		return err
+	}
+
+	var links []string
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, filepath.FromSlash(header.Name))
+		if !within(dst, target) {
+			return fmt.Errorf("archive entry escapes destination: %s", header.Name)
+		}
+		if target == dst {
+			continue
+		}
+		// 父目录中不能有符号链接，否则可借助先解出的链接写到 dst 之外
+		if err := checkNoSymlink(dst, filepath.Dir(target)); err != nil {
+			return fmt.Errorf("archive entry %s: %w", header.Name, err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := removeSymlink(target); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(target, os.FileMode(header.Mode)|0700); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if filepath.IsAbs(header.Linkname) || !within(dst, filepath.Join(filepath.Dir(target), filepath.FromSlash(header.Linkname))) {
+				return fmt.Errorf("archive entry %s: symlink target escapes destination: %s", header.Name, header.Linkname)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			os.Remove(target)
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+			links = append(links, target)
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := removeSymlink(target); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|oNoFollow, os.FileMode(header.Mode))
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			// 保留修改时间，避免同步后未变更的文件被识别为产出文件
+			os.Chtimes(target, header.ModTime, header.ModTime)
+		}
+	}
+
+	// 链接之间可能相互引用（如 a -> . 与 b -> a/..），逐个按实际解析结果再校验一次
+	for _, link := range links {
+		resolved, err := filepath.EvalSymlinks(link)
+		if err != nil {
+			continue // 悬空链接不指向任何文件
+		}
+		if !within(realDst, resolved) {
+			os.Remove(link)
+			return fmt.Errorf("archive symlink escapes destination: %s", link)
+		}
+	}
+	return nil
+}
+
+// within path 是否为 root 或位于 root 之下（均为已 Clean 的绝对路径）
+func within(root, path string) bool {
+	return path == root || strings.HasPrefix(path, root+string(os.PathSeparator))
+}
+
+// checkNoSymlink 校验 root 到 dir 之间（不含 root）的已存在路径均不是符号链接
+func checkNoSymlink(root, dir string) error {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		return err
+	}
+	cur := root
+	for _, part := range strings.Split(rel, string(os.PathSeparator)) {
+		cur = filepath.Join(cur, part)
+		info, err := os.Lstat(cur)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("parent %s is a symlink", cur)
+		}
+	}
+	return nil
+}
+
+// removeSymlink 删除 path 处已存在的符号链接（由同名目录或文件替换），避免经由链接写入
+func removeSymlink(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return nil
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tarEntry 构造归档的条目（Linkname 非空时为符号链接）
+type tarEntry struct {
+	name     string
+	linkname string
+	body     string
+}
+
+func buildTar(t *testing.T, entries ...tarEntry) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, e := range entries {
+		h := &tar.Header{Name: e.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(e.body))}
+		if e.linkname != "" {
+			h = &tar.Header{Name: e.name, Mode: 0777, Typeflag: tar.TypeSymlink, Linkname: e.linkname}
+		}
+		require.NoError(t, tw.WriteHeader(h))
+		if e.linkname == "" {
+			_, err := tw.Write([]byte(e.body))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func TestUnpack_RoundTrip(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "sub", "a.txt"), []byte("hello"), 0644))
+	require.NoError(t, os.Symlink("sub/a.txt", filepath.Join(src, "link")))
+
+	data, err := packPath(src, src)
+	require.NoError(t, err)
+	dst := t.TempDir()
+	require.NoError(t, unpack(data, dst))
+
+	got, err := os.ReadFile(filepath.Join(dst, "link"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(got))
+
+	// 再次同步：已存在的文件与链接被覆盖
+	require.NoError(t, unpack(data, dst))
+}
+
+func TestUnpack_RejectsMaliciousArchives(t *testing.T) {
+	outside := t.TempDir()
+
+	cases := map[string][]tarEntry{
+		"path traversal":     {{name: "../evil", body: "x"}},
+		"absolute symlink":   {{name: "x", linkname: "/"}},
+		"escaping symlink":   {{name: "x", linkname: "../../"}},
+		"write through link": {{name: "x", linkname: "."}, {name: "x/../../evil", body: "x"}},
+		"chained symlinks":   {{name: "a", linkname: "."}, {name: "b", linkname: "a/.."}},
+		"file under symlink": {{name: "d", linkname: "sub"}, {name: "sub/keep", body: "x"}, {name: "d/evil", body: "x"}},
+	}
+	for name, entries := range cases {
+		t.Run(name, func(t *testing.T) {
+			dst := filepath.Join(outside, name, "workspace")
+			err := unpack(buildTar(t, entries...), dst)
+			assert.Error(t, err)
+			_, statErr := os.Stat(filepath.Join(outside, name, "evil"))
+			assert.True(t, os.IsNotExist(statErr))
+		})
+	}
+
+	// 经由已存在的指向外部的链接写入（如 x -> / 后写 x/etc/...）
+	dst := t.TempDir()
+	target := t.TempDir()
+	require.NoError(t, os.Symlink(target, filepath.Join(dst, "x")))
+	err := unpack(buildTar(t, tarEntry{name: "x/evil", body: "x"}), dst)
+	assert.Error(t, err)
+	_, statErr := os.Stat(filepath.Join(target, "evil"))
+	assert.True(t, os.IsNotExist(statErr))
+
+	// 目标文件本身是指向外部的链接：替换链接而不是写入链接目标
+	require.NoError(t, os.WriteFile(filepath.Join(target, "f"), []byte("orig"), 0644))
+	require.NoError(t, os.Symlink(filepath.Join(target, "f"), filepath.Join(dst, "f")))
+	require.NoError(t, unpack(buildTar(t, tarEntry{name: "f", body: "new"}), dst))
+	got, err := os.ReadFile(filepath.Join(target, "f"))
+	require.NoError(t, err)
+	assert.Equal(t, "orig", string(got))
+}
@@ -0,0 +1,4 @@
+package worker
+
+// oNoFollow Windows 不支持 O_NOFOLLOW，依赖解压前的符号链接检查
+const oNoFollow = 0
@@ -0,0 +1,439 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/tmalldedede/agentbox/internal/container"
+)
+
+// Options Worker 配置
+type Options struct {
+	ServerURL         string            // 控制面地址，如 http://control-plane:18080
+	Token             string            // Worker 认证 token（与控制面 AGENTBOX_WORKER_TOKEN 一致）
+	ID                string            // 节点 ID，默认使用主机名
+	Name              string            // 节点显示名称
+	Version           string            // AgentBox 版本
+	Labels            map[string]string // 节点标签，供 Agent 的 node_selector 匹配
+	Capacity          int               // 最大并发会话数，0 表示不限
+	WorkspaceBase     string            // 本地工作空间目录
+	PullImages        bool              // 允许拉取本地没有的镜像
+	HeartbeatInterval time.Duration
+}
+
+// Client Worker 端：连接控制面并代为执行容器操作
+type Client struct {
+	opts       Options
+	containers container.Manager
+
+	conn       *websocket.Conn
+	writeMu    sync.Mutex
+	serverBase string
+
+	mu      sync.Mutex
+	streams map[string]context.CancelFunc
+}
+
+// NewClient 创建 Worker 客户端
+func NewClient(opts Options, containers container.Manager) *Client {
+	if opts.ID == "" {
+		opts.ID, _ = os.Hostname()
+	}
+	if opts.HeartbeatInterval <= 0 {
+		opts.HeartbeatInterval = DefaultHeartbeatInterval
+	}
+	if abs, err := filepath.Abs(opts.WorkspaceBase); err == nil {
+		opts.WorkspaceBase = abs
+	}
+	return &Client{
+		opts:       opts,
+		containers: containers,
+		streams:    make(map[string]context.CancelFunc),
+	}
+}
+
+// Run 连接控制面并处理请求，断开后按指数退避重连，直到 ctx 结束
+func (c *Client) Run(ctx context.Context) error {
+	backoff := time.Second
+	for {
+		start := time.Now()
+		err := c.serve(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if time.Since(start) > time.Minute {
+			backoff = time.Second
+		}
+		log.Warn("disconnected from control plane, reconnecting", "error", err, "backoff", backoff)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > 30*time.Second {
+			backoff = 30 * time.Second
+		}
+	}
+}
+
+// connectURL 将控制面地址转换为 WebSocket 连接地址
+func connectURL(server string) (string, error) {
+	u, err := url.Parse(strings.TrimRight(server, "/"))
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http", "ws":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("unsupported server url scheme: %q", u.Scheme)
+	}
+	u.Path += ConnectPath
+	return u.String(), nil
+}
+
+// serve 建立一次连接：注册、心跳并处理请求，连接断开时返回
+func (c *Client) serve(ctx context.Context) error {
+	target, err := connectURL(c.opts.ServerURL)
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+c.opts.Token)
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, target, header)
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("connect %s: %s", target, resp.Status)
+		}
+		return fmt.Errorf("connect %s: %w", target, err)
+	}
+	c.conn = conn
+	defer conn.Close()
+
+	connCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-connCtx.Done()
+		conn.Close()
+	}()
+
+	info := c.nodeInfo(connCtx)
+	payload, _ := json.Marshal(info)
+	if err := c.send(&Message{Type: TypeRegister, Payload: payload}); err != nil {
+		return err
+	}
+
+	var msg Message
+	if err := conn.ReadJSON(&msg); err != nil {
+		return err
+	}
+	if msg.Type != TypeWelcome {
+		return fmt.Errorf("expected welcome message, got %q", msg.Type)
+	}
+	var welcome Welcome
+	if err := json.Unmarshal(msg.Payload, &welcome); err != nil {
+		return err
+	}
+	c.serverBase = filepath.Clean(welcome.WorkspaceBase)
+	log.Info("connected to control plane", "server", c.opts.ServerURL, "node_id", welcome.NodeID,
+		"capacity", info.Capacity, "images", len(info.Images))
+
+	go c.heartbeat(connCtx)
+	defer c.cancelStreams()
+
+	for {
+		var msg Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			return err
+		}
+		switch msg.Type {
+		case TypeRequest:
+			go c.handle(connCtx, &msg)
+		case TypeCancel:
+			c.release(msg.ID)
+		}
+	}
+}
+
+func (c *Client) send(msg *Message) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return c.conn.WriteJSON(msg)
+}
+
+func (c *Client) cancelStreams() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, cancel := range c.streams {
+		cancel()
+		delete(c.streams, id)
+	}
+}
+
+// nodeInfo 收集节点注册信息
+func (c *Client) nodeInfo(ctx context.Context) *NodeInfo {
+	hb := c.load(ctx)
+	return &NodeInfo{
+		ID:         c.opts.ID,
+		Name:       c.opts.Name,
+		Version:    c.opts.Version,
+		Labels:     c.opts.Labels,
+		Capacity:   c.opts.Capacity,
+		Images:     hb.Images,
+		PullImages: c.opts.PullImages,
+		Active:     hb.Active,
+	}
+}
+
+// load 当前运行中的容器数与本地镜像
+func (c *Client) load(ctx context.Context) *Heartbeat {
+	hb := &Heartbeat{Images: []string{}}
+	if ctrs, err := c.containers.ListContainers(ctx); err == nil {
+		for _, ctr := range ctrs {
+			if ctr.Status == container.StatusRunning {
+				hb.Active++
+			}
+		}
+	}
+	if images, err := c.containers.ListImages(ctx); err == nil {
+		for _, img := range images {
+			hb.Images = append(hb.Images, img.Tags...)
+		}
+	}
+	return hb
+}
+
+func (c *Client) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(c.opts.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			payload, _ := json.Marshal(c.load(ctx))
+			if err := c.send(&Message{Type: TypeHeartbeat, Payload: payload}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// localPath 将控制面工作空间路径映射到本地工作空间
+func (c *Client) localPath(serverPath string) (string, error) {
+	rel, err := filepath.Rel(c.serverBase, filepath.Clean(serverPath))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return "", fmt.Errorf("path %s is outside the workspace base", serverPath)
+	}
+	return filepath.Join(c.opts.WorkspaceBase, rel), nil
+}
+
+// handle 处理 RPC 请求并回复（控制面可通过 cancel 消息取消进行中的请求）
+func (c *Client) handle(ctx context.Context, req *Message) {
+	reqCtx, cancel := context.WithCancel(ctx)
+	c.mu.Lock()
+	c.streams[req.ID] = cancel
+	c.mu.Unlock()
+
+	result, err := c.dispatch(reqCtx, req)
+	if err == errStreamHandled {
+		return // 输出流结束时释放
+	}
+	c.release(req.ID)
+	if ctx.Err() != nil {
+		return // 连接正在关闭，控制面会以 ErrNodeLost 结束该调用
+	}
+
+	reply := &Message{Type: TypeResponse, ID: req.ID}
+	if err != nil {
+		reply.Error = err.Error()
+	} else if result != nil {
+		reply.Payload, err = json.Marshal(result)
+		if err != nil {
+			reply.Error = err.Error()
+		}
+	}
+	c.send(reply)
+}
+
+// release 取消请求上下文
+func (c *Client) release(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cancel, ok := c.streams[id]; ok {
+		cancel()
+		delete(c.streams, id)
+	}
+}
+
+func (c *Client) dispatch(ctx context.Context, req *Message) (interface{}, error) {
+	switch req.Method {
+	case MethodCreate:
+		var r createRequest
+		if err := json.Unmarshal(req.Payload, &r); err != nil || r.Config == nil {
+			return nil, fmt.Errorf("invalid create request")
+		}
+		for i, m := range r.Config.Mounts {
+			local, err := c.localPath(m.Source)
+			if err != nil {
+				continue // 非工作空间挂载按原路径使用
+			}
+			if err := os.MkdirAll(local, 0755); err != nil {
+				return nil, fmt.Errorf("failed to create workspace: %w", err)
+			}
+			r.Config.Mounts[i].Source = local
+		}
+		return c.containers.Create(ctx, r.Config)
+
+	case MethodStart, MethodStop, MethodRemove, MethodExec, MethodInspect:
+		var r containerRequest
+		if err := json.Unmarshal(req.Payload, &r); err != nil {
+			return nil, err
+		}
+		switch req.Method {
+		case MethodStart:
+			return nil, c.containers.Start(ctx, r.ContainerID)
+		case MethodStop:
+			return nil, c.containers.Stop(ctx, r.ContainerID)
+		case MethodRemove:
+			return nil, c.containers.Remove(ctx, r.ContainerID)
+		case MethodExec:
+			return c.containers.Exec(ctx, r.ContainerID, r.Cmd)
+		default:
+			return c.containers.Inspect(ctx, r.ContainerID)
+		}
+
+	case MethodExecStream, MethodLogs:
+		var r containerRequest
+		if err := json.Unmarshal(req.Payload, &r); err != nil {
+			return nil, err
+		}
+		var reader io.ReadCloser
+		var result interface{}
+		if req.Method == MethodExecStream {
+			s, err := c.containers.ExecStream(ctx, r.ContainerID, r.Cmd)
+			if err != nil {
+				return nil, err
+			}
+			reader, result = s.Reader, s.ExecID
+		} else {
+			rc, err := c.containers.Logs(ctx, r.ContainerID)
+			if err != nil {
+				return nil, err
+			}
+			reader = rc
+		}
+		// 先回复请求，再推送输出（同一连接上消息有序）
+		c.handleStream(ctx, req.ID, reader, result)
+		return nil, errStreamHandled
+
+	case MethodListContainers:
+		return c.containers.ListContainers(ctx)
+	case MethodListImages:
+		return c.containers.ListImages(ctx)
+	case MethodPullImage, MethodRemoveImage:
+		var r imageRequest
+		if err := json.Unmarshal(req.Payload, &r); err != nil {
+			return nil, err
+		}
+		if req.Method == MethodPullImage {
+			return nil, c.containers.PullImage(ctx, r.Image)
+		}
+		return nil, c.containers.RemoveImage(ctx, r.Image)
+
+	case MethodCopyTo:
+		var r copyRequest
+		if err := json.Unmarshal(req.Payload, &r); err != nil {
+			return nil, err
+		}
+		tmp, err := os.MkdirTemp("", "agentbox-copy-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmp)
+		if err := unpack(r.Archive, tmp); err != nil {
+			return nil, err
+		}
+		return nil, c.containers.CopyToContainer(ctx, r.ContainerID, filepath.Join(tmp, filepath.Base(r.Name)), r.DstPath)
+
+	case MethodPushWorkspace, MethodPullWorkspace:
+		var r workspaceRequest
+		if err := json.Unmarshal(req.Payload, &r); err != nil {
+			return nil, err
+		}
+		local, err := c.localPath(r.Path)
+		if err != nil {
+			return nil, err
+		}
+		if req.Method == MethodPushWorkspace {
+			return nil, unpack(r.Archive, local)
+		}
+		archive, err := packPath(local, local)
+		if err != nil {
+			return nil, err
+		}
+		return &workspaceRequest{Path: r.Path, Archive: archive}, nil
+
+	case MethodPing:
+		return nil, c.containers.Ping(ctx)
+	}
+	return nil, fmt.Errorf("unknown method: %s", req.Method)
+}
+
+// errStreamHandled 输出流请求已自行回复
+var errStreamHandled = errors.New("stream handled")
+
+// handleStream 回复输出流请求并推送输出，结束后发送 stream_end
+func (c *Client) handleStream(ctx context.Context, id string, reader io.ReadCloser, result interface{}) {
+	reply := &Message{Type: TypeResponse, ID: id}
+	if result != nil {
+		reply.Payload, _ = json.Marshal(result)
+	}
+	if err := c.send(reply); err != nil {
+		c.release(id)
+		reader.Close()
+		return
+	}
+
+	go func() {
+		<-ctx.Done()
+		reader.Close()
+	}()
+	go func() {
+		defer c.release(id)
+
+		end := &Message{Type: TypeStreamEnd, ID: id}
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := reader.Read(buf)
+			if n > 0 {
+				chunk := append([]byte(nil), buf[:n]...)
+				if c.send(&Message{Type: TypeStream, ID: id, Data: chunk}) != nil {
+					return
+				}
+			}
+			if err != nil {
+				if err != io.EOF && ctx.Err() == nil {
+					end.Error = err.Error()
+				}
+				break
+			}
+		}
+		c.send(end)
+	}()
+}
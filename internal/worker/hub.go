@@ -0,0 +1,309 @@
+package worker
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/tmalldedede/agentbox/internal/apperr"
+	"github.com/tmalldedede/agentbox/internal/labels"
+	"github.com/tmalldedede/agentbox/internal/logger"
+)
+
+// 模块日志器
+var log *slog.Logger
+
+func init() {
+	log = logger.Module("worker")
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  32 * 1024,
+	WriteBufferSize: 32 * 1024,
+	CheckOrigin: func(r *http.Request) bool {
+		return true // Worker 不是浏览器客户端，通过 token 认证
+	},
+}
+
+const (
+	// DefaultHeartbeatInterval Worker 心跳间隔
+	DefaultHeartbeatInterval = 10 * time.Second
+	// DefaultHeartbeatTimeout 超过该时间未收到任何消息即认为节点断开
+	DefaultHeartbeatTimeout = 30 * time.Second
+
+	registerTimeout = 10 * time.Second
+	writeTimeout    = 30 * time.Second
+)
+
+// Config Hub 配置
+type Config struct {
+	Token            string            // Worker 认证 token，为空时拒绝所有 Worker 连接
+	WorkspaceBase    string            // 控制面工作空间目录
+	LocalCapacity    int               // 本机最大并发会话数：0 不限，<0 表示不在本机运行会话
+	LocalLabels      map[string]string // 本机节点标签（参与标签选择）
+	HeartbeatTimeout time.Duration
+}
+
+// Placement 会话放置请求
+type Placement struct {
+	SessionID string
+	Image     string
+	Selector  labels.Selector // 节点标签选择器，为空表示任意节点
+}
+
+// NodeStatus 节点状态（API 展示用）
+type NodeStatus struct {
+	NodeInfo
+	Assigned    int       `json:"assigned"` // 控制面放置到该节点的会话数
+	ConnectedAt time.Time `json:"connected_at"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// Hub 控制面侧的 Worker 节点注册中心
+type Hub struct {
+	cfg Config
+
+	mu         sync.RWMutex
+	nodes      map[string]*Node
+	placements map[string]string // sessionID → nodeID（空字符串表示本机）
+	onLost     []func(nodeID string)
+}
+
+// NewHub 创建 Hub
+func NewHub(cfg Config) *Hub {
+	if cfg.HeartbeatTimeout <= 0 {
+		cfg.HeartbeatTimeout = DefaultHeartbeatTimeout
+	}
+	return &Hub{
+		cfg:        cfg,
+		nodes:      make(map[string]*Node),
+		placements: make(map[string]string),
+	}
+}
+
+// Enabled 是否允许 Worker 连接
+func (h *Hub) Enabled() bool {
+	return h.cfg.Token != ""
+}
+
+// OnNodeLost 注册节点断开回调（同一节点重连替换旧连接时不会触发）
+func (h *Hub) OnNodeLost(fn func(nodeID string)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.onLost = append(h.onLost, fn)
+}
+
+// HandleConnect 处理 Worker 的 WebSocket 连接
+//
+// 认证方式：Authorization: Bearer <token>；连接建立后 Worker 须先发送 register 消息。
+func (h *Hub) HandleConnect(w http.ResponseWriter, r *http.Request) {
+	if !h.Enabled() {
+		http.Error(w, "worker connections are disabled", http.StatusServiceUnavailable)
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(h.cfg.Token)) != 1 {
+		http.Error(w, "invalid worker token", http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Warn("worker upgrade failed", "error", err)
+		return
+	}
+
+	info, err := readRegister(conn)
+	if err != nil {
+		log.Warn("worker registration failed", "remote", r.RemoteAddr, "error", err)
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error()))
+		conn.Close()
+		return
+	}
+
+	node := newNode(h, conn, info)
+	welcome, _ := json.Marshal(&Welcome{NodeID: info.ID, WorkspaceBase: h.cfg.WorkspaceBase})
+	if err := node.send(&Message{Type: TypeWelcome, Payload: welcome}); err != nil {
+		conn.Close()
+		return
+	}
+
+	h.mu.Lock()
+	old := h.nodes[info.ID]
+	h.nodes[info.ID] = node
+	h.mu.Unlock()
+	if old != nil {
+		log.Info("worker reconnected, replacing previous connection", "node_id", info.ID)
+		old.conn.Close()
+	}
+
+	log.Info("worker connected", "node_id", info.ID, "name", info.Name, "capacity", info.Capacity,
+		"labels", info.Labels, "images", len(info.Images), "remote", r.RemoteAddr)
+	go node.readLoop()
+}
+
+// readRegister 读取并校验注册消息
+func readRegister(conn *websocket.Conn) (*NodeInfo, error) {
+	conn.SetReadDeadline(time.Now().Add(registerTimeout))
+	var msg Message
+	if err := conn.ReadJSON(&msg); err != nil {
+		return nil, err
+	}
+	if msg.Type != TypeRegister {
+		return nil, fmt.Errorf("expected register message, got %q", msg.Type)
+	}
+	var info NodeInfo
+	if err := json.Unmarshal(msg.Payload, &info); err != nil {
+		return nil, fmt.Errorf("invalid register payload: %w", err)
+	}
+	if info.ID == "" {
+		return nil, fmt.Errorf("node id is required")
+	}
+	if err := labels.Validate(info.Labels); err != nil {
+		return nil, err
+	}
+	if info.Name == "" {
+		info.Name = info.ID
+	}
+	return &info, nil
+}
+
+// removeNode 节点连接关闭后移除（已被新连接替换时不触发断开回调）
+func (h *Hub) removeNode(n *Node) {
+	h.mu.Lock()
+	if h.nodes[n.id] != n {
+		h.mu.Unlock()
+		return
+	}
+	delete(h.nodes, n.id)
+	for sessionID, nodeID := range h.placements {
+		if nodeID == n.id {
+			delete(h.placements, sessionID)
+		}
+	}
+	callbacks := append([]func(string){}, h.onLost...)
+	h.mu.Unlock()
+
+	log.Warn("worker disconnected", "node_id", n.id)
+	for _, fn := range callbacks {
+		fn(n.id)
+	}
+}
+
+// Node 获取已连接的节点
+func (h *Hub) Node(id string) (*Node, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	n, ok := h.nodes[id]
+	return n, ok
+}
+
+// Nodes 列出已连接的节点（按 ID 排序）
+func (h *Hub) Nodes() []*NodeStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	result := make([]*NodeStatus, 0, len(h.nodes))
+	for _, n := range h.nodes {
+		status := n.status()
+		status.Assigned = h.assignedLocked(n.id)
+		result = append(result, status)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// Place 为会话选择节点，返回 nil 表示在本机运行
+//
+// 候选节点须满足标签选择器，远程节点还须已有镜像或允许拉取镜像；
+// 在候选节点中选择剩余容量最多的一个，容量相同时优先本机。
+func (h *Hub) Place(req *Placement) (*Node, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var best *Node
+	bestFree, local := 0, false
+	if h.cfg.LocalCapacity >= 0 && req.Selector.Matches(h.cfg.LocalLabels) {
+		if free := freeSlots(h.cfg.LocalCapacity, h.assignedLocked("")); free > 0 {
+			bestFree, local = free, true
+		}
+	}
+
+	ids := make([]string, 0, len(h.nodes))
+	for id := range h.nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		n := h.nodes[id]
+		info := n.snapshot()
+		if !req.Selector.Matches(info.Labels) || !info.canRun(req.Image) {
+			continue
+		}
+		active := info.Active
+		if assigned := h.assignedLocked(id); assigned > active {
+			active = assigned
+		}
+		if free := freeSlots(info.Capacity, active); free > bestFree {
+			best, bestFree, local = n, free, false
+		}
+	}
+
+	if best == nil && !local {
+		if req.Selector.Empty() {
+			return nil, apperr.Unavailable("no node has free capacity for image " + req.Image)
+		}
+		return nil, apperr.Unavailable(fmt.Sprintf("no node matching %q has free capacity for image %s", req.Selector.String(), req.Image))
+	}
+	nodeID := ""
+	if best != nil {
+		nodeID = best.id
+	}
+	h.placements[req.SessionID] = nodeID
+	return best, nil
+}
+
+// Release 会话删除后释放其占用的节点容量
+func (h *Hub) Release(sessionID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.placements, sessionID)
+}
+
+func (h *Hub) assignedLocked(nodeID string) int {
+	count := 0
+	for _, id := range h.placements {
+		if id == nodeID {
+			count++
+		}
+	}
+	return count
+}
+
+// freeSlots 剩余容量（capacity 为 0 表示不限）
+func freeSlots(capacity, active int) int {
+	if capacity == 0 {
+		return int(^uint(0) >> 2)
+	}
+	return capacity - active
+}
+
+// canRun 节点是否能运行指定镜像
+func (info *NodeInfo) canRun(image string) bool {
+	if info.PullImages || image == "" {
+		return true
+	}
+	for _, tag := range info.Images {
+		if tag == image || (!strings.Contains(image, ":") && tag == image+":latest") {
+			return true
+		}
+	}
+	return false
+}
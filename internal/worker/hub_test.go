@@ -0,0 +1,224 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmalldedede/agentbox/internal/container"
+	"github.com/tmalldedede/agentbox/internal/labels"
+)
+
+// fakeContainers 记录调用的容器管理器
+type fakeContainers struct {
+	container.NoopManager
+
+	mu      sync.Mutex
+	created *container.CreateConfig
+	block   chan struct{} // 非空时 Exec 阻塞直到关闭
+}
+
+func (f *fakeContainers) Create(ctx context.Context, cfg *container.CreateConfig) (*container.Container, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.created = cfg
+	return &container.Container{ID: "ctr-1", Name: cfg.Name, Image: cfg.Image, Status: container.StatusCreated}, nil
+}
+
+func (f *fakeContainers) Start(ctx context.Context, id string) error { return nil }
+
+func (f *fakeContainers) Exec(ctx context.Context, id string, cmd []string) (*container.ExecResult, error) {
+	if f.block != nil {
+		select {
+		case <-f.block:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return &container.ExecResult{Stdout: id + ":" + strings.Join(cmd, " ")}, nil
+}
+
+func (f *fakeContainers) ExecStream(ctx context.Context, id string, cmd []string) (*container.ExecStream, error) {
+	done := make(chan struct{})
+	close(done)
+	return &container.ExecStream{ExecID: "exec-1", Reader: io.NopCloser(strings.NewReader("line 1\nline 2\n")), Done: done}, nil
+}
+
+func (f *fakeContainers) ListContainers(ctx context.Context) ([]*container.Container, error) {
+	return []*container.Container{{ID: "other", Status: container.StatusRunning}}, nil
+}
+
+func (f *fakeContainers) ListImages(ctx context.Context) ([]*container.Image, error) {
+	return []*container.Image{{ID: "img", Tags: []string{"agent:v1"}}}, nil
+}
+
+func (f *fakeContainers) Ping(ctx context.Context) error { return nil }
+
+type testCluster struct {
+	hub        *Hub
+	serverBase string
+	workerBase string
+	fake       *fakeContainers
+	stop       context.CancelFunc
+	lost       chan string
+}
+
+func startCluster(t *testing.T, capacity int, nodeLabels map[string]string) *testCluster {
+	t.Helper()
+	tc := &testCluster{
+		serverBase: t.TempDir(),
+		workerBase: t.TempDir(),
+		fake:       &fakeContainers{},
+		lost:       make(chan string, 1),
+	}
+	tc.hub = NewHub(Config{Token: "secret", WorkspaceBase: tc.serverBase, LocalCapacity: -1})
+	tc.hub.OnNodeLost(func(id string) { tc.lost <- id })
+
+	srv := httptest.NewServer(http.HandlerFunc(tc.hub.HandleConnect))
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tc.stop = cancel
+	t.Cleanup(cancel)
+	client := NewClient(Options{
+		ServerURL:     srv.URL,
+		Token:         "secret",
+		ID:            "node-a",
+		Labels:        nodeLabels,
+		Capacity:      capacity,
+		WorkspaceBase: tc.workerBase,
+	}, tc.fake)
+	go client.Run(ctx)
+
+	require.Eventually(t, func() bool { return len(tc.hub.Nodes()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	return tc
+}
+
+func TestHub_RejectsInvalidToken(t *testing.T) {
+	hub := NewHub(Config{Token: "secret"})
+	srv := httptest.NewServer(http.HandlerFunc(hub.HandleConnect))
+	defer srv.Close()
+
+	client := NewClient(Options{ServerURL: srv.URL, Token: "wrong", ID: "node-x"}, &fakeContainers{})
+	err := client.serve(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "401")
+	assert.Empty(t, hub.Nodes())
+}
+
+func TestHub_PlacementAndRemoteExecution(t *testing.T) {
+	tc := startCluster(t, 2, map[string]string{"gpu": "true"})
+	ctx := context.Background()
+
+	nodes := tc.hub.Nodes()
+	assert.Equal(t, "node-a", nodes[0].ID)
+	assert.Equal(t, []string{"agent:v1"}, nodes[0].Images)
+	assert.Equal(t, 1, nodes[0].Active)
+
+	// 标签与镜像不匹配时无可用节点（本机已禁用）
+	noGPU, _ := labels.Parse("gpu=false")
+	_, err := tc.hub.Place(&Placement{SessionID: "s0", Image: "agent:v1", Selector: noGPU})
+	assert.Error(t, err)
+	_, err = tc.hub.Place(&Placement{SessionID: "s0", Image: "missing:v1"})
+	assert.Error(t, err)
+
+	gpu, _ := labels.Parse("gpu")
+	node, err := tc.hub.Place(&Placement{SessionID: "s1", Image: "agent:v1", Selector: gpu})
+	require.NoError(t, err)
+	require.NotNil(t, node)
+
+	// 容量 2：负载取上报的运行容器数与已放置会话数中的较大者
+	_, err = tc.hub.Place(&Placement{SessionID: "s2", Image: "agent:v1"})
+	require.NoError(t, err)
+	_, err = tc.hub.Place(&Placement{SessionID: "s3", Image: "agent:v1"})
+	assert.Error(t, err)
+	tc.hub.Release("s1")
+	_, err = tc.hub.Place(&Placement{SessionID: "s3", Image: "agent:v1"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, tc.hub.Nodes()[0].Assigned)
+
+	// 挂载路径映射到 Worker 本地工作空间
+	workspace := filepath.Join(tc.serverBase, "agent-1-task-1")
+	ctr, err := node.Create(ctx, &container.CreateConfig{
+		Name:   "agentbox-test",
+		Image:  "agent:v1",
+		Mounts: []container.Mount{{Source: workspace, Target: "/workspace"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "ctr-1", ctr.ID)
+	assert.Equal(t, filepath.Join(tc.workerBase, "agent-1-task-1"), tc.fake.created.Mounts[0].Source)
+	assert.DirExists(t, tc.fake.created.Mounts[0].Source)
+
+	result, err := node.Exec(ctx, ctr.ID, []string{"echo", "hi"})
+	require.NoError(t, err)
+	assert.Equal(t, "ctr-1:echo hi", result.Stdout)
+
+	stream, err := node.ExecStream(ctx, ctr.ID, []string{"run"})
+	require.NoError(t, err)
+	assert.Equal(t, "exec-1", stream.ExecID)
+	output, err := io.ReadAll(stream.Reader)
+	require.NoError(t, err)
+	assert.Equal(t, "line 1\nline 2\n", string(output))
+	<-stream.Done
+
+	// 工作区同步：推送附件，拉回产出文件
+	require.NoError(t, os.MkdirAll(workspace, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(workspace, "input.txt"), []byte("in"), 0644))
+	require.NoError(t, node.PushWorkspace(ctx, workspace))
+	assert.FileExists(t, filepath.Join(tc.workerBase, "agent-1-task-1", "input.txt"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(tc.workerBase, "agent-1-task-1", "report.md"), []byte("done"), 0644))
+	require.NoError(t, node.PullWorkspace(ctx, workspace))
+	data, err := os.ReadFile(filepath.Join(workspace, "report.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "done", string(data))
+
+	assert.Error(t, node.PushWorkspace(ctx, t.TempDir()), "paths outside the workspace base are rejected")
+}
+
+func TestHub_NodeLostFailsInflightCalls(t *testing.T) {
+	tc := startCluster(t, 0, nil)
+	tc.fake.block = make(chan struct{})
+	defer close(tc.fake.block)
+
+	node, ok := tc.hub.Node("node-a")
+	require.True(t, ok)
+	_, err := tc.hub.Place(&Placement{SessionID: "s1", Image: "agent:v1"})
+	require.NoError(t, err)
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := node.Exec(context.Background(), "ctr-1", []string{"sleep"})
+		errCh <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	tc.stop()
+
+	select {
+	case err := <-errCh:
+		assert.True(t, errors.Is(err, ErrNodeLost), "got %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("in-flight call did not fail after disconnect")
+	}
+	select {
+	case id := <-tc.lost:
+		assert.Equal(t, "node-a", id)
+	case <-time.After(5 * time.Second):
+		t.Fatal("node lost callback not called")
+	}
+
+	_, ok = tc.hub.Node("node-a")
+	assert.False(t, ok)
+	_, err = node.Exec(context.Background(), "ctr-1", nil)
+	assert.ErrorIs(t, err, ErrNodeLost)
+}
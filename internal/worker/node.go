@@ -0,0 +1,419 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/tmalldedede/agentbox/internal/container"
+)
+
+// Node 已连接的远程节点，通过 RPC 实现 container.Manager
+type Node struct {
+	id   string
+	hub  *Hub
+	conn *websocket.Conn
+
+	writeMu sync.Mutex
+
+	mu          sync.Mutex
+	info        NodeInfo
+	connectedAt time.Time
+	lastSeen    time.Time
+	pending     map[string]chan *Message
+	streams     map[string]*stream
+	closed      chan struct{}
+}
+
+var _ container.Manager = (*Node)(nil)
+
+func newNode(h *Hub, conn *websocket.Conn, info *NodeInfo) *Node {
+	now := time.Now()
+	return &Node{
+		id:          info.ID,
+		hub:         h,
+		conn:        conn,
+		info:        *info,
+		connectedAt: now,
+		lastSeen:    now,
+		pending:     make(map[string]chan *Message),
+		streams:     make(map[string]*stream),
+		closed:      make(chan struct{}),
+	}
+}
+
+// ID 节点 ID
+func (n *Node) ID() string {
+	return n.id
+}
+
+func (n *Node) snapshot() NodeInfo {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.info
+}
+
+func (n *Node) status() *NodeStatus {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return &NodeStatus{NodeInfo: n.info, ConnectedAt: n.connectedAt, LastSeen: n.lastSeen}
+}
+
+func (n *Node) send(msg *Message) error {
+	n.writeMu.Lock()
+	defer n.writeMu.Unlock()
+	n.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return n.conn.WriteJSON(msg)
+}
+
+// readLoop 读取 Worker 消息，连接断开后结束所有进行中的调用与输出流
+func (n *Node) readLoop() {
+	defer n.shutdown()
+
+	timeout := n.hub.cfg.HeartbeatTimeout
+	for {
+		n.conn.SetReadDeadline(time.Now().Add(timeout))
+		var msg Message
+		if err := n.conn.ReadJSON(&msg); err != nil {
+			return
+		}
+
+		n.mu.Lock()
+		n.lastSeen = time.Now()
+		switch msg.Type {
+		case TypeHeartbeat:
+			var hb Heartbeat
+			if json.Unmarshal(msg.Payload, &hb) == nil {
+				n.info.Active = hb.Active
+				if hb.Images != nil {
+					n.info.Images = hb.Images
+				}
+			}
+		case TypeResponse:
+			if ch, ok := n.pending[msg.ID]; ok {
+				delete(n.pending, msg.ID)
+				ch <- &msg
+			}
+		case TypeStream:
+			if s, ok := n.streams[msg.ID]; ok {
+				s.write(msg.Data)
+			}
+		case TypeStreamEnd:
+			if s, ok := n.streams[msg.ID]; ok {
+				delete(n.streams, msg.ID)
+				var err error = io.EOF
+				if msg.Error != "" {
+					err = fmt.Errorf("worker %s: %s", n.id, msg.Error)
+				}
+				s.finish(err)
+			}
+		}
+		n.mu.Unlock()
+	}
+}
+
+func (n *Node) shutdown() {
+	n.conn.Close()
+
+	n.mu.Lock()
+	close(n.closed)
+	for id, s := range n.streams {
+		s.finish(ErrNodeLost)
+		delete(n.streams, id)
+	}
+	n.pending = make(map[string]chan *Message)
+	n.mu.Unlock()
+
+	n.hub.removeNode(n)
+}
+
+// call 发送 RPC 请求并等待响应（节点断开时返回 ErrNodeLost）
+func (n *Node) call(ctx context.Context, method string, req, resp interface{}) error {
+	return n.callWithID(ctx, uuid.New().String(), method, req, resp)
+}
+
+func (n *Node) callWithID(ctx context.Context, id, method string, req, resp interface{}) error {
+	msg := &Message{Type: TypeRequest, ID: id, Method: method}
+	if req != nil {
+		payload, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		msg.Payload = payload
+	}
+
+	ch := make(chan *Message, 1)
+	n.mu.Lock()
+	select {
+	case <-n.closed:
+		n.mu.Unlock()
+		return ErrNodeLost
+	default:
+	}
+	n.pending[id] = ch
+	n.mu.Unlock()
+
+	if err := n.send(msg); err != nil {
+		n.mu.Lock()
+		delete(n.pending, id)
+		n.mu.Unlock()
+		return fmt.Errorf("%w: %v", ErrNodeLost, err)
+	}
+
+	select {
+	case reply := <-ch:
+		if reply.Error != "" {
+			return fmt.Errorf("worker %s: %s", n.id, reply.Error)
+		}
+		if resp != nil && len(reply.Payload) > 0 {
+			return json.Unmarshal(reply.Payload, resp)
+		}
+		return nil
+	case <-n.closed:
+		return ErrNodeLost
+	case <-ctx.Done():
+		n.mu.Lock()
+		delete(n.pending, id)
+		n.mu.Unlock()
+		n.send(&Message{Type: TypeCancel, ID: id})
+		return ctx.Err()
+	}
+}
+
+// openStream 发起返回输出流的调用
+func (n *Node) openStream(ctx context.Context, method string, req interface{}, resp interface{}) (*stream, error) {
+	id := uuid.New().String()
+	s := newStream(func() {
+		n.mu.Lock()
+		delete(n.streams, id)
+		n.mu.Unlock()
+		n.send(&Message{Type: TypeCancel, ID: id})
+	})
+
+	n.mu.Lock()
+	n.streams[id] = s
+	n.mu.Unlock()
+
+	if err := n.callWithID(ctx, id, method, req, resp); err != nil {
+		n.mu.Lock()
+		delete(n.streams, id)
+		n.mu.Unlock()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Create 在节点上创建容器（挂载路径由节点映射到本地工作空间）
+func (n *Node) Create(ctx context.Context, config *container.CreateConfig) (*container.Container, error) {
+	var ctr container.Container
+	if err := n.call(ctx, MethodCreate, &createRequest{Config: config}, &ctr); err != nil {
+		return nil, err
+	}
+	return &ctr, nil
+}
+
+// Start 启动容器
+func (n *Node) Start(ctx context.Context, containerID string) error {
+	return n.call(ctx, MethodStart, &containerRequest{ContainerID: containerID}, nil)
+}
+
+// Stop 停止容器
+func (n *Node) Stop(ctx context.Context, containerID string) error {
+	return n.call(ctx, MethodStop, &containerRequest{ContainerID: containerID}, nil)
+}
+
+// Remove 删除容器
+func (n *Node) Remove(ctx context.Context, containerID string) error {
+	return n.call(ctx, MethodRemove, &containerRequest{ContainerID: containerID}, nil)
+}
+
+// Exec 在容器中执行命令
+func (n *Node) Exec(ctx context.Context, containerID string, cmd []string) (*container.ExecResult, error) {
+	var result container.ExecResult
+	if err := n.call(ctx, MethodExec, &containerRequest{ContainerID: containerID, Cmd: cmd}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ExecStream 在容器中执行命令，输出由节点实时推送
+func (n *Node) ExecStream(ctx context.Context, containerID string, cmd []string) (*container.ExecStream, error) {
+	var execID string
+	s, err := n.openStream(ctx, MethodExecStream, &containerRequest{ContainerID: containerID, Cmd: cmd}, &execID)
+	if err != nil {
+		return nil, err
+	}
+	return &container.ExecStream{ExecID: execID, Reader: s, Done: s.done}, nil
+}
+
+// Logs 获取容器日志
+func (n *Node) Logs(ctx context.Context, containerID string) (io.ReadCloser, error) {
+	return n.openStream(ctx, MethodLogs, &containerRequest{ContainerID: containerID}, nil)
+}
+
+// Inspect 获取容器信息
+func (n *Node) Inspect(ctx context.Context, containerID string) (*container.Container, error) {
+	var ctr container.Container
+	if err := n.call(ctx, MethodInspect, &containerRequest{ContainerID: containerID}, &ctr); err != nil {
+		return nil, err
+	}
+	return &ctr, nil
+}
+
+// ListContainers 列出节点上 AgentBox 管理的容器
+func (n *Node) ListContainers(ctx context.Context) ([]*container.Container, error) {
+	var ctrs []*container.Container
+	if err := n.call(ctx, MethodListContainers, nil, &ctrs); err != nil {
+		return nil, err
+	}
+	return ctrs, nil
+}
+
+// ListImages 列出节点上的镜像
+func (n *Node) ListImages(ctx context.Context) ([]*container.Image, error) {
+	var images []*container.Image
+	if err := n.call(ctx, MethodListImages, nil, &images); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// PullImage 在节点上拉取镜像
+func (n *Node) PullImage(ctx context.Context, imageName string) error {
+	return n.call(ctx, MethodPullImage, &imageRequest{Image: imageName}, nil)
+}
+
+// RemoveImage 删除节点上的镜像
+func (n *Node) RemoveImage(ctx context.Context, imageID string) error {
+	return n.call(ctx, MethodRemoveImage, &imageRequest{Image: imageID}, nil)
+}
+
+// CopyToContainer 将控制面本地文件/目录复制到节点上的容器
+func (n *Node) CopyToContainer(ctx context.Context, containerID string, srcPath string, dstPath string) error {
+	srcPath = filepath.Clean(srcPath)
+	archive, err := packPath(filepath.Dir(srcPath), srcPath)
+	if err != nil {
+		return fmt.Errorf("failed to pack %s: %w", srcPath, err)
+	}
+	return n.call(ctx, MethodCopyTo, &copyRequest{
+		ContainerID: containerID,
+		DstPath:     dstPath,
+		Name:        filepath.Base(srcPath),
+		Archive:     archive,
+	}, nil)
+}
+
+// PushWorkspace 将控制面工作区同步到节点（执行前调用，如附件文件）
+func (n *Node) PushWorkspace(ctx context.Context, dir string) error {
+	archive, err := packPath(dir, dir)
+	if err != nil {
+		return fmt.Errorf("failed to pack workspace: %w", err)
+	}
+	return n.call(ctx, MethodPushWorkspace, &workspaceRequest{Path: dir, Archive: archive}, nil)
+}
+
+// PullWorkspace 将节点上的工作区同步回控制面（执行后调用，便于收集产出文件）
+func (n *Node) PullWorkspace(ctx context.Context, dir string) error {
+	var resp workspaceRequest
+	if err := n.call(ctx, MethodPullWorkspace, &workspaceRequest{Path: dir}, &resp); err != nil {
+		return err
+	}
+	return unpack(resp.Archive, filepath.Clean(dir))
+}
+
+// Ping 检查节点 Docker 连接
+func (n *Node) Ping(ctx context.Context) error {
+	return n.call(ctx, MethodPing, nil, nil)
+}
+
+// Close 连接由 Hub 管理，此处不做处理
+func (n *Node) Close() error {
+	return nil
+}
+
+// stream 远程输出流，数据由 readLoop 写入缓冲区，不阻塞其他消息的处理
+type stream struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	err     error
+	notify  chan struct{}
+	done    chan struct{}
+	onClose func()
+	closed  bool
+}
+
+func newStream(onClose func()) *stream {
+	return &stream{
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		onClose: onClose,
+	}
+}
+
+func (s *stream) write(data []byte) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.buf.Write(data)
+	}
+	s.mu.Unlock()
+	s.wake()
+}
+
+// finish 结束输出流（err 为 io.EOF 表示正常结束）
+func (s *stream) finish(err error) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+		close(s.done)
+	}
+	s.mu.Unlock()
+	s.wake()
+}
+
+func (s *stream) wake() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *stream) Read(p []byte) (int, error) {
+	for {
+		s.mu.Lock()
+		if s.buf.Len() > 0 {
+			n, _ := s.buf.Read(p)
+			s.mu.Unlock()
+			return n, nil
+		}
+		err := s.err
+		s.mu.Unlock()
+		if err != nil {
+			return 0, err
+		}
+		<-s.notify
+	}
+}
+
+func (s *stream) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	ended := s.err != nil
+	s.mu.Unlock()
+
+	if !ended {
+		s.onClose()
+	}
+	s.finish(io.ErrClosedPipe)
+	return nil
+}
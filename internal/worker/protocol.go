@@ -0,0 +1,118 @@
+// Package worker 远程 Worker 节点
+//
+// Worker 运行在其他机器上（agentbox worker），通过带认证的 WebSocket 连接控制面，
+// 上报容量、标签与本地镜像，并代表控制面在本机 Docker 上创建容器、执行命令。
+// 控制面侧的 Hub 维护已连接节点，每个 Node 实现 container.Manager，
+// session.Manager 按容量与标签选择节点后即可像操作本地容器一样操作远程容器。
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/tmalldedede/agentbox/internal/container"
+)
+
+// ConnectPath Worker 连接控制面的 WebSocket 路径
+const ConnectPath = "/api/v1/workers/connect"
+
+// ErrNodeLost 节点断开连接（进行中的调用与输出流均以此错误结束）
+var ErrNodeLost = errors.New("worker node disconnected")
+
+// MessageType 消息类型
+type MessageType string
+
+const (
+	TypeRegister  MessageType = "register"   // worker → server：注册节点
+	TypeWelcome   MessageType = "welcome"    // server → worker：注册成功
+	TypeHeartbeat MessageType = "heartbeat"  // worker → server：心跳（携带当前负载）
+	TypeRequest   MessageType = "request"    // server → worker：RPC 请求
+	TypeResponse  MessageType = "response"   // worker → server：RPC 响应
+	TypeStream    MessageType = "stream"     // worker → server：输出流数据块
+	TypeStreamEnd MessageType = "stream_end" // worker → server：输出流结束
+	TypeCancel    MessageType = "cancel"     // server → worker：关闭输出流
+)
+
+// RPC 方法
+const (
+	MethodCreate         = "create"
+	MethodStart          = "start"
+	MethodStop           = "stop"
+	MethodRemove         = "remove"
+	MethodExec           = "exec"
+	MethodExecStream     = "exec_stream"
+	MethodLogs           = "logs"
+	MethodInspect        = "inspect"
+	MethodListContainers = "list_containers"
+	MethodListImages     = "list_images"
+	MethodPullImage      = "pull_image"
+	MethodRemoveImage    = "remove_image"
+	MethodCopyTo         = "copy_to_container"
+	MethodPushWorkspace  = "push_workspace"
+	MethodPullWorkspace  = "pull_workspace"
+	MethodPing           = "ping"
+)
+
+// Message WebSocket 消息
+type Message struct {
+	Type    MessageType     `json:"type"`
+	ID      string          `json:"id,omitempty"`     // 请求 / 输出流 ID
+	Method  string          `json:"method,omitempty"` // RPC 方法
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Data    []byte          `json:"data,omitempty"` // 输出流数据块
+	Error   string          `json:"error,omitempty"`
+}
+
+// NodeInfo 节点注册信息
+type NodeInfo struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Version    string            `json:"version,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Capacity   int               `json:"capacity"`              // 最大并发会话数，0 表示不限
+	Images     []string          `json:"images,omitempty"`      // 本地已有的镜像标签
+	PullImages bool              `json:"pull_images,omitempty"` // 是否允许拉取本地没有的镜像
+	Active     int               `json:"active"`                // 当前运行中的容器数
+}
+
+// Welcome 注册成功响应
+type Welcome struct {
+	NodeID        string `json:"node_id"`
+	WorkspaceBase string `json:"workspace_base"` // 控制面工作空间目录，挂载路径据此映射到节点本地目录
+}
+
+// Heartbeat 心跳
+type Heartbeat struct {
+	Active int      `json:"active"`
+	Images []string `json:"images,omitempty"`
+}
+
+// containerRequest 针对单个容器的请求
+type containerRequest struct {
+	ContainerID string   `json:"container_id"`
+	Cmd         []string `json:"cmd,omitempty"`
+}
+
+// imageRequest 镜像请求
+type imageRequest struct {
+	Image string `json:"image"`
+}
+
+// copyRequest 复制文件到容器（Archive 为源路径的 tar 包，Name 为源路径的基础名）
+type copyRequest struct {
+	ContainerID string `json:"container_id"`
+	DstPath     string `json:"dst_path"`
+	Name        string `json:"name"`
+	Archive     []byte `json:"archive"`
+}
+
+// workspaceRequest 同步工作区（Path 为控制面路径，由节点映射到本地目录）
+type workspaceRequest struct {
+	Path    string `json:"path"`
+	Archive []byte `json:"archive,omitempty"`
+}
+
+// createRequest 创建容器
+type createRequest struct {
+	Config *container.CreateConfig `json:"config"`
+}